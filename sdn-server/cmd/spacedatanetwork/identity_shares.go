@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/keys"
+	"github.com/spacedatanetwork/sdn-server/internal/setup"
+	"github.com/spacedatanetwork/sdn-server/internal/vcard"
+	"github.com/spacedatanetwork/sdn-server/internal/wasm"
+)
+
+var splitIdentityCmd = &cobra.Command{
+	Use:   "split-identity",
+	Short: "Split the node mnemonic into M-of-N Shamir shares",
+	Long: `Splits the node's mnemonic into N shares, any M of which recover the identity.
+Fewer than M shares reveal nothing about the mnemonic.
+
+With --custodian, each share is encrypted to one custodian's X25519 public key
+(hex, one flag per share) and written as share-<i>.enc.json. Otherwise shares
+are written as share-<i>.txt, plus share-<i>.png QR codes with --qr.`,
+	RunE: runSplitIdentity,
+}
+
+var recoverIdentityCmd = &cobra.Command{
+	Use:   "recover-identity [share files...]",
+	Short: "Recover the node mnemonic from Shamir shares",
+	Long: `Reconstructs the node's mnemonic from any M of its shares and installs it,
+encrypted, as the node identity. The peer ID the mnemonic derives must match the
+one recorded in the shares (and --expect-peer-id, if set) before anything is written.
+
+Share files may be share text, QR code PNGs, or encrypted shares, which are opened
+with the --custodian-key files (hex X25519 private keys). Without files, share
+text is read from stdin one line at a time.`,
+	RunE: runRecoverIdentity,
+}
+
+var (
+	shareThreshold    int
+	shareCount        int
+	shareCustodians   []string
+	shareOutDir       string
+	shareQR           bool
+	recoverExpectPeer string
+	recoverKeyFiles   []string
+	recoverForce      bool
+)
+
+func init() {
+	splitIdentityCmd.Flags().IntVarP(&shareThreshold, "threshold", "m", 3, "shares needed to recover")
+	splitIdentityCmd.Flags().IntVarP(&shareCount, "shares", "n", 5, "shares to create")
+	splitIdentityCmd.Flags().StringArrayVar(&shareCustodians, "custodian", nil, "custodian X25519 public key (hex), one per share")
+	splitIdentityCmd.Flags().StringVarP(&shareOutDir, "out", "o", "", "directory to write shares to (required)")
+	splitIdentityCmd.Flags().BoolVar(&shareQR, "qr", false, "also write unencrypted shares as QR code PNGs")
+	splitIdentityCmd.Flags().StringVar(&wasmPath, "wasm", "", "path to hd-wallet.wasm")
+	_ = splitIdentityCmd.MarkFlagRequired("out")
+
+	recoverIdentityCmd.Flags().StringVar(&recoverExpectPeer, "expect-peer-id", "", "refuse shares for any other peer ID")
+	recoverIdentityCmd.Flags().StringArrayVar(&recoverKeyFiles, "custodian-key", nil, "file holding a custodian X25519 private key (hex)")
+	recoverIdentityCmd.Flags().BoolVar(&recoverForce, "force", false, "replace an existing node mnemonic")
+	recoverIdentityCmd.Flags().StringVar(&wasmPath, "wasm", "", "path to hd-wallet.wasm")
+
+	rootCmd.AddCommand(splitIdentityCmd)
+	rootCmd.AddCommand(recoverIdentityCmd)
+}
+
+// nodeKeyPassword resolves the mnemonic password: env > config > machine default.
+func nodeKeyPassword(cfg *config.Config) string {
+	if p := os.Getenv("SDN_KEY_PASSWORD"); p != "" {
+		return p
+	}
+	if cfg.Security.KeyPassword != "" {
+		return cfg.Security.KeyPassword
+	}
+	return keys.DeriveDefaultPassword()
+}
+
+// nodeMnemonicPath returns where the node keeps its encrypted mnemonic.
+func nodeMnemonicPath(cfg *config.Config) string {
+	return filepath.Join(filepath.Dir(cfg.Storage.Path), "keys", "mnemonic")
+}
+
+// loadHDWallet loads the HD wallet module from --wasm, HD_WALLET_WASM_PATH or
+// the development build location.
+func loadHDWallet(ctx context.Context) (*wasm.HDWalletModule, error) {
+	wp := strings.TrimSpace(wasmPath)
+	if wp == "" {
+		wp = os.Getenv("HD_WALLET_WASM_PATH")
+	}
+	if wp == "" {
+		wp = "../../hd-wallet-wasm/build-wasi/wasm/hd-wallet.wasm"
+	}
+	if _, err := os.Stat(wp); err != nil {
+		return nil, fmt.Errorf("hd-wallet.wasm not found at %q (set --wasm or HD_WALLET_WASM_PATH)", wp)
+	}
+	hw, err := wasm.NewHDWalletModule(ctx, wp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HD wallet WASM: %w", err)
+	}
+	return hw, nil
+}
+
+// peerIDDeriver returns the node's peer ID derivation for a mnemonic.
+func peerIDDeriver(hw *wasm.HDWalletModule) setup.IdentityDeriver {
+	return func(ctx context.Context, mnemonic string) (string, error) {
+		identity, err := hw.IdentityFromMnemonic(ctx, mnemonic, "", 0)
+		if err != nil {
+			return "", err
+		}
+		return identity.Info().PeerID, nil
+	}
+}
+
+func runSplitIdentity(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(shareCustodians) > 0 && len(shareCustodians) != shareCount {
+		return fmt.Errorf("got %d custodian keys for %d shares", len(shareCustodians), shareCount)
+	}
+	custodianKeys := make([][]byte, len(shareCustodians))
+	for i, k := range shareCustodians {
+		custodianKeys[i], err = hex.DecodeString(strings.TrimSpace(k))
+		if err != nil || len(custodianKeys[i]) != keys.X25519KeySize {
+			return fmt.Errorf("custodian key %d is not a hex X25519 public key", i+1)
+		}
+	}
+
+	mnemonicPath := nodeMnemonicPath(cfg)
+	data, err := os.ReadFile(mnemonicPath)
+	if err != nil {
+		return fmt.Errorf("failed to read mnemonic file %s: %w", mnemonicPath, err)
+	}
+	mnemonic := string(data)
+	if keys.IsMnemonicEncrypted(data) {
+		mnemonic, err = keys.DecryptMnemonic(data, nodeKeyPassword(cfg))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt mnemonic (wrong password?): %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	hw, err := loadHDWallet(ctx)
+	if err != nil {
+		return err
+	}
+	defer hw.Close(ctx)
+	peerID, err := peerIDDeriver(hw)(ctx, mnemonic)
+	if err != nil {
+		return fmt.Errorf("failed to derive identity: %w", err)
+	}
+
+	shares, err := keys.SplitMnemonic(mnemonic, peerID, shareThreshold, shareCount)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(shareOutDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", shareOutDir, err)
+	}
+
+	for i, share := range shares {
+		base := filepath.Join(shareOutDir, fmt.Sprintf("share-%d", share.Index))
+		if len(custodianKeys) > 0 {
+			enc, err := keys.EncryptShare(share, custodianKeys[i])
+			if err != nil {
+				return fmt.Errorf("failed to encrypt share %d: %w", share.Index, err)
+			}
+			encJSON, _ := json.MarshalIndent(enc, "", "  ")
+			if err := os.WriteFile(base+".enc.json", encJSON, 0600); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(base+".txt", []byte(share.String()+"\n"), 0600); err != nil {
+			return err
+		}
+		if shareQR {
+			png, err := vcard.ShareToQR(share, 512)
+			if err != nil {
+				return fmt.Errorf("failed to render share %d as QR: %w", share.Index, err)
+			}
+			if err := os.WriteFile(base+".png", png, 0600); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nSplit identity %s into %d shares; any %d recover it.\n", peerID, shareCount, shareThreshold)
+	fmt.Fprintf(os.Stderr, "Shares written to %s. Hand each to a different custodian and delete the local copies.\n", shareOutDir)
+	return nil
+}
+
+// readShareFile parses a share from share text, a QR code PNG, or an
+// encrypted share opened with one of the custodian keys.
+func readShareFile(path string, custodianKeys [][]byte) (keys.MnemonicShare, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return keys.MnemonicShare{}, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return vcard.QRToShare(data)
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		enc, err := keys.ParseEncryptedShare(data)
+		if err != nil {
+			return keys.MnemonicShare{}, err
+		}
+		for _, key := range custodianKeys {
+			if share, err := keys.DecryptShare(enc, key); err == nil {
+				return share, nil
+			}
+		}
+		return keys.MnemonicShare{}, fmt.Errorf("%w: no --custodian-key opens it", keys.ErrShareDecryption)
+	default:
+		return keys.ParseMnemonicShare(string(data))
+	}
+}
+
+func runRecoverIdentity(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	custodianKeys := make([][]byte, 0, len(recoverKeyFiles))
+	for _, path := range recoverKeyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read custodian key: %w", err)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != keys.X25519KeySize {
+			return fmt.Errorf("%s is not a hex X25519 private key", path)
+		}
+		custodianKeys = append(custodianKeys, key)
+	}
+
+	ctx := context.Background()
+	hw, err := loadHDWallet(ctx)
+	if err != nil {
+		return err
+	}
+	defer hw.Close(ctx)
+	recovery := setup.NewRecovery(peerIDDeriver(hw), strings.TrimSpace(recoverExpectPeer))
+
+	if len(args) > 0 {
+		for _, path := range args {
+			share, err := readShareFile(path, custodianKeys)
+			if err == nil {
+				err = recovery.AddShare(share)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	} else {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			have, need := recovery.Progress()
+			if need > 0 && have >= need {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "Enter share %d: ", have+1)
+			line, readErr := reader.ReadString('\n')
+			if strings.TrimSpace(line) != "" {
+				share, err := keys.ParseMnemonicShare(line)
+				if err == nil {
+					err = recovery.AddShare(share)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Share rejected: %v\n", err)
+				}
+			}
+			if readErr != nil {
+				break
+			}
+		}
+	}
+
+	mnemonic, peerID, err := recovery.Recover(ctx)
+	if err != nil {
+		return err
+	}
+	mnemonicPath := nodeMnemonicPath(cfg)
+	if err := setup.InstallMnemonic(mnemonicPath, mnemonic, nodeKeyPassword(cfg), recoverForce); err != nil {
+		if errors.Is(err, setup.ErrIdentityExists) {
+			return fmt.Errorf("%w (use --force to replace it)", err)
+		}
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRecovered identity %s and installed it at %s\n", peerID, mnemonicPath)
+	fmt.Println(peerID)
+	return nil
+}
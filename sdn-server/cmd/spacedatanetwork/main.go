@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -25,8 +26,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/spacedatanetwork/sdn-server/internal/api"
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/auth"
 	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/directory"
 	"github.com/spacedatanetwork/sdn-server/internal/epm"
 	"github.com/spacedatanetwork/sdn-server/internal/frontend"
 	"github.com/spacedatanetwork/sdn-server/internal/keys"
@@ -37,7 +40,6 @@ import (
 	"github.com/spacedatanetwork/sdn-server/internal/storage"
 	"github.com/spacedatanetwork/sdn-server/internal/storefront"
 	"github.com/spacedatanetwork/sdn-server/internal/tor"
-	"github.com/spacedatanetwork/sdn-server/internal/wasm"
 )
 
 var (
@@ -258,6 +260,42 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 		log.Infof("Listening on: %s", addr)
 	}
 
+	// Run the sdn-wasi module as a sandboxed processing stage if enabled
+	if cfg.WASI.Enabled {
+		stopWASI, err := startWASIStage(ctx, cfg.WASI, n)
+		if err != nil {
+			log.Warnf("Failed to start WASI processing stage: %v", err)
+		} else {
+			defer stopWASI()
+		}
+	}
+
+	// Tamper-evident record of privileged actions taken through the admin API.
+	auditLog, err := audit.NewLogger(cfg.Storage.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer auditLog.Close()
+	n.SetLicenseAuditLogger(auditLog)
+	if err := auditLog.LogServerStart(n.PeerID().String()); err != nil {
+		log.Warnf("Failed to record server start: %v", err)
+	}
+
+	// Periodically checkpoint the audit chain head to pubsub and IPFS so
+	// trusted peers can countersign it.
+	anchorInterval := node.DefaultAuditAnchorInterval
+	if v := os.Getenv("SDN_AUDIT_ANCHOR_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			anchorInterval = d
+		} else {
+			log.Warnf("Ignoring invalid SDN_AUDIT_ANCHOR_INTERVAL %q", v)
+		}
+	}
+	auditAnchorer, err := n.StartAuditAnchoring(auditLog, anchorInterval, cfg.Admin.IPFSAPIURL)
+	if err != nil {
+		log.Warnf("Audit anchoring disabled: %v", err)
+	}
+
 	// Start admin server if enabled
 	var adminServer *http.Server
 	var authHandler *auth.Handler
@@ -321,6 +359,12 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 
 			// Data API routes
 			dataAPI := api.NewDataQueryHandler(n.Store(), tokenVerifier)
+			if licSvc := n.LicenseService(); licSvc != nil {
+				dataAPI.SetReadScopePolicy(licSvc)
+			}
+			if n.PeerRegistry() != nil {
+				dataAPI.SetACL(n.PeerRegistry())
+			}
 			dataAPI.RegisterRoutes(adminMux)
 
 			// Catalog API route (public)
@@ -407,7 +451,25 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 			}
 
 			// Trusted peer registry management (admin UI React app consumes these endpoints).
-			adminMux.Handle("/api/", peers.NewAPIHandler(n.PeerRegistry(), n.PeerGater()))
+			peersAPI := peers.NewAPIHandler(n.PeerRegistry(), n.PeerGater())
+			peersAPI.SetAuditLogger(auditLog)
+			peersAPI.SetReputation(n.Reputation())
+			if wot := n.WebOfTrust(); wot != nil {
+				peersAPI.SetWebOfTrust(wot)
+			}
+			adminMux.Handle("/api/", peersAPI)
+
+			// Searchable directory of collected EPMs and chain address lookups.
+			if dir := n.Directory(); dir != nil {
+				directory.NewAPIHandler(dir).RegisterRoutes(adminMux)
+			}
+
+			// Audit log query, export, chain verification and checkpoints (admin-only).
+			auditAPI := audit.NewAPIHandler(auditLog)
+			if auditAnchorer != nil {
+				auditAPI.SetAnchorer(auditAnchorer)
+			}
+			auditAPI.RegisterRoutes(adminMux)
 
 			// Storefront API (listings, purchases, Stripe checkout/webhooks).
 			// Uses FlatSQL for content-addressed storage of STF/ACL/PUR/REV records.
@@ -416,13 +478,28 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 				if err != nil {
 					log.Warnf("Failed to initialize storefront store: %v", err)
 				} else {
-					sfSvc, err := storefront.NewService(sfStore, n.PeerID().String(), nil, nil)
+					var sfKey ed25519.PrivateKey
+					if raw := n.SigningKey(); len(raw) == ed25519.PrivateKeySize {
+						sfKey = ed25519.PrivateKey(raw)
+					}
+					sfSvc, err := storefront.NewService(sfStore, n.PeerID().String(), sfKey, n.PubSub())
 					if err != nil {
 						log.Warnf("Failed to initialize storefront service: %v", err)
 						_ = sfStore.Close()
 					} else {
-						sfCatalog := storefront.NewCatalog(sfStore, nil)
+						var sfDHT storefront.DHTStore
+						if n.DHT() != nil {
+							sfDHT = storefront.NewValueStoreDHT(n.DHT())
+						}
+						sfCatalog := storefront.NewCatalog(sfStore, sfDHT)
+						// Listings are signed with the libp2p identity key so other
+						// nodes can verify them against the provider's peer ID.
+						sfSvc.SetIdentityKey(n.Host().Peerstore().PrivKey(n.PeerID()))
+						sfSvc.SetCatalog(sfCatalog)
+						go storefront.NewCatalogSyncer(sfSvc, storefront.DefaultCatalogSyncConfig()).Run(ctx)
 						sfDelivery := storefront.NewDeliveryService(storefront.DefaultDeliveryConfig(), nil)
+						sfDelivery.SetRecordSealer(sfSvc)
+						sfDelivery.SetUsageMeter(sfSvc)
 						var chainVerifiers []storefront.ChainVerifier
 						if cfg.Blockchain.Ethereum.RPCURL != "" {
 							chainVerifiers = append(chainVerifiers, storefront.NewEthereumVerifier(storefront.ChainConfig{
@@ -443,8 +520,37 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 							}))
 						}
 						sfPayment := storefront.NewPaymentProcessor(sfStore, n.PeerID().String(), chainVerifiers...)
+						if cfg.Storefront.PlatformFeeBasisPoints > 0 {
+							fee := storefront.PlatformFee{
+								PeerID:      cfg.Storefront.PlatformFeePeerID,
+								BasisPoints: cfg.Storefront.PlatformFeeBasisPoints,
+							}
+							if fee.PeerID == "" {
+								fee.PeerID = n.PeerID().String()
+							}
+							if err := storefront.ValidateRevenueSplits(nil, fee); err != nil {
+								log.Warnf("Ignoring storefront platform fee: %v", err)
+							} else {
+								sfPayment.SetPlatformFee(fee)
+								sfSvc.SetPlatformFee(fee)
+							}
+						}
+						if cfg.Blockchain.WatchDeposits && len(chainVerifiers) > 0 {
+							// Deposit addresses are only handed out when
+							// something watches them; otherwise buyers pay by
+							// tx hash.
+							sfSvc.SetDepositAddressDeriver(n)
+							watcherCfg := storefront.DefaultPaymentWatcherConfig()
+							if d, err := time.ParseDuration(cfg.Blockchain.DepositPollInterval); err == nil && d > 0 {
+								watcherCfg.PollInterval = d
+							}
+							go storefront.NewPaymentWatcher(sfSvc, watcherCfg, chainVerifiers...).Run(ctx)
+							log.Infof("Storefront payment watcher polling every %s", watcherCfg.PollInterval)
+						}
+						go storefront.NewBillingRunner(sfSvc, storefront.DefaultBillingConfig()).Run(ctx)
 						sfTrust := storefront.NewTrustScorer(sfStore, storefront.DefaultTrustWeights())
 						sfAPI := storefront.NewAPIHandler(sfSvc, sfCatalog, sfDelivery, sfPayment, sfTrust)
+						sfAPI.SetAuditLogger(auditLog)
 						sfAPI.RegisterRoutes(adminMux, authHandler)
 						storefrontSvc = sfSvc
 						storefrontStore = sfStore
@@ -496,6 +602,12 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 					return fmt.Errorf("admin authentication required: create session store: %w", err)
 				}
 
+				apiKeyStore, err := auth.NewAPIKeyStore(authDB)
+				if err != nil {
+					_ = authDB.Close()
+					return fmt.Errorf("admin authentication required: create api key store: %w", err)
+				}
+
 				sessionTTL, _ := time.ParseDuration(cfg.Admin.SessionExpiry)
 				if sessionTTL == 0 {
 					sessionTTL = 24 * time.Hour
@@ -506,6 +618,8 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 					cfgDisplayPath = config.DefaultPath()
 				}
 				authHandler = auth.NewHandler(userStore, sessionStore, sessionTTL, cfg.Admin.WalletUIPath, cfgDisplayPath)
+				authHandler.SetAuditLogger(auditLog)
+				authHandler.SetAPIKeyStore(apiKeyStore)
 				if epmSvc := n.EPMService(); epmSvc != nil {
 					if att := epmSvc.GetIdentityAttestation(); att != nil {
 						authHandler.SetNodeSigningAttestation(att)
@@ -518,6 +632,9 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 				if n.Store() != nil && cfg.Publishing.Enabled {
 					quotas := api.NewStorageQuotaManager(n.Store(), cfg.Publishing.DefaultQuotaBytes)
 					publishAPI := api.NewPublishHandler(n.Store(), n.Validator(), quotas, &cfg.Publishing, authHandler)
+					if n.PeerRegistry() != nil {
+						publishAPI.SetACL(n.PeerRegistry())
+					}
 					publishAPI.RegisterRoutes(adminMux)
 					log.Infof("Publish API available at %s://%s/api/v1/data/publish/", adminScheme, adminAddr)
 				}
@@ -525,6 +642,8 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 				// Peer ACL admin API (requires admin auth)
 				if n.PeerRegistry() != nil {
 					aclAPI := api.NewACLHandler(n.PeerRegistry(), authHandler)
+					aclAPI.SetProviderPeerID(n.PeerID().String())
+					aclAPI.SetAuditLogger(auditLog)
 					aclAPI.RegisterRoutes(adminMux)
 					log.Infof("Peer ACL API available at %s://%s/api/v1/admin/peers", adminScheme, adminAddr)
 				}
@@ -568,8 +687,20 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 								return session.XPub, nil
 							},
 						)
+						uploadHandler.SetPublishers(licSvc.PluginPublishers())
+						uploadHandler.SetAuditLogger(auditLog)
+						uploadHandler.SetOnUpload(func(asset *license.PluginAsset) {
+							if err := n.ReloadPlugin(context.Background(), asset.ID); err != nil {
+								log.Warnf("Plugin %q version %s not hot-swapped: %v", asset.ID, asset.Version, err)
+							}
+							if err := reg.Reload(); err != nil {
+								log.Warnf("Failed to refresh plugin catalog: %v", err)
+							}
+						})
 						adminMux.HandleFunc("/api/v1/plugins/upload", uploadHandler.ServeHTTP)
 						log.Infof("Plugin upload API at %s://%s/api/v1/plugins/upload", adminScheme, adminAddr)
+
+						license.NewPluginVersionHandler(catalogVersions{n: n, reg: reg}).RegisterRoutes(adminMux)
 					}
 				}
 			}
@@ -578,6 +709,7 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 			// Frontend management API (admin-only)
 			// ----------------------------------------------------------------
 			frontendMgr := frontend.NewManager(cfg.Admin.FrontendPath)
+			frontendMgr.SetAuditLogger(auditLog)
 			frontendMgr.RegisterRoutes(adminMux)
 			log.Infof("Frontend manager at %s://%s/api/admin/frontend/ (dir: %s)", adminScheme, adminAddr, cfg.Admin.FrontendPath)
 
@@ -712,11 +844,7 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 							strings.HasPrefix(path, "/orbpro-key-broker/")
 
 						if isAPIOrPlugin && !isPublicAPIPath(path) {
-							minTrust := peers.Standard
-							if isAdminOnlyAPIPath(path) {
-								minTrust = peers.Admin
-							}
-							authHandler.RequireAuth(minTrust, func(w http.ResponseWriter, r *http.Request) {
+							authHandler.RequireAuth(apiMinTrust(path), func(w http.ResponseWriter, r *http.Request) {
 								adminMux.ServeHTTP(w, r)
 							})(w, r)
 							return
@@ -771,6 +899,9 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 			log.Warnf("Storefront store close error: %v", err)
 		}
 	}
+	if err := auditLog.LogServerStop(); err != nil {
+		log.Warnf("Failed to record server stop: %v", err)
+	}
 
 	return n.Stop()
 }
@@ -938,6 +1069,14 @@ func extractTCPPortFromMultiaddr(addr string) string {
 	return ""
 }
 
+// apiMinTrust returns the trust level a session needs for a gated API path.
+func apiMinTrust(path string) peers.TrustLevel {
+	if isAdminOnlyAPIPath(path) {
+		return peers.Admin
+	}
+	return peers.Standard
+}
+
 func isAdminOnlyAPIPath(path string) bool {
 	return strings.HasPrefix(path, "/api/peers") ||
 		strings.HasPrefix(path, "/api/groups") ||
@@ -946,6 +1085,10 @@ func isAdminOnlyAPIPath(path string) bool {
 		strings.HasPrefix(path, "/api/export") ||
 		strings.HasPrefix(path, "/api/import") ||
 		strings.HasPrefix(path, "/api/admin/") ||
+		strings.HasPrefix(path, "/api/directory") ||
+		strings.HasPrefix(path, "/api/endorsements") ||
+		strings.HasPrefix(path, "/api/trust/") ||
+		strings.HasPrefix(path, "/api/address-filter") ||
 		path == "/api/v1/plugins/upload"
 }
 
@@ -1575,22 +1718,10 @@ func runReindex(cmd *cobra.Command, args []string) error {
 }
 
 func runDeriveXPub(cmd *cobra.Command, args []string) error {
-	// Resolve WASM path
-	wp := strings.TrimSpace(wasmPath)
-	if wp == "" {
-		wp = os.Getenv("HD_WALLET_WASM_PATH")
-	}
-	if wp == "" {
-		wp = "../../hd-wallet-wasm/build-wasi/wasm/hd-wallet.wasm"
-	}
-	if _, err := os.Stat(wp); err != nil {
-		return fmt.Errorf("hd-wallet.wasm not found at %q (set --wasm or HD_WALLET_WASM_PATH)", wp)
-	}
-
 	ctx := context.Background()
-	hw, err := wasm.NewHDWalletModule(ctx, wp)
+	hw, err := loadHDWallet(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load HD wallet WASM: %w", err)
+		return err
 	}
 	defer hw.Close(ctx)
 
@@ -1645,17 +1776,10 @@ func runShowIdentity(cmd *cobra.Command, args []string) error {
 	}
 
 	// Resolve key password: env > config > machine default
-	keyPassword := os.Getenv("SDN_KEY_PASSWORD")
-	if keyPassword == "" {
-		keyPassword = cfg.Security.KeyPassword
-	}
-	if keyPassword == "" {
-		keyPassword = keys.DeriveDefaultPassword()
-	}
+	keyPassword := nodeKeyPassword(cfg)
 
 	// Locate mnemonic file
-	keyDir := filepath.Join(filepath.Dir(cfg.Storage.Path), "keys")
-	mnemonicPath := filepath.Join(keyDir, "mnemonic")
+	mnemonicPath := nodeMnemonicPath(cfg)
 
 	data, err := os.ReadFile(mnemonicPath)
 	if err != nil {
@@ -1673,22 +1797,10 @@ func runShowIdentity(cmd *cobra.Command, args []string) error {
 		mnemonic = string(data)
 	}
 
-	// Resolve WASM path
-	wp := strings.TrimSpace(wasmPath)
-	if wp == "" {
-		wp = os.Getenv("HD_WALLET_WASM_PATH")
-	}
-	if wp == "" {
-		wp = "../../hd-wallet-wasm/build-wasi/wasm/hd-wallet.wasm"
-	}
-	if _, err := os.Stat(wp); err != nil {
-		return fmt.Errorf("hd-wallet.wasm not found at %q (set --wasm or HD_WALLET_WASM_PATH)", wp)
-	}
-
 	ctx := context.Background()
-	hw, err := wasm.NewHDWalletModule(ctx, wp)
+	hw, err := loadHDWallet(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load HD wallet WASM: %w", err)
+		return err
 	}
 	defer hw.Close(ctx)
 
@@ -1730,3 +1842,30 @@ func runShowIdentity(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// catalogVersions applies plugin version changes to the node and refreshes
+// the license service's view of the catalog afterwards.
+type catalogVersions struct {
+	n   *node.Node
+	reg *license.PluginRegistry
+}
+
+func (c catalogVersions) PluginVersions(id string) ([]license.PluginDescriptor, error) {
+	return c.n.PluginVersions(id)
+}
+
+func (c catalogVersions) ActivatePluginVersion(ctx context.Context, id, version string) error {
+	defer c.refresh()
+	return c.n.ActivatePluginVersion(ctx, id, version)
+}
+
+func (c catalogVersions) PinPluginVersion(id string, pinned bool) error {
+	defer c.refresh()
+	return c.n.PinPluginVersion(id, pinned)
+}
+
+func (c catalogVersions) refresh() {
+	if err := c.reg.Reload(); err != nil {
+		log.Warnf("Failed to refresh plugin catalog: %v", err)
+	}
+}
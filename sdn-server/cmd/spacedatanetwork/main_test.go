@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spacedatanetwork/sdn-server/internal/auth"
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+// newStandardSession returns an auth handler and the cookie of a wallet
+// session for a Standard user.
+func newStandardSession(t *testing.T) (*auth.Handler, *http.Cookie) {
+	t.Helper()
+	dir := t.TempDir()
+	users, err := auth.NewUserStore(filepath.Join(dir, "users.db"), []config.UserEntry{
+		{XPub: "xpub-standard", TrustLevel: "standard", Name: "Standard"},
+	})
+	if err != nil {
+		t.Fatalf("NewUserStore: %v", err)
+	}
+	t.Cleanup(func() { users.Close() })
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "auth.db"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sessions, err := auth.NewSessionStore(db)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	token, err := sessions.CreateSession("xpub-standard", peers.Standard, "127.0.0.1", "test", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return auth.NewHandler(users, sessions, time.Hour, "", ""), &http.Cookie{Name: "sdn_wallet_session", Value: token}
+}
+
+func TestAdminOnlyAPIPathsRefuseStandardSessions(t *testing.T) {
+	h, cookie := newStandardSession(t)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/api/endorsements", http.StatusForbidden},
+		{http.MethodDelete, "/api/endorsements/12D3KooWExample", http.StatusForbidden},
+		{http.MethodGet, "/api/trust/derived", http.StatusForbidden},
+		{http.MethodGet, "/api/directory", http.StatusForbidden},
+		{http.MethodGet, "/api/address-filter", http.StatusForbidden},
+		{http.MethodGet, "/api/storefront/purchases", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		handler := h.RequireAuth(apiMinTrust(tt.path), func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Accept", "application/json")
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got %d want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
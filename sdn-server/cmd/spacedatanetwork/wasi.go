@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/node"
+	"github.com/spacedatanetwork/sdn-server/internal/sds"
+	"github.com/spacedatanetwork/sdn-server/internal/wasihost"
+)
+
+// startWASIStage runs the sdn-wasi module as a sandboxed processing stage:
+// it receives messages from the schema topics, verifies them against the
+// schemas and stores accepted records in the node's FlatSQL store. The
+// node's own subscription ingests each message; records the module derives
+// from it pass the same admission checks as PubSub messages.
+func startWASIStage(ctx context.Context, cfg config.WASIConfig, n *node.Node) (func(), error) {
+	if cfg.ModulePath == "" {
+		return nil, fmt.Errorf("wasi.module_path is required")
+	}
+	if n.Store() == nil || n.SDSExchange() == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	wasmBytes, err := os.ReadFile(cfg.ModulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WASI module: %w", err)
+	}
+
+	network := wasihost.NewPubSubNetwork(ctx, n, n.PeerID())
+	memoryMB := cfg.MemoryLimitMB
+	if memoryMB <= 0 {
+		memoryMB = 32
+	}
+	h, err := wasihost.New(ctx, wasmBytes, wasihost.Config{
+		Network:          network,
+		Storage:          wasihost.NewFlatSQLStorage(n.Store(), n.SDSExchange(), n.PeerID().String()),
+		MemoryLimitPages: uint32(memoryMB) * 16, // 64KiB pages
+	})
+	if err != nil {
+		network.Close()
+		return nil, err
+	}
+	stop := func() {
+		network.Close()
+		if err := h.Close(context.Background()); err != nil {
+			log.Warnf("WASI stage shutdown error: %v", err)
+		}
+	}
+
+	schemas := cfg.Schemas
+	if len(schemas) == 0 {
+		schemas = n.Validator().Schemas()
+	}
+	registry, err := sds.NewSchemaRegistry()
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if err := h.Start(ctx, schemas, registry.Get); err != nil {
+		stop()
+		return nil, err
+	}
+
+	log.Infof("WASI processing stage running %s on %d schema topics", cfg.ModulePath, len(schemas))
+	return stop, nil
+}
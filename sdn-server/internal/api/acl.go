@@ -2,20 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/auth"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
 )
 
-// ACLHandler provides admin REST endpoints for managing peer trust levels.
+// ACLHandler provides admin REST endpoints for managing peer trust levels
+// and per-schema ACL rules.
 type ACLHandler struct {
 	registry    *peers.Registry
 	authHandler *auth.Handler
+	providerID  string
+	audit       *audit.Logger
 }
 
 // NewACLHandler creates a new peer ACL handler.
@@ -26,10 +32,23 @@ func NewACLHandler(registry *peers.Registry, authHandler *auth.Handler) *ACLHand
 	}
 }
 
+// SetProviderPeerID sets the node peer ID recorded as provider_peer_id in
+// ACL.fbs exports.
+func (h *ACLHandler) SetProviderPeerID(id string) {
+	h.providerID = id
+}
+
+// SetAuditLogger records group ACL changes and ACL imports to logger.
+func (h *ACLHandler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
 // RegisterRoutes registers admin ACL API routes.
 func (h *ACLHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/admin/peers", h.authHandler.RequireAuth(peers.Admin, h.handlePeers))
 	mux.HandleFunc("/api/v1/admin/peers/", h.authHandler.RequireAuth(peers.Admin, h.handlePeerByID))
+	mux.HandleFunc("/api/v1/admin/groups/", h.authHandler.RequireAuth(peers.Admin, h.handleGroupACL))
+	mux.HandleFunc("/api/v1/admin/acl", h.authHandler.RequireAuth(peers.Admin, h.handleACLInterchange))
 }
 
 func (h *ACLHandler) handlePeers(w http.ResponseWriter, r *http.Request) {
@@ -97,6 +116,13 @@ func (h *ACLHandler) handlePeerByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Handle ACL sub-resource: /api/v1/admin/peers/{id}/acl
+	if strings.HasSuffix(peerIDStr, "/acl") {
+		peerIDStr = strings.TrimSuffix(peerIDStr, "/acl")
+		h.handlePeerACL(w, r, peerIDStr)
+		return
+	}
+
 	if peerIDStr == "" {
 		writeError(w, http.StatusBadRequest, "peer ID required in path")
 		return
@@ -170,6 +196,161 @@ func (h *ACLHandler) handlePeerTrust(w http.ResponseWriter, r *http.Request, pee
 	})
 }
 
+// handlePeerACL handles GET and PUT /api/v1/admin/peers/{id}/acl.
+func (h *ACLHandler) handlePeerACL(w http.ResponseWriter, r *http.Request, peerIDStr string) {
+	pid, err := peer.Decode(peerIDStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid peer ID: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tp, err := h.registry.GetPeer(pid)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "peer not found: "+peerIDStr)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"peer_id": peerIDStr,
+			"rules":   aclRules(tp.ACL),
+		})
+
+	case http.MethodPut:
+		rules, ok := decodeACLRules(w, r)
+		if !ok {
+			return
+		}
+		if err := h.registry.SetPeerACL(pid, rules); err != nil {
+			writeACLError(w, err, "peer not found: "+peerIDStr)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"peer_id": peerIDStr,
+			"rules":   aclRules(rules),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGroupACL handles GET and PUT /api/v1/admin/groups/{name}/acl.
+func (h *ACLHandler) handleGroupACL(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/groups/")
+	name, ok := strings.CutSuffix(strings.TrimSuffix(rest, "/"), "/acl")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		group, err := h.registry.GetGroup(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "group not found: "+name)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"group": name,
+			"rules": aclRules(group.ACL),
+		})
+
+	case http.MethodPut:
+		rules, ok := decodeACLRules(w, r)
+		if !ok {
+			return
+		}
+		var before []peers.ACLRule
+		if group, err := h.registry.GetGroup(name); err == nil {
+			before = group.ACL
+		}
+		if err := h.registry.SetGroupACL(name, rules); err != nil {
+			writeACLError(w, err, "group not found: "+name)
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeGroupChange,
+			TargetType:  "group",
+			TargetID:    name,
+			Description: "Group ACL replaced",
+			Before:      aclRules(before),
+			After:       aclRules(rules),
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"group": name,
+			"rules": aclRules(rules),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleACLInterchange exports (GET) or imports (POST) every ACL rule as an
+// ACL.fbs grant collection.
+func (h *ACLHandler) handleACLInterchange(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.registry.ExportACL(h.providerID))
+
+	case http.MethodPost:
+		var collection peers.ACLCollection
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&collection); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		before := h.registry.ExportACL(h.providerID)
+		imported, err := h.registry.ImportACL(&collection)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeACLImport,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "acl",
+			Description: fmt.Sprintf("Imported %d of %d ACL grants", imported, len(collection.Grants)),
+			Before:      before,
+			After:       h.registry.ExportACL(h.providerID),
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"imported": imported,
+			"skipped":  len(collection.Grants) - imported,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func decodeACLRules(w http.ResponseWriter, r *http.Request) ([]peers.ACLRule, bool) {
+	var req struct {
+		Rules []peers.ACLRule `json:"rules"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 256*1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, false
+	}
+	return req.Rules, true
+}
+
+func writeACLError(w http.ResponseWriter, err error, notFound string) {
+	if errors.Is(err, peers.ErrInvalidACLRule) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusNotFound, notFound)
+}
+
+// aclRules keeps empty rule lists as [] in responses.
+func aclRules(rules []peers.ACLRule) []peers.ACLRule {
+	if rules == nil {
+		return []peers.ACLRule{}
+	}
+	return rules
+}
+
 type addPeerRequest struct {
 	PeerID     string `json:"peer_id"`
 	TrustLevel string `json:"trust_level"`
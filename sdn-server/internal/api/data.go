@@ -18,14 +18,25 @@ import (
 	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/OMM"
 	flatbuffers "github.com/google/flatbuffers/go"
 
+	"github.com/libp2p/go-libp2p/core/peer"
+
 	"github.com/spacedatanetwork/sdn-server/internal/license"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
 	"github.com/spacedatanetwork/sdn-server/internal/storage"
 )
 
+// ReadScopePolicy reports which capability scopes allow reading a schema.
+// *license.Service implements it from its plan policy.
+type ReadScopePolicy interface {
+	ReadScopes(schema string) (scopes []string, protected bool)
+}
+
 // DataQueryHandler serves read-only, cache-friendly schema query APIs.
 type DataQueryHandler struct {
 	store    *storage.FlatSQLStore
 	verifier *license.TokenVerifier
+	policy   ReadScopePolicy
+	acl      *peers.Registry
 }
 
 // NewDataQueryHandler creates a new data query handler.
@@ -36,6 +47,18 @@ func NewDataQueryHandler(store *storage.FlatSQLStore, verifier *license.TokenVer
 	}
 }
 
+// SetReadScopePolicy sets the policy that decides which schemas need a token
+// on the generic query route.
+func (h *DataQueryHandler) SetReadScopePolicy(policy ReadScopePolicy) {
+	h.policy = policy
+}
+
+// SetACL enables per-schema query ACLs for callers that present a capability
+// token bound to a peer ID. Anonymous reads of public schemas are unaffected.
+func (h *DataQueryHandler) SetACL(registry *peers.Registry) {
+	h.acl = registry
+}
+
 // RegisterRoutes registers public data API routes.
 func (h *DataQueryHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/data/health", h.handleHealth)
@@ -65,7 +88,11 @@ func (h *DataQueryHandler) handleOMM(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	h.writeOMMResponse(w, r, true)
+	decision, private, ok := h.authorizeRead(w, r, "OMM.fbs")
+	if !ok {
+		return
+	}
+	h.writeOMMResponse(w, r, !private, decision)
 }
 
 func (h *DataQueryHandler) handleSecureOMM(w http.ResponseWriter, r *http.Request) {
@@ -73,10 +100,19 @@ func (h *DataQueryHandler) handleSecureOMM(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if !h.requireScope(w, r, "api:data:read:premium") {
+	claims := h.requireScope(w, r, license.ScopeDataReadPremium, license.DataReadScope("OMM.fbs"))
+	if claims == nil {
+		return
+	}
+	decision, ok := h.queryACL(w, r, claims, "OMM.fbs")
+	if !ok {
+		return
+	}
+	if noradID, err := requiredUint32(r, "norad_cat_id"); err == nil && !decision.AllowsObject(peers.ACLObject{NoradCatID: noradID}) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%v: norad_cat_id %d", peers.ErrACLDenied, noradID))
 		return
 	}
-	h.writeOMMResponse(w, r, false)
+	h.writeOMMResponse(w, r, false, decision)
 }
 
 func (h *DataQueryHandler) handleMPE(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +136,12 @@ func (h *DataQueryHandler) handleMPE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// MPE is derived from OMM records, so OMM's read policy applies.
+	decision, private, ok := h.authorizeRead(w, r, "OMM.fbs")
+	if !ok {
+		return
+	}
+
 	limit := parseLimit(r, 100, 1000)
 	includeData := parseBool(r, "include_data")
 	format := requestedDataFormat(r)
@@ -109,10 +151,17 @@ func (h *DataQueryHandler) handleMPE(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if decision.Filtered() {
+		records = filterRecordsByACL("OMM.fbs", records, decision)
+	}
 
-	setCachePolicy(w, day)
-	if handleConditionalCache(w, r, "OMM.fbs", day, entityID, records) {
-		return
+	if private {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		setCachePolicy(w, day)
+		if handleConditionalCache(w, r, "OMM.fbs", day, entityID, records) {
+			return
+		}
 	}
 
 	mpePayloads := make([][]byte, 0, len(records))
@@ -177,6 +226,11 @@ func (h *DataQueryHandler) handleCAT(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	decision, private, ok := h.authorizeRead(w, r, "CAT.fbs")
+	if !ok {
+		return
+	}
+
 	limit := parseLimit(r, 5, 100)
 	includeData := parseBool(r, "include_data")
 	format := requestedDataFormat(r)
@@ -186,10 +240,17 @@ func (h *DataQueryHandler) handleCAT(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if decision.Filtered() {
+		records = filterRecordsByACL("CAT.fbs", records, decision)
+	}
 
-	setCachePolicy(w, "")
-	if handleConditionalCache(w, r, "CAT.fbs", "", fmt.Sprintf("%d", noradID), records) {
-		return
+	if private {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		setCachePolicy(w, "")
+		if handleConditionalCache(w, r, "CAT.fbs", "", fmt.Sprintf("%d", noradID), records) {
+			return
+		}
 	}
 	if format == dataFormatFlatBuffers {
 		writeFlatBufferStream(w, "CAT.fbs", records)
@@ -249,6 +310,10 @@ func (h *DataQueryHandler) handleGenericQuery(w http.ResponseWriter, r *http.Req
 		writeError(w, http.StatusBadRequest, "missing schema in URL path")
 		return
 	}
+	decision, protected, ok := h.authorizeRead(w, r, schema)
+	if !ok {
+		return
+	}
 
 	q := r.URL.Query()
 	day := strings.TrimSpace(q.Get("day"))
@@ -280,8 +345,15 @@ func (h *DataQueryHandler) handleGenericQuery(w http.ResponseWriter, r *http.Req
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if decision.Filtered() {
+		records = filterRecordsByACL(schema, records, decision)
+	}
 
-	setCachePolicy(w, day)
+	if protected {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		setCachePolicy(w, day)
+	}
 
 	if format == dataFormatFlatBuffers {
 		writeFlatBufferStream(w, schema, records)
@@ -387,23 +459,101 @@ func parseBool(r *http.Request, key string) bool {
 	return raw == "1" || raw == "true" || raw == "yes"
 }
 
-func (h *DataQueryHandler) requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+// requireScope verifies the request's capability token and checks that it
+// carries at least one of scopes. It returns nil after writing an error.
+func (h *DataQueryHandler) requireScope(w http.ResponseWriter, r *http.Request, scopes ...string) *license.CapabilityClaims {
 	if h.verifier == nil {
 		writeError(w, http.StatusServiceUnavailable, "license verifier unavailable")
-		return false
+		return nil
 	}
 	expectedPeerID := strings.TrimSpace(r.Header.Get("X-SDN-Peer-ID"))
-	claims, err := h.verifier.VerifyAuthorizationHeader(r.Header.Get("Authorization"), expectedPeerID, []string{scope})
+	claims, err := h.verifier.VerifyAuthorizationHeader(r.Header.Get("Authorization"), expectedPeerID, nil)
 	if err != nil {
 		writeError(w, http.StatusUnauthorized, err.Error())
-		return false
+		return nil
+	}
+	if !claims.HasAnyScope(scopes...) {
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("%v: %s", license.ErrTokenMissingScope, strings.Join(scopes, " or ")))
+		return nil
 	}
 	w.Header().Set("X-SDN-Token-Subject", claims.Sub)
 	w.Header().Set("X-SDN-Token-Plan", claims.Plan)
-	return true
+	return claims
+}
+
+// authorizeRead applies the read-scope policy and the caller's query ACL to
+// a read of schema. Every data route calls it, so a protected schema cannot
+// be read through a route that does not name it. private reports whether the
+// response depends on the caller and must not be cached publicly. It returns
+// false after writing an error.
+func (h *DataQueryHandler) authorizeRead(w http.ResponseWriter, r *http.Request, schema string) (decision peers.ACLDecision, private, ok bool) {
+	var claims *license.CapabilityClaims
+	if h.policy != nil {
+		if scopes, protected := h.policy.ReadScopes(schema); protected {
+			if claims = h.requireScope(w, r, scopes...); claims == nil {
+				return decision, true, false
+			}
+			private = true
+		}
+	}
+	decision, ok = h.queryACL(w, r, claims, schema)
+	if !ok {
+		return decision, private, false
+	}
+	return decision, private || decision.Restricted, true
+}
+
+// queryACL evaluates the caller's query ACL for schema. claims may be nil for
+// public schemas, in which case a bearer token is verified if one was sent.
+// Callers without a peer identity are refused schemas that ACL rules cover.
+// It returns false after writing an error.
+func (h *DataQueryHandler) queryACL(w http.ResponseWriter, r *http.Request, claims *license.CapabilityClaims, schema string) (peers.ACLDecision, bool) {
+	open := peers.ACLDecision{Allowed: true}
+	if h.acl == nil {
+		return open, true
+	}
+	if claims == nil && h.verifier != nil && r.Header.Get("Authorization") != "" {
+		expectedPeerID := strings.TrimSpace(r.Header.Get("X-SDN-Peer-ID"))
+		verified, err := h.verifier.VerifyAuthorizationHeader(r.Header.Get("Authorization"), expectedPeerID, nil)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return open, false
+		}
+		claims = verified
+	}
+	var id peer.ID
+	if claims != nil {
+		id, _ = peer.Decode(claims.PeerID)
+	}
+	if id == "" {
+		if h.acl.ACLCovers(schema) {
+			writeError(w, http.StatusUnauthorized, fmt.Sprintf("%v: %s is access-controlled; a capability token bound to a peer ID is required", peers.ErrACLDenied, schema))
+			return peers.ACLDecision{Restricted: true}, false
+		}
+		return open, true
+	}
+	decision := h.acl.Authorize(id, peers.ACLQuery, schema)
+	if !decision.Allowed {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%v: query %s", peers.ErrACLDenied, schema))
+		return decision, false
+	}
+	return decision, true
+}
+
+// filterRecordsByACL drops records about objects an object-filtered ACL does
+// not cover.
+func filterRecordsByACL(schema string, records []*storage.Record, decision peers.ACLDecision) []*storage.Record {
+	allowed := records[:0]
+	for _, rec := range records {
+		norad, objectID := storage.RecordObject(schema, rec.Data)
+		if decision.AllowsObject(peers.ACLObject{NoradCatID: norad, ObjectID: objectID}) {
+			allowed = append(allowed, rec)
+		}
+	}
+	return allowed
 }
 
-func (h *DataQueryHandler) writeOMMResponse(w http.ResponseWriter, r *http.Request, cacheable bool) {
+func (h *DataQueryHandler) writeOMMResponse(w http.ResponseWriter, r *http.Request, cacheable bool, decision peers.ACLDecision) {
 	if !h.ensureStore(w) {
 		return
 	}
@@ -429,6 +579,9 @@ func (h *DataQueryHandler) writeOMMResponse(w http.ResponseWriter, r *http.Reque
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if decision.Filtered() {
+		records = filterRecordsByACL("OMM.fbs", records, decision)
+	}
 
 	if cacheable {
 		setCachePolicy(w, day)
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/auth"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
 	"github.com/spacedatanetwork/sdn-server/internal/pubsub"
@@ -15,6 +16,7 @@ import (
 type PinningHandler struct {
 	tipConfig   *pubsub.TipQueueConfig
 	authHandler *auth.Handler
+	audit       *audit.Logger
 }
 
 // NewPinningHandler creates a new pinning policy handler.
@@ -25,6 +27,11 @@ func NewPinningHandler(tipConfig *pubsub.TipQueueConfig, authHandler *auth.Handl
 	}
 }
 
+// SetAuditLogger records pinning policy edits to logger.
+func (h *PinningHandler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
 // RegisterRoutes registers admin pinning API routes.
 func (h *PinningHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/admin/pinning", h.authHandler.RequireAuth(peers.Admin, h.handlePinning))
@@ -82,7 +89,16 @@ func (h *PinningHandler) handleSchemaPolicy(w http.ResponseWriter, r *http.Reque
 			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 			return
 		}
+		before, _ := h.tipConfig.GetSchemaDefault(schema)
 		h.tipConfig.SetSchemaDefault(schema, &cfg)
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePinningChange,
+			TargetType:  "pinning_schema",
+			TargetID:    schema,
+			Description: "Schema pinning policy updated",
+			Before:      before,
+			After:       cfg,
+		})
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"schema":  schema,
 			"updated": true,
@@ -116,7 +132,16 @@ func (h *PinningHandler) handleSourcePolicy(w http.ResponseWriter, r *http.Reque
 			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 			return
 		}
+		before, _ := h.tipConfig.GetSourceConfig(peerID)
 		h.tipConfig.SetSourceOverride(peerID, &cfg)
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePinningChange,
+			TargetType:  "pinning_source",
+			TargetID:    peerID,
+			Description: "Source pinning policy updated",
+			Before:      before,
+			After:       cfg,
+		})
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"peer_id": peerID,
 			"updated": true,
@@ -126,6 +151,14 @@ func (h *PinningHandler) handleSourcePolicy(w http.ResponseWriter, r *http.Reque
 		// Trust/untrust toggle
 		if h.tipConfig.IsTrusted(peerID) {
 			h.tipConfig.UntrustSource(peerID)
+			h.audit.RecordRequest(r, audit.Event{
+				Type:        audit.EventTypePinningChange,
+				TargetType:  "pinning_source",
+				TargetID:    peerID,
+				Description: "Source untrusted for pinning",
+				Before:      map[string]bool{"trusted": true},
+				After:       map[string]bool{"trusted": false},
+			})
 		}
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"peer_id": peerID,
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
 	"github.com/spacedatanetwork/sdn-server/internal/auth"
 	"github.com/spacedatanetwork/sdn-server/internal/config"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
@@ -76,6 +80,7 @@ type PublishHandler struct {
 	quotas    *StorageQuotaManager
 	cfg       *config.PublishingConfig
 	authHandler *auth.Handler
+	acl         *peers.Registry
 }
 
 // NewPublishHandler creates a new publish handler.
@@ -95,6 +100,12 @@ func NewPublishHandler(
 	}
 }
 
+// SetACL enables per-schema publish ACLs. Users are matched to registry
+// peers by the peer ID of their wallet signing key.
+func (h *PublishHandler) SetACL(registry *peers.Registry) {
+	h.acl = registry
+}
+
 // RegisterRoutes registers publish API routes.
 func (h *PublishHandler) RegisterRoutes(mux *http.ServeMux) {
 	minTrust := peers.Standard
@@ -142,6 +153,10 @@ func (h *PublishHandler) handlePublish(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "no session")
 		return
 	}
+	if !session.AllowsSchema(schema) {
+		writeError(w, http.StatusForbidden, "api key not scoped for schema: "+schema)
+		return
+	}
 	peerID := session.XPub // use xpub as peer identifier for published records
 
 	// Read body with size limit
@@ -169,6 +184,11 @@ func (h *PublishHandler) handlePublish(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := h.checkACL(session, schema, data); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
 	// Check quota
 	if h.quotas != nil {
 		if err := h.quotas.CheckQuota(peerID, len(data)); err != nil {
@@ -226,6 +246,10 @@ func (h *PublishHandler) handlePublishBatch(w http.ResponseWriter, r *http.Reque
 		writeError(w, http.StatusUnauthorized, "no session")
 		return
 	}
+	if !session.AllowsSchema(schema) {
+		writeError(w, http.StatusForbidden, "api key not scoped for schema: "+schema)
+		return
+	}
 	peerID := session.XPub
 
 	// Read uint32BE-length-prefixed stream.
@@ -270,6 +294,14 @@ func (h *PublishHandler) handlePublishBatch(w http.ResponseWriter, r *http.Reque
 			}
 		}
 
+		if err := h.checkACL(session, schema, data); err != nil {
+			results = append(results, map[string]interface{}{
+				"error": err.Error(),
+				"bytes": len(data),
+			})
+			continue
+		}
+
 		if h.quotas != nil {
 			if err := h.quotas.CheckQuota(peerID, len(data)); err != nil {
 				results = append(results, map[string]interface{}{
@@ -303,6 +335,41 @@ func (h *PublishHandler) handlePublishBatch(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// checkACL applies the publisher's ACL rules to one record. Users without a
+// signing key on file have no registry identity and are not restricted.
+func (h *PublishHandler) checkACL(session *auth.Session, schema string, data []byte) error {
+	if h.acl == nil {
+		return nil
+	}
+	id, ok := h.publisherPeerID(session.XPub)
+	if !ok {
+		return nil
+	}
+	norad, objectID := storage.RecordObject(schema, data)
+	return h.acl.CheckAccess(id, peers.ACLPublish, schema, peers.ACLObject{NoradCatID: norad, ObjectID: objectID})
+}
+
+// publisherPeerID derives the peer ID of a user's Ed25519 signing key.
+func (h *PublishHandler) publisherPeerID(xpub string) (peer.ID, bool) {
+	user, err := h.authHandler.UserStore().GetUser(xpub)
+	if err != nil || user == nil || user.SigningPubKeyHex == "" {
+		return "", false
+	}
+	raw, err := hex.DecodeString(user.SigningPubKeyHex)
+	if err != nil {
+		return "", false
+	}
+	pub, err := crypto.UnmarshalEd25519PublicKey(raw)
+	if err != nil {
+		return "", false
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return "", false
+	}
+	return id, true
+}
+
 func (h *PublishHandler) isSchemaAllowed(schema string) bool {
 	if len(h.cfg.AllowedSchemas) == 0 {
 		return true
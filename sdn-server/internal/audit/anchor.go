@@ -0,0 +1,554 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CheckpointTopic is the pubsub topic for audit checkpoints and
+// countersignatures.
+const CheckpointTopic = "/spacedatanetwork/audit/checkpoints/1.0.0"
+
+// EventTypeCheckpointConflict is recorded when a witnessed node publishes
+// two different checkpoints for the same sequence.
+const EventTypeCheckpointConflict = "audit.checkpoint_conflict"
+
+const (
+	checkpointType       = "sdn-audit-checkpoint/v1"
+	countersignatureType = "sdn-audit-countersignature/v1"
+)
+
+var (
+	ErrNothingToAnchor    = errors.New("no audit entries since the last checkpoint")
+	ErrInvalidCheckpoint  = errors.New("invalid audit checkpoint signature")
+	ErrCheckpointConflict = errors.New("conflicting audit checkpoint for the same sequence")
+	ErrNoCheckpoint       = errors.New("no checkpoint covers the entry yet")
+)
+
+// Checkpoint commits a node to the head of its audit chain. Once other
+// nodes have seen it, the node cannot rewrite any entry up to Sequence
+// without the rewrite being detectable.
+type Checkpoint struct {
+	NodeID    string `json:"node_id"`
+	Sequence  int64  `json:"sequence"` // ID of the last entry covered
+	Hash      string `json:"hash"`     // EntryHash of that entry
+	Timestamp int64  `json:"timestamp"`
+	Signature []byte `json:"signature"`
+	// CID is where the signed checkpoint is pinned on IPFS. It is not
+	// covered by the signature.
+	CID               string             `json:"cid,omitempty"`
+	Countersignatures []Countersignature `json:"countersignatures,omitempty"`
+}
+
+// Countersignature is another node's statement that it saw a checkpoint
+// at WitnessedAt.
+type Countersignature struct {
+	PeerID      string `json:"peer_id"`
+	WitnessedAt int64  `json:"witnessed_at"`
+	Signature   []byte `json:"signature"`
+}
+
+func (c *Checkpoint) signingBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type      string `json:"type"`
+		NodeID    string `json:"node_id"`
+		Sequence  int64  `json:"sequence"`
+		Hash      string `json:"hash"`
+		Timestamp int64  `json:"timestamp"`
+	}{checkpointType, c.NodeID, c.Sequence, c.Hash, c.Timestamp})
+	return data
+}
+
+func (c *Checkpoint) countersignatureBytes(peerID string, witnessedAt int64) []byte {
+	data, _ := json.Marshal(struct {
+		Type        string          `json:"type"`
+		Checkpoint  json.RawMessage `json:"checkpoint"`
+		PeerID      string          `json:"peer_id"`
+		WitnessedAt int64           `json:"witnessed_at"`
+	}{countersignatureType, c.signingBytes(), peerID, witnessedAt})
+	return data
+}
+
+// verifyPeerSignature checks sig against the public key embedded in peerID.
+func verifyPeerSignature(peerID string, data, sig []byte) error {
+	if len(sig) == 0 {
+		return ErrInvalidCheckpoint
+	}
+	pid, err := peer.Decode(peerID)
+	if err != nil {
+		return fmt.Errorf("invalid peer ID: %w", err)
+	}
+	pub, err := pid.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("cannot extract public key: %w", err)
+	}
+	ok, err := pub.Verify(data, sig)
+	if err != nil || !ok {
+		return ErrInvalidCheckpoint
+	}
+	return nil
+}
+
+// Verify checks the checkpoint's signature against its node ID.
+func (c *Checkpoint) Verify() error {
+	return verifyPeerSignature(c.NodeID, c.signingBytes(), c.Signature)
+}
+
+// VerifyCountersignature checks that cs is a valid countersignature of c.
+func (c *Checkpoint) VerifyCountersignature(cs Countersignature) error {
+	return verifyPeerSignature(cs.PeerID, c.countersignatureBytes(cs.PeerID, cs.WitnessedAt), cs.Signature)
+}
+
+// Countersign returns key's countersignature of c, witnessed now.
+func (c *Checkpoint) Countersign(key crypto.PrivKey) (Countersignature, error) {
+	pid, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return Countersignature{}, err
+	}
+	cs := Countersignature{PeerID: pid.String(), WitnessedAt: time.Now().Unix()}
+	cs.Signature, err = key.Sign(c.countersignatureBytes(cs.PeerID, cs.WitnessedAt))
+	return cs, err
+}
+
+// initCheckpointDB creates the checkpoint tables. Checkpoints from this
+// node and those witnessed from other nodes share them, keyed by node ID.
+func (l *Logger) initCheckpointDB() error {
+	_, err := l.db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_checkpoints (
+			node_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			hash TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			signature BLOB NOT NULL,
+			cid TEXT,
+			PRIMARY KEY (node_id, sequence)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_countersignatures (
+			node_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			peer_id TEXT NOT NULL,
+			witnessed_at INTEGER NOT NULL,
+			signature BLOB NOT NULL,
+			PRIMARY KEY (node_id, sequence, peer_id)
+		)
+	`)
+	return err
+}
+
+// CreateCheckpoint signs the current head of the chain with key and stores
+// the checkpoint.
+func (l *Logger) CreateCheckpoint(key crypto.PrivKey) (*Checkpoint, error) {
+	pid, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("derive node ID: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lastID == 0 {
+		return nil, ErrNothingToAnchor
+	}
+	var latest sql.NullInt64
+	err = l.db.QueryRow(`SELECT MAX(sequence) FROM audit_checkpoints WHERE node_id = ?`, pid.String()).Scan(&latest)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Valid && latest.Int64 >= l.lastID {
+		return nil, ErrNothingToAnchor
+	}
+
+	c := &Checkpoint{
+		NodeID:    pid.String(),
+		Sequence:  l.lastID,
+		Hash:      l.lastHash,
+		Timestamp: time.Now().Unix(),
+	}
+	if c.Signature, err = key.Sign(c.signingBytes()); err != nil {
+		return nil, fmt.Errorf("sign checkpoint: %w", err)
+	}
+	if _, err := l.db.Exec(`
+		INSERT INTO audit_checkpoints (node_id, sequence, hash, timestamp, signature)
+		VALUES (?, ?, ?, ?, ?)
+	`, c.NodeID, c.Sequence, c.Hash, c.Timestamp, c.Signature); err != nil {
+		return nil, fmt.Errorf("store checkpoint: %w", err)
+	}
+	return c, nil
+}
+
+// SaveCheckpoint verifies and stores a checkpoint from another node. A
+// second checkpoint for the same sequence with a different hash means the
+// node rewrote its chain and returns ErrCheckpointConflict.
+func (l *Logger) SaveCheckpoint(c *Checkpoint) error {
+	if err := c.Verify(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var hash string
+	err := l.db.QueryRow(`SELECT hash FROM audit_checkpoints WHERE node_id = ? AND sequence = ?`,
+		c.NodeID, c.Sequence).Scan(&hash)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = l.db.Exec(`
+			INSERT INTO audit_checkpoints (node_id, sequence, hash, timestamp, signature, cid)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, c.NodeID, c.Sequence, c.Hash, c.Timestamp, c.Signature, c.CID)
+		return err
+	case err != nil:
+		return err
+	case hash != c.Hash:
+		return fmt.Errorf("%w: node %s sequence %d", ErrCheckpointConflict, c.NodeID, c.Sequence)
+	}
+	return nil
+}
+
+// SetCheckpointCID records where a checkpoint was pinned.
+func (l *Logger) SetCheckpointCID(nodeID string, sequence int64, cid string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.db.Exec(`UPDATE audit_checkpoints SET cid = ? WHERE node_id = ? AND sequence = ?`,
+		cid, nodeID, sequence)
+	return err
+}
+
+// AddCountersignature verifies cs against a stored checkpoint and stores it.
+func (l *Logger) AddCountersignature(nodeID string, sequence int64, cs Countersignature) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, err := l.checkpointLocked(nodeID, sequence)
+	if err != nil {
+		return err
+	}
+	if err := c.VerifyCountersignature(cs); err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`
+		INSERT OR IGNORE INTO audit_countersignatures (node_id, sequence, peer_id, witnessed_at, signature)
+		VALUES (?, ?, ?, ?, ?)
+	`, nodeID, sequence, cs.PeerID, cs.WitnessedAt, cs.Signature)
+	return err
+}
+
+func (l *Logger) checkpointLocked(nodeID string, sequence int64) (*Checkpoint, error) {
+	c := &Checkpoint{NodeID: nodeID, Sequence: sequence}
+	var cid sql.NullString
+	err := l.db.QueryRow(`
+		SELECT hash, timestamp, signature, cid FROM audit_checkpoints WHERE node_id = ? AND sequence = ?
+	`, nodeID, sequence).Scan(&c.Hash, &c.Timestamp, &c.Signature, &cid)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoCheckpoint
+	} else if err != nil {
+		return nil, err
+	}
+	c.CID = cid.String
+
+	rows, err := l.db.Query(`
+		SELECT peer_id, witnessed_at, signature FROM audit_countersignatures
+		WHERE node_id = ? AND sequence = ? ORDER BY witnessed_at ASC
+	`, nodeID, sequence)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cs Countersignature
+		if err := rows.Scan(&cs.PeerID, &cs.WitnessedAt, &cs.Signature); err != nil {
+			return nil, err
+		}
+		c.Countersignatures = append(c.Countersignatures, cs)
+	}
+	return c, rows.Err()
+}
+
+// Checkpoints returns a node's stored checkpoints, newest first.
+func (l *Logger) Checkpoints(nodeID string, limit int) ([]Checkpoint, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	query := `SELECT sequence FROM audit_checkpoints WHERE node_id = ? ORDER BY sequence DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := l.db.Query(query, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	var sequences []int64
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sequences = append(sequences, seq)
+	}
+	rows.Close()
+
+	out := make([]Checkpoint, 0, len(sequences))
+	for _, seq := range sequences {
+		c, err := l.checkpointLocked(nodeID, seq)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+// InclusionProof links an audit entry to a checkpoint through the chain
+// segment between them.
+type InclusionProof struct {
+	Entries    []Entry    `json:"entries"` // the entry first, the checkpointed entry last
+	Checkpoint Checkpoint `json:"checkpoint"`
+}
+
+// ProofResult is what a verified InclusionProof establishes.
+type ProofResult struct {
+	EntryID    int64  `json:"entry_id"`
+	NodeID     string `json:"node_id"`
+	Sequence   int64  `json:"sequence"`
+	AnchoredAt int64  `json:"anchored_at"`
+	// Witnesses are the other nodes whose valid countersignatures show the
+	// entry existed by FirstWitnessedAt.
+	Witnesses        []string `json:"witnesses"`
+	FirstWitnessedAt int64    `json:"first_witnessed_at,omitempty"`
+}
+
+// ProveEntry builds an inclusion proof for entry id against the earliest
+// of nodeID's checkpoints that covers it, preferring countersigned ones.
+func (l *Logger) ProveEntry(nodeID string, id int64) (*InclusionProof, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var sequence int64
+	err := l.db.QueryRow(`
+		SELECT c.sequence FROM audit_checkpoints c
+		WHERE c.node_id = ? AND c.sequence >= ?
+		ORDER BY EXISTS (
+			SELECT 1 FROM audit_countersignatures s WHERE s.node_id = c.node_id AND s.sequence = c.sequence
+		) DESC, c.sequence ASC
+		LIMIT 1
+	`, nodeID, id).Scan(&sequence)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoCheckpoint
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := l.checkpointLocked(nodeID, sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := l.db.Query(`
+		SELECT `+entryColumns+`
+		FROM audit_log WHERE id >= ? AND id <= ? ORDER BY id ASC
+	`, id, sequence)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	proof := &InclusionProof{Checkpoint: *c}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		proof.Entries = append(proof.Entries, entry)
+	}
+	if len(proof.Entries) == 0 || proof.Entries[0].ID != id {
+		return nil, ErrEntryNotFound
+	}
+	return proof, rows.Err()
+}
+
+// Verify checks the proof without access to the log: the entries must
+// hash-link from the first to the checkpointed one, and the checkpoint must
+// be signed by its node. Invalid countersignatures are ignored.
+func (p *InclusionProof) Verify() (*ProofResult, error) {
+	if len(p.Entries) == 0 {
+		return nil, errors.New("proof has no entries")
+	}
+	if err := p.Checkpoint.Verify(); err != nil {
+		return nil, err
+	}
+	for i, e := range p.Entries {
+		if computeEntryHash(e) != e.EntryHash {
+			return nil, fmt.Errorf("%w: entry %d hash mismatch", ErrLogTampered, e.ID)
+		}
+		if i > 0 {
+			prev := p.Entries[i-1]
+			if e.ID != prev.ID+1 || e.PreviousHash != prev.EntryHash {
+				return nil, fmt.Errorf("%w: chain break at entry %d", ErrLogTampered, e.ID)
+			}
+		}
+	}
+	last := p.Entries[len(p.Entries)-1]
+	if last.ID != p.Checkpoint.Sequence || last.EntryHash != p.Checkpoint.Hash {
+		return nil, fmt.Errorf("%w: segment does not end at the checkpoint", ErrLogTampered)
+	}
+
+	result := &ProofResult{
+		EntryID:    p.Entries[0].ID,
+		NodeID:     p.Checkpoint.NodeID,
+		Sequence:   p.Checkpoint.Sequence,
+		AnchoredAt: p.Checkpoint.Timestamp,
+		Witnesses:  []string{},
+	}
+	seen := make(map[string]bool)
+	for _, cs := range p.Checkpoint.Countersignatures {
+		if cs.PeerID == p.Checkpoint.NodeID || seen[cs.PeerID] || p.Checkpoint.VerifyCountersignature(cs) != nil {
+			continue
+		}
+		seen[cs.PeerID] = true
+		result.Witnesses = append(result.Witnesses, cs.PeerID)
+		if result.FirstWitnessedAt == 0 || cs.WitnessedAt < result.FirstWitnessedAt {
+			result.FirstWitnessedAt = cs.WitnessedAt
+		}
+	}
+	sort.Strings(result.Witnesses)
+	return result, nil
+}
+
+// anchorMessage is the pubsub envelope on CheckpointTopic.
+type anchorMessage struct {
+	Type             string            `json:"type"`
+	Checkpoint       *Checkpoint       `json:"checkpoint,omitempty"`
+	NodeID           string            `json:"node_id,omitempty"`
+	Sequence         int64             `json:"sequence,omitempty"`
+	Countersignature *Countersignature `json:"countersignature,omitempty"`
+}
+
+// Anchorer publishes this node's checkpoints and countersigns those of the
+// nodes it witnesses for.
+type Anchorer struct {
+	log     *Logger
+	key     crypto.PrivKey
+	nodeID  string
+	publish func([]byte) error
+	pin     func(ctx context.Context, data []byte) (string, error)
+	witness func(nodeID string) bool
+}
+
+// NewAnchorer creates an anchorer that signs with the node identity key.
+func NewAnchorer(l *Logger, key crypto.PrivKey) (*Anchorer, error) {
+	pid, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("derive node ID: %w", err)
+	}
+	return &Anchorer{log: l, key: key, nodeID: pid.String()}, nil
+}
+
+// NodeID returns the ID checkpoints are signed under.
+func (a *Anchorer) NodeID() string { return a.nodeID }
+
+// Logger returns the audit log being anchored.
+func (a *Anchorer) Logger() *Logger { return a.log }
+
+// SetPublisher sets how checkpoints and countersignatures reach other nodes.
+func (a *Anchorer) SetPublisher(fn func([]byte) error) { a.publish = fn }
+
+// SetPinner sets how signed checkpoints are pinned, returning their CID.
+func (a *Anchorer) SetPinner(fn func(ctx context.Context, data []byte) (string, error)) { a.pin = fn }
+
+// SetWitnessPolicy selects the nodes whose checkpoints this node
+// countersigns and whose countersignatures it accepts. Without one, it
+// witnesses for no one.
+func (a *Anchorer) SetWitnessPolicy(fn func(nodeID string) bool) { a.witness = fn }
+
+func (a *Anchorer) trusts(nodeID string) bool {
+	return a.witness != nil && nodeID != a.nodeID && a.witness(nodeID)
+}
+
+// Anchor checkpoints the chain head, pins the checkpoint and publishes it.
+// Pinning and publishing failures are logged; the checkpoint still stands.
+func (a *Anchorer) Anchor(ctx context.Context) (*Checkpoint, error) {
+	c, err := a.log.CreateCheckpoint(a.key)
+	if err != nil {
+		return nil, err
+	}
+	if a.pin != nil {
+		signed, _ := json.Marshal(c)
+		if cid, err := a.pin(ctx, signed); err != nil {
+			log.Warnf("Failed to pin audit checkpoint %d: %v", c.Sequence, err)
+		} else if err := a.log.SetCheckpointCID(c.NodeID, c.Sequence, cid); err != nil {
+			log.Warnf("Failed to record checkpoint CID: %v", err)
+		} else {
+			c.CID = cid
+		}
+	}
+	if a.publish != nil {
+		data, _ := json.Marshal(anchorMessage{Type: "checkpoint", Checkpoint: c})
+		if err := a.publish(data); err != nil {
+			log.Warnf("Failed to publish audit checkpoint %d: %v", c.Sequence, err)
+		}
+	}
+	return c, nil
+}
+
+// HandleMessage processes a message from CheckpointTopic. Checkpoints from
+// witnessed nodes are stored and countersigned; countersignatures of this
+// node's checkpoints from those nodes are stored.
+func (a *Anchorer) HandleMessage(data []byte) error {
+	var msg anchorMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("decode anchor message: %w", err)
+	}
+	switch msg.Type {
+	case "checkpoint":
+		c := msg.Checkpoint
+		if c == nil || !a.trusts(c.NodeID) {
+			return nil
+		}
+		c.Countersignatures = nil
+		if err := a.log.SaveCheckpoint(c); err != nil {
+			if errors.Is(err, ErrCheckpointConflict) {
+				a.log.Record(Event{
+					Type:        EventTypeCheckpointConflict,
+					Severity:    SeverityCritical,
+					TargetType:  "node",
+					TargetID:    c.NodeID,
+					Description: fmt.Sprintf("Node republished audit checkpoint %d with a different hash", c.Sequence),
+					Details:     map[string]interface{}{"sequence": c.Sequence, "hash": c.Hash},
+				})
+			}
+			return err
+		}
+		cs, err := c.Countersign(a.key)
+		if err != nil {
+			return err
+		}
+		if err := a.log.AddCountersignature(c.NodeID, c.Sequence, cs); err != nil {
+			return err
+		}
+		if a.publish == nil {
+			return nil
+		}
+		reply, _ := json.Marshal(anchorMessage{
+			Type: "countersignature", NodeID: c.NodeID, Sequence: c.Sequence, Countersignature: &cs,
+		})
+		return a.publish(reply)
+	case "countersignature":
+		if msg.NodeID != a.nodeID || msg.Countersignature == nil || !a.trusts(msg.Countersignature.PeerID) {
+			return nil
+		}
+		return a.log.AddCountersignature(msg.NodeID, msg.Sequence, *msg.Countersignature)
+	default:
+		return fmt.Errorf("unknown anchor message type %q", msg.Type)
+	}
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func newTestAnchorer(t *testing.T) *Anchorer {
+	t.Helper()
+	l, err := NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	a, err := NewAnchorer(l, key)
+	if err != nil {
+		t.Fatalf("NewAnchorer: %v", err)
+	}
+	return a
+}
+
+func TestAnchorAndCountersign(t *testing.T) {
+	alice, bob := newTestAnchorer(t), newTestAnchorer(t)
+	alice.SetWitnessPolicy(func(id string) bool { return id == bob.NodeID() })
+	bob.SetWitnessPolicy(func(id string) bool { return id == alice.NodeID() })
+
+	// Messages are delivered synchronously: alice's go to bob and back.
+	var toBob, toAlice [][]byte
+	alice.SetPublisher(func(data []byte) error { toBob = append(toBob, data); return nil })
+	bob.SetPublisher(func(data []byte) error { toAlice = append(toAlice, data); return nil })
+	alice.SetPinner(func(ctx context.Context, data []byte) (string, error) { return "bafy-checkpoint", nil })
+
+	if _, err := alice.Anchor(context.Background()); !errors.Is(err, ErrNothingToAnchor) {
+		t.Fatalf("Anchor on empty log = %v, want ErrNothingToAnchor", err)
+	}
+	for _, desc := range []string{"first", "second", "third"} {
+		alice.Logger().Record(Event{Type: EventTypeUserAdd, Description: desc})
+	}
+	c, err := alice.Anchor(context.Background())
+	if err != nil {
+		t.Fatalf("Anchor: %v", err)
+	}
+	if c.Sequence != 3 || c.Hash != alice.Logger().LastHash() || c.CID != "bafy-checkpoint" {
+		t.Errorf("Unexpected checkpoint: %+v", c)
+	}
+	if _, err := alice.Anchor(context.Background()); !errors.Is(err, ErrNothingToAnchor) {
+		t.Errorf("Second anchor without new entries = %v, want ErrNothingToAnchor", err)
+	}
+
+	for _, msg := range toBob {
+		if err := bob.HandleMessage(msg); err != nil {
+			t.Fatalf("bob.HandleMessage: %v", err)
+		}
+	}
+	for _, msg := range toAlice {
+		if err := alice.HandleMessage(msg); err != nil {
+			t.Fatalf("alice.HandleMessage: %v", err)
+		}
+	}
+
+	witnessed, err := bob.Logger().Checkpoints(alice.NodeID(), 0)
+	if err != nil || len(witnessed) != 1 {
+		t.Fatalf("Bob's copy of alice's checkpoints = %d, %v", len(witnessed), err)
+	}
+
+	proof, err := alice.Logger().ProveEntry(alice.NodeID(), 2)
+	if err != nil {
+		t.Fatalf("ProveEntry: %v", err)
+	}
+	if len(proof.Entries) != 2 || len(proof.Checkpoint.Countersignatures) != 1 {
+		t.Fatalf("Unexpected proof: %d entries, %d countersignatures", len(proof.Entries), len(proof.Checkpoint.Countersignatures))
+	}
+
+	// The proof survives a round trip and verifies without either log.
+	data, _ := json.Marshal(proof)
+	var decoded InclusionProof
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal proof: %v", err)
+	}
+	result, err := decoded.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.EntryID != 2 || len(result.Witnesses) != 1 || result.Witnesses[0] != bob.NodeID() {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	decoded.Entries[0].Description = "rewritten"
+	if _, err := decoded.Verify(); !errors.Is(err, ErrLogTampered) {
+		t.Errorf("Tampered proof = %v, want ErrLogTampered", err)
+	}
+}
+
+func TestCheckpointConflict(t *testing.T) {
+	alice, bob := newTestAnchorer(t), newTestAnchorer(t)
+	bob.SetWitnessPolicy(func(string) bool { return true })
+
+	alice.Logger().Record(Event{Type: EventTypeUserAdd, Description: "original"})
+	c, err := alice.Anchor(context.Background())
+	if err != nil {
+		t.Fatalf("Anchor: %v", err)
+	}
+	msg, _ := json.Marshal(anchorMessage{Type: "checkpoint", Checkpoint: c})
+	if err := bob.HandleMessage(msg); err != nil {
+		t.Fatalf("HandleMessage: %v", err)
+	}
+
+	// Alice re-signs the same sequence over a rewritten chain.
+	forged := *c
+	forged.Hash = "rewritten"
+	forged.Signature, _ = alice.key.Sign(forged.signingBytes())
+	msg, _ = json.Marshal(anchorMessage{Type: "checkpoint", Checkpoint: &forged})
+	if err := bob.HandleMessage(msg); !errors.Is(err, ErrCheckpointConflict) {
+		t.Fatalf("Equivocating checkpoint = %v, want ErrCheckpointConflict", err)
+	}
+	if entries, _ := bob.Logger().Query(QueryOptions{EventType: EventTypeCheckpointConflict}); len(entries) != 1 {
+		t.Errorf("Conflict should be recorded in bob's log, got %d entries", len(entries))
+	}
+
+	// Checkpoints signed by someone else are rejected outright.
+	forged.Signature, _ = bob.key.Sign(forged.signingBytes())
+	forged.Sequence = 2
+	if err := bob.Logger().SaveCheckpoint(&forged); !errors.Is(err, ErrInvalidCheckpoint) {
+		t.Errorf("Forged signature = %v, want ErrInvalidCheckpoint", err)
+	}
+}
+
+func TestUntrustedCheckpointIgnored(t *testing.T) {
+	alice, bob := newTestAnchorer(t), newTestAnchorer(t)
+	alice.Logger().Record(Event{Type: EventTypeUserAdd, Description: "entry"})
+	c, err := alice.Anchor(context.Background())
+	if err != nil {
+		t.Fatalf("Anchor: %v", err)
+	}
+	msg, _ := json.Marshal(anchorMessage{Type: "checkpoint", Checkpoint: c})
+	if err := bob.HandleMessage(msg); err != nil {
+		t.Fatalf("HandleMessage: %v", err)
+	}
+	if stored, _ := bob.Logger().Checkpoints(alice.NodeID(), 0); len(stored) != 0 {
+		t.Error("Checkpoints from nodes outside the witness policy should be ignored")
+	}
+	if _, err := alice.Logger().ProveEntry(alice.NodeID(), 2); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("ProveEntry past the checkpoint = %v, want ErrNoCheckpoint", err)
+	}
+}
@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIHandler serves the audit log to administrators. It does no
+// authentication of its own; mount it behind the admin gate.
+type APIHandler struct {
+	logger   *Logger
+	anchorer *Anchorer
+}
+
+// NewAPIHandler creates a handler for the audit log endpoints.
+func NewAPIHandler(logger *Logger) *APIHandler {
+	return &APIHandler{logger: logger}
+}
+
+// SetAnchorer enables the checkpoint and inclusion proof endpoints.
+func (h *APIHandler) SetAnchorer(a *Anchorer) {
+	h.anchorer = a
+}
+
+// RegisterRoutes registers the audit log endpoints.
+func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/admin/audit", h.handleQuery)
+	mux.HandleFunc("/api/admin/audit/export", h.handleExport)
+	mux.HandleFunc("/api/admin/audit/verify", h.handleVerify)
+	mux.HandleFunc("/api/admin/audit/checkpoints", h.handleCheckpoints)
+	mux.HandleFunc("/api/admin/audit/proof", h.handleProof)
+	mux.HandleFunc("/api/admin/audit/proof/verify", h.handleVerifyProof)
+}
+
+// queryOptionsFromRequest reads filters from the query string. since and
+// until are RFC 3339 timestamps or Unix seconds.
+func queryOptionsFromRequest(r *http.Request) (QueryOptions, error) {
+	q := r.URL.Query()
+	opts := QueryOptions{
+		EventType:  q.Get("event_type"),
+		Severity:   q.Get("severity"),
+		ActorXPub:  q.Get("actor"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	var err error
+	if opts.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		return opts, err
+	}
+	if opts.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		return opts, err
+	}
+	for name, dst := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dst = n
+		}
+	}
+	return opts, nil
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (h *APIHandler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := queryOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit == 0 {
+		opts.Limit = 100
+	}
+	entries, err := h.logger.Query(opts)
+	if err != nil {
+		http.Error(w, "failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+// handleExport returns every entry matching the filters, oldest first, so
+// the download can be re-verified offline from the genesis hash.
+func (h *APIHandler) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := queryOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := h.logger.Query(opts)
+	if err != nil {
+		http.Error(w, "failed to export audit log", http.StatusInternalServerError)
+		return
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=audit.json")
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (h *APIHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	valid, err := h.logger.VerifyChain()
+	count, _ := h.logger.Count()
+	resp := map[string]interface{}{
+		"valid":     valid,
+		"entries":   count,
+		"last_hash": h.logger.LastHash(),
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCheckpoints lists a node's checkpoints (GET, ?node= defaults to
+// this node) or anchors the chain head now (POST).
+func (h *APIHandler) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if h.anchorer == nil {
+		http.Error(w, "audit anchoring is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		nodeID := r.URL.Query().Get("node")
+		if nodeID == "" {
+			nodeID = h.anchorer.NodeID()
+		}
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		checkpoints, err := h.logger.Checkpoints(nodeID, limit)
+		if err != nil {
+			http.Error(w, "failed to list checkpoints", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": nodeID, "checkpoints": checkpoints})
+	case http.MethodPost:
+		c, err := h.anchorer.Anchor(r.Context())
+		if errors.Is(err, ErrNothingToAnchor) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to create checkpoint", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, c)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProof returns an inclusion proof for ?entry= against this node's
+// checkpoints.
+func (h *APIHandler) handleProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.anchorer == nil {
+		http.Error(w, "audit anchoring is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("entry"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid entry parameter", http.StatusBadRequest)
+		return
+	}
+	proof, err := h.logger.ProveEntry(h.anchorer.NodeID(), id)
+	switch {
+	case errors.Is(err, ErrNoCheckpoint), errors.Is(err, ErrEntryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "failed to build proof", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, proof)
+}
+
+// handleVerifyProof checks a posted inclusion proof. It needs nothing from
+// this node's log, so proofs from any node can be verified.
+func (h *APIHandler) handleVerifyProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var proof InclusionProof
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&proof); err != nil {
+		http.Error(w, "invalid proof", http.StatusBadRequest)
+		return
+	}
+	result, err := proof.Verify()
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"valid": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"valid": true, "result": result})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
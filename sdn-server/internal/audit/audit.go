@@ -41,6 +41,30 @@ const (
 	EventTypeSetupComplete    = "setup.complete"
 	EventTypeServerStart      = "server.start"
 	EventTypeServerStop       = "server.stop"
+	EventTypePeerUpdate       = "peer.update"
+	EventTypePeerBlock        = "peer.block"
+	EventTypePeerUnblock      = "peer.unblock"
+	EventTypePeerImport       = "peer.import"
+	EventTypeGroupChange      = "peer.group_change"
+	EventTypeACLImport        = "peer.acl_import"
+	EventTypeUserAdd          = "user.add"
+	EventTypeUserUpdate       = "user.update"
+	EventTypeUserRemove       = "user.remove"
+	EventTypePluginUpload     = "plugin.upload"
+	EventTypePinningChange    = "pinning.change"
+	EventTypeListingChange    = "storefront.listing_change"
+	EventTypeFrontendWrite    = "frontend.write"
+	EventTypeFrontendDelete   = "frontend.delete"
+	EventTypePeerEndorse      = "peer.endorse"
+	EventTypeAPIKeyCreate     = "apikey.create"
+	EventTypeAPIKeyRotate     = "apikey.rotate"
+	EventTypeAPIKeyRevoke     = "apikey.revoke"
+	EventTypeLicensePolicy    = "license.plan_policy"
+	EventTypeLicenseKeyRotate = "license.key_rotate"
+	EventTypeLicenseRevoke    = "license.revoke"
+	EventTypeIssuerTrust      = "license.issuer_trust"
+	EventTypeEntitlement      = "license.entitlement"
+	EventTypePublisherChange  = "plugin.publisher_change"
 )
 
 // Severity levels
@@ -74,6 +98,7 @@ type Entry struct {
 	Severity     string    `json:"severity"`
 	ActorID      int64     `json:"actor_id,omitempty"`      // Admin ID who performed action
 	ActorIP      string    `json:"actor_ip,omitempty"`      // IP address
+	ActorXPub    string    `json:"actor_xpub,omitempty"`    // Wallet xpub of the authenticated caller
 	TargetType   string    `json:"target_type,omitempty"`   // Type of target (peer, config, etc.)
 	TargetID     string    `json:"target_id,omitempty"`     // ID of target
 	Description  string    `json:"description"`
@@ -154,8 +179,27 @@ func (l *Logger) initDB() error {
 		return err
 	}
 	_, err = l.db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_actor ON audit_log(actor_id)`)
+	if err != nil {
+		return err
+	}
+
+	// actor_xpub was added after the first release; add it to older logs.
+	var hasXPub int
+	err = l.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('audit_log') WHERE name = 'actor_xpub'`).Scan(&hasXPub)
+	if err != nil {
+		return err
+	}
+	if hasXPub == 0 {
+		if _, err := l.db.Exec(`ALTER TABLE audit_log ADD COLUMN actor_xpub TEXT`); err != nil {
+			return err
+		}
+	}
+	_, err = l.db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_actor_xpub ON audit_log(actor_xpub)`)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return l.initCheckpointDB()
 }
 
 // loadLastHash loads the hash of the most recent log entry.
@@ -186,34 +230,33 @@ func (l *Logger) Log(eventType, severity, description string, actorID int64, act
 
 // LogWithTarget creates a new audit log entry with target information.
 func (l *Logger) LogWithTarget(eventType, severity, description string, actorID int64, actorIP, targetType, targetID string, details map[string]interface{}) error {
+	return l.write(Entry{
+		EventType:   eventType,
+		Severity:    severity,
+		ActorID:     actorID,
+		ActorIP:     actorIP,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		Description: description,
+	}, details)
+}
+
+// write appends entry to the chain, filling in its timestamp and hashes.
+func (l *Logger) write(entry Entry, details map[string]interface{}) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	timestamp := time.Now().UTC()
-
 	// Serialize details
-	var detailsJSON string
 	if details != nil {
 		data, err := json.Marshal(details)
 		if err != nil {
 			return fmt.Errorf("failed to marshal details: %w", err)
 		}
-		detailsJSON = string(data)
+		entry.Details = string(data)
 	}
 
-	// Create entry for hashing
-	entry := Entry{
-		Timestamp:    timestamp,
-		EventType:    eventType,
-		Severity:     severity,
-		ActorID:      actorID,
-		ActorIP:      actorIP,
-		TargetType:   targetType,
-		TargetID:     targetID,
-		Description:  description,
-		Details:      detailsJSON,
-		PreviousHash: l.lastHash,
-	}
+	entry.Timestamp = time.Now().UTC()
+	entry.PreviousHash = l.lastHash
 
 	// Compute hash
 	entryHash := computeEntryHash(entry)
@@ -221,11 +264,11 @@ func (l *Logger) LogWithTarget(eventType, severity, description string, actorID
 
 	// Insert into database
 	result, err := l.db.Exec(`
-		INSERT INTO audit_log (timestamp, event_type, severity, actor_id, actor_ip,
+		INSERT INTO audit_log (timestamp, event_type, severity, actor_id, actor_ip, actor_xpub,
 			target_type, target_id, description, details, previous_hash, entry_hash)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, timestamp.Unix(), eventType, severity, actorID, actorIP,
-		targetType, targetID, description, detailsJSON, l.lastHash, entryHash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Timestamp.Unix(), entry.EventType, entry.Severity, entry.ActorID, entry.ActorIP, entry.ActorXPub,
+		entry.TargetType, entry.TargetID, entry.Description, entry.Details, l.lastHash, entryHash)
 
 	if err != nil {
 		return fmt.Errorf("failed to write audit log: %w", err)
@@ -236,7 +279,7 @@ func (l *Logger) LogWithTarget(eventType, severity, description string, actorID
 	l.lastID = id
 	l.lastHash = entryHash
 
-	log.Debugf("Audit: [%s] %s - %s", eventType, severity, description)
+	log.Debugf("Audit: [%s] %s - %s", entry.EventType, entry.Severity, entry.Description)
 	return nil
 }
 
@@ -245,6 +288,10 @@ func computeEntryHash(e Entry) string {
 	data := fmt.Sprintf("%d|%s|%s|%d|%s|%s|%s|%s|%s|%s",
 		e.Timestamp.Unix(), e.EventType, e.Severity, e.ActorID, e.ActorIP,
 		e.TargetType, e.TargetID, e.Description, e.Details, e.PreviousHash)
+	// Entries written before actor_xpub existed hash without it.
+	if e.ActorXPub != "" {
+		data += "|" + e.ActorXPub
+	}
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
@@ -255,8 +302,7 @@ func (l *Logger) VerifyChain() (bool, error) {
 	defer l.mu.Unlock()
 
 	rows, err := l.db.Query(`
-		SELECT id, timestamp, event_type, severity, actor_id, actor_ip,
-			target_type, target_id, description, details, previous_hash, entry_hash
+		SELECT `+entryColumns+`
 		FROM audit_log ORDER BY id ASC
 	`)
 	if err != nil {
@@ -268,35 +314,11 @@ func (l *Logger) VerifyChain() (bool, error) {
 	var count int
 
 	for rows.Next() {
-		var entry Entry
-		var timestamp int64
-		var actorID sql.NullInt64
-		var actorIP, targetType, targetID, details sql.NullString
-
-		err := rows.Scan(&entry.ID, &timestamp, &entry.EventType, &entry.Severity,
-			&actorID, &actorIP, &targetType, &targetID, &entry.Description,
-			&details, &entry.PreviousHash, &entry.EntryHash)
+		entry, err := scanEntry(rows)
 		if err != nil {
 			return false, fmt.Errorf("failed to scan entry: %w", err)
 		}
 
-		entry.Timestamp = time.Unix(timestamp, 0)
-		if actorID.Valid {
-			entry.ActorID = actorID.Int64
-		}
-		if actorIP.Valid {
-			entry.ActorIP = actorIP.String
-		}
-		if targetType.Valid {
-			entry.TargetType = targetType.String
-		}
-		if targetID.Valid {
-			entry.TargetID = targetID.String
-		}
-		if details.Valid {
-			entry.Details = details.String
-		}
-
 		// Verify previous hash matches expected
 		if entry.PreviousHash != expectedPrevHash {
 			log.Errorf("Chain break at entry %d: expected prev hash %s, got %s",
@@ -326,8 +348,7 @@ func (l *Logger) Query(opts QueryOptions) ([]Entry, error) {
 	defer l.mu.Unlock()
 
 	query := `
-		SELECT id, timestamp, event_type, severity, actor_id, actor_ip,
-			target_type, target_id, description, details, previous_hash, entry_hash
+		SELECT `+entryColumns+`
 		FROM audit_log WHERE 1=1
 	`
 	var args []interface{}
@@ -344,6 +365,18 @@ func (l *Logger) Query(opts QueryOptions) ([]Entry, error) {
 		query += " AND actor_id = ?"
 		args = append(args, opts.ActorID)
 	}
+	if opts.ActorXPub != "" {
+		query += " AND actor_xpub = ?"
+		args = append(args, opts.ActorXPub)
+	}
+	if opts.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, opts.TargetType)
+	}
+	if opts.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, opts.TargetID)
+	}
 	if !opts.Since.IsZero() {
 		query += " AND timestamp >= ?"
 		args = append(args, opts.Since.Unix())
@@ -370,35 +403,11 @@ func (l *Logger) Query(opts QueryOptions) ([]Entry, error) {
 
 	var entries []Entry
 	for rows.Next() {
-		var entry Entry
-		var timestamp int64
-		var actorID sql.NullInt64
-		var actorIP, targetType, targetID, details sql.NullString
-
-		err := rows.Scan(&entry.ID, &timestamp, &entry.EventType, &entry.Severity,
-			&actorID, &actorIP, &targetType, &targetID, &entry.Description,
-			&details, &entry.PreviousHash, &entry.EntryHash)
+		entry, err := scanEntry(rows)
 		if err != nil {
 			continue
 		}
 
-		entry.Timestamp = time.Unix(timestamp, 0)
-		if actorID.Valid {
-			entry.ActorID = actorID.Int64
-		}
-		if actorIP.Valid {
-			entry.ActorIP = actorIP.String
-		}
-		if targetType.Valid {
-			entry.TargetType = targetType.String
-		}
-		if targetID.Valid {
-			entry.TargetID = targetID.String
-		}
-		if details.Valid {
-			entry.Details = details.String
-		}
-
 		entries = append(entries, entry)
 	}
 
@@ -407,13 +416,16 @@ func (l *Logger) Query(opts QueryOptions) ([]Entry, error) {
 
 // QueryOptions specifies filters for querying the audit log.
 type QueryOptions struct {
-	EventType string
-	Severity  string
-	ActorID   int64
-	Since     time.Time
-	Until     time.Time
-	Limit     int
-	Offset    int
+	EventType  string
+	Severity   string
+	ActorID    int64
+	ActorXPub  string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
 }
 
 // GetEntry retrieves a single audit log entry by ID.
@@ -421,43 +433,45 @@ func (l *Logger) GetEntry(id int64) (*Entry, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	var entry Entry
-	var timestamp int64
-	var actorID sql.NullInt64
-	var actorIP, targetType, targetID, details sql.NullString
-
-	err := l.db.QueryRow(`
-		SELECT id, timestamp, event_type, severity, actor_id, actor_ip,
-			target_type, target_id, description, details, previous_hash, entry_hash
+	entry, err := scanEntry(l.db.QueryRow(`
+		SELECT `+entryColumns+`
 		FROM audit_log WHERE id = ?
-	`, id).Scan(&entry.ID, &timestamp, &entry.EventType, &entry.Severity,
-		&actorID, &actorIP, &targetType, &targetID, &entry.Description,
-		&details, &entry.PreviousHash, &entry.EntryHash)
-
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrEntryNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	entry.Timestamp = time.Unix(timestamp, 0)
-	if actorID.Valid {
-		entry.ActorID = actorID.Int64
-	}
-	if actorIP.Valid {
-		entry.ActorIP = actorIP.String
-	}
-	if targetType.Valid {
-		entry.TargetType = targetType.String
-	}
-	if targetID.Valid {
-		entry.TargetID = targetID.String
-	}
-	if details.Valid {
-		entry.Details = details.String
+	return &entry, nil
+}
+
+// entryColumns lists the audit_log columns in the order scanEntry reads them.
+const entryColumns = `id, timestamp, event_type, severity, actor_id, actor_ip, actor_xpub,
+			target_type, target_id, description, details, previous_hash, entry_hash`
+
+// scanEntry reads one row selected with entryColumns.
+func scanEntry(row interface{ Scan(dest ...interface{}) error }) (Entry, error) {
+	var entry Entry
+	var timestamp int64
+	var actorID sql.NullInt64
+	var actorIP, actorXPub, targetType, targetID, details sql.NullString
+
+	err := row.Scan(&entry.ID, &timestamp, &entry.EventType, &entry.Severity,
+		&actorID, &actorIP, &actorXPub, &targetType, &targetID, &entry.Description,
+		&details, &entry.PreviousHash, &entry.EntryHash)
+	if err != nil {
+		return Entry{}, err
 	}
 
-	return &entry, nil
+	entry.Timestamp = time.Unix(timestamp, 0)
+	entry.ActorID = actorID.Int64
+	entry.ActorIP = actorIP.String
+	entry.ActorXPub = actorXPub.String
+	entry.TargetType = targetType.String
+	entry.TargetID = targetID.String
+	entry.Details = details.String
+	return entry, nil
 }
 
 // Count returns the total number of audit log entries.
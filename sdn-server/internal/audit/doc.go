@@ -21,10 +21,33 @@
 //   - admin.login, admin.logout: Authentication events
 //   - admin.password_change: Security-sensitive changes
 //   - peer.trust_change, peer.add, peer.remove: Peer management
+//   - peer.endorse: Trust endorsements issued or revoked by this node
 //   - config.change: Configuration modifications
 //   - key.generate, key.backup, key.restore: Key management
 //   - setup.start, setup.complete: First-time setup
 //   - server.start, server.stop: Server lifecycle
+//   - user.add, user.update, user.remove: Wallet user management
+//   - apikey.create, apikey.rotate, apikey.revoke: API keys for machine clients
+//   - plugin.upload, pinning.change, storefront.listing_change: Node content and policy
+//   - frontend.write, frontend.delete: Public frontend files
+//
+// # Daemon Events
+//
+// Handlers record typed events with Record or RecordRequest. An Event names
+// the actor's wallet xpub and IP, the target, and the target's state before
+// and after the change; RecordRequest takes the actor from the request, where
+// the auth middleware attaches it with WithActor. APIHandler serves the log
+// at /api/admin/audit, with /export and /verify sub-paths.
+//
+// # External Anchoring
+//
+// An Anchorer signs checkpoints of the chain head with the node's libp2p
+// identity and publishes them on CheckpointTopic. Nodes admitted by its
+// witness policy store each other's checkpoints and countersign them, so
+// the log cannot be rewritten behind a checkpoint without the rewrite
+// showing up as a conflicting checkpoint elsewhere. ProveEntry returns an
+// InclusionProof linking an entry to a countersigned checkpoint; its Verify
+// needs neither log.
 //
 // # Severity Levels
 //
@@ -38,7 +61,8 @@
 // The audit log supports flexible querying:
 //   - By event type
 //   - By severity
-//   - By actor (admin ID)
+//   - By actor (admin ID or xpub)
+//   - By target (type and ID)
 //   - By time range
 //   - With pagination (limit/offset)
 //
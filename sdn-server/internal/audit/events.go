@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Event is a typed record of a privileged action.
+type Event struct {
+	Type        string
+	Severity    string // defaults to SeverityInfo
+	ActorXPub   string
+	ActorIP     string
+	TargetType  string
+	TargetID    string
+	Description string
+	// Before and After hold the target's state around the change; either
+	// may be nil for creations and removals.
+	Before  interface{}
+	After   interface{}
+	Details map[string]interface{}
+}
+
+// Record appends e to the chain. A nil Logger discards the event, so
+// handlers can record unconditionally.
+func (l *Logger) Record(e Event) error {
+	if l == nil {
+		return nil
+	}
+	if e.Severity == "" {
+		e.Severity = SeverityInfo
+	}
+	details := make(map[string]interface{}, len(e.Details)+2)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	if e.Before != nil {
+		details["before"] = e.Before
+	}
+	if e.After != nil {
+		details["after"] = e.After
+	}
+	if len(details) == 0 {
+		details = nil
+	}
+	return l.write(Entry{
+		EventType:   e.Type,
+		Severity:    e.Severity,
+		ActorIP:     e.ActorIP,
+		ActorXPub:   e.ActorXPub,
+		TargetType:  e.TargetType,
+		TargetID:    e.TargetID,
+		Description: e.Description,
+	}, details)
+}
+
+// RecordRequest records e with the actor taken from r: the xpub attached by
+// WithActor and the client IP. Failures are logged rather than returned so
+// an audit outage does not fail the action it describes.
+func (l *Logger) RecordRequest(r *http.Request, e Event) {
+	if l == nil {
+		return
+	}
+	if e.ActorXPub == "" {
+		e.ActorXPub = ActorFromContext(r.Context())
+	}
+	if e.ActorIP == "" {
+		e.ActorIP = ClientIP(r)
+	}
+	if err := l.Record(e); err != nil {
+		log.Errorf("Failed to record %s audit event: %v", e.Type, err)
+	}
+}
+
+type contextKey string
+
+const actorContextKey contextKey = "audit_actor"
+
+// WithActor returns ctx carrying the xpub of the authenticated caller.
+func WithActor(ctx context.Context, xpub string) context.Context {
+	return context.WithValue(ctx, actorContextKey, xpub)
+}
+
+// ActorFromContext returns the xpub attached by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	xpub, _ := ctx.Value(actorContextKey).(string)
+	return xpub
+}
+
+// ClientIP returns the request's client address, honoring X-Forwarded-For
+// and X-Real-IP only from a loopback proxy.
+func ClientIP(r *http.Request) string {
+	remoteHost, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if remoteHost == "" {
+		remoteHost = r.RemoteAddr
+	}
+	if ip := net.ParseIP(remoteHost); ip != nil && ip.IsLoopback() {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+		if xri := r.Header.Get("X-Real-IP"); xri != "" {
+			return strings.TrimSpace(xri)
+		}
+	}
+	return strings.TrimSpace(remoteHost)
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRecordRequest(t *testing.T) {
+	l, err := NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer l.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/peers/x", nil)
+	req.RemoteAddr = "127.0.0.1:4000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	req = req.WithContext(WithActor(req.Context(), "xpub-admin"))
+
+	l.RecordRequest(req, Event{
+		Type:        EventTypePeerTrustChange,
+		TargetType:  "peer",
+		TargetID:    "peer-1",
+		Description: "Peer trust level changed",
+		Before:      map[string]string{"trust_level": "standard"},
+		After:       map[string]string{"trust_level": "admin"},
+	})
+	l.RecordRequest(req, Event{Type: EventTypeUserAdd, TargetType: "user", TargetID: "xpub-new", Description: "User added"})
+
+	entries, err := l.Query(QueryOptions{ActorXPub: "xpub-admin", TargetID: "peer-1"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Query = %d entries, %v", len(entries), err)
+	}
+	e := entries[0]
+	if e.ActorIP != "203.0.113.9" || e.Severity != SeverityInfo {
+		t.Errorf("Unexpected actor or severity: %+v", e)
+	}
+	var details map[string]map[string]string
+	if err := json.Unmarshal([]byte(e.Details), &details); err != nil {
+		t.Fatalf("Details are not JSON: %v", err)
+	}
+	if details["before"]["trust_level"] != "standard" || details["after"]["trust_level"] != "admin" {
+		t.Errorf("Unexpected details: %s", e.Details)
+	}
+
+	if valid, err := l.VerifyChain(); !valid || err != nil {
+		t.Fatalf("Chain should verify: %v", err)
+	}
+
+	// The xpub is covered by the entry hash.
+	if _, err := l.db.Exec(`UPDATE audit_log SET actor_xpub = 'xpub-other' WHERE id = ?`, e.ID); err != nil {
+		t.Fatalf("Failed to tamper: %v", err)
+	}
+	if valid, _ := l.VerifyChain(); valid {
+		t.Error("Tampered actor_xpub should break the chain")
+	}
+}
+
+func TestRecordNilLogger(t *testing.T) {
+	var l *Logger
+	if err := l.Record(Event{Type: EventTypeUserAdd}); err != nil {
+		t.Errorf("Nil logger should discard events: %v", err)
+	}
+	l.RecordRequest(httptest.NewRequest(http.MethodGet, "/", nil), Event{Type: EventTypeUserAdd})
+}
+
+func TestMigrateLegacyLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLogger(dir)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	l.LogServerStart("fingerprint")
+	l.Close()
+
+	// Recreate the table as it was before actor_xpub existed.
+	db, err := sql.Open("sqlite3", filepath.Join(dir, AuditDBFile))
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	if _, err := db.Exec(`DROP INDEX idx_audit_actor_xpub; ALTER TABLE audit_log DROP COLUMN actor_xpub`); err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+	db.Close()
+
+	l, err = NewLogger(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen legacy log: %v", err)
+	}
+	defer l.Close()
+	if err := l.Record(Event{Type: EventTypeUserRemove, ActorXPub: "xpub-admin", Description: "User removed"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if valid, err := l.VerifyChain(); !valid || err != nil {
+		t.Fatalf("Migrated chain should verify: %v", err)
+	}
+}
+
+func TestAPIHandler(t *testing.T) {
+	l, err := NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer l.Close()
+	for _, xpub := range []string{"xpub-a", "xpub-b", "xpub-a"} {
+		l.Record(Event{Type: EventTypeFrontendWrite, ActorXPub: xpub, Description: "write"})
+	}
+
+	mux := http.NewServeMux()
+	NewAPIHandler(l).RegisterRoutes(mux)
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	var page struct {
+		Entries []Entry `json:"entries"`
+	}
+	rec := get("/api/admin/audit?actor=xpub-a")
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || len(page.Entries) != 2 {
+		t.Fatalf("Query returned %d entries, %v", len(page.Entries), err)
+	}
+	if rec := get("/api/admin/audit?limit=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid limit status = %d, want 400", rec.Code)
+	}
+
+	var exported []Entry
+	if err := json.NewDecoder(get("/api/admin/audit/export").Body).Decode(&exported); err != nil || len(exported) != 3 {
+		t.Fatalf("Export returned %d entries, %v", len(exported), err)
+	}
+	if exported[0].PreviousHash != GenesisHash {
+		t.Error("Export should start from the genesis entry")
+	}
+
+	var verify struct {
+		Valid   bool  `json:"valid"`
+		Entries int64 `json:"entries"`
+	}
+	if err := json.NewDecoder(get("/api/admin/audit/verify").Body).Decode(&verify); err != nil || !verify.Valid || verify.Entries != 3 {
+		t.Fatalf("Verify = %+v, %v", verify, err)
+	}
+}
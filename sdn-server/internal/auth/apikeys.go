@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+const (
+	// APIKeyPrefix starts every API key, so keys are recognisable in
+	// Authorization headers and secret scanners.
+	APIKeyPrefix = "sdn_"
+
+	apiKeyIDLength     = 8
+	apiKeySecretLength = 32
+
+	// DefaultAPIKeyTTL is used when a key is created without an expiry.
+	DefaultAPIKeyTTL = 90 * 24 * time.Hour
+	// MaxAPIKeyTTL is the longest lifetime a key may have.
+	MaxAPIKeyTTL = 365 * 24 * time.Hour
+)
+
+// API key errors
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyInvalid  = errors.New("invalid api key")
+	ErrAPIKeyScope    = errors.New("api key not scoped for this endpoint")
+)
+
+// APIKey describes a machine credential issued by a user. The secret itself
+// is only returned when the key is created or rotated; the store keeps its
+// hash.
+type APIKey struct {
+	ID         string           `json:"id"`
+	XPub       string           `json:"xpub"`
+	Name       string           `json:"name,omitempty"`
+	TrustLevel peers.TrustLevel `json:"trust_level"`
+	Schemas    []string         `json:"schemas,omitempty"`
+	Endpoints  []string         `json:"endpoints,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	RotatedAt  *time.Time       `json:"rotated_at,omitempty"`
+	ExpiresAt  time.Time        `json:"expires_at"`
+	LastUsedAt *time.Time       `json:"last_used_at,omitempty"`
+	Revoked    bool             `json:"revoked"`
+}
+
+// AllowsEndpoint reports whether the key may call path. Keys without
+// endpoint scopes may call any endpoint their trust level allows.
+func (k *APIKey) AllowsEndpoint(path string) bool {
+	if len(k.Endpoints) == 0 {
+		return true
+	}
+	for _, prefix := range k.Endpoints {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore manages API keys in the auth database, next to SessionStore.
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+// NewAPIKeyStore creates an API key store using the provided database connection.
+func NewAPIKeyStore(db *sql.DB) (*APIKeyStore, error) {
+	ks := &APIKeyStore{db: db}
+	if err := ks.initDB(); err != nil {
+		return nil, fmt.Errorf("failed to initialize api key store: %w", err)
+	}
+	return ks, nil
+}
+
+func (ks *APIKeyStore) initDB() error {
+	_, err := ks.db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			key_hash TEXT NOT NULL UNIQUE,
+			xpub TEXT NOT NULL,
+			name TEXT,
+			trust_level INTEGER NOT NULL,
+			schemas TEXT,
+			endpoints TEXT,
+			created_at INTEGER NOT NULL,
+			rotated_at INTEGER,
+			expires_at INTEGER NOT NULL,
+			last_used_at INTEGER,
+			revoked INTEGER DEFAULT 0
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = ks.db.Exec(`CREATE INDEX IF NOT EXISTS idx_api_keys_xpub ON api_keys(xpub)`)
+	return err
+}
+
+// newAPIKeySecret returns a key of the form sdn_<id>_<secret>.
+func newAPIKeySecret(id string) (string, error) {
+	secret := make([]byte, apiKeySecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return APIKeyPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// CreateKey issues a key for xpub and returns the key string, which is not
+// stored and cannot be recovered.
+func (ks *APIKeyStore) CreateKey(xpub, name string, trust peers.TrustLevel, schemas, endpoints []string, ttl time.Duration) (string, *APIKey, error) {
+	if ttl <= 0 || ttl > MaxAPIKeyTTL {
+		return "", nil, fmt.Errorf("%w: lifetime must be between 0 and %s", ErrAPIKeyInvalid, MaxAPIKeyTTL)
+	}
+	idBytes := make([]byte, apiKeyIDLength)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+	token, err := newAPIKeySecret(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	key := &APIKey{
+		ID:         id,
+		XPub:       xpub,
+		Name:       name,
+		TrustLevel: trust,
+		Schemas:    schemas,
+		Endpoints:  endpoints,
+		CreatedAt:  time.Unix(now.Unix(), 0),
+		ExpiresAt:  time.Unix(now.Add(ttl).Unix(), 0),
+	}
+	schemasJSON, _ := json.Marshal(schemas)
+	endpointsJSON, _ := json.Marshal(endpoints)
+	_, err = ks.db.Exec(
+		"INSERT INTO api_keys (id, key_hash, xpub, name, trust_level, schemas, endpoints, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, hashToken(token), xpub, name, int(trust), string(schemasJSON), string(endpointsJSON), key.CreatedAt.Unix(), key.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+	return token, key, nil
+}
+
+const apiKeyColumns = "id, xpub, name, trust_level, schemas, endpoints, created_at, rotated_at, expires_at, last_used_at, revoked"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var name, schemasJSON, endpointsJSON sql.NullString
+	var trust, revoked int
+	var createdAt, expiresAt int64
+	var rotatedAt, lastUsedAt sql.NullInt64
+	if err := row.Scan(&k.ID, &k.XPub, &name, &trust, &schemasJSON, &endpointsJSON,
+		&createdAt, &rotatedAt, &expiresAt, &lastUsedAt, &revoked); err != nil {
+		return nil, err
+	}
+	k.Name = name.String
+	k.TrustLevel = peers.TrustLevel(trust)
+	k.Revoked = revoked != 0
+	k.CreatedAt = time.Unix(createdAt, 0)
+	k.ExpiresAt = time.Unix(expiresAt, 0)
+	if rotatedAt.Valid {
+		t := time.Unix(rotatedAt.Int64, 0)
+		k.RotatedAt = &t
+	}
+	if lastUsedAt.Valid {
+		t := time.Unix(lastUsedAt.Int64, 0)
+		k.LastUsedAt = &t
+	}
+	_ = json.Unmarshal([]byte(schemasJSON.String), &k.Schemas)
+	_ = json.Unmarshal([]byte(endpointsJSON.String), &k.Endpoints)
+	return &k, nil
+}
+
+// ValidateKey checks that token is a live key and records its use.
+func (ks *APIKeyStore) ValidateKey(token string) (*APIKey, error) {
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := scanAPIKey(ks.db.QueryRow(
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hashToken(token),
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if key.Revoked {
+		return nil, fmt.Errorf("api key revoked")
+	}
+	now := time.Now()
+	if now.After(key.ExpiresAt) {
+		return nil, fmt.Errorf("api key expired")
+	}
+
+	_, _ = ks.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now.Unix(), key.ID)
+	return key, nil
+}
+
+// GetKey returns a key by ID.
+func (ks *APIKeyStore) GetKey(id string) (*APIKey, error) {
+	key, err := scanAPIKey(ks.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// ListKeys returns the keys issued by xpub, or all keys when xpub is empty.
+func (ks *APIKeyStore) ListKeys(xpub string) ([]APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys"
+	var args []interface{}
+	if xpub != "" {
+		query += " WHERE xpub = ?"
+		args = append(args, xpub)
+	}
+	rows, err := ks.db.Query(query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RotateKey replaces a key's secret, keeping its scopes and expiry. The old
+// secret stops working immediately.
+func (ks *APIKeyStore) RotateKey(id string) (string, *APIKey, error) {
+	key, err := ks.GetKey(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if key.Revoked || time.Now().After(key.ExpiresAt) {
+		return "", nil, fmt.Errorf("%w: key is revoked or expired", ErrAPIKeyInvalid)
+	}
+	token, err := newAPIKeySecret(id)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Unix(time.Now().Unix(), 0)
+	if _, err := ks.db.Exec("UPDATE api_keys SET key_hash = ?, rotated_at = ? WHERE id = ?", hashToken(token), now.Unix(), id); err != nil {
+		return "", nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	key.RotatedAt = &now
+	return token, key, nil
+}
+
+// RevokeKey invalidates a key.
+func (ks *APIKeyStore) RevokeKey(id string) error {
+	result, err := ks.db.Exec("UPDATE api_keys SET revoked = 1 WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUser invalidates all keys issued by an xpub.
+func (ks *APIKeyStore) RevokeAllForUser(xpub string) error {
+	_, err := ks.db.Exec("UPDATE api_keys SET revoked = 1 WHERE xpub = ?", xpub)
+	return err
+}
+
+// Cleanup removes keys that expired more than a week ago, keeping recent
+// ones visible in listings.
+func (ks *APIKeyStore) Cleanup() (int64, error) {
+	result, err := ks.db.Exec("DELETE FROM api_keys WHERE expires_at < ?", time.Now().Add(-7*24*time.Hour).Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+type createAPIKeyRequest struct {
+	Name       string    `json:"name"`
+	TrustLevel string    `json:"trust_level,omitempty"`
+	Schemas    []string  `json:"schemas,omitempty"`
+	Endpoints  []string  `json:"endpoints,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+}
+
+// apiKeyResponse returns a key's secret alongside its metadata. It is only
+// sent when a key is created or rotated.
+type apiKeyResponse struct {
+	Key string `json:"key"`
+	*APIKey
+}
+
+// apiKeyFromRequest returns the API key from an "Authorization: Bearer"
+// header, if the request carries one.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// sessionFromAPIKey builds a session for an API key. The key's trust level is
+// capped at its owner's current trust, so demoting or removing a user also
+// limits or disables their keys.
+func (h *Handler) sessionFromAPIKey(r *http.Request, token string) (*Session, error) {
+	if h.apiKeys == nil {
+		return nil, fmt.Errorf("api keys not enabled")
+	}
+	key, err := h.apiKeys.ValidateKey(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.userStore.GetUser(key.XPub)
+	if err != nil || user == nil {
+		return nil, fmt.Errorf("api key owner no longer exists")
+	}
+	if !key.AllowsEndpoint(r.URL.Path) {
+		return nil, ErrAPIKeyScope
+	}
+
+	trust := key.TrustLevel
+	if user.TrustLevel < trust {
+		trust = user.TrustLevel
+	}
+	return &Session{
+		XPub:       key.XPub,
+		TrustLevel: trust,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		IPAddress:  clientIPForRequest(r),
+		UserAgent:  r.UserAgent(),
+		APIKeyID:   key.ID,
+		Schemas:    key.Schemas,
+	}, nil
+}
+
+// apiKeyManager returns the wallet session allowed to manage API keys, or
+// writes an error. Keys cannot be managed with an API key, so a leaked key
+// cannot mint or extend others.
+func (h *Handler) apiKeyManager(w http.ResponseWriter, r *http.Request) *Session {
+	if h.apiKeys == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Code: "not_enabled", Message: "api keys are not enabled"})
+		return nil
+	}
+	session, err := h.walletSessionFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Code: "unauthorized", Message: "wallet login required to manage api keys"})
+		return nil
+	}
+	return session
+}
+
+func (h *Handler) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	session := h.apiKeyManager(w, r)
+	if session == nil {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// Admins may list every key, or filter by owner.
+		owner := session.XPub
+		if session.TrustLevel >= peers.Admin {
+			owner = r.URL.Query().Get("xpub")
+		}
+		keys, err := h.apiKeys.ListKeys(owner)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "server_error", Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, keys)
+
+	case http.MethodPost:
+		var req createAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_request", Message: "invalid JSON body"})
+			return
+		}
+		trust := session.TrustLevel
+		if req.TrustLevel != "" {
+			parsed, err := peers.ParseTrustLevel(req.TrustLevel)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_trust_level", Message: err.Error()})
+				return
+			}
+			if parsed > session.TrustLevel {
+				writeJSON(w, http.StatusForbidden, errorResponse{Code: "forbidden", Message: "api key trust level cannot exceed your own"})
+				return
+			}
+			trust = parsed
+		}
+		for _, endpoint := range req.Endpoints {
+			if !strings.HasPrefix(endpoint, "/") {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_request", Message: fmt.Sprintf("endpoint scope %q must be a path starting with /", endpoint)})
+				return
+			}
+		}
+		for _, schema := range req.Schemas {
+			if strings.TrimSpace(schema) == "" {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_request", Message: "schema scopes must not be empty"})
+				return
+			}
+		}
+		ttl := DefaultAPIKeyTTL
+		if !req.ExpiresAt.IsZero() {
+			ttl = time.Until(req.ExpiresAt)
+		}
+
+		token, key, err := h.apiKeys.CreateKey(session.XPub, req.Name, trust, req.Schemas, req.Endpoints, ttl)
+		if errors.Is(err, ErrAPIKeyInvalid) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_request", Message: err.Error()})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "server_error", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeAPIKeyCreate, ActorXPub: session.XPub,
+			TargetType: "api_key", TargetID: key.ID,
+			Description: fmt.Sprintf("API key %q created with %s trust until %s", key.Name, key.TrustLevel, key.ExpiresAt.Format(time.RFC3339)),
+			After:       key,
+		})
+		writeJSON(w, http.StatusCreated, apiKeyResponse{Key: token, APIKey: key})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIKeyByID handles GET and DELETE /api/auth/keys/{id} and
+// POST /api/auth/keys/{id}/rotate.
+func (h *Handler) handleAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	session := h.apiKeyManager(w, r)
+	if session == nil {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/auth/keys/")
+	rotate := strings.HasSuffix(id, "/rotate")
+	id = strings.TrimSuffix(id, "/rotate")
+	if id == "" || strings.Contains(id, "/") {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_request", Message: "key id required in path"})
+		return
+	}
+
+	key, err := h.apiKeys.GetKey(id)
+	// Report other users' keys as missing rather than forbidden.
+	if errors.Is(err, ErrAPIKeyNotFound) || (err == nil && key.XPub != session.XPub && session.TrustLevel < peers.Admin) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Code: "not_found", Message: "api key not found"})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "server_error", Message: err.Error()})
+		return
+	}
+
+	switch {
+	case rotate && r.Method == http.MethodPost:
+		token, rotated, err := h.apiKeys.RotateKey(id)
+		if errors.Is(err, ErrAPIKeyInvalid) {
+			writeJSON(w, http.StatusConflict, errorResponse{Code: "rotate_failed", Message: err.Error()})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "server_error", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeAPIKeyRotate, ActorXPub: session.XPub,
+			TargetType: "api_key", TargetID: id,
+			Description: fmt.Sprintf("API key %q rotated", key.Name),
+		})
+		writeJSON(w, http.StatusOK, apiKeyResponse{Key: token, APIKey: rotated})
+
+	case !rotate && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, key)
+
+	case !rotate && r.Method == http.MethodDelete:
+		if err := h.apiKeys.RevokeKey(id); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "server_error", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeAPIKeyRevoke, Severity: audit.SeverityWarning, ActorXPub: session.XPub,
+			TargetType: "api_key", TargetID: id,
+			Description: fmt.Sprintf("API key %q revoked", key.Name),
+			Before:      key,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+// newAPIKeyTestHandler returns a handler with API keys enabled and a wallet
+// session cookie for a Standard user.
+func newAPIKeyTestHandler(t *testing.T) (*Handler, *http.Cookie) {
+	t.Helper()
+	dir := t.TempDir()
+	userStore, err := NewUserStore(filepath.Join(dir, "users.db"), []config.UserEntry{
+		{XPub: "xpub-test-operator", TrustLevel: "standard", Name: "Operator"},
+	})
+	if err != nil {
+		t.Fatalf("NewUserStore: %v", err)
+	}
+	t.Cleanup(func() { userStore.Close() })
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "auth.db"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sessions, err := NewSessionStore(db)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	keys, err := NewAPIKeyStore(db)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStore: %v", err)
+	}
+
+	h := NewHandler(userStore, sessions, 24*time.Hour, "", "")
+	h.SetAPIKeyStore(keys)
+
+	token, err := sessions.CreateSession("xpub-test-operator", peers.Standard, "127.0.0.1", "test", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return h, &http.Cookie{Name: "sdn_wallet_session", Value: token}
+}
+
+func createTestAPIKey(t *testing.T, h *Handler, cookie *http.Cookie, req map[string]any) apiKeyResponse {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/keys", bytes.NewReader(body))
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	h.handleAPIKeys(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key status: got %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var resp apiKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal key: %v", err)
+	}
+	return resp
+}
+
+// callWithKey runs a RequireAuth-protected request authenticated by key and
+// returns the status and the session the handler saw.
+func callWithKey(h *Handler, minTrust peers.TrustLevel, path, key string) (int, *Session) {
+	var seen *Session
+	handler := h.RequireAuth(minTrust, func(w http.ResponseWriter, r *http.Request) {
+		seen = SessionFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	return rec.Code, seen
+}
+
+func TestAPIKey_ScopesAndTrust(t *testing.T) {
+	t.Parallel()
+	h, cookie := newAPIKeyTestHandler(t)
+
+	// A key may not exceed its issuer's trust.
+	body, _ := json.Marshal(map[string]any{"name": "too-strong", "trust_level": "admin"})
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/keys", bytes.NewReader(body))
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	h.handleAPIKeys(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("admin key from standard user: got %d want %d", rec.Code, http.StatusForbidden)
+	}
+
+	created := createTestAPIKey(t, h, cookie, map[string]any{
+		"name":        "ingest-bot",
+		"trust_level": "limited",
+		"schemas":     []string{"OMM"},
+		"endpoints":   []string{"/api/v1/data/publish/"},
+	})
+	if created.Key == "" || created.TrustLevel != peers.Limited {
+		t.Fatalf("unexpected created key: %+v", created)
+	}
+	if got := created.ExpiresAt.Sub(created.CreatedAt); got != DefaultAPIKeyTTL {
+		t.Errorf("default lifetime: got %s want %s", got, DefaultAPIKeyTTL)
+	}
+
+	code, session := callWithKey(h, peers.Limited, "/api/v1/data/publish/OMM", created.Key)
+	if code != http.StatusNoContent {
+		t.Fatalf("scoped call: got %d want %d", code, http.StatusNoContent)
+	}
+	if session.XPub != "xpub-test-operator" || session.APIKeyID != created.ID {
+		t.Errorf("unexpected session: %+v", session)
+	}
+	if !session.AllowsSchema("OMM") || session.AllowsSchema("CAT") {
+		t.Errorf("schema scope not applied: %v", session.Schemas)
+	}
+
+	if code, _ := callWithKey(h, peers.Limited, "/api/peers", created.Key); code != http.StatusForbidden {
+		t.Errorf("out-of-scope endpoint: got %d want %d", code, http.StatusForbidden)
+	}
+	if code, _ := callWithKey(h, peers.Standard, "/api/v1/data/publish/OMM", created.Key); code != http.StatusForbidden {
+		t.Errorf("insufficient trust: got %d want %d", code, http.StatusForbidden)
+	}
+	if code, _ := callWithKey(h, peers.Limited, "/api/v1/data/publish/OMM", created.Key+"x"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: got %d want %d", code, http.StatusUnauthorized)
+	}
+
+	// Keys are stored hashed.
+	var stored string
+	if err := h.apiKeys.db.QueryRow("SELECT key_hash FROM api_keys WHERE id = ?", created.ID).Scan(&stored); err != nil {
+		t.Fatalf("read key hash: %v", err)
+	}
+	if stored != hashToken(created.Key) {
+		t.Errorf("expected the stored key to be its hash")
+	}
+}
+
+func TestAPIKey_RotateAndRevoke(t *testing.T) {
+	t.Parallel()
+	h, cookie := newAPIKeyTestHandler(t)
+	created := createTestAPIKey(t, h, cookie, map[string]any{"name": "sync"})
+
+	// An API key cannot manage keys.
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/keys", nil)
+	r.Header.Set("Authorization", "Bearer "+created.Key)
+	rec := httptest.NewRecorder()
+	h.handleAPIKeys(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("list with api key: got %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/auth/keys/"+created.ID+"/rotate", nil)
+	r.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	h.handleAPIKeyByID(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate status: got %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var rotated apiKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rotated); err != nil {
+		t.Fatalf("unmarshal rotated key: %v", err)
+	}
+	if rotated.ID != created.ID || rotated.Key == created.Key {
+		t.Fatalf("rotation should keep the id and change the secret: %+v", rotated)
+	}
+	if code, _ := callWithKey(h, peers.Limited, "/api/v1/data/query", created.Key); code != http.StatusUnauthorized {
+		t.Errorf("old secret after rotation: got %d want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := callWithKey(h, peers.Standard, "/api/v1/data/query", rotated.Key); code != http.StatusNoContent {
+		t.Errorf("new secret after rotation: got %d want %d", code, http.StatusNoContent)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/api/auth/keys/"+created.ID, nil)
+	r.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	h.handleAPIKeyByID(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke status: got %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if code, _ := callWithKey(h, peers.Limited, "/api/v1/data/query", rotated.Key); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got %d want %d", code, http.StatusUnauthorized)
+	}
+
+	keys, err := h.apiKeys.ListKeys("xpub-test-operator")
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if len(keys) != 1 || !keys[0].Revoked || keys[0].LastUsedAt == nil {
+		t.Errorf("unexpected key listing: %+v", keys)
+	}
+}
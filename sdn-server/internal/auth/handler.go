@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/epm"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
 )
@@ -34,6 +35,7 @@ const (
 type Handler struct {
 	userStore    *UserStore
 	sessions     *SessionStore
+	apiKeys      *APIKeyStore
 	challenges   map[string]pendingChallenge
 	mu           sync.Mutex
 	challengeTTL time.Duration
@@ -45,6 +47,7 @@ type Handler struct {
 	attestMu    sync.RWMutex
 	rateMu       sync.Mutex
 	rates        map[string]rateEntry
+	audit        *audit.Logger
 }
 
 type pendingChallenge struct {
@@ -115,6 +118,17 @@ func NewHandler(userStore *UserStore, sessions *SessionStore, sessionTTL time.Du
 	}
 }
 
+// SetAuditLogger records user management changes to logger.
+func (h *Handler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
+// SetAPIKeyStore enables API key authentication and the key management
+// endpoints.
+func (h *Handler) SetAPIKeyStore(keys *APIKeyStore) {
+	h.apiKeys = keys
+}
+
 // SetNodeSigningAttestation injects an identity-attestation chain for key binding.
 // The attestation ties a Bitcoin-derived xpub to an Ed25519 signing public key.
 func (h *Handler) SetNodeSigningAttestation(attestation *epm.IdentityAttestation) {
@@ -145,6 +159,8 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/auth/status", h.handleAuthStatus)
 	mux.HandleFunc("/api/auth/users", h.handleUsers)
 	mux.HandleFunc("/api/auth/users/", h.handleUserByXPub)
+	mux.HandleFunc("/api/auth/keys", h.handleAPIKeys)
+	mux.HandleFunc("/api/auth/keys/", h.handleAPIKeyByID)
 	mux.HandleFunc("/login", h.handleLoginPage)
 }
 
@@ -536,6 +552,13 @@ func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		after, _ := h.userStore.GetUser(req.XPub)
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeUserAdd, ActorXPub: session.XPub,
+			TargetType: "user", TargetID: req.XPub,
+			Description: fmt.Sprintf("User added with %s trust", trust),
+			After:       after,
+		})
 		writeJSON(w, http.StatusCreated, map[string]string{"status": "created"})
 
 	default:
@@ -572,10 +595,22 @@ func (h *Handler) handleUserByXPub(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, user)
 
 	case http.MethodDelete:
+		before, _ := h.userStore.GetUser(xpub)
 		if err := h.userStore.RemoveUser(xpub); err != nil {
 			writeJSON(w, http.StatusBadRequest, errorResponse{Code: "remove_failed", Message: err.Error()})
 			return
 		}
+		if h.apiKeys != nil {
+			if err := h.apiKeys.RevokeAllForUser(xpub); err != nil {
+				log.Warnf("Failed to revoke api keys of removed user %s: %v", xpub, err)
+			}
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeUserRemove, Severity: audit.SeverityWarning, ActorXPub: session.XPub,
+			TargetType: "user", TargetID: xpub,
+			Description: "User removed",
+			Before:      before,
+		})
 		writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
 
 	case http.MethodPut:
@@ -589,6 +624,7 @@ func (h *Handler) handleUserByXPub(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, errorResponse{Code: "invalid_trust_level", Message: err.Error()})
 			return
 		}
+		before, _ := h.userStore.GetUser(xpub)
 		if err := h.userStore.UpdateTrust(xpub, trust); err != nil {
 			writeJSON(w, http.StatusBadRequest, errorResponse{Code: "update_failed", Message: err.Error()})
 			return
@@ -599,6 +635,14 @@ func (h *Handler) handleUserByXPub(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
+		after, _ := h.userStore.GetUser(xpub)
+		h.audit.RecordRequest(r, audit.Event{
+			Type: audit.EventTypeUserUpdate, ActorXPub: session.XPub,
+			TargetType: "user", TargetID: xpub,
+			Description: fmt.Sprintf("User updated to %s trust", trust),
+			Before:      before,
+			After:       after,
+		})
 		writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 
 	default:
@@ -606,8 +650,17 @@ func (h *Handler) handleUserByXPub(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// sessionFromRequest extracts and validates the session from a request cookie.
+// sessionFromRequest extracts and validates the session from an API key in
+// the Authorization header, or else from the session cookie.
 func (h *Handler) sessionFromRequest(r *http.Request) (*Session, error) {
+	if token, ok := apiKeyFromRequest(r); ok {
+		return h.sessionFromAPIKey(r, token)
+	}
+	return h.walletSessionFromRequest(r)
+}
+
+// walletSessionFromRequest extracts and validates the session from a request cookie.
+func (h *Handler) walletSessionFromRequest(r *http.Request) (*Session, error) {
 	cookie, err := r.Cookie("sdn_wallet_session")
 	if err != nil {
 		return nil, fmt.Errorf("no session cookie")
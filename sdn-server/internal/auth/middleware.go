@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
 )
 
@@ -13,10 +15,15 @@ type contextKey string
 const sessionContextKey contextKey = "auth_session"
 
 // RequireAuth wraps an http.HandlerFunc to require a valid session with minimum trust level.
+// The session comes from the wallet cookie or an "Authorization: Bearer" API key.
 // Redirects to /login for browser requests, returns 401 JSON for API requests.
 func (h *Handler) RequireAuth(minTrust peers.TrustLevel, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, err := h.sessionFromRequest(r)
+		if errors.Is(err, ErrAPIKeyScope) {
+			writeJSON(w, http.StatusForbidden, errorResponse{Code: "forbidden", Message: err.Error()})
+			return
+		}
 		if err != nil {
 			if wantsJSON(r) {
 				writeJSON(w, http.StatusUnauthorized, errorResponse{Code: "unauthorized", Message: "not authenticated"})
@@ -35,8 +42,9 @@ func (h *Handler) RequireAuth(minTrust peers.TrustLevel, next http.HandlerFunc)
 			return
 		}
 
-		// Store session in request context
+		// Store session in request context, and the caller for audit events
 		ctx := context.WithValue(r.Context(), sessionContextKey, session)
+		ctx = audit.WithActor(ctx, session.XPub)
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -47,6 +55,7 @@ func (h *Handler) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
 		session, err := h.sessionFromRequest(r)
 		if err == nil && session != nil {
 			ctx := context.WithValue(r.Context(), sessionContextKey, session)
+			ctx = audit.WithActor(ctx, session.XPub)
 			r = r.WithContext(ctx)
 		}
 		next(w, r)
@@ -28,6 +28,25 @@ type Session struct {
 	ExpiresAt  time.Time        `json:"expires_at"`
 	IPAddress  string           `json:"ip_address,omitempty"`
 	UserAgent  string           `json:"user_agent,omitempty"`
+
+	// APIKeyID and Schemas are set when the session comes from an API key
+	// rather than a wallet login.
+	APIKeyID string   `json:"api_key_id,omitempty"`
+	Schemas  []string `json:"schemas,omitempty"`
+}
+
+// AllowsSchema reports whether the session may act on schema. Wallet
+// sessions and API keys without schema scopes allow every schema.
+func (s *Session) AllowsSchema(schema string) bool {
+	if len(s.Schemas) == 0 {
+		return true
+	}
+	for _, allowed := range s.Schemas {
+		if allowed == schema {
+			return true
+		}
+	}
+	return false
 }
 
 // SessionStore manages authentication sessions in SQLite.
@@ -22,6 +22,34 @@ type Config struct {
 	Users      []UserEntry      `yaml:"users"`
 	Blockchain BlockchainConfig `yaml:"blockchain"`
 	Publishing PublishingConfig `yaml:"publishing"`
+	Storefront StorefrontConfig `yaml:"storefront"`
+	WASI       WASIConfig       `yaml:"wasi"`
+}
+
+// WASIConfig embeds the sdn-wasi module in the daemon as a sandboxed stage
+// that validates and stores messages from the schema topics.
+type WASIConfig struct {
+	// Enabled runs the module inside the daemon. Default: false.
+	Enabled bool `yaml:"enabled"`
+
+	// ModulePath is the sdn-wasi.wasm library build (TinyGo, with exports).
+	ModulePath string `yaml:"module_path"`
+
+	// Schemas the module subscribes to. Empty = all schemas the node serves.
+	Schemas []string `yaml:"schemas"`
+
+	// MemoryLimitMB caps the module's linear memory (default: 32).
+	MemoryLimitMB int `yaml:"memory_limit_mb"`
+}
+
+// StorefrontConfig holds marketplace settings for this node.
+type StorefrontConfig struct {
+	// PlatformFeeBasisPoints is the share of every credits sale and usage
+	// invoice kept by this node's operator (100 = 1%). Default: 0.
+	PlatformFeeBasisPoints uint32 `yaml:"platform_fee_bps"`
+
+	// PlatformFeePeerID receives the platform fee. Empty = this node's peer ID.
+	PlatformFeePeerID string `yaml:"platform_fee_peer_id"`
 }
 
 // PublishingConfig controls remote data publishing via the API.
@@ -47,6 +75,14 @@ type BlockchainConfig struct {
 	Ethereum ChainRPCConfig `yaml:"ethereum"`
 	Solana   ChainRPCConfig `yaml:"solana"`
 	Bitcoin  ChainRPCConfig `yaml:"bitcoin"`
+
+	// WatchDeposits enables polling of per-purchase deposit addresses so
+	// crypto purchases priced in the chain's native coin complete without the
+	// buyer submitting a tx hash.
+	WatchDeposits bool `yaml:"watch_deposits"`
+
+	// DepositPollInterval is how often deposit addresses are checked (default: "30s").
+	DepositPollInterval string `yaml:"deposit_poll_interval"`
 }
 
 // ChainRPCConfig holds per-chain RPC endpoint and confirmation threshold.
@@ -163,6 +199,87 @@ type PeersConfig struct {
 
 	// TrustBasedRateLimiting adjusts rate limits based on peer trust level.
 	TrustBasedRateLimiting bool `yaml:"trust_based_rate_limiting"`
+
+	// Reputation configures automatic scoring and demotion of misbehaving peers.
+	Reputation ReputationConfig `yaml:"reputation"`
+
+	// WebOfTrust configures trust derived from peer endorsements.
+	WebOfTrust WebOfTrustConfig `yaml:"web_of_trust"`
+
+	// AddressFilter restricts which networks the node connects to or accepts.
+	AddressFilter AddressFilterConfig `yaml:"address_filter"`
+}
+
+// AddressFilterConfig contains CIDR and ASN connection filtering settings.
+type AddressFilterConfig struct {
+	// Allow, when non-empty, limits connections to these ranges.
+	Allow []AddressRangeConfig `yaml:"allow"`
+
+	// Deny rejects connections from these ranges, even if allowed.
+	Deny []AddressRangeConfig `yaml:"deny"`
+
+	// Limit caps concurrent connections from these ranges.
+	Limit []AddressRangeConfig `yaml:"limit"`
+
+	// ASNDatabase is an IP-to-ASN database file (iptoasn.com TSV or
+	// "cidr,asn" lines), required by ASN rules.
+	ASNDatabase string `yaml:"asn_database"`
+}
+
+// AddressRangeConfig is a CIDR block or ASN with an optional connection cap.
+type AddressRangeConfig struct {
+	CIDR           string `yaml:"cidr"`
+	ASN            uint32 `yaml:"asn"`
+	MaxConnections int    `yaml:"max_connections"`
+}
+
+// WebOfTrustConfig contains settings for transitive trust endorsements.
+type WebOfTrustConfig struct {
+	// Enabled exchanges endorsements with peers and derives trust from them.
+	Enabled bool `yaml:"enabled"`
+
+	// MaxPathLength is the longest endorsement chain honored (default: 2).
+	MaxPathLength int `yaml:"max_path_length"`
+
+	// MinEndorsers is how many distinct endorsers a peer needs (default: 1).
+	MinEndorsers int `yaml:"min_endorsers"`
+
+	// HonoredEndorsers lists the peer IDs whose endorsements root the web of
+	// trust. When empty, peers manually set to trusted or admin are honored.
+	HonoredEndorsers []string `yaml:"honored_endorsers"`
+
+	// SyncInterval is how often endorsements are exchanged with connected
+	// peers (default: 10m).
+	SyncInterval string `yaml:"sync_interval"`
+}
+
+// ReputationConfig contains peer reputation scoring settings.
+type ReputationConfig struct {
+	// Enabled turns on reputation scoring and automatic demotion/blocking.
+	Enabled bool `yaml:"enabled"`
+
+	// HalfLife is how long it takes a peer's score to halve (default: 1h).
+	HalfLife string `yaml:"half_life"`
+
+	// DemoteScore is the score at which a peer is demoted to Limited (read-only).
+	DemoteScore float64 `yaml:"demote_score"`
+
+	// DemoteDuration is the minimum time a demotion lasts (default: 1h).
+	DemoteDuration string `yaml:"demote_duration"`
+
+	// BlockScore is the score at which a peer is disconnected and blocked.
+	BlockScore float64 `yaml:"block_score"`
+
+	// BlockDuration is how long an automatic block lasts (default: 15m).
+	BlockDuration string `yaml:"block_duration"`
+
+	// StaleAfter is the record epoch age past which a published record is
+	// reported as stale (default: 168h). Zero disables stale checks.
+	StaleAfter string `yaml:"stale_after"`
+
+	// Penalties overrides the points added per offense: validation_failure,
+	// rate_limited, malformed_frame, duplicate_record, stale_record.
+	Penalties map[string]float64 `yaml:"penalties"`
 }
 
 // AdminConfig contains admin interface settings.
@@ -294,6 +411,22 @@ func Default() *Config {
 			EnableDHT:              true,
 			EnableMDNS:             true,
 			TrustBasedRateLimiting: true,
+			Reputation: ReputationConfig{
+				Enabled:        true,
+				HalfLife:       "1h",
+				DemoteScore:    50,
+				DemoteDuration: "1h",
+				BlockScore:     100,
+				BlockDuration:  "15m",
+				StaleAfter:     "168h",
+			},
+			WebOfTrust: WebOfTrustConfig{
+				Enabled:          true,
+				MaxPathLength:    2,
+				MinEndorsers:     1,
+				HonoredEndorsers: []string{},
+				SyncInterval:     "10m",
+			},
 		},
 		Admin: AdminConfig{
 			Enabled:       true,
@@ -319,6 +452,9 @@ func Default() *Config {
 			Ethereum: ChainRPCConfig{RequiredConfirmations: 12},
 			Solana:   ChainRPCConfig{RequiredConfirmations: 1},
 			Bitcoin:  ChainRPCConfig{RequiredConfirmations: 6},
+
+			WatchDeposits:       true,
+			DepositPollInterval: "30s",
 		},
 		Publishing: PublishingConfig{
 			Enabled:           true,
@@ -327,6 +463,11 @@ func Default() *Config {
 			DefaultQuotaBytes: 100 * 1024 * 1024, // 100MB
 			MinTrustLevel:     "standard",
 		},
+		WASI: WASIConfig{
+			Enabled:       false,
+			Schemas:       []string{},
+			MemoryLimitMB: 32,
+		},
 	}
 }
 
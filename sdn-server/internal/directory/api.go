@@ -0,0 +1,117 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+	// remoteLookupTimeout bounds DHT lookups made for a single request.
+	remoteLookupTimeout = 20 * time.Second
+)
+
+// APIHandler serves directory search and address lookups.
+type APIHandler struct {
+	dir *Directory
+}
+
+// NewAPIHandler creates a handler for the directory endpoints.
+func NewAPIHandler(dir *Directory) *APIHandler {
+	return &APIHandler{dir: dir}
+}
+
+// RegisterRoutes registers the directory endpoints.
+func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/directory", h.handleSearch)
+	mux.HandleFunc("/api/directory/address/", h.handleAddress)
+}
+
+// handleSearch handles GET /api/directory with q, organization, country,
+// chain, address, limit and offset filters.
+func (h *APIHandler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	q := Query{
+		Text:         params.Get("q"),
+		Organization: params.Get("organization"),
+		Country:      params.Get("country"),
+		Chain:        strings.ToLower(params.Get("chain")),
+		Address:      params.Get("address"),
+		Limit:        defaultSearchLimit,
+	}
+	if q.Chain != "" && !knownChain(q.Chain) {
+		http.Error(w, ErrUnknownChain.Error(), http.StatusBadRequest)
+		return
+	}
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("invalid %s parameter", name), http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+	if q.Limit == 0 || q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+
+	entries := h.dir.Search(q)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries, "count": len(entries)})
+}
+
+// handleAddress handles GET /api/directory/address/{address}. chain limits
+// the lookup to one chain; remote=true also asks the DHT.
+func (h *APIHandler) handleAddress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	address := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/directory/address/"))
+	if address == "" || strings.Contains(address, "/") {
+		http.Error(w, "address required", http.StatusBadRequest)
+		return
+	}
+	chain := r.URL.Query().Get("chain")
+	remote, _ := strconv.ParseBool(r.URL.Query().Get("remote"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), remoteLookupTimeout)
+	defer cancel()
+	entries, err := h.dir.LookupAddress(ctx, chain, address, remote)
+	if errors.Is(err, ErrUnknownChain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+
+	peerIDs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		peerIDs = append(peerIDs, e.PeerID)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"address":  address,
+		"chain":    chain,
+		"peer_ids": peerIDs,
+		"entries":  entries,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,394 @@
+// Package directory indexes the EPMs a node has collected (its own and its
+// peers') into a searchable entity directory, with reverse lookups from
+// attested Bitcoin, Ethereum and Solana addresses to peer IDs.
+package directory
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/spacedatanetwork/sdn-server/internal/epm"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+var log = logging.Logger("sdn-directory")
+
+// Chains whose attested addresses are indexed.
+var Chains = []string{"bitcoin", "ethereum", "solana"}
+
+// addressCIDNamespace prefixes the DHT keys under which nodes announce the
+// chain addresses their EPM attests.
+const addressCIDNamespace = "sdn-directory-address/v1:"
+
+// ErrUnknownChain is returned for a chain other than those in Chains.
+var ErrUnknownChain = errors.New("unknown chain")
+
+// Entry is one entity in the directory.
+type Entry struct {
+	PeerID     string `json:"peer_id"`
+	Self       bool   `json:"self,omitempty"`
+	TrustLevel string `json:"trust_level"`
+	// Name is the operator-assigned name from the peer registry.
+	Name string `json:"name,omitempty"`
+	// Organization is the EPM legal name, or the registry organization
+	// when the EPM has none.
+	Organization   string   `json:"organization,omitempty"`
+	DN             string   `json:"dn,omitempty"`
+	LegalName      string   `json:"legal_name,omitempty"`
+	GivenName      string   `json:"given_name,omitempty"`
+	FamilyName     string   `json:"family_name,omitempty"`
+	JobTitle       string   `json:"job_title,omitempty"`
+	Occupation     string   `json:"occupation,omitempty"`
+	Email          string   `json:"email,omitempty"`
+	Telephone      string   `json:"telephone,omitempty"`
+	Country        string   `json:"country,omitempty"`
+	Region         string   `json:"region,omitempty"`
+	Locality       string   `json:"locality,omitempty"`
+	AlternateNames []string `json:"alternate_names,omitempty"`
+	// Addresses maps chain to address, and is only set when the EPM's
+	// identity attestation verifies against the peer ID.
+	Addresses map[string]string `json:"addresses,omitempty"`
+	Attested  bool              `json:"attested"`
+	EPMCID    string            `json:"epm_cid,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at,omitempty"`
+}
+
+// Query filters a directory search. Empty fields match everything.
+type Query struct {
+	// Text must appear, term by term, somewhere in the entry's fields.
+	Text         string
+	Organization string
+	Country      string
+	// Chain restricts Address to one chain; without it Address matches on
+	// any chain.
+	Chain   string
+	Address string
+	Limit   int
+	Offset  int
+}
+
+// parsedEPM caches the indexed content of one EPM version.
+type parsedEPM struct {
+	entry Entry
+	err   error
+}
+
+// Directory builds entries from the peer registry and the node's own EPM.
+type Directory struct {
+	registry *peers.Registry
+	self     peer.ID
+	selfEPM  func() []byte
+
+	findProviders func(ctx context.Context, c cid.Cid) ([]peer.ID, error)
+	fetchEPM      func(ctx context.Context, id peer.ID) error
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]parsedEPM
+}
+
+// New creates a directory over registry. selfEPM returns the node's own
+// EPM and may be nil.
+func New(registry *peers.Registry, self peer.ID, selfEPM func() []byte) *Directory {
+	return &Directory{
+		registry: registry,
+		self:     self,
+		selfEPM:  selfEPM,
+		cache:    make(map[[sha256.Size]byte]parsedEPM),
+	}
+}
+
+// SetResolver enables network lookups: findProviders finds the peers that
+// announced a key on the DHT, and fetchEPM collects a peer's EPM into the
+// registry.
+func (d *Directory) SetResolver(findProviders func(ctx context.Context, c cid.Cid) ([]peer.ID, error), fetchEPM func(ctx context.Context, id peer.ID) error) {
+	d.findProviders = findProviders
+	d.fetchEPM = fetchEPM
+}
+
+// AddressCID returns the DHT key under which the holder of an attested
+// chain address announces itself.
+func AddressCID(chain, address string) (cid.Cid, error) {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	if !knownChain(chain) {
+		return cid.Undef, ErrUnknownChain
+	}
+	hash := sha256.Sum256([]byte(addressCIDNamespace + chain + ":" + epm.NormalizeChainAddress(address, chain)))
+	multihash, err := mh.Encode(hash[:], mh.SHA2_256)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.Raw, multihash), nil
+}
+
+// SelfAddressCIDs returns the DHT keys for the node's own attested
+// addresses, for announcement with Provide.
+func (d *Directory) SelfAddressCIDs() []cid.Cid {
+	if d.selfEPM == nil {
+		return nil
+	}
+	data := d.selfEPM()
+	if len(data) == 0 {
+		return nil
+	}
+	entry := d.parse(d.self, data)
+	var out []cid.Cid
+	for _, chain := range Chains {
+		if addr := entry.Addresses[chain]; addr != "" {
+			if c, err := AddressCID(chain, addr); err == nil {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// Entries returns every entity with an EPM, the node itself first.
+func (d *Directory) Entries() []Entry {
+	// Superseded EPM versions stay cached until the cache outgrows the
+	// registry; then it is rebuilt from the current versions.
+	d.mu.Lock()
+	if len(d.cache) > 2*d.registry.PeerCount()+64 {
+		d.cache = make(map[[sha256.Size]byte]parsedEPM)
+	}
+	d.mu.Unlock()
+
+	var out []Entry
+	if d.selfEPM != nil {
+		if data := d.selfEPM(); len(data) > 0 {
+			e := d.parse(d.self, data)
+			e.Self = true
+			e.TrustLevel = peers.Admin.String()
+			out = append(out, e)
+		}
+	}
+
+	var others []Entry
+	for _, tp := range d.registry.ListPeers() {
+		if len(tp.EPMData) == 0 || tp.ID == d.self {
+			continue
+		}
+		others = append(others, d.entryForPeer(tp))
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].PeerID < others[j].PeerID })
+	return append(out, others...)
+}
+
+func (d *Directory) entryForPeer(tp *peers.TrustedPeer) Entry {
+	e := d.parse(tp.ID, tp.EPMData)
+	e.TrustLevel = tp.TrustLevel.String()
+	e.Name = tp.Name
+	if e.Organization == "" {
+		e.Organization = tp.Organization
+	}
+	if len(tp.EPMHistory) > 0 {
+		e.EPMCID = tp.EPMHistory[0].CID
+		e.UpdatedAt = tp.EPMHistory[0].ReceivedAt
+	}
+	return e
+}
+
+// parse returns the cached entry for an EPM version, verifying its
+// attestation the first time it is seen.
+func (d *Directory) parse(id peer.ID, data []byte) Entry {
+	key := sha256.Sum256(append([]byte(id), data...))
+	d.mu.Lock()
+	cached, ok := d.cache[key]
+	d.mu.Unlock()
+	if !ok {
+		cached.entry, cached.err = entryFromEPM(data)
+		cached.entry.PeerID = id.String()
+		if cached.err == nil {
+			if att, err := epm.VerifyEPMAttestation(data, id); err == nil {
+				cached.entry.Attested = true
+				cached.entry.Addresses = map[string]string{
+					"bitcoin":  att.BitcoinAddress,
+					"ethereum": att.EthereumAddress,
+					"solana":   att.SolanaAddress,
+				}
+			} else if !errors.Is(err, epm.ErrEPMNoAttestation) {
+				log.Debugf("EPM attestation for %s not indexed: %v", id, err)
+			}
+		}
+		d.mu.Lock()
+		d.cache[key] = cached
+		d.mu.Unlock()
+	}
+	entry := cached.entry
+	entry.AlternateNames = append([]string(nil), entry.AlternateNames...)
+	if entry.Addresses != nil {
+		addrs := make(map[string]string, len(entry.Addresses))
+		for k, v := range entry.Addresses {
+			addrs[k] = v
+		}
+		entry.Addresses = addrs
+	}
+	return entry
+}
+
+// entryFromEPM reads the searchable fields of an EPM.
+func entryFromEPM(data []byte) (Entry, error) {
+	sum, err := epm.Summarize(data)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Organization:   sum.LegalName,
+		DN:             sum.DN,
+		LegalName:      sum.LegalName,
+		GivenName:      sum.GivenName,
+		FamilyName:     sum.FamilyName,
+		JobTitle:       sum.JobTitle,
+		Occupation:     sum.Occupation,
+		Email:          sum.Email,
+		Telephone:      sum.Telephone,
+		Country:        sum.Country,
+		Region:         sum.Region,
+		Locality:       sum.Locality,
+		AlternateNames: sum.AlternateNames,
+	}, nil
+}
+
+// Search returns the entries matching q.
+func (d *Directory) Search(q Query) []Entry {
+	return filterEntries(d.Entries(), q)
+}
+
+// LookupAddress returns the entities whose attested address on chain (or
+// on any chain, if chain is empty) is address. With remote set, peers that
+// announced the address on the DHT are asked for their EPMs first.
+func (d *Directory) LookupAddress(ctx context.Context, chain, address string, remote bool) ([]Entry, error) {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	if chain != "" && !knownChain(chain) {
+		return nil, ErrUnknownChain
+	}
+	q := Query{Chain: chain, Address: address}
+	local := filterEntries(d.Entries(), q)
+	if !remote || d.findProviders == nil || d.fetchEPM == nil {
+		return local, nil
+	}
+
+	known := make(map[string]bool, len(local))
+	for _, e := range local {
+		known[e.PeerID] = true
+	}
+	chains := Chains
+	if chain != "" {
+		chains = []string{chain}
+	}
+	fetched := false
+	for _, c := range chains {
+		key, err := AddressCID(c, address)
+		if err != nil {
+			continue
+		}
+		providers, err := d.findProviders(ctx, key)
+		if err != nil {
+			log.Debugf("Directory lookup of %s on %s failed: %v", address, c, err)
+			continue
+		}
+		for _, id := range providers {
+			if id == d.self || known[id.String()] {
+				continue
+			}
+			known[id.String()] = true
+			// The provider record is only a hint; the fetched EPM's
+			// attestation decides whether the peer holds the address.
+			if err := d.fetchEPM(ctx, id); err != nil {
+				log.Debugf("Directory could not fetch EPM from %s: %v", id, err)
+				continue
+			}
+			fetched = true
+		}
+	}
+	if !fetched {
+		return local, nil
+	}
+	return filterEntries(d.Entries(), q), nil
+}
+
+func filterEntries(entries []Entry, q Query) []Entry {
+	terms := strings.Fields(strings.ToLower(q.Text))
+	chain := strings.ToLower(strings.TrimSpace(q.Chain))
+	out := make([]Entry, 0)
+	for _, e := range entries {
+		if q.Organization != "" && !strings.EqualFold(strings.TrimSpace(e.Organization), strings.TrimSpace(q.Organization)) {
+			continue
+		}
+		if q.Country != "" && !strings.EqualFold(strings.TrimSpace(e.Country), strings.TrimSpace(q.Country)) {
+			continue
+		}
+		if q.Address != "" && !e.hasAddress(chain, q.Address) {
+			continue
+		}
+		if chain != "" && q.Address == "" && e.Addresses[chain] == "" {
+			continue
+		}
+		if !e.matchesText(terms) {
+			continue
+		}
+		out = append(out, e)
+	}
+
+	if q.Offset > 0 {
+		if q.Offset >= len(out) {
+			return []Entry{}
+		}
+		out = out[q.Offset:]
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out
+}
+
+func (e *Entry) hasAddress(chain, address string) bool {
+	for _, c := range Chains {
+		if chain != "" && c != chain {
+			continue
+		}
+		if have := e.Addresses[c]; have != "" && epm.NormalizeChainAddress(have, c) == epm.NormalizeChainAddress(address, c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Entry) matchesText(terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	fields := []string{
+		e.PeerID, e.Name, e.Organization, e.DN, e.LegalName, e.GivenName, e.FamilyName,
+		e.JobTitle, e.Occupation, e.Email, e.Telephone, e.Country, e.Region, e.Locality,
+	}
+	fields = append(fields, e.AlternateNames...)
+	for _, addr := range e.Addresses {
+		fields = append(fields, addr)
+	}
+	haystack := strings.ToLower(strings.Join(fields, "\n"))
+	for _, term := range terms {
+		if !strings.Contains(haystack, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func knownChain(chain string) bool {
+	for _, c := range Chains {
+		if c == chain {
+			return true
+		}
+	}
+	return false
+}
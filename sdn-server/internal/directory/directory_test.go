@@ -0,0 +1,97 @@
+package directory
+
+import (
+	"errors"
+	"testing"
+)
+
+func testEntries() []Entry {
+	return []Entry{
+		{
+			PeerID:       "peer-a",
+			Organization: "Orbital Dynamics Ltd",
+			LegalName:    "Orbital Dynamics Ltd",
+			Email:        "ops@orbital.example",
+			Country:      "GB",
+			Attested:     true,
+			Addresses: map[string]string{
+				"bitcoin":  "bc1qexampleaddressa",
+				"ethereum": "0xAbCdEf0000000000000000000000000000000001",
+				"solana":   "SoLanaAddressA",
+			},
+		},
+		{
+			PeerID:         "peer-b",
+			Organization:   "Tracking Co",
+			JobTitle:       "Flight Dynamics Engineer",
+			Country:        "US",
+			AlternateNames: []string{"TrackCo"},
+		},
+		{
+			PeerID:       "peer-c",
+			Organization: "Orbital Dynamics Ltd",
+			Country:      "us",
+			Attested:     true,
+			Addresses:    map[string]string{"ethereum": "0x1111111111111111111111111111111111111111"},
+		},
+	}
+}
+
+func peerIDs(entries []Entry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PeerID
+	}
+	return ids
+}
+
+func TestFilterEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all", Query{}, []string{"peer-a", "peer-b", "peer-c"}},
+		{"text across fields", Query{Text: "dynamics"}, []string{"peer-a", "peer-b", "peer-c"}},
+		{"every term must match", Query{Text: "flight trackco"}, []string{"peer-b"}},
+		{"organization is exact", Query{Organization: "orbital dynamics ltd"}, []string{"peer-a", "peer-c"}},
+		{"country ignores case", Query{Country: "US"}, []string{"peer-b", "peer-c"}},
+		{"ethereum address ignores case and prefix", Query{Chain: "ethereum", Address: "abcdef0000000000000000000000000000000001"}, []string{"peer-a"}},
+		{"address on any chain", Query{Address: "SoLanaAddressA"}, []string{"peer-a"}},
+		{"address on the wrong chain", Query{Chain: "bitcoin", Address: "SoLanaAddressA"}, []string{}},
+		{"chain alone requires an attested address", Query{Chain: "ethereum"}, []string{"peer-a", "peer-c"}},
+		{"offset and limit", Query{Offset: 1, Limit: 1}, []string{"peer-b"}},
+		{"offset past the end", Query{Offset: 5}, []string{}},
+	}
+	for _, tt := range tests {
+		got := peerIDs(filterEntries(testEntries(), tt.query))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAddressCID(t *testing.T) {
+	a, err := AddressCID("ethereum", "0xAbCdEf0000000000000000000000000000000001")
+	if err != nil {
+		t.Fatalf("AddressCID: %v", err)
+	}
+	b, _ := AddressCID("Ethereum", "abcdef0000000000000000000000000000000001")
+	if !a.Equals(b) {
+		t.Error("Equivalent Ethereum addresses should share a DHT key")
+	}
+	c, _ := AddressCID("bitcoin", "0xAbCdEf0000000000000000000000000000000001")
+	if a.Equals(c) {
+		t.Error("The chain should be part of the DHT key")
+	}
+	if _, err := AddressCID("dogecoin", "D123"); !errors.Is(err, ErrUnknownChain) {
+		t.Errorf("Unknown chain = %v, want ErrUnknownChain", err)
+	}
+}
@@ -3,6 +3,8 @@ package epm
 import (
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -10,9 +12,6 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
-
-	"github.com/spacedatanetwork/sdn-server/internal/peers"
-	"github.com/spacedatanetwork/sdn-server/internal/vcard"
 )
 
 const (
@@ -34,6 +33,9 @@ const (
 
 // RegisterProtocol registers the EPM exchange stream handler on the host.
 func (s *Service) RegisterProtocol(h host.Host) {
+	s.mu.Lock()
+	s.host = h
+	s.mu.Unlock()
 	h.SetStreamHandler(EPMExchangeProtocolID, s.handleStream)
 	log.Infof("Registered EPM exchange protocol: %s", EPMExchangeProtocolID)
 }
@@ -120,69 +122,28 @@ func (s *Service) writeResponse(stream network.Stream, status uint32, data []byt
 }
 
 // RequestPeerEPM opens a stream to a remote peer and requests their EPM.
-// On success, it stores the EPM in the peer registry.
+// The EPM is stored in the peer registry if its identity attestation binds
+// it to target; the stream is target's own, so no announcement signature is
+// needed.
 func (s *Service) RequestPeerEPM(ctx context.Context, h host.Host, target peer.ID) error {
-	streamCtx, cancel := context.WithTimeout(ctx, streamReadDeadline+streamWriteDeadline)
-	defer cancel()
-
-	stream, err := h.NewStream(streamCtx, target, EPMExchangeProtocolID)
-	if err != nil {
-		return err
-	}
-	defer stream.Close()
-
-	// Send request (len=0 means "send me yours")
-	_ = stream.SetWriteDeadline(time.Now().Add(streamWriteDeadline))
-	header := make([]byte, 4)
-	binary.LittleEndian.PutUint32(header, 0)
-	if _, err := stream.Write(header); err != nil {
-		return err
-	}
-
-	// Read response
-	_ = stream.SetReadDeadline(time.Now().Add(streamReadDeadline))
-
-	var respHeader [8]byte
-	if _, err := io.ReadFull(stream, respHeader[:]); err != nil {
-		return err
-	}
-
-	status := binary.LittleEndian.Uint32(respHeader[0:4])
-	dataLen := binary.LittleEndian.Uint32(respHeader[4:8])
-
-	if status != statusOK || dataLen == 0 || dataLen > maxEPMSize {
+	epmData, err := fetchEPMFromPeer(ctx, h, target)
+	if errors.Is(err, errEPMStreamEmptyResult) {
 		return nil // peer doesn't have an EPM or returned error
-	}
-
-	epmData := make([]byte, dataLen)
-	if _, err := io.ReadFull(stream, epmData); err != nil {
+	} else if err != nil {
 		return err
 	}
 
-	// Store in peer registry
-	tp, err := s.registry.GetPeer(target)
+	if _, err := VerifyEPMAttestation(epmData, target); err != nil {
+		return fmt.Errorf("EPM from %s rejected: %w", target, err)
+	}
+	epmCID, err := computeEPMCID(epmData)
 	if err != nil {
-		// Peer not in registry yet — auto-add with Standard trust
-		tp = &peers.TrustedPeer{
-			ID:         target,
-			TrustLevel: peers.Standard,
-		}
-		if addErr := s.registry.AddPeer(tp); addErr != nil {
-			log.Debugf("epm-exchange: failed to add peer %s: %v", target, addErr)
-			return nil
-		}
-		tp, _ = s.registry.GetPeer(target)
+		return err
 	}
-
-	if tp != nil {
-		tp.EPMData = epmData
-		// Generate vCard from EPM
-		if vcardStr, err := vcard.EPMToVCard(epmData); err == nil {
-			tp.VCardData = vcardStr
-		}
-		_ = s.registry.UpdatePeer(tp)
-		log.Infof("epm-exchange: stored EPM for peer %s (%d bytes)", target.ShortString(), len(epmData))
+	if _, err := s.storePeerEPM(target, epmData, epmCID.String(), "stream"); err != nil {
+		log.Debugf("epm-exchange: failed to store EPM for %s: %v", target, err)
+		return nil
 	}
-
+	log.Infof("epm-exchange: stored EPM for peer %s (%d bytes)", target.ShortString(), len(epmData))
 	return nil
 }
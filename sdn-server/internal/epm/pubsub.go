@@ -2,15 +2,17 @@ package epm
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/PNM"
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/ipfs/go-cid"
-	mh "github.com/multiformats/go-multihash"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/sds"
 )
 
 // TopicPublisher is the interface for publishing to a PubSub topic.
@@ -33,12 +35,10 @@ func (s *Service) PublishEPM(ctx context.Context, publisher TopicPublisher) erro
 	}
 
 	// Compute CID from EPM data
-	hash := sha256.Sum256(epmData)
-	multihash, err := mh.Encode(hash[:], mh.SHA2_256)
+	epmCID, err := computeEPMCID(epmData)
 	if err != nil {
-		return fmt.Errorf("failed to encode multihash: %w", err)
+		return err
 	}
-	epmCID := cid.NewCidV1(cid.Raw, multihash)
 
 	// Sign the CID with Ed25519 signing key (via libp2p crypto.PrivKey)
 	var signatureHex string
@@ -74,7 +74,7 @@ func (s *Service) PublishEPM(ctx context.Context, publisher TopicPublisher) erro
 	data := make([]byte, len(builder.FinishedBytes()))
 	copy(data, builder.FinishedBytes())
 
-	if err := publisher.Publish("PNM", data); err != nil {
+	if err := publisher.Publish(sds.PNMSchema, data); err != nil {
 		return fmt.Errorf("failed to publish EPM PNM: %w", err)
 	}
 
@@ -82,32 +82,102 @@ func (s *Service) PublishEPM(ctx context.Context, publisher TopicPublisher) erro
 	return nil
 }
 
-// HandlePNMEPM processes an incoming PNM with FILE_ID="EPM".
-// It verifies the signature and stores the EPM data in the peer registry.
-func (s *Service) HandlePNMEPM(pnmData []byte, fromPeer string) {
-	pnm := PNM.GetSizePrefixedRootAsPNM(pnmData, 0)
-	if pnm == nil {
-		log.Warn("Received invalid PNM data")
-		return
+// HandlePNMEPM processes an incoming PNM with FILE_ID="EPM". The EPM is
+// fetched by CID from the announcing peer or IPFS, checked with
+// VerifyRemoteEPM and stored as that peer's current EPM. author is the
+// PubSub message's signer; the announcer named in the PNM's
+// MULTIFORMAT_ADDRESS must be the author, so peers cannot trigger fetches
+// on behalf of others. An announcement of a version the peer has since
+// replaced fails with ErrEPMReplayed.
+func (s *Service) HandlePNMEPM(ctx context.Context, pnmData []byte, author peer.ID) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid PNM data")
+		}
+	}()
+	if len(pnmData) < 8 {
+		return fmt.Errorf("invalid PNM data")
 	}
+	pnm := PNM.GetSizePrefixedRootAsPNM(pnmData, 0)
 
 	fileID := string(pnm.FILE_ID())
 	if fileID != "EPM" {
-		return // not an EPM announcement
+		return nil // not an EPM announcement
 	}
 
 	epmCIDStr := string(pnm.CID())
 	if epmCIDStr == "" {
-		log.Warn("EPM PNM missing CID")
-		return
+		return fmt.Errorf("EPM PNM missing CID")
+	}
+	if _, err := cid.Decode(epmCIDStr); err != nil {
+		return fmt.Errorf("EPM PNM has invalid CID: %w", err)
+	}
+	origin, err := peer.Decode(strings.TrimPrefix(string(pnm.MULTIFORMAT_ADDRESS()), "/p2p/"))
+	if err != nil {
+		return fmt.Errorf("EPM PNM has invalid address: %w", err)
+	}
+	if origin == s.peerID {
+		return nil
+	}
+	if origin != author {
+		return fmt.Errorf("EPM PNM for %s was signed by %s", origin, author)
+	}
+	if sigType := string(pnm.SIGNATURE_TYPE()); sigType != "" && sigType != "Ed25519" {
+		return fmt.Errorf("unsupported EPM signature type %q", sigType)
+	}
+	signatureHex := string(pnm.SIGNATURE())
+	if signatureHex == "" {
+		return ErrEPMUnsigned
 	}
 
-	log.Debugf("Received EPM PNM from %s (CID: %s)", fromPeer, epmCIDStr)
+	if tp, err := s.registry.GetPeer(origin); err == nil {
+		for i, v := range tp.EPMHistory {
+			if v.CID != epmCIDStr {
+				continue
+			}
+			if i == 0 {
+				return nil // already current
+			}
+			// An old announcement must not roll the peer back.
+			return ErrEPMReplayed
+		}
+	}
 
-	// TODO: Fetch the actual EPM data by CID from the network
-	// For now, log the announcement. When IPFS content routing is
-	// integrated, we would: fetch EPM bytes by CID, verify signature,
-	// parse EPM FlatBuffer, store in registry.
+	s.mu.Lock()
+	if s.fetching[origin] {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.fetching == nil {
+		s.fetching = make(map[peer.ID]bool)
+	}
+	s.fetching[origin] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.fetching, origin)
+		s.mu.Unlock()
+	}()
+
+	log.Debugf("Received EPM PNM for %s (CID: %s)", origin, epmCIDStr)
+
+	fetchCtx, cancel := context.WithTimeout(ctx, epmFetchTimeout)
+	defer cancel()
+	epmData, source, err := s.fetchAnnouncedEPM(fetchCtx, origin, epmCIDStr)
+	if err != nil {
+		return err
+	}
+	if _, err := VerifyRemoteEPM(epmData, origin, epmCIDStr, signatureHex); err != nil {
+		return fmt.Errorf("EPM from %s rejected: %w", origin, err)
+	}
+	stored, err := s.storePeerEPM(origin, epmData, epmCIDStr, source)
+	if err != nil {
+		return err
+	}
+	if stored {
+		log.Infof("Stored EPM for peer %s from %s (CID: %s)", origin.ShortString(), source, epmCIDStr)
+	}
+	return nil
 }
 
 // StartAutoPublish runs a background goroutine that publishes the EPM
@@ -0,0 +1,380 @@
+package epm
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/EPM"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+	"github.com/spacedatanetwork/sdn-server/internal/vcard"
+)
+
+// Errors returned when a remote EPM fails verification.
+var (
+	ErrEPMUnsigned          = errors.New("EPM announcement is not signed")
+	ErrEPMCIDMismatch       = errors.New("EPM data does not match the announced CID")
+	ErrEPMBadSignature      = errors.New("EPM announcement signature is invalid")
+	ErrEPMIdentityMismatch  = errors.New("EPM identity attestation does not match the announcing peer")
+	ErrEPMMalformed         = errors.New("malformed EPM")
+	ErrEPMNoAttestation     = errors.New("EPM has no identity attestation")
+	ErrEPMFetchUnavailable  = errors.New("EPM could not be fetched from the peer or IPFS")
+	ErrEPMReplayed          = errors.New("EPM announcement replays an earlier version")
+	errEPMStreamEmptyResult = errors.New("peer has no EPM")
+)
+
+// epmFetchTimeout bounds each attempt to fetch an announced EPM.
+const epmFetchTimeout = 30 * time.Second
+
+// computeEPMCID returns the CIDv1 (raw, sha2-256) that PublishEPM announces
+// for epmData.
+func computeEPMCID(epmData []byte) (cid.Cid, error) {
+	hash := sha256.Sum256(epmData)
+	multihash, err := mh.Encode(hash[:], mh.SHA2_256)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to encode multihash: %w", err)
+	}
+	return cid.NewCidV1(cid.Raw, multihash), nil
+}
+
+// SetIPFSAPIURL sets the Kubo RPC API used to fetch announced EPMs when
+// the announcing peer cannot be reached directly.
+func (s *Service) SetIPFSAPIURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ipfsAPIURL = strings.TrimRight(strings.TrimSpace(url), "/")
+}
+
+// VerifyRemoteEPM checks an EPM announced by origin. The data must hash to
+// epmCID, the announcement signature must verify against the EPM's Ed25519
+// signing key, and the EPM's identity attestation must carry valid chain
+// proofs binding that signing key to origin's libp2p identity key.
+func VerifyRemoteEPM(epmData []byte, origin peer.ID, epmCID, signatureHex string) (*IdentityAttestation, error) {
+	if strings.TrimSpace(signatureHex) == "" {
+		return nil, ErrEPMUnsigned
+	}
+	announced, err := cid.Decode(epmCID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EPM CID: %w", err)
+	}
+	actual, err := announced.Prefix().Sum(epmData)
+	if err != nil || !actual.Equals(announced) {
+		return nil, ErrEPMCIDMismatch
+	}
+
+	att, signingKeyHex, err := verifyEPMAttestation(epmData, origin)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := hex.DecodeString(signingKeyHex)
+	if err != nil || len(signingKey) != ed25519.PublicKeySize {
+		return nil, ErrEPMMalformed
+	}
+	sig, err := hex.DecodeString(signatureHex)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(signingKey), []byte(epmCID), sig) {
+		return nil, ErrEPMBadSignature
+	}
+	return att, nil
+}
+
+// VerifyEPMAttestation checks that epmData carries an identity attestation
+// with valid chain proofs binding its signing key to owner's libp2p
+// identity key, and returns the attestation.
+func VerifyEPMAttestation(epmData []byte, owner peer.ID) (*IdentityAttestation, error) {
+	att, _, err := verifyEPMAttestation(epmData, owner)
+	return att, err
+}
+
+func verifyEPMAttestation(epmData []byte, owner peer.ID) (att *IdentityAttestation, signingKeyHex string, err error) {
+	// FlatBuffer accessors panic on corrupt offsets.
+	defer func() {
+		if r := recover(); r != nil {
+			att, signingKeyHex, err = nil, "", ErrEPMMalformed
+		}
+	}()
+	if len(epmData) < 8 {
+		return nil, "", ErrEPMMalformed
+	}
+	e := EPM.GetSizePrefixedRootAsEPM(epmData, 0)
+
+	att, err = attestationFromEPM(e)
+	if err != nil {
+		return nil, "", err
+	}
+	if ok, err := att.Verify(); !ok {
+		return nil, "", fmt.Errorf("identity attestation: %w", err)
+	}
+
+	ownerKey, err := owner.ExtractPublicKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot extract public key from %s: %w", owner, err)
+	}
+	ownerRaw, err := ownerKey.Raw()
+	if err != nil || !strings.EqualFold(att.IdentityPubKeyHex, hex.EncodeToString(ownerRaw)) {
+		return nil, "", ErrEPMIdentityMismatch
+	}
+
+	signingKeyHex = epmSigningKeyHex(e)
+	if signingKeyHex == "" || !strings.EqualFold(signingKeyHex, att.SigningPubKeyHex) {
+		return nil, "", ErrEPMIdentityMismatch
+	}
+	return att, signingKeyHex, nil
+}
+
+// EPMIdentity is what a verified EPM attests about its owner.
+type EPMIdentity struct {
+	Attestation   *IdentityAttestation
+	SigningKeyHex string
+	DN            string
+	LegalName     string
+	Email         string
+	// LicenseIssuer and LicenseIssuerKey are the descriptor and public key
+	// of the EPM's license issuer key, if it has one.
+	LicenseIssuer    string
+	LicenseIssuerKey string
+}
+
+// VerifyEPMIdentity checks epmData with VerifyEPMAttestation and returns the
+// identity it binds to owner. The attestation covers the EPM's signing key
+// only, so use it on EPMs whose content was verified when received, such as
+// those in the peer registry; use VerifySignedEPMIdentity otherwise.
+func VerifyEPMIdentity(epmData []byte, owner peer.ID) (id *EPMIdentity, err error) {
+	att, err := VerifyEPMAttestation(epmData, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			id, err = nil, ErrEPMMalformed
+		}
+	}()
+	e := EPM.GetSizePrefixedRootAsEPM(epmData, 0)
+	id = &EPMIdentity{
+		Attestation:   att,
+		SigningKeyHex: att.SigningPubKeyHex,
+		DN:            string(e.DN()),
+		LegalName:     string(e.LEGAL_NAME()),
+		Email:         string(e.EMAIL()),
+	}
+	key := new(EPM.CryptoKey)
+	for i := 0; i < e.KEYSLength(); i++ {
+		if e.KEYS(key, i) && string(key.ADDRESS_TYPE()) == vcard.LicenseIssuerAddressType {
+			id.LicenseIssuer = string(key.KEY_ADDRESS())
+			id.LicenseIssuerKey = string(key.PUBLIC_KEY())
+			break
+		}
+	}
+	return id, nil
+}
+
+// VerifySignedEPMIdentity is VerifyEPMIdentity for an EPM handed over
+// directly: signatureHex must be owner's announcement signature over the
+// EPM's CID, which covers the whole EPM.
+func VerifySignedEPMIdentity(epmData []byte, owner peer.ID, signatureHex string) (*EPMIdentity, error) {
+	c, err := computeEPMCID(epmData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := VerifyRemoteEPM(epmData, owner, c.String(), signatureHex); err != nil {
+		return nil, err
+	}
+	return VerifyEPMIdentity(epmData, owner)
+}
+
+// attestationFromEPM rebuilds the identity attestation from an EPM's chain
+// proofs, which all carry the same signed payload.
+func attestationFromEPM(e *EPM.EPM) (*IdentityAttestation, error) {
+	n := e.CHAIN_PROOFSLength()
+	if n == 0 {
+		return nil, ErrEPMNoAttestation
+	}
+
+	var payloadHex string
+	proofs := make([]IdentityAttestationChainProof, 0, n)
+	cp := new(EPM.ChainProof)
+	for i := 0; i < n; i++ {
+		if !e.CHAIN_PROOFS(cp, i) {
+			continue
+		}
+		proof := IdentityAttestationChainProof{
+			Chain:              string(cp.CHAIN()),
+			Address:            string(cp.ADDRESS()),
+			KeyPath:            string(cp.KEY_PATH()),
+			PublicKeyHex:       string(cp.PUBLIC_KEY()),
+			Signature:          string(cp.SIGNATURE()),
+			SignedPayloadHex:   string(cp.SIGNED_PAYLOAD()),
+			SignatureAlgorithm: string(cp.ALGORITHM()),
+			SignatureEncoding:  string(cp.ENCODING()),
+		}
+		if payloadHex == "" {
+			payloadHex = proof.SignedPayloadHex
+		} else if proof.SignedPayloadHex != payloadHex {
+			return nil, errors.New("chain proofs sign different payloads")
+		}
+		proofs = append(proofs, proof)
+	}
+
+	raw, err := hex.DecodeString(payloadHex)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrEPMNoAttestation
+	}
+	var payload identityAttestationPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("invalid attestation payload: %w", err)
+	}
+	return &IdentityAttestation{
+		Version:           payload.Version,
+		XPub:              payload.XPub,
+		IdentityPubKeyHex: payload.IdentityPubKeyHex,
+		IdentityKeyPath:   payload.IdentityKeyPath,
+		SigningPubKeyHex:  payload.SigningPubKeyHex,
+		SigningKeyPath:    payload.SigningKeyPath,
+		IssuedAt:          payload.IssuedAt,
+		BitcoinAddress:    payload.BitcoinAddress,
+		BitcoinKeyPath:    payload.BitcoinKeyPath,
+		EthereumAddress:   payload.EthereumAddress,
+		EthereumKeyPath:   payload.EthereumKeyPath,
+		SolanaAddress:     payload.SolanaAddress,
+		SolanaKeyPath:     payload.SolanaKeyPath,
+		ChainProofs:       proofs,
+	}, nil
+}
+
+// epmSigningKeyHex returns the EPM's Ed25519 signing public key.
+func epmSigningKeyHex(e *EPM.EPM) string {
+	key := new(EPM.CryptoKey)
+	for i := 0; i < e.KEYSLength(); i++ {
+		if e.KEYS(key, i) && key.KEY_TYPE() == EPM.KeyTypeSigning && string(key.ADDRESS_TYPE()) == "ed25519" {
+			return string(key.PUBLIC_KEY())
+		}
+	}
+	return ""
+}
+
+// fetchAnnouncedEPM fetches an announced EPM from the announcing peer over
+// EPMExchangeProtocolID, falling back to IPFS. It returns the data and the
+// source it came from.
+func (s *Service) fetchAnnouncedEPM(ctx context.Context, origin peer.ID, epmCID string) ([]byte, string, error) {
+	s.mu.RLock()
+	h := s.host
+	ipfsAPIURL := s.ipfsAPIURL
+	s.mu.RUnlock()
+
+	if h != nil {
+		data, err := fetchEPMFromPeer(ctx, h, origin)
+		if err == nil {
+			if c, cerr := computeEPMCID(data); cerr == nil && c.String() == epmCID {
+				return data, "stream", nil
+			}
+			// The peer has since rebuilt its EPM; the announced version may
+			// still be on IPFS.
+			log.Debugf("epm-exchange: %s served a newer EPM than %s", origin.ShortString(), epmCID)
+		} else {
+			log.Debugf("epm-exchange: fetch from %s failed: %v", origin.ShortString(), err)
+		}
+	}
+	if ipfsAPIURL != "" {
+		data, err := fetchEPMFromIPFS(ctx, ipfsAPIURL, epmCID)
+		if err == nil {
+			return data, "ipfs", nil
+		}
+		log.Debugf("IPFS fetch of EPM %s failed: %v", epmCID, err)
+	}
+	return nil, "", ErrEPMFetchUnavailable
+}
+
+// fetchEPMFromPeer asks target for its own EPM over EPMExchangeProtocolID.
+func fetchEPMFromPeer(ctx context.Context, h host.Host, target peer.ID) ([]byte, error) {
+	streamCtx, cancel := context.WithTimeout(ctx, streamReadDeadline+streamWriteDeadline)
+	defer cancel()
+
+	stream, err := h.NewStream(streamCtx, target, EPMExchangeProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	// Send request (len=0 means "send me yours")
+	_ = stream.SetWriteDeadline(time.Now().Add(streamWriteDeadline))
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, 0)
+	if _, err := stream.Write(header); err != nil {
+		return nil, err
+	}
+
+	// Read response
+	_ = stream.SetReadDeadline(time.Now().Add(streamReadDeadline))
+
+	var respHeader [8]byte
+	if _, err := io.ReadFull(stream, respHeader[:]); err != nil {
+		return nil, err
+	}
+
+	status := binary.LittleEndian.Uint32(respHeader[0:4])
+	dataLen := binary.LittleEndian.Uint32(respHeader[4:8])
+
+	if status != statusOK || dataLen == 0 || dataLen > maxEPMSize {
+		return nil, errEPMStreamEmptyResult
+	}
+
+	epmData := make([]byte, dataLen)
+	if _, err := io.ReadFull(stream, epmData); err != nil {
+		return nil, err
+	}
+	return epmData, nil
+}
+
+// fetchEPMFromIPFS reads an EPM by CID through the Kubo RPC API.
+func fetchEPMFromIPFS(ctx context.Context, apiURL, epmCID string) ([]byte, error) {
+	c, err := cid.Decode(epmCID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EPM CID: %w", err)
+	}
+	query := url.Values{"arg": {c.String()}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/api/v0/cat?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: epmFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IPFS cat failed with status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxEPMSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEPMSize {
+		return nil, fmt.Errorf("EPM exceeds %d bytes", maxEPMSize)
+	}
+	return data, nil
+}
+
+// storePeerEPM records epmData as origin's current EPM.
+func (s *Service) storePeerEPM(origin peer.ID, epmData []byte, epmCID, source string) (bool, error) {
+	vcardStr, _ := vcard.EPMToVCard(epmData)
+	return s.registry.SetPeerEPM(origin, peers.EPMVersion{
+		CID:    epmCID,
+		Data:   epmData,
+		Source: source,
+	}, vcardStr)
+}
@@ -0,0 +1,248 @@
+package epm
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/mr-tron/base58"
+
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+	"github.com/spacedatanetwork/sdn-server/internal/wasm"
+)
+
+// testIdentity builds a DerivedIdentity from fresh keys, with the chain keys
+// and addresses an identity attestation needs.
+func testIdentity(t *testing.T) *wasm.DerivedIdentity {
+	t.Helper()
+	idPriv, idPub, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateSecp256k1Key failed: %v", err)
+	}
+	signPriv, signPub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key failed: %v", err)
+	}
+	peerID, err := peer.IDFromPublicKey(idPub)
+	if err != nil {
+		t.Fatalf("IDFromPublicKey failed: %v", err)
+	}
+
+	chainKey := func() []byte {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatalf("rand.Read failed: %v", err)
+		}
+		return key
+	}
+	btcKey, ethKey, solKey := chainKey(), chainKey(), chainKey()
+	btcAddr, err := bitcoinAddressFromCompressedPublicKey(secp256k1.PrivKeyFromBytes(btcKey).PubKey().SerializeCompressed())
+	if err != nil {
+		t.Fatalf("bitcoin address: %v", err)
+	}
+	ethAddr, err := ethereumAddressFromCompressedPublicKey(secp256k1.PrivKeyFromBytes(ethKey).PubKey().SerializeCompressed())
+	if err != nil {
+		t.Fatalf("ethereum address: %v", err)
+	}
+	solAddr := base58.Encode(ed25519.NewKeyFromSeed(solKey).Public().(ed25519.PublicKey))
+
+	return &wasm.DerivedIdentity{
+		IdentityPrivKey:    idPriv,
+		IdentityPubKey:     idPub,
+		SigningPrivKey:     signPriv,
+		SigningPubKey:      signPub,
+		PeerID:             peerID,
+		IdentityKeyPath:    "m/44'/0'/0'",
+		SigningKeyPath:     "m/44'/0'/0'/0'/0'",
+		BitcoinKeyPath:     "m/84'/0'/0'/0/0",
+		BitcoinPrivateKey:  btcKey,
+		EthereumKeyPath:    "m/44'/60'/0'/0/0",
+		EthereumPrivateKey: ethKey,
+		SolanaKeyPath:      "m/44'/501'/0'/0'",
+		SolanaPrivateKey:   solKey,
+		Addresses: &wasm.CoinAddresses{
+			Bitcoin:  &wasm.CoinAddress{Address: btcAddr},
+			Ethereum: &wasm.CoinAddress{Address: ethAddr},
+			Solana:   &wasm.CoinAddress{Address: solAddr},
+		},
+	}
+}
+
+func newTestService(t *testing.T, registry *peers.Registry) (*Service, *wasm.DerivedIdentity) {
+	t.Helper()
+	id := testIdentity(t)
+	s := NewService(id, registry, id.PeerID, "xpub-test", t.TempDir())
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return s, id
+}
+
+// announce returns the PNM s publishes for its current EPM, with the EPM's
+// CID and announcement signature.
+func announce(t *testing.T, s *Service) (pnm []byte, epmCID, signatureHex string) {
+	t.Helper()
+	var pub capturePublisher
+	if err := s.PublishEPM(context.Background(), &pub); err != nil {
+		t.Fatalf("PublishEPM failed: %v", err)
+	}
+	c, err := computeEPMCID(s.GetNodeEPM())
+	if err != nil {
+		t.Fatalf("computeEPMCID failed: %v", err)
+	}
+	sig, err := s.identity.SigningPrivKey.Sign([]byte(c.String()))
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return pub.data, c.String(), hex.EncodeToString(sig)
+}
+
+type capturePublisher struct{ data []byte }
+
+func (p *capturePublisher) Publish(schema string, data []byte) error {
+	p.data = data
+	return nil
+}
+
+// ipfsServer serves EPMs by CID the way the Kubo cat RPC does.
+type ipfsServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	hits  int
+}
+
+func (f *ipfsServer) add(t *testing.T, data []byte) {
+	t.Helper()
+	c, err := computeEPMCID(data)
+	if err != nil {
+		t.Fatalf("computeEPMCID failed: %v", err)
+	}
+	f.mu.Lock()
+	f.files[c.String()] = data
+	f.mu.Unlock()
+}
+
+func (f *ipfsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits++
+	data, ok := f.files[r.URL.Query().Get("arg")]
+	if r.URL.Path != "/api/v0/cat" || len(r.URL.Query()["arg"]) != 1 || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func newIPFSServer(t *testing.T) (*ipfsServer, string) {
+	f := &ipfsServer{files: make(map[string][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+func TestVerifyRemoteEPM(t *testing.T) {
+	s, id := newTestService(t, peers.NewRegistry(false, nil))
+	other, _ := newTestService(t, peers.NewRegistry(false, nil))
+	_, epmCID, sig := announce(t, s)
+	epmData := s.GetNodeEPM()
+
+	if _, err := VerifyRemoteEPM(epmData, id.PeerID, epmCID, sig); err != nil {
+		t.Fatalf("VerifyRemoteEPM failed: %v", err)
+	}
+
+	_, otherCID, otherSig := announce(t, other)
+	tests := []struct {
+		name   string
+		data   []byte
+		origin peer.ID
+		cid    string
+		sig    string
+		want   error
+	}{
+		{"unsigned", epmData, id.PeerID, epmCID, "", ErrEPMUnsigned},
+		{"CID mismatch", other.GetNodeEPM(), id.PeerID, epmCID, sig, ErrEPMCIDMismatch},
+		{"signature over another CID", epmData, id.PeerID, epmCID, otherSig, ErrEPMBadSignature},
+		{"identity mismatch", other.GetNodeEPM(), id.PeerID, otherCID, otherSig, ErrEPMIdentityMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyRemoteEPM(tt.data, tt.origin, tt.cid, tt.sig); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyRemoteEPM = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchEPMFromIPFSRejectsInvalidCID(t *testing.T) {
+	f, url := newIPFSServer(t)
+	if _, err := fetchEPMFromIPFS(context.Background(), url, "bafy&arg=other"); err == nil {
+		t.Error("fetch with an invalid CID should fail")
+	}
+	if f.hits != 0 {
+		t.Errorf("IPFS was queried %d times for an invalid CID", f.hits)
+	}
+}
+
+func TestHandlePNMEPM(t *testing.T) {
+	announcer, id := newTestService(t, peers.NewRegistry(false, nil))
+	other, otherID := newTestService(t, peers.NewRegistry(false, nil))
+	registry := peers.NewRegistry(false, nil)
+	receiver, _ := newTestService(t, registry)
+	ipfs, url := newIPFSServer(t)
+	receiver.SetIPFSAPIURL(url)
+	ctx := context.Background()
+
+	// An announcement is only accepted from the peer it names.
+	pnm1, cid1, _ := announce(t, announcer)
+	ipfs.add(t, announcer.GetNodeEPM())
+	if err := receiver.HandlePNMEPM(ctx, pnm1, otherID.PeerID); err == nil {
+		t.Error("announcement signed by another peer should be rejected")
+	}
+	if _, err := registry.GetPeer(id.PeerID); err == nil {
+		t.Fatal("EPM stored from a forged announcement")
+	}
+
+	if err := receiver.HandlePNMEPM(ctx, pnm1, id.PeerID); err != nil {
+		t.Fatalf("HandlePNMEPM failed: %v", err)
+	}
+	tp, err := registry.GetPeer(id.PeerID)
+	if err != nil || len(tp.EPMHistory) != 1 || tp.EPMHistory[0].CID != cid1 {
+		t.Fatalf("stored EPM = %+v, %v; want %s", tp, err, cid1)
+	}
+
+	// Data that does not hash to the announced CID is not stored.
+	otherPNM, otherCID, _ := announce(t, other)
+	ipfs.mu.Lock()
+	ipfs.files[otherCID] = announcer.GetNodeEPM()
+	ipfs.mu.Unlock()
+	if err := receiver.HandlePNMEPM(ctx, otherPNM, otherID.PeerID); err == nil {
+		t.Error("EPM that does not match its CID should be rejected")
+	}
+
+	// A newer version replaces the EPM; replaying the older one does not
+	// roll it back.
+	if err := announcer.UpdateProfile(&Profile{LegalName: "Renamed Org"}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	pnm2, cid2, _ := announce(t, announcer)
+	ipfs.add(t, announcer.GetNodeEPM())
+	if err := receiver.HandlePNMEPM(ctx, pnm2, id.PeerID); err != nil {
+		t.Fatalf("HandlePNMEPM of the new version failed: %v", err)
+	}
+	if err := receiver.HandlePNMEPM(ctx, pnm1, id.PeerID); !errors.Is(err, ErrEPMReplayed) {
+		t.Errorf("replayed announcement = %v, want %v", err, ErrEPMReplayed)
+	}
+	if tp, _ := registry.GetPeer(id.PeerID); tp.EPMHistory[0].CID != cid2 {
+		t.Errorf("current EPM = %s, want %s", tp.EPMHistory[0].CID, cid2)
+	}
+}
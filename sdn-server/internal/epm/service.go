@@ -22,6 +22,7 @@ import (
 
 	flatbuffers "github.com/google/flatbuffers/go"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"golang.org/x/crypto/ripemd160"
 	"golang.org/x/crypto/sha3"
@@ -350,6 +351,12 @@ func verifySolanaChainProof(payload []byte, proof IdentityAttestationChainProof,
 	return nil
 }
 
+// NormalizeChainAddress returns address in the form used to compare
+// addresses on chain ("bitcoin", "ethereum" or "solana").
+func NormalizeChainAddress(address, chain string) string {
+	return normalizeChainAddress(address, strings.ToLower(strings.TrimSpace(chain)))
+}
+
 func normalizeChainAddress(address, chain string) string {
 	value := strings.TrimSpace(address)
 	switch chain {
@@ -570,6 +577,15 @@ type Service struct {
 	// (for example deterministic onion URLs).
 	runtimeAddresses    []string
 	identityAttestation *IdentityAttestation
+	// licenseIssuer is the license service's signed issuer descriptor,
+	// published as an extra key so peers can trust this node's tokens.
+	licenseIssuer    string
+	licenseIssuerKey string
+
+	// host and ipfsAPIURL are used to fetch EPMs announced by other peers.
+	host       host.Host
+	ipfsAPIURL string
+	fetching   map[peer.ID]bool // peers with an EPM fetch in flight
 
 	mu sync.RWMutex
 }
@@ -665,6 +681,23 @@ func (s *Service) SetRuntimeAddresses(addresses []string) error {
 	return nil
 }
 
+// SetLicenseIssuer publishes the license service's issuer descriptor and
+// active public key in the EPM and rebuilds it.
+func (s *Service) SetLicenseIssuer(publicKeyHex, descriptor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.licenseIssuer == descriptor && s.licenseIssuerKey == publicKeyHex {
+		return nil
+	}
+	s.licenseIssuer = descriptor
+	s.licenseIssuerKey = publicKeyHex
+	if err := s.rebuildEPMLocked(); err != nil {
+		return fmt.Errorf("failed to rebuild EPM with license issuer: %w", err)
+	}
+	return nil
+}
+
 // GetNodeEPMJSON returns the EPM as a JSON-friendly structure.
 func (s *Service) GetNodeEPMJSON() map[string]interface{} {
 	s.mu.RLock()
@@ -1025,6 +1058,20 @@ func (s *Service) rebuildEPMLocked() error {
 		keyOffsets = append(keyOffsets, encKeyOff)
 	}
 
+	if s.licenseIssuer != "" {
+		// License token issuer key; KEY_ADDRESS carries the signed descriptor.
+		licPubOff := builder.CreateString(s.licenseIssuerKey)
+		licAddrTypeOff := builder.CreateString(vcard.LicenseIssuerAddressType)
+		licDescOff := builder.CreateString(s.licenseIssuer)
+
+		EPM.CryptoKeyStart(builder)
+		EPM.CryptoKeyAddPUBLIC_KEY(builder, licPubOff)
+		EPM.CryptoKeyAddADDRESS_TYPE(builder, licAddrTypeOff)
+		EPM.CryptoKeyAddKEY_ADDRESS(builder, licDescOff)
+		EPM.CryptoKeyAddKEY_TYPE(builder, EPM.KeyTypeSigning)
+		keyOffsets = append(keyOffsets, EPM.CryptoKeyEnd(builder))
+	}
+
 	if len(keyOffsets) > 0 {
 		EPM.EPMStartKEYSVector(builder, len(keyOffsets))
 		for i := len(keyOffsets) - 1; i >= 0; i-- {
@@ -1240,6 +1287,15 @@ func (s *Service) buildCanonicalSigningContent(signatureTimestamp int64) []byte
 		})
 		content["KEYS"] = keys
 	}
+	if s.licenseIssuer != "" {
+		keys, _ := content["KEYS"].([]map[string]interface{})
+		content["KEYS"] = append(keys, map[string]interface{}{
+			"PUBLIC_KEY":   s.licenseIssuerKey,
+			"ADDRESS_TYPE": vcard.LicenseIssuerAddressType,
+			"KEY_ADDRESS":  s.licenseIssuer,
+			"KEY_TYPE":     "Signing",
+		})
+	}
 
 	// Multiformat addresses
 	peerIDStr := s.peerID.String()
@@ -0,0 +1,57 @@
+package epm
+
+import (
+	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/EPM"
+)
+
+// Summary holds the descriptive fields of an EPM.
+type Summary struct {
+	DN             string   `json:"dn,omitempty"`
+	LegalName      string   `json:"legal_name,omitempty"`
+	GivenName      string   `json:"given_name,omitempty"`
+	FamilyName     string   `json:"family_name,omitempty"`
+	JobTitle       string   `json:"job_title,omitempty"`
+	Occupation     string   `json:"occupation,omitempty"`
+	Email          string   `json:"email,omitempty"`
+	Telephone      string   `json:"telephone,omitempty"`
+	Country        string   `json:"country,omitempty"`
+	Region         string   `json:"region,omitempty"`
+	Locality       string   `json:"locality,omitempty"`
+	AlternateNames []string `json:"alternate_names,omitempty"`
+}
+
+// Summarize reads the descriptive fields of a size-prefixed EPM.
+func Summarize(epmData []byte) (sum *Summary, err error) {
+	// FlatBuffer accessors panic on corrupt offsets.
+	defer func() {
+		if r := recover(); r != nil {
+			sum, err = nil, ErrEPMMalformed
+		}
+	}()
+	if len(epmData) < 8 {
+		return nil, ErrEPMMalformed
+	}
+	e := EPM.GetSizePrefixedRootAsEPM(epmData, 0)
+	sum = &Summary{
+		DN:         string(e.DN()),
+		LegalName:  string(e.LEGAL_NAME()),
+		GivenName:  string(e.GIVEN_NAME()),
+		FamilyName: string(e.FAMILY_NAME()),
+		JobTitle:   string(e.JOB_TITLE()),
+		Occupation: string(e.OCCUPATION()),
+		Email:      string(e.EMAIL()),
+		Telephone:  string(e.TELEPHONE()),
+	}
+	addr := new(EPM.Address)
+	if e.ADDRESS(addr) != nil {
+		sum.Country = string(addr.COUNTRY())
+		sum.Region = string(addr.REGION())
+		sum.Locality = string(addr.LOCALITY())
+	}
+	for i := 0; i < e.ALTERNATE_NAMESLength(); i++ {
+		if v := e.ALTERNATE_NAMES(i); v != nil {
+			sum.AlternateNames = append(sum.AlternateNames, string(v))
+		}
+	}
+	return sum, nil
+}
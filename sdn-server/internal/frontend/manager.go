@@ -4,6 +4,8 @@
 package frontend
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +17,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 )
 
 // MaxUploadSize is the maximum total upload size (50 MB).
@@ -22,7 +26,8 @@ const MaxUploadSize = 50 << 20
 
 // Manager manages the frontend directory for an SDN node.
 type Manager struct {
-	dir string
+	dir   string
+	audit *audit.Logger
 }
 
 // NewManager creates a frontend manager rooted at dir.
@@ -30,6 +35,22 @@ func NewManager(dir string) *Manager {
 	return &Manager{dir: dir}
 }
 
+// SetAuditLogger records frontend writes and deletions to logger.
+func (m *Manager) SetAuditLogger(logger *audit.Logger) {
+	m.audit = logger
+}
+
+// fileState summarizes a file for audit events, or returns nil if it does
+// not exist.
+func fileState(path string) map[string]interface{} {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return map[string]interface{}{"size": len(data), "sha256": hex.EncodeToString(sum[:])}
+}
+
 // Dir returns the managed frontend directory path.
 func (m *Manager) Dir() string { return m.dir }
 
@@ -175,6 +196,8 @@ func (m *Manager) putFile(w http.ResponseWriter, r *http.Request, fullPath, relP
 		return
 	}
 
+	before := fileState(fullPath)
+
 	// Ensure parent directory exists
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -186,6 +209,14 @@ func (m *Manager) putFile(w http.ResponseWriter, r *http.Request, fullPath, relP
 		http.Error(w, fmt.Sprintf("failed to write file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	m.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypeFrontendWrite,
+		TargetType:  "frontend_file",
+		TargetID:    relPath,
+		Description: "Frontend file written",
+		Before:      before,
+		After:       fileState(fullPath),
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -194,16 +225,25 @@ func (m *Manager) putFile(w http.ResponseWriter, r *http.Request, fullPath, relP
 	})
 }
 
-func (m *Manager) deleteFile(w http.ResponseWriter, _ *http.Request, fullPath, relPath string) {
+func (m *Manager) deleteFile(w http.ResponseWriter, r *http.Request, fullPath, relPath string) {
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
+	before := fileState(fullPath)
 	if err := os.RemoveAll(fullPath); err != nil {
 		http.Error(w, fmt.Sprintf("failed to delete: %v", err), http.StatusInternalServerError)
 		return
 	}
+	m.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypeFrontendDelete,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "frontend_file",
+		TargetID:    relPath,
+		Description: "Frontend path deleted",
+		Before:      before,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -247,6 +287,13 @@ func (m *Manager) handleUpload(w http.ResponseWriter, r *http.Request) {
 			uploaded = append(uploaded, rel)
 		}
 	}
+	m.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypeFrontendWrite,
+		TargetType:  "frontend_dir",
+		TargetID:    filepath.ToSlash(subdir),
+		Description: fmt.Sprintf("%d frontend files uploaded", len(uploaded)),
+		Details:     map[string]interface{}{"files": uploaded},
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -357,6 +404,14 @@ func (m *Manager) handleGitImport(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	m.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypeFrontendWrite,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "frontend_dir",
+		Description: "Frontend replaced from git repository",
+		Details:     map[string]interface{}{"url": repoURL, "branch": strings.TrimSpace(body.Branch), "has_index": hasIndex},
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "ok",
@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 )
 
 func setupTestManager(t *testing.T) (*Manager, *http.ServeMux) {
@@ -198,3 +200,35 @@ func TestCreateSubdirectoryFile(t *testing.T) {
 		t.Errorf("css/main.css not found in listing: %+v", files)
 	}
 }
+
+func TestWritesAreAudited(t *testing.T) {
+	m, mux := setupTestManager(t)
+	logger, err := audit.NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	m.SetAuditLogger(logger)
+
+	body := bytes.NewBufferString(`{"content":"<h1>updated</h1>"}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/frontend/files/index.html", body)
+	req = req.WithContext(audit.WithActor(req.Context(), "xpub-admin"))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/admin/frontend/files/index.html", nil)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := logger.Query(audit.QueryOptions{TargetID: "index.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+	if entries[0].EventType != audit.EventTypeFrontendDelete || entries[1].EventType != audit.EventTypeFrontendWrite {
+		t.Errorf("unexpected event types: %s, %s", entries[0].EventType, entries[1].EventType)
+	}
+	if entries[1].ActorXPub != "xpub-admin" {
+		t.Errorf("expected actor xpub-admin, got %q", entries[1].ActorXPub)
+	}
+}
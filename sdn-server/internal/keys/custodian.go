@@ -0,0 +1,167 @@
+// Encryption of mnemonic shares to custodians.
+//
+// A share is sealed to a custodian's X25519 public key: an ephemeral X25519
+// key agrees a secret with the custodian key, HKDF-SHA256 turns it into an
+// XChaCha20-Poly1305 key, and the share text is the plaintext. Only the
+// holder of the custodian's private key can open it.
+
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrShareDecryption is returned when a share cannot be opened with the given key.
+var ErrShareDecryption = errors.New("failed to decrypt share - wrong custodian key?")
+
+const custodianHKDFInfo = "sdn-mnemonic-share/x25519-xchacha20poly1305"
+
+// EncryptedShare is a MnemonicShare sealed to a custodian's X25519 key. The
+// set ID, index and peer ID stay readable so custodians and operators can
+// tell shares apart without opening them.
+type EncryptedShare struct {
+	Version      int    `json:"version"`
+	SetID        string `json:"set_id"`
+	Index        int    `json:"index"`
+	PeerID       string `json:"peer_id"`
+	Custodian    string `json:"custodian"`     // Hex custodian X25519 public key
+	EphemeralKey string `json:"ephemeral_key"` // Hex ephemeral X25519 public key
+	Nonce        string `json:"nonce"`         // Hex XChaCha20-Poly1305 nonce
+	Ciphertext   string `json:"ciphertext"`    // Hex sealed share text
+}
+
+// shareKey derives the symmetric key for a share from the X25519 shared
+// secret and both public keys.
+func shareKey(shared, ephemeralPub, custodianPub []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPub...), custodianPub...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(custodianHKDFInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// shareAAD binds the readable fields of an encrypted share to its ciphertext.
+func shareAAD(e *EncryptedShare) []byte {
+	return []byte(fmt.Sprintf("%d\n%s\n%d\n%s", e.Version, e.SetID, e.Index, e.PeerID))
+}
+
+// EncryptShare seals share to the custodian's X25519 public key.
+func EncryptShare(share MnemonicShare, custodianPub []byte) (*EncryptedShare, error) {
+	if len(custodianPub) != X25519KeySize {
+		return nil, fmt.Errorf("%w: custodian key must be %d bytes", ErrInvalidKey, X25519KeySize)
+	}
+	ephemeralPriv := make([]byte, X25519KeySize)
+	if _, err := rand.Read(ephemeralPriv); err != nil {
+		return nil, fmt.Errorf("generate ephemeral key: %w", err)
+	}
+	defer zero(ephemeralPriv)
+	ephemeralPub, err := curve25519.X25519(ephemeralPriv, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("derive ephemeral key: %w", err)
+	}
+	shared, err := curve25519.X25519(ephemeralPriv, custodianPub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	key, err := shareKey(shared, ephemeralPub, custodianPub)
+	if err != nil {
+		return nil, fmt.Errorf("derive share key: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	enc := &EncryptedShare{
+		Version:      1,
+		SetID:        share.SetID,
+		Index:        share.Index,
+		PeerID:       share.PeerID,
+		Custodian:    hex.EncodeToString(custodianPub),
+		EphemeralKey: hex.EncodeToString(ephemeralPub),
+		Nonce:        hex.EncodeToString(nonce),
+	}
+	enc.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, []byte(share.String()), shareAAD(enc)))
+	return enc, nil
+}
+
+// DecryptShare opens an encrypted share with the custodian's X25519 private key.
+func DecryptShare(enc *EncryptedShare, custodianPriv []byte) (MnemonicShare, error) {
+	if enc == nil || enc.Version != 1 {
+		return MnemonicShare{}, ErrInvalidShare
+	}
+	if len(custodianPriv) != X25519KeySize {
+		return MnemonicShare{}, fmt.Errorf("%w: custodian key must be %d bytes", ErrInvalidKey, X25519KeySize)
+	}
+	ephemeralPub, err1 := hex.DecodeString(enc.EphemeralKey)
+	nonce, err2 := hex.DecodeString(enc.Nonce)
+	ciphertext, err3 := hex.DecodeString(enc.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return MnemonicShare{}, ErrInvalidShare
+	}
+
+	custodianPub, err := curve25519.X25519(custodianPriv, curve25519.Basepoint)
+	if err != nil {
+		return MnemonicShare{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	shared, err := curve25519.X25519(custodianPriv, ephemeralPub)
+	if err != nil {
+		return MnemonicShare{}, ErrShareDecryption
+	}
+	key, err := shareKey(shared, ephemeralPub, custodianPub)
+	if err != nil {
+		return MnemonicShare{}, ErrShareDecryption
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return MnemonicShare{}, ErrShareDecryption
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, shareAAD(enc))
+	if err != nil {
+		return MnemonicShare{}, ErrShareDecryption
+	}
+	return ParseMnemonicShare(string(plaintext))
+}
+
+// DecryptShare opens a share sealed to this node's X25519 encryption key, for
+// nodes acting as custodians of another node's shares.
+func (m *Manager) DecryptShare(enc *EncryptedShare) (MnemonicShare, error) {
+	if m.identity == nil || m.identity.EncryptionKey == nil {
+		return MnemonicShare{}, ErrKeyNotFound
+	}
+	return DecryptShare(enc, m.identity.EncryptionKey.PrivateKey)
+}
+
+// ParseEncryptedShare decodes an EncryptedShare from JSON.
+func ParseEncryptedShare(data []byte) (*EncryptedShare, error) {
+	var enc EncryptedShare
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	if enc.Version != 1 || strings.TrimSpace(enc.Ciphertext) == "" {
+		return nil, ErrInvalidShare
+	}
+	return &enc, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -34,6 +34,10 @@
 // 3. QR Code: The encrypted backup can be encoded for QR code generation,
 //    enabling mobile backup scenarios.
 //
+// 4. Shamir Shares: SplitMnemonic splits the node mnemonic into N shares, any
+//    M of which rebuild it with CombineMnemonicShares. EncryptShare seals a
+//    share to a custodian's X25519 key; vcard.ShareToQR prints one as a QR code.
+//
 // # Usage
 //
 // Generate new identity:
@@ -56,4 +60,9 @@
 // Import from backup:
 //
 //	err := mgr.ImportEncrypted(backupJSON, "password")
+//
+// Split the mnemonic 3-of-5 and seal a share to a custodian:
+//
+//	shares, _ := keys.SplitMnemonic(mnemonic, peerID, 3, 5)
+//	sealed, _ := keys.EncryptShare(shares[0], custodianX25519Pub)
 package keys
@@ -0,0 +1,246 @@
+// Shamir secret sharing of the node mnemonic.
+//
+// The mnemonic is split byte-wise over GF(2^8) into N shares, any M of which
+// reconstruct it. Fewer than M shares reveal nothing about the mnemonic. Each
+// share records the peer ID the mnemonic derives, so a recovery can check
+// the reconstructed identity before accepting it.
+
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Share errors
+var (
+	ErrInvalidShare       = errors.New("invalid mnemonic share")
+	ErrInsufficientShares = errors.New("not enough mnemonic shares")
+	ErrShareMismatch      = errors.New("mnemonic shares do not belong together")
+)
+
+const (
+	// MnemonicSharePrefix starts the text encoding of a MnemonicShare.
+	MnemonicSharePrefix = "sdn-share:1:"
+
+	// MaxShares is the largest number of shares a mnemonic can be split into.
+	MaxShares = 255
+
+	shareSetIDSize = 8
+)
+
+// MnemonicShare is one of the N shares of a split mnemonic.
+type MnemonicShare struct {
+	Version   int    `json:"v"`
+	SetID     string `json:"set"`      // Random ID shared by all shares of one split
+	PeerID    string `json:"peer_id"`  // Peer ID derived from the mnemonic
+	Threshold int    `json:"m"`        // Shares needed to recover
+	Total     int    `json:"n"`        // Shares issued
+	Index     int    `json:"i"`        // x coordinate, 1..Total
+	Checksum  string `json:"checksum"` // Truncated hash of the mnemonic
+	Data      []byte `json:"data"`     // y coordinates, one per mnemonic byte
+}
+
+// String encodes the share as a single line of text, suitable for printing
+// or a QR code.
+func (s MnemonicShare) String() string {
+	data, _ := json.Marshal(s)
+	return MnemonicSharePrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseMnemonicShare decodes a share produced by MnemonicShare.String.
+func ParseMnemonicShare(text string) (MnemonicShare, error) {
+	var s MnemonicShare
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, MnemonicSharePrefix) {
+		return s, fmt.Errorf("%w: missing %q prefix", ErrInvalidShare, MnemonicSharePrefix)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, MnemonicSharePrefix))
+	if err != nil {
+		return s, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	return s, s.validate()
+}
+
+func (s MnemonicShare) validate() error {
+	switch {
+	case s.Version != 1:
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidShare, s.Version)
+	case s.Threshold < 2 || s.Threshold > s.Total || s.Total > MaxShares:
+		return fmt.Errorf("%w: bad threshold %d of %d", ErrInvalidShare, s.Threshold, s.Total)
+	case s.Index < 1 || s.Index > s.Total:
+		return fmt.Errorf("%w: bad index %d", ErrInvalidShare, s.Index)
+	case s.SetID == "" || len(s.Data) == 0:
+		return fmt.Errorf("%w: missing set ID or data", ErrInvalidShare)
+	}
+	return nil
+}
+
+func mnemonicChecksum(mnemonic []byte) string {
+	h := sha256.Sum256(append([]byte("sdn-mnemonic-share\n"), mnemonic...))
+	return hex.EncodeToString(h[:4])
+}
+
+// SplitMnemonic splits mnemonic into total shares, any threshold of which
+// recover it. peerID is the identity the mnemonic derives and is recorded in
+// every share.
+func SplitMnemonic(mnemonic, peerID string, threshold, total int) ([]MnemonicShare, error) {
+	secret := []byte(strings.Join(strings.Fields(mnemonic), " "))
+	if len(secret) == 0 {
+		return nil, ErrInvalidMnemonic
+	}
+	if threshold < 2 || threshold > total || total > MaxShares {
+		return nil, fmt.Errorf("threshold must be between 2 and the share count (at most %d), got %d of %d", MaxShares, threshold, total)
+	}
+
+	setID := make([]byte, shareSetIDSize)
+	if _, err := rand.Read(setID); err != nil {
+		return nil, fmt.Errorf("generate share set ID: %w", err)
+	}
+	ys, err := splitSecret(secret, threshold, total)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]MnemonicShare, total)
+	for i := range shares {
+		shares[i] = MnemonicShare{
+			Version:   1,
+			SetID:     hex.EncodeToString(setID),
+			PeerID:    peerID,
+			Threshold: threshold,
+			Total:     total,
+			Index:     i + 1,
+			Checksum:  mnemonicChecksum(secret),
+			Data:      ys[i],
+		}
+	}
+	log.Infof("Split mnemonic into %d shares with threshold %d", total, threshold)
+	return shares, nil
+}
+
+// CombineMnemonicShares reconstructs a mnemonic from at least threshold
+// shares of the same split. Duplicate shares are ignored.
+func CombineMnemonicShares(shares []MnemonicShare) (string, error) {
+	if len(shares) == 0 {
+		return "", ErrInsufficientShares
+	}
+	first := shares[0]
+	seen := make(map[int]bool)
+	var xs []byte
+	var ys [][]byte
+	for _, s := range shares {
+		if err := s.validate(); err != nil {
+			return "", err
+		}
+		if s.SetID != first.SetID || s.PeerID != first.PeerID || s.Threshold != first.Threshold ||
+			s.Total != first.Total || s.Checksum != first.Checksum || len(s.Data) != len(first.Data) {
+			return "", ErrShareMismatch
+		}
+		if seen[s.Index] {
+			continue
+		}
+		seen[s.Index] = true
+		xs = append(xs, byte(s.Index))
+		ys = append(ys, s.Data)
+	}
+	if len(xs) < first.Threshold {
+		return "", fmt.Errorf("%w: have %d, need %d", ErrInsufficientShares, len(xs), first.Threshold)
+	}
+
+	secret := combineSecret(xs[:first.Threshold], ys[:first.Threshold])
+	if mnemonicChecksum(secret) != first.Checksum {
+		return "", fmt.Errorf("%w: checksum mismatch", ErrShareMismatch)
+	}
+	return string(secret), nil
+}
+
+// splitSecret returns n shares of secret, evaluating a random polynomial of
+// degree threshold-1 per byte at x = 1..n.
+func splitSecret(secret []byte, threshold, n int) ([][]byte, error) {
+	coeffs := make([]byte, threshold)
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	for b, s := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("generate share polynomial: %w", err)
+		}
+		coeffs[0] = s
+		for i := range shares {
+			shares[i][b] = gfEval(coeffs, byte(i+1))
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+	return shares, nil
+}
+
+// combineSecret interpolates the shares at x = 0.
+func combineSecret(xs []byte, ys [][]byte) []byte {
+	secret := make([]byte, len(ys[0]))
+	for i, xi := range xs {
+		// Lagrange basis polynomial for xi, evaluated at 0
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(ys[i][b], basis)
+		}
+	}
+	return secret
+}
+
+// GF(2^8) arithmetic with the AES polynomial x^8+x^4+x^3+x+1.
+var gfExp, gfLog = func() (exp [510]byte, lg [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		lg[x] = byte(i)
+		// multiply by the generator 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfEval evaluates the polynomial with coefficients coeffs at x.
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
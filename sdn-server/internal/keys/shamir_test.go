@@ -0,0 +1,135 @@
+package keys
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+const testMnemonic = "abandon ability able about above absent absorb abstract absurd abuse access accident " +
+	"account accuse achieve acid acoustic acquire across act action actor actress actual"
+
+func TestSplitMnemonicAnyThreshold(t *testing.T) {
+	shares, err := SplitMnemonic(testMnemonic, "12D3KooWTestPeer", 3, 5)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	// Every 3-of-5 combination recovers the mnemonic
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got, err := CombineMnemonicShares([]MnemonicShare{shares[c], shares[a], shares[b]})
+				if err != nil {
+					t.Fatalf("Combine shares %d,%d,%d: %v", a+1, b+1, c+1, err)
+				}
+				if got != testMnemonic {
+					t.Fatalf("Shares %d,%d,%d recovered the wrong mnemonic", a+1, b+1, c+1)
+				}
+			}
+		}
+	}
+
+	// Duplicates do not count towards the threshold
+	if _, err := CombineMnemonicShares([]MnemonicShare{shares[0], shares[1], shares[1]}); !errors.Is(err, ErrInsufficientShares) {
+		t.Errorf("Expected ErrInsufficientShares with a duplicate share, got %v", err)
+	}
+}
+
+func TestSplitMnemonicRejectsBadInput(t *testing.T) {
+	if _, err := SplitMnemonic(testMnemonic, "", 1, 3); err == nil {
+		t.Error("Threshold of 1 should be rejected")
+	}
+	if _, err := SplitMnemonic(testMnemonic, "", 4, 3); err == nil {
+		t.Error("Threshold above share count should be rejected")
+	}
+	if _, err := SplitMnemonic("  ", "", 2, 3); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Errorf("Expected ErrInvalidMnemonic for an empty mnemonic, got %v", err)
+	}
+}
+
+func TestMnemonicShareTextRoundTrip(t *testing.T) {
+	shares, err := SplitMnemonic(testMnemonic, "12D3KooWTestPeer", 2, 3)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+	parsed, err := ParseMnemonicShare(shares[2].String())
+	if err != nil {
+		t.Fatalf("Failed to parse share: %v", err)
+	}
+	if parsed.Index != 3 || parsed.PeerID != "12D3KooWTestPeer" || parsed.SetID != shares[2].SetID {
+		t.Errorf("Parsed share does not match: %+v", parsed)
+	}
+
+	// Shares from different splits cannot be mixed
+	other, err := SplitMnemonic(testMnemonic, "12D3KooWTestPeer", 2, 3)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+	if _, err := CombineMnemonicShares([]MnemonicShare{shares[0], other[1]}); !errors.Is(err, ErrShareMismatch) {
+		t.Errorf("Expected ErrShareMismatch, got %v", err)
+	}
+
+	// A corrupted share is caught by the checksum
+	bad := shares[1]
+	bad.Data = append([]byte{}, bad.Data...)
+	bad.Data[0] ^= 0xff
+	if _, err := CombineMnemonicShares([]MnemonicShare{shares[0], bad}); !errors.Is(err, ErrShareMismatch) {
+		t.Errorf("Expected ErrShareMismatch for a corrupted share, got %v", err)
+	}
+
+	if _, err := ParseMnemonicShare("not a share"); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Expected ErrInvalidShare, got %v", err)
+	}
+}
+
+func TestEncryptShareToCustodian(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sdn-keys-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	custodian, err := NewManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	identity, err := custodian.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	shares, err := SplitMnemonic(testMnemonic, "12D3KooWTestPeer", 2, 2)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+	enc, err := EncryptShare(shares[0], identity.EncryptionKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encrypt share: %v", err)
+	}
+
+	opened, err := custodian.DecryptShare(enc)
+	if err != nil {
+		t.Fatalf("Custodian failed to decrypt share: %v", err)
+	}
+	if opened.String() != shares[0].String() {
+		t.Error("Decrypted share does not match the original")
+	}
+
+	// Another key cannot open the share
+	wrong := make([]byte, X25519KeySize)
+	wrong[0] = 1
+	if _, err := DecryptShare(enc, wrong); !errors.Is(err, ErrShareDecryption) {
+		t.Errorf("Expected ErrShareDecryption with the wrong key, got %v", err)
+	}
+
+	// The readable fields are authenticated
+	tampered := *enc
+	tampered.Index = 2
+	if _, err := custodian.DecryptShare(&tampered); !errors.Is(err, ErrShareDecryption) {
+		t.Errorf("Expected ErrShareDecryption for a tampered share, got %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package license
 
 import (
-	"crypto/ed25519"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
@@ -13,12 +12,15 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 )
 
 // APIHandler exposes minimal HTTP APIs for token verification and entitlement management.
 type APIHandler struct {
 	service  *Service
 	verifier *TokenVerifier
+	audit    *audit.Logger
 }
 
 // NewAPIHandler creates a new license API handler.
@@ -32,6 +34,14 @@ func NewAPIHandler(service *Service) *APIHandler {
 	}
 }
 
+// SetAuditLogger records administrative changes to logger.
+func (h *APIHandler) SetAuditLogger(logger *audit.Logger) {
+	if h == nil {
+		return
+	}
+	h.audit = logger
+}
+
 // RegisterRoutes mounts HTTP routes.
 func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
 	if h == nil || mux == nil {
@@ -39,6 +49,16 @@ func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
 	}
 	mux.HandleFunc("/api/v1/license/verify", h.handleVerifyToken)
 	mux.HandleFunc("/api/v1/license/entitlements", h.handleEntitlements)
+	mux.HandleFunc("/api/v1/license/plans", h.handlePlans)
+	mux.HandleFunc("/api/v1/license/keys", h.handleIssuerKeys)
+	mux.HandleFunc("/api/v1/license/keys/rotate", h.handleRotateKey)
+	mux.HandleFunc("/api/v1/license/revocations", h.handleRevocations)
+	mux.HandleFunc("/api/v1/license/trust", h.handleTrust)
+	mux.HandleFunc("/api/v1/license/trust/", h.handleTrustedIssuer)
+	mux.HandleFunc("/api/v1/license/publishers", h.handlePublishers)
+	mux.HandleFunc("/api/v1/license/publishers/", h.handlePublisher)
+	mux.HandleFunc("/api/v1/license/stripe/webhook", h.handleStripeWebhook)
+	mux.HandleFunc("/api/v1/license/stripe/reconcile", h.handleStripeReconcile)
 	mux.HandleFunc("/api/v1/plugins/manifest", h.handlePluginManifest)
 	mux.HandleFunc("/api/v1/plugins/", h.handlePluginRoute)
 }
@@ -64,7 +84,9 @@ func (h *APIHandler) handleVerifyToken(w http.ResponseWriter, r *http.Request) {
 	writeLicenseJSON(w, http.StatusOK, claims)
 }
 
-func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request) {
+// requireAdminToken checks the X-License-Admin-Token header against
+// SDN_LICENSE_ADMIN_TOKEN and writes an error response if it does not match.
+func requireAdminToken(w http.ResponseWriter, r *http.Request) bool {
 	adminToken := strings.TrimSpace(os.Getenv("SDN_LICENSE_ADMIN_TOKEN"))
 	if adminToken == "" {
 		writeLicenseJSON(w, http.StatusServiceUnavailable, ErrorResponse{
@@ -72,7 +94,7 @@ func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request)
 			Code:    "admin_token_missing",
 			Message: "SDN_LICENSE_ADMIN_TOKEN is not configured",
 		})
-		return
+		return false
 	}
 	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(r.Header.Get("X-License-Admin-Token"))), []byte(adminToken)) != 1 {
 		writeLicenseJSON(w, http.StatusUnauthorized, ErrorResponse{
@@ -80,6 +102,414 @@ func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request)
 			Code:    "unauthorized",
 			Message: "invalid admin token",
 		})
+		return false
+	}
+	return true
+}
+
+// entitlementView is an entitlement together with the scopes its plan
+// currently grants.
+type entitlementView struct {
+	Entitlement
+	Scopes []string `json:"scopes"`
+}
+
+func (h *APIHandler) entitlementView(ent *Entitlement) entitlementView {
+	return entitlementView{Entitlement: *ent, Scopes: h.service.EffectiveScopes(ent.Plan)}
+}
+
+func (h *APIHandler) handlePlans(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeLicenseJSON(w, http.StatusOK, h.service.PlanPolicy())
+	case http.MethodPut:
+		var policy PlanPolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_json", Message: "invalid plan policy payload"})
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+			return
+		}
+		before := h.service.PlanPolicy()
+		if err := h.service.SetPlanPolicy(policy); err != nil {
+			writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
+			return
+		}
+		after := h.service.PlanPolicy()
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeLicensePolicy,
+			TargetType:  "plan_policy",
+			Description: "Plan policy updated",
+			Before:      before,
+			After:       after,
+		})
+		writeLicenseJSON(w, http.StatusOK, after)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIHandler) handleIssuerKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":     h.verifier.Issuer(),
+		"keys":       h.service.IssuerKeys(),
+		"descriptor": h.service.IssuerDescriptor().Encode(),
+	})
+}
+
+func (h *APIHandler) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdminToken(w, r) {
+		return
+	}
+	var req struct {
+		OverlapSeconds int64 `json:"overlap_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OverlapSeconds < 0 {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_json", Message: "invalid rotation payload"})
+			return
+		}
+	}
+	before := h.service.IssuerKeys()
+	key, err := h.service.RotateSigningKey(time.Duration(req.OverlapSeconds) * time.Second)
+	if err != nil {
+		writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
+		return
+	}
+	keys := h.service.IssuerKeys()
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypeLicenseKeyRotate,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "issuer_key",
+		TargetID:    key.KID,
+		Description: fmt.Sprintf("License signing key rotated to %s with %ds overlap", key.KID, req.OverlapSeconds),
+		Before:      before,
+		After:       keys,
+	})
+	writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+		"active": key,
+		"keys":   keys,
+	})
+}
+
+func (h *APIHandler) handleRevocations(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"revocations": h.service.Revocations(),
+		})
+	case http.MethodPost:
+		var req struct {
+			Kind   string `json:"kind"`
+			Value  string `json:"value"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_json", Message: "invalid revocation payload"})
+			return
+		}
+		rev, err := h.service.Revoke(req.Kind, req.Value, req.Reason)
+		if err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeLicenseRevoke,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "revocation",
+			TargetID:    rev.Kind + ":" + rev.Value,
+			Description: fmt.Sprintf("Revoked %s %s", rev.Kind, rev.Value),
+			After:       rev,
+		})
+		writeLicenseJSON(w, http.StatusCreated, rev)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIHandler) handleTrust(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"issuers": h.service.TrustStore().List(),
+		})
+	case http.MethodPost:
+		var req struct {
+			TrustGrant
+			Descriptor string `json:"descriptor"`
+			VCard      string `json:"vcard"`
+			// PeerID names the peer whose EPM publishes the issuer. EPM is
+			// its size-prefixed EPM FlatBuffer (base64) with the announcement
+			// signature; without it the last EPM received from the peer is
+			// used.
+			PeerID       string `json:"peer_id"`
+			EPM          []byte `json:"epm"`
+			EPMSignature string `json:"epm_signature"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, defaultRequestMaxLen)).Decode(&req); err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_json", Message: "invalid trust payload"})
+			return
+		}
+		descriptor, peerID, source := req.Descriptor, "", TrustSourceDescriptor
+		hasCard := strings.TrimSpace(req.VCard) != ""
+		if hasCard || len(req.EPM) > 0 || strings.TrimSpace(req.PeerID) != "" {
+			// EPM and vCard imports take the descriptor the peer's verified
+			// EPM publishes; a vCard only has to agree with it.
+			var err error
+			descriptor, err = h.peerIssuerDescriptor(req.PeerID, req.EPM, req.EPMSignature)
+			if err == nil && hasCard {
+				var fromCard string
+				if fromCard, err = DescriptorFromVCard(req.VCard); err == nil && fromCard != descriptor {
+					err = errors.New("vCard issuer descriptor does not match the peer's EPM")
+				}
+			}
+			if err != nil {
+				writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+				return
+			}
+			peerID, source = strings.TrimSpace(req.PeerID), TrustSourceEPM
+			if hasCard {
+				source = TrustSourceVCard
+			}
+		}
+		req.TrustGrant.Source = source
+		var before interface{}
+		if d, err := ParseIssuerDescriptor(descriptor); err == nil {
+			if prev, ok := h.service.TrustStore().Get(d.Issuer); ok {
+				before = prev
+			}
+		}
+		issuer, err := h.service.trustIssuer(descriptor, peerID, req.TrustGrant)
+		if err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeIssuerTrust,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "issuer",
+			TargetID:    issuer.Issuer,
+			Description: fmt.Sprintf("License issuer %s trusted from %s", issuer.Issuer, source),
+			Before:      before,
+			After:       issuer,
+		})
+		writeLicenseJSON(w, http.StatusCreated, issuer)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// peerIssuerDescriptor verifies peerID's EPM and returns the issuer
+// descriptor it publishes.
+func (h *APIHandler) peerIssuerDescriptor(peerID string, epmData []byte, signatureHex string) (string, error) {
+	attested, err := h.service.VerifyPeerEPM(peerID, epmData, signatureHex)
+	if err != nil {
+		return "", err
+	}
+	return DescriptorFromEPM(attested)
+}
+
+func (h *APIHandler) handleTrustedIssuer(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	issuer := strings.TrimPrefix(r.URL.Path, "/api/v1/license/trust/")
+	if issuer == "" || strings.Contains(issuer, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		t, ok := h.service.TrustStore().Get(issuer)
+		if !ok {
+			writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{Type: msgTypeErrorResponse, Code: "not_found", Message: "issuer not trusted"})
+			return
+		}
+		writeLicenseJSON(w, http.StatusOK, t)
+	case http.MethodDelete:
+		before, _ := h.service.TrustStore().Get(issuer)
+		removed, err := h.service.UntrustIssuer(issuer)
+		if err != nil {
+			writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
+			return
+		}
+		if !removed {
+			writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{Type: msgTypeErrorResponse, Code: "not_found", Message: "issuer not trusted"})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeIssuerTrust,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "issuer",
+			TargetID:    issuer,
+			Description: fmt.Sprintf("License issuer %s no longer trusted", issuer),
+			Before:      before,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIHandler) handlePublishers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"publishers": h.service.PluginPublishers().List(),
+		})
+	case http.MethodPost:
+		var req struct {
+			Publisher
+			// EPM is the peer_id's size-prefixed EPM FlatBuffer (base64)
+			// with its announcement signature; without it the last EPM
+			// received from the peer is used.
+			EPM          []byte `json:"epm"`
+			EPMSignature string `json:"epm_signature"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, defaultRequestMaxLen)).Decode(&req); err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_json", Message: "invalid publisher payload"})
+			return
+		}
+		p := req.Publisher
+		p.Source, p.PeerID = PublisherSourceConfig, ""
+		if len(req.EPM) > 0 || strings.TrimSpace(req.PeerID) != "" {
+			attested, err := h.service.VerifyPeerEPM(req.PeerID, req.EPM, req.EPMSignature)
+			var fromEPM Publisher
+			if err == nil {
+				fromEPM, err = PublisherFromEPM(attested)
+			}
+			if err != nil {
+				writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+				return
+			}
+			fromEPM.Plugins = req.Plugins
+			p = fromEPM
+		}
+		var before interface{}
+		if prev, ok := h.service.PluginPublishers().Get(p.PublicKeyHex); ok {
+			before = prev
+		}
+		p, err := h.service.PluginPublishers().Put(p)
+		if err != nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePublisherChange,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "publisher",
+			TargetID:    p.PublicKeyHex,
+			Description: fmt.Sprintf("Plugin publisher %s allowed", p.Name),
+			Before:      before,
+			After:       p,
+		})
+		writeLicenseJSON(w, http.StatusCreated, p)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIHandler) handlePublisher(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/api/v1/license/publishers/")
+	if key == "" || strings.Contains(key, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	before, _ := h.service.PluginPublishers().Get(key)
+	removed, err := h.service.PluginPublishers().Remove(key)
+	if err != nil {
+		writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
+		return
+	}
+	if !removed {
+		writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{Type: msgTypeErrorResponse, Code: "not_found", Message: "publisher not listed"})
+		return
+	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePublisherChange,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "publisher",
+		TargetID:    before.PublicKeyHex,
+		Description: fmt.Sprintf("Plugin publisher %s removed", before.Name),
+		Before:      before,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStripeWebhook is authenticated by the Stripe-Signature header rather
+// than the admin token.
+func (h *APIHandler) handleStripeWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxStripeWebhookBytes+1))
+	if err != nil || len(payload) > maxStripeWebhookBytes {
+		writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: "invalid webhook payload"})
+		return
+	}
+	result, err := h.service.HandleStripeWebhook(r.Header.Get("Stripe-Signature"), payload)
+	switch {
+	case errors.Is(err, ErrStripeUnmatched):
+		// Acknowledge so Stripe stops retrying; reconciliation cannot help
+		// until the subscription is linked to an xpub.
+		log.Warnf("Stripe webhook: %v", err)
+		writeLicenseJSON(w, http.StatusOK, StripeSyncResult{Ignored: true, Reason: err.Error()})
+	case err != nil:
+		writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: err.Error()})
+	default:
+		writeLicenseJSON(w, http.StatusOK, result)
+	}
+}
+
+func (h *APIHandler) handleStripeReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdminToken(w, r) {
+		return
+	}
+	result, err := h.service.ReconcileStripe(r.Context())
+	if err != nil {
+		writeLicenseJSON(w, http.StatusServiceUnavailable, ErrorResponse{Type: msgTypeErrorResponse, Code: "stripe_unavailable", Message: err.Error()})
+		return
+	}
+	writeLicenseJSON(w, http.StatusOK, result)
+}
+
+func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request) {
+	if !requireAdminToken(w, r) {
 		return
 	}
 
@@ -99,7 +529,7 @@ func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request)
 			writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{Type: msgTypeErrorResponse, Code: "not_found", Message: "entitlement not found"})
 			return
 		}
-		writeLicenseJSON(w, http.StatusOK, ent)
+		writeLicenseJSON(w, http.StatusOK, h.entitlementView(ent))
 	case http.MethodPost, http.MethodPut:
 		var ent Entitlement
 		if err := json.NewDecoder(r.Body).Decode(&ent); err != nil {
@@ -120,13 +550,16 @@ func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request)
 		}
 		// Validate plan field to prevent arbitrary values.
 		if p := strings.TrimSpace(ent.Plan); p != "" {
-			switch p {
-			case "free", "starter", "pro", "enterprise":
-			default:
-				writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: "invalid plan value"})
+			if policy := h.service.PlanPolicy(); !policy.HasPlan(p) {
+				writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{Type: msgTypeErrorResponse, Code: "invalid_request", Message: "invalid plan value (allowed: " + strings.Join(policy.PlanNames(), ", ") + ")"})
 				return
 			}
 		}
+		prev, err := h.service.GetEntitlement(ent.XPub)
+		if err != nil {
+			writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
+			return
+		}
 		if err := h.service.UpsertEntitlement(&ent); err != nil {
 			writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: err.Error()})
 			return
@@ -136,7 +569,19 @@ func (h *APIHandler) handleEntitlements(w http.ResponseWriter, r *http.Request)
 			writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: "failed to reload entitlement"})
 			return
 		}
-		writeLicenseJSON(w, http.StatusOK, updated)
+		var before interface{}
+		if prev != nil {
+			before = prev
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeEntitlement,
+			TargetType:  "entitlement",
+			TargetID:    updated.XPub,
+			Description: fmt.Sprintf("Entitlement for %s set to plan %q (%s)", updated.XPub, updated.Plan, updated.Status),
+			Before:      before,
+			After:       updated,
+		})
+		writeLicenseJSON(w, http.StatusOK, h.entitlementView(updated))
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -366,14 +811,21 @@ func isTokenError(err error) bool {
 		errors.Is(err, ErrTokenExpired) ||
 		errors.Is(err, ErrTokenIssuerMismatch) ||
 		errors.Is(err, ErrTokenPeerIDMismatch) ||
-		errors.Is(err, ErrTokenMissingScope)
+		errors.Is(err, ErrTokenMissingScope) ||
+		errors.Is(err, ErrTokenRevoked) ||
+		errors.Is(err, ErrUnknownSigningKey) ||
+		errors.Is(err, ErrIssuerNotTrusted)
 }
 
-// UploadHandler handles signed WASM plugin uploads.
+// UploadHandler handles signed WASM plugin uploads. The publisher signs the
+// canonical PluginManifest of the bundle with a key on the allow-list.
 type UploadHandler struct {
 	reg         *PluginRegistry
 	keyLookup   func(xpub string) (string, error)    // returns signing_pubkey_hex
 	xpubFromReq func(r *http.Request) (string, error) // extracts xpub from session
+	onUpload    func(asset *PluginAsset)
+	publishers  *PublisherStore
+	audit       *audit.Logger
 }
 
 // NewUploadHandler creates a handler for plugin uploads.
@@ -381,9 +833,27 @@ func NewUploadHandler(reg *PluginRegistry, keyLookup func(string) (string, error
 	return &UploadHandler{reg: reg, keyLookup: keyLookup, xpubFromReq: xpubFromReq}
 }
 
+// SetOnUpload registers a callback run after a plugin is stored, e.g. to
+// hot-swap the running instance to the new version.
+func (h *UploadHandler) SetOnUpload(fn func(asset *PluginAsset)) {
+	h.onUpload = fn
+}
+
+// SetPublishers sets the allow-list of keys trusted to sign uploads. Without
+// one every upload is refused.
+func (h *UploadHandler) SetPublishers(publishers *PublisherStore) {
+	h.publishers = publishers
+}
+
+// SetAuditLogger records accepted uploads to logger.
+func (h *UploadHandler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
 type uploadMetadata struct {
-	ID      string `json:"id"`
-	Version string `json:"version"`
+	ID           string             `json:"id"`
+	Version      string             `json:"version"`
+	Capabilities PluginCapabilities `json:"capabilities"`
 }
 
 func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -455,61 +925,72 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse signature.
-	sigHex := strings.TrimSpace(r.FormValue("signature_hex"))
-	if sigHex == "" {
-		writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "bad_request", Message: "missing signature_hex field",
-		})
-		return
-	}
-	signature, err := hex.DecodeString(sigHex)
-	if err != nil || len(signature) != ed25519.SignatureSize {
-		writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "bad_request", Message: "signature_hex must be 64-byte Ed25519 signature (128 hex chars)",
+	if h.publishers == nil {
+		writeLicenseJSON(w, http.StatusServiceUnavailable, ErrorResponse{
+			Type: msgTypeErrorResponse, Code: "no_publishers", Message: "no plugin publisher allow-list is configured",
 		})
 		return
 	}
 
-	// Look up signer's bound public key.
-	pubKeyHex, err := h.keyLookup(xpub)
-	if err != nil {
-		writeLicenseJSON(w, http.StatusForbidden, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "forbidden", Message: "user not found",
-		})
-		return
-	}
+	// The signer defaults to the key bound to the uploader's account.
+	pubKeyHex := strings.TrimSpace(r.FormValue("publisher_pubkey_hex"))
 	if pubKeyHex == "" {
-		writeLicenseJSON(w, http.StatusForbidden, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "forbidden", Message: "no signing key bound to this user (login with wallet first)",
-		})
-		return
-	}
-	pubKey, err := hex.DecodeString(pubKeyHex)
-	if err != nil || len(pubKey) != ed25519.PublicKeySize {
-		writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "server_error", Message: "invalid stored signing key",
-		})
-		return
+		if pubKeyHex, err = h.keyLookup(xpub); err != nil {
+			writeLicenseJSON(w, http.StatusForbidden, ErrorResponse{
+				Type: msgTypeErrorResponse, Code: "forbidden", Message: "user not found",
+			})
+			return
+		}
 	}
 
-	// Verify Ed25519 signature over SHA-256(bundle).
+	// Verify the publisher's signature over the canonical manifest.
 	bundleHash := sha256.Sum256(bundleData)
-	if !ed25519.Verify(pubKey, bundleHash[:], signature) {
-		writeLicenseJSON(w, http.StatusForbidden, ErrorResponse{
-			Type: msgTypeErrorResponse, Code: "signature_invalid", Message: "Ed25519 signature verification failed",
+	manifest := PluginManifest{
+		ID:           strings.TrimSpace(meta.ID),
+		Version:      strings.TrimSpace(meta.Version),
+		WasmSHA256:   hex.EncodeToString(bundleHash[:]),
+		Capabilities: meta.Capabilities,
+	}
+	sigHex := strings.TrimSpace(r.FormValue("signature_hex"))
+	publisher, err := h.publishers.Verify(manifest, bundleData, sigHex, pubKeyHex)
+	if err != nil {
+		status, code := http.StatusForbidden, "signature_invalid"
+		switch {
+		case errors.Is(err, ErrUnsignedPlugin):
+			status, code = http.StatusBadRequest, "unsigned_plugin"
+		case errors.Is(err, ErrUntrustedPublisher):
+			code = "untrusted_publisher"
+		}
+		writeLicenseJSON(w, status, ErrorResponse{
+			Type: msgTypeErrorResponse, Code: code, Message: err.Error(),
 		})
 		return
 	}
 
 	// Store the plugin.
-	asset, err := h.reg.AddPlugin(meta.ID, meta.Version, bundleData, sigHex, pubKeyHex)
+	var before interface{}
+	if prev, ok := h.reg.Get(manifest.ID); ok {
+		before = prev.Descriptor()
+	}
+	asset, err := h.reg.AddSignedPlugin(manifest, bundleData, sigHex, publisher)
 	if err != nil {
 		writeLicenseJSON(w, http.StatusInternalServerError, ErrorResponse{
 			Type: msgTypeErrorResponse, Code: "server_error", Message: "failed to store plugin: " + err.Error(),
 		})
 		return
 	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePluginUpload,
+		ActorXPub:   xpub,
+		TargetType:  "plugin",
+		TargetID:    asset.ID,
+		Description: fmt.Sprintf("Plugin %s version %s uploaded, signed by %s", asset.ID, asset.Version, publisher.Name),
+		Before:      before,
+		After:       asset.Descriptor(),
+	})
+	if h.onUpload != nil {
+		h.onUpload(asset)
+	}
 
 	writeLicenseJSON(w, http.StatusCreated, map[string]interface{}{
 		"status":        "ok",
@@ -517,5 +998,6 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"version":       asset.Version,
 		"bundle_sha256": asset.BundleSHA256,
 		"size_bytes":    asset.SizeBytes,
+		"publisher":     asset.Publisher,
 	})
 }
@@ -0,0 +1,232 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultSigningKeyRingFile = "token_signing_keys.json"
+
+// IssuerKey is a token verification key and the window in which tokens signed
+// by it are accepted. Windows of consecutive keys overlap during a rotation:
+// the new key signs from NotBefore while the old one keeps verifying the
+// tokens it already signed until NotAfter.
+type IssuerKey struct {
+	KID          string `json:"kid"`
+	PublicKeyHex string `json:"public_key_hex"`
+	NotBefore    int64  `json:"not_before,omitempty"`
+	// NotAfter is when the key is retired; zero while it is current.
+	NotAfter int64 `json:"not_after,omitempty"`
+}
+
+func (k IssuerKey) publicKey() (ed25519.PublicKey, bool) {
+	raw, err := hex.DecodeString(k.PublicKeyHex)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, false
+	}
+	return ed25519.PublicKey(raw), true
+}
+
+// validFor reports whether a token issued at iat may be verified with the key
+// at now.
+func (k IssuerKey) validFor(iat int64, now time.Time, leeway time.Duration) bool {
+	slack := int64(leeway.Seconds())
+	if k.NotBefore > 0 && iat < k.NotBefore-slack {
+		return false
+	}
+	if k.NotAfter > 0 && (iat > k.NotAfter || now.Unix() > k.NotAfter+slack) {
+		return false
+	}
+	return true
+}
+
+type signingKeyRecord struct {
+	IssuerKey
+	SeedFile string `json:"seed_file"`
+
+	private ed25519.PrivateKey
+}
+
+// signingKeyRing holds the issuer's signing keys. The newest key signs; older
+// keys are kept until their NotAfter so their tokens keep verifying.
+type signingKeyRing struct {
+	mu   sync.RWMutex
+	dir  string
+	path string
+	keys []*signingKeyRecord // oldest first
+}
+
+// loadSigningKeyRing loads the key ring next to legacyKeyPath. Without a ring
+// file the legacy single key becomes the first member.
+func loadSigningKeyRing(legacyKeyPath string) (*signingKeyRing, error) {
+	dir := filepath.Dir(legacyKeyPath)
+	ring := &signingKeyRing{dir: dir, path: filepath.Join(dir, defaultSigningKeyRingFile)}
+
+	data, err := os.ReadFile(ring.path)
+	if os.IsNotExist(err) {
+		priv, err := loadOrCreateEd25519Key(legacyKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = []*signingKeyRecord{newSigningKeyRecord(priv, filepath.Base(legacyKeyPath), 0)}
+		if err := ring.saveLocked(); err != nil {
+			return nil, err
+		}
+		return ring, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key ring: %w", err)
+	}
+
+	var records []*signingKeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("decode signing key ring: %w", err)
+	}
+	for _, rec := range records {
+		if rec.SeedFile != filepath.Base(rec.SeedFile) {
+			return nil, fmt.Errorf("signing key %s has invalid seed path %q", rec.KID, rec.SeedFile)
+		}
+		priv, err := loadOrCreateEd25519Key(filepath.Join(dir, rec.SeedFile))
+		if err != nil {
+			return nil, fmt.Errorf("load signing key %s: %w", rec.KID, err)
+		}
+		if KeyID(priv.Public().(ed25519.PublicKey)) != rec.KID {
+			return nil, fmt.Errorf("signing key %s does not match %s", rec.KID, rec.SeedFile)
+		}
+		rec.private = priv
+	}
+	if len(records) == 0 {
+		return nil, errors.New("signing key ring is empty")
+	}
+	ring.keys = records
+	return ring, nil
+}
+
+func newSigningKeyRecord(priv ed25519.PrivateKey, seedFile string, notBefore int64) *signingKeyRecord {
+	pub := priv.Public().(ed25519.PublicKey)
+	return &signingKeyRecord{
+		IssuerKey: IssuerKey{
+			KID:          KeyID(pub),
+			PublicKeyHex: hex.EncodeToString(pub),
+			NotBefore:    notBefore,
+		},
+		SeedFile: seedFile,
+		private:  priv,
+	}
+}
+
+func (r *signingKeyRing) saveLocked() error {
+	data, err := json.MarshalIndent(r.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("write signing key ring: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// active returns the key used to sign new tokens.
+func (r *signingKeyRing) active() (string, ed25519.PrivateKey) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec := r.keys[len(r.keys)-1]
+	return rec.KID, rec.private
+}
+
+// verificationKeys returns the public half of every key still in the ring.
+func (r *signingKeyRing) verificationKeys() []IssuerKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]IssuerKey, 0, len(r.keys))
+	for _, rec := range r.keys {
+		out = append(out, rec.IssuerKey)
+	}
+	return out
+}
+
+// rotate adds a new signing key and retires the current one after overlap.
+// Keys whose window has closed are dropped and their seeds deleted.
+func (r *signingKeyRing) rotate(now time.Time, overlap time.Duration) (IssuerKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seedFile := fmt.Sprintf("token_signing_%d.seed", now.UnixNano())
+	priv, err := loadOrCreateEd25519Key(filepath.Join(r.dir, seedFile))
+	if err != nil {
+		return IssuerKey{}, err
+	}
+	next := newSigningKeyRecord(priv, seedFile, now.Unix())
+
+	prev := r.keys
+	retireAt := now.Add(overlap).Unix()
+	var kept []*signingKeyRecord
+	var dropped []*signingKeyRecord
+	for _, rec := range prev {
+		cp := *rec
+		if cp.NotAfter == 0 {
+			cp.NotAfter = retireAt
+		}
+		if cp.NotAfter < now.Unix() {
+			dropped = append(dropped, rec)
+			continue
+		}
+		kept = append(kept, &cp)
+	}
+	r.keys = append(kept, next)
+	if err := r.saveLocked(); err != nil {
+		r.keys = prev
+		_ = os.Remove(filepath.Join(r.dir, seedFile))
+		return IssuerKey{}, err
+	}
+	for _, rec := range dropped {
+		if err := os.Remove(filepath.Join(r.dir, rec.SeedFile)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove retired signing key %s: %v", rec.KID, err)
+		}
+	}
+	return next.IssuerKey, nil
+}
+
+// IssuerKeys returns the keys that verify this service's tokens, newest last.
+func (s *Service) IssuerKeys() []IssuerKey {
+	return s.keys.verificationKeys()
+}
+
+// RotateSigningKey starts signing tokens with a new key. The previous key
+// keeps verifying for overlap, which is raised to the longest token TTL so
+// no token outlives the key that signed it.
+func (s *Service) RotateSigningKey(overlap time.Duration) (IssuerKey, error) {
+	if minOverlap := s.maxTokenTTL() + defaultVerifyLeeway; overlap < minOverlap {
+		overlap = minOverlap
+	}
+	key, err := s.keys.rotate(time.Now().UTC(), overlap)
+	if err != nil {
+		return IssuerKey{}, fmt.Errorf("rotate signing key: %w", err)
+	}
+	s.verifier.SetKeys(s.keys.verificationKeys())
+	log.Infof("Rotated token signing key to %s; previous key retires in %s", key.KID, overlap)
+
+	s.revokeMu.Lock()
+	onRotate := s.onKeyRotation
+	s.revokeMu.Unlock()
+	if onRotate != nil {
+		onRotate()
+	}
+	return key, nil
+}
+
+// SetOnKeyRotation registers a callback run after the signing key rotates,
+// e.g. to republish the issuer descriptor in the node's EPM.
+func (s *Service) SetOnKeyRotation(fn func()) {
+	s.revokeMu.Lock()
+	defer s.revokeMu.Unlock()
+	s.onKeyRotation = fn
+}
@@ -0,0 +1,207 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRetainedPluginVersions bounds how many inactive versions of a plugin are
+// kept on disk for rollback.
+const maxRetainedPluginVersions = 5
+
+const pluginRuntimeStatusRetained = "retained"
+
+// withVersion returns the catalog state after adding next to prev. Unless
+// prev is pinned, next becomes active and prev is retained. Versions beyond
+// maxRetainedPluginVersions are returned for removal.
+func withVersion(prev, next *PluginAsset) (*PluginAsset, []*PluginAsset) {
+	if prev == nil {
+		return next, nil
+	}
+	if prev.Pinned {
+		active := prev.clone()
+		active.retained = retainVersions(next, prev.retained, prev.Version)
+		return active, pruneRetained(active)
+	}
+
+	old := prev.clone()
+	old.retained = nil
+	old.Pinned = false
+	if old.Version == next.Version {
+		// Re-uploading the active version replaces it in place.
+		old = nil
+	}
+	active := next.clone()
+	active.retained = retainVersions(old, prev.retained, next.Version)
+	return active, pruneRetained(active)
+}
+
+// retainVersions puts head in front of retained, dropping versions equal to
+// head's or to active.
+func retainVersions(head *PluginAsset, retained []*PluginAsset, active string) []*PluginAsset {
+	out := make([]*PluginAsset, 0, len(retained)+1)
+	if head != nil {
+		out = append(out, head)
+	}
+	for _, a := range retained {
+		if a.Version == active || (head != nil && a.Version == head.Version) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func pruneRetained(a *PluginAsset) []*PluginAsset {
+	if len(a.retained) <= maxRetainedPluginVersions {
+		return nil
+	}
+	pruned := a.retained[maxRetainedPluginVersions:]
+	a.retained = a.retained[:maxRetainedPluginVersions:maxRetainedPluginVersions]
+	return pruned
+}
+
+// removeVersionFiles deletes uploaded bundles of pruned versions. Encrypted
+// bundles are provisioned by operators and are left in place.
+func removeVersionFiles(rootPath string, pruned []*PluginAsset) {
+	for _, a := range pruned {
+		if a.plainPath == "" || !strings.HasPrefix(a.plainPath, rootPath+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(a.plainPath); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove pruned plugin %s version %s: %v", a.ID, a.Version, err)
+			continue
+		}
+		// Remove the per-version directory if it is now empty.
+		_ = os.Remove(filepath.Dir(a.plainPath))
+	}
+}
+
+// Versions returns the active version of a plugin followed by its retained
+// versions, newest first.
+func (r *PluginRegistry) Versions(id string) ([]PluginDescriptor, error) {
+	if r == nil {
+		return nil, errors.New("plugin registry is nil")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	asset, ok := r.assets[strings.TrimSpace(id)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	out := []PluginDescriptor{asset.Descriptor()}
+	for _, old := range asset.retained {
+		d := old.Descriptor()
+		d.Status = pluginRuntimeStatusRetained
+		d.StatusMessage = ""
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Activate makes a retained version the active one, retaining the version it
+// replaces. The running instance is not touched; callers reload it.
+func (r *PluginRegistry) Activate(id, version string) (*PluginAsset, error) {
+	if r == nil {
+		return nil, errors.New("plugin registry is nil")
+	}
+	id = strings.TrimSpace(id)
+	version = strings.TrimSpace(version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	asset, ok := r.assets[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if asset.Version == version {
+		return asset.clone(), nil
+	}
+	var target *PluginAsset
+	for _, old := range asset.retained {
+		if old.Version == version {
+			target = old
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("plugin %q has no retained version %q", id, version)
+	}
+
+	prev := asset.clone()
+	prev.retained = nil
+	prev.Pinned = false
+	next := target.clone()
+	next.Pinned = asset.Pinned
+	next.runtimeStatus = ""
+	next.statusMessage = ""
+	next.retained = retainVersions(prev, asset.retained, version)
+
+	r.assets[id] = next
+	if err := r.saveCatalogLocked(); err != nil {
+		r.assets[id] = asset
+		return nil, fmt.Errorf("save catalog: %w", err)
+	}
+	return next.clone(), nil
+}
+
+// SetPinned pins or unpins the active version of a plugin. Uploads to a
+// pinned plugin are retained without becoming active.
+func (r *PluginRegistry) SetPinned(id string, pinned bool) error {
+	if r == nil {
+		return errors.New("plugin registry is nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	asset, ok := r.assets[strings.TrimSpace(id)]
+	if !ok {
+		return os.ErrNotExist
+	}
+	was := asset.Pinned
+	asset.Pinned = pinned
+	if err := r.saveCatalogLocked(); err != nil {
+		asset.Pinned = was
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// Reload re-reads the catalog from disk, picking up changes written by
+// another registry instance. Runtime status is kept for unchanged versions.
+func (r *PluginRegistry) Reload() error {
+	if r == nil {
+		return errors.New("plugin registry is nil")
+	}
+	data, err := os.ReadFile(filepath.Join(r.rootPath, defaultPluginCatalogFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read plugin catalog: %w", err)
+	}
+	var catalog PluginCatalogFile
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("decode plugin catalog: %w", err)
+		}
+	}
+	assets, err := loadCatalogAssets(r.rootPath, catalog)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, asset := range assets {
+		if old, ok := r.assets[id]; ok && old.Version == asset.Version && old.BundleSHA256 == asset.BundleSHA256 {
+			asset.runtimeStatus = old.runtimeStatus
+			asset.statusMessage = old.statusMessage
+		}
+	}
+	r.assets = assets
+	return nil
+}
@@ -0,0 +1,131 @@
+package license
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// PluginVersionManager switches the version a node runs for a catalog plugin.
+type PluginVersionManager interface {
+	PluginVersions(id string) ([]PluginDescriptor, error)
+	ActivatePluginVersion(ctx context.Context, id, version string) error
+	PinPluginVersion(id string, pinned bool) error
+}
+
+// PluginVersionHandler serves the admin API for listing, activating (rolling
+// back) and pinning plugin versions:
+//
+//	GET  /api/admin/plugins/{id}/versions
+//	POST /api/admin/plugins/{id}/activate  {"version": "1.2.0"}
+//	POST /api/admin/plugins/{id}/pin       {"pinned": true}
+type PluginVersionHandler struct {
+	mgr PluginVersionManager
+}
+
+// NewPluginVersionHandler creates the plugin version admin API.
+func NewPluginVersionHandler(mgr PluginVersionManager) *PluginVersionHandler {
+	return &PluginVersionHandler{mgr: mgr}
+}
+
+// RegisterRoutes mounts the plugin version routes.
+func (h *PluginVersionHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/admin/plugins/", h.ServeHTTP)
+}
+
+func (h *PluginVersionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/plugins/"), "/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || !pluginIDPattern.MatchString(parts[0]) {
+		writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{
+			Type: msgTypeErrorResponse, Code: "not_found", Message: "unknown plugin route",
+		})
+		return
+	}
+	pluginID, action := parts[0], parts[1]
+
+	switch action {
+	case "versions":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		versions, err := h.mgr.PluginVersions(pluginID)
+		if err != nil {
+			writePluginVersionError(w, err)
+			return
+		}
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"plugin_id": pluginID,
+			"versions":  versions,
+		})
+
+	case "activate":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Version string `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Version) == "" {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{
+				Type: msgTypeErrorResponse, Code: "bad_request", Message: "version is required",
+			})
+			return
+		}
+		if err := h.mgr.ActivatePluginVersion(r.Context(), pluginID, req.Version); err != nil {
+			writePluginVersionError(w, err)
+			return
+		}
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"status":    "ok",
+			"plugin_id": pluginID,
+			"version":   strings.TrimSpace(req.Version),
+		})
+
+	case "pin":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Pinned *bool `json:"pinned"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pinned == nil {
+			writeLicenseJSON(w, http.StatusBadRequest, ErrorResponse{
+				Type: msgTypeErrorResponse, Code: "bad_request", Message: "pinned is required",
+			})
+			return
+		}
+		if err := h.mgr.PinPluginVersion(pluginID, *req.Pinned); err != nil {
+			writePluginVersionError(w, err)
+			return
+		}
+		writeLicenseJSON(w, http.StatusOK, map[string]interface{}{
+			"status":    "ok",
+			"plugin_id": pluginID,
+			"pinned":    *req.Pinned,
+		})
+
+	default:
+		writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{
+			Type: msgTypeErrorResponse, Code: "not_found", Message: "unknown plugin route",
+		})
+	}
+}
+
+func writePluginVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, os.ErrNotExist) {
+		writeLicenseJSON(w, http.StatusNotFound, ErrorResponse{
+			Type: msgTypeErrorResponse, Code: "not_found", Message: "plugin not found",
+		})
+		return
+	}
+	writeLicenseJSON(w, http.StatusConflict, ErrorResponse{
+		Type: msgTypeErrorResponse, Code: "plugin_version_error", Message: err.Error(),
+	})
+}
@@ -0,0 +1,60 @@
+package license
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type fakeVersionManager struct {
+	activated string
+	pinned    *bool
+}
+
+func (f *fakeVersionManager) PluginVersions(id string) ([]PluginDescriptor, error) {
+	if id != "demo" {
+		return nil, os.ErrNotExist
+	}
+	return []PluginDescriptor{{ID: id, Version: "2.0.0"}, {ID: id, Version: "1.0.0", Status: "retained"}}, nil
+}
+
+func (f *fakeVersionManager) ActivatePluginVersion(_ context.Context, _ string, version string) error {
+	f.activated = version
+	return nil
+}
+
+func (f *fakeVersionManager) PinPluginVersion(_ string, pinned bool) error {
+	f.pinned = &pinned
+	return nil
+}
+
+func TestPluginVersionHandler(t *testing.T) {
+	mgr := &fakeVersionManager{}
+	mux := http.NewServeMux()
+	NewPluginVersionHandler(mgr).RegisterRoutes(mux)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/admin/plugins/demo/versions", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"1.0.0"`) {
+		t.Fatalf("versions: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/admin/plugins/missing/versions", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("versions of unknown plugin: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/admin/plugins/demo/activate", `{"version":"1.0.0"}`); rec.Code != http.StatusOK || mgr.activated != "1.0.0" {
+		t.Fatalf("activate: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/admin/plugins/demo/activate", `{}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("activate without version: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/admin/plugins/demo/pin", `{"pinned":true}`); rec.Code != http.StatusOK || mgr.pinned == nil || !*mgr.pinned {
+		t.Fatalf("pin: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -94,6 +94,16 @@ type PluginCatalogEntry struct {
 	SignatureHex    string `json:"signature_hex,omitempty"`
 	SignerPubKeyHex string `json:"signer_pubkey_hex,omitempty"`
 	UploadedAt      string `json:"uploaded_at,omitempty"`
+
+	// Publisher and Capabilities come from the signed upload manifest.
+	Publisher    string              `json:"publisher,omitempty"`
+	Capabilities *PluginCapabilities `json:"capabilities,omitempty"`
+
+	// Pinned keeps the active version when new versions are uploaded.
+	Pinned bool `json:"pinned,omitempty"`
+	// Retained lists inactive versions kept on disk for rollback, newest
+	// first. Their id fields are ignored.
+	Retained []PluginCatalogEntry `json:"retained_versions,omitempty"`
 }
 
 // PluginDescriptor is safe to return publicly (no key path information).
@@ -108,8 +118,13 @@ type PluginDescriptor struct {
 	SignatureHex    string `json:"signature_hex,omitempty"`
 	SignerPubKeyHex string `json:"signer_pubkey_hex,omitempty"`
 	UploadedAt      string `json:"uploaded_at,omitempty"`
+	Pinned          bool   `json:"pinned,omitempty"`
 	Status          string `json:"status"`
 	StatusMessage   string `json:"status_message,omitempty"`
+
+	// Publisher names the allow-listed publisher that signed the upload.
+	Publisher    string              `json:"publisher,omitempty"`
+	Capabilities *PluginCapabilities `json:"capabilities,omitempty"`
 }
 
 // PluginAsset is an in-memory validated plugin metadata record.
@@ -124,10 +139,14 @@ type PluginAsset struct {
 	SignatureHex    string
 	SignerPubKeyHex string
 	UploadedAt      string
+	Pinned          bool
+	Publisher       string
+	Capabilities    *PluginCapabilities
 
 	encryptedPath string
 	keyPath       string
 	plainPath     string
+	retained      []*PluginAsset
 
 	runtimeStatus string
 	statusMessage string
@@ -138,6 +157,7 @@ func (a *PluginAsset) clone() *PluginAsset {
 		return nil
 	}
 	cp := *a
+	cp.retained = append([]*PluginAsset(nil), a.retained...)
 	return &cp
 }
 
@@ -157,8 +177,11 @@ func (a *PluginAsset) Descriptor() PluginDescriptor {
 		SignatureHex:    a.SignatureHex,
 		SignerPubKeyHex: a.SignerPubKeyHex,
 		UploadedAt:      a.UploadedAt,
+		Pinned:          a.Pinned,
 		Status:          status,
 		StatusMessage:   strings.TrimSpace(a.statusMessage),
+		Publisher:       a.Publisher,
+		Capabilities:    a.Capabilities,
 	}
 }
 
@@ -282,15 +305,33 @@ func LoadPluginRegistry(rootPath string) (*PluginRegistry, error) {
 		return nil, fmt.Errorf("decode plugin catalog: %w", err)
 	}
 
+	assets, err := loadCatalogAssets(rootAbs, catalog)
+	if err != nil {
+		return nil, err
+	}
+	reg.assets = assets
+	return reg, nil
+}
+
+func loadCatalogAssets(rootAbs string, catalog PluginCatalogFile) (map[string]*PluginAsset, error) {
+	assets := make(map[string]*PluginAsset, len(catalog.Plugins))
 	for _, entry := range catalog.Plugins {
 		asset, err := validateCatalogEntry(rootAbs, entry)
 		if err != nil {
 			return nil, fmt.Errorf("plugin %q invalid: %w", entry.ID, err)
 		}
-		reg.assets[asset.ID] = asset
+		asset.Pinned = entry.Pinned
+		for _, retained := range entry.Retained {
+			retained.ID = asset.ID
+			old, err := validateCatalogEntry(rootAbs, retained)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %q version %q invalid: %w", entry.ID, retained.Version, err)
+			}
+			asset.retained = append(asset.retained, old)
+		}
+		assets[asset.ID] = asset
 	}
-
-	return reg, nil
+	return assets, nil
 }
 
 // Count returns the number of configured plugin assets.
@@ -688,6 +729,8 @@ func validateCatalogEntry(rootAbs string, entry PluginCatalogEntry) (*PluginAsse
 		SignatureHex:    entry.SignatureHex,
 		SignerPubKeyHex: entry.SignerPubKeyHex,
 		UploadedAt:      entry.UploadedAt,
+		Publisher:       entry.Publisher,
+		Capabilities:    entry.Capabilities,
 	}
 
 	// Plain (uploaded) plugins have plain_path; encrypted have encrypted_path + key_path.
@@ -746,24 +789,57 @@ func validateCatalogEntry(rootAbs string, entry PluginCatalogEntry) (*PluginAsse
 	return asset, nil
 }
 
-// AddPlugin writes a plain (unencrypted) WASM bundle to the registry.
+// AddPlugin writes a plain (unencrypted) WASM bundle to the registry. Each
+// version is stored in its own directory and becomes the active version
+// unless the plugin is pinned; the previously active version is retained for
+// rollback.
 func (r *PluginRegistry) AddPlugin(id, version string, wasmData []byte, signatureHex, signerPubKeyHex string) (*PluginAsset, error) {
-	id = strings.TrimSpace(id)
+	return r.addPlugin(&PluginAsset{
+		ID:              id,
+		Version:         version,
+		SignatureHex:    signatureHex,
+		SignerPubKeyHex: signerPubKeyHex,
+	}, wasmData)
+}
+
+// AddSignedPlugin stores a bundle whose manifest was verified against the
+// publisher allow-list, recording the publisher and declared capabilities.
+func (r *PluginRegistry) AddSignedPlugin(m PluginManifest, wasmData []byte, signatureHex string, publisher Publisher) (*PluginAsset, error) {
+	caps := m.Capabilities.canonical()
+	return r.addPlugin(&PluginAsset{
+		ID:              m.ID,
+		Version:         m.Version,
+		SignatureHex:    strings.ToLower(strings.TrimSpace(signatureHex)),
+		SignerPubKeyHex: publisher.PublicKeyHex,
+		Publisher:       publisher.Name,
+		Capabilities:    &caps,
+	}, wasmData)
+}
+
+func (r *PluginRegistry) addPlugin(asset *PluginAsset, wasmData []byte) (*PluginAsset, error) {
+	id := strings.TrimSpace(asset.ID)
 	if id == "" {
 		return nil, errors.New("plugin id is required")
 	}
 	if !pluginIDPattern.MatchString(id) {
 		return nil, errors.New("plugin id contains invalid characters")
 	}
-	version = strings.TrimSpace(version)
+	version := strings.TrimSpace(asset.Version)
 	if version == "" {
 		return nil, errors.New("version is required")
 	}
+	if !pluginIDPattern.MatchString(version) {
+		return nil, errors.New("version contains invalid characters")
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	pluginDir := filepath.Join(r.rootPath, id)
+	if prev, ok := r.assets[id]; ok && prev.Pinned && prev.Version == version {
+		return nil, fmt.Errorf("plugin %q is pinned to version %q", id, version)
+	}
+
+	pluginDir := filepath.Join(r.rootPath, id, version)
 	if err := os.MkdirAll(pluginDir, 0700); err != nil {
 		return nil, fmt.Errorf("create plugin directory: %w", err)
 	}
@@ -775,27 +851,30 @@ func (r *PluginRegistry) AddPlugin(id, version string, wasmData []byte, signatur
 
 	h := sha256.Sum256(wasmData)
 
-	asset := &PluginAsset{
-		ID:              id,
-		Version:         version,
-		RequiredScope:   defaultPluginRequiredScope,
-		ContentType:     defaultPluginContentType,
-		CacheControl:    defaultPluginCacheControl,
-		BundleSHA256:    hex.EncodeToString(h[:]),
-		SizeBytes:       int64(len(wasmData)),
-		SignatureHex:    signatureHex,
-		SignerPubKeyHex: signerPubKeyHex,
-		UploadedAt:      time.Now().UTC().Format(time.RFC3339),
-		plainPath:       bundlePath,
-	}
-
-	r.assets[id] = asset
+	asset.ID = id
+	asset.Version = version
+	asset.RequiredScope = defaultPluginRequiredScope
+	asset.ContentType = defaultPluginContentType
+	asset.CacheControl = defaultPluginCacheControl
+	asset.BundleSHA256 = hex.EncodeToString(h[:])
+	asset.SizeBytes = int64(len(wasmData))
+	asset.UploadedAt = time.Now().UTC().Format(time.RFC3339)
+	asset.plainPath = bundlePath
+
+	prev, existed := r.assets[id]
+	next, pruned := withVersion(prev, asset)
+	r.assets[id] = next
 	if err := r.saveCatalogLocked(); err != nil {
 		// Roll back on catalog save failure.
-		delete(r.assets, id)
+		if existed {
+			r.assets[id] = prev
+		} else {
+			delete(r.assets, id)
+		}
 		_ = os.Remove(bundlePath)
 		return nil, fmt.Errorf("save catalog: %w", err)
 	}
+	removeVersionFiles(r.rootPath, pruned)
 	return asset.clone(), nil
 }
 
@@ -804,37 +883,18 @@ func (r *PluginRegistry) AddPlugin(id, version string, wasmData []byte, signatur
 func (r *PluginRegistry) saveCatalogLocked() error {
 	entries := make([]PluginCatalogEntry, 0, len(r.assets))
 	for _, a := range r.assets {
-		entry := PluginCatalogEntry{
-			ID:              a.ID,
-			Version:         a.Version,
-			RequiredScope:   a.RequiredScope,
-			ContentType:     a.ContentType,
-			CacheControl:    a.CacheControl,
-			SignatureHex:    a.SignatureHex,
-			SignerPubKeyHex: a.SignerPubKeyHex,
-			UploadedAt:      a.UploadedAt,
+		entry, err := r.catalogEntry(a)
+		if err != nil {
+			return err
 		}
-		if a.plainPath != "" {
-			rel, err := filepath.Rel(r.rootPath, a.plainPath)
+		entry.Pinned = a.Pinned
+		for _, old := range a.retained {
+			retained, err := r.catalogEntry(old)
 			if err != nil {
-				return fmt.Errorf("relativize plain path for %q: %w", a.ID, err)
-			}
-			entry.PlainPath = rel
-		} else {
-			if a.encryptedPath != "" {
-				rel, err := filepath.Rel(r.rootPath, a.encryptedPath)
-				if err != nil {
-					return fmt.Errorf("relativize encrypted path for %q: %w", a.ID, err)
-				}
-				entry.EncryptedPath = rel
-			}
-			if a.keyPath != "" {
-				rel, err := filepath.Rel(r.rootPath, a.keyPath)
-				if err != nil {
-					return fmt.Errorf("relativize key path for %q: %w", a.ID, err)
-				}
-				entry.KeyPath = rel
+				return err
 			}
+			retained.ID = ""
+			entry.Retained = append(entry.Retained, retained)
 		}
 		entries = append(entries, entry)
 	}
@@ -849,6 +909,45 @@ func (r *PluginRegistry) saveCatalogLocked() error {
 	return os.WriteFile(catalogPath, data, 0600)
 }
 
+// catalogEntry converts an asset back to its catalog form.
+func (r *PluginRegistry) catalogEntry(a *PluginAsset) (PluginCatalogEntry, error) {
+	entry := PluginCatalogEntry{
+		ID:              a.ID,
+		Version:         a.Version,
+		RequiredScope:   a.RequiredScope,
+		ContentType:     a.ContentType,
+		CacheControl:    a.CacheControl,
+		SignatureHex:    a.SignatureHex,
+		SignerPubKeyHex: a.SignerPubKeyHex,
+		UploadedAt:      a.UploadedAt,
+		Publisher:       a.Publisher,
+		Capabilities:    a.Capabilities,
+	}
+	if a.plainPath != "" {
+		rel, err := filepath.Rel(r.rootPath, a.plainPath)
+		if err != nil {
+			return entry, fmt.Errorf("relativize plain path for %q: %w", a.ID, err)
+		}
+		entry.PlainPath = rel
+		return entry, nil
+	}
+	if a.encryptedPath != "" {
+		rel, err := filepath.Rel(r.rootPath, a.encryptedPath)
+		if err != nil {
+			return entry, fmt.Errorf("relativize encrypted path for %q: %w", a.ID, err)
+		}
+		entry.EncryptedPath = rel
+	}
+	if a.keyPath != "" {
+		rel, err := filepath.Rel(r.rootPath, a.keyPath)
+		if err != nil {
+			return entry, fmt.Errorf("relativize key path for %q: %w", a.ID, err)
+		}
+		entry.KeyPath = rel
+	}
+	return entry, nil
+}
+
 func resolveRelativePath(rootAbs, relPath string) (string, error) {
 	rel := strings.TrimSpace(relPath)
 	if rel == "" {
@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -201,3 +202,91 @@ func TestParseX25519PublicKey(t *testing.T) {
 		t.Fatal("base64 parse mismatch")
 	}
 }
+
+func TestPluginRegistryVersionsPinAndRollback(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	reg, err := LoadPluginRegistry(dir)
+	if err != nil {
+		t.Fatalf("LoadPluginRegistry failed: %v", err)
+	}
+
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if _, err := reg.AddPlugin("analysis", v, []byte("wasm-"+v), "", ""); err != nil {
+			t.Fatalf("AddPlugin(%s) failed: %v", v, err)
+		}
+	}
+	activeVersion := func(r *PluginRegistry) string {
+		t.Helper()
+		asset, ok := r.Get("analysis")
+		if !ok {
+			t.Fatal("plugin missing")
+		}
+		return asset.Version
+	}
+	if got := activeVersion(reg); got != "1.1.0" {
+		t.Fatalf("active version = %s, want 1.1.0", got)
+	}
+	versions, err := reg.Versions("analysis")
+	if err != nil || len(versions) != 2 || versions[1].Version != "1.0.0" || versions[1].Status != pluginRuntimeStatusRetained {
+		t.Fatalf("Versions() = %+v, %v", versions, err)
+	}
+
+	// Roll back, then pin: a new upload is retained but not activated.
+	if _, err := reg.Activate("analysis", "1.0.0"); err != nil {
+		t.Fatalf("Activate failed: %v", err)
+	}
+	if err := reg.SetPinned("analysis", true); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+	if _, err := reg.AddPlugin("analysis", "1.2.0", []byte("wasm-1.2.0"), "", ""); err != nil {
+		t.Fatalf("AddPlugin(1.2.0) failed: %v", err)
+	}
+	if _, err := reg.AddPlugin("analysis", "1.0.0", []byte("overwrite"), "", ""); err == nil {
+		t.Fatal("uploading over the pinned version should fail")
+	}
+	if got := activeVersion(reg); got != "1.0.0" {
+		t.Fatalf("pinned active version = %s, want 1.0.0", got)
+	}
+
+	// The catalog survives a reload from disk, including retained versions.
+	reloaded, err := LoadPluginRegistry(dir)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if got := activeVersion(reloaded); got != "1.0.0" {
+		t.Fatalf("reloaded active version = %s, want 1.0.0", got)
+	}
+	versions, _ = reloaded.Versions("analysis")
+	if len(versions) != 3 || !versions[0].Pinned || versions[1].Version != "1.2.0" {
+		t.Fatalf("reloaded versions = %+v", versions)
+	}
+	data, err := reloaded.DecryptBundle("analysis", nil)
+	if err != nil || string(data) != "wasm-1.0.0" {
+		t.Fatalf("active bundle = %q, %v", data, err)
+	}
+}
+
+func TestPluginRegistryPrunesOldVersions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	reg, err := LoadPluginRegistry(dir)
+	if err != nil {
+		t.Fatalf("LoadPluginRegistry failed: %v", err)
+	}
+	for i := 0; i <= maxRetainedPluginVersions+1; i++ {
+		v := fmt.Sprintf("1.%d.0", i)
+		if _, err := reg.AddPlugin("analysis", v, []byte(v), "", ""); err != nil {
+			t.Fatalf("AddPlugin(%s) failed: %v", v, err)
+		}
+	}
+	versions, _ := reg.Versions("analysis")
+	if len(versions) != maxRetainedPluginVersions+1 {
+		t.Fatalf("kept %d versions, want %d", len(versions), maxRetainedPluginVersions+1)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "analysis", "1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("pruned version directory still exists: %v", err)
+	}
+}
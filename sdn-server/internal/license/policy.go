@@ -0,0 +1,233 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPlanPolicyFile = "plans.json"
+
+	// ScopeDataReadPremium grants read access to every protected schema.
+	ScopeDataReadPremium = "api:data:read:premium"
+	// ScopeDataReadPrefix prefixes per-schema read scopes, e.g.
+	// "api:data:read:OMM.fbs".
+	ScopeDataReadPrefix = "api:data:read:"
+
+	// Token TTLs are bounded so a policy typo cannot mint long-lived tokens.
+	minPlanTokenTTL = time.Minute
+	maxPlanTokenTTL = 24 * time.Hour
+)
+
+// PlanDefinition lists the scopes granted to a plan.
+type PlanDefinition struct {
+	Scopes []string `json:"scopes"`
+	// TokenTTLSeconds overrides the service's capability token lifetime for
+	// this plan. Zero uses the service default.
+	TokenTTLSeconds int64 `json:"token_ttl_seconds,omitempty"`
+}
+
+// PlanPolicy maps entitlement plans to capability token scopes.
+type PlanPolicy struct {
+	// DefaultPlan is used for entitlements whose plan is empty or not
+	// defined by the policy.
+	DefaultPlan string                    `json:"default_plan"`
+	Plans       map[string]PlanDefinition `json:"plans"`
+	// ProtectedSchemas lists schemas whose data API reads, on every route,
+	// require a token. A token passes with ScopeDataReadPremium or the schema's own
+	// DataReadScope.
+	ProtectedSchemas []string `json:"protected_schemas,omitempty"`
+}
+
+// DefaultPlanPolicy returns the built-in policy: "free" gets the free tiers
+// and every paid plan gets the premium tiers as well.
+func DefaultPlanPolicy() PlanPolicy {
+	free := []string{"api:data:read:free", "orbpro:base"}
+	paid := append(append([]string(nil), free...), ScopeDataReadPremium, "orbpro:premium")
+	return PlanPolicy{
+		DefaultPlan: "free",
+		Plans: map[string]PlanDefinition{
+			"free":       {Scopes: free},
+			"starter":    {Scopes: paid},
+			"pro":        {Scopes: paid},
+			"enterprise": {Scopes: paid},
+		},
+	}
+}
+
+// DataReadScope returns the per-schema read scope for schema.
+func DataReadScope(schema string) string {
+	return ScopeDataReadPrefix + schema
+}
+
+// Validate checks that the policy is usable.
+func (p PlanPolicy) Validate() error {
+	if len(p.Plans) == 0 {
+		return errors.New("policy defines no plans")
+	}
+	for name, def := range p.Plans {
+		if name != strings.ToLower(strings.TrimSpace(name)) || !pluginIDPattern.MatchString(name) {
+			return fmt.Errorf("invalid plan name %q (lowercase A-Za-z0-9._-)", name)
+		}
+		for _, scope := range def.Scopes {
+			if strings.TrimSpace(scope) == "" || strings.ContainsAny(scope, " \t\r\n") {
+				return fmt.Errorf("plan %q has an invalid scope %q", name, scope)
+			}
+		}
+		if def.TokenTTLSeconds != 0 {
+			ttl := time.Duration(def.TokenTTLSeconds) * time.Second
+			if ttl < minPlanTokenTTL || ttl > maxPlanTokenTTL {
+				return fmt.Errorf("plan %q token TTL must be between %s and %s", name, minPlanTokenTTL, maxPlanTokenTTL)
+			}
+		}
+	}
+	if _, ok := p.Plans[p.DefaultPlan]; !ok {
+		return fmt.Errorf("default plan %q is not defined", p.DefaultPlan)
+	}
+	for _, schema := range p.ProtectedSchemas {
+		if strings.TrimSpace(schema) == "" {
+			return errors.New("protected schema name is empty")
+		}
+	}
+	return nil
+}
+
+// HasPlan reports whether plan is defined by the policy.
+func (p PlanPolicy) HasPlan(plan string) bool {
+	_, ok := p.Plans[strings.ToLower(strings.TrimSpace(plan))]
+	return ok
+}
+
+// PlanNames returns the defined plans in sorted order.
+func (p PlanPolicy) PlanNames() []string {
+	names := make([]string, 0, len(p.Plans))
+	for name := range p.Plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the scopes and token TTL for plan, falling back to the
+// default plan. A zero TTL means the service default applies.
+func (p PlanPolicy) Resolve(plan string) ([]string, time.Duration) {
+	def, ok := p.Plans[strings.ToLower(strings.TrimSpace(plan))]
+	if !ok {
+		def = p.Plans[p.DefaultPlan]
+	}
+	return append([]string(nil), def.Scopes...), time.Duration(def.TokenTTLSeconds) * time.Second
+}
+
+// ReadScopes returns the scopes that each allow reading schema through the
+// data API, and whether the schema is protected at all. Names are compared
+// the way the store maps them to tables, so "omm" and "OMM.fbs" match; the
+// per-schema scope uses the name as configured.
+func (p PlanPolicy) ReadScopes(schema string) ([]string, bool) {
+	key := schemaTableKey(schema)
+	for _, protected := range p.ProtectedSchemas {
+		if schemaTableKey(protected) == key {
+			return []string{ScopeDataReadPremium, DataReadScope(protected)}, true
+		}
+	}
+	return nil, false
+}
+
+// schemaTableKey reduces a schema name as sds.SchemaNameToTable does.
+func schemaTableKey(schema string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(schema), ".fbs"))
+}
+
+func (p PlanPolicy) clone() PlanPolicy {
+	out := PlanPolicy{
+		DefaultPlan:      p.DefaultPlan,
+		Plans:            make(map[string]PlanDefinition, len(p.Plans)),
+		ProtectedSchemas: append([]string(nil), p.ProtectedSchemas...),
+	}
+	for name, def := range p.Plans {
+		def.Scopes = append([]string(nil), def.Scopes...)
+		out.Plans[name] = def
+	}
+	return out
+}
+
+// LoadPlanPolicy reads a policy file. A missing file yields the default
+// policy.
+func LoadPlanPolicy(path string) (PlanPolicy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultPlanPolicy(), nil
+	}
+	if err != nil {
+		return PlanPolicy{}, fmt.Errorf("read plan policy: %w", err)
+	}
+	var p PlanPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return PlanPolicy{}, fmt.Errorf("decode plan policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return PlanPolicy{}, fmt.Errorf("plan policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func savePlanPolicy(path string, p PlanPolicy) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// PlanPolicy returns a copy of the active plan policy.
+func (s *Service) PlanPolicy() PlanPolicy {
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	return s.policy.clone()
+}
+
+// SetPlanPolicy validates, persists and activates a plan policy. Tokens
+// already issued keep their scopes until they expire.
+func (s *Service) SetPlanPolicy(p PlanPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p = p.clone()
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+	if s.policyPath != "" {
+		if err := savePlanPolicy(s.policyPath, p); err != nil {
+			return fmt.Errorf("save plan policy: %w", err)
+		}
+	}
+	s.policy = p
+	return nil
+}
+
+// EffectiveScopes returns the scopes a token for plan would carry.
+func (s *Service) EffectiveScopes(plan string) []string {
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	scopes, _ := s.policy.Resolve(plan)
+	return scopes
+}
+
+// ReadScopes reports the scopes that allow reading schema through the data
+// API under the active policy.
+func (s *Service) ReadScopes(schema string) ([]string, bool) {
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	return s.policy.ReadScopes(schema)
+}
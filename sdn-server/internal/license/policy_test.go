@@ -0,0 +1,140 @@
+package license
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanPolicyResolve(t *testing.T) {
+	policy := DefaultPlanPolicy()
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("default policy invalid: %v", err)
+	}
+
+	free, ttl := policy.Resolve("free")
+	if !reflect.DeepEqual(free, []string{"api:data:read:free", "orbpro:base"}) || ttl != 0 {
+		t.Fatalf("free = %v, %v", free, ttl)
+	}
+	if pro, _ := policy.Resolve(" PRO "); !hasScope(pro, ScopeDataReadPremium) {
+		t.Fatalf("pro scopes = %v", pro)
+	}
+	if unknown, _ := policy.Resolve("legacy"); !reflect.DeepEqual(unknown, free) {
+		t.Fatalf("unknown plan scopes = %v, want default plan", unknown)
+	}
+
+	policy.Plans["cdm"] = PlanDefinition{Scopes: []string{DataReadScope("CDM.fbs")}, TokenTTLSeconds: 3600}
+	policy.ProtectedSchemas = []string{"CDM.fbs"}
+	if _, ttl := policy.Resolve("cdm"); ttl != time.Hour {
+		t.Fatalf("cdm ttl = %v", ttl)
+	}
+	scopes, ok := policy.ReadScopes("CDM.fbs")
+	if !ok || !reflect.DeepEqual(scopes, []string{ScopeDataReadPremium, "api:data:read:CDM.fbs"}) {
+		t.Fatalf("ReadScopes = %v, %v", scopes, ok)
+	}
+	// Spellings that read the same table are protected the same way.
+	for _, name := range []string{"cdm", "CDM", "cdm.fbs", " CDM.fbs "} {
+		if got, ok := policy.ReadScopes(name); !ok || !reflect.DeepEqual(got, scopes) {
+			t.Errorf("ReadScopes(%q) = %v, %v; want %v", name, got, ok, scopes)
+		}
+	}
+	if _, ok := policy.ReadScopes("OMM.fbs"); ok {
+		t.Fatal("OMM.fbs should not be protected")
+	}
+}
+
+func TestPlanPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy PlanPolicy
+	}{
+		{"no plans", PlanPolicy{DefaultPlan: "free"}},
+		{"undefined default", PlanPolicy{DefaultPlan: "gold", Plans: map[string]PlanDefinition{"free": {}}}},
+		{"uppercase plan", PlanPolicy{DefaultPlan: "Free", Plans: map[string]PlanDefinition{"Free": {}}}},
+		{"bad scope", PlanPolicy{DefaultPlan: "free", Plans: map[string]PlanDefinition{"free": {Scopes: []string{"a b"}}}}},
+		{"ttl too long", PlanPolicy{DefaultPlan: "free", Plans: map[string]PlanDefinition{"free": {TokenTTLSeconds: 7 * 24 * 3600}}}},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); err == nil {
+			t.Errorf("%s: Validate() succeeded", tt.name)
+		}
+	}
+}
+
+func TestServicePlanPolicyPersists(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := newServiceWithOptions(dir, "test", serviceOptions{
+		entitlementDBPath: filepath.Join(dir, "license", defaultEntitlementDB),
+		signingKeyPath:    filepath.Join(dir, "license", "seed"),
+		tokenTTL:          defaultTokenTTL,
+		planPolicyPath:    filepath.Join(dir, "license", defaultPlanPolicyFile),
+	})
+	if err != nil {
+		t.Fatalf("newServiceWithOptions: %v", err)
+	}
+	defer svc.Close()
+
+	policy := svc.PlanPolicy()
+	policy.Plans["free"] = PlanDefinition{Scopes: []string{"api:data:read:free"}}
+	if err := svc.SetPlanPolicy(policy); err != nil {
+		t.Fatalf("SetPlanPolicy: %v", err)
+	}
+	if got := svc.EffectiveScopes("free"); !reflect.DeepEqual(got, []string{"api:data:read:free"}) {
+		t.Fatalf("EffectiveScopes = %v", got)
+	}
+
+	loaded, err := LoadPlanPolicy(filepath.Join(dir, "license", defaultPlanPolicyFile))
+	if err != nil {
+		t.Fatalf("LoadPlanPolicy: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Plans["free"].Scopes, []string{"api:data:read:free"}) {
+		t.Fatalf("persisted free scopes = %v", loaded.Plans["free"].Scopes)
+	}
+}
+
+func TestEntitlementClaims(t *testing.T) {
+	dir := t.TempDir()
+	svc, err := newServiceWithOptions(dir, "test", serviceOptions{
+		entitlementDBPath: filepath.Join(dir, "license", defaultEntitlementDB),
+		signingKeyPath:    filepath.Join(dir, "license", "seed"),
+		tokenTTL:          defaultTokenTTL,
+		planPolicyPath:    filepath.Join(dir, "license", defaultPlanPolicyFile),
+	})
+	if err != nil {
+		t.Fatalf("newServiceWithOptions: %v", err)
+	}
+	defer svc.Close()
+
+	if _, err := svc.EntitlementClaims("xpub-operator", "peer-a"); err == nil {
+		t.Fatal("EntitlementClaims without an entitlement should fail")
+	}
+
+	policy := svc.PlanPolicy()
+	policy.Plans["analysis"] = PlanDefinition{Scopes: []string{"plugin:data:query:OMM.fbs"}}
+	if err := svc.SetPlanPolicy(policy); err != nil {
+		t.Fatalf("SetPlanPolicy: %v", err)
+	}
+	ent := &Entitlement{XPub: "xpub-operator", Plan: "analysis", Status: entitlementStatusActive}
+	if err := svc.UpsertEntitlement(ent); err != nil {
+		t.Fatalf("UpsertEntitlement: %v", err)
+	}
+	claims, err := svc.EntitlementClaims("xpub-operator", "peer-a")
+	if err != nil {
+		t.Fatalf("EntitlementClaims: %v", err)
+	}
+	if claims.Sub != "xpub-operator" || claims.PeerID != "peer-a" || claims.Plan != "analysis" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if !reflect.DeepEqual(claims.Scopes, []string{"plugin:data:query:OMM.fbs"}) {
+		t.Errorf("scopes = %v, want the plan's scopes", claims.Scopes)
+	}
+
+	ent.Status = "canceled"
+	if err := svc.UpsertEntitlement(ent); err != nil {
+		t.Fatalf("UpsertEntitlement: %v", err)
+	}
+	if _, err := svc.EntitlementClaims("xpub-operator", "peer-a"); err == nil {
+		t.Error("EntitlementClaims for an inactive entitlement should fail")
+	}
+}
@@ -0,0 +1,319 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPublisherStoreFile = "plugin_publishers.json"
+
+	// PluginManifestType tags the canonical manifest so signatures over it
+	// cannot be replayed as other message types.
+	PluginManifestType = "sdn-plugin-manifest/v1"
+
+	// Publisher sources.
+	PublisherSourceConfig = "config"
+	PublisherSourceEPM    = "epm"
+)
+
+var (
+	// ErrUnsignedPlugin indicates an upload carried no signature.
+	ErrUnsignedPlugin = errors.New("plugin is not signed")
+	// ErrUntrustedPublisher indicates the signing key is not on the
+	// publisher allow-list or may not publish the plugin.
+	ErrUntrustedPublisher = errors.New("plugin publisher is not trusted")
+)
+
+// PluginCapabilities are the data-access capabilities a plugin declares, in
+// the form the WASI runtime reads from plugin_get_capabilities.
+type PluginCapabilities struct {
+	Query     []string `json:"query,omitempty"`
+	Subscribe []string `json:"subscribe,omitempty"`
+	Publish   []string `json:"publish,omitempty"`
+}
+
+func (c PluginCapabilities) canonical() PluginCapabilities {
+	return PluginCapabilities{
+		Query:     canonicalStrings(c.Query),
+		Subscribe: canonicalStrings(c.Subscribe),
+		Publish:   canonicalStrings(c.Publish),
+	}
+}
+
+func canonicalStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	var out []string
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// PluginManifest is what a publisher signs for an upload.
+type PluginManifest struct {
+	ID           string             `json:"id"`
+	Version      string             `json:"version"`
+	WasmSHA256   string             `json:"wasm_sha256"`
+	Capabilities PluginCapabilities `json:"capabilities"`
+}
+
+// CanonicalBytes returns the bytes a publisher signs: compact JSON with a
+// fixed key order, trimmed fields and sorted, de-duplicated capabilities.
+func (m PluginManifest) CanonicalBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type         string             `json:"type"`
+		ID           string             `json:"id"`
+		Version      string             `json:"version"`
+		WasmSHA256   string             `json:"wasm_sha256"`
+		Capabilities PluginCapabilities `json:"capabilities"`
+	}{
+		Type:         PluginManifestType,
+		ID:           strings.TrimSpace(m.ID),
+		Version:      strings.TrimSpace(m.Version),
+		WasmSHA256:   strings.ToLower(strings.TrimSpace(m.WasmSHA256)),
+		Capabilities: m.Capabilities.canonical(),
+	})
+	return data
+}
+
+// Publisher is a key trusted to sign plugin uploads.
+type Publisher struct {
+	Name         string `json:"name"`
+	PublicKeyHex string `json:"public_key_hex"`
+	// Plugins restricts the plugin IDs the publisher may upload; empty
+	// allows any.
+	Plugins []string `json:"plugins,omitempty"`
+	Source  string   `json:"source"`
+	// PeerID, DN and Email identify the entity for EPM-attested
+	// publishers.
+	PeerID  string `json:"peer_id,omitempty"`
+	DN      string `json:"dn,omitempty"`
+	Email   string `json:"email,omitempty"`
+	AddedAt int64  `json:"added_at"`
+}
+
+func (p Publisher) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("publisher name is required")
+	}
+	raw, err := hex.DecodeString(p.PublicKeyHex)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return errors.New("public_key_hex must be a 32-byte Ed25519 key")
+	}
+	for _, id := range p.Plugins {
+		if !pluginIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid plugin id %q", id)
+		}
+	}
+	return nil
+}
+
+func (p Publisher) mayPublish(pluginID string) bool {
+	if len(p.Plugins) == 0 {
+		return true
+	}
+	for _, id := range p.Plugins {
+		if id == pluginID {
+			return true
+		}
+	}
+	return false
+}
+
+// PublisherFromEPM builds a publisher from a verified EPM, using the
+// Ed25519 signing key its identity attestation binds to the peer.
+func PublisherFromEPM(a *AttestedEPM) (Publisher, error) {
+	if a == nil || a.SigningKeyHex == "" {
+		return Publisher{}, errors.New("EPM has no Ed25519 signing key")
+	}
+	p := Publisher{
+		Name:         a.LegalName,
+		PublicKeyHex: strings.ToLower(a.SigningKeyHex),
+		Source:       PublisherSourceEPM,
+		PeerID:       a.PeerID,
+		DN:           a.DN,
+		Email:        a.Email,
+	}
+	if p.Name == "" {
+		p.Name = a.DN
+	}
+	return p, p.validate()
+}
+
+// PublisherStore is the allow-list of plugin publishers.
+type PublisherStore struct {
+	mu         sync.RWMutex
+	path       string
+	publishers map[string]Publisher // by public key hex
+}
+
+// LoadPublisherStore reads the allow-list at path. A missing file yields an
+// empty list, which refuses every upload; an empty path keeps it in memory.
+func LoadPublisherStore(path string) (*PublisherStore, error) {
+	ps := &PublisherStore{path: path, publishers: make(map[string]Publisher)}
+	if path == "" {
+		return ps, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read publisher allow-list: %w", err)
+	}
+	var list []Publisher
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode publisher allow-list: %w", err)
+	}
+	for _, p := range list {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("publisher %q: %w", p.Name, err)
+		}
+		ps.publishers[strings.ToLower(p.PublicKeyHex)] = p
+	}
+	return ps, nil
+}
+
+func (ps *PublisherStore) saveLocked() error {
+	if ps.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ps.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ps.path), 0700); err != nil {
+		return err
+	}
+	tmp := ps.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("write publisher allow-list: %w", err)
+	}
+	return os.Rename(tmp, ps.path)
+}
+
+func (ps *PublisherStore) listLocked() []Publisher {
+	out := make([]Publisher, 0, len(ps.publishers))
+	for _, p := range ps.publishers {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].PublicKeyHex < out[j].PublicKeyHex
+	})
+	return out
+}
+
+// Put adds or replaces a publisher.
+func (ps *PublisherStore) Put(p Publisher) (Publisher, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	p.PublicKeyHex = strings.ToLower(strings.TrimSpace(p.PublicKeyHex))
+	if p.Source == "" {
+		p.Source = PublisherSourceConfig
+	}
+	if err := p.validate(); err != nil {
+		return Publisher{}, err
+	}
+	p.AddedAt = time.Now().Unix()
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	prev, had := ps.publishers[p.PublicKeyHex]
+	ps.publishers[p.PublicKeyHex] = p
+	if err := ps.saveLocked(); err != nil {
+		if had {
+			ps.publishers[p.PublicKeyHex] = prev
+		} else {
+			delete(ps.publishers, p.PublicKeyHex)
+		}
+		return Publisher{}, err
+	}
+	return p, nil
+}
+
+// Remove drops the publisher with the given key and reports whether it was
+// listed. Plugins it already published stay installed.
+func (ps *PublisherStore) Remove(publicKeyHex string) (bool, error) {
+	key := strings.ToLower(strings.TrimSpace(publicKeyHex))
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	prev, ok := ps.publishers[key]
+	if !ok {
+		return false, nil
+	}
+	delete(ps.publishers, key)
+	if err := ps.saveLocked(); err != nil {
+		ps.publishers[key] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns the publisher with key publicKeyHex.
+func (ps *PublisherStore) Get(publicKeyHex string) (Publisher, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	p, ok := ps.publishers[strings.ToLower(strings.TrimSpace(publicKeyHex))]
+	return p, ok
+}
+
+// List returns the allow-list sorted by name.
+func (ps *PublisherStore) List() []Publisher {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.listLocked()
+}
+
+// Verify checks that the manifest describes wasmData and is signed by a
+// listed publisher allowed to publish it, returning that publisher.
+func (ps *PublisherStore) Verify(m PluginManifest, wasmData []byte, signatureHex, publicKeyHex string) (Publisher, error) {
+	sum := sha256.Sum256(wasmData)
+	if !strings.EqualFold(strings.TrimSpace(m.WasmSHA256), hex.EncodeToString(sum[:])) {
+		return Publisher{}, errors.New("manifest wasm_sha256 does not match the bundle")
+	}
+	if strings.TrimSpace(signatureHex) == "" {
+		return Publisher{}, ErrUnsignedPlugin
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(signatureHex))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return Publisher{}, errors.New("signature must be a 64-byte Ed25519 signature")
+	}
+
+	ps.mu.RLock()
+	p, ok := ps.publishers[strings.ToLower(strings.TrimSpace(publicKeyHex))]
+	ps.mu.RUnlock()
+	if !ok {
+		return Publisher{}, ErrUntrustedPublisher
+	}
+	if !p.mayPublish(strings.TrimSpace(m.ID)) {
+		return Publisher{}, fmt.Errorf("%w: %s may not publish %q", ErrUntrustedPublisher, p.Name, m.ID)
+	}
+	pub, _ := hex.DecodeString(p.PublicKeyHex)
+	if !ed25519.Verify(pub, m.CanonicalBytes(), sig) {
+		return Publisher{}, errors.New("manifest signature verification failed")
+	}
+	return p, nil
+}
+
+// PluginPublishers exposes the plugin publisher allow-list.
+func (s *Service) PluginPublishers() *PublisherStore {
+	return s.publishers
+}
@@ -0,0 +1,223 @@
+package license
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
+)
+
+func signManifest(t *testing.T, priv ed25519.PrivateKey, m PluginManifest) string {
+	t.Helper()
+	return hex.EncodeToString(ed25519.Sign(priv, m.CanonicalBytes()))
+}
+
+func testManifest(wasm []byte) PluginManifest {
+	sum := sha256.Sum256(wasm)
+	return PluginManifest{
+		ID:           "orbit-tools",
+		Version:      "1.0.0",
+		WasmSHA256:   hex.EncodeToString(sum[:]),
+		Capabilities: PluginCapabilities{Query: []string{"OMM", "CAT"}},
+	}
+}
+
+func TestPluginManifestCanonical(t *testing.T) {
+	a := PluginManifest{ID: " p ", Version: "1", WasmSHA256: "AB", Capabilities: PluginCapabilities{Query: []string{"OMM", "CAT", "OMM"}}}
+	b := PluginManifest{ID: "p", Version: "1", WasmSHA256: "ab", Capabilities: PluginCapabilities{Query: []string{"CAT", "OMM"}}}
+	if !bytes.Equal(a.CanonicalBytes(), b.CanonicalBytes()) {
+		t.Fatalf("canonical forms differ:\n%s\n%s", a.CanonicalBytes(), b.CanonicalBytes())
+	}
+	c := b
+	c.Capabilities.Publish = []string{"OMM"}
+	if bytes.Equal(b.CanonicalBytes(), c.CanonicalBytes()) {
+		t.Fatal("capabilities are not covered by the canonical form")
+	}
+}
+
+func TestPublisherStoreVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	pubHex := hex.EncodeToString(pub)
+	wasm := []byte("\x00asm plugin")
+	m := testManifest(wasm)
+
+	path := filepath.Join(t.TempDir(), defaultPublisherStoreFile)
+	ps, err := LoadPublisherStore(path)
+	if err != nil {
+		t.Fatalf("LoadPublisherStore: %v", err)
+	}
+	if _, err := ps.Verify(m, wasm, signManifest(t, priv, m), pubHex); !errors.Is(err, ErrUntrustedPublisher) {
+		t.Fatalf("unlisted publisher error = %v, want ErrUntrustedPublisher", err)
+	}
+	if _, err := ps.Put(Publisher{Name: "Acme", PublicKeyHex: pubHex, Plugins: []string{"orbit-tools"}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, err := ps.Verify(m, wasm, signManifest(t, priv, m), pubHex)
+	if err != nil || got.Name != "Acme" {
+		t.Fatalf("Verify = %+v, %v", got, err)
+	}
+	if _, err := ps.Verify(m, wasm, "", pubHex); !errors.Is(err, ErrUnsignedPlugin) {
+		t.Fatalf("unsigned error = %v, want ErrUnsignedPlugin", err)
+	}
+	if _, err := ps.Verify(m, wasm, signManifest(t, otherPriv, m), pubHex); err == nil {
+		t.Fatal("signature from another key accepted")
+	}
+	if _, err := ps.Verify(m, []byte("other bundle"), signManifest(t, priv, m), pubHex); err == nil {
+		t.Fatal("manifest accepted for a different bundle")
+	}
+	widened := m
+	widened.Capabilities.Publish = []string{"OMM"}
+	if _, err := ps.Verify(widened, wasm, signManifest(t, priv, m), pubHex); err == nil {
+		t.Fatal("capabilities widened after signing were accepted")
+	}
+	renamed := m
+	renamed.ID = "other-plugin"
+	if _, err := ps.Verify(renamed, wasm, signManifest(t, priv, renamed), pubHex); !errors.Is(err, ErrUntrustedPublisher) {
+		t.Fatalf("restricted plugin error = %v, want ErrUntrustedPublisher", err)
+	}
+
+	reloaded, err := LoadPublisherStore(path)
+	if err != nil || len(reloaded.List()) != 1 {
+		t.Fatalf("reloaded store = %+v, %v", reloaded.List(), err)
+	}
+	if removed, err := reloaded.Remove(pubHex); err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+}
+
+func TestPublisherFromEPM(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	p, err := PublisherFromEPM(&AttestedEPM{
+		PeerID: "peer-acme", SigningKeyHex: hex.EncodeToString(pub),
+		DN: "CN=Acme", LegalName: "Acme Corp", Email: "ops@acme.test",
+	})
+	if err != nil {
+		t.Fatalf("PublisherFromEPM: %v", err)
+	}
+	if p.Name != "Acme Corp" || p.DN != "CN=Acme" || p.PeerID != "peer-acme" ||
+		p.Source != PublisherSourceEPM || p.PublicKeyHex != hex.EncodeToString(pub) {
+		t.Fatalf("publisher = %+v", p)
+	}
+	if _, err := PublisherFromEPM(&AttestedEPM{DN: "CN=Acme"}); err == nil {
+		t.Fatal("publisher built from an EPM without a signing key")
+	}
+	if _, err := PublisherFromEPM(nil); err == nil {
+		t.Fatal("publisher built without a verified EPM")
+	}
+}
+
+func TestUploadHandlerRequiresTrustedPublisher(t *testing.T) {
+	reg, err := LoadPluginRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadPluginRegistry: %v", err)
+	}
+	ps, _ := LoadPublisherStore("")
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubHex := hex.EncodeToString(pub)
+
+	h := NewUploadHandler(reg,
+		func(string) (string, error) { return pubHex, nil },
+		func(*http.Request) (string, error) { return "xpub-admin", nil },
+	)
+	h.SetPublishers(ps)
+
+	wasm := []byte("\x00asm plugin")
+	m := testManifest(wasm)
+	upload := func(sig string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("bundle", "plugin.wasm")
+		_, _ = fw.Write(wasm)
+		meta, _ := json.Marshal(uploadMetadata{ID: m.ID, Version: m.Version, Capabilities: m.Capabilities})
+		_ = mw.WriteField("metadata", string(meta))
+		if sig != "" {
+			_ = mw.WriteField("signature_hex", sig)
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/plugins/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload(""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unsigned upload status = %d, want 400", rec.Code)
+	}
+	if rec := upload(signManifest(t, priv, m)); rec.Code != http.StatusForbidden {
+		t.Fatalf("untrusted upload status = %d, want 403", rec.Code)
+	}
+	if _, err := ps.Put(Publisher{Name: "Acme", PublicKeyHex: pubHex}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if rec := upload(signManifest(t, priv, m)); rec.Code != http.StatusCreated {
+		t.Fatalf("trusted upload status = %d: %s", rec.Code, rec.Body.String())
+	}
+	asset, ok := reg.Get(m.ID)
+	if !ok {
+		t.Fatal("uploaded plugin not registered")
+	}
+	desc := asset.Descriptor()
+	if desc.Publisher != "Acme" || desc.Capabilities == nil || len(desc.Capabilities.Query) != 2 {
+		t.Fatalf("descriptor = %+v", desc)
+	}
+}
+
+func TestPublisherChangesAreAudited(t *testing.T) {
+	t.Setenv("SDN_LICENSE_ADMIN_TOKEN", "admin-secret")
+	svc := newTestService(t, t.TempDir())
+	logger, err := audit.NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	h := NewAPIHandler(svc)
+	h.SetAuditLogger(logger)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	pubHex := hex.EncodeToString(pub)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-License-Admin-Token", "admin-secret")
+		req = req.WithContext(audit.WithActor(req.Context(), "xpub-admin"))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do(http.MethodPost, "/api/v1/license/publishers", `{"name":"Acme","public_key_hex":"`+pubHex+`"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("add publisher status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/api/v1/license/publishers/"+pubHex, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("remove publisher status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entries, err := logger.Query(audit.QueryOptions{TargetID: pubHex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if e.EventType != audit.EventTypePublisherChange || e.ActorXPub != "xpub-admin" {
+			t.Errorf("entry = %s by %q", e.EventType, e.ActorXPub)
+		}
+	}
+	if !strings.Contains(entries[0].Details, `"before"`) || strings.Contains(entries[0].Details, `"after"`) {
+		t.Errorf("removal details = %s", entries[0].Details)
+	}
+}
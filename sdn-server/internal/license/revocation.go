@@ -0,0 +1,313 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RevocationTopic is the PubSub topic revocations are gossiped on.
+	RevocationTopic = "/spacedatanetwork/license/revocations/1.0.0"
+
+	// RevokeJTI revokes a single token by its jti claim.
+	RevokeJTI = "jti"
+	// RevokeSubject revokes every token issued to an xpub up to the time of
+	// revocation. Suspend the entitlement as well to stop new tokens.
+	RevokeSubject = "sub"
+
+	msgTypeRevocations = "revocations"
+)
+
+// Revocation is an issuer-signed entry of the revocation list.
+type Revocation struct {
+	Issuer    string `json:"iss"`
+	Kind      string `json:"kind"`
+	Value     string `json:"value"`
+	Reason    string `json:"reason,omitempty"`
+	RevokedAt int64  `json:"revoked_at"`
+	// ExpiresAt is when the entry can be forgotten because every token it
+	// covers has expired.
+	ExpiresAt    int64  `json:"expires_at"`
+	KID          string `json:"kid"`
+	SignatureHex string `json:"signature_hex"`
+}
+
+// RevocationMessage carries revocations over PubSub.
+type RevocationMessage struct {
+	Type        string       `json:"type"`
+	Revocations []Revocation `json:"revocations"`
+}
+
+func (r Revocation) key() string {
+	return r.Issuer + "\x00" + r.Kind + "\x00" + r.Value
+}
+
+func (r Revocation) signingBytes() []byte {
+	r.SignatureHex = ""
+	data, _ := json.Marshal(r)
+	return data
+}
+
+func (r Revocation) validate() error {
+	if r.Kind != RevokeJTI && r.Kind != RevokeSubject {
+		return fmt.Errorf("invalid revocation kind %q", r.Kind)
+	}
+	if strings.TrimSpace(r.Value) == "" || strings.TrimSpace(r.Issuer) == "" {
+		return errors.New("revocation issuer and value are required")
+	}
+	if r.RevokedAt <= 0 || r.ExpiresAt < r.RevokedAt {
+		return errors.New("invalid revocation timestamps")
+	}
+	return nil
+}
+
+// verify checks the revocation's signature against an issuer key set.
+func (r Revocation) verify(keys []IssuerKey) error {
+	return verifyIssuerSignature(keys, r.KID, r.RevokedAt, r.signingBytes(), r.SignatureHex)
+}
+
+// RevocationList is the in-memory set of revocations consulted by verifiers.
+type RevocationList struct {
+	mu      sync.RWMutex
+	entries map[string]Revocation
+}
+
+// NewRevocationList creates an empty revocation list.
+func NewRevocationList() *RevocationList {
+	return &RevocationList{entries: make(map[string]Revocation)}
+}
+
+// Add records a revocation and reports whether the list changed. A later
+// revocation of the same subject supersedes an earlier one.
+func (l *RevocationList) Add(r Revocation) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cur, ok := l.entries[r.key()]; ok && cur.RevokedAt >= r.RevokedAt {
+		return false
+	}
+	l.entries[r.key()] = r
+	return true
+}
+
+// IsRevoked reports whether the token described by claims is revoked.
+func (l *RevocationList) IsRevoked(claims *CapabilityClaims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if claims.JTI != "" {
+		if _, ok := l.entries[Revocation{Issuer: claims.Iss, Kind: RevokeJTI, Value: claims.JTI}.key()]; ok {
+			return true
+		}
+	}
+	if r, ok := l.entries[Revocation{Issuer: claims.Iss, Kind: RevokeSubject, Value: claims.Sub}.key()]; ok {
+		return claims.Iat <= r.RevokedAt
+	}
+	return false
+}
+
+// List returns the unexpired revocations and drops expired ones.
+func (l *RevocationList) List(now time.Time) []Revocation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Revocation, 0, len(l.entries))
+	for k, r := range l.entries {
+		if r.ExpiresAt < now.Unix() {
+			delete(l.entries, k)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func (s *EntitlementStore) initRevocationSchema() error {
+	_, err := s.db.Exec(`
+CREATE TABLE IF NOT EXISTS revocations (
+	issuer TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL,
+	reason TEXT,
+	revoked_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	kid TEXT NOT NULL,
+	signature_hex TEXT NOT NULL,
+	PRIMARY KEY (issuer, kind, value)
+);
+CREATE INDEX IF NOT EXISTS idx_revocations_expires ON revocations(expires_at);
+`)
+	if err != nil {
+		return fmt.Errorf("init revocation schema: %w", err)
+	}
+	return nil
+}
+
+// SaveRevocation persists a revocation, keeping the latest per key.
+func (s *EntitlementStore) SaveRevocation(r Revocation) error {
+	_, err := s.db.Exec(`
+INSERT INTO revocations (issuer, kind, value, reason, revoked_at, expires_at, kid, signature_hex)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(issuer, kind, value) DO UPDATE SET
+	reason = excluded.reason,
+	revoked_at = excluded.revoked_at,
+	expires_at = excluded.expires_at,
+	kid = excluded.kid,
+	signature_hex = excluded.signature_hex
+WHERE excluded.revoked_at > revocations.revoked_at
+`, r.Issuer, r.Kind, r.Value, r.Reason, r.RevokedAt, r.ExpiresAt, r.KID, r.SignatureHex)
+	if err != nil {
+		return fmt.Errorf("save revocation: %w", err)
+	}
+	return nil
+}
+
+// ListRevocations returns unexpired revocations and deletes expired ones.
+func (s *EntitlementStore) ListRevocations(now time.Time) ([]Revocation, error) {
+	if _, err := s.db.Exec(`DELETE FROM revocations WHERE expires_at < ?`, now.Unix()); err != nil {
+		return nil, fmt.Errorf("prune revocations: %w", err)
+	}
+	rows, err := s.db.Query(`
+SELECT issuer, kind, value, reason, revoked_at, expires_at, kid, signature_hex
+FROM revocations`)
+	if err != nil {
+		return nil, fmt.Errorf("list revocations: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Revocation
+	for rows.Next() {
+		var r Revocation
+		var reason sql.NullString
+		if err := rows.Scan(&r.Issuer, &r.Kind, &r.Value, &reason, &r.RevokedAt, &r.ExpiresAt, &r.KID, &r.SignatureHex); err != nil {
+			return nil, fmt.Errorf("scan revocation: %w", err)
+		}
+		r.Reason = reason.String
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SetRevocationPublisher sets the function used to gossip revocation
+// messages, typically a PubSub publish on RevocationTopic.
+func (s *Service) SetRevocationPublisher(fn func(data []byte) error) {
+	s.revokeMu.Lock()
+	defer s.revokeMu.Unlock()
+	s.publishRevocations = fn
+}
+
+// Revoke signs, persists and gossips a revocation of a token (kind RevokeJTI)
+// or of every token issued to an xpub so far (kind RevokeSubject).
+func (s *Service) Revoke(kind, value, reason string) (*Revocation, error) {
+	now := time.Now().UTC()
+	kid, priv := s.keys.active()
+	r := Revocation{
+		Issuer:    s.issuer,
+		Kind:      strings.TrimSpace(kind),
+		Value:     strings.TrimSpace(value),
+		Reason:    strings.TrimSpace(reason),
+		RevokedAt: now.Unix(),
+		// No token outlives the longest allowed TTL, so neither does the entry.
+		ExpiresAt: now.Add(s.maxTokenTTL() + defaultVerifyLeeway).Unix(),
+		KID:       kid,
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	r.SignatureHex = hex.EncodeToString(ed25519.Sign(priv, r.signingBytes()))
+
+	if err := s.store.SaveRevocation(r); err != nil {
+		return nil, err
+	}
+	s.revocations.Add(r)
+	log.Infof("Revoked %s %s", r.Kind, r.Value)
+
+	if err := s.gossipRevocations([]Revocation{r}); err != nil {
+		log.Warnf("Failed to gossip revocation of %s %s: %v", r.Kind, r.Value, err)
+	}
+	return &r, nil
+}
+
+// Revocations returns the unexpired revocations.
+func (s *Service) Revocations() []Revocation {
+	return s.revocations.List(time.Now())
+}
+
+// HandleRevocationMessage applies revocations gossiped by other nodes. Only
+// entries from this node's issuer or a trusted issuer, signed by one of that
+// issuer's keys, are accepted; it returns how many were new.
+func (s *Service) HandleRevocationMessage(data []byte) (int, error) {
+	var msg RevocationMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return 0, fmt.Errorf("decode revocation message: %w", err)
+	}
+	if msg.Type != msgTypeRevocations {
+		return 0, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+
+	now := time.Now().Unix()
+	applied := 0
+	for _, r := range msg.Revocations {
+		keys, ok := s.issuerKeys(r.Issuer)
+		if !ok || r.ExpiresAt < now {
+			continue
+		}
+		if err := r.validate(); err != nil {
+			log.Debugf("Ignoring invalid revocation: %v", err)
+			continue
+		}
+		if err := r.verify(keys); err != nil {
+			log.Debugf("Ignoring revocation of %s %s: %v", r.Kind, r.Value, err)
+			continue
+		}
+		if !s.revocations.Add(r) {
+			continue
+		}
+		if err := s.store.SaveRevocation(r); err != nil {
+			log.Warnf("Failed to persist revocation of %s %s: %v", r.Kind, r.Value, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// GossipRevocations republishes every unexpired revocation so nodes that
+// joined since they were issued catch up.
+func (s *Service) GossipRevocations() error {
+	list := s.Revocations()
+	if len(list) == 0 {
+		return nil
+	}
+	return s.gossipRevocations(list)
+}
+
+func (s *Service) gossipRevocations(list []Revocation) error {
+	s.revokeMu.Lock()
+	publish := s.publishRevocations
+	s.revokeMu.Unlock()
+	if publish == nil {
+		return nil
+	}
+	data, err := json.Marshal(RevocationMessage{Type: msgTypeRevocations, Revocations: list})
+	if err != nil {
+		return err
+	}
+	return publish(data)
+}
+
+// maxTokenTTL returns the longest token lifetime the service can issue.
+func (s *Service) maxTokenTTL() time.Duration {
+	longest := s.tokenTTL
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	for _, def := range s.policy.Plans {
+		if ttl := time.Duration(def.TokenTTLSeconds) * time.Second; ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
@@ -0,0 +1,141 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T, dir string) *Service {
+	t.Helper()
+	svc, err := newServiceWithOptions(dir, "test-issuer", serviceOptions{
+		entitlementDBPath: filepath.Join(dir, "license", defaultEntitlementDB),
+		signingKeyPath:    filepath.Join(dir, "license", "token_signing_ed25519.seed"),
+		tokenTTL:          defaultTokenTTL,
+	})
+	if err != nil {
+		t.Fatalf("newServiceWithOptions: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func (s *Service) signTestToken(t *testing.T, sub, jti string) string {
+	t.Helper()
+	now := time.Now()
+	kid, priv := s.keys.active()
+	token, err := SignCapabilityTokenWithKID(CapabilityClaims{
+		Iss: s.issuer, Sub: sub, PeerID: "peer", Scopes: []string{"orbpro:base"},
+		Iat: now.Unix(), Exp: now.Add(5 * time.Minute).Unix(), JTI: jti,
+	}, priv, kid)
+	if err != nil {
+		t.Fatalf("SignCapabilityTokenWithKID: %v", err)
+	}
+	return token
+}
+
+func TestSigningKeyRotationOverlap(t *testing.T) {
+	dir := t.TempDir()
+	svc := newTestService(t, dir)
+	oldToken := svc.signTestToken(t, "xpub-a", "jti-old")
+
+	if _, err := svc.RotateSigningKey(0); err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+	keys := svc.IssuerKeys()
+	if len(keys) != 2 || keys[0].NotAfter == 0 || keys[1].NotAfter != 0 {
+		t.Fatalf("unexpected key ring after rotation: %+v", keys)
+	}
+	newToken := svc.signTestToken(t, "xpub-a", "jti-new")
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := svc.Verifier().VerifyToken(token, "peer", nil); err != nil {
+			t.Fatalf("%s token rejected during overlap: %v", name, err)
+		}
+	}
+
+	// The ring survives a restart and the new key keeps signing.
+	svc.Close()
+	reopened := newTestService(t, dir)
+	if _, err := reopened.Verifier().VerifyToken(oldToken, "peer", nil); err != nil {
+		t.Fatalf("old token rejected after restart: %v", err)
+	}
+	if kid, _ := reopened.keys.active(); kid != keys[1].KID {
+		t.Fatalf("active key after restart = %s, want %s", kid, keys[1].KID)
+	}
+
+	// Once the old key's window closes its tokens are refused.
+	retired := keys[0]
+	retired.NotAfter = time.Now().Add(-time.Hour).Unix()
+	reopened.Verifier().SetKeys([]IssuerKey{retired, keys[1]})
+	if _, err := reopened.Verifier().VerifyToken(oldToken, "peer", nil); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Fatalf("retired key error = %v, want ErrUnknownSigningKey", err)
+	}
+}
+
+func TestRevocationByJTIAndSubject(t *testing.T) {
+	svc := newTestService(t, t.TempDir())
+	tokenA := svc.signTestToken(t, "xpub-a", "jti-a")
+	tokenB := svc.signTestToken(t, "xpub-b", "jti-b")
+
+	if _, err := svc.Revoke(RevokeJTI, "jti-a", "leaked"); err != nil {
+		t.Fatalf("Revoke jti: %v", err)
+	}
+	if _, err := svc.Verifier().VerifyToken(tokenA, "peer", nil); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("revoked jti error = %v", err)
+	}
+	if _, err := svc.Verifier().VerifyToken(tokenB, "peer", nil); err != nil {
+		t.Fatalf("unrelated token rejected: %v", err)
+	}
+
+	if _, err := svc.Revoke(RevokeSubject, "xpub-b", ""); err != nil {
+		t.Fatalf("Revoke sub: %v", err)
+	}
+	if _, err := svc.Verifier().VerifyToken(tokenB, "peer", nil); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("revoked subject error = %v", err)
+	}
+	if _, err := svc.Revoke("bogus", "x", ""); err == nil {
+		t.Fatal("Revoke accepted an invalid kind")
+	}
+}
+
+func TestHandleRevocationMessage(t *testing.T) {
+	svc := newTestService(t, t.TempDir())
+	var published []byte
+	svc.SetRevocationPublisher(func(data []byte) error {
+		published = data
+		return nil
+	})
+	if _, err := svc.Revoke(RevokeJTI, "jti-x", ""); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if published == nil {
+		t.Fatal("revocation was not published")
+	}
+
+	// A verifying node sharing the issuer key set applies the message once.
+	peer := newTestService(t, t.TempDir())
+	peer.verifier = NewTokenVerifier(nil, svc.issuer)
+	peer.verifier.SetKeys(svc.IssuerKeys())
+	peer.verifier.SetRevocations(peer.revocations)
+	if n, err := peer.HandleRevocationMessage(published); err != nil || n != 1 {
+		t.Fatalf("HandleRevocationMessage = %d, %v", n, err)
+	}
+	if n, _ := peer.HandleRevocationMessage(published); n != 0 {
+		t.Fatalf("duplicate message applied %d revocations", n)
+	}
+	if _, err := peer.Verifier().VerifyToken(svc.signTestToken(t, "xpub", "jti-x"), "peer", nil); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("gossiped revocation not enforced: %v", err)
+	}
+
+	// Tampered entries are ignored.
+	var msg RevocationMessage
+	_ = json.Unmarshal(published, &msg)
+	msg.Revocations[0].Value = "jti-y"
+	tampered, _ := json.Marshal(msg)
+	if n, _ := peer.HandleRevocationMessage(tampered); n != 0 {
+		t.Fatal("tampered revocation was applied")
+	}
+}
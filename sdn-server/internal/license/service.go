@@ -41,6 +41,10 @@ type serviceOptions struct {
 	challengeTTL      time.Duration
 	tokenTTL          time.Duration
 	clockSkew         time.Duration
+	planPolicyPath    string
+	trustStorePath    string
+	stripe            stripeConfig
+	publishersPath    string
 }
 
 type pendingChallenge struct {
@@ -56,17 +60,37 @@ type pendingChallenge struct {
 
 // Service handles challenge/proof/grant exchange over libp2p streams.
 type Service struct {
-	store      *EntitlementStore
-	privateKey ed25519.PrivateKey
-	publicKey  ed25519.PublicKey
-	issuer     string
-	verifier   *TokenVerifier
-	plugins    *PluginRegistry
+	store       *EntitlementStore
+	keys        *signingKeyRing
+	issuer      string
+	verifier    *TokenVerifier
+	plugins     *PluginRegistry
+	revocations *RevocationList
+	trust       *TrustStore
+	publishers  *PublisherStore
+
+	// publishRevocations gossips revocation messages to other nodes;
+	// onKeyRotation republishes the issuer descriptor after a rotation.
+	revokeMu           sync.Mutex
+	publishRevocations func(data []byte) error
+	onKeyRotation      func()
+
+	// verifyEPM verifies the EPMs issuers and publishers are imported from.
+	epmMu     sync.RWMutex
+	verifyEPM EPMVerifier
 
 	challengeTTL time.Duration
 	tokenTTL     time.Duration
 	clockSkew    time.Duration
 
+	policyMu   sync.RWMutex
+	policy     PlanPolicy
+	policyPath string
+
+	// stripeMu serializes Stripe webhook and reconciliation updates.
+	stripeMu sync.Mutex
+	stripe   stripeConfig
+
 	mu         sync.Mutex
 	challenges map[string]pendingChallenge
 }
@@ -84,6 +108,16 @@ func NewService(baseDataPath, issuer string) (*Service, error) {
 		challengeTTL:      defaultChallengeTTL,
 		tokenTTL:          defaultTokenTTL,
 		clockSkew:         defaultClockSkew,
+		planPolicyPath:    filepath.Join(licenseDir, defaultPlanPolicyFile),
+		trustStorePath:    filepath.Join(licenseDir, defaultTrustStoreFile),
+		stripe:            stripeConfigFromEnv(),
+		publishersPath:    filepath.Join(licenseDir, defaultPublisherStoreFile),
+	}
+	if path := strings.TrimSpace(os.Getenv("SDN_LICENSE_PLAN_POLICY")); path != "" {
+		opts.planPolicyPath = path
+	}
+	if path := strings.TrimSpace(os.Getenv("SDN_PLUGIN_PUBLISHERS")); path != "" {
+		opts.publishersPath = path
 	}
 	return newServiceWithOptions(baseDataPath, issuer, opts)
 }
@@ -92,11 +126,10 @@ func newServiceWithOptions(baseDataPath, issuer string, opts serviceOptions) (*S
 	if err := os.MkdirAll(filepath.Join(baseDataPath, "license"), 0700); err != nil {
 		return nil, fmt.Errorf("create license dir: %w", err)
 	}
-	priv, err := loadOrCreateEd25519Key(opts.signingKeyPath)
+	keys, err := loadSigningKeyRing(opts.signingKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("load token signing key: %w", err)
 	}
-	pub := priv.Public().(ed25519.PublicKey)
 	store, err := NewEntitlementStore(opts.entitlementDBPath)
 	if err != nil {
 		return nil, err
@@ -104,6 +137,13 @@ func newServiceWithOptions(baseDataPath, issuer string, opts serviceOptions) (*S
 	if issuer == "" {
 		issuer = "spaceaware-license"
 	}
+	policy := DefaultPlanPolicy()
+	if opts.planPolicyPath != "" {
+		if policy, err = LoadPlanPolicy(opts.planPolicyPath); err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+	}
 	pluginRoot := strings.TrimSpace(os.Getenv("SDN_PLUGIN_ROOT"))
 	if pluginRoot == "" {
 		pluginRoot = DefaultPluginRoot(baseDataPath)
@@ -113,18 +153,46 @@ func newServiceWithOptions(baseDataPath, issuer string, opts serviceOptions) (*S
 		_ = store.Close()
 		return nil, fmt.Errorf("load plugin registry: %w", err)
 	}
+	trust, err := LoadTrustStore(opts.trustStorePath)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	publishers, err := LoadPublisherStore(opts.publishersPath)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	revocations := NewRevocationList()
+	stored, err := store.ListRevocations(time.Now())
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	for _, r := range stored {
+		revocations.Add(r)
+	}
 	svc := &Service{
 		store:        store,
-		privateKey:   priv,
-		publicKey:    pub,
+		keys:         keys,
+		revocations:  revocations,
+		trust:        trust,
+		publishers:   publishers,
 		issuer:       issuer,
 		plugins:      plugins,
 		challengeTTL: opts.challengeTTL,
 		tokenTTL:     opts.tokenTTL,
 		clockSkew:    opts.clockSkew,
+		policy:       policy,
+		policyPath:   opts.planPolicyPath,
+		stripe:       opts.stripe,
 		challenges:   make(map[string]pendingChallenge),
 	}
-	svc.verifier = NewTokenVerifier(pub, issuer)
+	_, priv := keys.active()
+	svc.verifier = NewTokenVerifier(priv.Public().(ed25519.PublicKey), issuer)
+	svc.verifier.SetKeys(keys.verificationKeys())
+	svc.verifier.SetRevocations(revocations)
+	svc.verifier.SetTrustStore(trust)
 	if plugins.Count() > 0 {
 		log.Infof("Loaded %d encrypted plugin bundle(s) from %s", plugins.Count(), pluginRoot)
 	}
@@ -151,7 +219,8 @@ func (s *Service) PluginRegistry() *PluginRegistry {
 
 // PublicKeyHex returns the token verification key for distribution.
 func (s *Service) PublicKeyHex() string {
-	return hex.EncodeToString(s.publicKey)
+	_, priv := s.keys.active()
+	return hex.EncodeToString(priv.Public().(ed25519.PublicKey))
 }
 
 // GetEntitlement returns entitlement for xpub.
@@ -159,6 +228,49 @@ func (s *Service) GetEntitlement(xpub string) (*Entitlement, error) {
 	return s.store.GetEntitlement(xpub)
 }
 
+// EntitlementClaims returns the claims a capability token issued now to xpub
+// would carry, from its active entitlement. It does not create entitlements:
+// an xpub without an active one gets an error.
+func (s *Service) EntitlementClaims(xpub, peerID string) (*CapabilityClaims, error) {
+	ent, err := s.store.GetEntitlement(xpub)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !ent.IsActive(now) {
+		return nil, fmt.Errorf("no active entitlement for %s", xpub)
+	}
+	claims := s.entitlementClaims(ent, xpub, peerID, now)
+	return &claims, nil
+}
+
+// entitlementClaims resolves an entitlement's plan into capability claims.
+func (s *Service) entitlementClaims(ent *Entitlement, xpub, peerID string, now time.Time) CapabilityClaims {
+	s.policyMu.RLock()
+	scopes, ttl := s.policy.Resolve(ent.Plan)
+	s.policyMu.RUnlock()
+	if ttl <= 0 {
+		ttl = s.tokenTTL
+	}
+	exp := now.Add(ttl)
+	if ent.ExpiresAt > 0 {
+		entExp := time.Unix(ent.ExpiresAt, 0)
+		if entExp.Before(exp) {
+			exp = entExp
+		}
+	}
+	return CapabilityClaims{
+		Iss:    s.issuer,
+		Sub:    xpub,
+		PeerID: peerID,
+		Plan:   ent.Plan,
+		Scopes: scopes,
+		Iat:    now.Unix(),
+		Exp:    exp.Unix(),
+		JTI:    uuid.NewString(),
+	}
+}
+
 // UpsertEntitlement updates entitlement state.
 func (s *Service) UpsertEntitlement(ent *Entitlement) error {
 	return s.store.UpsertEntitlement(ent)
@@ -363,24 +475,9 @@ func (s *Service) handleProofRequest(req ProofRequest) (*GrantResponse, *ErrorRe
 		return nil, &ErrorResponse{Type: msgTypeErrorResponse, Code: "entitlement_inactive", Message: "subscription is not active"}
 	}
 
-	exp := now.Add(s.tokenTTL)
-	if ent.ExpiresAt > 0 {
-		entExp := time.Unix(ent.ExpiresAt, 0)
-		if entExp.Before(exp) {
-			exp = entExp
-		}
-	}
-	claims := CapabilityClaims{
-		Iss:    s.issuer,
-		Sub:    req.XPub,
-		PeerID: req.PeerID,
-		Plan:   ent.Plan,
-		Scopes: scopesForPlan(ent.Plan),
-		Iat:    now.Unix(),
-		Exp:    exp.Unix(),
-		JTI:    uuid.NewString(),
-	}
-	token, err := SignCapabilityToken(claims, s.privateKey)
+	claims := s.entitlementClaims(ent, req.XPub, req.PeerID, now)
+	kid, priv := s.keys.active()
+	token, err := SignCapabilityTokenWithKID(claims, priv, kid)
 	if err != nil {
 		return nil, &ErrorResponse{Type: msgTypeErrorResponse, Code: "server_error", Message: "failed to sign capability token"}
 	}
@@ -404,17 +501,6 @@ func (s *Service) cleanupChallenges(now time.Time) {
 	}
 }
 
-func scopesForPlan(plan string) []string {
-	normalized := strings.ToLower(strings.TrimSpace(plan))
-	scopes := []string{"api:data:read:free", "orbpro:base"}
-	switch normalized {
-	case "free", "":
-		return scopes
-	default:
-		return append(scopes, "api:data:read:premium", "orbpro:premium")
-	}
-}
-
 func withinClockSkew(ts int64, skew time.Duration) bool {
 	if ts <= 0 {
 		return false
@@ -64,7 +64,10 @@ CREATE INDEX IF NOT EXISTS idx_entitlements_status ON entitlements(status);
 	if err != nil {
 		return fmt.Errorf("init entitlement schema: %w", err)
 	}
-	return nil
+	if err := s.initRevocationSchema(); err != nil {
+		return err
+	}
+	return s.initStripeSchema()
 }
 
 // Close closes the underlying database.
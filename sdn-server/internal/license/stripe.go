@@ -0,0 +1,561 @@
+package license
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStripeAPIURL = "https://api.stripe.com"
+
+	// Paid periods are extended by a grace period so the renewal invoice has
+	// time to land before the entitlement lapses.
+	defaultStripeGracePeriod       = 24 * time.Hour
+	defaultStripeReconcileInterval = time.Hour
+	stripeSignatureTolerance       = 5 * time.Minute
+	maxStripeWebhookBytes          = 1 << 20
+	maxStripeResponseBytes         = 1 << 20
+	stripeRequestTimeout           = 30 * time.Second
+	stripeMetadataXPub             = "xpub"
+	stripeMetadataPlan             = "plan"
+	stripeReconcileEventPrefix     = "reconcile:"
+)
+
+// stripeConfig configures entitlement sync with Stripe or a Stripe-compatible
+// API such as a local mock.
+type stripeConfig struct {
+	apiURL            string
+	secretKey         string
+	webhookSecret     string
+	gracePeriod       time.Duration
+	reconcileInterval time.Duration
+}
+
+// stripeConfigFromEnv reads STRIPE_SECRET_KEY, SDN_LICENSE_STRIPE_API_URL,
+// SDN_LICENSE_STRIPE_WEBHOOK_SECRET (falling back to STRIPE_WEBHOOK_SECRET),
+// SDN_LICENSE_STRIPE_GRACE and SDN_LICENSE_STRIPE_RECONCILE_INTERVAL.
+func stripeConfigFromEnv() stripeConfig {
+	cfg := stripeConfig{
+		apiURL:            defaultStripeAPIURL,
+		secretKey:         strings.TrimSpace(os.Getenv("STRIPE_SECRET_KEY")),
+		webhookSecret:     strings.TrimSpace(os.Getenv("SDN_LICENSE_STRIPE_WEBHOOK_SECRET")),
+		gracePeriod:       defaultStripeGracePeriod,
+		reconcileInterval: defaultStripeReconcileInterval,
+	}
+	if v := strings.TrimSpace(os.Getenv("SDN_LICENSE_STRIPE_API_URL")); v != "" {
+		cfg.apiURL = v
+	}
+	if cfg.webhookSecret == "" {
+		cfg.webhookSecret = strings.TrimSpace(os.Getenv("STRIPE_WEBHOOK_SECRET"))
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("SDN_LICENSE_STRIPE_GRACE"))); err == nil && d >= 0 {
+		cfg.gracePeriod = d
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("SDN_LICENSE_STRIPE_RECONCILE_INTERVAL"))); err == nil && d > 0 {
+		cfg.reconcileInterval = d
+	}
+	return cfg
+}
+
+// ErrStripeUnmatched indicates a Stripe object could not be tied to an
+// entitlement.
+var ErrStripeUnmatched = errors.New("stripe subscription has no matching entitlement")
+
+// stripeRef is a Stripe object reference that may arrive as an ID or as an
+// expanded object.
+type stripeRef string
+
+func (r *stripeRef) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*r = stripeRef(id)
+		return nil
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*r = stripeRef(obj.ID)
+	return nil
+}
+
+type stripeEventEnvelope struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeSubscription struct {
+	ID               string            `json:"id"`
+	Customer         stripeRef         `json:"customer"`
+	Status           string            `json:"status"`
+	CurrentPeriodEnd int64             `json:"current_period_end"`
+	EndedAt          int64             `json:"ended_at"`
+	Metadata         map[string]string `json:"metadata"`
+	Items            struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				LookupKey string            `json:"lookup_key"`
+				Metadata  map[string]string `json:"metadata"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// periodEnd returns the end of the paid period. Newer API versions report it
+// per subscription item.
+func (sub stripeSubscription) periodEnd() int64 {
+	end := sub.CurrentPeriodEnd
+	for _, item := range sub.Items.Data {
+		if item.CurrentPeriodEnd > end {
+			end = item.CurrentPeriodEnd
+		}
+	}
+	return end
+}
+
+// plan returns the plan named in the subscription or price metadata, or the
+// price lookup key.
+func (sub stripeSubscription) plan() string {
+	if p := sub.Metadata[stripeMetadataPlan]; p != "" {
+		return p
+	}
+	for _, item := range sub.Items.Data {
+		if p := item.Price.Metadata[stripeMetadataPlan]; p != "" {
+			return p
+		}
+		if item.Price.LookupKey != "" {
+			return item.Price.LookupKey
+		}
+	}
+	return ""
+}
+
+type stripeInvoice struct {
+	ID           string    `json:"id"`
+	Customer     stripeRef `json:"customer"`
+	Subscription stripeRef `json:"subscription"`
+	PeriodEnd    int64     `json:"period_end"`
+	Parent       struct {
+		SubscriptionDetails struct {
+			Subscription stripeRef `json:"subscription"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+	Lines struct {
+		Data []struct {
+			Period struct {
+				End int64 `json:"end"`
+			} `json:"period"`
+		} `json:"data"`
+	} `json:"lines"`
+}
+
+func (inv stripeInvoice) subscriptionID() string {
+	if inv.Subscription != "" {
+		return string(inv.Subscription)
+	}
+	return string(inv.Parent.SubscriptionDetails.Subscription)
+}
+
+// periodEnd returns the end of the latest period the invoice covers.
+func (inv stripeInvoice) periodEnd() int64 {
+	var end int64
+	for _, line := range inv.Lines.Data {
+		if line.Period.End > end {
+			end = line.Period.End
+		}
+	}
+	if end == 0 {
+		end = inv.PeriodEnd
+	}
+	return end
+}
+
+// stripeEntitlementStatus maps a Stripe subscription status to an
+// entitlement status.
+func stripeEntitlementStatus(status string) string {
+	switch status {
+	case "active", "trialing":
+		return entitlementStatusActive
+	case "past_due", "unpaid", "incomplete":
+		return entitlementStatusPastDue
+	case "paused":
+		return entitlementStatusSuspended
+	default: // canceled, incomplete_expired
+		return entitlementStatusCancelled
+	}
+}
+
+// StripeSyncResult reports what a webhook or reconciliation pass did.
+type StripeSyncResult struct {
+	EventType      string       `json:"event_type,omitempty"`
+	SubscriptionID string       `json:"subscription_id,omitempty"`
+	Entitlement    *Entitlement `json:"entitlement,omitempty"`
+	Changed        bool         `json:"changed"`
+	// Ignored is set for events that do not concern entitlements, were
+	// already processed, or are older than the entitlement's Stripe state.
+	Ignored bool   `json:"ignored,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// StripeReconcileResult summarizes a reconciliation pass.
+type StripeReconcileResult struct {
+	Checked int      `json:"checked"`
+	Updated int      `json:"updated"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func (s *EntitlementStore) initStripeSchema() error {
+	_, err := s.db.Exec(`
+CREATE TABLE IF NOT EXISTS stripe_events (
+	event_id TEXT PRIMARY KEY,
+	subscription_id TEXT NOT NULL,
+	created INTEGER NOT NULL,
+	processed_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_stripe_events_subscription ON stripe_events(subscription_id, created);
+CREATE INDEX IF NOT EXISTS idx_entitlements_stripe_subscription ON entitlements(stripe_subscription_id);
+CREATE INDEX IF NOT EXISTS idx_entitlements_stripe_customer ON entitlements(stripe_customer_id);
+-- Reconciliation passes used to be recorded once per pass.
+DELETE FROM stripe_events WHERE event_id LIKE 'reconcile:%:%';
+`)
+	if err != nil {
+		return fmt.Errorf("init stripe schema: %w", err)
+	}
+	return nil
+}
+
+// FindEntitlementByStripe returns the entitlement linked to a Stripe
+// subscription or, failing that, to a customer without a subscription yet.
+func (s *EntitlementStore) FindEntitlementByStripe(subscriptionID, customerID string) (*Entitlement, error) {
+	var xpub string
+	err := s.db.QueryRow(`SELECT xpub FROM entitlements WHERE stripe_subscription_id = ? AND stripe_subscription_id != ''`, subscriptionID).Scan(&xpub)
+	if errors.Is(err, sql.ErrNoRows) && customerID != "" {
+		err = s.db.QueryRow(`
+SELECT xpub FROM entitlements
+WHERE stripe_customer_id = ? AND COALESCE(stripe_subscription_id, '') = ''
+ORDER BY updated_at DESC LIMIT 1`, customerID).Scan(&xpub)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find stripe entitlement: %w", err)
+	}
+	return s.GetEntitlement(xpub)
+}
+
+// ListStripeSubscriptionIDs returns every subscription linked to an
+// entitlement.
+func (s *EntitlementStore) ListStripeSubscriptionIDs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT stripe_subscription_id FROM entitlements WHERE COALESCE(stripe_subscription_id, '') != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("list stripe subscriptions: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan stripe subscription: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// stripeEventState reports whether eventID was already processed and the
+// newest event time recorded for subscriptionID.
+func (s *EntitlementStore) stripeEventState(eventID, subscriptionID string) (bool, int64, error) {
+	var seen int
+	if err := s.db.QueryRow(`SELECT COUNT(1) FROM stripe_events WHERE event_id = ?`, eventID).Scan(&seen); err != nil {
+		return false, 0, fmt.Errorf("query stripe event: %w", err)
+	}
+	var latest sql.NullInt64
+	if err := s.db.QueryRow(`SELECT MAX(created) FROM stripe_events WHERE subscription_id = ?`, subscriptionID).Scan(&latest); err != nil {
+		return false, 0, fmt.Errorf("query stripe event: %w", err)
+	}
+	return seen > 0, latest.Int64, nil
+}
+
+// recordStripeEvent marks eventID processed. A reconciliation row is
+// reused by every pass over its subscription and keeps the latest time.
+func (s *EntitlementStore) recordStripeEvent(eventID, subscriptionID string, created int64) error {
+	_, err := s.db.Exec(`
+INSERT INTO stripe_events (event_id, subscription_id, created, processed_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(event_id) DO UPDATE SET
+	created = MAX(created, excluded.created),
+	processed_at = excluded.processed_at`, eventID, subscriptionID, created, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("record stripe event: %w", err)
+	}
+	return nil
+}
+
+// HandleStripeWebhook verifies a Stripe webhook and applies subscription
+// lifecycle events to the matching entitlement.
+func (s *Service) HandleStripeWebhook(signatureHeader string, payload []byte) (*StripeSyncResult, error) {
+	if s.stripe.webhookSecret == "" {
+		return nil, errors.New("stripe webhook secret is not configured")
+	}
+	if err := verifyStripeSignature(payload, signatureHeader, s.stripe.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	var evt stripeEventEnvelope
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return nil, fmt.Errorf("invalid stripe event payload: %w", err)
+	}
+	if evt.ID == "" {
+		return nil, errors.New("stripe event id is required")
+	}
+
+	switch evt.Type {
+	case "customer.subscription.created", "customer.subscription.updated",
+		"customer.subscription.deleted", "customer.subscription.paused",
+		"customer.subscription.resumed":
+		var sub stripeSubscription
+		if err := json.Unmarshal(evt.Data.Object, &sub); err != nil {
+			return nil, fmt.Errorf("invalid subscription payload: %w", err)
+		}
+		return s.applyStripeSubscription(evt.ID, evt.Type, evt.Created, sub)
+
+	case "invoice.paid", "invoice.payment_succeeded", "invoice.payment_failed":
+		var inv stripeInvoice
+		if err := json.Unmarshal(evt.Data.Object, &inv); err != nil {
+			return nil, fmt.Errorf("invalid invoice payload: %w", err)
+		}
+		subID := inv.subscriptionID()
+		if subID == "" {
+			return &StripeSyncResult{EventType: evt.Type, Ignored: true, Reason: "invoice has no subscription"}, nil
+		}
+		// An invoice carries no subscription status; derive it from the
+		// payment outcome. A renewal extends the paid period.
+		sub := stripeSubscription{ID: subID, Customer: inv.Customer, Status: "active", CurrentPeriodEnd: inv.periodEnd()}
+		if evt.Type == "invoice.payment_failed" {
+			sub.Status = "past_due"
+		}
+		return s.applyStripeSubscription(evt.ID, evt.Type, evt.Created, sub)
+	}
+	return &StripeSyncResult{EventType: evt.Type, Ignored: true, Reason: "event type not handled"}, nil
+}
+
+// applyStripeSubscription updates the entitlement tied to sub unless the
+// event was seen before or is older than the state already applied.
+func (s *Service) applyStripeSubscription(eventID, eventType string, created int64, sub stripeSubscription) (*StripeSyncResult, error) {
+	result := &StripeSyncResult{EventType: eventType, SubscriptionID: sub.ID}
+	if sub.ID == "" {
+		return nil, errors.New("stripe subscription id is required")
+	}
+
+	s.stripeMu.Lock()
+	defer s.stripeMu.Unlock()
+
+	seen, latest, err := s.store.stripeEventState(eventID, sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Reconciliation passes share one event ID per subscription and are
+	// never duplicates of each other.
+	if seen && !strings.HasPrefix(eventID, stripeReconcileEventPrefix) {
+		result.Ignored, result.Reason = true, "event already processed"
+		return result, nil
+	}
+	if created < latest {
+		result.Ignored, result.Reason = true, "event is older than the applied state"
+		return result, s.store.recordStripeEvent(eventID, sub.ID, created)
+	}
+
+	ent, err := s.store.FindEntitlementByStripe(sub.ID, string(sub.Customer))
+	if err != nil {
+		return nil, err
+	}
+	if ent == nil {
+		if xpub := strings.TrimSpace(sub.Metadata[stripeMetadataXPub]); xpub != "" {
+			if ent, err = s.store.GetOrCreateEntitlement(xpub, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ent == nil {
+		return nil, fmt.Errorf("%w: %s", ErrStripeUnmatched, sub.ID)
+	}
+
+	before := *ent
+	ent.StripeSubscriptionID = sub.ID
+	if sub.Customer != "" {
+		ent.StripeCustomerID = string(sub.Customer)
+	}
+	if plan := strings.ToLower(strings.TrimSpace(sub.plan())); plan != "" {
+		if s.PlanPolicy().HasPlan(plan) {
+			ent.Plan = plan
+		} else {
+			log.Warnf("Stripe subscription %s names unknown plan %q; keeping %q", sub.ID, plan, ent.Plan)
+		}
+	}
+	ent.Status = stripeEntitlementStatus(sub.Status)
+	switch ent.Status {
+	case entitlementStatusActive:
+		if end := sub.periodEnd(); end > 0 {
+			ent.ExpiresAt = time.Unix(end, 0).Add(s.stripe.gracePeriod).Unix()
+		}
+	case entitlementStatusCancelled:
+		ent.ExpiresAt = sub.EndedAt
+		if ent.ExpiresAt == 0 {
+			ent.ExpiresAt = time.Now().Unix()
+		}
+	}
+	result.Changed = before != *ent
+	if err := s.store.UpsertEntitlement(ent); err != nil {
+		return nil, err
+	}
+	if err := s.store.recordStripeEvent(eventID, sub.ID, created); err != nil {
+		return nil, err
+	}
+	if result.Changed {
+		log.Infof("Stripe %s: entitlement %s is %s (plan %s, expires %d)", eventType, ent.XPub, ent.Status, ent.Plan, ent.ExpiresAt)
+	}
+	result.Entitlement = ent
+	return result, nil
+}
+
+// StripeReconcileInterval returns how often entitlements should be
+// reconciled against Stripe, or zero when no API key is configured.
+func (s *Service) StripeReconcileInterval() time.Duration {
+	if s.stripe.secretKey == "" {
+		return 0
+	}
+	return s.stripe.reconcileInterval
+}
+
+// ReconcileStripe fetches every linked subscription from the Stripe API and
+// applies its current state, repairing entitlements whose webhooks were
+// missed.
+func (s *Service) ReconcileStripe(ctx context.Context) (*StripeReconcileResult, error) {
+	if s.stripe.secretKey == "" {
+		return nil, errors.New("stripe API key is not configured")
+	}
+	ids, err := s.store.ListStripeSubscriptionIDs()
+	if err != nil {
+		return nil, err
+	}
+	result := &StripeReconcileResult{}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Checked++
+		sub, err := s.fetchStripeSubscription(ctx, id)
+		if err == nil {
+			var applied *StripeSyncResult
+			applied, err = s.applyStripeSubscription(stripeReconcileEventPrefix+id, "reconcile", time.Now().Unix(), *sub)
+			if err == nil && applied.Changed {
+				result.Updated++
+			}
+		}
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", id, err))
+			log.Warnf("Stripe reconciliation of %s failed: %v", id, err)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) fetchStripeSubscription(ctx context.Context, id string) (*stripeSubscription, error) {
+	reqURL := strings.TrimRight(s.stripe.apiURL, "/") + "/v1/subscriptions/" + url.PathEscape(id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.stripe.secretKey)
+	client := &http.Client{Timeout: stripeRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStripeResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("read stripe response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &apiErr)
+		return nil, fmt.Errorf("stripe returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+	var sub stripeSubscription
+	if err := json.Unmarshal(body, &sub); err != nil {
+		return nil, fmt.Errorf("decode stripe subscription: %w", err)
+	}
+	if sub.ID != id {
+		return nil, fmt.Errorf("stripe returned subscription %q for %q", sub.ID, id)
+	}
+	return &sub, nil
+}
+
+// verifyStripeSignature checks a Stripe-Signature header ("t=...,v1=...")
+// against the endpoint secret.
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("missing stripe signature")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid stripe timestamp: %w", err)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > stripeSignatureTolerance || d < -stripeSignatureTolerance {
+		return errors.New("stripe signature timestamp outside tolerance")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if actual, err := hex.DecodeString(sig); err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return errors.New("stripe signature verification failed")
+}
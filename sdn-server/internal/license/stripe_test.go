@@ -0,0 +1,187 @@
+package license
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testStripeWebhookSecret = "whsec_test"
+
+func newStripeTestService(t *testing.T, apiURL string) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	svc, err := newServiceWithOptions(dir, "test-issuer", serviceOptions{
+		entitlementDBPath: filepath.Join(dir, "license", defaultEntitlementDB),
+		signingKeyPath:    filepath.Join(dir, "license", "token_signing_ed25519.seed"),
+		tokenTTL:          defaultTokenTTL,
+		stripe: stripeConfig{
+			apiURL:        apiURL,
+			secretKey:     "sk_test",
+			webhookSecret: testStripeWebhookSecret,
+			gracePeriod:   time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatalf("newServiceWithOptions: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func stripeEvent(t *testing.T, id, typ string, created int64, object interface{}) ([]byte, string) {
+	t.Helper()
+	obj, _ := json.Marshal(object)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"id": id, "type": typ, "created": created,
+		"data": map[string]json.RawMessage{"object": obj},
+	})
+	ts := fmt.Sprint(time.Now().Unix())
+	mac := hmac.New(sha256.New, []byte(testStripeWebhookSecret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return payload, "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeSubscriptionLifecycle(t *testing.T) {
+	svc := newStripeTestService(t, "")
+	now := time.Now().Unix()
+	periodEnd := now + 30*24*3600
+	sub := map[string]interface{}{
+		"id": "sub_1", "customer": "cus_1", "status": "active",
+		"current_period_end": periodEnd,
+		"metadata":           map[string]string{"xpub": "xpub-s", "plan": "pro"},
+	}
+
+	payload, sig := stripeEvent(t, "evt_created", "customer.subscription.created", now, sub)
+	res, err := svc.HandleStripeWebhook(sig, payload)
+	if err != nil {
+		t.Fatalf("created: %v", err)
+	}
+	ent := res.Entitlement
+	if ent == nil || ent.Status != entitlementStatusActive || ent.Plan != "pro" ||
+		ent.StripeCustomerID != "cus_1" || ent.ExpiresAt != periodEnd+3600 {
+		t.Fatalf("created entitlement = %+v", ent)
+	}
+
+	// Replays and out-of-order deliveries are ignored.
+	if res, _ := svc.HandleStripeWebhook(sig, payload); !res.Ignored {
+		t.Fatal("replayed event was applied")
+	}
+
+	failed := map[string]interface{}{"id": "in_1", "customer": "cus_1", "subscription": "sub_1"}
+	payload, sig = stripeEvent(t, "evt_failed", "invoice.payment_failed", now+10, failed)
+	if res, err := svc.HandleStripeWebhook(sig, payload); err != nil || res.Entitlement.Status != entitlementStatusPastDue {
+		t.Fatalf("payment_failed = %+v, %v", res, err)
+	}
+	stale := map[string]interface{}{"id": "sub_1", "customer": "cus_1", "status": "active", "current_period_end": periodEnd}
+	payload, sig = stripeEvent(t, "evt_stale", "customer.subscription.updated", now+5, stale)
+	if res, _ := svc.HandleStripeWebhook(sig, payload); !res.Ignored {
+		t.Fatal("stale event was applied")
+	}
+
+	renewedEnd := periodEnd + 30*24*3600
+	paid := map[string]interface{}{
+		"id": "in_2", "customer": "cus_1", "subscription": "sub_1",
+		"lines": map[string]interface{}{"data": []interface{}{map[string]interface{}{"period": map[string]int64{"end": renewedEnd}}}},
+	}
+	payload, sig = stripeEvent(t, "evt_paid", "invoice.paid", now+20, paid)
+	if res, err := svc.HandleStripeWebhook(sig, payload); err != nil ||
+		res.Entitlement.Status != entitlementStatusActive || res.Entitlement.ExpiresAt != renewedEnd+3600 {
+		t.Fatalf("renewal = %+v, %v", res, err)
+	}
+
+	canceled := map[string]interface{}{"id": "sub_1", "customer": "cus_1", "status": "canceled", "ended_at": now + 30}
+	payload, sig = stripeEvent(t, "evt_deleted", "customer.subscription.deleted", now+30, canceled)
+	if _, err := svc.HandleStripeWebhook(sig, payload); err != nil {
+		t.Fatalf("deleted: %v", err)
+	}
+	got, _ := svc.GetEntitlement("xpub-s")
+	if got.Status != entitlementStatusCancelled || got.ExpiresAt != now+30 || got.IsActive(time.Now()) {
+		t.Fatalf("canceled entitlement = %+v", got)
+	}
+
+	// Bad signatures are refused.
+	if _, err := svc.HandleStripeWebhook(strings.Replace(sig, "v1=", "v1=00", 1), payload); err == nil {
+		t.Fatal("tampered signature accepted")
+	}
+}
+
+func TestReconcileStripe(t *testing.T) {
+	var mu sync.Mutex
+	status := "past_due"
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/v1/subscriptions/")
+		if id != "sub_r" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"No such subscription"}}`))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "sub_r", "customer": map[string]string{"id": "cus_r"}, "status": status,
+			"items": map[string]interface{}{"data": []interface{}{map[string]interface{}{
+				"current_period_end": time.Now().Add(24 * time.Hour).Unix(),
+				"price":              map[string]string{"lookup_key": "starter"},
+			}}},
+		})
+	}))
+	defer mock.Close()
+
+	svc := newStripeTestService(t, mock.URL)
+	for _, ent := range []*Entitlement{
+		{XPub: "xpub-r", Plan: "pro", Status: entitlementStatusActive, StripeSubscriptionID: "sub_r"},
+		{XPub: "xpub-gone", Status: entitlementStatusActive, StripeSubscriptionID: "sub_gone"},
+	} {
+		if err := svc.UpsertEntitlement(ent); err != nil {
+			t.Fatalf("UpsertEntitlement: %v", err)
+		}
+	}
+
+	res, err := svc.ReconcileStripe(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileStripe: %v", err)
+	}
+	if res.Checked != 2 || res.Updated != 1 || res.Failed != 1 {
+		t.Fatalf("reconcile result = %+v", res)
+	}
+	got, _ := svc.GetEntitlement("xpub-r")
+	if got.Status != entitlementStatusPastDue || got.Plan != "starter" || got.StripeCustomerID != "cus_r" {
+		t.Fatalf("reconciled entitlement = %+v", got)
+	}
+
+	// An unchanged subscription is not counted as an update.
+	if res, _ := svc.ReconcileStripe(context.Background()); res.Updated != 0 {
+		t.Fatalf("second pass updated %d entitlements", res.Updated)
+	}
+	mu.Lock()
+	status = "active"
+	mu.Unlock()
+	if res, _ := svc.ReconcileStripe(context.Background()); res.Updated != 1 {
+		t.Fatalf("recovery pass updated %d entitlements", res.Updated)
+	}
+	if got, _ := svc.GetEntitlement("xpub-r"); !got.IsActive(time.Now()) {
+		t.Fatalf("entitlement not active after recovery: %+v", got)
+	}
+
+	// Passes do not pile up in the webhook dedupe table.
+	var rows int
+	if err := svc.store.db.QueryRow(`SELECT COUNT(1) FROM stripe_events WHERE subscription_id = 'sub_r'`).Scan(&rows); err != nil || rows != 1 {
+		t.Fatalf("stripe_events rows for sub_r = %d, %v; want 1", rows, err)
+	}
+}
@@ -2,11 +2,14 @@ package license
 
 import (
 	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,11 +36,23 @@ var (
 	ErrTokenPeerIDMismatch = errors.New("token peer_id mismatch")
 	// ErrTokenMissingScope indicates one or more required scopes are absent.
 	ErrTokenMissingScope = errors.New("token missing required scope")
+	// ErrTokenRevoked indicates the token or its subject was revoked.
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrUnknownSigningKey indicates the token was signed by a key that is
+	// unknown or outside its validity window.
+	ErrUnknownSigningKey = errors.New("token signed by unknown or retired key")
 )
 
 type tokenHeader struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// KeyID derives the key ID carried in token headers from a public key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
 }
 
 // CapabilityClaims are server-signed claims used to authorize paid capabilities.
@@ -61,22 +76,63 @@ type VerifyOptions struct {
 	RequiredScopes []string
 }
 
-// TokenVerifier validates capability tokens against a known public key.
+// TokenVerifier validates capability tokens against an issuer's key set.
 type TokenVerifier struct {
-	publicKey ed25519.PublicKey
-	issuer    string
-	leeway    time.Duration
+	issuer string
+	leeway time.Duration
+
+	mu          sync.RWMutex
+	keys        []IssuerKey
+	revocations *RevocationList
+	trust       *TrustStore
 }
 
-// NewTokenVerifier creates a token verifier.
+// NewTokenVerifier creates a token verifier for a single key.
 func NewTokenVerifier(publicKey ed25519.PublicKey, issuer string) *TokenVerifier {
 	return &TokenVerifier{
-		publicKey: append(ed25519.PublicKey(nil), publicKey...),
-		issuer:    issuer,
-		leeway:    defaultVerifyLeeway,
+		issuer: issuer,
+		leeway: defaultVerifyLeeway,
+		keys: []IssuerKey{{
+			KID:          KeyID(publicKey),
+			PublicKeyHex: hex.EncodeToString(publicKey),
+		}},
 	}
 }
 
+// SetKeys replaces the verification key set, e.g. after a key rotation.
+func (v *TokenVerifier) SetKeys(keys []IssuerKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys = append([]IssuerKey(nil), keys...)
+}
+
+// Keys returns the verification key set.
+func (v *TokenVerifier) Keys() []IssuerKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]IssuerKey(nil), v.keys...)
+}
+
+// Issuer returns the issuer tokens must name.
+func (v *TokenVerifier) Issuer() string {
+	return v.issuer
+}
+
+// SetRevocations makes the verifier reject tokens on list.
+func (v *TokenVerifier) SetRevocations(list *RevocationList) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.revocations = list
+}
+
+// SetTrustStore makes the verifier accept tokens from trusted foreign
+// issuers, limited to the scopes each may grant.
+func (v *TokenVerifier) SetTrustStore(trust *TrustStore) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.trust = trust
+}
+
 // VerifyAuthorizationHeader verifies a Bearer token from an HTTP Authorization header.
 func (v *TokenVerifier) VerifyAuthorizationHeader(authHeader, expectedPeerID string, requiredScopes []string) (*CapabilityClaims, error) {
 	token, err := ExtractBearerToken(authHeader)
@@ -86,7 +142,10 @@ func (v *TokenVerifier) VerifyAuthorizationHeader(authHeader, expectedPeerID str
 	return v.VerifyToken(token, expectedPeerID, requiredScopes)
 }
 
-// VerifyToken verifies a compact capability token.
+// VerifyToken verifies a compact capability token. The signing key is chosen
+// by the kid header; tokens without one are checked against every own key.
+// A kid that is not one of the verifier's keys is looked up in the trust
+// store, and the token's scopes are cut down to what that issuer may grant.
 func (v *TokenVerifier) VerifyToken(token, expectedPeerID string, requiredScopes []string) (*CapabilityClaims, error) {
 	opts := VerifyOptions{
 		Issuer:         v.issuer,
@@ -94,7 +153,64 @@ func (v *TokenVerifier) VerifyToken(token, expectedPeerID string, requiredScopes
 		RequiredScopes: requiredScopes,
 		Leeway:         v.leeway,
 	}
-	return VerifyCapabilityToken(token, v.publicKey, opts)
+	parsed, err := parseCapabilityToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	keys := v.keys
+	revocations := v.revocations
+	trust := v.trust
+	v.mu.RUnlock()
+
+	now := time.Now()
+	var key *IssuerKey
+	for i := range keys {
+		k := &keys[i]
+		if parsed.header.Kid != "" && k.KID != parsed.header.Kid {
+			continue
+		}
+		if pub, ok := k.publicKey(); ok && ed25519.Verify(pub, []byte(parsed.signingInput), parsed.signature) {
+			key = k
+			break
+		}
+	}
+	claims := parsed.claims
+	if key == nil {
+		if parsed.header.Kid == "" {
+			return nil, ErrInvalidTokenSignature
+		}
+		if _, own := findKey(keys, parsed.header.Kid); own || trust == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, parsed.header.Kid)
+		}
+		issuer, k, ok := trust.lookupKID(parsed.header.Kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, parsed.header.Kid)
+		}
+		pub, ok := k.publicKey()
+		if !ok || !ed25519.Verify(pub, []byte(parsed.signingInput), parsed.signature) {
+			return nil, ErrInvalidTokenSignature
+		}
+		if !issuer.activeAt(now) {
+			return nil, fmt.Errorf("%w: %s", ErrIssuerNotTrusted, issuer.Issuer)
+		}
+		key = &k
+		opts.Issuer = issuer.Issuer
+		claims.Scopes = issuer.grant(claims.Scopes)
+	}
+	if !key.validFor(claims.Iat, now, v.leeway) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, key.KID)
+	}
+
+	checked, err := checkCapabilityClaims(claims, opts)
+	if err != nil {
+		return nil, err
+	}
+	if revocations != nil && revocations.IsRevoked(checked) {
+		return nil, ErrTokenRevoked
+	}
+	return checked, nil
 }
 
 // ExtractBearerToken parses an Authorization header and returns the bearer token.
@@ -116,12 +232,19 @@ func ExtractBearerToken(authHeader string) (string, error) {
 
 // SignCapabilityToken signs capability claims with Ed25519 in compact JWT-like form.
 func SignCapabilityToken(claims CapabilityClaims, privateKey ed25519.PrivateKey) (string, error) {
+	return SignCapabilityTokenWithKID(claims, privateKey, "")
+}
+
+// SignCapabilityTokenWithKID signs capability claims and names the signing key
+// in the token header so verifiers can pick it from a rotated key set.
+func SignCapabilityTokenWithKID(claims CapabilityClaims, privateKey ed25519.PrivateKey, kid string) (string, error) {
 	if len(privateKey) != ed25519.PrivateKeySize {
 		return "", fmt.Errorf("invalid private key size: %d", len(privateKey))
 	}
 	header := tokenHeader{
 		Alg: "EdDSA",
 		Typ: "JWT",
+		Kid: kid,
 	}
 	headerJSON, err := json.Marshal(header)
 	if err != nil {
@@ -142,6 +265,25 @@ func SignCapabilityToken(claims CapabilityClaims, privateKey ed25519.PrivateKey)
 
 // VerifyCapabilityToken verifies signature and registered claims.
 func VerifyCapabilityToken(token string, publicKey ed25519.PublicKey, opts VerifyOptions) (*CapabilityClaims, error) {
+	parsed, err := parseCapabilityToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(publicKey, []byte(parsed.signingInput), parsed.signature) {
+		return nil, ErrInvalidTokenSignature
+	}
+	return checkCapabilityClaims(parsed.claims, opts)
+}
+
+type parsedToken struct {
+	header       tokenHeader
+	claims       CapabilityClaims
+	signingInput string
+	signature    []byte
+}
+
+// parseCapabilityToken decodes a compact token without verifying it.
+func parseCapabilityToken(token string) (*parsedToken, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
 		return nil, ErrInvalidTokenFormat
@@ -160,15 +302,10 @@ func VerifyCapabilityToken(token string, publicKey ed25519.PublicKey, opts Verif
 		return nil, fmt.Errorf("%w: expected EdDSA, got %s", ErrInvalidTokenFormat, hdr.Alg)
 	}
 
-	signingInput := parts[0] + "." + parts[1]
-
 	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
 	if err != nil {
 		return nil, ErrInvalidTokenFormat
 	}
-	if !ed25519.Verify(publicKey, []byte(signingInput), signature) {
-		return nil, ErrInvalidTokenSignature
-	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
@@ -178,7 +315,17 @@ func VerifyCapabilityToken(token string, publicKey ed25519.PublicKey, opts Verif
 	if err := json.Unmarshal(payload, &claims); err != nil {
 		return nil, ErrInvalidTokenFormat
 	}
+	return &parsedToken{
+		header:       hdr,
+		claims:       claims,
+		signingInput: parts[0] + "." + parts[1],
+		signature:    signature,
+	}, nil
+}
 
+// checkCapabilityClaims validates the registered claims of a token whose
+// signature has been verified.
+func checkCapabilityClaims(claims CapabilityClaims, opts VerifyOptions) (*CapabilityClaims, error) {
 	now := opts.Now
 	if now.IsZero() {
 		now = time.Now()
@@ -212,6 +359,16 @@ func VerifyCapabilityToken(token string, publicKey ed25519.PublicKey, opts Verif
 	return &claims, nil
 }
 
+// HasAnyScope reports whether the claims carry at least one of scopes.
+func (c *CapabilityClaims) HasAnyScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if hasScope(c.Scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
 func hasScope(scopes []string, required string) bool {
 	for _, s := range scopes {
 		if s == required {
@@ -0,0 +1,547 @@
+package license
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTrustStoreFile = "trusted_issuers.json"
+
+	// IssuerDescriptorPrefix prefixes the text form of an IssuerDescriptor.
+	IssuerDescriptorPrefix = "sdn-license-issuer:v1:"
+	// LicenseIssuerAddressType is the EPM CryptoKey ADDRESS_TYPE whose
+	// KEY_ADDRESS carries the node's issuer descriptor.
+	LicenseIssuerAddressType = "sdn-license-issuer"
+	// VCardLicenseIssuerProperty is the vCard property carrying the
+	// descriptor.
+	VCardLicenseIssuerProperty = "X-SDN-LICENSE-ISSUER"
+
+	// Trust sources recorded on imported issuers.
+	TrustSourceDescriptor = "descriptor"
+	TrustSourceEPM        = "epm"
+	TrustSourceVCard      = "vcard"
+)
+
+// ErrIssuerNotTrusted indicates the token's issuer is not in the trust store
+// or its trust window is closed.
+var ErrIssuerNotTrusted = errors.New("token issuer not trusted")
+
+// IssuerDescriptor is a licensing node's self-signed statement of its issuer
+// ID and verification keys. Nodes publish it in their EPM and vCard so other
+// operators can import it into their trust store.
+type IssuerDescriptor struct {
+	Issuer string      `json:"iss"`
+	Keys   []IssuerKey `json:"keys"`
+	// Scopes lists what the issuer grants under its plan policy. Importers
+	// decide what to honor; this is informational.
+	Scopes       []string `json:"scopes,omitempty"`
+	Timestamp    int64    `json:"timestamp"`
+	KID          string   `json:"kid"`
+	SignatureHex string   `json:"signature_hex"`
+}
+
+func (d IssuerDescriptor) signingBytes() []byte {
+	d.SignatureHex = ""
+	data, _ := json.Marshal(d)
+	return data
+}
+
+// Verify checks that the descriptor is well-formed and signed by one of the
+// keys it lists.
+func (d IssuerDescriptor) Verify() error {
+	if strings.TrimSpace(d.Issuer) == "" {
+		return errors.New("descriptor issuer is required")
+	}
+	if len(d.Keys) == 0 {
+		return errors.New("descriptor lists no keys")
+	}
+	for _, k := range d.Keys {
+		pub, ok := k.publicKey()
+		if !ok || KeyID(pub) != k.KID {
+			return fmt.Errorf("descriptor key %s is invalid", k.KID)
+		}
+	}
+	if d.Timestamp > time.Now().Add(defaultVerifyLeeway).Unix() {
+		return errors.New("descriptor timestamp is in the future")
+	}
+	return verifyIssuerSignature(d.Keys, d.KID, d.Timestamp, d.signingBytes(), d.SignatureHex)
+}
+
+// Encode returns the descriptor's text form for EPM and vCard fields.
+func (d IssuerDescriptor) Encode() string {
+	data, _ := json.Marshal(d)
+	return IssuerDescriptorPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseIssuerDescriptor decodes the text form produced by Encode. It does not
+// verify the signature.
+func ParseIssuerDescriptor(s string) (IssuerDescriptor, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, IssuerDescriptorPrefix) {
+		return IssuerDescriptor{}, errors.New("not an issuer descriptor")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, IssuerDescriptorPrefix))
+	if err != nil {
+		return IssuerDescriptor{}, fmt.Errorf("decode issuer descriptor: %w", err)
+	}
+	var d IssuerDescriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return IssuerDescriptor{}, fmt.Errorf("decode issuer descriptor: %w", err)
+	}
+	return d, nil
+}
+
+// DescriptorFromVCard returns the issuer descriptor carried in a vCard's
+// X-SDN-LICENSE-ISSUER property.
+func DescriptorFromVCard(card string) (string, error) {
+	// Unfold continuation lines (RFC 6350 section 3.2) before matching.
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(card))
+	sc.Buffer(make([]byte, 0, 4096), defaultRequestMaxLen)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("read vCard: %w", err)
+	}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(name, ";")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:] // property group
+		}
+		if strings.EqualFold(name, VCardLicenseIssuerProperty) {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("vCard has no %s property", VCardLicenseIssuerProperty)
+}
+
+// AttestedEPM is what a peer's EPM binds to it once verified: the EPM's
+// signing key, its names and the license issuer key it publishes.
+type AttestedEPM struct {
+	PeerID        string
+	SigningKeyHex string
+	DN            string
+	LegalName     string
+	Email         string
+	// IssuerDescriptor and IssuerKeyHex are the EPM's sdn-license-issuer
+	// key, if it has one.
+	IssuerDescriptor string
+	IssuerKeyHex     string
+}
+
+// EPMVerifier verifies peerID's EPM and returns what it attests. With no
+// epmData it uses the last EPM the node verified from that peer; otherwise
+// signatureHex must be the peer's announcement signature over the EPM's CID.
+type EPMVerifier func(peerID string, epmData []byte, signatureHex string) (*AttestedEPM, error)
+
+// ErrNoEPMVerifier indicates the service cannot verify EPMs, so issuers
+// and publishers cannot be imported from them.
+var ErrNoEPMVerifier = errors.New("EPM verification is not available")
+
+// DescriptorFromEPM returns the issuer descriptor a verified EPM publishes.
+// The descriptor must be signed and list the issuer key the EPM carries, so
+// it belongs to the peer that attested the EPM.
+func DescriptorFromEPM(a *AttestedEPM) (string, error) {
+	if a == nil || a.IssuerDescriptor == "" || a.IssuerKeyHex == "" {
+		return "", errors.New("EPM has no license issuer key")
+	}
+	d, err := ParseIssuerDescriptor(a.IssuerDescriptor)
+	if err != nil {
+		return "", err
+	}
+	if err := d.Verify(); err != nil {
+		return "", fmt.Errorf("issuer descriptor: %w", err)
+	}
+	for _, k := range d.Keys {
+		if strings.EqualFold(k.PublicKeyHex, a.IssuerKeyHex) {
+			return a.IssuerDescriptor, nil
+		}
+	}
+	return "", errors.New("issuer descriptor does not list the EPM's license issuer key")
+}
+
+// verifyIssuerSignature checks sigHex over msg against the key kid of an
+// issuer key set at time at.
+func verifyIssuerSignature(keys []IssuerKey, kid string, at int64, msg []byte, sigHex string) error {
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("invalid signature encoding")
+	}
+	for _, k := range keys {
+		if k.KID != kid {
+			continue
+		}
+		pub, ok := k.publicKey()
+		if !ok || !k.validFor(at, time.Unix(at, 0), defaultVerifyLeeway) {
+			break
+		}
+		if ed25519.Verify(pub, msg, sig) {
+			return nil
+		}
+		return ErrInvalidTokenSignature
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+}
+
+// TrustedIssuer is a foreign licensing node whose tokens this node honors.
+type TrustedIssuer struct {
+	Issuer string      `json:"iss"`
+	Keys   []IssuerKey `json:"keys"`
+	// AllowedScopes bounds what the issuer may grant here. A trailing "*"
+	// matches any scope with that prefix, e.g. "api:data:read:*".
+	AllowedScopes []string `json:"allowed_scopes"`
+	NotBefore     int64    `json:"not_before,omitempty"`
+	NotAfter      int64    `json:"not_after,omitempty"`
+	Source        string   `json:"source"`
+	// PeerID is the peer whose verified EPM published the issuer, for
+	// issuers imported from an EPM or vCard.
+	PeerID string `json:"peer_id,omitempty"`
+	// DescriptorTimestamp is the signing time of the imported descriptor;
+	// older descriptors cannot replace newer ones.
+	DescriptorTimestamp int64 `json:"descriptor_timestamp"`
+	AddedAt             int64 `json:"added_at"`
+}
+
+// TrustGrant is what an operator allows an imported issuer.
+type TrustGrant struct {
+	AllowedScopes []string `json:"allowed_scopes"`
+	NotBefore     int64    `json:"not_before,omitempty"`
+	NotAfter      int64    `json:"not_after,omitempty"`
+	Source        string   `json:"source,omitempty"`
+}
+
+func (g TrustGrant) validate() error {
+	if len(g.AllowedScopes) == 0 {
+		return errors.New("allowed_scopes is required")
+	}
+	for _, scope := range g.AllowedScopes {
+		if strings.TrimSpace(scope) == "" || strings.ContainsAny(scope, " \t\r\n") {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+		if i := strings.Index(scope, "*"); i >= 0 && i != len(scope)-1 {
+			return fmt.Errorf("scope %q may only end in a wildcard", scope)
+		}
+	}
+	if g.NotAfter != 0 && g.NotAfter <= g.NotBefore {
+		return errors.New("not_after must be after not_before")
+	}
+	return nil
+}
+
+// activeAt reports whether the trust window is open at now.
+func (t TrustedIssuer) activeAt(now time.Time) bool {
+	return (t.NotBefore == 0 || now.Unix() >= t.NotBefore) &&
+		(t.NotAfter == 0 || now.Unix() < t.NotAfter)
+}
+
+// allows reports whether the issuer may grant scope.
+func (t TrustedIssuer) allows(scope string) bool {
+	for _, allowed := range t.AllowedScopes {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(scope, prefix) {
+				return true
+			}
+		} else if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// grant intersects scopes with what the issuer is allowed to grant.
+func (t TrustedIssuer) grant(scopes []string) []string {
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if t.allows(scope) {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
+
+// TrustStore holds the foreign issuers whose tokens are honored.
+type TrustStore struct {
+	mu      sync.RWMutex
+	path    string
+	issuers map[string]TrustedIssuer
+}
+
+// LoadTrustStore reads the trust store at path. A missing file yields an
+// empty store; an empty path keeps the store in memory.
+func LoadTrustStore(path string) (*TrustStore, error) {
+	ts := &TrustStore{path: path, issuers: make(map[string]TrustedIssuer)}
+	if path == "" {
+		return ts, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read trust store: %w", err)
+	}
+	var list []TrustedIssuer
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode trust store: %w", err)
+	}
+	for _, t := range list {
+		ts.issuers[t.Issuer] = t
+	}
+	return ts, nil
+}
+
+func (ts *TrustStore) saveLocked() error {
+	if ts.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ts.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0700); err != nil {
+		return err
+	}
+	tmp := ts.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("write trust store: %w", err)
+	}
+	return os.Rename(tmp, ts.path)
+}
+
+func (ts *TrustStore) listLocked() []TrustedIssuer {
+	out := make([]TrustedIssuer, 0, len(ts.issuers))
+	for _, t := range ts.issuers {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Issuer < out[j].Issuer })
+	return out
+}
+
+// Put adds or replaces a trusted issuer. Key IDs must not collide with
+// another issuer's, and a descriptor older than the stored one is rejected.
+func (ts *TrustStore) Put(t TrustedIssuer) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if cur, ok := ts.issuers[t.Issuer]; ok && t.DescriptorTimestamp < cur.DescriptorTimestamp {
+		return fmt.Errorf("issuer %s already trusted with a newer descriptor", t.Issuer)
+	}
+	for _, other := range ts.issuers {
+		if other.Issuer == t.Issuer {
+			continue
+		}
+		for _, k := range t.Keys {
+			if _, ok := findKey(other.Keys, k.KID); ok {
+				return fmt.Errorf("key %s is already trusted for issuer %s", k.KID, other.Issuer)
+			}
+		}
+	}
+	prev, had := ts.issuers[t.Issuer]
+	ts.issuers[t.Issuer] = t
+	if err := ts.saveLocked(); err != nil {
+		if had {
+			ts.issuers[t.Issuer] = prev
+		} else {
+			delete(ts.issuers, t.Issuer)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove stops trusting issuer and reports whether it was trusted.
+func (ts *TrustStore) Remove(issuer string) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	prev, ok := ts.issuers[issuer]
+	if !ok {
+		return false, nil
+	}
+	delete(ts.issuers, issuer)
+	if err := ts.saveLocked(); err != nil {
+		ts.issuers[issuer] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns the trusted issuers sorted by issuer ID.
+func (ts *TrustStore) List() []TrustedIssuer {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.listLocked()
+}
+
+// Get returns the trusted issuer with ID issuer.
+func (ts *TrustStore) Get(issuer string) (TrustedIssuer, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.issuers[issuer]
+	return t, ok
+}
+
+// lookupKID returns the trusted issuer owning the key kid.
+func (ts *TrustStore) lookupKID(kid string) (TrustedIssuer, IssuerKey, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, t := range ts.issuers {
+		if k, ok := findKey(t.Keys, kid); ok {
+			return t, k, true
+		}
+	}
+	return TrustedIssuer{}, IssuerKey{}, false
+}
+
+func findKey(keys []IssuerKey, kid string) (IssuerKey, bool) {
+	for _, k := range keys {
+		if k.KID == kid {
+			return k, true
+		}
+	}
+	return IssuerKey{}, false
+}
+
+// IssuerDescriptor returns this node's descriptor signed with the active
+// token signing key.
+func (s *Service) IssuerDescriptor() IssuerDescriptor {
+	kid, priv := s.keys.active()
+	seen := make(map[string]bool)
+	var scopes []string
+	policy := s.PlanPolicy()
+	for _, name := range policy.PlanNames() {
+		for _, scope := range policy.Plans[name].Scopes {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	d := IssuerDescriptor{
+		Issuer:    s.issuer,
+		Keys:      s.keys.verificationKeys(),
+		Scopes:    scopes,
+		Timestamp: time.Now().Unix(),
+		KID:       kid,
+	}
+	d.SignatureHex = hex.EncodeToString(ed25519.Sign(priv, d.signingBytes()))
+	return d
+}
+
+// TrustStore exposes the foreign issuers this node honors.
+func (s *Service) TrustStore() *TrustStore {
+	return s.trust
+}
+
+// SetEPMVerifier sets how the service verifies the EPMs that issuers and
+// plugin publishers are imported from.
+func (s *Service) SetEPMVerifier(fn EPMVerifier) {
+	s.epmMu.Lock()
+	defer s.epmMu.Unlock()
+	s.verifyEPM = fn
+}
+
+// VerifyPeerEPM verifies peerID's EPM with the configured EPMVerifier.
+func (s *Service) VerifyPeerEPM(peerID string, epmData []byte, signatureHex string) (*AttestedEPM, error) {
+	s.epmMu.RLock()
+	verify := s.verifyEPM
+	s.epmMu.RUnlock()
+	if verify == nil {
+		return nil, ErrNoEPMVerifier
+	}
+	peerID = strings.TrimSpace(peerID)
+	if peerID == "" {
+		return nil, errors.New("peer_id is required")
+	}
+	a, err := verify(peerID, epmData, signatureHex)
+	if err != nil {
+		return nil, fmt.Errorf("verify EPM of %s: %w", peerID, err)
+	}
+	return a, nil
+}
+
+// TrustIssuer verifies an encoded issuer descriptor and trusts its issuer
+// within grant. Re-importing a newer descriptor picks up rotated keys.
+func (s *Service) TrustIssuer(descriptor string, grant TrustGrant) (TrustedIssuer, error) {
+	return s.trustIssuer(descriptor, "", grant)
+}
+
+// trustIssuer is TrustIssuer for a descriptor published by peerID's
+// verified EPM, or by no peer when peerID is empty.
+func (s *Service) trustIssuer(descriptor, peerID string, grant TrustGrant) (TrustedIssuer, error) {
+	d, err := ParseIssuerDescriptor(descriptor)
+	if err != nil {
+		return TrustedIssuer{}, err
+	}
+	if err := d.Verify(); err != nil {
+		return TrustedIssuer{}, fmt.Errorf("issuer descriptor: %w", err)
+	}
+	if d.Issuer == s.issuer {
+		return TrustedIssuer{}, errors.New("cannot trust this node's own issuer")
+	}
+	if err := grant.validate(); err != nil {
+		return TrustedIssuer{}, err
+	}
+	source := grant.Source
+	if source == "" {
+		source = TrustSourceDescriptor
+	}
+	t := TrustedIssuer{
+		Issuer:              d.Issuer,
+		Keys:                d.Keys,
+		AllowedScopes:       append([]string(nil), grant.AllowedScopes...),
+		NotBefore:           grant.NotBefore,
+		NotAfter:            grant.NotAfter,
+		Source:              source,
+		PeerID:              peerID,
+		DescriptorTimestamp: d.Timestamp,
+		AddedAt:             time.Now().Unix(),
+	}
+	if err := s.trust.Put(t); err != nil {
+		return TrustedIssuer{}, err
+	}
+	log.Infof("Trusting license issuer %s (%d key(s), scopes %v)", t.Issuer, len(t.Keys), t.AllowedScopes)
+	return t, nil
+}
+
+// UntrustIssuer removes issuer from the trust store.
+func (s *Service) UntrustIssuer(issuer string) (bool, error) {
+	removed, err := s.trust.Remove(issuer)
+	if removed {
+		log.Infof("Stopped trusting license issuer %s", issuer)
+	}
+	return removed, err
+}
+
+// issuerKeys returns the keys that sign tokens and revocations for issuer:
+// this node's own keys or a trusted issuer's.
+func (s *Service) issuerKeys(issuer string) ([]IssuerKey, bool) {
+	if issuer == s.issuer {
+		return s.verifier.Keys(), true
+	}
+	t, ok := s.trust.Get(issuer)
+	if !ok || !t.activeAt(time.Now()) {
+		return nil, false
+	}
+	return t.Keys, true
+}
@@ -0,0 +1,194 @@
+package license
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newForeignIssuer(t *testing.T) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	svc, err := newServiceWithOptions(dir, "other-issuer", serviceOptions{
+		entitlementDBPath: filepath.Join(dir, "license", defaultEntitlementDB),
+		signingKeyPath:    filepath.Join(dir, "license", "token_signing_ed25519.seed"),
+		tokenTTL:          defaultTokenTTL,
+	})
+	if err != nil {
+		t.Fatalf("newServiceWithOptions: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func (s *Service) signScopedToken(t *testing.T, iss string, scopes ...string) string {
+	t.Helper()
+	now := time.Now()
+	kid, priv := s.keys.active()
+	token, err := SignCapabilityTokenWithKID(CapabilityClaims{
+		Iss: iss, Sub: "xpub-f", PeerID: "peer", Scopes: scopes,
+		Iat: now.Unix(), Exp: now.Add(5 * time.Minute).Unix(), JTI: "jti-f",
+	}, priv, kid)
+	if err != nil {
+		t.Fatalf("SignCapabilityTokenWithKID: %v", err)
+	}
+	return token
+}
+
+func TestTrustedIssuerTokens(t *testing.T) {
+	local := newTestService(t, t.TempDir())
+	foreign := newForeignIssuer(t)
+	token := foreign.signScopedToken(t, foreign.issuer, "api:data:read:OMM.fbs", "orbpro:premium")
+
+	if _, err := local.Verifier().VerifyToken(token, "peer", nil); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Fatalf("untrusted issuer error = %v, want ErrUnknownSigningKey", err)
+	}
+
+	if _, err := local.TrustIssuer(foreign.IssuerDescriptor().Encode(), TrustGrant{
+		AllowedScopes: []string{"api:data:read:*"},
+	}); err != nil {
+		t.Fatalf("TrustIssuer: %v", err)
+	}
+	claims, err := local.Verifier().VerifyToken(token, "peer", []string{"api:data:read:OMM.fbs"})
+	if err != nil {
+		t.Fatalf("trusted token rejected: %v", err)
+	}
+	if len(claims.Scopes) != 1 || claims.Scopes[0] != "api:data:read:OMM.fbs" {
+		t.Fatalf("scopes = %v, want only the allowed data scope", claims.Scopes)
+	}
+	if _, err := local.Verifier().VerifyToken(token, "peer", []string{"orbpro:premium"}); !errors.Is(err, ErrTokenMissingScope) {
+		t.Fatalf("scope outside grant error = %v, want ErrTokenMissingScope", err)
+	}
+
+	// A trusted key cannot mint tokens in another issuer's name.
+	spoofed := foreign.signScopedToken(t, local.issuer, "api:data:read:OMM.fbs")
+	if _, err := local.Verifier().VerifyToken(spoofed, "peer", nil); !errors.Is(err, ErrTokenIssuerMismatch) {
+		t.Fatalf("spoofed issuer error = %v, want ErrTokenIssuerMismatch", err)
+	}
+
+	// Closing the trust window stops its tokens.
+	if _, err := local.TrustIssuer(foreign.IssuerDescriptor().Encode(), TrustGrant{
+		AllowedScopes: []string{"api:data:read:*"},
+		NotBefore:     time.Now().Add(-2 * time.Hour).Unix(),
+		NotAfter:      time.Now().Add(-time.Hour).Unix(),
+	}); err != nil {
+		t.Fatalf("TrustIssuer: %v", err)
+	}
+	if _, err := local.Verifier().VerifyToken(token, "peer", nil); !errors.Is(err, ErrIssuerNotTrusted) {
+		t.Fatalf("expired trust error = %v, want ErrIssuerNotTrusted", err)
+	}
+}
+
+func TestTrustIssuerImport(t *testing.T) {
+	local := newTestService(t, t.TempDir())
+	foreign := newForeignIssuer(t)
+	grant := TrustGrant{AllowedScopes: []string{"orbpro:base"}}
+	desc := foreign.IssuerDescriptor().Encode()
+
+	// vCard property with a folded value.
+	var folded strings.Builder
+	line := VCardLicenseIssuerProperty + ":" + desc
+	for len(line) > 75 {
+		folded.WriteString(line[:75] + "\r\n ")
+		line = line[75:]
+	}
+	folded.WriteString(line)
+	card := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Other Org\r\n" + folded.String() + "\r\nEND:VCARD\r\n"
+	got, err := DescriptorFromVCard(card)
+	if err != nil || got != desc {
+		t.Fatalf("DescriptorFromVCard = %q, %v", got, err)
+	}
+
+	// EPM imports need a verified EPM whose issuer key signed the
+	// descriptor.
+	if _, err := local.VerifyPeerEPM("peer-f", nil, ""); !errors.Is(err, ErrNoEPMVerifier) {
+		t.Fatalf("VerifyPeerEPM without a verifier = %v, want ErrNoEPMVerifier", err)
+	}
+	attested := &AttestedEPM{PeerID: "peer-f", IssuerDescriptor: desc, IssuerKeyHex: foreign.PublicKeyHex()}
+	local.SetEPMVerifier(func(peerID string, epmData []byte, signatureHex string) (*AttestedEPM, error) {
+		if peerID != attested.PeerID {
+			return nil, errors.New("no verified EPM")
+		}
+		return attested, nil
+	})
+	if _, err := local.VerifyPeerEPM("peer-x", nil, ""); err == nil {
+		t.Fatal("unverified peer EPM accepted")
+	}
+	a, err := local.VerifyPeerEPM("peer-f", nil, "")
+	if err != nil {
+		t.Fatalf("VerifyPeerEPM: %v", err)
+	}
+	if got, err := DescriptorFromEPM(a); err != nil || got != desc {
+		t.Fatalf("DescriptorFromEPM = %q, %v", got, err)
+	}
+	// Another node's descriptor in a peer's EPM does not carry its key.
+	if _, err := DescriptorFromEPM(&AttestedEPM{IssuerDescriptor: desc, IssuerKeyHex: local.PublicKeyHex()}); err == nil {
+		t.Fatal("descriptor accepted without the EPM's issuer key")
+	}
+	if _, err := DescriptorFromEPM(&AttestedEPM{IssuerDescriptor: desc}); err == nil {
+		t.Fatal("descriptor accepted from an EPM without an issuer key")
+	}
+	ti, err := local.trustIssuer(desc, "peer-f", grant)
+	if err != nil || ti.PeerID != "peer-f" {
+		t.Fatalf("trustIssuer = %+v, %v", ti, err)
+	}
+
+	// Tampered descriptors and this node's own descriptor are refused.
+	d, _ := ParseIssuerDescriptor(desc)
+	d.Issuer = "mallory"
+	if _, err := local.TrustIssuer(d.Encode(), grant); err == nil {
+		t.Fatal("tampered descriptor was trusted")
+	}
+	if _, err := local.TrustIssuer(local.IssuerDescriptor().Encode(), grant); err == nil {
+		t.Fatal("own descriptor was trusted")
+	}
+	if _, err := local.TrustIssuer(desc, TrustGrant{}); err == nil {
+		t.Fatal("descriptor trusted without allowed scopes")
+	}
+
+	// The store persists across reloads.
+	path := filepath.Join(t.TempDir(), defaultTrustStoreFile)
+	store, _ := LoadTrustStore(path)
+	local.trust = store
+	if _, err := local.TrustIssuer(desc, grant); err != nil {
+		t.Fatalf("TrustIssuer: %v", err)
+	}
+	reloaded, err := LoadTrustStore(path)
+	if err != nil {
+		t.Fatalf("LoadTrustStore: %v", err)
+	}
+	if ti, ok := reloaded.Get(foreign.issuer); !ok || len(ti.Keys) != 1 || ti.AllowedScopes[0] != "orbpro:base" {
+		t.Fatalf("reloaded issuer = %+v, %v", ti, ok)
+	}
+}
+
+func TestTrustedIssuerRevocations(t *testing.T) {
+	local := newTestService(t, t.TempDir())
+	foreign := newForeignIssuer(t)
+	var published []byte
+	foreign.SetRevocationPublisher(func(data []byte) error {
+		published = data
+		return nil
+	})
+	if _, err := foreign.Revoke(RevokeJTI, "jti-f", ""); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	if n, _ := local.HandleRevocationMessage(published); n != 0 {
+		t.Fatal("revocation from an untrusted issuer was applied")
+	}
+	if _, err := local.TrustIssuer(foreign.IssuerDescriptor().Encode(), TrustGrant{
+		AllowedScopes: []string{"orbpro:base"},
+	}); err != nil {
+		t.Fatalf("TrustIssuer: %v", err)
+	}
+	if n, err := local.HandleRevocationMessage(published); err != nil || n != 1 {
+		t.Fatalf("HandleRevocationMessage = %d, %v", n, err)
+	}
+	token := foreign.signScopedToken(t, foreign.issuer, "orbpro:base")
+	if _, err := local.Verifier().VerifyToken(token, "peer", nil); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("trusted issuer revocation not enforced: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+// setupAddressFilter installs the configured CIDR and ASN rules on the
+// connection gater. Nothing is installed when no rules are configured.
+func (n *Node) setupAddressFilter() error {
+	cfg := n.config.Peers.AddressFilter
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 && len(cfg.Limit) == 0 {
+		return nil
+	}
+
+	filter, err := peers.NewNetworkFilter(peers.NetworkFilterConfig{
+		Allow:       addressRanges(cfg.Allow),
+		Deny:        addressRanges(cfg.Deny),
+		Limit:       addressRanges(cfg.Limit),
+		ASNDatabase: cfg.ASNDatabase,
+	})
+	if err != nil {
+		return err
+	}
+	n.peerGater.SetNetworkFilter(filter)
+	log.Infof("Address filter enabled: %d allow, %d deny, %d limit ranges",
+		len(cfg.Allow), len(cfg.Deny), len(cfg.Limit))
+	return nil
+}
+
+func addressRanges(in []config.AddressRangeConfig) []peers.AddressRange {
+	out := make([]peers.AddressRange, len(in))
+	for i, r := range in {
+		out[i] = peers.AddressRange{CIDR: r.CIDR, ASN: r.ASN, MaxConnections: r.MaxConnections}
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+// DefaultAuditAnchorInterval is how often the audit chain head is
+// checkpointed when it has changed.
+const DefaultAuditAnchorInterval = time.Hour
+
+// StartAuditAnchoring checkpoints l every interval, signed with the node
+// identity, and gossips the checkpoints on audit.CheckpointTopic. Peers at
+// Trusted level or above countersign each other's checkpoints. When
+// ipfsAPIURL is set, checkpoints are also pinned through that Kubo API.
+func (n *Node) StartAuditAnchoring(l *audit.Logger, interval time.Duration, ipfsAPIURL string) (*audit.Anchorer, error) {
+	key := n.host.Peerstore().PrivKey(n.host.ID())
+	if key == nil {
+		return nil, errors.New("node identity key is not available")
+	}
+	anchorer, err := audit.NewAnchorer(l, key)
+	if err != nil {
+		return nil, err
+	}
+	if registry := n.PeerRegistry(); registry != nil {
+		anchorer.SetWitnessPolicy(func(nodeID string) bool {
+			pid, err := peer.Decode(nodeID)
+			return err == nil && registry.GetTrustLevel(pid) >= peers.Trusted
+		})
+	}
+	if ipfsAPIURL = strings.TrimRight(strings.TrimSpace(ipfsAPIURL), "/"); ipfsAPIURL != "" {
+		anchorer.SetPinner(func(ctx context.Context, data []byte) (string, error) {
+			return pinToIPFS(ctx, ipfsAPIURL, data)
+		})
+	}
+
+	topic, err := n.Topic(audit.CheckpointTopic)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %w", audit.CheckpointTopic, err)
+	}
+	anchorer.SetPublisher(func(data []byte) error {
+		return topic.Publish(n.ctx, data)
+	})
+
+	if interval <= 0 {
+		interval = DefaultAuditAnchorInterval
+	}
+	n.wg.Add(2)
+	go func() {
+		defer n.wg.Done()
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(n.ctx)
+			if err != nil {
+				if n.ctx.Err() != nil {
+					return
+				}
+				log.Warnf("Error reading from %s: %v", audit.CheckpointTopic, err)
+				continue
+			}
+			if msg.ReceivedFrom == n.host.ID() {
+				continue
+			}
+			if err := anchorer.HandleMessage(msg.Data); err != nil {
+				if errors.Is(err, audit.ErrCheckpointConflict) {
+					log.Errorf("Audit checkpoint conflict from %s: %v", msg.ReceivedFrom, err)
+					continue
+				}
+				log.Debugf("Ignoring audit checkpoint message from %s: %v", msg.ReceivedFrom, err)
+			}
+		}
+	}()
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-ticker.C:
+				c, err := anchorer.Anchor(n.ctx)
+				if errors.Is(err, audit.ErrNothingToAnchor) {
+					continue
+				} else if err != nil {
+					log.Warnf("Audit anchoring failed: %v", err)
+					continue
+				}
+				log.Infof("Anchored audit log at entry %d", c.Sequence)
+			}
+		}
+	}()
+	return anchorer, nil
+}
+
+// pinToIPFS adds data to IPFS through the Kubo RPC API and returns its CID.
+func pinToIPFS(ctx context.Context, apiURL string, data []byte) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "checkpoint.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/api/v0/add?pin=true", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IPFS add failed with status %d", resp.StatusCode)
+	}
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return "", fmt.Errorf("decode IPFS response: %w", err)
+	}
+	return added.Hash, nil
+}
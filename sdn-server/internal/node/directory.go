@@ -0,0 +1,78 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/directory"
+)
+
+// directoryAnnounceInterval is how often the node re-provides its attested
+// chain addresses on the DHT.
+const directoryAnnounceInterval = time.Hour
+
+// initDirectory builds the entity directory over the peer registry, using
+// the DHT and EPM exchange for address lookups the registry cannot answer.
+func (n *Node) initDirectory() {
+	var selfEPM func() []byte
+	if n.epmService != nil {
+		selfEPM = n.epmService.GetNodeEPM
+	}
+	n.directory = directory.New(n.peerRegistry, n.host.ID(), selfEPM)
+	if n.dht == nil || n.epmService == nil {
+		return
+	}
+	n.directory.SetResolver(
+		func(ctx context.Context, c cid.Cid) ([]peer.ID, error) {
+			var ids []peer.ID
+			for info := range n.dht.FindProvidersAsync(ctx, c, 20) {
+				ids = append(ids, info.ID)
+			}
+			return ids, ctx.Err()
+		},
+		func(ctx context.Context, id peer.ID) error {
+			return n.epmService.RequestPeerEPM(ctx, n.host, id)
+		},
+	)
+}
+
+// Directory returns the entity directory.
+func (n *Node) Directory() *directory.Directory {
+	return n.directory
+}
+
+// startDirectoryAnnounce provides the node's attested chain addresses on
+// the DHT so other nodes can resolve them to this peer.
+func (n *Node) startDirectoryAnnounce() {
+	if n.directory == nil || n.dht == nil {
+		return
+	}
+	announce := func() {
+		for _, c := range n.directory.SelfAddressCIDs() {
+			ctx, cancel := context.WithTimeout(n.ctx, 30*time.Second)
+			if err := n.dht.Provide(ctx, c, true); err != nil {
+				log.Debugf("Directory announce of %s failed: %v", c, err)
+			}
+			cancel()
+		}
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		announce()
+		ticker := time.NewTicker(directoryAnnounceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-ticker.C:
+				announce()
+			}
+		}
+	}()
+}
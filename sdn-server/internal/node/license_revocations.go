@@ -0,0 +1,136 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/epm"
+	"github.com/spacedatanetwork/sdn-server/internal/license"
+)
+
+// revocationGossipInterval is how often the full revocation list is
+// republished for nodes that missed earlier messages.
+const revocationGossipInterval = 10 * time.Minute
+
+// startRevocationGossip joins the license revocation topic, applies
+// revocations gossiped by other nodes and publishes this node's own.
+func (n *Node) startRevocationGossip() {
+	svc := n.LicenseService()
+	if svc == nil {
+		return
+	}
+	topic, err := n.Topic(license.RevocationTopic)
+	if err != nil {
+		log.Warnf("Revocation gossip disabled: %v", err)
+		return
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		log.Warnf("Failed to subscribe to %s: %v", license.RevocationTopic, err)
+		return
+	}
+	svc.SetRevocationPublisher(func(data []byte) error {
+		return topic.Publish(n.ctx, data)
+	})
+
+	n.wg.Add(2)
+	go func() {
+		defer n.wg.Done()
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(n.ctx)
+			if err != nil {
+				if n.ctx.Err() != nil {
+					return
+				}
+				log.Warnf("Error reading from %s: %v", license.RevocationTopic, err)
+				continue
+			}
+			if msg.ReceivedFrom == n.host.ID() {
+				continue
+			}
+			applied, err := svc.HandleRevocationMessage(msg.Data)
+			if err != nil {
+				log.Debugf("Ignoring revocation message from %s: %v", msg.ReceivedFrom, err)
+				continue
+			}
+			if applied > 0 {
+				log.Infof("Applied %d revocation(s) from %s", applied, msg.ReceivedFrom)
+			}
+		}
+	}()
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(revocationGossipInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := svc.GossipRevocations(); err != nil {
+					log.Debugf("Revocation gossip failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// publishLicenseIssuer puts the license service's signed issuer descriptor
+// in the node's EPM, and refreshes it whenever the signing key rotates, so
+// other operators can import this node into their trust store.
+func (n *Node) publishLicenseIssuer() {
+	svc := n.LicenseService()
+	if svc == nil || n.epmService == nil {
+		return
+	}
+	publish := func() {
+		if err := n.epmService.SetLicenseIssuer(svc.PublicKeyHex(), svc.IssuerDescriptor().Encode()); err != nil {
+			log.Warnf("Failed to publish license issuer in EPM: %v", err)
+		}
+	}
+	svc.SetOnKeyRotation(publish)
+	publish()
+}
+
+// verifyLicenseEPMs lets the license service import issuers and publishers
+// from peer EPMs the node can verify.
+func (n *Node) verifyLicenseEPMs() {
+	if svc := n.LicenseService(); svc != nil {
+		svc.SetEPMVerifier(n.verifyPeerEPM)
+	}
+}
+
+// verifyPeerEPM verifies peerID's EPM: epmData against the peer's
+// announcement signature, or else the last EPM received from the peer,
+// which was verified when it arrived.
+func (n *Node) verifyPeerEPM(peerID string, epmData []byte, signatureHex string) (*license.AttestedEPM, error) {
+	pid, err := peer.Decode(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	var id *epm.EPMIdentity
+	if len(epmData) > 0 {
+		id, err = epm.VerifySignedEPMIdentity(epmData, pid, signatureHex)
+	} else {
+		tp, gerr := n.peerRegistry.GetPeer(pid)
+		if gerr != nil || len(tp.EPMHistory) == 0 {
+			return nil, fmt.Errorf("no EPM received from %s", peerID)
+		}
+		id, err = epm.VerifyEPMIdentity(tp.EPMHistory[0].Data, pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &license.AttestedEPM{
+		PeerID:           pid.String(),
+		SigningKeyHex:    id.SigningKeyHex,
+		DN:               id.DN,
+		LegalName:        id.LegalName,
+		Email:            id.Email,
+		IssuerDescriptor: id.LicenseIssuer,
+		IssuerKeyHex:     id.LicenseIssuerKey,
+	}, nil
+}
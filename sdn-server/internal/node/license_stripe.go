@@ -0,0 +1,39 @@
+package node
+
+import "time"
+
+// startStripeReconciler periodically reconciles license entitlements against
+// Stripe so subscriptions whose webhooks were missed still lapse or renew.
+func (n *Node) startStripeReconciler() {
+	svc := n.LicenseService()
+	if svc == nil {
+		return
+	}
+	interval := svc.StripeReconcileInterval()
+	if interval <= 0 {
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			result, err := svc.ReconcileStripe(n.ctx)
+			if err != nil {
+				if n.ctx.Err() != nil {
+					return
+				}
+				log.Warnf("Stripe reconciliation failed: %v", err)
+			} else if result.Updated > 0 || result.Failed > 0 {
+				log.Infof("Stripe reconciliation: %d checked, %d updated, %d failed", result.Checked, result.Updated, result.Failed)
+			}
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
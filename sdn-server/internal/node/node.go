@@ -32,8 +32,10 @@ import (
 	"github.com/multiformats/go-multiaddr"
 	mh "github.com/multiformats/go-multihash"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/bootstrap"
 	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/directory"
 	"github.com/spacedatanetwork/sdn-server/internal/epm"
 	"github.com/spacedatanetwork/sdn-server/internal/keys"
 	"github.com/spacedatanetwork/sdn-server/internal/license"
@@ -41,6 +43,7 @@ import (
 	"github.com/spacedatanetwork/sdn-server/internal/protocol"
 	"github.com/spacedatanetwork/sdn-server/internal/sds"
 	"github.com/spacedatanetwork/sdn-server/internal/storage"
+	"github.com/spacedatanetwork/sdn-server/internal/storefront"
 	"github.com/spacedatanetwork/sdn-server/internal/wasm"
 	"github.com/spacedatanetwork/sdn-server/plugins"
 	"github.com/spacedatanetwork/sdn-server/plugins/licenseplugin"
@@ -55,6 +58,13 @@ const (
 
 	// mDNS service name
 	MDNSServiceName = "space-data-network-mdns"
+
+	// maxEPMFetches bounds the EPM announcements fetched at once; further
+	// announcements are dropped until a fetch finishes.
+	maxEPMFetches = 8
+
+	// SDSTopicPrefix prefixes the per-schema PubSub topics.
+	SDSTopicPrefix = "/spacedatanetwork/sds/"
 )
 
 // Node represents a Space Data Network node.
@@ -62,10 +72,13 @@ type Node struct {
 	host       host.Host
 	dht        *dht.IpfsDHT
 	pubsub     *pubsub.PubSub
-	topics     map[string]*pubsub.Topic
+	topics     map[string]*pubsub.Topic // by schema
+	joined     map[string]*pubsub.Topic // other topics, by name
+	topicsMu   sync.RWMutex
 	flatc      *wasm.FlatcModule
 	hdwallet   *wasm.HDWalletModule
 	identity   *wasm.DerivedIdentity // nil if using random key (no HD wallet)
+	xpub       string                // operator xpub, licensee of catalog plugins; "" without HD wallet
 	validator  *sds.Validator
 	store      *storage.FlatSQLStore
 	protocol   *protocol.SDSExchangeHandler
@@ -73,11 +86,22 @@ type Node struct {
 	license    *licenseplugin.Plugin
 	keyBroker  *wasmlicenseplugin.Plugin
 	epmService *epm.Service
+	directory  *directory.Directory
 	config     *config.Config
 
+	// Catalog plugin versions, see plugin_versions.go.
+	pluginMu       sync.Mutex
+	pluginRegistry *license.PluginRegistry
+	pluginKey      []byte
+	pluginRunning  map[string]string // plugin ID -> running version
+
 	// Trusted peer management
 	peerRegistry *peers.Registry
 	peerGater    *peers.TrustedConnectionGater
+	reputation   *peers.Reputation
+	webOfTrust   *peers.WebOfTrust
+
+	epmFetches chan struct{} // semaphore, see maxEPMFetches
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -89,10 +113,12 @@ func New(ctx context.Context, cfg *config.Config) (*Node, error) {
 	nodeCtx, cancel := context.WithCancel(ctx)
 
 	n := &Node{
-		topics: make(map[string]*pubsub.Topic),
-		config: cfg,
-		ctx:    nodeCtx,
-		cancel: cancel,
+		topics:     make(map[string]*pubsub.Topic),
+		joined:     make(map[string]*pubsub.Topic),
+		config:     cfg,
+		epmFetches: make(chan struct{}, maxEPMFetches),
+		ctx:        nodeCtx,
+		cancel:     cancel,
 	}
 
 	if err := n.init(); err != nil {
@@ -150,6 +176,9 @@ func (n *Node) init() error {
 	}
 	n.peerRegistry = peers.NewRegistry(n.config.Peers.StrictMode, persistence)
 	n.peerGater = peers.NewTrustedConnectionGater(n.peerRegistry)
+	if err := n.setupAddressFilter(); err != nil {
+		return fmt.Errorf("invalid peers.address_filter: %w", err)
+	}
 
 	// Log trusted peer mode
 	if n.config.Peers.StrictMode {
@@ -214,6 +243,7 @@ func (n *Node) init() error {
 			dhtRouting, err = dht.New(n.ctx, h,
 				dht.Mode(dht.ModeAutoServer),
 				dht.ProtocolPrefix("/spacedatanetwork"),
+				dht.NamespacedValidator("sdn", storefront.RecordValidator{}),
 			)
 			return dhtRouting, err
 		}),
@@ -225,8 +255,13 @@ func (n *Node) init() error {
 	}
 	n.dht = dhtRouting
 
-	// Create GossipSub
-	n.pubsub, err = pubsub.NewGossipSub(n.ctx, n.host)
+	// The address filter counts open connections for its per-range caps.
+	if filter := n.peerGater.NetworkFilter(); filter != nil {
+		n.host.Network().Notify(filter)
+	}
+
+	// Create GossipSub. Peers only join schema topic meshes their ACL allows.
+	n.pubsub, err = pubsub.NewGossipSub(n.ctx, n.host, pubsub.WithPeerFilter(n.topicPeerFilter))
 	if err != nil {
 		return fmt.Errorf("failed to create pubsub: %w", err)
 	}
@@ -294,6 +329,9 @@ func (n *Node) init() error {
 	}
 
 	n.protocol = protocol.NewSDSExchangeHandlerWithOptions(n.store, n.validator, limits, rateLimiter)
+	n.protocol.SetACL(n.peerRegistry)
+	n.setupReputation(rateLimiter)
+	n.setupWebOfTrust(privKey, persistence)
 	n.host.SetStreamHandler(protocol.SDSProtocolID, n.protocol.HandleStream)
 	n.host.SetStreamHandler(protocol.IDExchangeProtoID, protocol.HandleLegacyIDExchange)
 	n.host.SetStreamHandler(protocol.ChatProtoID, protocol.HandleLegacyChat)
@@ -303,29 +341,23 @@ func (n *Node) init() error {
 	var xpubStr string
 	if n.hdwallet != nil && n.identity != nil {
 		// Derive xpub from encrypted mnemonic seed for the EPM
-		mnemonicPath := filepath.Join(basePath, "keys", "mnemonic")
-		if mnemonicData, err := os.ReadFile(mnemonicPath); err == nil {
-			var mnemonic string
-			if keys.IsMnemonicEncrypted(mnemonicData) {
-				mnemonic, _ = keys.DecryptMnemonic(mnemonicData, n.resolveKeyPassword())
-			} else {
-				mnemonic = string(mnemonicData)
-			}
-			if mnemonic != "" {
-				if seed, err := n.hdwallet.MnemonicToSeed(n.ctx, mnemonic, ""); err == nil {
-					if xpub, err := n.hdwallet.DeriveXPub(n.ctx, seed, 0); err == nil {
-						xpubStr = xpub
-					}
+		if mnemonic, err := n.readMnemonic(); err == nil && mnemonic != "" {
+			if seed, err := n.hdwallet.MnemonicToSeed(n.ctx, mnemonic, ""); err == nil {
+				if xpub, err := n.hdwallet.DeriveXPub(n.ctx, seed, 0); err == nil {
+					xpubStr = xpub
 				}
 			}
 		}
 	}
+	n.xpub = xpubStr
 	n.epmService = epm.NewService(n.identity, n.peerRegistry, n.host.ID(), xpubStr, basePath)
 	if err := n.epmService.Init(); err != nil {
 		log.Warnf("EPM service initialization failed (non-fatal): %v", err)
 	} else {
 		n.epmService.RegisterProtocol(n.host)
+		n.epmService.SetIPFSAPIURL(n.config.Admin.IPFSAPIURL)
 	}
+	n.initDirectory()
 
 	// Initialize runtime plugins.
 	n.plugins = plugins.New()
@@ -357,6 +389,8 @@ func (n *Node) init() error {
 			if keyErr != nil {
 				log.Warnf("Plugin decryption key invalid: %v", keyErr)
 			}
+			n.pluginRegistry = reg
+			n.pluginKey = recipientKey
 
 			if err := n.registerCatalogPlugins(reg, pluginCtx, recipientKey); err != nil {
 				log.Warnf("Plugin catalog runtime startup completed with errors: %v", err)
@@ -472,6 +506,14 @@ func (n *Node) registerCatalogPlugins(reg *license.PluginRegistry, pluginCtx plu
 		}
 
 		plugin := wasmlicenseplugin.NewFromBytes(wasmBytes)
+		if asset, ok := reg.Get(pluginID); ok {
+			n.setPluginDataAccess(plugin, asset)
+		}
+		plugin.SetQuarantineHandler(func(reason string) {
+			if err := reg.SetRuntimeStatus(pluginID, "quarantined", reason); err != nil {
+				log.Warnf("Unable to update runtime status for plugin %q: %v", pluginID, err)
+			}
+		})
 		if err := n.plugins.Register(plugin); err != nil {
 			errMsg := fmt.Errorf("plugin %q registration failed: %w", pluginID, err)
 			_ = reg.SetRuntimeStatus(pluginID, "error", errMsg.Error())
@@ -482,6 +524,7 @@ func (n *Node) registerCatalogPlugins(reg *license.PluginRegistry, pluginCtx plu
 		if err := reg.SetRuntimeStatus(pluginID, "stopped", "registered, waiting for startup"); err != nil {
 			log.Warnf("Unable to update runtime status for plugin %q: %v", pluginID, err)
 		}
+		n.setRunningPluginVersion(pluginID, descriptor.Version)
 		log.Infof("Registered encrypted catalog plugin %q from runtime registry", pluginID)
 	}
 
@@ -609,6 +652,20 @@ func (n *Node) loadOrCreateKey() (crypto.PrivKey, error) {
 	return n.generateRandomKey(keyDir, keyPath)
 }
 
+// readMnemonic loads the node's BIP-39 mnemonic from disk, decrypting it
+// when stored in encrypted form.
+func (n *Node) readMnemonic() (string, error) {
+	mnemonicPath := filepath.Join(filepath.Dir(n.config.Storage.Path), "keys", "mnemonic")
+	data, err := os.ReadFile(mnemonicPath)
+	if err != nil {
+		return "", err
+	}
+	if keys.IsMnemonicEncrypted(data) {
+		return keys.DecryptMnemonic(data, n.resolveKeyPassword())
+	}
+	return string(data), nil
+}
+
 // resolveKeyPassword returns the password for mnemonic encryption/decryption.
 // Priority: SDN_KEY_PASSWORD env var > config security.key_password > machine-derived default.
 func (n *Node) resolveKeyPassword() string {
@@ -746,13 +803,22 @@ func (n *Node) Start(ctx context.Context) error {
 
 	// Setup per-schema PubSub topics
 	for _, schema := range n.validator.Schemas() {
-		topicName := fmt.Sprintf("/spacedatanetwork/sds/%s", schema)
+		topicName := SDSTopicPrefix + schema
 		topic, err := n.pubsub.Join(topicName)
 		if err != nil {
 			log.Warnf("Failed to join topic %s: %v", topicName, err)
 			continue
 		}
+		n.topicsMu.Lock()
 		n.topics[schema] = topic
+		n.topicsMu.Unlock()
+
+		// Admit messages before they are delivered or forwarded, so invalid
+		// ones stop here and offenses are charged to their signer.
+		if err := n.pubsub.RegisterTopicValidator(topicName, n.admitTopicMessage(schema)); err != nil {
+			log.Warnf("Failed to register validator for %s: %v", topicName, err)
+			continue
+		}
 
 		// Subscribe to receive messages
 		sub, err := topic.Subscribe()
@@ -782,6 +848,18 @@ func (n *Node) Start(ctx context.Context) error {
 		}()
 	}
 
+	// Let other nodes resolve our attested chain addresses to this peer
+	n.startDirectoryAnnounce()
+
+	// Gossip capability token revocations, advertise the token issuer and
+	// verify the peer EPMs issuers are imported from
+	n.startRevocationGossip()
+	n.publishLicenseIssuer()
+	n.verifyLicenseEPMs()
+
+	// Keep Stripe-backed entitlements in sync with their subscriptions
+	n.startStripeReconciler()
+
 	return nil
 }
 
@@ -803,13 +881,62 @@ func (n *Node) handleSubscription(sub *pubsub.Subscription, schema string) {
 			continue
 		}
 
-		// Process the message
-		if err := n.protocol.HandlePubSubMessage(schema, msg.Data, msg.ReceivedFrom); err != nil {
+		// The topic validator has admitted the message for its signer.
+		if err := n.protocol.StorePubSubMessage(schema, msg.Data, msg.GetFrom()); err != nil {
 			log.Warnf("Failed to handle message on %s: %v", schema, err)
+			continue
+		}
+
+		// EPM announcements are fetched and verified off the read loop, a
+		// bounded number at a time.
+		if schema == sds.PNMSchema && n.epmService != nil {
+			select {
+			case n.epmFetches <- struct{}{}:
+			default:
+				log.Debugf("Dropping EPM announcement from %s: too many fetches in progress", msg.GetFrom())
+				continue
+			}
+			n.wg.Add(1)
+			go func(data []byte, author peer.ID) {
+				defer n.wg.Done()
+				defer func() { <-n.epmFetches }()
+				if err := n.epmService.HandlePNMEPM(n.ctx, data, author); err != nil {
+					log.Debugf("Ignoring EPM announcement from %s: %v", author, err)
+				}
+			}(msg.Data, msg.GetFrom())
 		}
 	}
 }
 
+// admitTopicMessage returns the PubSub validator for a schema topic. It
+// applies the SDS exchange admission rules to the message's signer; rejected
+// messages are dropped and not forwarded, and rate-limited ones are ignored
+// without penalising the peer that relayed them.
+func (n *Node) admitTopicMessage(schema string) pubsub.ValidatorEx {
+	return func(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		author := msg.GetFrom()
+		if author == n.host.ID() {
+			return pubsub.ValidationAccept
+		}
+		if err := n.protocol.AdmitPubSubMessage(schema, msg.Data, author); err != nil {
+			if errors.Is(err, protocol.ErrRateLimited) {
+				return pubsub.ValidationIgnore
+			}
+			return pubsub.ValidationReject
+		}
+		return pubsub.ValidationAccept
+	}
+}
+
+// topicPeerFilter applies subscribe ACLs to SDS schema topics.
+func (n *Node) topicPeerFilter(id peer.ID, topic string) bool {
+	schema, ok := strings.CutPrefix(topic, SDSTopicPrefix)
+	if !ok || n.peerRegistry == nil {
+		return true
+	}
+	return n.peerRegistry.Authorize(id, peers.ACLSubscribe, schema).Allowed
+}
+
 // mdnsNotifee handles mDNS peer discovery events.
 type mdnsNotifee struct {
 	host host.Host
@@ -986,7 +1113,9 @@ func (n *Node) ListenAddrs() []multiaddr.Multiaddr {
 
 // Publish publishes data to a schema topic.
 func (n *Node) Publish(schema string, data []byte) error {
+	n.topicsMu.RLock()
 	topic, ok := n.topics[schema]
+	n.topicsMu.RUnlock()
 	if !ok {
 		return fmt.Errorf("unknown schema: %s", schema)
 	}
@@ -994,6 +1123,29 @@ func (n *Node) Publish(schema string, data []byte) error {
 	return topic.Publish(n.ctx, data)
 }
 
+// Topic returns the PubSub topic with the given name, joining it if needed.
+// A topic can only be joined once per node, so per-schema SDS topics are
+// shared with the node's own subscriptions.
+func (n *Node) Topic(name string) (*pubsub.Topic, error) {
+	n.topicsMu.Lock()
+	defer n.topicsMu.Unlock()
+
+	if schema, ok := strings.CutPrefix(name, SDSTopicPrefix); ok {
+		if topic, ok := n.topics[schema]; ok {
+			return topic, nil
+		}
+	}
+	if topic, ok := n.joined[name]; ok {
+		return topic, nil
+	}
+	topic, err := n.pubsub.Join(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join topic %s: %w", name, err)
+	}
+	n.joined[name] = topic
+	return topic, nil
+}
+
 // PeerRegistry returns the trusted peer registry.
 func (n *Node) PeerRegistry() *peers.Registry {
 	return n.peerRegistry
@@ -1019,6 +1171,11 @@ func (n *Node) Validator() *sds.Validator {
 	return n.validator
 }
 
+// SDSExchange returns the SDS exchange protocol handler.
+func (n *Node) SDSExchange() *protocol.SDSExchangeHandler {
+	return n.protocol
+}
+
 // PluginManager returns the node plugin manager.
 func (n *Node) PluginManager() *plugins.Manager {
 	return n.plugins
@@ -1032,6 +1189,14 @@ func (n *Node) LicenseService() *license.Service {
 	return n.license.Service()
 }
 
+// SetLicenseAuditLogger records changes made through the license admin API
+// to logger.
+func (n *Node) SetLicenseAuditLogger(logger *audit.Logger) {
+	if n.license != nil {
+		n.license.SetAuditLogger(logger)
+	}
+}
+
 // Identity returns the node's HD wallet identity, or nil if using a random key.
 func (n *Node) Identity() *wasm.DerivedIdentity {
 	return n.identity
@@ -1076,6 +1241,33 @@ func (n *Node) SigningKey() []byte {
 	return nil
 }
 
+// DeriveDepositAddress derives a per-purchase receive address for chain from
+// the node's HD wallet. It satisfies storefront.DepositAddressDeriver.
+func (n *Node) DeriveDepositAddress(ctx context.Context, chain string, index uint32) (string, error) {
+	if n.hdwallet == nil {
+		return "", fmt.Errorf("HD wallet not available")
+	}
+	mnemonic, err := n.readMnemonic()
+	if err != nil {
+		return "", fmt.Errorf("failed to read mnemonic: %w", err)
+	}
+	seed, err := n.hdwallet.MnemonicToSeed(ctx, mnemonic, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to derive seed: %w", err)
+	}
+	defer func() {
+		for i := range seed {
+			seed[i] = 0
+		}
+	}()
+
+	addr, err := n.hdwallet.DeriveDepositAddress(ctx, seed, chain, index)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
 // IdentityKeyMaterial returns the raw private key bytes used for this node's
 // libp2p identity. This is used for deterministic derivations (for example, TOR
 // hidden-service key material).
@@ -0,0 +1,174 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/license"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+	"github.com/spacedatanetwork/sdn-server/internal/storage"
+	"github.com/spacedatanetwork/sdn-server/internal/wasiplugin"
+	"github.com/spacedatanetwork/sdn-server/plugins/wasmlicenseplugin"
+)
+
+// pluginDataAccess backs the WASI plugin data-access host ABI with the
+// node's store, validator and schema topics. Reads are subject to the ACL
+// rules of the peer the plugin is licensed to.
+type pluginDataAccess struct {
+	n    *Node
+	peer peer.ID // licensee; "" when unlicensed
+}
+
+// PluginDataAccess returns the data-access backend for a WASI plugin run by
+// this node under claims. Pass it in wasiplugin.Options together with the
+// same claims.
+func (n *Node) PluginDataAccess(claims *license.CapabilityClaims) wasiplugin.DataAccess {
+	d := &pluginDataAccess{n: n}
+	if claims != nil {
+		d.peer, _ = peer.Decode(claims.PeerID)
+	}
+	return d
+}
+
+// setPluginDataAccess wires a catalog plugin to the data-access ABI under
+// the claims of its licensee.
+func (n *Node) setPluginDataAccess(plugin *wasmlicenseplugin.Plugin, asset *license.PluginAsset) {
+	claims := n.pluginDataClaims(asset)
+	plugin.SetDataAccess(n.PluginDataAccess(claims), claims, pluginManifest(asset))
+}
+
+// pluginDataClaims returns the claims a catalog plugin runs under: those a
+// capability token for the plugin's licensee, this node's operator, would
+// carry, resolved from the operator's active entitlement. The signed
+// manifest only bounds what the plugin may ask for; it grants nothing.
+// Without an active entitlement covering the plugin's required scope the
+// plugin gets no data access.
+func (n *Node) pluginDataClaims(asset *license.PluginAsset) *license.CapabilityClaims {
+	svc := n.LicenseService()
+	if asset == nil || svc == nil || n.xpub == "" {
+		return nil
+	}
+	claims, err := svc.EntitlementClaims(n.xpub, n.host.ID().String())
+	if err != nil {
+		log.Warnf("Plugin %q runs without data access: %v", asset.ID, err)
+		return nil
+	}
+	if asset.RequiredScope != "" && !slices.Contains(claims.Scopes, asset.RequiredScope) {
+		log.Warnf("Plugin %q runs without data access: entitlement lacks scope %s", asset.ID, asset.RequiredScope)
+		return nil
+	}
+	return claims
+}
+
+// pluginManifest returns the capabilities a catalog plugin's signed manifest
+// declares, which bound what the plugin may ask for at load.
+func pluginManifest(asset *license.PluginAsset) *wasiplugin.Capabilities {
+	if asset == nil || asset.Capabilities == nil {
+		return nil
+	}
+	caps := wasiplugin.Capabilities(*asset.Capabilities)
+	return &caps
+}
+
+func (d *pluginDataAccess) checkSchema(schema string) error {
+	if d.n.store == nil {
+		return fmt.Errorf("storage is not available")
+	}
+	if !d.n.validator.HasSchema(schema) {
+		return fmt.Errorf("unknown schema: %s", schema)
+	}
+	return nil
+}
+
+// authorizeRead applies the query ACL of the plugin's licensee to schema,
+// as the data API does for a token-bearing client.
+func (d *pluginDataAccess) authorizeRead(schema string) (peers.ACLDecision, error) {
+	open := peers.ACLDecision{Allowed: true}
+	if d.n.peerRegistry == nil {
+		return open, nil
+	}
+	if d.peer == "" {
+		if d.n.peerRegistry.ACLCovers(schema) {
+			return peers.ACLDecision{Restricted: true}, fmt.Errorf("%w: %s is access-controlled and the plugin has no licensee", peers.ErrACLDenied, schema)
+		}
+		return open, nil
+	}
+	decision := d.n.peerRegistry.Authorize(d.peer, peers.ACLQuery, schema)
+	if !decision.Allowed {
+		return decision, fmt.Errorf("%w: query %s", peers.ErrACLDenied, schema)
+	}
+	return decision, nil
+}
+
+// Query returns stored records matching the indexed-field filters that the
+// licensee's ACL lets it read.
+func (d *pluginDataAccess) Query(ctx context.Context, schema string, q wasiplugin.DataQuery) ([][]byte, error) {
+	if err := d.checkSchema(schema); err != nil {
+		return nil, err
+	}
+	decision, err := d.authorizeRead(schema)
+	if err != nil {
+		return nil, err
+	}
+	records, err := d.n.store.QueryByIndexedFields(schema, q.Day, q.NoradCatID, q.EntityID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(records))
+	for _, rec := range records {
+		if decision.Filtered() && !decision.AllowsObject(recordObject(schema, rec.Data)) {
+			continue
+		}
+		out = append(out, rec.Data)
+	}
+	return out, nil
+}
+
+// Subscribe reports every new record of schema, whether it arrived over
+// PubSub, the exchange protocol or the HTTP API, that the licensee's ACL
+// lets it read.
+func (d *pluginDataAccess) Subscribe(schema string, fn func(data []byte)) (func(), error) {
+	if err := d.checkSchema(schema); err != nil {
+		return nil, err
+	}
+	if _, err := d.authorizeRead(schema); err != nil {
+		return nil, err
+	}
+	return d.n.store.OnStore(func(schemaName string, rec *storage.Record) {
+		if schemaName != schema {
+			return
+		}
+		// Rules may change while subscribed, so each record is checked.
+		if decision, err := d.authorizeRead(schema); err != nil || !decision.AllowsObject(recordObject(schema, rec.Data)) {
+			return
+		}
+		fn(rec.Data)
+	}), nil
+}
+
+func recordObject(schema string, data []byte) peers.ACLObject {
+	norad, objectID := storage.RecordObject(schema, data)
+	return peers.ACLObject{NoradCatID: norad, ObjectID: objectID}
+}
+
+// Publish validates a record, stores it as this node's and announces it on
+// the schema topic.
+func (d *pluginDataAccess) Publish(ctx context.Context, schema string, data []byte) (string, error) {
+	if err := d.checkSchema(schema); err != nil {
+		return "", err
+	}
+	if err := d.n.validator.Validate(ctx, schema, data); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+	cid, err := d.n.store.Store(schema, data, d.n.host.ID().String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to store: %w", err)
+	}
+	if err := d.n.Publish(schema, data); err != nil {
+		log.Warnf("Stored plugin %s record %s but failed to announce it: %v", schema, cid, err)
+	}
+	return cid, nil
+}
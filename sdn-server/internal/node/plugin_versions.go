@@ -0,0 +1,135 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spacedatanetwork/sdn-server/internal/license"
+	"github.com/spacedatanetwork/sdn-server/plugins/wasmlicenseplugin"
+)
+
+// setRunningPluginVersion records the catalog version a plugin instance is
+// running.
+func (n *Node) setRunningPluginVersion(id, version string) {
+	if n.pluginRunning == nil {
+		n.pluginRunning = make(map[string]string)
+	}
+	n.pluginRunning[id] = version
+}
+
+func (n *Node) catalogRegistry() (*license.PluginRegistry, error) {
+	if n.pluginRegistry == nil {
+		return nil, errors.New("plugin catalog is not available")
+	}
+	return n.pluginRegistry, nil
+}
+
+// PluginVersions lists the active and retained versions of a catalog plugin.
+func (n *Node) PluginVersions(id string) ([]license.PluginDescriptor, error) {
+	reg, err := n.catalogRegistry()
+	if err != nil {
+		return nil, err
+	}
+	n.pluginMu.Lock()
+	defer n.pluginMu.Unlock()
+	if err := reg.Reload(); err != nil {
+		return nil, err
+	}
+	return reg.Versions(id)
+}
+
+// PinPluginVersion pins or unpins the active version of a catalog plugin.
+// Versions uploaded to a pinned plugin are retained without being activated.
+func (n *Node) PinPluginVersion(id string, pinned bool) error {
+	reg, err := n.catalogRegistry()
+	if err != nil {
+		return err
+	}
+	n.pluginMu.Lock()
+	defer n.pluginMu.Unlock()
+	if err := reg.Reload(); err != nil {
+		return err
+	}
+	return reg.SetPinned(id, pinned)
+}
+
+// ActivatePluginVersion makes a retained version of a catalog plugin active
+// and hot-swaps the running instance to it. If the version fails to load,
+// the previously running version is restored.
+func (n *Node) ActivatePluginVersion(ctx context.Context, id, version string) error {
+	reg, err := n.catalogRegistry()
+	if err != nil {
+		return err
+	}
+	n.pluginMu.Lock()
+	defer n.pluginMu.Unlock()
+	if err := reg.Reload(); err != nil {
+		return err
+	}
+	if _, err := reg.Activate(id, version); err != nil {
+		return err
+	}
+	return n.reloadPluginLocked(ctx, reg, id)
+}
+
+// ReloadPlugin hot-swaps a running catalog plugin to the active version in
+// the on-disk catalog, e.g. after an upload. Requests in flight on the old
+// instance are drained first. If the new version fails its health probe the
+// running instance is kept and the catalog is rolled back to its version.
+func (n *Node) ReloadPlugin(ctx context.Context, id string) error {
+	reg, err := n.catalogRegistry()
+	if err != nil {
+		return err
+	}
+	n.pluginMu.Lock()
+	defer n.pluginMu.Unlock()
+	if err := reg.Reload(); err != nil {
+		return err
+	}
+	return n.reloadPluginLocked(ctx, reg, id)
+}
+
+// reloadPluginLocked swaps the running instance of id to the catalog's active
+// version. Callers must hold n.pluginMu.
+func (n *Node) reloadPluginLocked(ctx context.Context, reg *license.PluginRegistry, id string) error {
+	if id != wasmlicenseplugin.ID {
+		return fmt.Errorf("plugin %q has no local runtime wrapper", id)
+	}
+	asset, ok := reg.Get(id)
+	if !ok {
+		return fmt.Errorf("plugin %q is not in the catalog", id)
+	}
+	running := n.pluginRunning[id]
+	if running == asset.Version {
+		return nil
+	}
+	plugin, ok := n.getPluginByID(reg, id)
+	if !ok {
+		return fmt.Errorf("plugin %q is not running", id)
+	}
+
+	wasmBytes, err := reg.DecryptBundle(id, n.pluginKey)
+	if err == nil {
+		n.setPluginDataAccess(plugin, asset)
+		err = plugin.Reload(ctx, wasmBytes)
+	}
+	if err != nil {
+		err = fmt.Errorf("plugin %q version %s failed to load: %w", id, asset.Version, err)
+		if running != "" {
+			if prev, rbErr := reg.Activate(id, running); rbErr != nil {
+				log.Warnf("Unable to roll plugin %q back to version %s: %v", id, running, rbErr)
+			} else {
+				n.setPluginDataAccess(plugin, prev)
+				log.Warnf("Rolled plugin %q back to version %s", id, running)
+			}
+		}
+		_ = reg.SetRuntimeStatus(id, "running", err.Error())
+		return err
+	}
+
+	n.setRunningPluginVersion(id, asset.Version)
+	_ = reg.SetRuntimeStatus(id, "running", "reloaded")
+	log.Infof("Plugin %q hot-swapped to version %s", id, asset.Version)
+	return nil
+}
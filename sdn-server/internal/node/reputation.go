@@ -0,0 +1,79 @@
+package node
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/config"
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+	"github.com/spacedatanetwork/sdn-server/internal/protocol"
+)
+
+// reputationSweepInterval is how often expired blocks and demotions are
+// lifted.
+const reputationSweepInterval = time.Minute
+
+// setupReputation starts peer reputation scoring when enabled, feeding it
+// rate-limit hits and protocol offenses.
+func (n *Node) setupReputation(rateLimiter *protocol.PeerRateLimiter) {
+	cfg := n.config.Peers.Reputation
+	if !cfg.Enabled {
+		return
+	}
+
+	n.reputation = peers.NewReputation(n.peerRegistry, n.peerGater, reputationConfig(cfg))
+	n.reputation.SetDisconnectFunc(func(id peer.ID) {
+		if err := n.host.Network().ClosePeer(id); err != nil {
+			log.Debugf("Failed to disconnect blocked peer %s: %v", id.ShortString(), err)
+		}
+	})
+	if rateLimiter != nil {
+		rateLimiter.SetLimitedCallback(func(id peer.ID) {
+			n.reputation.Report(id, peers.OffenseRateLimited)
+		})
+	}
+	n.protocol.SetReputation(n.reputation, parseReputationDuration("stale_after", cfg.StaleAfter))
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.reputation.Run(n.ctx, reputationSweepInterval)
+	}()
+}
+
+// reputationConfig converts the YAML settings. Unset or invalid values fall
+// back to the peers package defaults.
+func reputationConfig(cfg config.ReputationConfig) peers.ReputationConfig {
+	out := peers.ReputationConfig{
+		HalfLife:       parseReputationDuration("half_life", cfg.HalfLife),
+		DemoteScore:    cfg.DemoteScore,
+		DemoteDuration: parseReputationDuration("demote_duration", cfg.DemoteDuration),
+		BlockScore:     cfg.BlockScore,
+		BlockDuration:  parseReputationDuration("block_duration", cfg.BlockDuration),
+	}
+	if len(cfg.Penalties) > 0 {
+		out.Penalties = make(map[peers.Offense]float64, len(cfg.Penalties))
+		for offense, points := range cfg.Penalties {
+			out.Penalties[peers.Offense(offense)] = points
+		}
+	}
+	return out
+}
+
+func parseReputationDuration(name, raw string) time.Duration {
+	if raw == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Warnf("Invalid peers.reputation.%s %q, using default: %v", name, raw, err)
+		return 0
+	}
+	return d
+}
+
+// Reputation returns the peer reputation engine, or nil when disabled.
+func (n *Node) Reputation() *peers.Reputation {
+	return n.reputation
+}
@@ -0,0 +1,84 @@
+package node
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
+)
+
+const (
+	// defaultEndorsementSyncInterval is used when sync_interval is unset.
+	defaultEndorsementSyncInterval = 10 * time.Minute
+	// endorsementInitialSync gives bootstrap connections time to come up
+	// before the first exchange.
+	endorsementInitialSync = 30 * time.Second
+)
+
+// setupWebOfTrust loads stored endorsements, serves them to peers and
+// periodically merges the endorsements held by connected peers.
+func (n *Node) setupWebOfTrust(privKey crypto.PrivKey, persistence *peers.SQLitePersistence) {
+	cfg := n.config.Peers.WebOfTrust
+	if !cfg.Enabled {
+		return
+	}
+
+	policy := peers.TrustPolicy{
+		MaxPathLength: cfg.MaxPathLength,
+		MinEndorsers:  cfg.MinEndorsers,
+	}
+	for _, s := range cfg.HonoredEndorsers {
+		id, err := peer.Decode(s)
+		if err != nil {
+			log.Warnf("Invalid honored endorser %s: %v", s, err)
+			continue
+		}
+		policy.HonoredEndorsers = append(policy.HonoredEndorsers, id)
+	}
+
+	var store peers.EndorsementPersistence
+	if persistence != nil {
+		store = persistence
+	}
+	wot, err := peers.NewWebOfTrust(n.peerRegistry, privKey, policy, store)
+	if err != nil {
+		log.Warnf("Web of trust disabled: %v", err)
+		return
+	}
+	n.webOfTrust = wot
+	wot.RegisterProtocol(n.host)
+
+	interval := defaultEndorsementSyncInterval
+	if cfg.SyncInterval != "" {
+		if d, err := time.ParseDuration(cfg.SyncInterval); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Warnf("Invalid peers.web_of_trust.sync_interval %q, using %s", cfg.SyncInterval, interval)
+		}
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		timer := time.NewTimer(endorsementInitialSync)
+		defer timer.Stop()
+		for {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-timer.C:
+				wot.SyncAll(n.ctx, n.host)
+				// Expiry and manual trust changes also move derived trust.
+				wot.Recompute()
+				timer.Reset(interval)
+			}
+		}
+	}()
+}
+
+// WebOfTrust returns the endorsement store, or nil when disabled.
+func (n *Node) WebOfTrust() *peers.WebOfTrust {
+	return n.webOfTrust
+}
@@ -0,0 +1,531 @@
+package peers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ACLAction is an operation an ACL rule grants on a schema.
+type ACLAction string
+
+const (
+	// ACLPublish allows pushing records of the schema to this node
+	ACLPublish ACLAction = "publish"
+	// ACLQuery allows reading and querying stored records of the schema
+	ACLQuery ACLAction = "query"
+	// ACLSubscribe allows joining the schema's PubSub topic mesh
+	ACLSubscribe ACLAction = "subscribe"
+)
+
+// ACLWildcard matches every schema in an ACL rule.
+const ACLWildcard = "*"
+
+// ACL errors
+var (
+	ErrACLDenied      = errors.New("access denied by ACL")
+	ErrInvalidACLRule = errors.New("invalid ACL rule")
+)
+
+// ACLRule grants a peer, or every member of a group, a set of actions on one
+// schema. When NoradCatIDs or ObjectIDs are set, the rule only covers records
+// about those objects.
+type ACLRule struct {
+	// ID identifies the rule; it is the grant_id in ACL.fbs exports
+	ID string `json:"id"`
+
+	// Schema is the schema name ("OMM" or "OMM.fbs"), or "*" for all schemas
+	Schema string `json:"schema"`
+
+	// Actions are the operations the rule grants
+	Actions []ACLAction `json:"actions"`
+
+	// NoradCatIDs limits the rule to records about these catalog numbers
+	NoradCatIDs []uint32 `json:"norad_cat_ids,omitempty"`
+
+	// ObjectIDs limits the rule to records with these object or entity IDs
+	ObjectIDs []string `json:"object_ids,omitempty"`
+
+	// ExpiresAt is when the rule stops applying (zero = never)
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// CreatedAt is when the rule was added
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the rule and normalises its schema name and actions.
+func (r *ACLRule) Validate() error {
+	r.Schema = strings.TrimSpace(r.Schema)
+	if r.Schema == "" {
+		return fmt.Errorf("%w: schema is required", ErrInvalidACLRule)
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("%w: at least one action is required", ErrInvalidACLRule)
+	}
+	for i, a := range r.Actions {
+		a = ACLAction(strings.ToLower(strings.TrimSpace(string(a))))
+		switch a {
+		case ACLPublish, ACLQuery, ACLSubscribe:
+			r.Actions[i] = a
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidACLRule, a)
+		}
+	}
+	if r.ID == "" {
+		r.ID = newRuleID()
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Filtered reports whether the rule is limited to specific objects.
+func (r *ACLRule) Filtered() bool {
+	return len(r.NoradCatIDs) > 0 || len(r.ObjectIDs) > 0
+}
+
+func (r *ACLRule) matches(action ACLAction, schema string, now time.Time) bool {
+	if !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt) {
+		return false
+	}
+	if r.Schema != ACLWildcard && normalizeSchema(r.Schema) != normalizeSchema(schema) {
+		return false
+	}
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ACLObject identifies the object a record describes. Zero fields are unknown.
+type ACLObject struct {
+	NoradCatID uint32
+	ObjectID   string
+}
+
+// ACLDecision is the result of evaluating a peer's ACL rules for one action
+// on one schema.
+type ACLDecision struct {
+	// Restricted is true when ACL rules apply to the peer at all. Peers
+	// without rules fall back to trust-level checks alone.
+	Restricted bool `json:"restricted"`
+
+	// Allowed is true when the action is permitted for at least some objects
+	Allowed bool `json:"allowed"`
+
+	// NoradCatIDs and ObjectIDs list the objects the peer is limited to.
+	// Both are empty when access is not object-filtered.
+	NoradCatIDs []uint32 `json:"norad_cat_ids,omitempty"`
+	ObjectIDs   []string `json:"object_ids,omitempty"`
+}
+
+// Filtered reports whether access is limited to specific objects.
+func (d ACLDecision) Filtered() bool {
+	return len(d.NoradCatIDs) > 0 || len(d.ObjectIDs) > 0
+}
+
+// AllowsObject reports whether the decision covers a record about obj.
+// Filtered decisions reject records whose object is unknown.
+func (d ACLDecision) AllowsObject(obj ACLObject) bool {
+	if !d.Allowed {
+		return false
+	}
+	if !d.Filtered() {
+		return true
+	}
+	if obj.NoradCatID != 0 {
+		for _, id := range d.NoradCatIDs {
+			if id == obj.NoradCatID {
+				return true
+			}
+		}
+	}
+	if obj.ObjectID != "" {
+		for _, id := range d.ObjectIDs {
+			if strings.EqualFold(id, obj.ObjectID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorize evaluates the ACL rules of a peer and of the groups it belongs to.
+// Rules only grant: once any rule applies to a peer, actions on schemas no
+// rule covers are denied. Limited peers are read-only and may not publish.
+func (r *Registry) Authorize(id peer.ID, action ACLAction, schema string) ACLDecision {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tp, exists := r.peers[id]
+	if !exists || !tp.hasManualTrust() {
+		if dt, ok := r.derived[id]; ok && action == ACLPublish && dt.Level <= Limited {
+			return ACLDecision{Restricted: true}
+		}
+		if !exists {
+			return ACLDecision{Allowed: true}
+		}
+	} else if action == ACLPublish && tp.TrustLevel <= Limited {
+		return ACLDecision{Restricted: true}
+	}
+
+	rules := append([]ACLRule(nil), tp.ACL...)
+	for _, name := range tp.Groups {
+		if g, ok := r.groups[name]; ok {
+			rules = append(rules, g.ACL...)
+		}
+	}
+	if len(rules) == 0 {
+		return ACLDecision{Allowed: true}
+	}
+
+	decision := ACLDecision{Restricted: true}
+	now := time.Now()
+	unfiltered := false
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(action, schema, now) {
+			continue
+		}
+		decision.Allowed = true
+		if !rule.Filtered() {
+			unfiltered = true
+			continue
+		}
+		decision.NoradCatIDs = append(decision.NoradCatIDs, rule.NoradCatIDs...)
+		decision.ObjectIDs = append(decision.ObjectIDs, rule.ObjectIDs...)
+	}
+	if unfiltered {
+		decision.NoradCatIDs, decision.ObjectIDs = nil, nil
+	}
+	return decision
+}
+
+// CheckAccess returns ErrACLDenied unless the peer may perform action on a
+// record of schema about obj.
+func (r *Registry) CheckAccess(id peer.ID, action ACLAction, schema string, obj ACLObject) error {
+	decision := r.Authorize(id, action, schema)
+	if !decision.AllowsObject(obj) {
+		return fmt.Errorf("%w: %s %s", ErrACLDenied, action, schema)
+	}
+	return nil
+}
+
+// ACLCovers reports whether any ACL rule in force, on a peer or a group,
+// names schema or all schemas. Callers that cannot identify the requesting
+// peer must refuse such schemas, or the ACL is bypassed by staying
+// anonymous.
+func (r *Registry) ACLCovers(schema string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	covers := func(rules []ACLRule) bool {
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.ExpiresAt.IsZero() && now.After(rule.ExpiresAt) {
+				continue
+			}
+			if rule.Schema == ACLWildcard || normalizeSchema(rule.Schema) == normalizeSchema(schema) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tp := range r.peers {
+		if covers(tp.ACL) {
+			return true
+		}
+	}
+	for _, g := range r.groups {
+		if covers(g.ACL) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPeerACL replaces the ACL rules attached to a peer.
+func (r *Registry) SetPeerACL(id peer.ID, rules []ACLRule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tp, exists := r.peers[id]
+	if !exists {
+		return ErrPeerNotFound
+	}
+	tp.ACL = rules
+	r.save()
+	return nil
+}
+
+// SetGroupACL replaces the ACL rules attached to a group.
+func (r *Registry) SetGroupACL(name string, rules []ACLRule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, exists := r.groups[name]
+	if !exists {
+		return ErrGroupNotFound
+	}
+	g.ACL = rules
+	r.save()
+	return nil
+}
+
+// ACL.fbs interchange.
+//
+// Rules are exchanged as ACL.fbs access grants in their JSON form. ACL.fbs
+// was written for storefront purchases, so the fields are mapped as follows:
+//
+//	grant_id       rule ID
+//	listing_id     "sdn-acl:" + schema
+//	tier_name      comma-separated actions
+//	buyer_peer_id  peer ID, or "group:" + group name
+//	notes          object filter, e.g. "norad_cat_ids=25544,43013;object_ids=1998-067A"
+
+const (
+	aclListingPrefix = "sdn-acl:"
+	aclGroupPrefix   = "group:"
+)
+
+// ACLGrant is an ACL.fbs access grant in JSON form.
+type ACLGrant struct {
+	GrantID        string `json:"grant_id"`
+	ListingID      string `json:"listing_id"`
+	TierName       string `json:"tier_name"`
+	BuyerPeerID    string `json:"buyer_peer_id"`
+	AccessType     string `json:"access_type,omitempty"`
+	GrantedAt      uint64 `json:"granted_at"`
+	ExpiresAt      uint64 `json:"expires_at,omitempty"`
+	Status         string `json:"status"`
+	Notes          string `json:"notes,omitempty"`
+	ProviderPeerID string `json:"provider_peer_id,omitempty"`
+}
+
+// ACLCollection is an ACL.fbs grant collection in JSON form.
+type ACLCollection struct {
+	Grants     []ACLGrant `json:"grants"`
+	TotalCount uint32     `json:"total_count"`
+}
+
+// ExportACL returns every peer and group rule as ACL.fbs grants issued by
+// provider.
+func (r *Registry) ExportACL(provider string) *ACLCollection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := &ACLCollection{Grants: make([]ACLGrant, 0)}
+	for _, tp := range r.peers {
+		for _, rule := range tp.ACL {
+			out.Grants = append(out.Grants, rule.toGrant(tp.ID.String(), provider))
+		}
+	}
+	for _, g := range r.groups {
+		for _, rule := range g.ACL {
+			out.Grants = append(out.Grants, rule.toGrant(aclGroupPrefix+g.Name, provider))
+		}
+	}
+	sort.Slice(out.Grants, func(i, j int) bool { return out.Grants[i].GrantID < out.Grants[j].GrantID })
+	out.TotalCount = uint32(len(out.Grants))
+	return out
+}
+
+// ImportACL adds ACL.fbs grants as rules, replacing rules with the same ID.
+// Grants that are not active or name an unknown peer or group are skipped.
+// It returns the number of rules imported.
+func (r *Registry) ImportACL(collection *ACLCollection) (int, error) {
+	type target struct {
+		group string
+		peer  peer.ID
+	}
+	parsed := make(map[target][]ACLRule)
+	for _, grant := range collection.Grants {
+		if grant.Status != "" && grant.Status != "Active" {
+			continue
+		}
+		rule, err := ruleFromGrant(grant)
+		if err != nil {
+			return 0, fmt.Errorf("grant %s: %w", grant.GrantID, err)
+		}
+		var t target
+		if name, ok := strings.CutPrefix(grant.BuyerPeerID, aclGroupPrefix); ok {
+			t.group = name
+		} else {
+			id, err := peer.Decode(grant.BuyerPeerID)
+			if err != nil {
+				return 0, fmt.Errorf("grant %s: %w", grant.GrantID, ErrInvalidPeerID)
+			}
+			t.peer = id
+		}
+		parsed[t] = append(parsed[t], rule)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imported := 0
+	for t, rules := range parsed {
+		var existing *[]ACLRule
+		if t.group != "" {
+			g, ok := r.groups[t.group]
+			if !ok {
+				continue
+			}
+			existing = &g.ACL
+		} else {
+			tp, ok := r.peers[t.peer]
+			if !ok {
+				continue
+			}
+			existing = &tp.ACL
+		}
+		*existing = mergeRules(*existing, rules)
+		imported += len(rules)
+	}
+	r.save()
+	return imported, nil
+}
+
+func (r *ACLRule) toGrant(buyer, provider string) ACLGrant {
+	actions := make([]string, len(r.Actions))
+	for i, a := range r.Actions {
+		actions[i] = string(a)
+	}
+	grant := ACLGrant{
+		GrantID:        r.ID,
+		ListingID:      aclListingPrefix + r.Schema,
+		TierName:       strings.Join(actions, ","),
+		BuyerPeerID:    buyer,
+		AccessType:     "Query",
+		GrantedAt:      uint64(r.CreatedAt.Unix()),
+		Status:         "Active",
+		Notes:          formatObjectFilter(r.NoradCatIDs, r.ObjectIDs),
+		ProviderPeerID: provider,
+	}
+	for _, a := range r.Actions {
+		if a == ACLSubscribe {
+			grant.AccessType = "Streaming"
+		}
+	}
+	if !r.ExpiresAt.IsZero() {
+		grant.ExpiresAt = uint64(r.ExpiresAt.Unix())
+		if time.Now().After(r.ExpiresAt) {
+			grant.Status = "Expired"
+		}
+	}
+	return grant
+}
+
+func ruleFromGrant(grant ACLGrant) (ACLRule, error) {
+	schema, ok := strings.CutPrefix(grant.ListingID, aclListingPrefix)
+	if !ok {
+		return ACLRule{}, fmt.Errorf("%w: listing_id %q is not an SDN ACL", ErrInvalidACLRule, grant.ListingID)
+	}
+	rule := ACLRule{ID: grant.GrantID, Schema: schema}
+	for _, a := range strings.Split(grant.TierName, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			rule.Actions = append(rule.Actions, ACLAction(a))
+		}
+	}
+	if grant.GrantedAt > 0 {
+		rule.CreatedAt = time.Unix(int64(grant.GrantedAt), 0)
+	}
+	if grant.ExpiresAt > 0 {
+		rule.ExpiresAt = time.Unix(int64(grant.ExpiresAt), 0)
+	}
+	var err error
+	if rule.NoradCatIDs, rule.ObjectIDs, err = parseObjectFilter(grant.Notes); err != nil {
+		return ACLRule{}, err
+	}
+	return rule, rule.Validate()
+}
+
+func formatObjectFilter(norad []uint32, objects []string) string {
+	var parts []string
+	if len(norad) > 0 {
+		ids := make([]string, len(norad))
+		for i, id := range norad {
+			ids[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		parts = append(parts, "norad_cat_ids="+strings.Join(ids, ","))
+	}
+	if len(objects) > 0 {
+		parts = append(parts, "object_ids="+strings.Join(objects, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+func parseObjectFilter(s string) ([]uint32, []string, error) {
+	var norad []uint32
+	var objects []string
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			switch key {
+			case "norad_cat_ids":
+				id, err := strconv.ParseUint(v, 10, 32)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%w: invalid NORAD ID %q", ErrInvalidACLRule, v)
+				}
+				norad = append(norad, uint32(id))
+			case "object_ids":
+				objects = append(objects, v)
+			}
+		}
+	}
+	return norad, objects, nil
+}
+
+func mergeRules(existing, incoming []ACLRule) []ACLRule {
+	replaced := make(map[string]bool, len(incoming))
+	for _, rule := range incoming {
+		replaced[rule.ID] = true
+	}
+	out := make([]ACLRule, 0, len(existing)+len(incoming))
+	for _, rule := range existing {
+		if !replaced[rule.ID] {
+			out = append(out, rule)
+		}
+	}
+	return append(out, incoming...)
+}
+
+// normalizeSchema maps "OMM", "omm" and "OMM.fbs" to the same key.
+func normalizeSchema(schema string) string {
+	return strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(schema), ".fbs"))
+}
+
+func newRuleID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package peers
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestRegistry_Authorize(t *testing.T) {
+	registry := NewRegistry(false, nil)
+	analyst := testPeerID1
+	outsider := testPeerID2
+	for _, id := range []peer.ID{analyst, outsider} {
+		if err := registry.AddPeer(&TrustedPeer{ID: id, TrustLevel: Standard}); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+	}
+	registry.AddGroup(&PeerGroup{Name: "conjunction-analysts"})
+	registry.AddPeerToGroup(analyst, "conjunction-analysts")
+
+	err := registry.SetGroupACL("conjunction-analysts", []ACLRule{
+		{Schema: "CDM", Actions: []ACLAction{ACLQuery, ACLSubscribe}},
+		{Schema: "OMM.fbs", Actions: []ACLAction{"Query"}, NoradCatIDs: []uint32{25544}},
+	})
+	if err != nil {
+		t.Fatalf("SetGroupACL: %v", err)
+	}
+	if err := registry.SetPeerACL(analyst, []ACLRule{{Schema: "OMM", Actions: []ACLAction{ACLPublish}}}); err != nil {
+		t.Fatalf("SetPeerACL: %v", err)
+	}
+
+	// Peers without rules keep trust-level-only access.
+	if d := registry.Authorize(outsider, ACLPublish, "OMM.fbs"); d.Restricted || !d.Allowed {
+		t.Errorf("Peer without rules should be unrestricted, got %+v", d)
+	}
+
+	if d := registry.Authorize(analyst, ACLSubscribe, "CDM.fbs"); !d.Allowed || d.Filtered() {
+		t.Errorf("Group rule should allow unfiltered CDM subscribe, got %+v", d)
+	}
+	if d := registry.Authorize(analyst, ACLPublish, "CDM.fbs"); d.Allowed {
+		t.Error("Actions no rule grants should be denied")
+	}
+	if err := registry.CheckAccess(analyst, ACLPublish, "OMM.fbs", ACLObject{NoradCatID: 1}); err != nil {
+		t.Errorf("Peer rule should allow OMM publish: %v", err)
+	}
+
+	d := registry.Authorize(analyst, ACLQuery, "OMM.fbs")
+	if !d.Allowed || !d.Filtered() {
+		t.Fatalf("OMM query should be filtered, got %+v", d)
+	}
+	if !d.AllowsObject(ACLObject{NoradCatID: 25544}) {
+		t.Error("Filtered decision should cover its NORAD ID")
+	}
+	if d.AllowsObject(ACLObject{NoradCatID: 43013}) || d.AllowsObject(ACLObject{}) {
+		t.Error("Filtered decision should reject other or unknown objects")
+	}
+	if err := registry.CheckAccess(analyst, ACLQuery, "OMM.fbs", ACLObject{NoradCatID: 43013}); !errors.Is(err, ErrACLDenied) {
+		t.Errorf("CheckAccess = %v, want ErrACLDenied", err)
+	}
+
+	for _, schema := range []string{"CDM.fbs", "omm", "OMM.fbs"} {
+		if !registry.ACLCovers(schema) {
+			t.Errorf("ACLCovers(%q) = false, want true", schema)
+		}
+	}
+	if registry.ACLCovers("CAT.fbs") {
+		t.Error("ACLCovers(CAT.fbs) = true with no CAT rule")
+	}
+
+	// Expired rules no longer apply.
+	registry.SetPeerACL(analyst, []ACLRule{{Schema: "*", Actions: []ACLAction{ACLPublish}, ExpiresAt: time.Now().Add(-time.Minute)}})
+	if d := registry.Authorize(analyst, ACLPublish, "OMM.fbs"); d.Allowed {
+		t.Error("Expired rule should not grant access")
+	}
+	if registry.ACLCovers("CAT.fbs") {
+		t.Error("Expired wildcard rule should not cover CAT.fbs")
+	}
+
+	if err := registry.SetPeerACL(analyst, []ACLRule{{Schema: "OMM", Actions: []ACLAction{"delete"}}}); !errors.Is(err, ErrInvalidACLRule) {
+		t.Errorf("Unknown action = %v, want ErrInvalidACLRule", err)
+	}
+}
+
+func TestRegistry_ACLInterchange(t *testing.T) {
+	source := NewRegistry(false, nil)
+	id := testPeerID3
+	source.AddPeer(&TrustedPeer{ID: id, TrustLevel: Standard})
+	source.AddGroup(&PeerGroup{Name: "operators"})
+	source.SetPeerACL(id, []ACLRule{{
+		Schema:      "OMM",
+		Actions:     []ACLAction{ACLQuery, ACLSubscribe},
+		NoradCatIDs: []uint32{25544, 43013},
+		ObjectIDs:   []string{"1998-067A"},
+	}})
+	source.SetGroupACL("operators", []ACLRule{{Schema: "*", Actions: []ACLAction{ACLPublish}}})
+
+	exported := source.ExportACL("provider")
+	if exported.TotalCount != 2 {
+		t.Fatalf("Expected 2 grants, got %d", exported.TotalCount)
+	}
+
+	target := NewRegistry(false, nil)
+	target.AddPeer(&TrustedPeer{ID: id, TrustLevel: Standard})
+	target.AddGroup(&PeerGroup{Name: "operators"})
+	imported, err := target.ImportACL(exported)
+	if err != nil || imported != 2 {
+		t.Fatalf("ImportACL = %d, %v", imported, err)
+	}
+
+	tp, _ := target.GetPeer(id)
+	if len(tp.ACL) != 1 {
+		t.Fatalf("Expected 1 peer rule, got %d", len(tp.ACL))
+	}
+	rule := tp.ACL[0]
+	if rule.Schema != "OMM" || len(rule.Actions) != 2 || len(rule.NoradCatIDs) != 2 || rule.ObjectIDs[0] != "1998-067A" {
+		t.Errorf("Rule did not round-trip: %+v", rule)
+	}
+	group, _ := target.GetGroup("operators")
+	if len(group.ACL) != 1 || group.ACL[0].Schema != "*" {
+		t.Errorf("Group rule did not round-trip: %+v", group.ACL)
+	}
+
+	// Re-importing replaces rules with the same grant ID.
+	if _, err := target.ImportACL(exported); err != nil {
+		t.Fatalf("Second ImportACL: %v", err)
+	}
+	if tp, _ := target.GetPeer(id); len(tp.ACL) != 1 {
+		t.Errorf("Re-import should not duplicate rules, got %d", len(tp.ACL))
+	}
+}
+
+func TestSQLitePersistence_ACL(t *testing.T) {
+	sp, err := NewSQLitePersistence(filepath.Join(t.TempDir(), "peers.db"))
+	if err != nil {
+		t.Fatalf("NewSQLitePersistence: %v", err)
+	}
+	defer sp.Close()
+
+	registry := NewRegistry(false, sp)
+	registry.AddPeer(&TrustedPeer{ID: testPeerID1, TrustLevel: Standard})
+	registry.AddGroup(&PeerGroup{Name: "operators"})
+	registry.SetPeerACL(testPeerID1, []ACLRule{{Schema: "CAT", Actions: []ACLAction{ACLQuery}, NoradCatIDs: []uint32{25544}}})
+	registry.SetGroupACL("operators", []ACLRule{{Schema: "*", Actions: []ACLAction{ACLSubscribe}}})
+
+	peers, groups, err := sp.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if acl := peers[testPeerID1].ACL; len(acl) != 1 || acl[0].NoradCatIDs[0] != 25544 {
+		t.Errorf("Peer ACL not persisted: %+v", acl)
+	}
+	if acl := groups["operators"].ACL; len(acl) != 1 || acl[0].Actions[0] != ACLSubscribe {
+		t.Errorf("Group ACL not persisted: %+v", acl)
+	}
+}
@@ -3,6 +3,7 @@ package peers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/vcard"
 )
 
@@ -19,6 +21,10 @@ type APIHandler struct {
 	registry *Registry
 	gater    *TrustedConnectionGater
 	mux      *http.ServeMux
+	audit    *audit.Logger
+
+	reputation *Reputation
+	webOfTrust *WebOfTrust
 }
 
 // NewAPIHandler creates a new API handler.
@@ -32,6 +38,17 @@ func NewAPIHandler(registry *Registry, gater *TrustedConnectionGater) *APIHandle
 	return h
 }
 
+// SetAuditLogger records peer, group, blocklist and settings changes to
+// logger.
+func (h *APIHandler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
+// SetReputation includes reputation scores in peer stats.
+func (h *APIHandler) SetReputation(r *Reputation) {
+	h.reputation = r
+}
+
 // ServeHTTP implements http.Handler.
 func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Admin API is served from the same origin; no wildcard CORS.
@@ -60,6 +77,9 @@ func (h *APIHandler) setupRoutes() {
 	h.mux.HandleFunc("/api/blocklist", h.handleBlocklist)
 	h.mux.HandleFunc("/api/blocklist/", h.handleBlocklistByID)
 
+	// CIDR/ASN address filter rules and counters
+	h.mux.HandleFunc("/api/address-filter", h.handleAddressFilter)
+
 	// Settings
 	h.mux.HandleFunc("/api/settings", h.handleSettings)
 
@@ -240,6 +260,13 @@ func (h *APIHandler) addPeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePeerAdd,
+		TargetType:  "peer",
+		TargetID:    peerID.String(),
+		Description: fmt.Sprintf("Peer added with %s trust", tp.TrustLevel),
+		After:       tp,
+	})
 	w.WriteHeader(http.StatusCreated)
 	writeJSON(w, tp)
 }
@@ -257,11 +284,13 @@ func (h *APIHandler) updatePeer(w http.ResponseWriter, r *http.Request, peerID p
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	before := *existing
 
 	// Update fields if provided
 	if req.TrustLevel != "" {
 		if level, err := ParseTrustLevel(req.TrustLevel); err == nil {
 			existing.TrustLevel = level
+			delete(existing.Metadata, metaEPMOnly)
 		}
 	}
 	if req.Name != "" {
@@ -294,15 +323,37 @@ func (h *APIHandler) updatePeer(w http.ResponseWriter, r *http.Request, peerID p
 		return
 	}
 
+	event := audit.Event{
+		Type:        audit.EventTypePeerUpdate,
+		TargetType:  "peer",
+		TargetID:    peerID.String(),
+		Description: "Peer updated",
+		Before:      before,
+		After:       existing,
+	}
+	if before.TrustLevel != existing.TrustLevel {
+		event.Type = audit.EventTypePeerTrustChange
+		event.Description = fmt.Sprintf("Peer trust level changed: %s -> %s", before.TrustLevel, existing.TrustLevel)
+	}
+	h.audit.RecordRequest(r, event)
 	writeJSON(w, existing)
 }
 
 // removePeer removes a peer.
 func (h *APIHandler) removePeer(w http.ResponseWriter, r *http.Request, peerID peer.ID) {
+	before, _ := h.registry.GetPeer(peerID)
 	if err := h.registry.RemovePeer(peerID); err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePeerRemove,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "peer",
+		TargetID:    peerID.String(),
+		Description: "Peer removed",
+		Before:      before,
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -311,8 +362,12 @@ type UpdateTrustRequest struct {
 	TrustLevel string `json:"trust_level"`
 }
 
-// handlePeerTrust handles PUT /api/peers/:id/trust
+// handlePeerTrust handles GET and PUT /api/peers/:id/trust
 func (h *APIHandler) handlePeerTrust(w http.ResponseWriter, r *http.Request, peerID peer.ID) {
+	if r.Method == "GET" {
+		h.getPeerTrust(w, peerID)
+		return
+	}
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -330,10 +385,22 @@ func (h *APIHandler) handlePeerTrust(w http.ResponseWriter, r *http.Request, pee
 		return
 	}
 
+	var oldLevel TrustLevel
+	if existing, err := h.registry.GetPeer(peerID); err == nil {
+		oldLevel = existing.TrustLevel
+	}
 	if err := h.registry.SetTrustLevel(peerID, level); err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePeerTrustChange,
+		TargetType:  "peer",
+		TargetID:    peerID.String(),
+		Description: fmt.Sprintf("Peer trust level changed: %s -> %s", oldLevel, level),
+		Before:      map[string]string{"trust_level": oldLevel.String()},
+		After:       map[string]string{"trust_level": level.String()},
+	})
 
 	tp, _ := h.registry.GetPeer(peerID)
 	writeJSON(w, tp)
@@ -346,9 +413,20 @@ func (h *APIHandler) handlePeerStats(w http.ResponseWriter, r *http.Request, pee
 		return
 	}
 
+	var rep *PeerReputation
+	if h.reputation != nil {
+		current := h.reputation.Get(peerID)
+		rep = &current
+	}
+
 	tp, err := h.registry.GetPeer(peerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		// Unregistered peers only have stats once they have been scored.
+		if rep == nil || len(rep.Offenses) == 0 {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, ConnectionStats{PeerID: peerID, Reputation: rep})
 		return
 	}
 
@@ -360,12 +438,13 @@ func (h *APIHandler) handlePeerStats(w http.ResponseWriter, r *http.Request, pee
 		MessagesSent:     tp.MessagesSent,
 		BytesReceived:    tp.BytesReceived,
 		BytesSent:        tp.BytesSent,
+		Reputation:       rep,
 	}
 
 	writeJSON(w, stats)
 }
 
-// handlePeerEPM handles GET /api/peers/:id/epm[/vcard|/qr]
+// handlePeerEPM handles GET /api/peers/:id/epm[/vcard|/qr|/history]
 func (h *APIHandler) handlePeerEPM(w http.ResponseWriter, r *http.Request, peerID peer.ID, format string) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -397,6 +476,20 @@ func (h *APIHandler) handlePeerEPM(w http.ResponseWriter, r *http.Request, peerI
 		w.Header().Set("Content-Disposition", "attachment; filename=peer-"+peerID.ShortString()+".vcf")
 		w.Write([]byte(vcardData))
 
+	case "history":
+		// Versions without the EPM bytes; fetch the current one from /epm.
+		type versionInfo struct {
+			CID        string    `json:"cid"`
+			Size       int       `json:"size"`
+			ReceivedAt time.Time `json:"received_at"`
+			Source     string    `json:"source,omitempty"`
+		}
+		versions := make([]versionInfo, 0, len(tp.EPMHistory))
+		for _, v := range tp.EPMHistory {
+			versions = append(versions, versionInfo{CID: v.CID, Size: len(v.Data), ReceivedAt: v.ReceivedAt, Source: v.Source})
+		}
+		writeJSON(w, map[string]interface{}{"peer_id": peerID.String(), "versions": versions})
+
 	case "qr":
 		var qrData []byte
 		if len(tp.EPMData) > 0 {
@@ -443,6 +536,13 @@ func (h *APIHandler) handleGroups(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeGroupChange,
+			TargetType:  "group",
+			TargetID:    group.Name,
+			Description: "Group created",
+			After:       group,
+		})
 		w.WriteHeader(http.StatusCreated)
 		writeJSON(w, group)
 	default:
@@ -477,10 +577,18 @@ func (h *APIHandler) handleGroupByName(w http.ResponseWriter, r *http.Request) {
 		}
 		writeJSON(w, group)
 	case "DELETE":
+		before, _ := h.registry.GetGroup(groupName)
 		if err := h.registry.RemoveGroup(groupName); err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeGroupChange,
+			TargetType:  "group",
+			TargetID:    groupName,
+			Description: "Group removed",
+			Before:      before,
+		})
 		w.WriteHeader(http.StatusNoContent)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -515,6 +623,13 @@ func (h *APIHandler) handleGroupMembers(w http.ResponseWriter, r *http.Request,
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			h.audit.RecordRequest(r, audit.Event{
+				Type:        audit.EventTypeGroupChange,
+				TargetType:  "group",
+				TargetID:    groupName,
+				Description: "Peer added to group",
+				Details:     map[string]interface{}{"peer_id": peerID.String()},
+			})
 			w.WriteHeader(http.StatusCreated)
 			return
 		}
@@ -534,6 +649,13 @@ func (h *APIHandler) handleGroupMembers(w http.ResponseWriter, r *http.Request,
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeGroupChange,
+			TargetType:  "group",
+			TargetID:    groupName,
+			Description: "Peer removed from group",
+			Details:     map[string]interface{}{"peer_id": peerID.String()},
+		})
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -570,6 +692,13 @@ func (h *APIHandler) handleBlocklist(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		h.gater.Block(peerID)
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePeerBlock,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "peer",
+			TargetID:    peerID.String(),
+			Description: "Peer blocked",
+		})
 		w.WriteHeader(http.StatusCreated)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -596,12 +725,40 @@ func (h *APIHandler) handleBlocklistByID(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, map[string]bool{"blocked": blocked})
 	case "DELETE":
 		h.gater.Unblock(peerID)
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePeerUnblock,
+			TargetType:  "peer",
+			TargetID:    peerID.String(),
+			Description: "Peer unblocked",
+		})
 		w.WriteHeader(http.StatusNoContent)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// AddressFilterResponse reports the address filter rules and counters.
+type AddressFilterResponse struct {
+	Enabled bool `json:"enabled"`
+	NetworkFilterStats
+}
+
+// handleAddressFilter handles GET /api/address-filter
+func (h *APIHandler) handleAddressFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := AddressFilterResponse{NetworkFilterStats: NetworkFilterStats{Ranges: []AddressRangeStats{}}}
+	if h.gater != nil {
+		if f := h.gater.NetworkFilter(); f != nil {
+			resp.Enabled = true
+			resp.NetworkFilterStats = f.Stats()
+		}
+	}
+	writeJSON(w, resp)
+}
+
 // SettingsResponse represents the settings response.
 type SettingsResponse struct {
 	StrictMode bool `json:"strict_mode"`
@@ -628,7 +785,16 @@ func (h *APIHandler) handleSettings(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if req.StrictMode != nil {
+			before := h.registry.IsStrictMode()
 			h.registry.SetStrictMode(*req.StrictMode)
+			h.audit.RecordRequest(r, audit.Event{
+				Type:        audit.EventTypeConfigChange,
+				TargetType:  "config",
+				TargetID:    "strict_mode",
+				Description: "Configuration changed: strict_mode",
+				Before:      before,
+				After:       *req.StrictMode,
+			})
 		}
 		settings := SettingsResponse{
 			StrictMode: h.registry.IsStrictMode(),
@@ -674,10 +840,20 @@ func (h *APIHandler) handleImport(w http.ResponseWriter, r *http.Request) {
 
 	merge := r.URL.Query().Get("merge") == "true"
 
+	peersBefore := h.registry.PeerCount()
 	if err := h.registry.Import(data, merge); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePeerImport,
+		Severity:    audit.SeverityWarning,
+		TargetType:  "registry",
+		Description: "Peer registry imported",
+		Before:      map[string]int{"peers": peersBefore},
+		After:       map[string]int{"peers": h.registry.PeerCount()},
+		Details:     map[string]interface{}{"merge": merge},
+	})
 
 	settings := SettingsResponse{
 		StrictMode: h.registry.IsStrictMode(),
@@ -734,6 +910,13 @@ func (h *APIHandler) handleVCardImport(w http.ResponseWriter, r *http.Request) {
 			errors = append(errors, info.PeerID.ShortString()+": "+addErr.Error())
 		} else {
 			imported = append(imported, tp)
+			h.audit.RecordRequest(r, audit.Event{
+				Type:        audit.EventTypePeerAdd,
+				TargetType:  "peer",
+				TargetID:    tp.ID.String(),
+				Description: fmt.Sprintf("Peer imported from vCard with %s trust", tp.TrustLevel),
+				After:       tp,
+			})
 		}
 	}
 
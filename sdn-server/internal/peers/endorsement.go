@@ -0,0 +1,527 @@
+package peers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Endorsement errors
+var (
+	ErrInvalidEndorsement   = errors.New("invalid endorsement")
+	ErrEndorsementSignature = errors.New("endorsement signature does not verify")
+	ErrEndorsementNotFound  = errors.New("endorsement not found")
+	ErrUnknownEndorser      = errors.New("endorser is not honored, derived or registered")
+	ErrEndorsementLimit     = errors.New("endorser has too many endorsements")
+)
+
+// MaxEndorsementsPerEndorser bounds the endorsements and revocations kept
+// from any one endorser other than this node.
+const MaxEndorsementsPerEndorser = 256
+
+// defaultRevocationLifetime is how long a revocation of an unknown
+// endorsement is kept and gossiped.
+const defaultRevocationLifetime = 365 * 24 * time.Hour
+
+// Endorsement is a signed statement that Endorser vouches for Subject at
+// Level until ExpiresAt. A revocation is an endorsement with Revoked set; it
+// replaces any earlier endorsement of the same subject by the same endorser.
+type Endorsement struct {
+	Endorser  peer.ID    `json:"endorser"`
+	Subject   peer.ID    `json:"subject"`
+	Level     TrustLevel `json:"level"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Revoked   bool       `json:"revoked,omitempty"`
+	Signature []byte     `json:"signature"`
+}
+
+// signingBytes returns the canonical payload covered by the signature.
+func (e *Endorsement) signingBytes() []byte {
+	return []byte(fmt.Sprintf("sdn-trust-endorsement/1\n%s\n%s\n%s\n%d\n%d\n%t",
+		e.Endorser, e.Subject, e.Level, e.IssuedAt.Unix(), e.ExpiresAt.Unix(), e.Revoked))
+}
+
+// Verify checks the endorsement's fields and that it was signed by the key
+// embedded in the endorser's peer ID.
+func (e *Endorsement) Verify() error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	pub, err := e.Endorser.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEndorsementSignature, err)
+	}
+	ok, err := pub.Verify(e.signingBytes(), e.Signature)
+	if err != nil || !ok {
+		return ErrEndorsementSignature
+	}
+	return nil
+}
+
+func (e *Endorsement) validate() error {
+	if e.Endorser == "" || e.Subject == "" || e.Endorser == e.Subject {
+		return fmt.Errorf("%w: endorser and subject must be distinct peers", ErrInvalidEndorsement)
+	}
+	if e.Level < Limited || e.Level > Trusted {
+		return fmt.Errorf("%w: level must be limited, standard or trusted", ErrInvalidEndorsement)
+	}
+	if !e.ExpiresAt.After(e.IssuedAt) {
+		return fmt.Errorf("%w: expires_at must be after issued_at", ErrInvalidEndorsement)
+	}
+	return nil
+}
+
+// active reports whether the endorsement currently grants trust.
+func (e *Endorsement) active(now time.Time) bool {
+	return !e.Revoked && now.Before(e.ExpiresAt)
+}
+
+// DerivedTrust is the trust level a peer holds through endorsements. It is
+// kept apart from the manual trust level in the registry.
+type DerivedTrust struct {
+	Level     TrustLevel `json:"level"`
+	Depth     int        `json:"depth"`
+	Endorsers []peer.ID  `json:"endorsers"`
+}
+
+// TrustPolicy controls how endorsements turn into derived trust.
+type TrustPolicy struct {
+	// MaxPathLength is the longest endorsement chain from an honored
+	// endorser to a subject
+	MaxPathLength int `json:"max_path_length"`
+
+	// MinEndorsers is the number of distinct qualifying endorsers a subject
+	// needs
+	MinEndorsers int `json:"min_endorsers"`
+
+	// HonoredEndorsers are the peers whose endorsements root the web of
+	// trust. When empty, manually trusted and admin peers are honored.
+	HonoredEndorsers []peer.ID `json:"honored_endorsers,omitempty"`
+}
+
+// DefaultTrustPolicy returns the default derivation policy.
+func DefaultTrustPolicy() TrustPolicy {
+	return TrustPolicy{MaxPathLength: 2, MinEndorsers: 1}
+}
+
+// EndorsementPersistence stores endorsements. SQLitePersistence implements it.
+type EndorsementPersistence interface {
+	SaveEndorsements(endorsements []*Endorsement) error
+	LoadEndorsements() ([]*Endorsement, error)
+}
+
+type endorsementKey struct {
+	endorser, subject peer.ID
+}
+
+// WebOfTrust holds the endorsements known to this node and derives trust
+// for peers that are not in the registry from them.
+type WebOfTrust struct {
+	registry    *Registry
+	self        peer.ID
+	key         crypto.PrivKey
+	persistence EndorsementPersistence
+	now         func() time.Time
+
+	mu           sync.RWMutex
+	policy       TrustPolicy
+	endorsements map[endorsementKey]*Endorsement
+	perEndorser  map[peer.ID]int
+}
+
+// NewWebOfTrust creates a web of trust that signs endorsements with key and
+// publishes derived trust to registry. persistence may be nil.
+func NewWebOfTrust(registry *Registry, key crypto.PrivKey, policy TrustPolicy, persistence EndorsementPersistence) (*WebOfTrust, error) {
+	self, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	w := &WebOfTrust{
+		registry:     registry,
+		self:         self,
+		key:          key,
+		persistence:  persistence,
+		now:          time.Now,
+		policy:       normalizePolicy(policy),
+		endorsements: make(map[endorsementKey]*Endorsement),
+		perEndorser:  make(map[peer.ID]int),
+	}
+	if persistence != nil {
+		stored, err := persistence.LoadEndorsements()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range stored {
+			if e.Verify() == nil {
+				w.put(e)
+			}
+		}
+	}
+	registry.setTrustChangeHook(w.Recompute)
+	w.Recompute()
+	return w, nil
+}
+
+func normalizePolicy(p TrustPolicy) TrustPolicy {
+	def := DefaultTrustPolicy()
+	if p.MaxPathLength <= 0 {
+		p.MaxPathLength = def.MaxPathLength
+	}
+	if p.MinEndorsers <= 0 {
+		p.MinEndorsers = def.MinEndorsers
+	}
+	return p
+}
+
+// Policy returns the current derivation policy.
+func (w *WebOfTrust) Policy() TrustPolicy {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.policy
+}
+
+// SetPolicy replaces the derivation policy and recomputes derived trust.
+func (w *WebOfTrust) SetPolicy(policy TrustPolicy) {
+	w.mu.Lock()
+	w.policy = normalizePolicy(policy)
+	w.mu.Unlock()
+	w.Recompute()
+}
+
+// Issue signs an endorsement of subject at level by this node, replacing any
+// earlier endorsement or revocation of subject.
+func (w *WebOfTrust) Issue(subject peer.ID, level TrustLevel, expiresAt time.Time) (*Endorsement, error) {
+	now := w.now().UTC().Truncate(time.Second)
+	w.mu.RLock()
+	if prev, ok := w.endorsements[endorsementKey{w.self, subject}]; ok && !now.After(prev.IssuedAt) {
+		now = prev.IssuedAt.Add(time.Second)
+	}
+	w.mu.RUnlock()
+	e := &Endorsement{
+		Endorser:  w.self,
+		Subject:   subject,
+		Level:     level,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+	if err := w.sign(e); err != nil {
+		return nil, err
+	}
+	if _, err := w.Add(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Revoke signs a revocation of this node's endorsement of subject. The
+// revocation is kept for as long as the endorsement it replaces would have
+// been valid, so stale copies of that endorsement are not accepted again.
+func (w *WebOfTrust) Revoke(subject peer.ID) (*Endorsement, error) {
+	now := w.now().UTC().Truncate(time.Second)
+
+	w.mu.RLock()
+	prev, ok := w.endorsements[endorsementKey{w.self, subject}]
+	w.mu.RUnlock()
+	if !ok || prev.Revoked {
+		return nil, ErrEndorsementNotFound
+	}
+
+	expires := prev.ExpiresAt
+	if !expires.After(now) {
+		expires = now.Add(defaultRevocationLifetime)
+	}
+	// A revocation must sort after the endorsement it replaces.
+	if !now.After(prev.IssuedAt) {
+		now = prev.IssuedAt.Add(time.Second)
+	}
+	e := &Endorsement{
+		Endorser:  w.self,
+		Subject:   subject,
+		Level:     prev.Level,
+		IssuedAt:  now,
+		ExpiresAt: expires,
+		Revoked:   true,
+	}
+	if err := w.sign(e); err != nil {
+		return nil, err
+	}
+	if _, err := w.Add(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (w *WebOfTrust) sign(e *Endorsement) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+	sig, err := w.key.Sign(e.signingBytes())
+	if err != nil {
+		return err
+	}
+	e.Signature = sig
+	return nil
+}
+
+// Add verifies an endorsement and stores it if it is newer than the one held
+// for the same endorser and subject. It reports whether the set changed and
+// recomputes derived trust when it did.
+func (w *WebOfTrust) Add(e *Endorsement) (bool, error) {
+	changed, err := w.add(e)
+	if err != nil || !changed {
+		return changed, err
+	}
+	w.save()
+	w.Recompute()
+	return true, nil
+}
+
+// Merge adds endorsements received from another node and returns how many
+// were new. Invalid endorsements are skipped, as are those by endorsers that
+// are still unknown once the rest of the batch has been applied.
+func (w *WebOfTrust) Merge(endorsements []*Endorsement) int {
+	added := 0
+	pending := endorsements
+	for len(pending) > 0 {
+		// An endorser can gain derived trust from an endorsement later in
+		// the batch, so retry unknown endorsers after each round.
+		var unknown []*Endorsement
+		round := 0
+		for _, e := range pending {
+			changed, err := w.add(e)
+			if errors.Is(err, ErrUnknownEndorser) {
+				unknown = append(unknown, e)
+			} else if err == nil && changed {
+				round++
+			}
+		}
+		if round == 0 {
+			break
+		}
+		added += round
+		w.Recompute()
+		pending = unknown
+	}
+	if added > 0 {
+		w.save()
+	}
+	return added
+}
+
+func (w *WebOfTrust) add(e *Endorsement) (bool, error) {
+	if err := e.Verify(); err != nil {
+		return false, err
+	}
+	if !w.now().Before(e.ExpiresAt) {
+		return false, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := endorsementKey{e.Endorser, e.Subject}
+	prev, exists := w.endorsements[key]
+	if exists && !e.IssuedAt.After(prev.IssuedAt) {
+		return false, nil
+	}
+	if !w.knownEndorser(e.Endorser) {
+		return false, ErrUnknownEndorser
+	}
+	if !exists && e.Endorser != w.self && w.perEndorser[e.Endorser] >= MaxEndorsementsPerEndorser {
+		return false, ErrEndorsementLimit
+	}
+	w.put(e)
+	return true, nil
+}
+
+// put stores e, replacing the endorsement held for the same endorser and
+// subject. Callers hold w.mu or own w.
+func (w *WebOfTrust) put(e *Endorsement) {
+	key := endorsementKey{e.Endorser, e.Subject}
+	if _, ok := w.endorsements[key]; !ok {
+		w.perEndorser[e.Endorser]++
+	}
+	w.endorsements[key] = e
+}
+
+// knownEndorser reports whether endorsements by id are worth keeping: id is
+// this node, an honored endorser, or a peer with a manual or derived trust
+// level. Callers hold w.mu.
+func (w *WebOfTrust) knownEndorser(id peer.ID) bool {
+	if id == w.self || w.registry.isRegistered(id) {
+		return true
+	}
+	for _, honored := range w.policy.HonoredEndorsers {
+		if id == honored {
+			return true
+		}
+	}
+	_, derived := w.registry.GetDerivedTrust(id)
+	return derived
+}
+
+// List returns the unexpired endorsements and revocations known to the node,
+// optionally restricted to an endorser or subject.
+func (w *WebOfTrust) List(endorser, subject peer.ID) []*Endorsement {
+	now := w.now()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	out := make([]*Endorsement, 0, len(w.endorsements))
+	for key, e := range w.endorsements {
+		if !now.Before(e.ExpiresAt) {
+			continue
+		}
+		if (endorser != "" && key.endorser != endorser) || (subject != "" && key.subject != subject) {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].IssuedAt.Before(out[j].IssuedAt) })
+	return out
+}
+
+func (w *WebOfTrust) save() {
+	if w.persistence == nil {
+		return
+	}
+	if err := w.persistence.SaveEndorsements(w.List("", "")); err != nil {
+		log.Warnf("Failed to save endorsements: %v", err)
+	}
+}
+
+// Recompute drops expired endorsements and publishes derived trust to the
+// registry. The registry calls it when a manual trust level changes.
+func (w *WebOfTrust) Recompute() {
+	now := w.now()
+
+	w.mu.Lock()
+	for key, e := range w.endorsements {
+		if !now.Before(e.ExpiresAt) {
+			delete(w.endorsements, key)
+			if w.perEndorser[key.endorser]--; w.perEndorser[key.endorser] <= 0 {
+				delete(w.perEndorser, key.endorser)
+			}
+		}
+	}
+	derived := w.derive(now)
+	w.mu.Unlock()
+
+	w.registry.SetDerivedTrust(derived)
+}
+
+// derive walks endorsement chains outward from the honored endorsers, one
+// hop per round up to MaxPathLength. A subject needs MinEndorsers distinct
+// endorsers that are honored or hold derived Trusted level from an earlier
+// round. Each endorsement counts at most at its endorser's own level, and
+// the subject gets the highest level that MinEndorsers endorsers agree on.
+// Callers hold w.mu.
+func (w *WebOfTrust) derive(now time.Time) map[peer.ID]DerivedTrust {
+	// Endorsers whose endorsements count, with the level they can vouch at.
+	endorsers := map[peer.ID]TrustLevel{w.self: Trusted}
+	if len(w.policy.HonoredEndorsers) > 0 {
+		for _, id := range w.policy.HonoredEndorsers {
+			endorsers[id] = Trusted
+		}
+	} else {
+		for _, tp := range w.registry.ListPeers() {
+			if tp.TrustLevel >= Trusted {
+				endorsers[tp.ID] = Trusted
+			}
+		}
+	}
+
+	bySubject := make(map[peer.ID][]*Endorsement)
+	for _, e := range w.endorsements {
+		if e.active(now) {
+			bySubject[e.Subject] = append(bySubject[e.Subject], e)
+		}
+	}
+
+	derived := make(map[peer.ID]DerivedTrust)
+	for depth := 1; depth <= w.policy.MaxPathLength; depth++ {
+		round := make(map[peer.ID]DerivedTrust)
+		for subject, list := range bySubject {
+			if subject == w.self {
+				continue
+			}
+			if _, done := derived[subject]; done {
+				continue
+			}
+			var levels []TrustLevel
+			var from []peer.ID
+			for _, e := range list {
+				limit, ok := endorsers[e.Endorser]
+				if !ok {
+					continue
+				}
+				level := e.Level
+				if level > limit {
+					level = limit
+				}
+				levels = append(levels, level)
+				from = append(from, e.Endorser)
+			}
+			if len(levels) < w.policy.MinEndorsers {
+				continue
+			}
+			sort.Slice(levels, func(i, j int) bool { return levels[i] > levels[j] })
+			sort.Slice(from, func(i, j int) bool { return from[i] < from[j] })
+			round[subject] = DerivedTrust{
+				Level:     levels[w.policy.MinEndorsers-1],
+				Depth:     depth,
+				Endorsers: from,
+			}
+		}
+		if len(round) == 0 {
+			break
+		}
+		for subject, dt := range round {
+			derived[subject] = dt
+			if _, honored := endorsers[subject]; !honored && dt.Level >= Trusted && !w.registry.isRegistered(subject) {
+				endorsers[subject] = dt.Level
+			}
+		}
+	}
+	return derived
+}
+
+// SetDerivedTrust replaces the trust levels derived from endorsements.
+func (r *Registry) SetDerivedTrust(derived map[peer.ID]DerivedTrust) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.derived = derived
+}
+
+// GetDerivedTrust returns the trust a peer holds through endorsements,
+// whether or not it also has a manual trust level.
+func (r *Registry) GetDerivedTrust(id peer.ID) (DerivedTrust, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dt, ok := r.derived[id]
+	return dt, ok
+}
+
+// ListDerivedTrust returns all derived trust levels.
+func (r *Registry) ListDerivedTrust() map[peer.ID]DerivedTrust {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[peer.ID]DerivedTrust, len(r.derived))
+	for id, dt := range r.derived {
+		out[id] = dt
+	}
+	return out
+}
+
+// isRegistered reports whether id has a manual trust level.
+func (r *Registry) isRegistered(id peer.ID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tp, ok := r.peers[id]
+	return ok && tp.hasManualTrust()
+}
@@ -0,0 +1,160 @@
+package peers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
+)
+
+// defaultEndorsementLifetime is used when an endorsement request has no
+// expiry.
+const defaultEndorsementLifetime = 90 * 24 * time.Hour
+
+// SetWebOfTrust enables the endorsement endpoints and derived trust in peer
+// trust responses.
+func (h *APIHandler) SetWebOfTrust(w *WebOfTrust) {
+	h.webOfTrust = w
+	h.mux.HandleFunc("/api/endorsements", h.handleEndorsements)
+	h.mux.HandleFunc("/api/endorsements/", h.handleEndorsementBySubject)
+	h.mux.HandleFunc("/api/trust/derived", h.handleDerivedTrust)
+}
+
+// IssueEndorsementRequest is the request body for endorsing a peer.
+type IssueEndorsementRequest struct {
+	Subject   string    `json:"subject"`
+	Level     string    `json:"level"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// PeerTrustResponse shows a peer's manual and derived trust side by side.
+type PeerTrustResponse struct {
+	PeerID    peer.ID       `json:"peer_id"`
+	Manual    *TrustLevel   `json:"manual,omitempty"`
+	Derived   *DerivedTrust `json:"derived,omitempty"`
+	Effective TrustLevel    `json:"effective"`
+}
+
+// handleEndorsements handles GET /api/endorsements and POST /api/endorsements
+func (h *APIHandler) handleEndorsements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		var endorser, subject peer.ID
+		for param, dst := range map[string]*peer.ID{"endorser": &endorser, "subject": &subject} {
+			if v := r.URL.Query().Get(param); v != "" {
+				id, err := peer.Decode(v)
+				if err != nil {
+					http.Error(w, "Invalid "+param, http.StatusBadRequest)
+					return
+				}
+				*dst = id
+			}
+		}
+		writeJSON(w, h.webOfTrust.List(endorser, subject))
+	case "POST":
+		var req IssueEndorsementRequest
+		if err := readJSON(r, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subject, err := peer.Decode(req.Subject)
+		if err != nil {
+			http.Error(w, "Invalid subject", http.StatusBadRequest)
+			return
+		}
+		level, err := ParseTrustLevel(req.Level)
+		if err != nil {
+			http.Error(w, "Invalid trust level: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt.IsZero() {
+			req.ExpiresAt = time.Now().Add(defaultEndorsementLifetime)
+		}
+
+		e, err := h.webOfTrust.Issue(subject, level, req.ExpiresAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypePeerEndorse,
+			TargetType:  "peer",
+			TargetID:    subject.String(),
+			Description: fmt.Sprintf("Peer endorsed at %s until %s", level, e.ExpiresAt.Format(time.RFC3339)),
+			After:       map[string]string{"level": level.String(), "expires_at": e.ExpiresAt.Format(time.RFC3339)},
+		})
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, e)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEndorsementBySubject handles DELETE /api/endorsements/:subject,
+// which revokes this node's endorsement of the subject.
+func (h *APIHandler) handleEndorsementBySubject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	subject, err := peer.Decode(strings.TrimPrefix(r.URL.Path, "/api/endorsements/"))
+	if err != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+
+	e, err := h.webOfTrust.Revoke(subject)
+	if errors.Is(err, ErrEndorsementNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit.RecordRequest(r, audit.Event{
+		Type:        audit.EventTypePeerEndorse,
+		TargetType:  "peer",
+		TargetID:    subject.String(),
+		Description: "Peer endorsement revoked",
+		Before:      map[string]string{"level": e.Level.String()},
+	})
+	writeJSON(w, e)
+}
+
+// handleDerivedTrust handles GET /api/trust/derived
+func (h *APIHandler) handleDerivedTrust(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	derived := h.registry.ListDerivedTrust()
+	out := make(map[string]DerivedTrust, len(derived))
+	for id, dt := range derived {
+		out[id.String()] = dt
+	}
+	writeJSON(w, map[string]interface{}{
+		"policy":  h.webOfTrust.Policy(),
+		"derived": out,
+	})
+}
+
+// getPeerTrust handles GET /api/peers/:id/trust
+func (h *APIHandler) getPeerTrust(w http.ResponseWriter, peerID peer.ID) {
+	resp := PeerTrustResponse{
+		PeerID:    peerID,
+		Effective: h.registry.GetTrustLevel(peerID),
+	}
+	if tp, err := h.registry.GetPeer(peerID); err == nil && tp.hasManualTrust() {
+		level := tp.TrustLevel
+		resp.Manual = &level
+	}
+	if dt, ok := h.registry.GetDerivedTrust(peerID); ok {
+		resp.Derived = &dt
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,108 @@
+package peers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	// EndorsementProtocolID is the libp2p protocol for exchanging trust
+	// endorsements.
+	EndorsementProtocolID = protocol.ID("/spacedatanetwork/trust-endorsements/1.0.0")
+
+	// endorsementStreamTimeout bounds a single exchange.
+	endorsementStreamTimeout = 15 * time.Second
+	// maxEndorsementPayload caps the size of an endorsement set.
+	maxEndorsementPayload = 4 * 1024 * 1024
+)
+
+// RegisterProtocol registers the endorsement exchange handler on h.
+func (w *WebOfTrust) RegisterProtocol(h host.Host) {
+	h.SetStreamHandler(EndorsementProtocolID, w.handleStream)
+	log.Infof("Registered trust endorsement protocol: %s", EndorsementProtocolID)
+}
+
+// handleStream answers an exchange with every endorsement and revocation
+// this node knows about.
+//
+// Wire format: the responder writes payloadLen(4 LE) + JSON array of
+// endorsements and closes the stream. The requester sends nothing.
+func (w *WebOfTrust) handleStream(s network.Stream) {
+	defer s.Close()
+	_ = s.SetWriteDeadline(time.Now().Add(endorsementStreamTimeout))
+
+	data, err := json.Marshal(w.List("", ""))
+	if err != nil || len(data) > maxEndorsementPayload {
+		log.Warnf("trust-endorsements: cannot send endorsement set (%d bytes): %v", len(data), err)
+		return
+	}
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(len(data)))
+	if _, err := s.Write(header); err != nil {
+		log.Debugf("trust-endorsements: write to %s failed: %v", s.Conn().RemotePeer().ShortString(), err)
+		return
+	}
+	if _, err := s.Write(data); err != nil {
+		log.Debugf("trust-endorsements: write to %s failed: %v", s.Conn().RemotePeer().ShortString(), err)
+	}
+}
+
+// Sync fetches the endorsement set of target and merges it, returning the
+// number of new endorsements.
+func (w *WebOfTrust) Sync(ctx context.Context, h host.Host, target peer.ID) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, endorsementStreamTimeout)
+	defer cancel()
+
+	s, err := h.NewStream(ctx, target, EndorsementProtocolID)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	_ = s.SetReadDeadline(time.Now().Add(endorsementStreamTimeout))
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s, header); err != nil {
+		return 0, err
+	}
+	size := binary.LittleEndian.Uint32(header)
+	if size > maxEndorsementPayload {
+		return 0, fmt.Errorf("endorsement set too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(s, data); err != nil {
+		return 0, err
+	}
+
+	var endorsements []*Endorsement
+	if err := json.Unmarshal(data, &endorsements); err != nil {
+		return 0, fmt.Errorf("decode endorsements: %w", err)
+	}
+	return w.Merge(endorsements), nil
+}
+
+// SyncAll exchanges endorsements with every connected peer that supports
+// the protocol.
+func (w *WebOfTrust) SyncAll(ctx context.Context, h host.Host) {
+	for _, id := range h.Network().Peers() {
+		if protos, err := h.Peerstore().SupportsProtocols(id, EndorsementProtocolID); err != nil || len(protos) == 0 {
+			continue
+		}
+		added, err := w.Sync(ctx, h, id)
+		if err != nil {
+			log.Debugf("trust-endorsements: sync with %s failed: %v", id.ShortString(), err)
+			continue
+		}
+		if added > 0 {
+			log.Infof("Received %d trust endorsements from %s", added, id.ShortString())
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package peers
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type testNode struct {
+	id  peer.ID
+	wot *WebOfTrust
+}
+
+// newTestNodes creates n webs of trust with their own keys, each backed by
+// its own registry.
+func newTestNodes(t *testing.T, n int) []testNode {
+	t.Helper()
+	nodes := make([]testNode, n)
+	for i := range nodes {
+		priv, _, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			t.Fatalf("GenerateEd25519Key: %v", err)
+		}
+		wot, err := NewWebOfTrust(NewRegistry(true, nil), priv, TrustPolicy{}, nil)
+		if err != nil {
+			t.Fatalf("NewWebOfTrust: %v", err)
+		}
+		nodes[i] = testNode{id: wot.self, wot: wot}
+	}
+	return nodes
+}
+
+func TestEndorsement_Verify(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+	e, err := nodes[0].wot.Issue(nodes[1].id, Standard, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if err := e.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	tampered := *e
+	tampered.Level = Trusted
+	if err := tampered.Verify(); !errors.Is(err, ErrEndorsementSignature) {
+		t.Errorf("Tampered level = %v, want ErrEndorsementSignature", err)
+	}
+
+	if _, err := nodes[0].wot.Issue(nodes[1].id, Admin, time.Now().Add(time.Hour)); !errors.Is(err, ErrInvalidEndorsement) {
+		t.Errorf("Admin endorsement = %v, want ErrInvalidEndorsement", err)
+	}
+	if _, err := nodes[0].wot.Issue(nodes[0].id, Standard, time.Now().Add(time.Hour)); !errors.Is(err, ErrInvalidEndorsement) {
+		t.Errorf("Self endorsement = %v, want ErrInvalidEndorsement", err)
+	}
+}
+
+func TestWebOfTrust_DerivePathLength(t *testing.T) {
+	// local trusts a manually; a endorses b as trusted; b endorses c.
+	nodes := newTestNodes(t, 4)
+	local, a, b, c := nodes[0], nodes[1], nodes[2], nodes[3]
+	local.wot.registry.AddPeer(&TrustedPeer{ID: a.id, TrustLevel: Trusted})
+
+	expires := time.Now().Add(time.Hour)
+	ab, _ := a.wot.Issue(b.id, Trusted, expires)
+	bc, _ := b.wot.Issue(c.id, Standard, expires)
+	if added := local.wot.Merge([]*Endorsement{ab, bc}); added != 2 {
+		t.Fatalf("Merge added %d, want 2", added)
+	}
+
+	registry := local.wot.registry
+	if level := registry.GetTrustLevel(b.id); level != Trusted {
+		t.Errorf("b should derive trusted, got %s", level)
+	}
+	dt, ok := registry.GetDerivedTrust(c.id)
+	if !ok || dt.Level != Standard || dt.Depth != 2 {
+		t.Errorf("c should derive standard at depth 2, got %+v (%v)", dt, ok)
+	}
+	if _, err := registry.GetPeer(c.id); err != ErrPeerNotFound {
+		t.Error("Derived trust must not add peers to the registry")
+	}
+
+	local.wot.SetPolicy(TrustPolicy{MaxPathLength: 1})
+	if level := registry.GetTrustLevel(c.id); level != Untrusted {
+		t.Errorf("c is beyond the path length, got %s", level)
+	}
+}
+
+func TestWebOfTrust_MinEndorsersAndHonored(t *testing.T) {
+	nodes := newTestNodes(t, 4)
+	local, a, b, subject := nodes[0], nodes[1], nodes[2], nodes[3]
+	registry := local.wot.registry
+	registry.AddPeer(&TrustedPeer{ID: a.id, TrustLevel: Trusted})
+	registry.AddPeer(&TrustedPeer{ID: b.id, TrustLevel: Trusted})
+
+	expires := time.Now().Add(time.Hour)
+	fromA, _ := a.wot.Issue(subject.id, Trusted, expires)
+	fromB, _ := b.wot.Issue(subject.id, Standard, expires)
+	local.wot.Merge([]*Endorsement{fromA, fromB})
+
+	local.wot.SetPolicy(TrustPolicy{MinEndorsers: 2})
+	dt, ok := registry.GetDerivedTrust(subject.id)
+	if !ok || dt.Level != Standard || len(dt.Endorsers) != 2 {
+		t.Errorf("Two endorsers should agree on standard, got %+v", dt)
+	}
+
+	local.wot.SetPolicy(TrustPolicy{MinEndorsers: 2, HonoredEndorsers: []peer.ID{a.id}})
+	if _, ok := registry.GetDerivedTrust(subject.id); ok {
+		t.Error("Only honored endorsers should count")
+	}
+
+	// Manual trust takes precedence over derived trust.
+	local.wot.SetPolicy(TrustPolicy{})
+	registry.AddPeer(&TrustedPeer{ID: subject.id, TrustLevel: Limited})
+	if level := registry.GetTrustLevel(subject.id); level != Limited {
+		t.Errorf("Manual trust should win, got %s", level)
+	}
+	if _, ok := registry.GetDerivedTrust(subject.id); !ok {
+		t.Error("Derived trust should still be reported for registered peers")
+	}
+}
+
+func TestWebOfTrust_Revoke(t *testing.T) {
+	nodes := newTestNodes(t, 3)
+	local, a, subject := nodes[0], nodes[1], nodes[2]
+	local.wot.registry.AddPeer(&TrustedPeer{ID: a.id, TrustLevel: Trusted})
+
+	endorsement, _ := a.wot.Issue(subject.id, Standard, time.Now().Add(time.Hour))
+	local.wot.Merge([]*Endorsement{endorsement})
+	if _, ok := local.wot.registry.GetDerivedTrust(subject.id); !ok {
+		t.Fatal("Expected derived trust before revocation")
+	}
+
+	revocation, err := a.wot.Revoke(subject.id)
+	if err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	local.wot.Merge([]*Endorsement{revocation})
+	if _, ok := local.wot.registry.GetDerivedTrust(subject.id); ok {
+		t.Error("Revocation should remove derived trust")
+	}
+
+	// A replayed copy of the original endorsement does not undo the revocation.
+	if added := local.wot.Merge([]*Endorsement{endorsement}); added != 0 {
+		t.Error("Older endorsement should not replace a revocation")
+	}
+	if _, err := a.wot.Revoke(subject.id); !errors.Is(err, ErrEndorsementNotFound) {
+		t.Errorf("Second revoke = %v, want ErrEndorsementNotFound", err)
+	}
+}
+
+func TestWebOfTrust_UnknownEndorsersAndLimit(t *testing.T) {
+	nodes := newTestNodes(t, 3)
+	local, stranger, a := nodes[0], nodes[1], nodes[2]
+	expires := time.Now().Add(time.Hour)
+
+	// Endorsements by a peer the node has no trust level for are not kept.
+	junk, _ := stranger.wot.Issue(a.id, Trusted, expires)
+	if added := local.wot.Merge([]*Endorsement{junk}); added != 0 {
+		t.Errorf("Merge kept %d endorsements by an unknown endorser", added)
+	}
+	if _, err := local.wot.Add(junk); !errors.Is(err, ErrUnknownEndorser) {
+		t.Errorf("Add = %v, want ErrUnknownEndorser", err)
+	}
+
+	// A registered endorser is capped.
+	local.wot.registry.AddPeer(&TrustedPeer{ID: a.id, TrustLevel: Standard})
+	batch := make([]*Endorsement, 0, MaxEndorsementsPerEndorser+1)
+	for i := 0; i <= MaxEndorsementsPerEndorser; i++ {
+		priv, _, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			t.Fatalf("GenerateEd25519Key: %v", err)
+		}
+		subject, _ := peer.IDFromPrivateKey(priv)
+		e, err := a.wot.Issue(subject, Standard, expires)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		batch = append(batch, e)
+	}
+	if added := local.wot.Merge(batch); added != MaxEndorsementsPerEndorser {
+		t.Errorf("Merge added %d, want the cap of %d", added, MaxEndorsementsPerEndorser)
+	}
+}
+
+func TestWebOfTrust_RecomputesOnTrustChange(t *testing.T) {
+	nodes := newTestNodes(t, 3)
+	local, a, subject := nodes[0], nodes[1], nodes[2]
+	registry := local.wot.registry
+	registry.AddPeer(&TrustedPeer{ID: a.id, TrustLevel: Standard})
+
+	endorsement, _ := a.wot.Issue(subject.id, Standard, time.Now().Add(time.Hour))
+	local.wot.Merge([]*Endorsement{endorsement})
+	if _, ok := registry.GetDerivedTrust(subject.id); ok {
+		t.Fatal("A standard endorser should not be honored")
+	}
+
+	if err := registry.SetTrustLevel(a.id, Trusted); err != nil {
+		t.Fatalf("SetTrustLevel: %v", err)
+	}
+	if _, ok := registry.GetDerivedTrust(subject.id); !ok {
+		t.Error("Honoring an endorser should derive trust without waiting for a recompute")
+	}
+
+	if err := registry.RemovePeer(a.id); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+	if _, ok := registry.GetDerivedTrust(subject.id); ok {
+		t.Error("Removing the endorser should drop the derived trust it gave")
+	}
+}
+
+func TestSQLitePersistence_Endorsements(t *testing.T) {
+	sp, err := NewSQLitePersistence(filepath.Join(t.TempDir(), "peers.db"))
+	if err != nil {
+		t.Fatalf("NewSQLitePersistence: %v", err)
+	}
+	defer sp.Close()
+
+	priv, _, _ := crypto.GenerateEd25519Key(nil)
+	wot, err := NewWebOfTrust(NewRegistry(false, sp), priv, TrustPolicy{}, sp)
+	if err != nil {
+		t.Fatalf("NewWebOfTrust: %v", err)
+	}
+	if _, err := wot.Issue(testPeerID1, Trusted, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	reloaded, err := NewWebOfTrust(NewRegistry(false, sp), priv, TrustPolicy{}, sp)
+	if err != nil {
+		t.Fatalf("NewWebOfTrust: %v", err)
+	}
+	if level := reloaded.registry.GetTrustLevel(testPeerID1); level != Trusted {
+		t.Errorf("Persisted endorsement should derive trusted, got %s", level)
+	}
+}
@@ -18,7 +18,9 @@ var log = logging.Logger("sdn-peers")
 type TrustedConnectionGater struct {
 	registry    *Registry
 	blocklist   map[peer.ID]struct{}
+	autoBlocked map[peer.ID]struct{} // blocks placed by AutoBlock
 	blocklistMu sync.RWMutex
+	netFilter   *NetworkFilter
 
 	// Callback for connection events
 	onBlocked func(peerID peer.ID, reason string)
@@ -27,8 +29,9 @@ type TrustedConnectionGater struct {
 // NewTrustedConnectionGater creates a new connection gater.
 func NewTrustedConnectionGater(registry *Registry) *TrustedConnectionGater {
 	return &TrustedConnectionGater{
-		registry:  registry,
-		blocklist: make(map[peer.ID]struct{}),
+		registry:    registry,
+		blocklist:   make(map[peer.ID]struct{}),
+		autoBlocked: make(map[peer.ID]struct{}),
 	}
 }
 
@@ -37,11 +40,24 @@ func (g *TrustedConnectionGater) SetBlockedCallback(cb func(peerID peer.ID, reas
 	g.onBlocked = cb
 }
 
-// Block adds a peer to the blocklist.
+// SetNetworkFilter enforces CIDR and ASN rules on dialed and accepted
+// addresses.
+func (g *TrustedConnectionGater) SetNetworkFilter(f *NetworkFilter) {
+	g.netFilter = f
+}
+
+// NetworkFilter returns the address filter, or nil when none is set.
+func (g *TrustedConnectionGater) NetworkFilter() *NetworkFilter {
+	return g.netFilter
+}
+
+// Block adds a peer to the blocklist. An automatic block on the peer
+// becomes a manual one that AutoUnblock leaves in place.
 func (g *TrustedConnectionGater) Block(peerID peer.ID) {
 	g.blocklistMu.Lock()
 	defer g.blocklistMu.Unlock()
 	g.blocklist[peerID] = struct{}{}
+	delete(g.autoBlocked, peerID)
 	log.Infof("Blocked peer: %s", peerID.ShortString())
 }
 
@@ -50,9 +66,38 @@ func (g *TrustedConnectionGater) Unblock(peerID peer.ID) {
 	g.blocklistMu.Lock()
 	defer g.blocklistMu.Unlock()
 	delete(g.blocklist, peerID)
+	delete(g.autoBlocked, peerID)
 	log.Infof("Unblocked peer: %s", peerID.ShortString())
 }
 
+// AutoBlock blocks a peer on the node's own initiative, unless it is
+// already blocked. It reports whether it placed the block.
+func (g *TrustedConnectionGater) AutoBlock(peerID peer.ID) bool {
+	g.blocklistMu.Lock()
+	defer g.blocklistMu.Unlock()
+	if _, blocked := g.blocklist[peerID]; blocked {
+		return false
+	}
+	g.blocklist[peerID] = struct{}{}
+	g.autoBlocked[peerID] = struct{}{}
+	log.Infof("Blocked peer: %s (automatic)", peerID.ShortString())
+	return true
+}
+
+// AutoUnblock lifts a block placed by AutoBlock. Blocks an operator placed,
+// before or since, stay. It reports whether the peer was unblocked.
+func (g *TrustedConnectionGater) AutoUnblock(peerID peer.ID) bool {
+	g.blocklistMu.Lock()
+	defer g.blocklistMu.Unlock()
+	if _, auto := g.autoBlocked[peerID]; !auto {
+		return false
+	}
+	delete(g.autoBlocked, peerID)
+	delete(g.blocklist, peerID)
+	log.Infof("Unblocked peer: %s (automatic)", peerID.ShortString())
+	return true
+}
+
 // IsBlocked checks if a peer is on the blocklist.
 func (g *TrustedConnectionGater) IsBlocked(peerID peer.ID) bool {
 	g.blocklistMu.RLock()
@@ -109,18 +154,46 @@ func (g *TrustedConnectionGater) InterceptPeerDial(p peer.ID) bool {
 // InterceptAddrDial is called before dialing a specific address.
 func (g *TrustedConnectionGater) InterceptAddrDial(p peer.ID, addr multiaddr.Multiaddr) bool {
 	// Use the same logic as InterceptPeerDial
-	return g.InterceptPeerDial(p)
+	if !g.InterceptPeerDial(p) {
+		return false
+	}
+	if g.netFilter != nil && !g.netFilter.Allow(addr) {
+		log.Debugf("Blocked dial to peer %s at %s: address filter", p.ShortString(), addr)
+		if g.onBlocked != nil {
+			g.onBlocked(p, "address filter")
+		}
+		return false
+	}
+	return true
 }
 
 // InterceptAccept is called when accepting a connection from a multiaddr.
 func (g *TrustedConnectionGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
-	// We can't know the peer ID at this point, so allow all accepts
-	// The peer ID check happens in InterceptSecured
+	// We can't know the peer ID at this point; only the address filter
+	// applies. The peer ID check happens in InterceptSecured
+	if g.netFilter != nil && !g.netFilter.Allow(addrs.RemoteMultiaddr()) {
+		log.Debugf("Rejected connection from %s: address filter", addrs.RemoteMultiaddr())
+		return false
+	}
 	return true
 }
 
 // InterceptSecured is called after the security handshake is complete.
 func (g *TrustedConnectionGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	if g.allowSecured(p) {
+		return true
+	}
+	// The connection will not open, so free the slot the address filter
+	// reserved for it
+	if g.netFilter != nil {
+		g.netFilter.Release(addrs.RemoteMultiaddr())
+	}
+	return false
+}
+
+// allowSecured applies the blocklist and strict-mode checks to a secured
+// connection from p.
+func (g *TrustedConnectionGater) allowSecured(p peer.ID) bool {
 	// Check blocklist first
 	if g.IsBlocked(p) {
 		log.Debugf("Rejected secured connection from peer %s: on blocklist", p.ShortString())
@@ -0,0 +1,453 @@
+package peers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ErrInvalidAddressRange is returned for malformed CIDR or ASN rules.
+var ErrInvalidAddressRange = errors.New("invalid address range")
+
+// reservationTimeout bounds how long a slot taken by Allow is held for a
+// connection that never opens, e.g. because its dial or handshake failed.
+const reservationTimeout = time.Minute
+
+// AddressRange is a CIDR block or an autonomous system, optionally with a cap
+// on concurrent connections from it.
+type AddressRange struct {
+	CIDR           string `json:"cidr,omitempty"`
+	ASN            uint32 `json:"asn,omitempty"`
+	MaxConnections int    `json:"max_connections,omitempty"`
+}
+
+func (ar AddressRange) String() string {
+	if ar.ASN != 0 {
+		return fmt.Sprintf("AS%d", ar.ASN)
+	}
+	return ar.CIDR
+}
+
+// NetworkFilterConfig lists the address ranges enforced by a NetworkFilter.
+type NetworkFilterConfig struct {
+	// Allow, when non-empty, restricts connections to these ranges
+	Allow []AddressRange
+
+	// Deny rejects connections from these ranges, even if allowed
+	Deny []AddressRange
+
+	// Limit caps connections from these ranges without allowing or denying
+	// them; Allow ranges may also set caps
+	Limit []AddressRange
+
+	// ASNDatabase is the path to an IP-to-ASN database, needed by ASN rules
+	ASNDatabase string
+}
+
+// AddressRangeStats reports the counters of one filter rule.
+type AddressRangeStats struct {
+	Action         string `json:"action"`
+	CIDR           string `json:"cidr,omitempty"`
+	ASN            uint32 `json:"asn,omitempty"`
+	MaxConnections int    `json:"max_connections,omitempty"`
+	Active         int    `json:"active"`
+	Pending        int    `json:"pending"`
+	Accepted       uint64 `json:"accepted"`
+	Rejected       uint64 `json:"rejected"`
+}
+
+// NetworkFilterStats reports the counters of a NetworkFilter.
+type NetworkFilterStats struct {
+	Ranges []AddressRangeStats `json:"ranges"`
+	// NotAllowed counts connections rejected for matching no allow range
+	NotAllowed uint64 `json:"not_allowed"`
+	// NoIP counts connections over transports without an IP address
+	NoIP uint64 `json:"no_ip"`
+	// ASNDatabaseEntries is the number of ranges in the loaded ASN database
+	ASNDatabaseEntries int `json:"asn_database_entries"`
+}
+
+type rangeRule struct {
+	action   string
+	spec     AddressRange
+	prefix   netip.Prefix
+	active   int
+	pending  int
+	accepted uint64
+	rejected uint64
+}
+
+// reservation is a slot taken by Allow on each matched rule, held until the
+// connection opens, is rejected, or times out.
+type reservation struct {
+	rules   []*rangeRule
+	expires time.Time
+}
+
+func (rr *rangeRule) matches(ip netip.Addr, asn uint32) bool {
+	if rr.spec.ASN != 0 {
+		return asn == rr.spec.ASN
+	}
+	return rr.prefix.Contains(ip)
+}
+
+// NetworkFilter enforces CIDR and ASN allow and deny lists and per-range
+// connection caps. Allow reserves a slot under each cap, so concurrent
+// handshakes cannot overshoot it; the filter counts open connections by
+// watching the network, so it must be registered with Network.Notify.
+type NetworkFilter struct {
+	asn *ASNDatabase
+
+	mu         sync.Mutex
+	rules      []*rangeRule
+	reserved   map[netip.Addr][]reservation
+	reserveTTL time.Duration
+	hasAllow   bool
+	notAllowed uint64
+	noIP       uint64
+}
+
+// NewNetworkFilter builds a filter from cfg, loading the ASN database when
+// one is configured.
+func NewNetworkFilter(cfg NetworkFilterConfig) (*NetworkFilter, error) {
+	f := &NetworkFilter{
+		reserved:   make(map[netip.Addr][]reservation),
+		reserveTTL: reservationTimeout,
+		hasAllow:   len(cfg.Allow) > 0,
+	}
+
+	if cfg.ASNDatabase != "" {
+		db, err := LoadASNDatabase(cfg.ASNDatabase)
+		if err != nil {
+			return nil, err
+		}
+		f.asn = db
+	}
+
+	for _, list := range []struct {
+		action string
+		ranges []AddressRange
+	}{{"deny", cfg.Deny}, {"allow", cfg.Allow}, {"limit", cfg.Limit}} {
+		for _, spec := range list.ranges {
+			rule := &rangeRule{action: list.action, spec: spec}
+			switch {
+			case spec.ASN != 0 && spec.CIDR != "":
+				return nil, fmt.Errorf("%w: %s rule sets both cidr and asn", ErrInvalidAddressRange, list.action)
+			case spec.ASN != 0:
+				if f.asn == nil {
+					return nil, fmt.Errorf("%w: AS%d needs an ASN database", ErrInvalidAddressRange, spec.ASN)
+				}
+			default:
+				prefix, err := netip.ParsePrefix(spec.CIDR)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidAddressRange, err)
+				}
+				rule.prefix = prefix.Masked()
+			}
+			if spec.MaxConnections < 0 {
+				return nil, fmt.Errorf("%w: negative max_connections for %s", ErrInvalidAddressRange, spec)
+			}
+			f.rules = append(f.rules, rule)
+		}
+	}
+	return f, nil
+}
+
+// addrIP returns the IP of a multiaddr, unmapping IPv4-in-IPv6 addresses.
+func addrIP(addr multiaddr.Multiaddr) (netip.Addr, bool) {
+	if addr == nil {
+		return netip.Addr{}, false
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	a, ok := netip.AddrFromSlice(ip)
+	return a.Unmap(), ok
+}
+
+// Allow reports whether a connection to or from addr may be opened, and
+// updates the rule counters. An allowed connection holds a slot under every
+// matching cap until it opens; call Release if it is rejected before then.
+// Addresses without an IP, such as onion addresses, are only allowed when
+// there is no allow list.
+func (f *NetworkFilter) Allow(addr multiaddr.Multiaddr) bool {
+	ip, ok := addrIP(addr)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireLocked(time.Now())
+
+	if !ok {
+		if f.hasAllow {
+			f.noIP++
+			return false
+		}
+		return true
+	}
+	asn := f.asn.Lookup(ip)
+
+	var matched []*rangeRule
+	allowed := !f.hasAllow
+	for _, rule := range f.rules {
+		if !rule.matches(ip, asn) {
+			continue
+		}
+		switch rule.action {
+		case "deny":
+			rule.rejected++
+			return false
+		case "allow":
+			allowed = true
+		}
+		matched = append(matched, rule)
+	}
+	if !allowed {
+		f.notAllowed++
+		return false
+	}
+	for _, rule := range matched {
+		if rule.spec.MaxConnections > 0 && rule.active+rule.pending >= rule.spec.MaxConnections {
+			rule.rejected++
+			return false
+		}
+	}
+	for _, rule := range matched {
+		rule.accepted++
+		rule.pending++
+	}
+	f.reserved[ip] = append(f.reserved[ip], reservation{rules: matched, expires: time.Now().Add(f.reserveTTL)})
+	return true
+}
+
+// Release frees the slot Allow reserved for a connection to or from addr
+// that was rejected or failed before it opened.
+func (f *NetworkFilter) Release(addr multiaddr.Multiaddr) {
+	ip, ok := addrIP(addr)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releaseLocked(ip)
+}
+
+// releaseLocked drops the oldest reservation for ip and reports whether
+// there was one.
+func (f *NetworkFilter) releaseLocked(ip netip.Addr) bool {
+	pending := f.reserved[ip]
+	if len(pending) == 0 {
+		return false
+	}
+	for _, rule := range pending[0].rules {
+		rule.pending--
+	}
+	if len(pending) == 1 {
+		delete(f.reserved, ip)
+	} else {
+		f.reserved[ip] = pending[1:]
+	}
+	return true
+}
+
+// expireLocked drops reservations for connections that never opened.
+func (f *NetworkFilter) expireLocked(now time.Time) {
+	for ip, pending := range f.reserved {
+		for len(pending) > 0 && now.After(pending[0].expires) {
+			f.releaseLocked(ip)
+			pending = f.reserved[ip]
+		}
+	}
+}
+
+// track adjusts the open connection count of every rule matching addr. An
+// opening connection takes over the slot Allow reserved for it.
+func (f *NetworkFilter) track(addr multiaddr.Multiaddr, delta int) {
+	ip, ok := addrIP(addr)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if delta > 0 {
+		f.releaseLocked(ip)
+	}
+	asn := f.asn.Lookup(ip)
+	for _, rule := range f.rules {
+		if rule.action != "deny" && rule.matches(ip, asn) {
+			rule.active += delta
+			if rule.active < 0 {
+				rule.active = 0
+			}
+		}
+	}
+}
+
+// Stats returns the filter's rules and counters.
+func (f *NetworkFilter) Stats() NetworkFilterStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireLocked(time.Now())
+	stats := NetworkFilterStats{
+		Ranges:     make([]AddressRangeStats, 0, len(f.rules)),
+		NotAllowed: f.notAllowed,
+		NoIP:       f.noIP,
+	}
+	if f.asn != nil {
+		stats.ASNDatabaseEntries = len(f.asn.ranges)
+	}
+	for _, rule := range f.rules {
+		stats.Ranges = append(stats.Ranges, AddressRangeStats{
+			Action:         rule.action,
+			CIDR:           rule.spec.CIDR,
+			ASN:            rule.spec.ASN,
+			MaxConnections: rule.spec.MaxConnections,
+			Active:         rule.active,
+			Pending:        rule.pending,
+			Accepted:       rule.accepted,
+			Rejected:       rule.rejected,
+		})
+	}
+	return stats
+}
+
+// Connected implements network.Notifiee.
+func (f *NetworkFilter) Connected(_ network.Network, c network.Conn) {
+	f.track(c.RemoteMultiaddr(), 1)
+}
+
+// Disconnected implements network.Notifiee.
+func (f *NetworkFilter) Disconnected(_ network.Network, c network.Conn) {
+	f.track(c.RemoteMultiaddr(), -1)
+}
+
+// Listen implements network.Notifiee.
+func (f *NetworkFilter) Listen(network.Network, multiaddr.Multiaddr) {}
+
+// ListenClose implements network.Notifiee.
+func (f *NetworkFilter) ListenClose(network.Network, multiaddr.Multiaddr) {}
+
+var _ network.Notifiee = (*NetworkFilter)(nil)
+
+type asnRange struct {
+	start, end netip.Addr
+	asn        uint32
+}
+
+// ASNDatabase maps IP addresses to autonomous system numbers.
+type ASNDatabase struct {
+	ranges []asnRange // sorted by start, non-overlapping
+}
+
+// LoadASNDatabase reads an IP-to-ASN database. Each line is either an
+// iptoasn.com style tab-separated range ("start end asn ...") or a
+// comma-separated "cidr,asn" pair. Blank lines, comments and ASN 0
+// (unrouted) entries are skipped.
+func LoadASNDatabase(path string) (*ASNDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open ASN database: %w", err)
+	}
+	defer f.Close()
+
+	db := &ASNDatabase{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseASNLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("ASN database %s line %d: %w", path, lineNo, err)
+		}
+		if r.asn != 0 {
+			db.ranges = append(db.ranges, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ASN database: %w", err)
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+func parseASNLine(line string) (asnRange, error) {
+	var r asnRange
+	if strings.Contains(line, "\t") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return r, errors.New("expected start, end and asn")
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return r, err
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return r, err
+		}
+		r.start, r.end = start.Unmap(), end.Unmap()
+		r.asn, err = parseASN(fields[2])
+		return r, err
+	}
+
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 {
+		return r, errors.New("expected cidr,asn")
+	}
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return r, err
+	}
+	prefix = prefix.Masked()
+	r.start, r.end = prefix.Addr(), lastAddr(prefix)
+	r.asn, err = parseASN(strings.TrimSpace(fields[1]))
+	return r, err
+}
+
+func parseASN(s string) (uint32, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	return uint32(n), err
+}
+
+// lastAddr returns the highest address in prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// Lookup returns the ASN announcing ip, or 0 when it is unknown. A nil
+// database knows no addresses.
+func (db *ASNDatabase) Lookup(ip netip.Addr) uint32 {
+	if db == nil {
+		return 0
+	}
+	// The last range starting at or before ip is the only candidate.
+	i := sort.Search(len(db.ranges), func(i int) bool { return ip.Less(db.ranges[i].start) }) - 1
+	if i < 0 {
+		return 0
+	}
+	r := db.ranges[i]
+	if r.start.BitLen() != ip.BitLen() || r.end.Less(ip) {
+		return 0
+	}
+	return r.asn
+}
@@ -0,0 +1,183 @@
+package peers
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+func tcpAddr(t *testing.T, s string) multiaddr.Multiaddr {
+	t.Helper()
+	addr, err := multiaddr.NewMultiaddr(s)
+	if err != nil {
+		t.Fatalf("NewMultiaddr(%s): %v", s, err)
+	}
+	return addr
+}
+
+func TestNetworkFilter_AllowDeny(t *testing.T) {
+	f, err := NewNetworkFilter(NetworkFilterConfig{
+		Allow: []AddressRange{{CIDR: "10.0.0.0/8"}, {CIDR: "fd00::/8"}},
+		Deny:  []AddressRange{{CIDR: "10.66.0.0/16"}},
+	})
+	if err != nil {
+		t.Fatalf("NewNetworkFilter: %v", err)
+	}
+
+	cases := []struct {
+		addr string
+		want bool
+	}{
+		{"/ip4/10.1.2.3/tcp/4001", true},
+		{"/ip6/fd00::1/udp/4001/quic-v1", true},
+		{"/ip4/10.66.1.1/tcp/4001", false},
+		{"/ip4/203.0.113.7/tcp/4001", false},
+		{"/onion3/vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd:4001", false},
+	}
+	for _, c := range cases {
+		if got := f.Allow(tcpAddr(t, c.addr)); got != c.want {
+			t.Errorf("Allow(%s) = %v, want %v", c.addr, got, c.want)
+		}
+	}
+
+	stats := f.Stats()
+	if stats.NotAllowed != 1 || stats.NoIP != 1 {
+		t.Errorf("Expected one not-allowed and one no-IP rejection, got %+v", stats)
+	}
+	if deny := stats.Ranges[0]; deny.Action != "deny" || deny.Rejected != 1 {
+		t.Errorf("Deny rule should count its rejection, got %+v", deny)
+	}
+}
+
+func TestNetworkFilter_ConnectionCap(t *testing.T) {
+	f, err := NewNetworkFilter(NetworkFilterConfig{
+		Limit: []AddressRange{{CIDR: "198.51.100.0/24", MaxConnections: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewNetworkFilter: %v", err)
+	}
+	addr := tcpAddr(t, "/ip4/198.51.100.9/tcp/4001")
+
+	for i := 0; i < 2; i++ {
+		if !f.Allow(addr) {
+			t.Fatalf("Connection %d should be under the cap", i+1)
+		}
+		f.track(addr, 1)
+	}
+	if f.Allow(addr) {
+		t.Error("Third connection should exceed the cap")
+	}
+	if !f.Allow(tcpAddr(t, "/ip4/192.0.2.1/tcp/4001")) {
+		t.Error("Addresses outside limited ranges are unaffected without an allow list")
+	}
+
+	f.track(addr, -1)
+	if !f.Allow(addr) {
+		t.Error("Closing a connection should free a slot")
+	}
+
+	limit := f.Stats().Ranges[0]
+	if limit.Active != 1 || limit.Accepted != 3 || limit.Rejected != 1 {
+		t.Errorf("Unexpected counters: %+v", limit)
+	}
+}
+
+func TestNetworkFilter_CapReservesSlots(t *testing.T) {
+	f, err := NewNetworkFilter(NetworkFilterConfig{
+		Limit: []AddressRange{{CIDR: "198.51.100.0/24", MaxConnections: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewNetworkFilter: %v", err)
+	}
+	addr := tcpAddr(t, "/ip4/198.51.100.9/tcp/4001")
+
+	// Handshakes in flight count against the cap before any opens.
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f.Allow(addr) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 2 {
+		t.Fatalf("%d concurrent connections allowed, want 2", n)
+	}
+	if limit := f.Stats().Ranges[0]; limit.Active != 0 || limit.Pending != 2 {
+		t.Errorf("Unexpected counters: %+v", limit)
+	}
+
+	// Opening a connection takes over its reservation.
+	f.track(addr, 1)
+	if limit := f.Stats().Ranges[0]; limit.Active != 1 || limit.Pending != 1 {
+		t.Errorf("Unexpected counters after open: %+v", limit)
+	}
+	if f.Allow(addr) {
+		t.Error("Open and pending connections should fill the cap")
+	}
+
+	// A rejected handshake gives its slot back.
+	f.Release(addr)
+	if !f.Allow(addr) {
+		t.Error("Releasing a reservation should free a slot")
+	}
+
+	// A reservation whose connection never opens expires.
+	f.reserveTTL = -time.Second
+	f.Release(addr)
+	if !f.Allow(addr) {
+		t.Fatal("Connection under the cap should be allowed")
+	}
+	if limit := f.Stats().Ranges[0]; limit.Active != 1 || limit.Pending != 0 {
+		t.Errorf("Expired reservation still held: %+v", limit)
+	}
+}
+
+func TestNetworkFilter_ASN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	db := "# start\tend\tasn\tcountry\tdescription\n" +
+		"192.0.2.0\t192.0.2.255\t64500\tZZ\tEXAMPLE-NET\n" +
+		"198.51.100.0\t198.51.100.255\t0\tNone\tNot routed\n" +
+		"2001:db8::/32,AS64501\n"
+	if err := os.WriteFile(path, []byte(db), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewNetworkFilter(NetworkFilterConfig{Deny: []AddressRange{{ASN: 64500}}}); !errors.Is(err, ErrInvalidAddressRange) {
+		t.Errorf("ASN rule without database = %v, want ErrInvalidAddressRange", err)
+	}
+
+	f, err := NewNetworkFilter(NetworkFilterConfig{
+		Deny:        []AddressRange{{ASN: 64500}, {ASN: 64501}},
+		ASNDatabase: path,
+	})
+	if err != nil {
+		t.Fatalf("NewNetworkFilter: %v", err)
+	}
+	if f.Stats().ASNDatabaseEntries != 2 {
+		t.Errorf("Expected 2 routed ranges, got %d", f.Stats().ASNDatabaseEntries)
+	}
+	if f.Allow(tcpAddr(t, "/ip4/192.0.2.77/tcp/4001")) {
+		t.Error("Address in denied ASN should be rejected")
+	}
+	if f.Allow(tcpAddr(t, "/ip6/2001:db8::5/tcp/4001")) {
+		t.Error("IPv6 address in denied ASN should be rejected")
+	}
+	if !f.Allow(tcpAddr(t, "/ip4/198.51.100.1/tcp/4001")) {
+		t.Error("Unrouted address should not match an ASN")
+	}
+	if asn := f.asn.Lookup(netip.MustParseAddr("192.0.3.1")); asn != 0 {
+		t.Errorf("Address past the last range should have no ASN, got %d", asn)
+	}
+}
@@ -78,6 +78,17 @@ func (sp *SQLitePersistence) initialize() error {
 		metadata TEXT
 	);
 
+	CREATE TABLE IF NOT EXISTS trust_endorsements (
+		endorser TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		level INTEGER NOT NULL,
+		issued_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		revoked INTEGER NOT NULL DEFAULT 0,
+		signature BLOB NOT NULL,
+		PRIMARY KEY (endorser, subject)
+	);
+
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT
@@ -88,7 +99,31 @@ func (sp *SQLitePersistence) initialize() error {
 	CREATE INDEX IF NOT EXISTS idx_peers_last_seen ON peers(last_seen);
 	`
 
-	_, err := sp.db.Exec(schema)
+	if _, err := sp.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the first release; add them to older databases.
+	for _, col := range []struct{ table, name string }{
+		{"peers", "epm_history"},
+		{"peers", "acl"},
+		{"peer_groups", "acl"},
+	} {
+		if err := sp.addColumn(col.table, col.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a TEXT column to table unless it already exists.
+func (sp *SQLitePersistence) addColumn(table, column string) error {
+	var exists int
+	err := sp.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = sp.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` TEXT`)
 	return err
 }
 
@@ -105,14 +140,16 @@ func (sp *SQLitePersistence) Save(peers map[peer.ID]*TrustedPeer, groups map[str
 		addrsJSON, _ := json.Marshal(multiaddrsToStrings(tp.Addrs))
 		groupsJSON, _ := json.Marshal(tp.Groups)
 		metadataJSON, _ := json.Marshal(tp.Metadata)
+		historyJSON, _ := json.Marshal(tp.EPMHistory)
+		aclJSON, _ := json.Marshal(tp.ACL)
 
 		_, err := tx.Exec(`
 			INSERT OR REPLACE INTO peers (
 				id, addrs, trust_level, name, organization, groups, notes,
 				added_at, last_seen, last_connected, connection_count,
 				messages_received, messages_sent, bytes_received, bytes_sent,
-				epm_data, vcard_data, metadata
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				epm_data, vcard_data, metadata, epm_history, acl
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 			tp.ID.String(),
 			string(addrsJSON),
@@ -132,6 +169,8 @@ func (sp *SQLitePersistence) Save(peers map[peer.ID]*TrustedPeer, groups map[str
 			tp.EPMData,
 			tp.VCardData,
 			string(metadataJSON),
+			string(historyJSON),
+			string(aclJSON),
 		)
 		if err != nil {
 			return err
@@ -142,11 +181,12 @@ func (sp *SQLitePersistence) Save(peers map[peer.ID]*TrustedPeer, groups map[str
 	for _, g := range groups {
 		membersJSON, _ := json.Marshal(peerIDsToStrings(g.Members))
 		metadataJSON, _ := json.Marshal(g.Metadata)
+		aclJSON, _ := json.Marshal(g.ACL)
 
 		_, err := tx.Exec(`
 			INSERT OR REPLACE INTO peer_groups (
-				name, description, default_trust_level, members, created_at, metadata
-			) VALUES (?, ?, ?, ?, ?, ?)
+				name, description, default_trust_level, members, created_at, metadata, acl
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
 		`,
 			g.Name,
 			g.Description,
@@ -154,6 +194,7 @@ func (sp *SQLitePersistence) Save(peers map[peer.ID]*TrustedPeer, groups map[str
 			string(membersJSON),
 			g.CreatedAt,
 			string(metadataJSON),
+			string(aclJSON),
 		)
 		if err != nil {
 			return err
@@ -173,7 +214,7 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 		SELECT id, addrs, trust_level, name, organization, groups, notes,
 			added_at, last_seen, last_connected, connection_count,
 			messages_received, messages_sent, bytes_received, bytes_sent,
-			epm_data, vcard_data, metadata
+			epm_data, vcard_data, metadata, epm_history, acl
 		FROM peers
 	`)
 	if err != nil {
@@ -201,13 +242,15 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 			epmData       []byte
 			vcardData     sql.NullString
 			metadataJSON  string
+			historyJSON   sql.NullString
+			aclJSON       sql.NullString
 		)
 
 		err := rows.Scan(
 			&idStr, &addrsJSON, &trustLevel, &name, &organization, &groupsJSON, &notes,
 			&addedAt, &lastSeen, &lastConnected, &connCount,
 			&msgsRecv, &msgsSent, &bytesRecv, &bytesSent,
-			&epmData, &vcardData, &metadataJSON,
+			&epmData, &vcardData, &metadataJSON, &historyJSON, &aclJSON,
 		)
 		if err != nil {
 			continue
@@ -227,6 +270,16 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 		var metadata map[string]string
 		json.Unmarshal([]byte(metadataJSON), &metadata)
 
+		var history []EPMVersion
+		if historyJSON.Valid {
+			json.Unmarshal([]byte(historyJSON.String), &history)
+		}
+
+		var acl []ACLRule
+		if aclJSON.Valid {
+			json.Unmarshal([]byte(aclJSON.String), &acl)
+		}
+
 		tp := &TrustedPeer{
 			ID:               peerID,
 			Addrs:            stringsToMultiaddrs(addrStrs),
@@ -246,6 +299,8 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 			EPMData:          epmData,
 			VCardData:        vcardData.String,
 			Metadata:         metadata,
+			EPMHistory:       history,
+			ACL:              acl,
 		}
 
 		peers[peerID] = tp
@@ -253,7 +308,7 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 
 	// Load groups
 	groupRows, err := sp.db.Query(`
-		SELECT name, description, default_trust_level, members, created_at, metadata
+		SELECT name, description, default_trust_level, members, created_at, metadata, acl
 		FROM peer_groups
 	`)
 	if err != nil {
@@ -269,9 +324,10 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 			membersJSON string
 			createdAt   time.Time
 			metadataJSON string
+			aclJSON     sql.NullString
 		)
 
-		err := groupRows.Scan(&name, &description, &trustLevel, &membersJSON, &createdAt, &metadataJSON)
+		err := groupRows.Scan(&name, &description, &trustLevel, &membersJSON, &createdAt, &metadataJSON, &aclJSON)
 		if err != nil {
 			continue
 		}
@@ -282,6 +338,11 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 		var metadata map[string]string
 		json.Unmarshal([]byte(metadataJSON), &metadata)
 
+		var acl []ACLRule
+		if aclJSON.Valid {
+			json.Unmarshal([]byte(aclJSON.String), &acl)
+		}
+
 		g := &PeerGroup{
 			Name:              name,
 			Description:       description.String,
@@ -289,6 +350,7 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 			Members:           stringsToPeerIDs(memberStrs),
 			CreatedAt:         createdAt,
 			Metadata:          metadata,
+			ACL:               acl,
 		}
 
 		groups[name] = g
@@ -297,6 +359,70 @@ func (sp *SQLitePersistence) Load() (map[peer.ID]*TrustedPeer, map[string]*PeerG
 	return peers, groups, nil
 }
 
+// SaveEndorsements replaces the stored trust endorsements.
+func (sp *SQLitePersistence) SaveEndorsements(endorsements []*Endorsement) error {
+	tx, err := sp.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM trust_endorsements`); err != nil {
+		return err
+	}
+	for _, e := range endorsements {
+		_, err := tx.Exec(`
+			INSERT INTO trust_endorsements (
+				endorser, subject, level, issued_at, expires_at, revoked, signature
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
+		`,
+			e.Endorser.String(),
+			e.Subject.String(),
+			int(e.Level),
+			e.IssuedAt.UTC(),
+			e.ExpiresAt.UTC(),
+			e.Revoked,
+			e.Signature,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadEndorsements loads the stored trust endorsements.
+func (sp *SQLitePersistence) LoadEndorsements() ([]*Endorsement, error) {
+	rows, err := sp.db.Query(`
+		SELECT endorser, subject, level, issued_at, expires_at, revoked, signature
+		FROM trust_endorsements
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endorsements []*Endorsement
+	for rows.Next() {
+		var endorser, subject string
+		var level int
+		e := &Endorsement{}
+		if err := rows.Scan(&endorser, &subject, &level, &e.IssuedAt, &e.ExpiresAt, &e.Revoked, &e.Signature); err != nil {
+			return nil, err
+		}
+		if e.Endorser, err = peer.Decode(endorser); err != nil {
+			continue
+		}
+		if e.Subject, err = peer.Decode(subject); err != nil {
+			continue
+		}
+		e.Level = TrustLevel(level)
+		endorsements = append(endorsements, e)
+	}
+	return endorsements, rows.Err()
+}
+
 // Close closes the database connection.
 func (sp *SQLitePersistence) Close() error {
 	return sp.db.Close()
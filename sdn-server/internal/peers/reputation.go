@@ -0,0 +1,393 @@
+package peers
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Offense is a kind of peer misbehaviour scored by the reputation engine.
+type Offense string
+
+const (
+	// OffenseValidationFailure is a record that failed schema validation
+	OffenseValidationFailure Offense = "validation_failure"
+	// OffenseRateLimited is a message or stream refused by the rate limiter
+	OffenseRateLimited Offense = "rate_limited"
+	// OffenseMalformedFrame is an exchange frame or PubSub message that could not be parsed
+	OffenseMalformedFrame Offense = "malformed_frame"
+	// OffenseDuplicateRecord is a pushed record the node already holds
+	OffenseDuplicateRecord Offense = "duplicate_record"
+	// OffenseStaleRecord is a published record whose epoch is too old to be live data
+	OffenseStaleRecord Offense = "stale_record"
+)
+
+// Registry metadata keys used to persist automatic demotions.
+const (
+	metaDemotedFrom  = "reputation.demoted_from"
+	metaDemotedUntil = "reputation.demoted_until"
+	metaAddedBy      = "reputation.added"
+)
+
+// ReputationConfig controls scoring, decay and the automatic actions taken
+// against misbehaving peers.
+type ReputationConfig struct {
+	// HalfLife is how long it takes a peer's score to halve
+	HalfLife time.Duration
+
+	// DemoteScore is the score at which a peer is demoted to Limited
+	DemoteScore float64
+
+	// DemoteDuration is the minimum time a demotion lasts
+	DemoteDuration time.Duration
+
+	// BlockScore is the score at which a peer is disconnected and blocked
+	BlockScore float64
+
+	// BlockDuration is how long an automatic block lasts
+	BlockDuration time.Duration
+
+	// Penalties are the points each offense adds to the score
+	Penalties map[Offense]float64
+}
+
+// DefaultReputationConfig returns the default thresholds and penalties.
+func DefaultReputationConfig() ReputationConfig {
+	return ReputationConfig{
+		HalfLife:       time.Hour,
+		DemoteScore:    50,
+		DemoteDuration: time.Hour,
+		BlockScore:     100,
+		BlockDuration:  15 * time.Minute,
+		Penalties: map[Offense]float64{
+			OffenseValidationFailure: 10,
+			OffenseRateLimited:       2,
+			OffenseMalformedFrame:    15,
+			OffenseDuplicateRecord:   1,
+			OffenseStaleRecord:       2,
+		},
+	}
+}
+
+// PeerReputation is the reputation of one peer as reported in its stats.
+type PeerReputation struct {
+	Score        float64           `json:"score"`
+	Offenses     map[Offense]int64 `json:"offenses,omitempty"`
+	LastOffense  time.Time         `json:"last_offense,omitempty"`
+	DemotedUntil time.Time         `json:"demoted_until,omitempty"`
+	BlockedUntil time.Time         `json:"blocked_until,omitempty"`
+}
+
+type reputationEntry struct {
+	score        float64
+	updated      time.Time
+	offenses     map[Offense]int64
+	lastOffense  time.Time
+	blockedUntil time.Time
+}
+
+// Reputation scores peers from offenses reported by the protocol handlers
+// and demotes or temporarily blocks those whose score crosses the configured
+// thresholds. Scores decay exponentially. Trusted and Admin peers are scored
+// but never acted on automatically.
+type Reputation struct {
+	cfg        ReputationConfig
+	registry   *Registry
+	gater      *TrustedConnectionGater
+	disconnect func(peer.ID)
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[peer.ID]*reputationEntry
+}
+
+// NewReputation creates a reputation engine. Zero fields in cfg take their
+// defaults.
+func NewReputation(registry *Registry, gater *TrustedConnectionGater, cfg ReputationConfig) *Reputation {
+	def := DefaultReputationConfig()
+	if cfg.HalfLife <= 0 {
+		cfg.HalfLife = def.HalfLife
+	}
+	if cfg.DemoteScore <= 0 {
+		cfg.DemoteScore = def.DemoteScore
+	}
+	if cfg.DemoteDuration <= 0 {
+		cfg.DemoteDuration = def.DemoteDuration
+	}
+	if cfg.BlockScore <= 0 {
+		cfg.BlockScore = def.BlockScore
+	}
+	if cfg.BlockDuration <= 0 {
+		cfg.BlockDuration = def.BlockDuration
+	}
+	penalties := make(map[Offense]float64, len(def.Penalties))
+	for o, p := range def.Penalties {
+		penalties[o] = p
+	}
+	for o, p := range cfg.Penalties {
+		penalties[o] = p
+	}
+	cfg.Penalties = penalties
+
+	return &Reputation{
+		cfg:      cfg,
+		registry: registry,
+		gater:    gater,
+		now:      time.Now,
+		entries:  make(map[peer.ID]*reputationEntry),
+	}
+}
+
+// SetDisconnectFunc sets the function used to drop connections to a peer
+// when it is blocked.
+func (r *Reputation) SetDisconnectFunc(fn func(peer.ID)) {
+	r.disconnect = fn
+}
+
+// Report records an offense by a peer and applies any resulting demotion or
+// block.
+func (r *Reputation) Report(id peer.ID, offense Offense) {
+	now := r.now()
+
+	r.mu.Lock()
+	e, ok := r.entries[id]
+	if !ok {
+		e = &reputationEntry{updated: now, offenses: make(map[Offense]int64)}
+		r.entries[id] = e
+	}
+	r.decay(e, now)
+	e.score += r.cfg.Penalties[offense]
+	e.offenses[offense]++
+	e.lastOffense = now
+	score := e.score
+	block := score >= r.cfg.BlockScore && now.After(e.blockedUntil)
+	r.mu.Unlock()
+
+	if r.registry.GetTrustLevel(id) >= Trusted {
+		return
+	}
+	if score >= r.cfg.DemoteScore {
+		r.demote(id, now)
+	}
+	if block {
+		r.block(id, now)
+	}
+}
+
+// Get returns a peer's current reputation.
+func (r *Reputation) Get(id peer.ID) PeerReputation {
+	now := r.now()
+	rep := PeerReputation{}
+
+	r.mu.Lock()
+	if e, ok := r.entries[id]; ok {
+		r.decay(e, now)
+		rep.Score = math.Round(e.score*100) / 100
+		rep.Offenses = make(map[Offense]int64, len(e.offenses))
+		for o, n := range e.offenses {
+			rep.Offenses[o] = n
+		}
+		rep.LastOffense = e.lastOffense
+		if now.Before(e.blockedUntil) {
+			rep.BlockedUntil = e.blockedUntil
+		}
+	}
+	r.mu.Unlock()
+
+	if tp, err := r.registry.GetPeer(id); err == nil {
+		r.registry.mu.RLock()
+		until, _ := time.Parse(time.RFC3339, tp.Metadata[metaDemotedUntil])
+		r.registry.mu.RUnlock()
+		rep.DemotedUntil = until
+	}
+	return rep
+}
+
+// Sweep lifts expired blocks, restores demoted peers whose score has decayed
+// below the demotion threshold, and forgets peers with no remaining score.
+func (r *Reputation) Sweep() {
+	now := r.now()
+
+	var unblock []peer.ID
+	r.mu.Lock()
+	for id, e := range r.entries {
+		r.decay(e, now)
+		if !e.blockedUntil.IsZero() && !now.Before(e.blockedUntil) {
+			unblock = append(unblock, id)
+			e.blockedUntil = time.Time{}
+		}
+		if e.score < 0.01 && e.blockedUntil.IsZero() {
+			delete(r.entries, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, id := range unblock {
+		if r.gater.AutoUnblock(id) {
+			log.Infof("Reputation block expired for peer %s", id.ShortString())
+		}
+	}
+
+	for _, id := range r.demotedPeers() {
+		r.restore(id, now)
+	}
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (r *Reputation) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Sweep()
+		}
+	}
+}
+
+// decay applies exponential decay to e up to now. Callers hold r.mu.
+func (r *Reputation) decay(e *reputationEntry, now time.Time) {
+	elapsed := now.Sub(e.updated)
+	if elapsed > 0 {
+		e.score *= math.Pow(0.5, float64(elapsed)/float64(r.cfg.HalfLife))
+		e.updated = now
+	}
+}
+
+func (r *Reputation) score(id peer.ID, now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[id]
+	if !ok {
+		return 0
+	}
+	r.decay(e, now)
+	return e.score
+}
+
+// demote lowers a peer to Limited, or extends an existing demotion. Unknown
+// peers are added to the registry so the demotion sticks.
+func (r *Reputation) demote(id peer.ID, now time.Time) {
+	until := now.Add(r.cfg.DemoteDuration).UTC().Format(time.RFC3339)
+
+	if _, err := r.registry.GetPeer(id); err == ErrPeerNotFound {
+		from := r.registry.GetTrustLevel(id)
+		if from <= Limited {
+			return
+		}
+		err := r.registry.AddPeer(&TrustedPeer{
+			ID:         id,
+			TrustLevel: Limited,
+			Notes:      "Demoted automatically for misbehaviour",
+			Metadata: map[string]string{
+				metaDemotedFrom:  from.String(),
+				metaDemotedUntil: until,
+				metaAddedBy:      "true",
+			},
+		})
+		if err == nil {
+			log.Warnf("Demoted peer %s to limited (reputation)", id.ShortString())
+		}
+		return
+	}
+
+	effective := r.registry.GetTrustLevel(id)
+	r.registry.UpdateStats(id, func(tp *TrustedPeer) {
+		// An entry that only holds the peer's EPM is demoted from the
+		// peer's effective level, as an unknown peer is, and becomes an
+		// EPM-only entry again when the demotion ends.
+		epmOnly := !tp.hasManualTrust()
+		if tp.TrustLevel >= Trusted && !epmOnly {
+			return
+		}
+		if tp.Metadata == nil {
+			tp.Metadata = make(map[string]string)
+		}
+		if _, demoted := tp.Metadata[metaDemotedFrom]; !demoted {
+			level := tp.TrustLevel
+			if epmOnly {
+				level = effective
+			}
+			if level <= Limited {
+				return
+			}
+			tp.Metadata[metaDemotedFrom] = tp.TrustLevel.String()
+			if epmOnly {
+				delete(tp.Metadata, metaEPMOnly)
+				tp.Metadata[metaAddedBy] = "epm"
+			}
+			tp.TrustLevel = Limited
+			log.Warnf("Demoted peer %s to limited (reputation)", id.ShortString())
+		}
+		tp.Metadata[metaDemotedUntil] = until
+	})
+}
+
+// demotedPeers lists the registry peers under an automatic demotion.
+func (r *Reputation) demotedPeers() []peer.ID {
+	r.registry.mu.RLock()
+	defer r.registry.mu.RUnlock()
+	var ids []peer.ID
+	for id, tp := range r.registry.peers {
+		if _, ok := tp.Metadata[metaDemotedFrom]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// restore lifts an expired demotion once the peer's score has decayed below
+// the demotion threshold.
+func (r *Reputation) restore(id peer.ID, now time.Time) {
+	score := r.score(id, now)
+	remove := false
+	r.registry.UpdateStats(id, func(tp *TrustedPeer) {
+		from, demoted := tp.Metadata[metaDemotedFrom]
+		if !demoted {
+			return
+		}
+		until, _ := time.Parse(time.RFC3339, tp.Metadata[metaDemotedUntil])
+		if now.Before(until) || score >= r.cfg.DemoteScore {
+			return
+		}
+		if level, err := ParseTrustLevel(from); err == nil && tp.TrustLevel == Limited {
+			tp.TrustLevel = level
+		}
+		switch tp.Metadata[metaAddedBy] {
+		case "true":
+			remove = true
+		case "epm":
+			tp.Metadata[metaEPMOnly] = "true"
+		}
+		delete(tp.Metadata, metaDemotedFrom)
+		delete(tp.Metadata, metaDemotedUntil)
+		delete(tp.Metadata, metaAddedBy)
+		log.Infof("Restored peer %s to %s (reputation)", id.ShortString(), tp.TrustLevel)
+	})
+	if remove {
+		r.registry.RemovePeer(id)
+	}
+}
+
+// block blocks and disconnects a peer for BlockDuration, unless it is
+// already blocked by an operator.
+func (r *Reputation) block(id peer.ID, now time.Time) {
+	if r.gater == nil || !r.gater.AutoBlock(id) {
+		return
+	}
+	r.mu.Lock()
+	if e, ok := r.entries[id]; ok {
+		e.blockedUntil = now.Add(r.cfg.BlockDuration)
+	}
+	r.mu.Unlock()
+
+	if r.disconnect != nil {
+		r.disconnect(id)
+	}
+	log.Warnf("Blocked peer %s for %s (reputation)", id.ShortString(), r.cfg.BlockDuration)
+}
@@ -0,0 +1,146 @@
+package peers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestReputation(t *testing.T) (*Reputation, *Registry, *TrustedConnectionGater, *time.Time) {
+	t.Helper()
+	registry := NewRegistry(false, nil)
+	gater := NewTrustedConnectionGater(registry)
+	rep := NewReputation(registry, gater, ReputationConfig{})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rep.now = func() time.Time { return now }
+	return rep, registry, gater, &now
+}
+
+func TestReputation_Decay(t *testing.T) {
+	rep, _, _, now := newTestReputation(t)
+
+	rep.Report(testPeerID1, OffenseValidationFailure)
+	rep.Report(testPeerID1, OffenseValidationFailure)
+	if got := rep.Get(testPeerID1); got.Score != 20 || got.Offenses[OffenseValidationFailure] != 2 {
+		t.Fatalf("Expected score 20 after two failures, got %+v", got)
+	}
+
+	*now = now.Add(time.Hour)
+	if got := rep.Get(testPeerID1).Score; math.Abs(got-10) > 0.01 {
+		t.Errorf("Score should halve after one half-life, got %.2f", got)
+	}
+}
+
+func TestReputation_DemoteAndRestore(t *testing.T) {
+	rep, registry, gater, now := newTestReputation(t)
+	registry.AddPeer(&TrustedPeer{ID: testPeerID1, TrustLevel: Standard})
+
+	for i := 0; i < 5; i++ {
+		rep.Report(testPeerID1, OffenseValidationFailure)
+	}
+	if level := registry.GetTrustLevel(testPeerID1); level != Limited {
+		t.Fatalf("Expected demotion to limited, got %s", level)
+	}
+	if gater.IsBlocked(testPeerID1) {
+		t.Error("Peer below the block score should not be blocked")
+	}
+	if d := registry.Authorize(testPeerID1, ACLPublish, "OMM.fbs"); d.Allowed {
+		t.Error("Demoted peer should not be allowed to publish")
+	}
+	if rep.Get(testPeerID1).DemotedUntil.IsZero() {
+		t.Error("Stats should report when the demotion ends")
+	}
+
+	// The demotion outlasts its duration until the score has decayed.
+	*now = now.Add(30 * time.Minute)
+	rep.Sweep()
+	if level := registry.GetTrustLevel(testPeerID1); level != Limited {
+		t.Errorf("Demotion lifted early, got %s", level)
+	}
+
+	*now = now.Add(90 * time.Minute)
+	rep.Sweep()
+	if level := registry.GetTrustLevel(testPeerID1); level != Standard {
+		t.Errorf("Expected restore to standard, got %s", level)
+	}
+	tp, _ := registry.GetPeer(testPeerID1)
+	if _, ok := tp.Metadata[metaDemotedFrom]; ok {
+		t.Error("Restore should clear demotion metadata")
+	}
+}
+
+func TestReputation_UnknownPeerRemovedOnRestore(t *testing.T) {
+	rep, registry, _, now := newTestReputation(t)
+
+	for i := 0; i < 4; i++ {
+		rep.Report(testPeerID2, OffenseMalformedFrame)
+	}
+	if level := registry.GetTrustLevel(testPeerID2); level != Limited {
+		t.Fatalf("Unknown peer should be demoted to limited, got %s", level)
+	}
+
+	*now = now.Add(3 * time.Hour)
+	rep.Sweep()
+	if _, err := registry.GetPeer(testPeerID2); err != ErrPeerNotFound {
+		t.Errorf("Peer added by a demotion should be removed on restore, got %v", err)
+	}
+}
+
+func TestReputation_BlockAndExpire(t *testing.T) {
+	rep, _, gater, now := newTestReputation(t)
+	var disconnected []peer.ID
+	rep.SetDisconnectFunc(func(id peer.ID) { disconnected = append(disconnected, id) })
+
+	for i := 0; i < 7; i++ {
+		rep.Report(testPeerID3, OffenseMalformedFrame)
+	}
+	if !gater.IsBlocked(testPeerID3) {
+		t.Fatal("Peer over the block score should be blocked")
+	}
+	if len(disconnected) != 1 || disconnected[0] != testPeerID3 {
+		t.Errorf("Expected one disconnect, got %v", disconnected)
+	}
+	if rep.Get(testPeerID3).BlockedUntil.IsZero() {
+		t.Error("Stats should report when the block ends")
+	}
+
+	*now = now.Add(16 * time.Minute)
+	rep.Sweep()
+	if gater.IsBlocked(testPeerID3) {
+		t.Error("Block should expire after the block duration")
+	}
+
+	// An operator block placed during the automatic block outlives it.
+	for i := 0; i < 7; i++ {
+		rep.Report(testPeerID3, OffenseMalformedFrame)
+	}
+	if !gater.IsBlocked(testPeerID3) {
+		t.Fatal("Peer over the block score should be blocked again")
+	}
+	gater.Block(testPeerID3)
+	*now = now.Add(16 * time.Minute)
+	rep.Sweep()
+	if !gater.IsBlocked(testPeerID3) {
+		t.Error("Expiring automatic block lifted the operator's block")
+	}
+}
+
+func TestReputation_TrustedPeersExempt(t *testing.T) {
+	rep, registry, gater, _ := newTestReputation(t)
+	registry.AddPeer(&TrustedPeer{ID: testPeerID1, TrustLevel: Trusted})
+
+	for i := 0; i < 20; i++ {
+		rep.Report(testPeerID1, OffenseMalformedFrame)
+	}
+	if level := registry.GetTrustLevel(testPeerID1); level != Trusted {
+		t.Errorf("Trusted peer should not be demoted, got %s", level)
+	}
+	if gater.IsBlocked(testPeerID1) {
+		t.Error("Trusted peer should not be blocked")
+	}
+	if rep.Get(testPeerID1).Score == 0 {
+		t.Error("Trusted peer should still be scored")
+	}
+}
@@ -138,6 +138,13 @@ type TrustedPeer struct {
 	// VCardData is the optional vCard representation
 	VCardData string `json:"vcard_data,omitempty"`
 
+	// EPMHistory holds the verified EPM versions received for this peer,
+	// newest first; the first entry is the one in EPMData.
+	EPMHistory []EPMVersion `json:"epm_history,omitempty"`
+
+	// ACL are the schema access rules attached to this peer
+	ACL []ACLRule `json:"acl,omitempty"`
+
 	// Metadata is additional custom metadata
 	Metadata map[string]string `json:"metadata,omitempty"`
 }
@@ -198,6 +205,36 @@ func (tp *TrustedPeer) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MaxEPMHistory is the number of EPM versions kept per peer.
+const MaxEPMHistory = 10
+
+// metaEPMOnly marks a registry entry that SetPeerEPM created to hold a
+// peer's EPM. Its TrustLevel is not a manual trust level: the peer keeps
+// the trust it would have if it were unknown, including derived trust,
+// until an operator sets one.
+const metaEPMOnly = "epm.only"
+
+// hasManualTrust reports whether the entry's TrustLevel was set by an
+// operator rather than by SetPeerEPM.
+func (tp *TrustedPeer) hasManualTrust() bool {
+	return tp.Metadata[metaEPMOnly] != "true"
+}
+
+// EPMVersion is one verified EPM received for a peer.
+type EPMVersion struct {
+	// CID is the content identifier the peer announced for the EPM
+	CID string `json:"cid"`
+
+	// Data is the size-prefixed EPM FlatBuffer
+	Data []byte `json:"data"`
+
+	// ReceivedAt is when the EPM was fetched and verified
+	ReceivedAt time.Time `json:"received_at"`
+
+	// Source is how the EPM was fetched ("stream" or "ipfs")
+	Source string `json:"source,omitempty"`
+}
+
 // PeerGroup represents a group of peers for organization.
 type PeerGroup struct {
 	// Name is the unique name of the group
@@ -215,6 +252,9 @@ type PeerGroup struct {
 	// MembersStrings is used for JSON serialization
 	MembersStrings []string `json:"members,omitempty"`
 
+	// ACL are the schema access rules applied to every member
+	ACL []ACLRule `json:"acl,omitempty"`
+
 	// CreatedAt is when this group was created
 	CreatedAt time.Time `json:"created_at"`
 
@@ -268,19 +308,20 @@ func (pg *PeerGroup) UnmarshalJSON(data []byte) error {
 
 // ConnectionStats represents connection statistics for a peer.
 type ConnectionStats struct {
-	PeerID           peer.ID       `json:"peer_id"`
-	Connected        bool          `json:"connected"`
-	LastConnected    time.Time     `json:"last_connected,omitempty"`
-	LastDisconnected time.Time     `json:"last_disconnected,omitempty"`
-	ConnectionCount  int64         `json:"connection_count"`
-	TotalUptime      time.Duration `json:"total_uptime"`
-	CurrentUptime    time.Duration `json:"current_uptime,omitempty"`
-	Latency          time.Duration `json:"latency,omitempty"`
-	MessagesReceived int64         `json:"messages_received"`
-	MessagesSent     int64         `json:"messages_sent"`
-	BytesReceived    int64         `json:"bytes_received"`
-	BytesSent        int64         `json:"bytes_sent"`
-	RateLimited      bool          `json:"rate_limited"`
+	PeerID           peer.ID         `json:"peer_id"`
+	Connected        bool            `json:"connected"`
+	LastConnected    time.Time       `json:"last_connected,omitempty"`
+	LastDisconnected time.Time       `json:"last_disconnected,omitempty"`
+	ConnectionCount  int64           `json:"connection_count"`
+	TotalUptime      time.Duration   `json:"total_uptime"`
+	CurrentUptime    time.Duration   `json:"current_uptime,omitempty"`
+	Latency          time.Duration   `json:"latency,omitempty"`
+	MessagesReceived int64           `json:"messages_received"`
+	MessagesSent     int64           `json:"messages_sent"`
+	BytesReceived    int64           `json:"bytes_received"`
+	BytesSent        int64           `json:"bytes_sent"`
+	RateLimited      bool            `json:"rate_limited"`
+	Reputation       *PeerReputation `json:"reputation,omitempty"`
 }
 
 // Registry manages the trusted peer registry.
@@ -290,6 +331,28 @@ type Registry struct {
 	groups      map[string]*PeerGroup
 	strictMode  bool // Only connect to peers in registry
 	persistence PersistenceProvider
+	derived     map[peer.ID]DerivedTrust // Trust derived from endorsements
+
+	// onTrustChange is called after a manual trust level changes, outside
+	// mu. The web of trust uses it to recompute derived trust.
+	hookMu        sync.RWMutex
+	onTrustChange func()
+}
+
+// setTrustChangeHook sets the function called after manual trust changes.
+func (r *Registry) setTrustChangeHook(fn func()) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+	r.onTrustChange = fn
+}
+
+func (r *Registry) trustChanged() {
+	r.hookMu.RLock()
+	fn := r.onTrustChange
+	r.hookMu.RUnlock()
+	if fn != nil {
+		fn()
+	}
 }
 
 // PersistenceProvider is an interface for persisting the registry.
@@ -330,21 +393,37 @@ var (
 )
 
 // AddPeer adds a peer to the registry.
-func (r *Registry) AddPeer(tp *TrustedPeer) error {
+func (r *Registry) AddPeer(tp *TrustedPeer) (err error) {
 	if tp.ID == "" {
 		return ErrInvalidPeerID
 	}
 
+	defer func() {
+		if err == nil {
+			r.trustChanged()
+		}
+	}()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.peers[tp.ID]; exists {
+	existing, exists := r.peers[tp.ID]
+	if exists && existing.hasManualTrust() {
 		return ErrPeerAlreadyExists
 	}
 
 	if tp.AddedAt.IsZero() {
 		tp.AddedAt = time.Now()
 	}
+	if exists {
+		// Adding a peer whose entry only held its EPM keeps the EPM.
+		if len(tp.EPMData) == 0 {
+			tp.EPMData, tp.VCardData = existing.EPMData, existing.VCardData
+		}
+		if len(tp.EPMHistory) == 0 {
+			tp.EPMHistory = existing.EPMHistory
+		}
+		delete(tp.Metadata, metaEPMOnly)
+	}
 
 	r.peers[tp.ID] = tp
 	r.save()
@@ -352,11 +431,16 @@ func (r *Registry) AddPeer(tp *TrustedPeer) error {
 }
 
 // UpdatePeer updates an existing peer in the registry.
-func (r *Registry) UpdatePeer(tp *TrustedPeer) error {
+func (r *Registry) UpdatePeer(tp *TrustedPeer) (err error) {
 	if tp.ID == "" {
 		return ErrInvalidPeerID
 	}
 
+	defer func() {
+		if err == nil {
+			r.trustChanged()
+		}
+	}()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -369,8 +453,56 @@ func (r *Registry) UpdatePeer(tp *TrustedPeer) error {
 	return nil
 }
 
+// SetPeerEPM makes a verified EPM the peer's current one and records it in
+// the peer's history. An unknown peer is added without a manual trust level,
+// so it keeps the default or derived trust of an unknown peer. It reports
+// false if the CID is already the current EPM.
+func (r *Registry) SetPeerEPM(id peer.ID, version EPMVersion, vcardData string) (bool, error) {
+	if id == "" {
+		return false, ErrInvalidPeerID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tp, exists := r.peers[id]
+	if !exists {
+		level := Standard
+		if r.strictMode {
+			level = Untrusted
+		}
+		tp = &TrustedPeer{
+			ID:         id,
+			TrustLevel: level,
+			AddedAt:    time.Now(),
+			Metadata:   map[string]string{metaEPMOnly: "true"},
+		}
+		r.peers[id] = tp
+	}
+	if len(tp.EPMHistory) > 0 && tp.EPMHistory[0].CID == version.CID {
+		return false, nil
+	}
+
+	if version.ReceivedAt.IsZero() {
+		version.ReceivedAt = time.Now()
+	}
+	tp.EPMData = version.Data
+	tp.VCardData = vcardData
+	tp.EPMHistory = append([]EPMVersion{version}, tp.EPMHistory...)
+	if len(tp.EPMHistory) > MaxEPMHistory {
+		tp.EPMHistory = tp.EPMHistory[:MaxEPMHistory]
+	}
+	r.save()
+	return true, nil
+}
+
 // RemovePeer removes a peer from the registry.
-func (r *Registry) RemovePeer(id peer.ID) error {
+func (r *Registry) RemovePeer(id peer.ID) (err error) {
+	defer func() {
+		if err == nil {
+			r.trustChanged()
+		}
+	}()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -445,7 +577,12 @@ func (r *Registry) ListPeersByGroup(groupName string) []*TrustedPeer {
 }
 
 // SetTrustLevel updates the trust level for a peer.
-func (r *Registry) SetTrustLevel(id peer.ID, level TrustLevel) error {
+func (r *Registry) SetTrustLevel(id peer.ID, level TrustLevel) (err error) {
+	defer func() {
+		if err == nil {
+			r.trustChanged()
+		}
+	}()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -455,17 +592,23 @@ func (r *Registry) SetTrustLevel(id peer.ID, level TrustLevel) error {
 	}
 
 	tp.TrustLevel = level
+	delete(tp.Metadata, metaEPMOnly)
 	r.save()
 	return nil
 }
 
-// GetTrustLevel returns the trust level for a peer.
+// GetTrustLevel returns the trust level for a peer. Peers without a manual
+// trust level get their derived trust, if any.
 func (r *Registry) GetTrustLevel(id peer.ID) TrustLevel {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	tp, exists := r.peers[id]
-	if !exists {
+	if !exists || !tp.hasManualTrust() {
+		// Manual trust always wins; endorsements only place unknown peers.
+		if dt, ok := r.derived[id]; ok {
+			return dt.Level
+		}
 		if r.strictMode {
 			return Untrusted
 		}
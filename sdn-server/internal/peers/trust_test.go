@@ -2,6 +2,8 @@ package peers
 
 import (
 	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -438,3 +440,69 @@ func TestRegistry_GetTrustedAddrInfos(t *testing.T) {
 		t.Errorf("Expected 0 AddrInfos (no addresses), got %d", len(infos))
 	}
 }
+
+func TestRegistry_SetPeerEPM(t *testing.T) {
+	persistence, err := NewSQLitePersistence(filepath.Join(t.TempDir(), "peers.db"))
+	if err != nil {
+		t.Fatalf("Failed to open persistence: %v", err)
+	}
+	defer persistence.Close()
+
+	// Unknown peers are added at the strict-mode default.
+	registry := NewRegistry(true, persistence)
+	changed, err := registry.SetPeerEPM(testPeerID1, EPMVersion{CID: "cid-0", Data: []byte("epm-0")}, "vcard-0")
+	if err != nil || !changed {
+		t.Fatalf("SetPeerEPM = %v, %v", changed, err)
+	}
+	if got := registry.GetTrustLevel(testPeerID1); got != Untrusted {
+		t.Errorf("Auto-added peer trust = %v, want %v", got, Untrusted)
+	}
+	if changed, _ := registry.SetPeerEPM(testPeerID1, EPMVersion{CID: "cid-0", Data: []byte("epm-0")}, "vcard-0"); changed {
+		t.Error("Re-storing the current CID should be a no-op")
+	}
+
+	for i := 1; i <= MaxEPMHistory+2; i++ {
+		registry.SetPeerEPM(testPeerID1, EPMVersion{
+			CID:  fmt.Sprintf("cid-%d", i),
+			Data: []byte(fmt.Sprintf("epm-%d", i)),
+		}, "")
+	}
+
+	// History survives a reload, newest first and bounded.
+	reloaded := NewRegistry(true, persistence)
+	tp, err := reloaded.GetPeer(testPeerID1)
+	if err != nil {
+		t.Fatalf("GetPeer after reload: %v", err)
+	}
+	if len(tp.EPMHistory) != MaxEPMHistory {
+		t.Fatalf("History length = %d, want %d", len(tp.EPMHistory), MaxEPMHistory)
+	}
+	latest := fmt.Sprintf("cid-%d", MaxEPMHistory+2)
+	if tp.EPMHistory[0].CID != latest || string(tp.EPMData) != fmt.Sprintf("epm-%d", MaxEPMHistory+2) {
+		t.Errorf("Current EPM = %s / %q, want %s", tp.EPMHistory[0].CID, tp.EPMData, latest)
+	}
+	if tp.EPMHistory[0].ReceivedAt.IsZero() {
+		t.Error("ReceivedAt should default to now")
+	}
+
+	// Storing an EPM does not give the peer a manual trust level, so
+	// derived trust still applies after a reload.
+	reloaded.SetDerivedTrust(map[peer.ID]DerivedTrust{testPeerID1: {Level: Trusted, Depth: 1}})
+	if got := reloaded.GetTrustLevel(testPeerID1); got != Trusted {
+		t.Errorf("Trust with an EPM-only entry = %v, want derived %v", got, Trusted)
+	}
+
+	// Adding the peer gives it a manual level and keeps its EPM.
+	if err := reloaded.AddPeer(&TrustedPeer{ID: testPeerID1, TrustLevel: Limited}); err != nil {
+		t.Fatalf("AddPeer over an EPM-only entry: %v", err)
+	}
+	if got := reloaded.GetTrustLevel(testPeerID1); got != Limited {
+		t.Errorf("Trust after AddPeer = %v, want %v", got, Limited)
+	}
+	if tp, _ := reloaded.GetPeer(testPeerID1); len(tp.EPMHistory) != MaxEPMHistory {
+		t.Errorf("AddPeer dropped the EPM history: %d versions", len(tp.EPMHistory))
+	}
+	if err := reloaded.AddPeer(&TrustedPeer{ID: testPeerID1, TrustLevel: Trusted}); err != ErrPeerAlreadyExists {
+		t.Errorf("AddPeer over a manual entry = %v, want %v", err, ErrPeerAlreadyExists)
+	}
+}
@@ -59,6 +59,9 @@ type PeerRateLimiter struct {
 	cleanupInterval time.Duration
 	maxIdleTime     time.Duration
 	stopCleanup     chan struct{}
+
+	// onLimited is called (outside the lock) when a peer is rate limited.
+	onLimited func(peer.ID)
 }
 
 // NewPeerRateLimiter creates a new rate limiter for tracking per-peer message rates.
@@ -77,9 +80,24 @@ func NewPeerRateLimiter(config RateLimitConfig) *PeerRateLimiter {
 	return prl
 }
 
+// SetLimitedCallback sets a function called whenever a peer is rate limited.
+func (prl *PeerRateLimiter) SetLimitedCallback(fn func(peer.ID)) {
+	prl.mu.Lock()
+	defer prl.mu.Unlock()
+	prl.onLimited = fn
+}
+
 // Allow checks if a message from the given peer should be allowed.
 // Returns true if the message is allowed, false if rate limited.
 func (prl *PeerRateLimiter) Allow(peerID peer.ID) bool {
+	allowed, onLimited := prl.allow(peerID)
+	if !allowed && onLimited != nil {
+		onLimited(peerID)
+	}
+	return allowed
+}
+
+func (prl *PeerRateLimiter) allow(peerID peer.ID) (bool, func(peer.ID)) {
 	prl.mu.Lock()
 	defer prl.mu.Unlock()
 
@@ -90,7 +108,8 @@ func (prl *PeerRateLimiter) Allow(peerID peer.ID) bool {
 		// Reject new peers if the map is at capacity to prevent OOM.
 		if len(prl.limiters) >= maxTrackedPeers {
 			log.Warnf("Rate limiter map at capacity (%d peers), rejecting new peer %s", maxTrackedPeers, peerID.ShortString())
-			return false
+			// Capacity is not the peer's fault, so it is not reported.
+			return false, nil
 		}
 		// Create new limiter for this peer
 		pl = &peerLimiter{
@@ -107,7 +126,7 @@ func (prl *PeerRateLimiter) Allow(peerID peer.ID) bool {
 	// Check per-second rate limit using token bucket
 	if !pl.limiter.Allow() {
 		log.Debugf("Rate limit exceeded (per-second) for peer %s", peerID.ShortString())
-		return false
+		return false, prl.onLimited
 	}
 
 	// Check per-minute rate limit using sliding window
@@ -121,10 +140,10 @@ func (prl *PeerRateLimiter) Allow(peerID peer.ID) bool {
 	pl.minuteCount++
 	if pl.minuteCount > prl.config.MaxMessagesPerMinute {
 		log.Debugf("Rate limit exceeded (per-minute) for peer %s: %d/%d", peerID.ShortString(), pl.minuteCount, prl.config.MaxMessagesPerMinute)
-		return false
+		return false, prl.onLimited
 	}
 
-	return true
+	return true, nil
 }
 
 // GetPeerStats returns rate limiting statistics for a peer.
@@ -13,6 +13,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	"github.com/spacedatanetwork/sdn-server/internal/peers"
 	"github.com/spacedatanetwork/sdn-server/internal/sds"
 	"github.com/spacedatanetwork/sdn-server/internal/storage"
 )
@@ -79,6 +80,9 @@ type SDSExchangeHandler struct {
 	validator   *sds.Validator
 	limits      MessageLimits
 	rateLimiter *PeerRateLimiter
+	acl         *peers.Registry
+	reputation  *peers.Reputation
+	staleAfter  time.Duration
 }
 
 // ErrRateLimited is returned when a peer exceeds the rate limit.
@@ -119,6 +123,37 @@ func NewSDSExchangeHandlerWithOptions(store *storage.FlatSQLStore, validator *sd
 	return h
 }
 
+// SetACL enables per-schema ACL checks against the peer registry. Without it
+// every peer that passes the connection gater may publish and query.
+func (h *SDSExchangeHandler) SetACL(registry *peers.Registry) {
+	h.acl = registry
+}
+
+// checkACL returns nil when no ACL is configured or the peer may perform
+// action on the record in data.
+func (h *SDSExchangeHandler) checkACL(id peer.ID, action peers.ACLAction, schema string, data []byte) error {
+	if h.acl == nil {
+		return nil
+	}
+	norad, objectID := storage.RecordObject(schema, data)
+	return h.acl.CheckAccess(id, action, schema, peers.ACLObject{NoradCatID: norad, ObjectID: objectID})
+}
+
+// SetReputation reports peer misbehaviour seen by the handler to r. Published
+// records whose epoch is older than staleAfter are reported as stale; zero
+// disables the check.
+func (h *SDSExchangeHandler) SetReputation(r *peers.Reputation, staleAfter time.Duration) {
+	h.reputation = r
+	h.staleAfter = staleAfter
+}
+
+// report records an offense against a peer when reputation scoring is enabled.
+func (h *SDSExchangeHandler) report(id peer.ID, offense peers.Offense) {
+	if h.reputation != nil {
+		h.reputation.Report(id, offense)
+	}
+}
+
 // HandleStream handles an incoming SDS exchange stream.
 func (h *SDSExchangeHandler) HandleStream(s network.Stream) {
 	defer s.Close()
@@ -158,6 +193,7 @@ func (h *SDSExchangeHandler) HandleStream(s network.Stream) {
 		h.handleQuery(ctx, s)
 	default:
 		log.Warnf("Unknown message type: 0x%02x", msgType[0])
+		h.report(peerID, peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 	}
 }
@@ -174,6 +210,7 @@ func (h *SDSExchangeHandler) handleDataRequest(ctx context.Context, s network.St
 	schemaLen := binary.BigEndian.Uint16(schemaNameLen)
 	if int(schemaLen) > h.limits.MaxSchemaName {
 		log.Warnf("Schema name too long: %d > %d", schemaLen, h.limits.MaxSchemaName)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -188,6 +225,7 @@ func (h *SDSExchangeHandler) handleDataRequest(ctx context.Context, s network.St
 	// Validate schema name to prevent path traversal and injection attacks
 	if err := sds.ValidateSchemaName(string(schemaName)); err != nil {
 		log.Warnf("Invalid schema name from %s: %v", s.Conn().RemotePeer().ShortString(), err)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -214,6 +252,12 @@ func (h *SDSExchangeHandler) handleDataRequest(ctx context.Context, s network.St
 		return
 	}
 
+	if err := h.checkACL(s.Conn().RemotePeer(), peers.ACLQuery, string(schemaName), data); err != nil {
+		log.Debugf("Request for %s/%s from %s rejected: %v", schemaName, cid, s.Conn().RemotePeer().ShortString(), err)
+		s.Write([]byte{RespReject})
+		return
+	}
+
 	// Send response
 	s.Write([]byte{RespAccept})
 
@@ -241,6 +285,7 @@ func (h *SDSExchangeHandler) handleDataPush(ctx context.Context, s network.Strea
 	schemaLen := binary.BigEndian.Uint16(schemaNameLen)
 	if int(schemaLen) > h.limits.MaxSchemaName {
 		log.Warnf("Schema name too long: %d > %d", schemaLen, h.limits.MaxSchemaName)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -256,6 +301,7 @@ func (h *SDSExchangeHandler) handleDataPush(ctx context.Context, s network.Strea
 	// Validate schema name to prevent path traversal and injection attacks
 	if err := sds.ValidateSchemaName(string(schemaName)); err != nil {
 		log.Warnf("Invalid schema name from %s: %v", s.Conn().RemotePeer().ShortString(), err)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -272,6 +318,7 @@ func (h *SDSExchangeHandler) handleDataPush(ctx context.Context, s network.Strea
 	dataLen := binary.BigEndian.Uint32(dataLenBuf)
 	if int(dataLen) > h.limits.MaxMessageSize {
 		log.Warnf("Message too large: %d > %d bytes", dataLen, h.limits.MaxMessageSize)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -287,23 +334,33 @@ func (h *SDSExchangeHandler) handleDataPush(ctx context.Context, s network.Strea
 	// Get peer ID
 	peerID := s.Conn().RemotePeer()
 
+	if err := h.checkACL(peerID, peers.ACLPublish, string(schemaName), data); err != nil {
+		log.Warnf("Push of %s from %s rejected: %v", schemaName, peerID.ShortString(), err)
+		s.Write([]byte{RespReject})
+		return
+	}
+
 	// Validate data against schema with timeout
 	validationCtx, validationCancel := context.WithTimeout(ctx, DefaultValidationTimeout)
 	defer validationCancel()
 
 	if err := h.validator.Validate(validationCtx, string(schemaName), data); err != nil {
 		log.Warnf("Validation failed for %s from %s: %v", schemaName, peerID, err)
+		h.report(peerID, peers.OffenseValidationFailure)
 		s.Write([]byte{RespReject})
 		return
 	}
 
 	// Store data
-	cid, err := h.store.Store(string(schemaName), data, peerID.String(), nil)
+	cid, created, err := h.store.StoreNew(string(schemaName), data, peerID.String(), nil)
 	if err != nil {
 		log.Warnf("Failed to store data: %v", err)
 		s.Write([]byte{RespReject})
 		return
 	}
+	if !created {
+		h.report(peerID, peers.OffenseDuplicateRecord)
+	}
 
 	// Send ACK with CID
 	s.Write([]byte{RespAccept})
@@ -324,6 +381,7 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 	schemaLen := binary.BigEndian.Uint16(schemaNameLen)
 	if int(schemaLen) > h.limits.MaxSchemaName {
 		log.Warnf("Schema name too long: %d > %d", schemaLen, h.limits.MaxSchemaName)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -338,6 +396,7 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 	// Validate schema name to prevent path traversal and injection attacks
 	if err := sds.ValidateSchemaName(string(schemaName)); err != nil {
 		log.Warnf("Invalid schema name from %s: %v", s.Conn().RemotePeer().ShortString(), err)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -353,6 +412,7 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 	queryLen := binary.BigEndian.Uint32(queryLenBuf)
 	if int(queryLen) > h.limits.MaxQuerySize {
 		log.Warnf("Query too large: %d > %d bytes", queryLen, h.limits.MaxQuerySize)
+		h.report(s.Conn().RemotePeer(), peers.OffenseMalformedFrame)
 		s.Write([]byte{RespReject})
 		return
 	}
@@ -364,6 +424,16 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 		return
 	}
 
+	var decision peers.ACLDecision
+	if h.acl != nil {
+		decision = h.acl.Authorize(s.Conn().RemotePeer(), peers.ACLQuery, string(schemaName))
+		if !decision.Allowed {
+			log.Debugf("Query on %s from %s rejected by ACL", schemaName, s.Conn().RemotePeer().ShortString())
+			s.Write([]byte{RespReject})
+			return
+		}
+	}
+
 	// Execute safe bounded query — peer-provided SQL is not used to prevent injection.
 	// Enforce a strict row/byte budget to avoid response amplification and memory pressure.
 	results, err := h.store.QueryAllBounded(string(schemaName), DefaultQueryRecordLimit, DefaultQueryResponseMaxBytes)
@@ -373,6 +443,18 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 		return
 	}
 
+	// Object-filtered ACLs only see records about their objects.
+	if decision.Filtered() {
+		allowed := results[:0]
+		for _, data := range results {
+			norad, objectID := storage.RecordObject(string(schemaName), data)
+			if decision.AllowsObject(peers.ACLObject{NoradCatID: norad, ObjectID: objectID}) {
+				allowed = append(allowed, data)
+			}
+		}
+		results = allowed
+	}
+
 	// Send response
 	s.Write([]byte{RespAccept})
 
@@ -395,8 +477,33 @@ func (h *SDSExchangeHandler) handleQuery(ctx context.Context, s network.Stream)
 	log.Debugf("Sent %d results for query on %s", len(results), schemaName)
 }
 
-// HandlePubSubMessage processes a message received via PubSub.
+// HandlePubSubMessage processes a message received via PubSub. from is the
+// peer that signed the message, which ACLs and reputation apply to.
 func (h *SDSExchangeHandler) HandlePubSubMessage(schema string, data []byte, from peer.ID) error {
+	if err := h.AdmitPubSubMessage(schema, data, from); err != nil {
+		return err
+	}
+	return h.StorePubSubMessage(schema, data, from)
+}
+
+// StorePubSubMessage stores a PubSub message that AdmitPubSubMessage has
+// already admitted, typically in a topic validator. A record the node
+// already holds is not an offense: gossip can deliver the same record from
+// different publishers.
+func (h *SDSExchangeHandler) StorePubSubMessage(schema string, data []byte, from peer.ID) error {
+	if _, _, err := h.store.StoreNew(schema, data, from.String(), nil); err != nil {
+		return fmt.Errorf("failed to store: %w", err)
+	}
+
+	log.Debugf("PubSub message accepted: %s record from %s", schema, from.ShortString())
+	return nil
+}
+
+// AdmitPubSubMessage applies every check HandlePubSubMessage makes before
+// storing a record: rate limit, schema name and size limits, ACL, schema
+// validation and reputation reporting. Other ingest paths, such as the WASI
+// processing stage, call it so records cannot bypass those rules.
+func (h *SDSExchangeHandler) AdmitPubSubMessage(schema string, data []byte, from peer.ID) error {
 	// Check rate limit before processing
 	if h.rateLimiter != nil && !h.rateLimiter.Allow(from) {
 		log.Warnf("Rate limit exceeded for peer %s, rejecting PubSub message", from.ShortString())
@@ -406,15 +513,18 @@ func (h *SDSExchangeHandler) HandlePubSubMessage(schema string, data []byte, fro
 	// Validate schema name to prevent path traversal and injection attacks
 	if err := sds.ValidateSchemaName(schema); err != nil {
 		log.Warnf("PubSub message rejected: invalid schema name from %s: %v", from.ShortString(), err)
+		h.report(from, peers.OffenseMalformedFrame)
 		return fmt.Errorf("invalid schema name: %w", err)
 	}
 
 	if len(data) == 0 {
+		h.report(from, peers.OffenseMalformedFrame)
 		return errors.New("message too short")
 	}
 
 	// Validate message size.
 	if len(data) > h.limits.MaxMessageSize {
+		h.report(from, peers.OffenseMalformedFrame)
 		return fmt.Errorf("message too large: %d > %d bytes", len(data), h.limits.MaxMessageSize)
 	}
 
@@ -427,6 +537,11 @@ func (h *SDSExchangeHandler) HandlePubSubMessage(schema string, data []byte, fro
 	// SDS v1 message format: [data...]
 	msgData := data
 
+	if err := h.checkACL(from, peers.ACLPublish, schema, msgData); err != nil {
+		log.Warnf("PubSub message rejected: %s from %s: %v", schema, from.ShortString(), err)
+		return err
+	}
+
 	// Create context with timeout for PubSub message handling
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultValidationTimeout)
 	defer cancel()
@@ -434,16 +549,16 @@ func (h *SDSExchangeHandler) HandlePubSubMessage(schema string, data []byte, fro
 	// Validate data against schema
 	if err := h.validator.Validate(ctx, schema, msgData); err != nil {
 		log.Warnf("PubSub message rejected: validation failed for %s from %s: %v", schema, from.ShortString(), err)
+		h.report(from, peers.OffenseValidationFailure)
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
-	// Store data
-	_, err := h.store.Store(schema, msgData, from.String(), nil)
-	if err != nil {
-		return fmt.Errorf("failed to store: %w", err)
+	// Replayed or long-expired records are accepted but count against the peer.
+	if h.reputation != nil && h.staleAfter > 0 {
+		if epoch, ok := storage.RecordEpoch(schema, msgData); ok && time.Since(epoch) > h.staleAfter {
+			h.report(from, peers.OffenseStaleRecord)
+		}
 	}
-
-	log.Debugf("PubSub message accepted: %s record from %s", schema, from.ShortString())
 	return nil
 }
 
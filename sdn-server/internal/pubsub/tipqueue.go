@@ -9,6 +9,8 @@ import (
 	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/PNM"
 	flatbuffers "github.com/google/flatbuffers/go"
 	ps "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/spacedatanetwork/sdn-server/internal/sds"
 )
 
 // TipQueue errors.
@@ -122,7 +124,7 @@ func (tq *TipQueue) Subscribe() error {
 		return ErrNoTopicMgr
 	}
 
-	sub, err := tq.topicMgr.Subscribe("PNM")
+	sub, err := tq.topicMgr.Subscribe(sds.PNMSchema)
 	if err != nil {
 		return err
 	}
@@ -386,7 +388,7 @@ func (tq *TipQueue) PublishTip(ctx context.Context, opts PublishOptions) error {
 	data := make([]byte, len(builder.FinishedBytes()))
 	copy(data, builder.FinishedBytes())
 
-	return topicMgr.Publish("PNM", data)
+	return topicMgr.Publish(sds.PNMSchema, data)
 }
 
 // PublishOptions contains options for publishing a tip.
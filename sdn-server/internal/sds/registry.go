@@ -15,6 +15,10 @@ import (
 //go:embed schemas/*.fbs
 var sdsSchemasFS embed.FS
 
+// PNMSchema is the schema name, and PubSub topic key, of Peer Network
+// Manifests. PNMs announce tips and peer EPMs.
+const PNMSchema = "PNM.fbs"
+
 // SchemaRegistry manages SDS schema files and metadata.
 type SchemaRegistry struct {
 	schemas      map[string][]byte // schema name -> content
@@ -44,4 +44,15 @@
 // Complete setup:
 //
 //	err := mgr.CompleteSetup()
+//
+// # Identity Recovery
+//
+// A Recovery rebuilds a node mnemonic from M of its Shamir shares (see
+// keys.SplitMnemonic). It only returns the mnemonic once the peer ID it
+// derives matches the one the shares were made for:
+//
+//	r := setup.NewRecovery(derivePeerID, expectedPeerID)
+//	_ = r.AddShare(share) // repeat until r.Progress() reports enough
+//	mnemonic, peerID, err := r.Recover(ctx)
+//	err = setup.InstallMnemonic(mnemonicPath, mnemonic, password, false)
 package setup
@@ -0,0 +1,113 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spacedatanetwork/sdn-server/internal/keys"
+)
+
+// Recovery errors
+var (
+	ErrPeerIDMismatch  = errors.New("recovered identity does not match the expected peer ID")
+	ErrIdentityExists  = errors.New("an identity already exists")
+	ErrRecoveryPending = errors.New("more shares are needed")
+)
+
+// IdentityDeriver returns the peer ID a mnemonic derives. The node uses the
+// HD wallet module's IdentityFromMnemonic.
+type IdentityDeriver func(ctx context.Context, mnemonic string) (string, error)
+
+// Recovery collects Shamir shares of a node mnemonic until enough are present
+// to rebuild it. The rebuilt mnemonic is only returned once the peer ID it
+// derives matches the one recorded in the shares, and the expected peer ID if
+// one was given.
+type Recovery struct {
+	derive         IdentityDeriver
+	expectedPeerID string
+	shares         map[int]keys.MnemonicShare
+	first          *keys.MnemonicShare
+}
+
+// NewRecovery starts a recovery. expectedPeerID may be empty to accept the
+// peer ID recorded in the shares.
+func NewRecovery(derive IdentityDeriver, expectedPeerID string) *Recovery {
+	return &Recovery{
+		derive:         derive,
+		expectedPeerID: expectedPeerID,
+		shares:         make(map[int]keys.MnemonicShare),
+	}
+}
+
+// AddShare adds a share. It rejects shares from another split or for another
+// peer ID; adding a share twice has no effect.
+func (r *Recovery) AddShare(share keys.MnemonicShare) error {
+	if r.expectedPeerID != "" && share.PeerID != r.expectedPeerID {
+		return fmt.Errorf("%w: share is for %s", ErrPeerIDMismatch, share.PeerID)
+	}
+	if r.first != nil && (share.SetID != r.first.SetID || share.PeerID != r.first.PeerID) {
+		return keys.ErrShareMismatch
+	}
+	if r.first == nil {
+		r.first = &share
+	}
+	r.shares[share.Index] = share
+	return nil
+}
+
+// Progress returns how many distinct shares have been added and how many are
+// needed. need is 0 before the first share.
+func (r *Recovery) Progress() (have, need int) {
+	if r.first == nil {
+		return 0, 0
+	}
+	return len(r.shares), r.first.Threshold
+}
+
+// Recover rebuilds the mnemonic and verifies the identity it derives.
+func (r *Recovery) Recover(ctx context.Context) (mnemonic, peerID string, err error) {
+	if have, need := r.Progress(); need == 0 || have < need {
+		return "", "", fmt.Errorf("%w: have %d of %d", ErrRecoveryPending, have, need)
+	}
+	shares := make([]keys.MnemonicShare, 0, len(r.shares))
+	for _, s := range r.shares {
+		shares = append(shares, s)
+	}
+	mnemonic, err = keys.CombineMnemonicShares(shares)
+	if err != nil {
+		return "", "", err
+	}
+
+	peerID, err = r.derive(ctx, mnemonic)
+	if err != nil {
+		return "", "", fmt.Errorf("derive identity from recovered mnemonic: %w", err)
+	}
+	if peerID != r.first.PeerID {
+		return "", "", fmt.Errorf("%w: derived %s, shares are for %s", ErrPeerIDMismatch, peerID, r.first.PeerID)
+	}
+	log.Infof("Recovered identity %s from %d shares", peerID, len(shares))
+	return mnemonic, peerID, nil
+}
+
+// InstallMnemonic stores a recovered mnemonic at path, encrypted with
+// password, where the node loads its identity from. It refuses to replace an
+// existing mnemonic unless overwrite is set.
+func InstallMnemonic(path, mnemonic, password string, overwrite bool) error {
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return fmt.Errorf("%w at %s", ErrIdentityExists, path)
+	}
+	encrypted, err := keys.EncryptMnemonic(mnemonic, password)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt mnemonic: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		return fmt.Errorf("failed to write mnemonic: %w", err)
+	}
+	return nil
+}
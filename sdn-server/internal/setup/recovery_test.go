@@ -0,0 +1,91 @@
+package setup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spacedatanetwork/sdn-server/internal/keys"
+)
+
+const recoveryTestMnemonic = "abandon ability able about above absent absorb abstract absurd abuse access accident"
+
+// fakePeerID stands in for the HD wallet derivation.
+func fakePeerID(_ context.Context, mnemonic string) (string, error) {
+	h := sha256.Sum256([]byte(mnemonic))
+	return "peer-" + hex.EncodeToString(h[:8]), nil
+}
+
+func TestRecoveryFromShares(t *testing.T) {
+	peerID, _ := fakePeerID(context.Background(), recoveryTestMnemonic)
+	shares, err := keys.SplitMnemonic(recoveryTestMnemonic, peerID, 2, 3)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+
+	r := NewRecovery(fakePeerID, peerID)
+	if err := r.AddShare(shares[2]); err != nil {
+		t.Fatalf("Failed to add share: %v", err)
+	}
+	if _, _, err := r.Recover(context.Background()); !errors.Is(err, ErrRecoveryPending) {
+		t.Errorf("Expected ErrRecoveryPending with one share, got %v", err)
+	}
+	if err := r.AddShare(shares[0]); err != nil {
+		t.Fatalf("Failed to add share: %v", err)
+	}
+	if have, need := r.Progress(); have != 2 || need != 2 {
+		t.Errorf("Expected 2 of 2 shares, got %d of %d", have, need)
+	}
+
+	mnemonic, got, err := r.Recover(context.Background())
+	if err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	if mnemonic != recoveryTestMnemonic || got != peerID {
+		t.Errorf("Recovered %q / %s", mnemonic, got)
+	}
+}
+
+func TestRecoveryRejectsWrongIdentity(t *testing.T) {
+	// Shares claim a peer ID the mnemonic does not derive
+	shares, err := keys.SplitMnemonic(recoveryTestMnemonic, "peer-someone-else", 2, 2)
+	if err != nil {
+		t.Fatalf("Failed to split mnemonic: %v", err)
+	}
+
+	if err := NewRecovery(fakePeerID, "peer-expected").AddShare(shares[0]); !errors.Is(err, ErrPeerIDMismatch) {
+		t.Errorf("Expected ErrPeerIDMismatch for a share of another node, got %v", err)
+	}
+
+	r := NewRecovery(fakePeerID, "")
+	for _, s := range shares {
+		if err := r.AddShare(s); err != nil {
+			t.Fatalf("Failed to add share: %v", err)
+		}
+	}
+	if _, _, err := r.Recover(context.Background()); !errors.Is(err, ErrPeerIDMismatch) {
+		t.Errorf("Expected ErrPeerIDMismatch, got %v", err)
+	}
+}
+
+func TestInstallMnemonic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "mnemonic")
+	if err := InstallMnemonic(path, recoveryTestMnemonic, "secret", false); err != nil {
+		t.Fatalf("InstallMnemonic failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read mnemonic: %v", err)
+	}
+	if got, err := keys.DecryptMnemonic(data, "secret"); err != nil || got != recoveryTestMnemonic {
+		t.Errorf("Stored mnemonic did not decrypt: %v", err)
+	}
+
+	if err := InstallMnemonic(path, recoveryTestMnemonic, "secret", false); !errors.Is(err, ErrIdentityExists) {
+		t.Errorf("Expected ErrIdentityExists, got %v", err)
+	}
+}
@@ -31,8 +31,16 @@ type FlatSQLStore struct {
 	validator *sds.Validator
 	dbPath    string
 	mu        sync.RWMutex
+
+	listenMu  sync.RWMutex
+	listeners map[uint64]StoreListener
+	nextID    uint64
 }
 
+// StoreListener is called after a new record has been stored. Records that
+// were already present are not reported again.
+type StoreListener func(schemaName string, rec *Record)
+
 // NewFlatSQLStore creates a new FlatSQL storage instance.
 func NewFlatSQLStore(basePath string, validator *sds.Validator) (*FlatSQLStore, error) {
 	// Ensure directory exists
@@ -161,12 +169,64 @@ func (s *FlatSQLStore) initTables() error {
 
 // Store stores validated data in the appropriate table.
 func (s *FlatSQLStore) Store(schemaName string, data []byte, peerID string, signature []byte) (string, error) {
+	cid, rec, err := s.store(schemaName, data, peerID, signature)
+	if err != nil {
+		return "", err
+	}
+	if rec != nil {
+		s.notify(schemaName, rec)
+	}
+	return cid, nil
+}
+
+// StoreNew is Store that also reports whether the record was new. created is
+// false when a record with the same CID was already stored.
+func (s *FlatSQLStore) StoreNew(schemaName string, data []byte, peerID string, signature []byte) (cid string, created bool, err error) {
+	cid, rec, err := s.store(schemaName, data, peerID, signature)
+	if err != nil {
+		return "", false, err
+	}
+	if rec != nil {
+		s.notify(schemaName, rec)
+	}
+	return cid, rec != nil, nil
+}
+
+// OnStore registers a listener for newly stored records and returns a
+// function that removes it. Listeners run on the writer's goroutine after
+// the store lock is released, so they must not block.
+func (s *FlatSQLStore) OnStore(fn StoreListener) func() {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[uint64]StoreListener)
+	}
+	s.nextID++
+	id := s.nextID
+	s.listeners[id] = fn
+	return func() {
+		s.listenMu.Lock()
+		delete(s.listeners, id)
+		s.listenMu.Unlock()
+	}
+}
+
+func (s *FlatSQLStore) notify(schemaName string, rec *Record) {
+	s.listenMu.RLock()
+	defer s.listenMu.RUnlock()
+	for _, fn := range s.listeners {
+		fn(schemaName, rec)
+	}
+}
+
+// store writes the record and returns it if it was not already present.
+func (s *FlatSQLStore) store(schemaName string, data []byte, peerID string, signature []byte) (string, *Record, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	tableName, err := sds.SchemaNameToTable(schemaName)
 	if err != nil {
-		return "", fmt.Errorf("invalid schema name: %w", err)
+		return "", nil, fmt.Errorf("invalid schema name: %w", err)
 	}
 
 	// Compute CID (content identifier)
@@ -181,9 +241,9 @@ func (s *FlatSQLStore) Store(schemaName string, data []byte, peerID string, sign
 	`, tableName)
 
 	now := time.Now().Unix()
-	_, err = s.db.Exec(insertSQL, cid, peerID, now, data, signature)
+	res, err := s.db.Exec(insertSQL, cid, peerID, now, data, signature)
 	if err != nil {
-		return "", fmt.Errorf("failed to store data: %w", err)
+		return "", nil, fmt.Errorf("failed to store data: %w", err)
 	}
 
 	if err := s.upsertRecordIndex(schemaName, cid, now, data); err != nil {
@@ -192,7 +252,16 @@ func (s *FlatSQLStore) Store(schemaName string, data []byte, peerID string, sign
 	}
 
 	log.Debugf("Stored %s record with CID: %s", schemaName, cid[:16]+"...")
-	return cid, nil
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return cid, nil, nil
+	}
+	return cid, &Record{
+		CID:       cid,
+		PeerID:    peerID,
+		Timestamp: time.Unix(now, 0).UTC(),
+		Data:      data,
+		Signature: signature,
+	}, nil
 }
 
 // Get retrieves data by CID.
@@ -609,6 +678,36 @@ func (s *FlatSQLStore) GetRecord(schemaName, cid string) (*Record, error) {
 	return &record, nil
 }
 
+// FindByCID looks up a record by CID, or by a prefix of at least 16 hex
+// characters, across all schema tables. It returns the record's schema.
+func (s *FlatSQLStore) FindByCID(cidPrefix string) (string, []byte, error) {
+	cidPrefix = strings.ToLower(cidPrefix)
+	if len(cidPrefix) < 16 || len(cidPrefix) > 64 || strings.Trim(cidPrefix, "0123456789abcdef") != "" {
+		return "", nil, fmt.Errorf("invalid CID: %s", cidPrefix)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, schemaName := range s.validator.Schemas() {
+		tableName, err := sds.SchemaNameToTable(schemaName)
+		if err != nil {
+			continue
+		}
+		// Hex CIDs sort below "g", so this range matches the prefix.
+		querySQL := fmt.Sprintf(`SELECT data FROM %s WHERE cid >= ? AND cid < ? LIMIT 1`, tableName)
+		var data []byte
+		err = s.db.QueryRow(querySQL, cidPrefix, cidPrefix+"g").Scan(&data)
+		if err == nil {
+			return schemaName, data, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", nil, fmt.Errorf("failed to get data: %w", err)
+		}
+	}
+	return "", nil, fmt.Errorf("not found: %s", cidPrefix)
+}
+
 type indexedFields struct {
 	noradCatID *uint32
 	entityID   string
@@ -658,6 +757,29 @@ func (s *FlatSQLStore) upsertRecordIndex(schemaName, cid string, sourceTimestamp
 	return nil
 }
 
+// RecordObject returns the NORAD catalog number and object or entity ID a
+// record describes, as far as they are indexed for its schema. Zero values
+// mean the field is unknown.
+func RecordObject(schemaName string, data []byte) (noradCatID uint32, objectID string) {
+	fields, err := extractIndexedFields(schemaName, data)
+	if err != nil {
+		return 0, ""
+	}
+	if fields.noradCatID != nil {
+		noradCatID = *fields.noradCatID
+	}
+	return noradCatID, fields.entityID
+}
+
+// RecordEpoch returns the epoch of a record for schemas that index one.
+func RecordEpoch(schemaName string, data []byte) (time.Time, bool) {
+	fields, err := extractIndexedFields(schemaName, data)
+	if err != nil || fields.epochUnix == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*fields.epochUnix, 0).UTC(), true
+}
+
 func extractIndexedFields(schemaName string, data []byte) (*indexedFields, error) {
 	out := &indexedFields{}
 
@@ -357,6 +357,50 @@ func TestFlatSQLStoreGetRecord(t *testing.T) {
 	}
 }
 
+func TestFlatSQLStoreOnStore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "flatsql-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	validator, err := sds.NewValidator(nil)
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+
+	store, err := NewFlatSQLStore(tmpDir, validator)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	var seen []string
+	remove := store.OnStore(func(schemaName string, rec *Record) {
+		seen = append(seen, schemaName+"/"+rec.CID)
+	})
+
+	cid, err := store.Store("OMM.fbs", []byte("listener test"), "12D3KooWTestListener", nil)
+	if err != nil {
+		t.Fatalf("Failed to store: %v", err)
+	}
+	// Duplicates are not reported again.
+	if _, err := store.Store("OMM.fbs", []byte("listener test"), "12D3KooWTestListener", nil); err != nil {
+		t.Fatalf("Failed to store duplicate: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "OMM.fbs/"+cid {
+		t.Errorf("listener saw %v, want [OMM.fbs/%s]", seen, cid)
+	}
+
+	remove()
+	if _, err := store.Store("OMM.fbs", []byte("after removal"), "12D3KooWTestListener", nil); err != nil {
+		t.Fatalf("Failed to store: %v", err)
+	}
+	if len(seen) != 1 {
+		t.Errorf("removed listener was called: %v", seen)
+	}
+}
+
 func TestComputeCID(t *testing.T) {
 	data1 := []byte("test data 1")
 	data2 := []byte("test data 2")
@@ -1,12 +1,18 @@
 package storefront
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/auth"
 	"github.com/spacedatanetwork/sdn-server/internal/peers"
 )
@@ -18,6 +24,8 @@ type APIHandler struct {
 	delivery *DeliveryService
 	payment  *PaymentProcessor
 	trust    *TrustScorer
+	audit    *audit.Logger
+	auth     *auth.Handler
 }
 
 // NewAPIHandler creates a new API handler
@@ -31,9 +39,16 @@ func NewAPIHandler(service *Service, catalog *Catalog, delivery *DeliveryService
 	}
 }
 
+// SetAuditLogger records listing creation and removal to logger.
+func (h *APIHandler) SetAuditLogger(logger *audit.Logger) {
+	h.audit = logger
+}
+
 // RegisterRoutes registers the storefront HTTP routes on a mux.
 // authHandler may be nil (auth disabled), in which case all routes are open.
 func (h *APIHandler) RegisterRoutes(mux *http.ServeMux, authHandler *auth.Handler) {
+	h.auth = authHandler
+
 	// Helper to wrap with auth at a given trust level (no-op if authHandler is nil)
 	requireAuth := func(minTrust peers.TrustLevel, handler http.HandlerFunc) http.HandlerFunc {
 		if authHandler == nil {
@@ -61,6 +76,10 @@ func (h *APIHandler) RegisterRoutes(mux *http.ServeMux, authHandler *auth.Handle
 	mux.HandleFunc("/api/storefront/grants", requireAuth(peers.Standard, h.handleGrants))
 	mux.HandleFunc("/api/storefront/grants/", requireAuth(peers.Standard, h.handleGrantByID))
 
+	// Usage invoices — require auth
+	mux.HandleFunc("/api/storefront/invoices", requireAuth(peers.Standard, h.handleInvoices))
+	mux.HandleFunc("/api/storefront/invoices/", requireAuth(peers.Standard, h.handleInvoiceByID))
+
 	// Reviews — read is public via listing sub-path, create requires auth
 	mux.HandleFunc("/api/storefront/reviews", requireAuth(peers.Standard, h.handleCreateReview))
 	mux.HandleFunc("/api/storefront/reviews/", requireAuth(peers.Standard, h.handleReviewByID))
@@ -68,6 +87,9 @@ func (h *APIHandler) RegisterRoutes(mux *http.ServeMux, authHandler *auth.Handle
 	// Credits — require auth
 	mux.HandleFunc("/api/storefront/credits/", requireAuth(peers.Standard, h.handleCredits))
 
+	// Provenance — trace a delivered record back to its grant
+	mux.HandleFunc("/api/storefront/provenance/verify", requireAuth(peers.Standard, h.handleVerifyProvenance))
+
 	// Trust — public (read-only)
 	mux.HandleFunc("/api/storefront/trust/", h.handleTrust)
 
@@ -97,6 +119,10 @@ func (h *APIHandler) handleListings(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "at least one pricing tier is required", http.StatusBadRequest)
 			return
 		}
+		if err := ValidateRevenueSplits(listing.RevenueSplits, h.service.PlatformFee()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err := h.service.CreateListing(r.Context(), &listing); err != nil {
 			http.Error(w, "failed to create listing", http.StatusInternalServerError)
 			return
@@ -104,6 +130,13 @@ func (h *APIHandler) handleListings(w http.ResponseWriter, r *http.Request) {
 		if h.catalog != nil {
 			h.catalog.PublishListing(r.Context(), &listing)
 		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeListingChange,
+			TargetType:  "listing",
+			TargetID:    listing.ListingID,
+			Description: "Listing created",
+			After:       listing,
+		})
 		writeJSON(w, http.StatusCreated, listing)
 
 	case http.MethodGet:
@@ -182,10 +215,27 @@ func (h *APIHandler) handleListingByID(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, listing)
 
 	case http.MethodDelete:
-		if err := h.service.store.UpdateListingActive(listingID, false); err != nil {
+		listing, err := h.service.GetListing(r.Context(), listingID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if listing == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err := h.service.RemoveListing(r.Context(), listingID); err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
+		h.audit.RecordRequest(r, audit.Event{
+			Type:        audit.EventTypeListingChange,
+			Severity:    audit.SeverityWarning,
+			TargetType:  "listing",
+			TargetID:    listingID,
+			Description: "Listing removed",
+			Before:      listing,
+		})
 		w.WriteHeader(http.StatusNoContent)
 
 	case http.MethodPatch:
@@ -308,6 +358,16 @@ func (h *APIHandler) handleConfirmPayment(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	purchase, err := h.service.store.GetPurchaseRequest(requestID)
+	if err != nil || purchase == nil {
+		http.Error(w, "purchase not found", http.StatusNotFound)
+		return
+	}
+	if purchase.Status == PurchaseStatusExpired {
+		http.Error(w, "purchase expired", http.StatusGone)
+		return
+	}
+
 	if h.payment != nil {
 		result, err := h.payment.VerifyCryptoPayment(r.Context(), &CryptoPaymentRequest{
 			RequestID:     requestID,
@@ -326,6 +386,10 @@ func (h *APIHandler) handleConfirmPayment(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := h.service.ProcessPayment(r.Context(), requestID, body.TxHash, body.Chain); err != nil {
+		if errors.Is(err, ErrPaymentAlreadyProcessed) {
+			http.Error(w, "payment already processed", http.StatusConflict)
+			return
+		}
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -477,6 +541,11 @@ func (h *APIHandler) handleGrantByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) > 1 && parts[1] == "usage" {
+		h.handleGrantUsage(w, r, grantID)
+		return
+	}
+
 	grant, err := h.service.store.GetGrant(grantID)
 	if err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -489,6 +558,184 @@ func (h *APIHandler) handleGrantByID(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, grant)
 }
 
+// handleGrantUsage records a delivery against a grant (POST) or returns the
+// grant's metered usage periods (GET). Usage is recorded automatically by the
+// delivery service; POST is for providers delivering out of band, and only
+// this node's admins may record usage against grants it provides.
+func (h *APIHandler) handleGrantUsage(w http.ResponseWriter, r *http.Request, grantID string) {
+	switch r.Method {
+	case http.MethodGet:
+		periods, err := h.service.store.GetUsagePeriods(grantID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, periods)
+	case http.MethodPost:
+		grant, err := h.service.store.GetGrant(grantID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grant == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if grant.ProviderPeerID != h.service.peerID {
+			http.Error(w, "usage can only be recorded by the grant's provider", http.StatusForbidden)
+			return
+		}
+		if session := auth.SessionFromContext(r.Context()); session == nil || session.TrustLevel < peers.Admin {
+			http.Error(w, "admin access required to record usage", http.StatusForbidden)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 1024)
+		var body struct {
+			Records uint64 `json:"records"`
+			Bytes   uint64 `json:"bytes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		if err := h.service.RecordUsage(r.Context(), grantID, body.Records, body.Bytes); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVerifyProvenance accepts a delivered record (raw bytes, with or
+// without its provenance envelope) and reports the grant it was sold under.
+// An envelope whose signature or record hash does not verify is reported
+// with 422 so callers cannot mistake the claimed grant for a verified one.
+// The ?listing= the record came from is required, and only its provider or
+// an admin may trace records of it.
+func (h *APIHandler) handleVerifyProvenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	listingID := r.URL.Query().Get("listing")
+	if listingID == "" {
+		http.Error(w, "listing query param required", http.StatusBadRequest)
+		return
+	}
+	listing, err := h.service.store.GetListing(listingID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if listing == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	// Traces name buyers, so only the listing's provider may run them.
+	if !h.sessionActsFor(r, listing.ProviderPeerID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16<<20)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	trace, err := h.service.TraceRecord(data, listingID)
+	if errors.Is(err, ErrNoProvenance) || (err == nil && trace.ListingID != listingID) {
+		http.Error(w, "no provenance found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !trace.Valid {
+		writeJSON(w, http.StatusUnprocessableEntity, trace)
+		return
+	}
+	writeJSON(w, http.StatusOK, trace)
+}
+
+func (h *APIHandler) handleInvoices(w http.ResponseWriter, r *http.Request) {
+	peerID := r.URL.Query().Get("peer")
+	if peerID == "" {
+		http.Error(w, "peer query param required", http.StatusBadRequest)
+		return
+	}
+	if !h.sessionActsFor(r, peerID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+	invoices, err := h.service.store.GetInvoicesByPeer(peerID, limit, offset)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, invoices)
+}
+
+func (h *APIHandler) handleInvoiceByID(w http.ResponseWriter, r *http.Request) {
+	invoiceID := extractPathParam(r.URL.Path, "/api/storefront/invoices/")
+	inv, err := h.service.store.GetInvoice(invoiceID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if inv == nil || !(h.sessionActsFor(r, inv.BuyerPeerID) || h.sessionActsFor(r, inv.ProviderPeerID)) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// sessionActsFor reports whether the request's session may read peerID's
+// records: admins may read any peer's, other users only those of the peer
+// derived from their signing key. Requests without a session are refused.
+func (h *APIHandler) sessionActsFor(r *http.Request, peerID string) bool {
+	session := auth.SessionFromContext(r.Context())
+	if session == nil {
+		return false
+	}
+	if session.TrustLevel >= peers.Admin {
+		return true
+	}
+	id, ok := h.sessionPeerID(session.XPub)
+	return ok && id.String() == peerID
+}
+
+// sessionPeerID derives the peer ID of a user's Ed25519 signing key.
+func (h *APIHandler) sessionPeerID(xpub string) (peer.ID, bool) {
+	if h.auth == nil {
+		return "", false
+	}
+	user, err := h.auth.UserStore().GetUser(xpub)
+	if err != nil || user == nil || user.SigningPubKeyHex == "" {
+		return "", false
+	}
+	raw, err := hex.DecodeString(user.SigningPubKeyHex)
+	if err != nil {
+		return "", false
+	}
+	pub, err := crypto.UnmarshalEd25519PublicKey(raw)
+	if err != nil {
+		return "", false
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return "", false
+	}
+	return id, true
+}
+
 func (h *APIHandler) handleCreateReview(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -630,6 +877,7 @@ type SellerDashboardResponse struct {
 	TotalListings   int                `json:"total_listings"`
 	ActiveGrants    int                `json:"active_grants"`
 	TotalEarnings   uint64             `json:"total_earnings"`
+	Payouts         *PayoutSummary     `json:"payouts,omitempty"` // net credits received, by split role
 	RecentPurchases []*PurchaseRequest `json:"recent_purchases"`
 	TrustScore      *TrustScore        `json:"trust_score,omitempty"`
 	CreditsBalance  *CreditsBalance    `json:"credits_balance"`
@@ -655,6 +903,7 @@ func (h *APIHandler) handleSellerDashboard(w http.ResponseWriter, r *http.Reques
 
 	// Get earnings
 	earnings, _ := h.service.store.GetProviderEarnings(providerID)
+	payouts, _ := h.service.store.GetPayoutSummary(providerID)
 
 	// Get recent purchases
 	purchases, _, _ := h.service.store.GetProviderPurchases(providerID, 10, 0)
@@ -673,6 +922,7 @@ func (h *APIHandler) handleSellerDashboard(w http.ResponseWriter, r *http.Reques
 		TotalListings:   listingsResult.Total,
 		ActiveGrants:    totalGrants,
 		TotalEarnings:   earnings,
+		Payouts:         payouts,
 		RecentPurchases: purchases,
 		TrustScore:      trustScore,
 		CreditsBalance:  balance,
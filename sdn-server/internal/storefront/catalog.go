@@ -39,6 +39,11 @@ type Catalog struct {
 	dht     DHTStore
 	entries map[string]*CatalogEntry // listingID -> entry
 	mu      sync.RWMutex
+
+	// Provider and category indexes are only published for the provider
+	// that can sign them.
+	indexProvider string
+	signIndex     func(data []byte) ([]byte, error)
 }
 
 // NewCatalog creates a new catalog for DHT-based discovery
@@ -50,6 +55,63 @@ func NewCatalog(store *Store, dht DHTStore) *Catalog {
 	}
 }
 
+// SetIndexSigner sets the provider whose provider and category indexes this
+// catalog publishes, and the function that signs them with the provider's
+// identity key. Without a signer no indexes are published.
+func (c *Catalog) SetIndexSigner(providerPeerID string, sign func(data []byte) ([]byte, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexProvider = providerPeerID
+	c.signIndex = sign
+}
+
+// categoryIndexKey returns the DHT key of a provider's index for a data type.
+func categoryIndexKey(dataType, providerPeerID string) string {
+	return DHTKeyCategoryPrefix + strings.ToLower(dataType) + "/" + providerPeerID
+}
+
+// publishIndex signs and stores a listing index under key.
+func (c *Catalog) publishIndex(ctx context.Context, key string, ids []string) error {
+	c.mu.RLock()
+	provider, sign := c.indexProvider, c.signIndex
+	c.mu.RUnlock()
+
+	idx := &ListingIndex{ProviderPeerID: provider, ListingIDs: ids, UpdatedAt: time.Now()}
+	sig, err := sign(listingIndexSigningPayload(key, idx))
+	if err != nil {
+		return fmt.Errorf("failed to sign listing index: %w", err)
+	}
+	idx.Signature = sig
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return c.dht.PutValue(ctx, key, data)
+}
+
+// canPublishIndex reports whether this catalog signs indexes for provider.
+func (c *Catalog) canPublishIndex(providerPeerID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dht != nil && c.signIndex != nil && c.indexProvider == providerPeerID
+}
+
+// fetchIndex fetches and verifies the listing index stored under key.
+func (c *Catalog) fetchIndex(ctx context.Context, key string) ([]string, error) {
+	data, err := c.dht.GetValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var idx ListingIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal listing index: %w", err)
+	}
+	if err := VerifyListingIndex(key, &idx); err != nil {
+		return nil, err
+	}
+	return idx.ListingIDs, nil
+}
+
 // PublishListing publishes a listing to the DHT catalog
 func (c *Catalog) PublishListing(ctx context.Context, listing *Listing) error {
 	entry := &CatalogEntry{
@@ -76,29 +138,19 @@ func (c *Catalog) PublishListing(ctx context.Context, listing *Listing) error {
 	}
 
 	// Update provider index
-	providerKey := DHTKeyProviderPrefix + listing.ProviderPeerID + "/listings"
 	c.mu.Lock()
 	c.entries[listing.ListingID] = entry
-	providerListingIDs := c.getProviderListingIDsLocked(listing.ProviderPeerID)
 	c.mu.Unlock()
-
-	if c.dht != nil {
-		indexData, _ := json.Marshal(providerListingIDs)
-		if err := c.dht.PutValue(ctx, providerKey, indexData); err != nil {
-			log.Warnf("Failed to publish provider index to DHT: %v", err)
-		}
-	}
+	c.PublishProviderIndex(ctx, listing.ProviderPeerID)
 
 	// Update category indexes
-	for _, dt := range listing.DataTypes {
-		categoryKey := DHTKeyCategoryPrefix + strings.ToLower(dt)
-		c.mu.RLock()
-		categoryIDs := c.getCategoryListingIDsLocked(dt)
-		c.mu.RUnlock()
-
-		if c.dht != nil {
-			catData, _ := json.Marshal(categoryIDs)
-			if err := c.dht.PutValue(ctx, categoryKey, catData); err != nil {
+	if c.canPublishIndex(listing.ProviderPeerID) {
+		for _, dt := range listing.DataTypes {
+			c.mu.RLock()
+			categoryIDs := c.getCategoryListingIDsLocked(dt, listing.ProviderPeerID)
+			c.mu.RUnlock()
+
+			if err := c.publishIndex(ctx, categoryIndexKey(dt, listing.ProviderPeerID), categoryIDs); err != nil {
 				log.Warnf("Failed to publish category index to DHT: %v", err)
 			}
 		}
@@ -108,6 +160,22 @@ func (c *Catalog) PublishListing(ctx context.Context, listing *Listing) error {
 	return nil
 }
 
+// PublishProviderIndex publishes the IDs of a provider's active catalog
+// entries to the DHT. Only the index signer's own index is published.
+func (c *Catalog) PublishProviderIndex(ctx context.Context, providerPeerID string) {
+	if !c.canPublishIndex(providerPeerID) {
+		return
+	}
+	c.mu.RLock()
+	providerListingIDs := c.getProviderListingIDsLocked(providerPeerID)
+	c.mu.RUnlock()
+
+	providerKey := DHTKeyProviderPrefix + providerPeerID + "/listings"
+	if err := c.publishIndex(ctx, providerKey, providerListingIDs); err != nil {
+		log.Warnf("Failed to publish provider index to DHT: %v", err)
+	}
+}
+
 // FetchListing fetches a listing from the DHT by ID
 func (c *Catalog) FetchListing(ctx context.Context, listingID string) (*Listing, error) {
 	// Check local store first
@@ -120,7 +188,12 @@ func (c *Catalog) FetchListing(ctx context.Context, listingID string) (*Listing,
 	if c.dht == nil {
 		return nil, fmt.Errorf("listing not found and DHT not available")
 	}
+	return c.fetchRemoteListing(ctx, listingID)
+}
 
+// fetchRemoteListing fetches a listing from the DHT, verifies the provider's
+// signature and indexes it locally.
+func (c *Catalog) fetchRemoteListing(ctx context.Context, listingID string) (*Listing, error) {
 	key := DHTKeyListingPrefix + listingID
 	data, err := c.dht.GetValue(ctx, key)
 	if err != nil {
@@ -131,52 +204,80 @@ func (c *Catalog) FetchListing(ctx context.Context, listingID string) (*Listing,
 	if err := json.Unmarshal(data, &fetched); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal DHT listing: %w", err)
 	}
+	if fetched.ListingID != listingID {
+		return nil, fmt.Errorf("DHT listing ID mismatch: %s", fetched.ListingID)
+	}
 
 	// Index locally
-	if err := c.store.CreateListing(&fetched); err != nil {
-		log.Warnf("Failed to index fetched listing locally: %v", err)
+	if _, err := indexRemoteListing(c.store, &fetched, ""); err != nil {
+		return nil, fmt.Errorf("failed to index DHT listing: %w", err)
 	}
 
 	return &fetched, nil
 }
 
-// FetchProviderListings fetches all listing IDs for a provider from DHT
-func (c *Catalog) FetchProviderListings(ctx context.Context, providerPeerID string) ([]string, error) {
+// PublishTombstone publishes a listing tombstone to the DHT.
+func (c *Catalog) PublishTombstone(ctx context.Context, tombstone *ListingTombstone) error {
 	if c.dht == nil {
-		return nil, fmt.Errorf("DHT not available")
+		return nil
+	}
+	data, err := json.Marshal(tombstone)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tombstone: %w", err)
 	}
+	return c.dht.PutValue(ctx, DHTKeyTombstonePrefix+tombstone.ListingID, data)
+}
 
-	key := DHTKeyProviderPrefix + providerPeerID + "/listings"
-	data, err := c.dht.GetValue(ctx, key)
+// FetchTombstone looks up a listing tombstone in the DHT and, if one is found
+// and verifies, withdraws the listing locally.
+func (c *Catalog) FetchTombstone(ctx context.Context, listingID string) error {
+	if c.dht == nil {
+		return fmt.Errorf("DHT not available")
+	}
+	data, err := c.dht.GetValue(ctx, DHTKeyTombstonePrefix+listingID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch provider listings: %w", err)
+		return fmt.Errorf("failed to fetch tombstone: %w", err)
 	}
 
-	var ids []string
-	if err := json.Unmarshal(data, &ids); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal provider listing IDs: %w", err)
+	var tombstone ListingTombstone
+	if err := json.Unmarshal(data, &tombstone); err != nil {
+		return fmt.Errorf("failed to unmarshal tombstone: %w", err)
+	}
+	if tombstone.ListingID != listingID {
+		return fmt.Errorf("DHT tombstone ID mismatch: %s", tombstone.ListingID)
+	}
+	if err := applyTombstone(c.store, &tombstone); err != nil {
+		return err
 	}
 
-	return ids, nil
+	c.RemoveListing(ctx, listingID)
+	return nil
 }
 
-// FetchCategoryListings fetches listing IDs for a data type category from DHT
-func (c *Catalog) FetchCategoryListings(ctx context.Context, dataType string) ([]string, error) {
+// FetchProviderListings fetches all listing IDs for a provider from DHT
+func (c *Catalog) FetchProviderListings(ctx context.Context, providerPeerID string) ([]string, error) {
 	if c.dht == nil {
 		return nil, fmt.Errorf("DHT not available")
 	}
 
-	key := DHTKeyCategoryPrefix + strings.ToLower(dataType)
-	data, err := c.dht.GetValue(ctx, key)
+	ids, err := c.fetchIndex(ctx, DHTKeyProviderPrefix+providerPeerID+"/listings")
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch category listings: %w", err)
+		return nil, fmt.Errorf("failed to fetch provider listings: %w", err)
 	}
+	return ids, nil
+}
 
-	var ids []string
-	if err := json.Unmarshal(data, &ids); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal category listing IDs: %w", err)
+// FetchCategoryListings fetches a provider's listing IDs for a data type
+// category from DHT
+func (c *Catalog) FetchCategoryListings(ctx context.Context, dataType, providerPeerID string) ([]string, error) {
+	if c.dht == nil {
+		return nil, fmt.Errorf("DHT not available")
 	}
 
+	ids, err := c.fetchIndex(ctx, categoryIndexKey(dataType, providerPeerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch category listings: %w", err)
+	}
 	return ids, nil
 }
 
@@ -209,11 +310,11 @@ func (c *Catalog) getProviderListingIDsLocked(providerPeerID string) []string {
 	return ids
 }
 
-func (c *Catalog) getCategoryListingIDsLocked(dataType string) []string {
+func (c *Catalog) getCategoryListingIDsLocked(dataType, providerPeerID string) []string {
 	var ids []string
 	dt := strings.ToLower(dataType)
 	for _, e := range c.entries {
-		if !e.Active {
+		if !e.Active || e.ProviderPeerID != providerPeerID {
 			continue
 		}
 		for _, d := range e.DataTypes {
@@ -243,12 +344,17 @@ func NewIndexer(store *Store, catalog *Catalog) *Indexer {
 	}
 }
 
-// IndexListing indexes a single listing received from PubSub or DHT
+// IndexListing verifies and indexes a single listing received from PubSub or
+// DHT
 func (idx *Indexer) IndexListing(listing *Listing) error {
 	// Store in SQLite for search
-	if err := idx.store.CreateListing(listing); err != nil {
-		// May already exist, try update
-		log.Debugf("Listing %s may already exist, attempting update", listing.ListingID)
+	indexed, err := indexRemoteListing(idx.store, listing, "")
+	if err != nil {
+		return fmt.Errorf("failed to index listing %s: %w", listing.ListingID, err)
+	}
+	if !indexed {
+		log.Debugf("Listing %s is withdrawn or not newer than the indexed copy", listing.ListingID)
+		return nil
 	}
 
 	// Update catalog entry
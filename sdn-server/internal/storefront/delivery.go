@@ -120,6 +120,7 @@ type DeliveryRequest struct {
 	BuyerPeerID   string         `json:"buyer_peer_id"`
 	Method        DeliveryMethod `json:"method"`
 	Data          []byte         `json:"data"`
+	Records       uint64         `json:"records,omitempty"` // records in Data, for metering (default 1)
 	Encrypted     bool           `json:"encrypted"`
 	DeliveryTopic string         `json:"delivery_topic,omitempty"`
 	WebhookURL    string         `json:"webhook_url,omitempty"`
@@ -144,9 +145,24 @@ type DeliveryService struct {
 	pubsub     *ps.PubSub
 	topics     map[string]*ps.Topic // topic path -> topic
 	httpClient *http.Client
+	sealer     RecordSealer
+	meter      UsageMeter
 	mu         sync.RWMutex
 }
 
+// RecordSealer binds a delivered record to the grant it is sold under, e.g.
+// with a signed provenance envelope or watermark.
+type RecordSealer interface {
+	SealRecord(ctx context.Context, grantID string, record []byte) ([]byte, error)
+}
+
+// UsageMeter records deliveries against a grant for usage-based billing. It
+// returns an error for grants that may not receive data, such as grants
+// suspended for unpaid usage.
+type UsageMeter interface {
+	RecordUsage(ctx context.Context, grantID string, records, bytes uint64) error
+}
+
 // NewDeliveryService creates a new delivery service
 func NewDeliveryService(config DeliveryConfig, pubsub *ps.PubSub) *DeliveryService {
 	return &DeliveryService{
@@ -163,8 +179,45 @@ func NewDeliveryService(config DeliveryConfig, pubsub *ps.PubSub) *DeliveryServi
 	}
 }
 
-// Deliver sends data to a buyer using the specified delivery method
+// SetRecordSealer enables per-grant provenance on delivered records.
+func (ds *DeliveryService) SetRecordSealer(sealer RecordSealer) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.sealer = sealer
+}
+
+// SetUsageMeter enables metering of deliveries made under a grant.
+func (ds *DeliveryService) SetUsageMeter(meter UsageMeter) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.meter = meter
+}
+
+// Deliver sends data to a buyer using the specified delivery method. Data sent
+// under a grant is metered before it goes out, so grants that are suspended
+// or inactive receive nothing.
 func (ds *DeliveryService) Deliver(ctx context.Context, req *DeliveryRequest) (*DeliveryResult, error) {
+	ds.mu.RLock()
+	sealer := ds.sealer
+	meter := ds.meter
+	ds.mu.RUnlock()
+	if meter != nil && req.GrantID != "" {
+		records := req.Records
+		if records == 0 {
+			records = 1
+		}
+		if err := meter.RecordUsage(ctx, req.GrantID, records, uint64(len(req.Data))); err != nil {
+			return nil, fmt.Errorf("delivery refused: %w", err)
+		}
+	}
+	if sealer != nil && req.GrantID != "" {
+		sealed, err := sealer.SealRecord(ctx, req.GrantID, req.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply provenance: %w", err)
+		}
+		req.Data = sealed
+	}
+
 	switch req.Method {
 	case DeliveryPubSubStream:
 		return ds.deliverPubSub(ctx, req)
@@ -0,0 +1,372 @@
+package storefront
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// StorefrontTombstonesTopic is the PubSub topic for listing withdrawals
+const StorefrontTombstonesTopic = "/sdn/storefront/tombstones"
+
+// DHTKeyTombstonePrefix is the DHT key prefix for listing tombstones
+const DHTKeyTombstonePrefix = "/sdn/tombstone/"
+
+// ErrInvalidSignature is returned when a remote listing or tombstone is not
+// signed by the provider it names.
+var ErrInvalidSignature = errors.New("invalid provider signature")
+
+// listingSigningPayload returns the canonical bytes a provider signs for a
+// listing. It covers the identity, descriptive and commercial fields, using
+// only values that survive a round trip through the listing index.
+func listingSigningPayload(listing *Listing) ([]byte, error) {
+	terms, err := json.Marshal(struct {
+		DataTypes        []string          `json:"data_types"`
+		AccessType       AccessType        `json:"access_type"`
+		Pricing          []PricingTier     `json:"pricing"`
+		AcceptedPayments []PaymentMethod   `json:"accepted_payments"`
+		RevenueSplits    []RevenueSplit    `json:"revenue_splits"`
+		Provenance       ProvenanceOptions `json:"provenance"`
+		TermsCID         string            `json:"terms_cid"`
+		License          string            `json:"license"`
+	}{
+		DataTypes:        nilIfEmpty(listing.DataTypes),
+		AccessType:       listing.AccessType,
+		Pricing:          nilIfEmpty(listing.Pricing),
+		AcceptedPayments: nilIfEmpty(listing.AcceptedPayments),
+		RevenueSplits:    nilIfEmpty(listing.RevenueSplits),
+		Provenance:       listing.Provenance,
+		TermsCID:         listing.TermsCID,
+		License:          listing.License,
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := fmt.Sprintf("%s:%s:%s:%s:%d:%d:%s",
+		listing.ListingID,
+		listing.ProviderPeerID,
+		listing.Title,
+		listing.Description,
+		listing.UpdatedAt.Unix(),
+		listing.Version,
+		terms,
+	)
+	return []byte(data), nil
+}
+
+func nilIfEmpty[T any](s []T) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func tombstoneSigningPayload(t *ListingTombstone) []byte {
+	return []byte(fmt.Sprintf("tombstone:%s:%s:%d", t.ListingID, t.ProviderPeerID, t.RemovedAt.Unix()))
+}
+
+// ListingIndex is a provider's signed list of its active listing IDs, stored
+// in the DHT under its provider index key or one of its category index keys.
+// Only the provider named in the key can write it.
+type ListingIndex struct {
+	ProviderPeerID string    `json:"provider_peer_id"`
+	ListingIDs     []string  `json:"listing_ids"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Signature      []byte    `json:"signature"`
+}
+
+// listingIndexSigningPayload binds an index to the DHT key it is stored
+// under, so a provider's index for one category cannot be replayed under
+// another.
+func listingIndexSigningPayload(key string, idx *ListingIndex) []byte {
+	return []byte(fmt.Sprintf("listing-index:%s:%s:%d:%s",
+		key, idx.ProviderPeerID, idx.UpdatedAt.UnixNano(), strings.Join(idx.ListingIDs, ",")))
+}
+
+// listingIndexOwner returns the provider whose index is stored under key:
+// /sdn/provider/<peer>/listings or /sdn/category/<type>/<peer>.
+func listingIndexOwner(key string) string {
+	switch {
+	case strings.HasPrefix(key, DHTKeyProviderPrefix):
+		return strings.TrimSuffix(strings.TrimPrefix(key, DHTKeyProviderPrefix), "/listings")
+	case strings.HasPrefix(key, DHTKeyCategoryPrefix):
+		rest := strings.TrimPrefix(key, DHTKeyCategoryPrefix)
+		if i := strings.LastIndex(rest, "/"); i > 0 {
+			return rest[i+1:]
+		}
+	}
+	return ""
+}
+
+// VerifyListingIndex checks that an index record stored under key is signed
+// by the provider the key names.
+func VerifyListingIndex(key string, idx *ListingIndex) error {
+	owner := listingIndexOwner(key)
+	if owner == "" || owner != idx.ProviderPeerID {
+		return fmt.Errorf("listing index does not match key")
+	}
+	return verifyPeerSignature(idx.ProviderPeerID, listingIndexSigningPayload(key, idx), idx.Signature)
+}
+
+// VerifyListing checks that a listing is signed by its provider's libp2p
+// identity key.
+func VerifyListing(listing *Listing) error {
+	data, err := listingSigningPayload(listing)
+	if err != nil {
+		return fmt.Errorf("failed to encode listing: %w", err)
+	}
+	return verifyPeerSignature(listing.ProviderPeerID, data, listing.Signature)
+}
+
+// VerifyTombstone checks that a tombstone is signed by its provider.
+func VerifyTombstone(t *ListingTombstone) error {
+	return verifyPeerSignature(t.ProviderPeerID, tombstoneSigningPayload(t), t.Signature)
+}
+
+func verifyPeerSignature(peerID string, data, sig []byte) error {
+	if len(sig) == 0 {
+		return ErrInvalidSignature
+	}
+	pid, err := peer.Decode(peerID)
+	if err != nil {
+		return fmt.Errorf("invalid provider peer ID: %w", err)
+	}
+	pub, err := pid.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("cannot extract provider public key: %w", err)
+	}
+	ok, err := pub.Verify(data, sig)
+	if err != nil || !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// indexRemoteListing verifies a listing announced by another node and, unless
+// it is withdrawn or older than the copy already indexed, stores it for search.
+// It reports whether the listing was indexed.
+func indexRemoteListing(store *Store, listing *Listing, sourcePeerID string) (bool, error) {
+	if err := VerifyListing(listing); err != nil {
+		return false, err
+	}
+
+	tombstone, err := store.GetTombstone(listing.ListingID)
+	if err != nil {
+		return false, err
+	}
+	if tombstone != nil && tombstone.ProviderPeerID == listing.ProviderPeerID &&
+		listing.UpdatedAt.Unix() <= tombstone.RemovedAt.Unix() {
+		return false, nil
+	}
+
+	existing, err := store.GetListing(listing.ListingID)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		if existing.ProviderPeerID != listing.ProviderPeerID {
+			return false, fmt.Errorf("listing %s already indexed for another provider", listing.ListingID)
+		}
+		if existing.Version > listing.Version ||
+			(existing.Version == listing.Version && listing.UpdatedAt.Unix() <= existing.UpdatedAt.Unix()) {
+			return false, nil
+		}
+	}
+
+	if sourcePeerID == "" {
+		sourcePeerID = listing.ProviderPeerID
+	}
+	listing.SourcePeerID = sourcePeerID
+	listing.Reputation = ProviderReputation{}
+	if err := store.CreateListing(listing); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyTombstone verifies a tombstone and deactivates the listing it names.
+func applyTombstone(store *Store, t *ListingTombstone) error {
+	if err := VerifyTombstone(t); err != nil {
+		return err
+	}
+	listing, err := store.GetListing(t.ListingID)
+	if err != nil {
+		return err
+	}
+	if listing != nil && listing.ProviderPeerID != t.ProviderPeerID {
+		return fmt.Errorf("tombstone for %s not from its provider", t.ListingID)
+	}
+	if err := store.PutTombstone(t); err != nil {
+		return err
+	}
+	if listing != nil && listing.Active && listing.UpdatedAt.Unix() <= t.RemovedAt.Unix() {
+		return store.UpdateListingActive(t.ListingID, false)
+	}
+	return nil
+}
+
+// RecordValidator validates storefront records stored in the "sdn" DHT
+// namespace. Listings, tombstones, and provider and category indexes must
+// carry a valid signature from the provider they name.
+type RecordValidator struct{}
+
+// Validate implements the libp2p record validator interface.
+func (RecordValidator) Validate(key string, value []byte) error {
+	switch {
+	case strings.HasPrefix(key, DHTKeyListingPrefix):
+		var listing Listing
+		if err := json.Unmarshal(value, &listing); err != nil {
+			return fmt.Errorf("invalid listing record: %w", err)
+		}
+		if listing.ListingID != strings.TrimPrefix(key, DHTKeyListingPrefix) {
+			return fmt.Errorf("listing record does not match key")
+		}
+		return VerifyListing(&listing)
+	case strings.HasPrefix(key, DHTKeyTombstonePrefix):
+		var t ListingTombstone
+		if err := json.Unmarshal(value, &t); err != nil {
+			return fmt.Errorf("invalid tombstone record: %w", err)
+		}
+		if t.ListingID != strings.TrimPrefix(key, DHTKeyTombstonePrefix) {
+			return fmt.Errorf("tombstone record does not match key")
+		}
+		return VerifyTombstone(&t)
+	case strings.HasPrefix(key, DHTKeyProviderPrefix), strings.HasPrefix(key, DHTKeyCategoryPrefix):
+		var idx ListingIndex
+		if err := json.Unmarshal(value, &idx); err != nil {
+			return fmt.Errorf("invalid listing index record: %w", err)
+		}
+		return VerifyListingIndex(key, &idx)
+	default:
+		return fmt.Errorf("unknown storefront record key: %s", key)
+	}
+}
+
+// Select implements the libp2p record validator interface, preferring the
+// most recent listing, tombstone or index.
+func (RecordValidator) Select(key string, values [][]byte) (int, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no values")
+	}
+	best, found := 0, false
+	var bestVersion uint32
+	var bestTime time.Time
+	for i, v := range values {
+		var version uint32
+		var at time.Time
+		switch {
+		case strings.HasPrefix(key, DHTKeyListingPrefix):
+			var listing Listing
+			if json.Unmarshal(v, &listing) != nil {
+				continue
+			}
+			version, at = listing.Version, listing.UpdatedAt
+		case strings.HasPrefix(key, DHTKeyTombstonePrefix):
+			var t ListingTombstone
+			if json.Unmarshal(v, &t) != nil {
+				continue
+			}
+			at = t.RemovedAt
+		case strings.HasPrefix(key, DHTKeyProviderPrefix), strings.HasPrefix(key, DHTKeyCategoryPrefix):
+			var idx ListingIndex
+			if json.Unmarshal(v, &idx) != nil {
+				continue
+			}
+			at = idx.UpdatedAt
+		default:
+			return 0, nil
+		}
+		if !found || version > bestVersion || (version == bestVersion && at.After(bestTime)) {
+			best, found, bestVersion, bestTime = i, true, version, at
+		}
+	}
+	return best, nil
+}
+
+// valueStoreDHT adapts a libp2p routing.ValueStore (such as the node's
+// Kademlia DHT) to DHTStore.
+type valueStoreDHT struct {
+	vs routing.ValueStore
+}
+
+// NewValueStoreDHT returns a DHTStore backed by a libp2p value store.
+func NewValueStoreDHT(vs routing.ValueStore) DHTStore {
+	return &valueStoreDHT{vs: vs}
+}
+
+func (d *valueStoreDHT) PutValue(ctx context.Context, key string, value []byte) error {
+	return d.vs.PutValue(ctx, key, value)
+}
+
+func (d *valueStoreDHT) GetValue(ctx context.Context, key string) ([]byte, error) {
+	return d.vs.GetValue(ctx, key)
+}
+
+// CatalogSyncConfig controls the federated catalog loop.
+type CatalogSyncConfig struct {
+	Interval time.Duration // how often listings are republished and the DHT re-read
+}
+
+// DefaultCatalogSyncConfig returns sensible defaults.
+func DefaultCatalogSyncConfig() CatalogSyncConfig {
+	return CatalogSyncConfig{
+		Interval: 30 * time.Minute,
+	}
+}
+
+// CatalogSyncer federates the storefront catalog: it indexes listing
+// announcements and tombstones gossiped by other nodes, periodically
+// re-announces this node's listings, and refreshes known providers' listings
+// from the DHT.
+type CatalogSyncer struct {
+	service *Service
+	cfg     CatalogSyncConfig
+}
+
+// NewCatalogSyncer creates a catalog syncer for the service.
+func NewCatalogSyncer(service *Service, cfg CatalogSyncConfig) *CatalogSyncer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultCatalogSyncConfig().Interval
+	}
+	return &CatalogSyncer{service: service, cfg: cfg}
+}
+
+// Run subscribes to catalog gossip and syncs with the DHT until ctx is
+// cancelled.
+func (c *CatalogSyncer) Run(ctx context.Context) {
+	if listings, err := c.service.SubscribeToListings(ctx); err != nil {
+		log.Warnf("Catalog listing subscription unavailable: %v", err)
+	} else {
+		go func() {
+			for listing := range listings {
+				log.Debugf("Indexed remote listing %s from %s", listing.ListingID, listing.SourcePeerID)
+			}
+		}()
+	}
+	if err := c.service.SubscribeToTombstones(ctx); err != nil {
+		log.Warnf("Catalog tombstone subscription unavailable: %v", err)
+	}
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.service.RepublishListings(ctx); err != nil {
+			log.Warnf("Failed to republish listings: %v", err)
+		}
+		if err := c.service.IndexListingsFromDHT(ctx); err != nil {
+			log.Warnf("DHT catalog sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
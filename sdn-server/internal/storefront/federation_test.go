@@ -0,0 +1,275 @@
+package storefront
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newRemoteProvider(t *testing.T) crypto.PrivKey {
+	t.Helper()
+	priv, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return priv
+}
+
+// signRemoteListing sets the listing's provider to key's peer ID, signs it and
+// returns the peer ID.
+func signRemoteListing(t *testing.T, key crypto.PrivKey, listing *Listing) string {
+	t.Helper()
+	pid, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatalf("IDFromPrivateKey failed: %v", err)
+	}
+	listing.ProviderPeerID = pid.String()
+	if listing.Version == 0 {
+		listing.Version = 1
+	}
+	data, err := listingSigningPayload(listing)
+	if err != nil {
+		t.Fatalf("listingSigningPayload failed: %v", err)
+	}
+	listing.Signature, err = key.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return listing.ProviderPeerID
+}
+
+// newProviderService returns a service whose peer ID matches its identity key.
+func newProviderService(t *testing.T, dht DHTStore) (*Service, *Store) {
+	t.Helper()
+	store := newTestStore(t)
+	key := newRemoteProvider(t)
+	pid, _ := peer.IDFromPrivateKey(key)
+
+	svc, err := NewService(store, pid.String(), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	svc.SetIdentityKey(key)
+	svc.SetCatalog(NewCatalog(store, dht))
+	return svc, store
+}
+
+func TestVerifyListing(t *testing.T) {
+	listing := testListing()
+	listing.ListingID = "signed"
+	listing.UpdatedAt = time.Now()
+	signRemoteListing(t, newRemoteProvider(t), listing)
+
+	if err := VerifyListing(listing); err != nil {
+		t.Fatalf("VerifyListing failed: %v", err)
+	}
+
+	// The signature must survive a JSON round trip.
+	data, _ := json.Marshal(listing)
+	var decoded Listing
+	json.Unmarshal(data, &decoded)
+	if err := VerifyListing(&decoded); err != nil {
+		t.Errorf("VerifyListing after round trip failed: %v", err)
+	}
+
+	decoded.Pricing[0].PriceAmount = 1
+	if err := VerifyListing(&decoded); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered price: err = %v, want ErrInvalidSignature", err)
+	}
+
+	impostor := *listing
+	signRemoteListing(t, newRemoteProvider(t), &impostor)
+	impostor.ProviderPeerID = listing.ProviderPeerID
+	if err := VerifyListing(&impostor); err == nil {
+		t.Error("listing signed by another key should be rejected")
+	}
+}
+
+func TestIndexRemoteListingAndTombstone(t *testing.T) {
+	store := newTestStore(t)
+	key := newRemoteProvider(t)
+
+	listing := testListing()
+	listing.ListingID = "remote-1"
+	listing.Title = "Remote Ephemeris Feed"
+	listing.Active = true
+	listing.CreatedAt = time.Now().Add(-time.Hour)
+	listing.UpdatedAt = time.Now().Add(-time.Hour)
+	provider := signRemoteListing(t, key, listing)
+
+	indexed, err := indexRemoteListing(store, listing, "relay-peer")
+	if err != nil || !indexed {
+		t.Fatalf("indexRemoteListing = %v, %v", indexed, err)
+	}
+	result, err := store.SearchListings(&SearchQuery{SearchText: "Ephemeris", Limit: 10})
+	if err != nil || result.Total != 1 {
+		t.Fatalf("search for remote listing = %+v, %v", result, err)
+	}
+
+	// Forged listings are not indexed.
+	forged := testListing()
+	forged.ListingID = "forged"
+	forged.ProviderPeerID = provider
+	forged.Signature = []byte("not a signature")
+	if indexed, err := indexRemoteListing(store, forged, ""); err == nil || indexed {
+		t.Error("forged listing should be rejected")
+	}
+
+	// Withdraw the listing.
+	tombstone := &ListingTombstone{ListingID: "remote-1", ProviderPeerID: provider, RemovedAt: time.Now()}
+	tombstone.Signature, _ = key.Sign(tombstoneSigningPayload(tombstone))
+	if err := applyTombstone(store, tombstone); err != nil {
+		t.Fatalf("applyTombstone failed: %v", err)
+	}
+	if got, _ := store.GetListing("remote-1"); got.Active {
+		t.Error("listing should be inactive after tombstone")
+	}
+
+	// A replayed announcement of the withdrawn listing is ignored.
+	if indexed, err := indexRemoteListing(store, listing, ""); err != nil || indexed {
+		t.Errorf("replayed listing: indexed = %v, err = %v", indexed, err)
+	}
+
+	// Tombstones from anyone else are rejected.
+	other := newRemoteProvider(t)
+	otherID, _ := peer.IDFromPrivateKey(other)
+	bogus := &ListingTombstone{ListingID: "remote-1", ProviderPeerID: otherID.String(), RemovedAt: time.Now()}
+	bogus.Signature, _ = other.Sign(tombstoneSigningPayload(bogus))
+	if err := applyTombstone(store, bogus); err == nil {
+		t.Error("tombstone from a different provider should be rejected")
+	}
+}
+
+func TestFederatedCatalogOverDHT(t *testing.T) {
+	ctx := context.Background()
+	dht := &mockDHTStore{data: make(map[string][]byte)}
+
+	provider, _ := newProviderService(t, dht)
+	buyerNode, buyerStore := newProviderService(t, dht)
+
+	listing := testListing()
+	if err := provider.CreateListing(ctx, listing); err != nil {
+		t.Fatalf("CreateListing failed: %v", err)
+	}
+	if err := provider.RepublishListings(ctx); err != nil {
+		t.Fatalf("RepublishListings failed: %v", err)
+	}
+
+	// Every record the provider published passes the DHT validator.
+	for key, value := range dht.data {
+		if err := (RecordValidator{}).Validate(key, value); err != nil {
+			t.Errorf("Validate(%s) failed: %v", key, err)
+		}
+	}
+
+	fetched, err := buyerNode.getCatalog().FetchListing(ctx, listing.ListingID)
+	if err != nil {
+		t.Fatalf("FetchListing failed: %v", err)
+	}
+	if fetched.ProviderPeerID != provider.peerID {
+		t.Errorf("ProviderPeerID = %s, want %s", fetched.ProviderPeerID, provider.peerID)
+	}
+	if got, _ := buyerStore.GetListing(listing.ListingID); got == nil || !got.Active {
+		t.Fatal("fetched listing should be indexed on the buyer node")
+	}
+
+	// The provider withdraws the listing; the buyer node picks up the
+	// tombstone on its next DHT sync.
+	if err := provider.RemoveListing(ctx, listing.ListingID); err != nil {
+		t.Fatalf("RemoveListing failed: %v", err)
+	}
+	if _, ok := dht.data[DHTKeyTombstonePrefix+listing.ListingID]; !ok {
+		t.Fatal("tombstone not published to DHT")
+	}
+	if err := buyerNode.IndexListingsFromDHT(ctx); err != nil {
+		t.Fatalf("IndexListingsFromDHT failed: %v", err)
+	}
+	if got, _ := buyerStore.GetListing(listing.ListingID); got.Active {
+		t.Error("withdrawn listing should be inactive on the buyer node")
+	}
+}
+
+func TestRecordValidatorRejectsForgedListing(t *testing.T) {
+	listing := testListing()
+	listing.ListingID = "v-1"
+	signRemoteListing(t, newRemoteProvider(t), listing)
+	data, _ := json.Marshal(listing)
+
+	v := RecordValidator{}
+	if err := v.Validate(DHTKeyListingPrefix+"v-1", data); err != nil {
+		t.Errorf("valid listing rejected: %v", err)
+	}
+	if err := v.Validate(DHTKeyListingPrefix+"other", data); err == nil {
+		t.Error("listing stored under another ID should be rejected")
+	}
+	listing.Title = "Tampered"
+	tampered, _ := json.Marshal(listing)
+	if err := v.Validate(DHTKeyListingPrefix+"v-1", tampered); err == nil {
+		t.Error("tampered listing should be rejected")
+	}
+
+	newer := *listing
+	newer.Version = 2
+	newerData, _ := json.Marshal(&newer)
+	if i, _ := v.Select(DHTKeyListingPrefix+"v-1", [][]byte{data, newerData}); i != 1 {
+		t.Errorf("Select = %d, want 1", i)
+	}
+}
+
+func TestRecordValidatorRejectsForgedIndex(t *testing.T) {
+	ctx := context.Background()
+	dht := &mockDHTStore{data: make(map[string][]byte)}
+	provider, _ := newProviderService(t, dht)
+
+	listing := testListing()
+	listing.DataTypes = []string{"OMM"}
+	if err := provider.CreateListing(ctx, listing); err != nil {
+		t.Fatalf("CreateListing failed: %v", err)
+	}
+	if err := provider.RepublishListings(ctx); err != nil {
+		t.Fatalf("RepublishListings failed: %v", err)
+	}
+
+	v := RecordValidator{}
+	providerKey := DHTKeyProviderPrefix + provider.peerID + "/listings"
+	categoryKey := categoryIndexKey("OMM", provider.peerID)
+	for _, key := range []string{providerKey, categoryKey} {
+		if err := v.Validate(key, dht.data[key]); err != nil {
+			t.Errorf("Validate(%s) failed: %v", key, err)
+		}
+	}
+	if ids, err := provider.getCatalog().FetchCategoryListings(ctx, "omm", provider.peerID); err != nil || len(ids) != 1 {
+		t.Errorf("FetchCategoryListings = %v, %v", ids, err)
+	}
+
+	// Another peer cannot write the provider's index, even signed with its own key.
+	other := newRemoteProvider(t)
+	forged := &ListingIndex{ProviderPeerID: provider.peerID, ListingIDs: []string{"spam"}, UpdatedAt: time.Now()}
+	forged.Signature, _ = other.Sign(listingIndexSigningPayload(providerKey, forged))
+	forgedData, _ := json.Marshal(forged)
+	if err := v.Validate(providerKey, forgedData); err == nil {
+		t.Error("index signed by another peer should be rejected")
+	}
+	unsigned, _ := json.Marshal([]string{"spam"})
+	if err := v.Validate(providerKey, unsigned); err == nil {
+		t.Error("unsigned index should be rejected")
+	}
+
+	// An index cannot be replayed under another key.
+	if err := v.Validate(categoryIndexKey("CAT", provider.peerID), dht.data[categoryKey]); err == nil {
+		t.Error("index replayed under another category should be rejected")
+	}
+
+	older := &ListingIndex{ProviderPeerID: provider.peerID, UpdatedAt: time.Now().Add(-time.Hour)}
+	olderData, _ := json.Marshal(older)
+	if i, _ := v.Select(providerKey, [][]byte{olderData, dht.data[providerKey]}); i != 1 {
+		t.Errorf("Select = %d, want 1", i)
+	}
+}
@@ -0,0 +1,286 @@
+package storefront
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBillingPeriodDays = 30
+	bytesPerGB               = 1_000_000_000
+)
+
+// RecordUsage records one delivery against a grant: a request returning the
+// given number of records and bytes. For metered tiers the usage is also
+// aggregated into the grant's current billing period. Suspended grants are
+// rejected until their outstanding invoices are paid.
+func (s *Service) RecordUsage(ctx context.Context, grantID string, records, bytes uint64) error {
+	grant, err := s.store.GetGrant(grantID)
+	if err != nil {
+		return fmt.Errorf("failed to get grant: %w", err)
+	}
+	if grant == nil {
+		return fmt.Errorf("grant not found: %s", grantID)
+	}
+	if grant.Status == GrantStatusSuspended {
+		return fmt.Errorf("grant suspended for unpaid usage")
+	}
+	if grant.Status != GrantStatusActive {
+		return fmt.Errorf("grant not active: %v", grant.Status)
+	}
+
+	usage := &UsagePeriod{GrantID: grantID, Requests: 1, Records: records, Bytes: bytes}
+
+	listing, err := s.store.GetListing(grant.ListingID)
+	if err != nil {
+		return fmt.Errorf("failed to get listing: %w", err)
+	}
+	if tier := findPricingTierByName(listing, grant.TierName); tier != nil && tier.IsMetered() {
+		usage.PeriodStart, usage.PeriodEnd = billingPeriod(grant.GrantedAt, tier.BillingPeriodDays, time.Now())
+	}
+
+	return s.store.RecordGrantUsage(usage)
+}
+
+// billingPeriod returns the billing period containing t for a grant issued at
+// grantedAt. Periods are consecutive windows of periodDays starting at grant
+// issuance.
+func billingPeriod(grantedAt time.Time, periodDays uint32, t time.Time) (time.Time, time.Time) {
+	if periodDays == 0 {
+		periodDays = defaultBillingPeriodDays
+	}
+	length := time.Duration(periodDays) * 24 * time.Hour
+	if t.Before(grantedAt) {
+		return grantedAt, grantedAt.Add(length)
+	}
+	n := t.Sub(grantedAt) / length
+	start := grantedAt.Add(n * length)
+	return start, start.Add(length)
+}
+
+// meteredCharge returns ceil(units * price / per), saturating at MaxUint64.
+func meteredCharge(units, price, per uint64) uint64 {
+	if units == 0 || price == 0 {
+		return 0
+	}
+	n := new(big.Int).Mul(new(big.Int).SetUint64(units), new(big.Int).SetUint64(price))
+	n.Add(n, new(big.Int).SetUint64(per-1))
+	n.Div(n, new(big.Int).SetUint64(per))
+	if !n.IsUint64() {
+		return math.MaxUint64
+	}
+	return n.Uint64()
+}
+
+func (s *Service) signInvoice(inv *Invoice) []byte {
+	data := fmt.Sprintf("%s:%s:%s:%s:%d:%d:%d:%d:%d:%d",
+		inv.InvoiceID,
+		inv.GrantID,
+		inv.BuyerPeerID,
+		inv.ProviderPeerID,
+		inv.PeriodStart.Unix(),
+		inv.PeriodEnd.Unix(),
+		inv.Records,
+		inv.Bytes,
+		inv.TotalAmount,
+		inv.CreatedAt.Unix(),
+	)
+	return ed25519.Sign(s.signingKey, []byte(data))
+}
+
+// BillingConfig controls the usage billing loop.
+type BillingConfig struct {
+	Interval  time.Duration
+	BatchSize int // maximum usage periods / invoices handled per cycle
+}
+
+// DefaultBillingConfig returns sensible defaults.
+func DefaultBillingConfig() BillingConfig {
+	return BillingConfig{
+		Interval:  time.Hour,
+		BatchSize: 500,
+	}
+}
+
+// BillingRunner turns closed usage periods into signed invoices and settles
+// them from the buyer's SDN credits. When a buyer cannot cover an invoice the
+// grant is suspended; it is reactivated once all its invoices are paid.
+type BillingRunner struct {
+	service *Service
+	cfg     BillingConfig
+}
+
+// NewBillingRunner creates a billing runner for the service.
+func NewBillingRunner(service *Service, cfg BillingConfig) *BillingRunner {
+	def := DefaultBillingConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	return &BillingRunner{service: service, cfg: cfg}
+}
+
+// Run executes billing cycles until ctx is cancelled.
+func (b *BillingRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.RunCycle(ctx, time.Now()); err != nil {
+			log.Warnf("Billing cycle failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunCycle retries outstanding invoices, then invoices every usage period
+// that closed at or before now.
+func (b *BillingRunner) RunCycle(ctx context.Context, now time.Time) error {
+	store := b.service.store
+
+	unpaid, err := store.ListUnpaidInvoices(b.cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, inv := range unpaid {
+		if err := b.settle(inv); err != nil {
+			log.Warnf("Failed to settle invoice %s: %v", inv.InvoiceID, err)
+		}
+	}
+
+	periods, err := store.ListBillableUsage(now, b.cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, usage := range periods {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		inv, err := b.invoice(usage, now)
+		if err != nil {
+			log.Warnf("Failed to invoice grant %s: %v", usage.GrantID, err)
+			continue
+		}
+		if err := b.settle(inv); err != nil {
+			log.Warnf("Failed to settle invoice %s: %v", inv.InvoiceID, err)
+		}
+	}
+	return nil
+}
+
+func (b *BillingRunner) invoice(usage *UsagePeriod, now time.Time) (*Invoice, error) {
+	store := b.service.store
+
+	grant, err := store.GetGrant(usage.GrantID)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, fmt.Errorf("grant not found")
+	}
+	listing, err := store.GetListing(grant.ListingID)
+	if err != nil {
+		return nil, err
+	}
+	tier := findPricingTierByName(listing, grant.TierName)
+	if tier == nil {
+		return nil, fmt.Errorf("tier not found: %s", grant.TierName)
+	}
+
+	inv := &Invoice{
+		InvoiceID:      uuid.New().String(),
+		GrantID:        grant.GrantID,
+		ListingID:      grant.ListingID,
+		TierName:       grant.TierName,
+		BuyerPeerID:    grant.BuyerPeerID,
+		ProviderPeerID: grant.ProviderPeerID,
+		PeriodStart:    usage.PeriodStart,
+		PeriodEnd:      usage.PeriodEnd,
+		Requests:       usage.Requests,
+		Records:        usage.Records,
+		Bytes:          usage.Bytes,
+		RecordsAmount:  meteredCharge(usage.Records, tier.PricePer1KRecords, 1000),
+		BytesAmount:    meteredCharge(usage.Bytes, tier.PricePerGB, bytesPerGB),
+		Status:         InvoiceStatusUnpaid,
+		CreatedAt:      now,
+	}
+	inv.TotalAmount = inv.RecordsAmount + inv.BytesAmount
+	if inv.TotalAmount < inv.RecordsAmount {
+		inv.TotalAmount = math.MaxUint64
+	}
+	if b.service.signingKey != nil {
+		inv.ProviderSignature = b.service.signInvoice(inv)
+	}
+
+	if err := store.CreateInvoice(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// settle deducts an invoice from the buyer's credits, splitting it like a
+// sale of the listing. Insufficient credits suspend the grant rather than fail
+// the cycle.
+func (b *BillingRunner) settle(inv *Invoice) error {
+	store := b.service.store
+
+	if inv.TotalAmount == 0 {
+		return store.MarkInvoicePaid(inv.InvoiceID, "")
+	}
+
+	var splits []RevenueSplit
+	if listing, err := store.GetListing(inv.ListingID); err == nil && listing != nil {
+		splits = listing.RevenueSplits
+	}
+	payouts := ComputePayouts(inv.TotalAmount, inv.ProviderPeerID, splits, b.service.PlatformFee())
+
+	_, err := store.SettleInvoice(inv.InvoiceID, inv.BuyerPeerID, payouts)
+	if errors.Is(err, ErrInsufficientCredits) {
+		return b.suspend(inv, err)
+	}
+	if err != nil && !errors.Is(err, ErrInvoiceSettled) {
+		// ErrInvoiceSettled means another run already charged it.
+		return err
+	}
+
+	return b.reactivateIfSettled(inv.GrantID)
+}
+
+func (b *BillingRunner) suspend(inv *Invoice, cause error) error {
+	store := b.service.store
+
+	grant, err := store.GetGrant(inv.GrantID)
+	if err != nil || grant == nil || grant.Status != GrantStatusActive {
+		return err
+	}
+	log.Infof("Suspending grant %s: invoice %s unpaid (%v)", inv.GrantID, inv.InvoiceID, cause)
+	return store.UpdateGrantStatus(inv.GrantID, GrantStatusSuspended)
+}
+
+func (b *BillingRunner) reactivateIfSettled(grantID string) error {
+	store := b.service.store
+
+	grant, err := store.GetGrant(grantID)
+	if err != nil || grant == nil || grant.Status != GrantStatusSuspended {
+		return err
+	}
+	outstanding, err := store.CountUnpaidInvoices(grantID)
+	if err != nil || outstanding > 0 {
+		return err
+	}
+	log.Infof("Reactivating grant %s: usage invoices settled", grantID)
+	return store.UpdateGrantStatus(grantID, GrantStatusActive)
+}
@@ -0,0 +1,201 @@
+package storefront
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func meteredListing() *Listing {
+	listing := testListing()
+	listing.AccessType = AccessTypeQuery
+	listing.Pricing = []PricingTier{
+		{
+			Name:              "Metered",
+			PriceCurrency:     "SDN",
+			PricePer1KRecords: 10,
+			PricePerGB:        500,
+			BillingPeriodDays: 1,
+		},
+	}
+	return listing
+}
+
+func issueMeteredGrant(t *testing.T, svc *Service, buyer string) *AccessGrant {
+	t.Helper()
+	ctx := context.Background()
+
+	listing := meteredListing()
+	if err := svc.CreateListing(ctx, listing); err != nil {
+		t.Fatalf("CreateListing failed: %v", err)
+	}
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "Metered", BuyerPeerID: buyer, PaymentMethod: PaymentMethodSDNCredits}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+	grant, err := svc.IssueGrant(ctx, req.RequestID)
+	if err != nil {
+		t.Fatalf("IssueGrant failed: %v", err)
+	}
+	return grant
+}
+
+func TestMeteredCharge(t *testing.T) {
+	tests := []struct {
+		units, price, per, want uint64
+	}{
+		{0, 10, 1000, 0},
+		{1000, 10, 1000, 10},
+		{1001, 10, 1000, 11},
+		{1, 10, 1000, 1},
+		{2_500_000_000, 500, bytesPerGB, 1250},
+	}
+	for _, tt := range tests {
+		if got := meteredCharge(tt.units, tt.price, tt.per); got != tt.want {
+			t.Errorf("meteredCharge(%d, %d, %d) = %d, want %d", tt.units, tt.price, tt.per, got, tt.want)
+		}
+	}
+}
+
+func TestBillingPeriod(t *testing.T) {
+	granted := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	start, end := billingPeriod(granted, 30, granted.Add(45*24*time.Hour))
+	if !start.Equal(granted.Add(30 * 24 * time.Hour)) {
+		t.Errorf("start = %v", start)
+	}
+	if !end.Equal(granted.Add(60 * 24 * time.Hour)) {
+		t.Errorf("end = %v", end)
+	}
+}
+
+func TestUsageBillingDeductsCredits(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	grant := issueMeteredGrant(t, svc, "metered-buyer")
+
+	store.UpdateCreditsBalance("metered-buyer", 1000)
+
+	if err := svc.RecordUsage(ctx, grant.GrantID, 1500, 1_000_000_000); err != nil {
+		t.Fatalf("RecordUsage failed: %v", err)
+	}
+	if err := svc.RecordUsage(ctx, grant.GrantID, 500, 0); err != nil {
+		t.Fatalf("RecordUsage failed: %v", err)
+	}
+
+	updated, _ := store.GetGrant(grant.GrantID)
+	if updated.TotalRequests != 2 || updated.TotalRecords != 2000 || updated.TotalBytes != 1_000_000_000 {
+		t.Errorf("totals = %d/%d/%d", updated.TotalRequests, updated.TotalRecords, updated.TotalBytes)
+	}
+
+	// Nothing is billable until the period closes.
+	runner := NewBillingRunner(svc, DefaultBillingConfig())
+	runner.RunCycle(ctx, time.Now())
+	if invoices, _ := store.GetInvoicesByPeer("metered-buyer", 10, 0); len(invoices) != 0 {
+		t.Fatalf("got %d invoices before period end", len(invoices))
+	}
+
+	runner.RunCycle(ctx, time.Now().Add(48*time.Hour))
+	invoices, err := store.GetInvoicesByPeer("metered-buyer", 10, 0)
+	if err != nil || len(invoices) != 1 {
+		t.Fatalf("GetInvoicesByPeer = %d, %v; want 1 invoice", len(invoices), err)
+	}
+	inv := invoices[0]
+	if inv.RecordsAmount != 20 || inv.BytesAmount != 500 || inv.TotalAmount != 520 {
+		t.Errorf("amounts = %d + %d = %d, want 20 + 500 = 520", inv.RecordsAmount, inv.BytesAmount, inv.TotalAmount)
+	}
+	if inv.Status != InvoiceStatusPaid || inv.CreditsTransactionID == "" {
+		t.Errorf("invoice status = %d tx = %q, want paid", inv.Status, inv.CreditsTransactionID)
+	}
+
+	data := fmt.Sprintf("%s:%s:%s:%s:%d:%d:%d:%d:%d:%d", inv.InvoiceID, inv.GrantID, inv.BuyerPeerID,
+		inv.ProviderPeerID, inv.PeriodStart.Unix(), inv.PeriodEnd.Unix(), inv.Records, inv.Bytes,
+		inv.TotalAmount, inv.CreatedAt.Unix())
+	pub := svc.signingKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(pub, []byte(data), inv.ProviderSignature) {
+		t.Error("invoice signature does not verify")
+	}
+
+	buyer, _ := store.GetCreditsBalance("metered-buyer")
+	if buyer.Balance != 480 {
+		t.Errorf("buyer balance = %d, want 480", buyer.Balance)
+	}
+	provider, _ := store.GetCreditsBalance(grant.ProviderPeerID)
+	if provider.Balance != 520 {
+		t.Errorf("provider balance = %d, want 520", provider.Balance)
+	}
+
+	// Settling an invoice again charges nothing.
+	if _, err := store.SettleInvoice(inv.InvoiceID, "metered-buyer", []Payout{{PeerID: grant.ProviderPeerID, Amount: 520}}); !errors.Is(err, ErrInvoiceSettled) {
+		t.Errorf("SettleInvoice of a paid invoice = %v, want %v", err, ErrInvoiceSettled)
+	}
+	if err := runner.settle(inv); err != nil {
+		t.Errorf("settle of a paid invoice failed: %v", err)
+	}
+	if buyer, _ := store.GetCreditsBalance("metered-buyer"); buyer.Balance != 480 {
+		t.Errorf("buyer balance after resettling = %d, want 480", buyer.Balance)
+	}
+
+	// A second cycle must not bill the same period again.
+	runner.RunCycle(ctx, time.Now().Add(48*time.Hour))
+	if invoices, _ := store.GetInvoicesByPeer("metered-buyer", 10, 0); len(invoices) != 1 {
+		t.Errorf("got %d invoices after second cycle, want 1", len(invoices))
+	}
+}
+
+func TestUsageBillingOverdraftSuspends(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	grant := issueMeteredGrant(t, svc, "broke-buyer")
+
+	svc.RecordUsage(ctx, grant.GrantID, 10_000, 0) // 100 credits
+
+	runner := NewBillingRunner(svc, DefaultBillingConfig())
+	runner.RunCycle(ctx, time.Now().Add(48*time.Hour))
+
+	suspended, _ := store.GetGrant(grant.GrantID)
+	if suspended.Status != GrantStatusSuspended {
+		t.Fatalf("Status = %d, want Suspended", suspended.Status)
+	}
+	if err := svc.RecordUsage(ctx, grant.GrantID, 1, 0); err == nil {
+		t.Error("usage on a suspended grant should be rejected")
+	}
+
+	// Topping up settles the invoice and reactivates the grant.
+	store.UpdateCreditsBalance("broke-buyer", 100)
+	runner.RunCycle(ctx, time.Now().Add(48*time.Hour))
+
+	active, _ := store.GetGrant(grant.GrantID)
+	if active.Status != GrantStatusActive {
+		t.Errorf("Status = %d, want Active after settlement", active.Status)
+	}
+	if n, _ := store.CountUnpaidInvoices(grant.GrantID); n != 0 {
+		t.Errorf("unpaid invoices = %d, want 0", n)
+	}
+}
+
+func TestDeliveryMetersUsage(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	grant := issueMeteredGrant(t, svc, "delivered-buyer")
+
+	delivery := NewDeliveryService(DefaultDeliveryConfig(), nil)
+	delivery.SetUsageMeter(svc)
+	req := &DeliveryRequest{GrantID: grant.GrantID, BuyerPeerID: "delivered-buyer", Method: DeliveryDirectTransfer, Data: make([]byte, 2048), Records: 20}
+	if _, err := delivery.Deliver(ctx, req); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	updated, _ := store.GetGrant(grant.GrantID)
+	if updated.TotalRequests != 1 || updated.TotalRecords != 20 || updated.TotalBytes != 2048 {
+		t.Errorf("totals = %d/%d/%d, want 1/20/2048", updated.TotalRequests, updated.TotalRecords, updated.TotalBytes)
+	}
+
+	// Suspended grants receive nothing.
+	svc.RecordUsage(ctx, grant.GrantID, 10_000, 0)
+	NewBillingRunner(svc, DefaultBillingConfig()).RunCycle(ctx, time.Now().Add(48*time.Hour))
+	if _, err := delivery.Deliver(ctx, req); err == nil {
+		t.Error("delivery to a suspended grant should be refused")
+	}
+}
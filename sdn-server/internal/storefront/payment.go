@@ -23,6 +23,7 @@ type PaymentProcessor struct {
 	store          *Store
 	peerID         string
 	chainVerifiers map[string]ChainVerifier
+	platformFee    PlatformFee
 }
 
 // NewPaymentProcessor creates a new payment processor.
@@ -39,6 +40,24 @@ func NewPaymentProcessor(store *Store, peerID string, verifiers ...ChainVerifier
 	return pp
 }
 
+// SetPlatformFee configures the share of every credits sale routed to the
+// hosting node operator.
+func (pp *PaymentProcessor) SetPlatformFee(fee PlatformFee) {
+	pp.platformFee = fee
+}
+
+// payoutsFor splits a sale of the purchase's listing between the provider,
+// the platform and the listing's revenue-split payees.
+func (pp *PaymentProcessor) payoutsFor(requestID string, amount uint64, providerPeerID string) []Payout {
+	var splits []RevenueSplit
+	if purchase, err := pp.store.GetPurchaseRequest(requestID); err == nil && purchase != nil {
+		if listing, err := pp.store.GetListing(purchase.ListingID); err == nil && listing != nil {
+			splits = listing.RevenueSplits
+		}
+	}
+	return ComputePayouts(amount, providerPeerID, splits, pp.platformFee)
+}
+
 const (
 	stripeCheckoutSessionsURL = "https://api.stripe.com/v1/checkout/sessions"
 	stripeSigTolerance        = 5 * time.Minute
@@ -88,44 +107,22 @@ func (pp *PaymentProcessor) VerifyCryptoPayment(ctx context.Context, req *Crypto
 	return verifier.VerifyTransaction(ctx, req)
 }
 
-// ProcessCredits processes a payment using SDN credits atomically.
+// ProcessCredits processes a payment using SDN credits atomically. The amount
+// is split between the provider, the platform fee and any revenue splits on
+// the listing in a single store transaction.
 func (pp *PaymentProcessor) ProcessCredits(ctx context.Context, requestID string, buyerPeerID string, amount uint64, providerPeerID string) error {
-	txID := uuid.New().String()
+	payouts := pp.payoutsFor(requestID, amount, providerPeerID)
 
-	// Use atomic deduction to prevent double-spend race conditions.
-	// AtomicDeductCredits checks balance >= amount and deducts in a single SQL statement.
-	if err := pp.store.AtomicDeductCredits(buyerPeerID, amount); err != nil {
+	txs, err := pp.store.TransferCredits(buyerPeerID, payouts, "purchase", requestID)
+	if err != nil {
 		return fmt.Errorf("failed to deduct credits: %w", err)
 	}
 
-	// Create transaction record
-	tx := &CreditsTransaction{
-		TransactionID: txID,
-		FromPeerID:    buyerPeerID,
-		ToPeerID:      providerPeerID,
-		Amount:        amount,
-		Type:          "purchase",
-		Reference:     requestID,
-		CreatedAt:     time.Now(),
-		Status:        "completed",
+	// Update purchase with the provider leg's credits tx ID
+	if len(txs) > 0 {
+		pp.store.UpdatePurchaseCreditsTransaction(requestID, txs[0].TransactionID)
 	}
 
-	if err := pp.store.CreateCreditsTransaction(tx); err != nil {
-		// Refund on failure
-		pp.store.UpdateCreditsBalance(buyerPeerID, int64(amount))
-		return fmt.Errorf("failed to create credits transaction: %w", err)
-	}
-
-	// Credit to provider
-	if err := pp.store.UpdateCreditsBalance(providerPeerID, int64(amount)); err != nil {
-		// Refund buyer on failure
-		pp.store.UpdateCreditsBalance(buyerPeerID, int64(amount))
-		return fmt.Errorf("failed to credit provider: %w", err)
-	}
-
-	// Update purchase with credits tx ID
-	pp.store.UpdatePurchaseCreditsTransaction(requestID, txID)
-
 	return nil
 }
 
@@ -352,6 +349,12 @@ func (pp *PaymentProcessor) CreateFiatPaymentIntent(ctx context.Context, req *Fi
 
 // RefundCredits processes a credits refund
 func (pp *PaymentProcessor) RefundCredits(ctx context.Context, requestID string, buyerPeerID string, amount uint64, providerPeerID string) error {
+	// A full refund of a split sale claws back each leg from its payee.
+	legs, payer, err := pp.store.GetTransferLegs(requestID, "purchase")
+	if err == nil && len(legs) > 1 && payer == buyerPeerID && sumPayouts(legs) == amount {
+		return pp.refundLegs(requestID, buyerPeerID, legs)
+	}
+
 	txID := uuid.New().String()
 	tx := &CreditsTransaction{
 		TransactionID: txID,
@@ -382,6 +385,21 @@ func (pp *PaymentProcessor) RefundCredits(ctx context.Context, requestID string,
 	return nil
 }
 
+func (pp *PaymentProcessor) refundLegs(requestID, buyerPeerID string, legs []Payout) error {
+	if _, err := pp.store.RefundTransfer(buyerPeerID, legs, requestID); err != nil {
+		return fmt.Errorf("failed to refund split payment: %w", err)
+	}
+	return nil
+}
+
+func sumPayouts(payouts []Payout) uint64 {
+	var total uint64
+	for _, p := range payouts {
+		total += p.Amount
+	}
+	return total
+}
+
 // HandleStripeWebhook validates and interprets a Stripe webhook payload.
 func (pp *PaymentProcessor) HandleStripeWebhook(ctx context.Context, signatureHeader string, payload []byte) (*StripeWebhookAction, error) {
 	_ = ctx
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"net/http"
 	"strings"
 	"time"
@@ -20,6 +22,25 @@ type ChainVerifier interface {
 	Chain() string
 }
 
+// DepositWatcher is implemented by chain verifiers that can inspect the balance
+// of a receive address directly. It lets the payment watcher detect purchases
+// that were paid to a per-purchase deposit address without the buyer
+// submitting a transaction hash.
+type DepositWatcher interface {
+	Chain() string
+
+	// CheckDeposit reports the amount received at address, in the chain's
+	// base unit (wei, lamports or satoshis).
+	CheckDeposit(ctx context.Context, address string) (*DepositStatus, error)
+}
+
+// DepositStatus describes funds observed at a deposit address.
+type DepositStatus struct {
+	Received  uint64 // total seen, including unconfirmed/low-confirmation funds
+	Confirmed uint64 // amount with the verifier's required confirmations
+	Block     uint64 // chain height (block or slot) at which the check ran
+}
+
 // ChainConfig holds RPC endpoint and confirmation settings for one blockchain.
 type ChainConfig struct {
 	RPCURL                string
@@ -178,6 +199,61 @@ func (v *EthereumVerifier) VerifyTransaction(ctx context.Context, req *CryptoPay
 	return &CryptoPaymentResult{Verified: true, ConfirmationBlock: txBlock}, nil
 }
 
+// CheckDeposit compares the address balance at the chain head with the balance
+// RequiredConfirmations blocks back.
+func (v *EthereumVerifier) CheckDeposit(ctx context.Context, address string) (*DepositStatus, error) {
+	if v.rpcURL == "" {
+		return nil, fmt.Errorf("ethereum RPC URL not configured")
+	}
+
+	blockRaw, err := rpcCall(ctx, v.client, v.rpcURL, "eth_blockNumber", []interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("eth_blockNumber: %w", err)
+	}
+	var blockHex string
+	if err := json.Unmarshal(blockRaw, &blockHex); err != nil {
+		return nil, fmt.Errorf("invalid block number response: %w", err)
+	}
+	head, err := parseHexUint64(blockHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current block: %w", err)
+	}
+
+	received, err := v.balanceAt(ctx, address, "latest")
+	if err != nil {
+		return nil, err
+	}
+	status := &DepositStatus{Received: received, Block: head}
+	if head < v.confirmations {
+		return status, nil
+	}
+
+	status.Confirmed, err = v.balanceAt(ctx, address, fmt.Sprintf("0x%x", head-v.confirmations))
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (v *EthereumVerifier) balanceAt(ctx context.Context, address, block string) (uint64, error) {
+	raw, err := rpcCall(ctx, v.client, v.rpcURL, "eth_getBalance", []interface{}{address, block})
+	if err != nil {
+		return 0, fmt.Errorf("eth_getBalance: %w", err)
+	}
+	var balHex string
+	if err := json.Unmarshal(raw, &balHex); err != nil {
+		return 0, fmt.Errorf("invalid balance response: %w", err)
+	}
+	wei, ok := new(big.Int).SetString(strings.TrimPrefix(strings.TrimPrefix(balHex, "0x"), "0X"), 16)
+	if !ok {
+		return 0, fmt.Errorf("invalid balance %q", balHex)
+	}
+	if !wei.IsUint64() {
+		return math.MaxUint64, nil
+	}
+	return wei.Uint64(), nil
+}
+
 // --- Solana ---
 
 // SolanaVerifier verifies Solana transactions via JSON-RPC (getTransaction).
@@ -232,6 +308,42 @@ func (v *SolanaVerifier) VerifyTransaction(ctx context.Context, req *CryptoPayme
 	return &CryptoPaymentResult{Verified: true, ConfirmationBlock: tx.Slot}, nil
 }
 
+// CheckDeposit reads the address balance at "confirmed" and "finalized"
+// commitment; only finalized lamports count as confirmed.
+func (v *SolanaVerifier) CheckDeposit(ctx context.Context, address string) (*DepositStatus, error) {
+	if v.rpcURL == "" {
+		return nil, fmt.Errorf("solana RPC URL not configured")
+	}
+
+	received, slot, err := v.balance(ctx, address, "confirmed")
+	if err != nil {
+		return nil, err
+	}
+	confirmed, _, err := v.balance(ctx, address, "finalized")
+	if err != nil {
+		return nil, err
+	}
+	return &DepositStatus{Received: received, Confirmed: confirmed, Block: slot}, nil
+}
+
+func (v *SolanaVerifier) balance(ctx context.Context, address, commitment string) (uint64, uint64, error) {
+	params := []interface{}{address, map[string]interface{}{"commitment": commitment}}
+	raw, err := rpcCall(ctx, v.client, v.rpcURL, "getBalance", params)
+	if err != nil {
+		return 0, 0, fmt.Errorf("getBalance: %w", err)
+	}
+	var res struct {
+		Context struct {
+			Slot uint64 `json:"slot"`
+		} `json:"context"`
+		Value uint64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return 0, 0, fmt.Errorf("parse balance: %w", err)
+	}
+	return res.Value, res.Context.Slot, nil
+}
+
 // --- Bitcoin ---
 
 // BitcoinVerifier verifies Bitcoin transactions via JSON-RPC (getrawtransaction).
@@ -286,3 +398,37 @@ func (v *BitcoinVerifier) VerifyTransaction(ctx context.Context, req *CryptoPaym
 
 	return &CryptoPaymentResult{Verified: true, ConfirmationBlock: tx.Confirmations}, nil
 }
+
+// CheckDeposit scans the UTXO set for outputs paying address
+// (scantxoutset). Outputs with fewer than the required confirmations count
+// towards Received only.
+func (v *BitcoinVerifier) CheckDeposit(ctx context.Context, address string) (*DepositStatus, error) {
+	if v.rpcURL == "" {
+		return nil, fmt.Errorf("bitcoin RPC URL not configured")
+	}
+
+	raw, err := rpcCall(ctx, v.client, v.rpcURL, "scantxoutset", []interface{}{"start", []string{"addr(" + address + ")"}})
+	if err != nil {
+		return nil, fmt.Errorf("scantxoutset: %w", err)
+	}
+	var res struct {
+		Height   uint64 `json:"height"`
+		Unspents []struct {
+			Amount float64 `json:"amount"`
+			Height uint64  `json:"height"`
+		} `json:"unspents"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, fmt.Errorf("parse scantxoutset: %w", err)
+	}
+
+	status := &DepositStatus{Block: res.Height}
+	for _, u := range res.Unspents {
+		sats := uint64(math.Round(u.Amount * 1e8))
+		status.Received += sats
+		if u.Height > 0 && u.Height <= res.Height && res.Height-u.Height+1 >= v.confirmations {
+			status.Confirmed += sats
+		}
+	}
+	return status, nil
+}
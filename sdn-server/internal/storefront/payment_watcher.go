@@ -0,0 +1,159 @@
+package storefront
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PaymentWatcherConfig controls how often open purchases are checked on chain.
+type PaymentWatcherConfig struct {
+	PollInterval time.Duration
+	BatchSize    int // maximum purchases inspected per poll
+
+	// LateDepositWindow is how long after its deadline an expired purchase's
+	// deposit address is still watched. A deposit that confirms in that
+	// window completes the purchase.
+	LateDepositWindow time.Duration
+}
+
+// DefaultPaymentWatcherConfig returns sensible defaults.
+func DefaultPaymentWatcherConfig() PaymentWatcherConfig {
+	return PaymentWatcherConfig{
+		PollInterval:      30 * time.Second,
+		BatchSize:         200,
+		LateDepositWindow: 7 * 24 * time.Hour,
+	}
+}
+
+// PaymentWatcher polls the deposit addresses of open crypto purchases and
+// completes them once enough confirmed funds arrive, so buyers do not need to
+// submit a transaction hash.
+//
+// Only purchases priced in the chain's native coin are watched, and amounts
+// are compared in its base unit: PaymentAmount is wei, lamports or satoshis.
+// Purchases priced in any other currency must be paid by tx hash.
+type PaymentWatcher struct {
+	service  *Service
+	cfg      PaymentWatcherConfig
+	watchers map[string]DepositWatcher // chain -> watcher
+}
+
+// NewPaymentWatcher creates a watcher over the given verifiers. Verifiers that
+// cannot inspect address balances are ignored.
+func NewPaymentWatcher(service *Service, cfg PaymentWatcherConfig, verifiers ...ChainVerifier) *PaymentWatcher {
+	def := DefaultPaymentWatcherConfig()
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.LateDepositWindow <= 0 {
+		cfg.LateDepositWindow = def.LateDepositWindow
+	}
+
+	w := &PaymentWatcher{
+		service:  service,
+		cfg:      cfg,
+		watchers: make(map[string]DepositWatcher),
+	}
+	for _, v := range verifiers {
+		if dw, ok := v.(DepositWatcher); ok {
+			w.watchers[dw.Chain()] = dw
+		}
+	}
+	return w
+}
+
+// Run polls until ctx is cancelled.
+func (w *PaymentWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			log.Warnf("Payment watcher poll failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll performs a single pass over open purchases.
+func (w *PaymentWatcher) Poll(ctx context.Context) error {
+	now := time.Now()
+	purchases, err := w.service.store.ListOpenCryptoPurchases(w.cfg.BatchSize, now.Add(-w.cfg.LateDepositWindow))
+	if err != nil {
+		return err
+	}
+
+	for _, req := range purchases {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := w.check(ctx, req, now); err != nil {
+			log.Warnf("Payment watcher: purchase %s: %v", req.RequestID, err)
+		}
+	}
+	return nil
+}
+
+func (w *PaymentWatcher) check(ctx context.Context, req *PurchaseRequest, now time.Time) error {
+	store := w.service.store
+
+	if req.DepositAddress == "" {
+		// Legacy purchase paid by tx hash; only handle expiry.
+		return w.expireIfOverdue(req, now)
+	}
+	watcher, ok := w.watchers[req.PaymentChain]
+	if !ok || !pricedInNativeCoin(req.PaymentChain, req.PaymentCurrency) {
+		return w.expireIfOverdue(req, now)
+	}
+
+	status, err := watcher.CheckDeposit(ctx, req.DepositAddress)
+	if err != nil {
+		return fmt.Errorf("check deposit: %w", err)
+	}
+
+	if status.Confirmed >= req.PaymentAmount {
+		if err := store.UpdatePurchaseConfirmation(req.RequestID, status.Block); err != nil {
+			return err
+		}
+		log.Infof("Deposit confirmed for purchase %s at %s", req.RequestID, req.DepositAddress)
+		err := w.service.ProcessPayment(ctx, req.RequestID, req.PaymentTxHash, req.PaymentChain)
+		if errors.Is(err, ErrPaymentAlreadyProcessed) {
+			// Completed through the confirm API in the meantime.
+			return nil
+		}
+		return err
+	}
+	if req.Status == PurchaseStatusExpired {
+		// Expired purchases are only watched for a late confirmed deposit.
+		return nil
+	}
+
+	if status.Received >= req.PaymentAmount && req.Status == PurchaseStatusPending {
+		msg := fmt.Sprintf("Deposit detected at %s, awaiting confirmations", req.DepositAddress)
+		_, err := store.TransitionPurchaseStatus(req.RequestID, PurchaseStatusPaymentDetected, msg, PurchaseStatusPending)
+		return err
+	}
+
+	return w.expireIfOverdue(req, now)
+}
+
+// expireIfOverdue marks a purchase expired when no payment has been detected
+// or submitted before its deadline. Purchases with detected funds are left to
+// confirm.
+func (w *PaymentWatcher) expireIfOverdue(req *PurchaseRequest, now time.Time) error {
+	if req.Status != PurchaseStatusPending || req.PaymentTxHash != "" || now.Before(req.PaymentDeadline) {
+		return nil
+	}
+	// Conditional, so a payment confirmed since the poll is not overwritten.
+	_, err := w.service.store.TransitionPurchaseStatus(req.RequestID, PurchaseStatusExpired, "Payment deadline passed", PurchaseStatusPending)
+	return err
+}
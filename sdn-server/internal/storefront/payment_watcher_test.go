@@ -0,0 +1,313 @@
+package storefront
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeDepositDeriver struct{}
+
+func (fakeDepositDeriver) DeriveDepositAddress(ctx context.Context, chain string, index uint32) (string, error) {
+	return fmt.Sprintf("%s-deposit-%d", chain, index), nil
+}
+
+// fakeEthNode serves eth_blockNumber and eth_getBalance. Balances at "latest"
+// and at older blocks are configured independently to model confirmations.
+type fakeEthNode struct {
+	mu        sync.Mutex
+	head      uint64
+	latest    uint64
+	confirmed uint64
+}
+
+func (f *fakeEthNode) set(latest, confirmed uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latest, f.confirmed = latest, confirmed
+}
+
+func (f *fakeEthNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result string
+	switch req.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("0x%x", f.head)
+	case "eth_getBalance":
+		if req.Params[1] == "latest" {
+			result = fmt.Sprintf("0x%x", f.latest)
+		} else {
+			result = fmt.Sprintf("0x%x", f.confirmed)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+// nativeCoinListing returns the test listing with tiers priced in ETH (wei)
+// and BTC (satoshis).
+func nativeCoinListing() *Listing {
+	listing := testListing()
+	listing.Pricing = append(listing.Pricing,
+		PricingTier{Name: "ETH", PriceAmount: 50_000_000_000_000_000, PriceCurrency: "ETH", DurationDays: 30},
+		PricingTier{Name: "BTC", PriceAmount: 150_000, PriceCurrency: "BTC", DurationDays: 30},
+	)
+	return listing
+}
+
+func TestCreatePurchaseAssignsDepositAddress(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.SetDepositAddressDeriver(fakeDepositDeriver{})
+	ctx := context.Background()
+
+	listing := nativeCoinListing()
+	svc.CreateListing(ctx, listing)
+
+	first := &PurchaseRequest{ListingID: listing.ListingID, TierName: "ETH", PaymentMethod: PaymentMethodCryptoETH}
+	second := &PurchaseRequest{ListingID: listing.ListingID, TierName: "BTC", PaymentMethod: PaymentMethodCryptoBTC}
+	credits := &PurchaseRequest{ListingID: listing.ListingID, TierName: "Basic", PaymentMethod: PaymentMethodSDNCredits}
+	usd := &PurchaseRequest{ListingID: listing.ListingID, TierName: "Basic", PaymentMethod: PaymentMethodCryptoETH}
+	mismatched := &PurchaseRequest{ListingID: listing.ListingID, TierName: "BTC", PaymentMethod: PaymentMethodCryptoETH}
+	for _, req := range []*PurchaseRequest{first, second, credits, usd, mismatched} {
+		if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+			t.Fatalf("CreatePurchaseRequest failed: %v", err)
+		}
+	}
+
+	if first.DepositAddress != "ethereum-deposit-1" || first.PaymentChain != "ethereum" {
+		t.Errorf("first deposit = %q on %q", first.DepositAddress, first.PaymentChain)
+	}
+	if second.DepositAddress != "bitcoin-deposit-2" || second.DepositIndex != 2 {
+		t.Errorf("second deposit = %q index %d", second.DepositAddress, second.DepositIndex)
+	}
+	if credits.DepositAddress != "" {
+		t.Errorf("credits purchase should not get a deposit address, got %q", credits.DepositAddress)
+	}
+	// A USD price cannot be compared with a wei balance, nor BTC with ETH.
+	if usd.DepositAddress != "" || mismatched.DepositAddress != "" {
+		t.Errorf("purchases not priced in the chain's coin got deposit addresses %q, %q", usd.DepositAddress, mismatched.DepositAddress)
+	}
+
+	stored, err := store.GetPurchaseRequest(first.RequestID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetPurchaseRequest failed: %v", err)
+	}
+	if stored.DepositAddress != first.DepositAddress || stored.DepositIndex != 1 {
+		t.Errorf("stored deposit = %q index %d", stored.DepositAddress, stored.DepositIndex)
+	}
+}
+
+func TestPaymentWatcherCompletesDeposit(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.SetDepositAddressDeriver(fakeDepositDeriver{})
+	ctx := context.Background()
+
+	node := &fakeEthNode{head: 100}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	watcher := NewPaymentWatcher(svc, DefaultPaymentWatcherConfig(),
+		NewEthereumVerifier(ChainConfig{RPCURL: srv.URL, RequiredConfirmations: 12}),
+		&mockChainVerifier{chain: "solana"},
+	)
+
+	listing := nativeCoinListing()
+	svc.CreateListing(ctx, listing)
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "ETH", BuyerPeerID: "buyer", PaymentMethod: PaymentMethodCryptoETH}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+
+	status := func() PurchaseStatus {
+		t.Helper()
+		p, err := store.GetPurchaseRequest(req.RequestID)
+		if err != nil || p == nil {
+			t.Fatalf("GetPurchaseRequest failed: %v", err)
+		}
+		return p.Status
+	}
+
+	// Nothing paid yet.
+	if err := watcher.Poll(ctx); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if s := status(); s != PurchaseStatusPending {
+		t.Fatalf("Status = %d, want Pending", s)
+	}
+
+	// A dust deposit does not pay for the purchase.
+	node.set(4900, 4900)
+	watcher.Poll(ctx)
+	if s := status(); s != PurchaseStatusPending {
+		t.Fatalf("Status after underpayment = %d, want Pending", s)
+	}
+
+	// Funds seen but not yet confirmed.
+	node.set(req.PaymentAmount, 0)
+	watcher.Poll(ctx)
+	if s := status(); s != PurchaseStatusPaymentDetected {
+		t.Fatalf("Status = %d, want PaymentDetected", s)
+	}
+
+	// Funds confirmed.
+	node.set(req.PaymentAmount, req.PaymentAmount)
+	watcher.Poll(ctx)
+	p, _ := store.GetPurchaseRequest(req.RequestID)
+	if p.Status != PurchaseStatusCompleted {
+		t.Fatalf("Status = %d, want Completed", p.Status)
+	}
+	if p.ConfirmationBlock != 100 {
+		t.Errorf("ConfirmationBlock = %d, want 100", p.ConfirmationBlock)
+	}
+	if p.GrantID == "" {
+		t.Error("grant should be issued")
+	}
+}
+
+func TestPaymentWatcherExpiresOverdue(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+
+	req := &PurchaseRequest{
+		RequestID:       "overdue",
+		ListingID:       "listing",
+		PaymentMethod:   PaymentMethodCryptoETH,
+		PaymentAmount:   1,
+		Status:          PurchaseStatusPending,
+		CreatedAt:       time.Now().Add(-time.Hour),
+		UpdatedAt:       time.Now().Add(-time.Hour),
+		PaymentDeadline: time.Now().Add(-time.Minute),
+	}
+	if err := store.CreatePurchaseRequest(req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+
+	if err := NewPaymentWatcher(svc, DefaultPaymentWatcherConfig()).Poll(ctx); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	p, _ := store.GetPurchaseRequest(req.RequestID)
+	if p.Status != PurchaseStatusExpired {
+		t.Errorf("Status = %d, want Expired", p.Status)
+	}
+}
+
+func TestProcessPaymentGrantsOnce(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+
+	listing := nativeCoinListing()
+	svc.CreateListing(ctx, listing)
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "ETH", BuyerPeerID: "buyer", PaymentMethod: PaymentMethodCryptoETH}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+
+	// The watcher and the confirm API race on the same purchase.
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = svc.ProcessPayment(ctx, req.RequestID, "0xabc", "ethereum")
+		}(i)
+	}
+	wg.Wait()
+
+	granted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			granted++
+		case !errors.Is(err, ErrPaymentAlreadyProcessed):
+			t.Errorf("ProcessPayment failed: %v", err)
+		}
+	}
+	if granted != 1 {
+		t.Errorf("%d calls granted, want 1", granted)
+	}
+	if grants, _ := store.GetGrantsByBuyer("buyer"); len(grants) != 1 {
+		t.Errorf("%d grants issued, want 1", len(grants))
+	}
+	p, _ := store.GetPurchaseRequest(req.RequestID)
+	if p.Status != PurchaseStatusCompleted || p.GrantID == "" {
+		t.Errorf("purchase = status %d grant %q, want completed with a grant", p.Status, p.GrantID)
+	}
+}
+
+func TestPaymentWatcherCompletesLateDeposit(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.SetDepositAddressDeriver(fakeDepositDeriver{})
+	ctx := context.Background()
+
+	node := &fakeEthNode{head: 100}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+	watcher := NewPaymentWatcher(svc, DefaultPaymentWatcherConfig(),
+		NewEthereumVerifier(ChainConfig{RPCURL: srv.URL, RequiredConfirmations: 12}))
+
+	listing := nativeCoinListing()
+	svc.CreateListing(ctx, listing)
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "ETH", BuyerPeerID: "buyer", PaymentMethod: PaymentMethodCryptoETH}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+
+	// Past the deadline with nothing paid, the purchase expires.
+	if err := watcher.check(ctx, req, req.PaymentDeadline.Add(time.Minute)); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	p, _ := store.GetPurchaseRequest(req.RequestID)
+	if p.Status != PurchaseStatusExpired {
+		t.Fatalf("Status = %d, want Expired", p.Status)
+	}
+
+	// Unconfirmed funds leave it expired; confirmed funds complete it.
+	node.set(req.PaymentAmount, 0)
+	watcher.Poll(ctx)
+	if p, _ := store.GetPurchaseRequest(req.RequestID); p.Status != PurchaseStatusExpired {
+		t.Fatalf("Status with unconfirmed late deposit = %d, want Expired", p.Status)
+	}
+	node.set(req.PaymentAmount, req.PaymentAmount)
+	if err := watcher.Poll(ctx); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	p, _ = store.GetPurchaseRequest(req.RequestID)
+	if p.Status != PurchaseStatusCompleted || p.GrantID == "" {
+		t.Errorf("purchase = status %d grant %q, want completed with a grant", p.Status, p.GrantID)
+	}
+}
+
+func TestBitcoinCheckDeposit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"height":110,"unspents":[
+			{"amount":0.001,"height":100},
+			{"amount":0.0005,"height":108}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	v := NewBitcoinVerifier(ChainConfig{RPCURL: srv.URL, RequiredConfirmations: 6})
+	status, err := v.CheckDeposit(context.Background(), "bc1qtest")
+	if err != nil {
+		t.Fatalf("CheckDeposit failed: %v", err)
+	}
+	if status.Received != 150000 {
+		t.Errorf("Received = %d, want 150000", status.Received)
+	}
+	if status.Confirmed != 100000 {
+		t.Errorf("Confirmed = %d, want 100000", status.Confirmed)
+	}
+}
@@ -0,0 +1,392 @@
+package storefront
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Delivered records are bound to their grant in two ways, chosen per listing:
+//
+//	envelope:  "SDNP" | uint32 header length | header JSON | record
+//	watermark: record | "SDNW" | 8-byte tag
+//
+// The envelope header is signed by the provider and names the grant, buyer
+// and license terms. The watermark tag is derived from the grant ID with a
+// key derived from the provider secret; it sits after the end of the
+// FlatBuffer, where readers ignore it, so the record decodes unchanged.
+//
+// The trailer is trivially stripped, so listings can also name
+// WatermarkFields: double fields of the root table whose lowest mantissa
+// byte is overwritten with one byte of the tag each. A copy stripped of its
+// trailer is then traced from those fields, given the listing it came from.
+// Neither form proves anything about the record contents.
+const (
+	provenanceMagic = "SDNP"
+	watermarkMagic  = "SDNW"
+	watermarkTagLen = 8
+	maxEnvelopeHdr  = 64 * 1024
+
+	// minWatermarkFields is the fewest fields a field watermark is embedded
+	// in; shorter tags would collide between grants.
+	minWatermarkFields = 4
+)
+
+// ErrNoProvenance is returned when a record carries no provenance this node
+// can trace.
+var ErrNoProvenance = errors.New("no provenance found")
+
+// ProvenanceEnvelope is the signed header wrapped around a delivered record.
+type ProvenanceEnvelope struct {
+	GrantID        string    `json:"grant_id"`
+	ListingID      string    `json:"listing_id"`
+	BuyerPeerID    string    `json:"buyer_peer_id"`
+	ProviderPeerID string    `json:"provider_peer_id"`
+	License        string    `json:"license,omitempty"`
+	TermsCID       string    `json:"terms_cid,omitempty"`
+	RecordHash     []byte    `json:"record_hash"` // SHA-256 of the enclosed record
+	IssuedAt       time.Time `json:"issued_at"`
+	Signature      []byte    `json:"signature"`
+}
+
+// ProvenanceTrace answers which grant a record was delivered under.
+//
+// Valid is true when the trace can be relied on: for an envelope, the
+// provider signature verifies and the record matches its hash; for a
+// watermark, the tag matched a grant this node issued. An envelope naming a
+// grant but failing either check is reported with Valid false, since anyone
+// can write such a header.
+type ProvenanceTrace struct {
+	GrantID        string    `json:"grant_id"`
+	ListingID      string    `json:"listing_id"`
+	BuyerPeerID    string    `json:"buyer_peer_id"`
+	ProviderPeerID string    `json:"provider_peer_id"`
+	Method         string    `json:"method"` // "envelope" or "watermark"
+	Valid          bool      `json:"valid"`
+	SignatureValid bool      `json:"signature_valid"` // envelope only
+	RecordIntact   bool      `json:"record_intact"`   // envelope only: record matches its hash
+	IssuedAt       time.Time `json:"issued_at,omitempty"`
+}
+
+func envelopeSigningPayload(env *ProvenanceEnvelope) []byte {
+	return []byte(fmt.Sprintf("provenance:%s:%s:%s:%s:%s:%s:%x:%d",
+		env.GrantID,
+		env.ListingID,
+		env.BuyerPeerID,
+		env.ProviderPeerID,
+		env.License,
+		env.TermsCID,
+		env.RecordHash,
+		env.IssuedAt.Unix(),
+	))
+}
+
+// SealRecord applies the provenance options of the grant's listing to one
+// delivered record. Records of listings without provenance options are
+// returned unchanged.
+func (s *Service) SealRecord(ctx context.Context, grantID string, record []byte) ([]byte, error) {
+	grant, err := s.store.GetGrant(grantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grant: %w", err)
+	}
+	if grant == nil {
+		return nil, fmt.Errorf("grant not found: %s", grantID)
+	}
+	listing, err := s.store.GetListing(grant.ListingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get listing: %w", err)
+	}
+	if listing == nil {
+		return nil, fmt.Errorf("listing not found: %s", grant.ListingID)
+	}
+
+	out := record
+	if listing.Provenance.Watermark {
+		tag, err := s.watermarkTag(grantID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.PutWatermark(hex.EncodeToString(tag), grantID); err != nil {
+			return nil, err
+		}
+		out = make([]byte, 0, len(record)+len(watermarkMagic)+len(tag))
+		out = append(out, record...)
+		if n := embedFieldWatermark(out, listing.Provenance.WatermarkFields, tag); n > 0 {
+			if err := s.store.PutWatermark(hex.EncodeToString(tag[:n]), grantID); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, watermarkMagic...)
+		out = append(out, tag...)
+	}
+
+	if listing.Provenance.Envelope {
+		if !s.canSignListings() {
+			return nil, fmt.Errorf("no signing key for provenance envelopes")
+		}
+		hash := sha256.Sum256(out)
+		env := &ProvenanceEnvelope{
+			GrantID:        grant.GrantID,
+			ListingID:      grant.ListingID,
+			BuyerPeerID:    grant.BuyerPeerID,
+			ProviderPeerID: grant.ProviderPeerID,
+			License:        listing.License,
+			TermsCID:       listing.TermsCID,
+			RecordHash:     hash[:],
+			IssuedAt:       time.Now(),
+		}
+		env.Signature, err = s.signAsProvider(envelopeSigningPayload(env))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign provenance envelope: %w", err)
+		}
+		out, err = encodeEnvelope(env, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// watermarkTag derives the deterministic watermark tag for a grant.
+func (s *Service) watermarkTag(grantID string) ([]byte, error) {
+	key, err := s.watermarkKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sdn-watermark:" + grantID))
+	return mac.Sum(nil)[:watermarkTagLen], nil
+}
+
+// watermarkKey derives the watermark HMAC key from the node's secret key, so
+// the signing key itself is never used as a MAC key.
+func (s *Service) watermarkKey() ([]byte, error) {
+	var secret []byte
+	s.mu.RLock()
+	if s.signingKey != nil {
+		secret = s.signingKey.Seed()
+	} else if s.identityKey != nil {
+		secret, _ = s.identityKey.Raw()
+	}
+	s.mu.RUnlock()
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("no signing key for watermarks")
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("sdn-storefront-watermark-v1")), key); err != nil {
+		return nil, fmt.Errorf("failed to derive watermark key: %w", err)
+	}
+	return key, nil
+}
+
+// embedFieldWatermark writes one tag byte into the lowest mantissa byte of
+// each eligible field in record, in the order fields lists them, and returns
+// the number of bytes embedded. Records with fewer than minWatermarkFields
+// eligible fields are left unchanged.
+func embedFieldWatermark(record []byte, fields []int, tag []byte) int {
+	slots := watermarkSlots(record, fields, len(tag))
+	if len(slots) < minWatermarkFields {
+		return 0
+	}
+	for i, pos := range slots {
+		record[pos] = tag[i]
+	}
+	return len(slots)
+}
+
+// readFieldWatermark returns the tag bytes embedFieldWatermark wrote into
+// record, or nil if it has too few eligible fields.
+func readFieldWatermark(record []byte, fields []int) []byte {
+	slots := watermarkSlots(record, fields, watermarkTagLen)
+	if len(slots) < minWatermarkFields {
+		return nil
+	}
+	tag := make([]byte, len(slots))
+	for i, pos := range slots {
+		tag[i] = record[pos]
+	}
+	return tag
+}
+
+// watermarkSlots locates the lowest mantissa byte of up to max of the given
+// double fields in the root table of a FlatBuffer. Fields that are absent,
+// zero apart from that byte, or not finite are skipped; none of these
+// properties depend on the byte, so embedding and reading agree.
+func watermarkSlots(buf []byte, fields []int, max int) []int {
+	if len(buf) < 8 {
+		return nil
+	}
+	table := int(binary.LittleEndian.Uint32(buf))
+	if table > len(buf)-4 {
+		return nil
+	}
+	vtable := table - int(int32(binary.LittleEndian.Uint32(buf[table:])))
+	if vtable < 0 || vtable > len(buf)-4 {
+		return nil
+	}
+	vtableLen := int(binary.LittleEndian.Uint16(buf[vtable:]))
+	if vtable+vtableLen > len(buf) {
+		return nil
+	}
+
+	var slots []int
+	for _, id := range fields {
+		if len(slots) == max {
+			break
+		}
+		entry := 4 + 2*id
+		if id < 0 || entry+2 > vtableLen {
+			continue
+		}
+		off := int(binary.LittleEndian.Uint16(buf[vtable+entry:]))
+		if off == 0 || table+off+8 > len(buf) {
+			continue
+		}
+		magnitude := binary.LittleEndian.Uint64(buf[table+off:]) &^ (1 << 63)
+		if magnitude&^0xff == 0 || magnitude>>52 == 0x7ff {
+			continue
+		}
+		slots = append(slots, table+off)
+	}
+	return slots
+}
+
+func encodeEnvelope(env *ProvenanceEnvelope, record []byte) ([]byte, error) {
+	header, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal provenance envelope: %w", err)
+	}
+	out := make([]byte, 0, len(provenanceMagic)+4+len(header)+len(record))
+	out = append(out, provenanceMagic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	out = append(out, record...)
+	return out, nil
+}
+
+// DecodeEnvelope splits an enveloped record into its provenance header and
+// the enclosed record.
+func DecodeEnvelope(data []byte) (*ProvenanceEnvelope, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(provenanceMagic)) || len(data) < len(provenanceMagic)+4 {
+		return nil, nil, ErrNoProvenance
+	}
+	rest := data[len(provenanceMagic):]
+	n := binary.BigEndian.Uint32(rest)
+	rest = rest[4:]
+	if n > maxEnvelopeHdr || int(n) > len(rest) {
+		return nil, nil, fmt.Errorf("malformed provenance envelope")
+	}
+	var env ProvenanceEnvelope
+	if err := json.Unmarshal(rest[:n], &env); err != nil {
+		return nil, nil, fmt.Errorf("malformed provenance envelope: %w", err)
+	}
+	return &env, rest[n:], nil
+}
+
+// TraceRecord identifies the grant a delivered record was sold under, from
+// its provenance envelope or, if the envelope was stripped, its watermark.
+// The listing the record is claimed to come from tells which fields may
+// carry a watermark once the trailer is stripped too.
+func (s *Service) TraceRecord(data []byte, listingID string) (*ProvenanceTrace, error) {
+	if env, record, err := DecodeEnvelope(data); err == nil {
+		hash := sha256.Sum256(record)
+		trace := &ProvenanceTrace{
+			GrantID:        env.GrantID,
+			ListingID:      env.ListingID,
+			BuyerPeerID:    env.BuyerPeerID,
+			ProviderPeerID: env.ProviderPeerID,
+			Method:         "envelope",
+			SignatureValid: s.verifyEnvelope(env),
+			RecordIntact:   hmac.Equal(hash[:], env.RecordHash),
+			IssuedAt:       env.IssuedAt,
+		}
+		trace.Valid = trace.SignatureValid && trace.RecordIntact
+		return trace, nil
+	} else if !errors.Is(err, ErrNoProvenance) {
+		return nil, err
+	}
+
+	trailer := len(watermarkMagic) + watermarkTagLen
+	if len(data) >= trailer && string(data[len(data)-trailer:len(data)-watermarkTagLen]) == watermarkMagic {
+		trace, err := s.traceWatermark(data[len(data)-watermarkTagLen:])
+		if !errors.Is(err, ErrNoProvenance) {
+			return trace, err
+		}
+	}
+
+	if listingID == "" {
+		return nil, ErrNoProvenance
+	}
+	listing, err := s.store.GetListing(listingID)
+	if err != nil {
+		return nil, err
+	}
+	if listing == nil || !listing.Provenance.Watermark {
+		return nil, ErrNoProvenance
+	}
+	tag := readFieldWatermark(data, listing.Provenance.WatermarkFields)
+	if tag == nil {
+		return nil, ErrNoProvenance
+	}
+	return s.traceWatermark(tag)
+}
+
+// traceWatermark looks up the grant a watermark tag was issued for.
+func (s *Service) traceWatermark(tag []byte) (*ProvenanceTrace, error) {
+	grantID, err := s.store.GetWatermarkGrant(hex.EncodeToString(tag))
+	if err != nil {
+		return nil, err
+	}
+	if grantID == "" {
+		return nil, ErrNoProvenance
+	}
+	grant, err := s.store.GetGrant(grantID)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, ErrNoProvenance
+	}
+	return &ProvenanceTrace{
+		GrantID:        grant.GrantID,
+		ListingID:      grant.ListingID,
+		BuyerPeerID:    grant.BuyerPeerID,
+		ProviderPeerID: grant.ProviderPeerID,
+		Method:         "watermark",
+		Valid:          true,
+	}, nil
+}
+
+// verifyEnvelope checks an envelope signature: this node's own envelopes
+// against its signing key, others' against the provider's peer ID.
+func (s *Service) verifyEnvelope(env *ProvenanceEnvelope) bool {
+	data := envelopeSigningPayload(env)
+	if env.ProviderPeerID != s.peerID {
+		return verifyPeerSignature(env.ProviderPeerID, data, env.Signature) == nil
+	}
+
+	s.mu.RLock()
+	identityKey, signingKey := s.identityKey, s.signingKey
+	s.mu.RUnlock()
+	if identityKey != nil {
+		ok, err := identityKey.GetPublic().Verify(data, env.Signature)
+		return err == nil && ok
+	}
+	if signingKey != nil {
+		return ed25519.Verify(signingKey.Public().(ed25519.PublicKey), data, env.Signature)
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package storefront
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+func issueTestGrant(t *testing.T, svc *Service, listing *Listing, buyer string) *AccessGrant {
+	t.Helper()
+	ctx := context.Background()
+	if err := svc.CreateListing(ctx, listing); err != nil {
+		t.Fatalf("CreateListing failed: %v", err)
+	}
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "Basic", BuyerPeerID: buyer, PaymentMethod: PaymentMethodSDNCredits}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+	grant, err := svc.IssueGrant(ctx, req.RequestID)
+	if err != nil {
+		t.Fatalf("IssueGrant failed: %v", err)
+	}
+	return grant
+}
+
+func TestSealAndTraceRecord(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	listing := testListing()
+	listing.License = "CC-BY-NC-4.0"
+	listing.Provenance = ProvenanceOptions{Envelope: true, Watermark: true}
+	grant := issueTestGrant(t, svc, listing, "leaky-buyer")
+
+	record := []byte("\x10\x00\x00\x00OMM$flatbuffer-payload")
+	sealed, err := svc.SealRecord(ctx, grant.GrantID, record)
+	if err != nil {
+		t.Fatalf("SealRecord failed: %v", err)
+	}
+
+	env, inner, err := DecodeEnvelope(sealed)
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+	if env.GrantID != grant.GrantID || env.License != "CC-BY-NC-4.0" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if !bytes.HasPrefix(inner, record) {
+		t.Error("enclosed record should start with the original FlatBuffer")
+	}
+
+	trace, err := svc.TraceRecord(sealed, listing.ListingID)
+	if err != nil {
+		t.Fatalf("TraceRecord failed: %v", err)
+	}
+	if trace.Method != "envelope" || trace.GrantID != grant.GrantID || trace.BuyerPeerID != "leaky-buyer" {
+		t.Errorf("trace = %+v", trace)
+	}
+	if !trace.Valid || !trace.SignatureValid || !trace.RecordIntact {
+		t.Errorf("valid = %v, signature valid = %v, record intact = %v", trace.Valid, trace.SignatureValid, trace.RecordIntact)
+	}
+
+	// A modified record no longer matches its envelope.
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 0xff
+	if trace, _ := svc.TraceRecord(tampered, listing.ListingID); trace == nil || trace.RecordIntact || trace.Valid {
+		t.Errorf("tampered record trace = %+v, want not intact and not valid", trace)
+	}
+
+	// A header rewritten to blame another buyer no longer verifies.
+	forgedEnv := *env
+	forgedEnv.BuyerPeerID = "innocent-buyer"
+	forged, err := encodeEnvelope(&forgedEnv, inner)
+	if err != nil {
+		t.Fatalf("encodeEnvelope failed: %v", err)
+	}
+	trace, err = svc.TraceRecord(forged, listing.ListingID)
+	if err != nil {
+		t.Fatalf("TraceRecord(forged) failed: %v", err)
+	}
+	if trace.SignatureValid || trace.Valid {
+		t.Errorf("forged envelope trace = %+v, want invalid signature", trace)
+	}
+	body, _ := json.Marshal(trace)
+	if !bytes.Contains(body, []byte(`"signature_valid":false`)) || !bytes.Contains(body, []byte(`"valid":false`)) {
+		t.Errorf("forged trace JSON should report validity explicitly: %s", body)
+	}
+
+	// With the envelope stripped, the watermark still identifies the grant.
+	trace, err = svc.TraceRecord(inner, listing.ListingID)
+	if err != nil {
+		t.Fatalf("TraceRecord(watermarked) failed: %v", err)
+	}
+	if trace.Method != "watermark" || trace.GrantID != grant.GrantID || !trace.Valid {
+		t.Errorf("watermark trace = %+v", trace)
+	}
+
+	// The watermark is deterministic per grant.
+	again, _ := svc.SealRecord(ctx, grant.GrantID, record)
+	_, innerAgain, _ := DecodeEnvelope(again)
+	if !bytes.Equal(inner, innerAgain) {
+		t.Error("watermark should be deterministic for a grant")
+	}
+
+	if _, err := svc.TraceRecord(record, listing.ListingID); !errors.Is(err, ErrNoProvenance) {
+		t.Errorf("unsealed record: err = %v, want ErrNoProvenance", err)
+	}
+}
+
+// buildDoubleTable builds a FlatBuffer whose root table holds the given
+// doubles as fields 0..n-1.
+func buildDoubleTable(values ...float64) []byte {
+	b := flatbuffers.NewBuilder(64)
+	b.StartObject(len(values))
+	for i, v := range values {
+		b.PrependFloat64Slot(i, v, 0)
+	}
+	b.Finish(b.EndObject())
+	return b.FinishedBytes()
+}
+
+func readDoubleField(t *testing.T, buf []byte, field int) float64 {
+	t.Helper()
+	tab := &flatbuffers.Table{Bytes: buf, Pos: flatbuffers.GetUOffsetT(buf)}
+	o := flatbuffers.UOffsetT(tab.Offset(flatbuffers.VOffsetT(4 + 2*field)))
+	if o == 0 {
+		t.Fatalf("field %d missing", field)
+	}
+	return tab.GetFloat64(tab.Pos + o)
+}
+
+func TestFieldWatermarkSurvivesStrippedTrailer(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	listing := testListing()
+	listing.Provenance = ProvenanceOptions{Watermark: true, WatermarkFields: []int{1, 2, 3, 4, 5}}
+	grant := issueTestGrant(t, svc, listing, "leaky-buyer")
+	other := issueTestGrant(t, svc, listing, "other-buyer")
+
+	values := []float64{42, 15.5, 0.0001, 98.7, 7000.25, -3.75}
+	record := buildDoubleTable(values...)
+	sealed, err := svc.SealRecord(ctx, grant.GrantID, record)
+	if err != nil {
+		t.Fatalf("SealRecord failed: %v", err)
+	}
+	stripped := sealed[:len(sealed)-len(watermarkMagic)-watermarkTagLen]
+	if bytes.Equal(stripped, record) {
+		t.Fatal("record fields should carry the watermark")
+	}
+	if got := readDoubleField(t, stripped, 0); got != values[0] {
+		t.Errorf("unlisted field = %v, want %v unchanged", got, values[0])
+	}
+	for i := 1; i < len(values); i++ {
+		got := readDoubleField(t, stripped, i)
+		if math.Abs(got-values[i]) > math.Abs(values[i])*1e-12 {
+			t.Errorf("field %d = %v, want close to %v", i, got, values[i])
+		}
+	}
+
+	trace, err := svc.TraceRecord(stripped, listing.ListingID)
+	if err != nil {
+		t.Fatalf("TraceRecord(stripped) failed: %v", err)
+	}
+	if trace.Method != "watermark" || trace.GrantID != grant.GrantID || trace.BuyerPeerID != "leaky-buyer" {
+		t.Errorf("stripped trace = %+v", trace)
+	}
+
+	otherSealed, _ := svc.SealRecord(ctx, other.GrantID, record)
+	otherStripped := otherSealed[:len(otherSealed)-len(watermarkMagic)-watermarkTagLen]
+	if trace, err := svc.TraceRecord(otherStripped, listing.ListingID); err != nil || trace.GrantID != other.GrantID {
+		t.Errorf("other grant trace = %+v, %v", trace, err)
+	}
+
+	// Without the listing the fields cannot be read, and too few fields
+	// carry no field watermark.
+	if _, err := svc.TraceRecord(stripped, ""); !errors.Is(err, ErrNoProvenance) {
+		t.Errorf("trace without listing: err = %v, want ErrNoProvenance", err)
+	}
+	sparse := buildDoubleTable(1.5, 2.5, 0, 0, 0, 0)
+	sealedSparse, _ := svc.SealRecord(ctx, grant.GrantID, sparse)
+	if !bytes.Equal(sealedSparse[:len(sparse)], sparse) {
+		t.Error("record with too few watermark fields should be unchanged")
+	}
+}
+
+func TestWatermarkKeyIsNotSigningSeed(t *testing.T) {
+	svc, _ := newTestService(t)
+	key, err := svc.watermarkKey()
+	if err != nil {
+		t.Fatalf("watermarkKey failed: %v", err)
+	}
+	if bytes.Equal(key, svc.signingKey.Seed()) {
+		t.Error("watermark key should be derived from, not equal to, the signing seed")
+	}
+}
+
+func TestDeliverWithoutProvenanceOptions(t *testing.T) {
+	svc, _ := newTestService(t)
+	grant := issueTestGrant(t, svc, testListing(), "buyer")
+
+	ds := NewDeliveryService(DefaultDeliveryConfig(), nil)
+	ds.SetRecordSealer(svc)
+
+	record := []byte("plain-record")
+	req := &DeliveryRequest{GrantID: grant.GrantID, Method: DeliveryDirectTransfer, Data: record}
+	result, err := ds.Deliver(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if result.BytesSent != len(record) || !bytes.Equal(req.Data, record) {
+		t.Errorf("record should be delivered unchanged, got %q", req.Data)
+	}
+}
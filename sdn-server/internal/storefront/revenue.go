@@ -0,0 +1,82 @@
+package storefront
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// maxBasisPoints is 100% expressed in basis points.
+const maxBasisPoints = 10000
+
+// PlatformFee is the share of every sale kept by the hosting node operator.
+type PlatformFee struct {
+	PeerID      string
+	BasisPoints uint32
+}
+
+// ValidateRevenueSplits checks that every split names a payee and that the
+// splits plus the platform fee do not exceed 100%.
+func ValidateRevenueSplits(splits []RevenueSplit, fee PlatformFee) error {
+	total := uint64(0)
+	if fee.PeerID != "" {
+		total += uint64(fee.BasisPoints)
+	}
+	for _, sp := range splits {
+		if sp.PeerID == "" {
+			return fmt.Errorf("revenue split missing peer_id")
+		}
+		if sp.BasisPoints == 0 {
+			return fmt.Errorf("revenue split for %s has zero share", sp.PeerID)
+		}
+		total += uint64(sp.BasisPoints)
+	}
+	if total > maxBasisPoints {
+		return fmt.Errorf("revenue splits total %d basis points, exceeds %d", total, maxBasisPoints)
+	}
+	return nil
+}
+
+// ComputePayouts divides amount between the platform, the listing's split
+// payees and the provider. Shares are rounded down; the provider receives the
+// remainder, so the payouts always sum to amount. Zero-amount legs are omitted.
+func ComputePayouts(amount uint64, providerPeerID string, splits []RevenueSplit, fee PlatformFee) []Payout {
+	var payouts []Payout
+	remaining := amount
+
+	add := func(peerID, role string, bps uint32) {
+		share := basisPointsOf(amount, bps)
+		if share > remaining {
+			share = remaining
+		}
+		if share == 0 {
+			return
+		}
+		remaining -= share
+		payouts = append(payouts, Payout{PeerID: peerID, Role: role, Amount: share})
+	}
+
+	if fee.PeerID != "" && fee.BasisPoints > 0 {
+		add(fee.PeerID, SplitRolePlatform, fee.BasisPoints)
+	}
+	for _, sp := range splits {
+		role := sp.Role
+		if role == "" {
+			role = SplitRoleCoOwner
+		}
+		add(sp.PeerID, role, sp.BasisPoints)
+	}
+	if remaining > 0 {
+		payouts = append([]Payout{{PeerID: providerPeerID, Role: SplitRoleProvider, Amount: remaining}}, payouts...)
+	}
+	return payouts
+}
+
+// basisPointsOf returns floor(amount * bps / 10000) without overflow.
+func basisPointsOf(amount uint64, bps uint32) uint64 {
+	if bps >= maxBasisPoints {
+		return amount
+	}
+	hi, lo := bits.Mul64(amount, uint64(bps))
+	q, _ := bits.Div64(hi, lo, maxBasisPoints)
+	return q
+}
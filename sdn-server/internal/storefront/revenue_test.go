@@ -0,0 +1,140 @@
+package storefront
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestComputePayouts(t *testing.T) {
+	splits := []RevenueSplit{
+		{PeerID: "co-owner", Role: SplitRoleCoOwner, BasisPoints: 2000},
+		{PeerID: "author", Role: SplitRolePluginAuthor, BasisPoints: 333},
+	}
+	fee := PlatformFee{PeerID: "operator", BasisPoints: 500}
+
+	payouts := ComputePayouts(1001, "provider", splits, fee)
+	got := map[string]uint64{}
+	var total uint64
+	for _, p := range payouts {
+		got[p.PeerID] = p.Amount
+		total += p.Amount
+	}
+	if total != 1001 {
+		t.Errorf("payouts sum to %d, want 1001", total)
+	}
+	want := map[string]uint64{"operator": 50, "co-owner": 200, "author": 33, "provider": 718}
+	for peer, amount := range want {
+		if got[peer] != amount {
+			t.Errorf("%s = %d, want %d", peer, got[peer], amount)
+		}
+	}
+	if payouts[0].PeerID != "provider" {
+		t.Errorf("first payout = %s, want provider", payouts[0].PeerID)
+	}
+}
+
+func TestValidateRevenueSplits(t *testing.T) {
+	fee := PlatformFee{PeerID: "operator", BasisPoints: 1000}
+	if err := ValidateRevenueSplits([]RevenueSplit{{PeerID: "a", BasisPoints: 9000}}, fee); err != nil {
+		t.Errorf("100%% total should be valid: %v", err)
+	}
+	if err := ValidateRevenueSplits([]RevenueSplit{{PeerID: "a", BasisPoints: 9001}}, fee); err == nil {
+		t.Error("over 100% should be rejected")
+	}
+	if err := ValidateRevenueSplits([]RevenueSplit{{BasisPoints: 10}}, PlatformFee{}); err == nil {
+		t.Error("split without peer should be rejected")
+	}
+}
+
+func TestSplitCreditsPaymentAndRefund(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+
+	listing := testListing()
+	listing.RevenueSplits = []RevenueSplit{{PeerID: "co-owner", Role: SplitRoleCoOwner, BasisPoints: 2500}}
+	if err := svc.CreateListing(ctx, listing); err != nil {
+		t.Fatalf("CreateListing failed: %v", err)
+	}
+	stored, _ := store.GetListing(listing.ListingID)
+	if len(stored.RevenueSplits) != 1 || stored.RevenueSplits[0].PeerID != "co-owner" {
+		t.Fatalf("RevenueSplits not persisted: %+v", stored.RevenueSplits)
+	}
+
+	req := &PurchaseRequest{ListingID: listing.ListingID, TierName: "Basic", BuyerPeerID: "buyer", PaymentMethod: PaymentMethodSDNCredits}
+	if err := svc.CreatePurchaseRequest(ctx, req); err != nil {
+		t.Fatalf("CreatePurchaseRequest failed: %v", err)
+	}
+
+	store.UpdateCreditsBalance("buyer", 1000)
+	pp := NewPaymentProcessor(store, "test-peer-id")
+	pp.SetPlatformFee(PlatformFee{PeerID: "operator", BasisPoints: 1000})
+
+	if err := pp.ProcessCredits(ctx, req.RequestID, "buyer", 1000, "test-peer-id"); err != nil {
+		t.Fatalf("ProcessCredits failed: %v", err)
+	}
+
+	balances := map[string]uint64{"buyer": 0, "test-peer-id": 650, "co-owner": 250, "operator": 100}
+	for peer, want := range balances {
+		bal, _ := store.GetCreditsBalance(peer)
+		if bal.Balance != want {
+			t.Errorf("%s balance = %d, want %d", peer, bal.Balance, want)
+		}
+	}
+
+	summary, err := store.GetPayoutSummary("co-owner")
+	if err != nil {
+		t.Fatalf("GetPayoutSummary failed: %v", err)
+	}
+	if summary.Total != 250 || summary.ByRole[SplitRoleCoOwner] != 250 {
+		t.Errorf("co-owner summary = %+v", summary)
+	}
+
+	// Insufficient funds move nothing.
+	if err := pp.ProcessCredits(ctx, req.RequestID, "buyer", 1, "test-peer-id"); err == nil {
+		t.Error("ProcessCredits should fail with an empty balance")
+	}
+
+	// A refund that fails part way through moves nothing.
+	if _, err := store.db.Exec(`CREATE TRIGGER fail_operator_refund BEFORE INSERT ON storefront_credits_transactions
+		WHEN NEW.type = 'refund' AND NEW.from_peer_id = 'operator' BEGIN SELECT RAISE(ABORT, 'refund failed'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	if err := pp.RefundCredits(ctx, req.RequestID, "buyer", 1000, "test-peer-id"); err == nil {
+		t.Fatal("RefundCredits should fail when a leg cannot be recorded")
+	}
+	for peer, want := range balances {
+		if bal, _ := store.GetCreditsBalance(peer); bal.Balance != want {
+			t.Errorf("%s balance after failed refund = %d, want %d", peer, bal.Balance, want)
+		}
+	}
+	store.db.Exec(`DROP TRIGGER fail_operator_refund`)
+
+	// A payee that spent its share cannot be pushed negative.
+	store.UpdateCreditsBalance("co-owner", -200)
+	if err := pp.RefundCredits(ctx, req.RequestID, "buyer", 1000, "test-peer-id"); !errors.Is(err, ErrInsufficientCredits) {
+		t.Fatalf("RefundCredits with a spent share = %v, want %v", err, ErrInsufficientCredits)
+	}
+	if bal, _ := store.GetCreditsBalance("co-owner"); bal.Balance != 50 {
+		t.Errorf("co-owner balance after refused refund = %d, want 50", bal.Balance)
+	}
+	store.UpdateCreditsBalance("co-owner", 200)
+
+	if err := pp.RefundCredits(ctx, req.RequestID, "buyer", 1000, "test-peer-id"); err != nil {
+		t.Fatalf("RefundCredits failed: %v", err)
+	}
+	for _, peer := range []string{"test-peer-id", "co-owner", "operator"} {
+		bal, _ := store.GetCreditsBalance(peer)
+		if bal.Balance != 0 {
+			t.Errorf("%s balance after refund = %d, want 0", peer, bal.Balance)
+		}
+	}
+	buyer, _ := store.GetCreditsBalance("buyer")
+	if buyer.Balance != 1000 {
+		t.Errorf("buyer balance after refund = %d, want 1000", buyer.Balance)
+	}
+	summary, _ = store.GetPayoutSummary("co-owner")
+	if summary.Total != 0 {
+		t.Errorf("co-owner net payout after refund = %d, want 0", summary.Total)
+	}
+}
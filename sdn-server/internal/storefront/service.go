@@ -7,11 +7,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	ps "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
 )
 
 // StorefrontListingsTopic is the PubSub topic for listing announcements
@@ -25,13 +27,24 @@ type Service struct {
 	store         *Store
 	peerID        string
 	signingKey    ed25519.PrivateKey
+	identityKey   crypto.PrivKey
 	pubsub        *ps.PubSub
 	listingTopic  *ps.Topic
 	purchaseTopic *ps.Topic
+	tombTopic     *ps.Topic
+	catalog       *Catalog
 	subscribers   map[string]chan *Listing // listingID -> channel
+	deposits      DepositAddressDeriver
+	platformFee   PlatformFee
 	mu            sync.RWMutex
 }
 
+// DepositAddressDeriver derives a receive address for a purchase from the
+// node's HD wallet. Each index yields a distinct, deterministic address.
+type DepositAddressDeriver interface {
+	DeriveDepositAddress(ctx context.Context, chain string, index uint32) (string, error)
+}
+
 // NewService creates a new storefront service
 func NewService(store *Store, peerID string, signingKey ed25519.PrivateKey, pubsub *ps.PubSub) (*Service, error) {
 	svc := &Service{
@@ -54,13 +67,69 @@ func NewService(store *Store, peerID string, signingKey ed25519.PrivateKey, pubs
 		if err != nil {
 			log.Warnf("Failed to join purchases topic: %v", err)
 		}
+
+		svc.tombTopic, err = pubsub.Join(StorefrontTombstonesTopic)
+		if err != nil {
+			log.Warnf("Failed to join tombstones topic: %v", err)
+		}
 	}
 
 	return svc, nil
 }
 
+// SetDepositAddressDeriver enables per-purchase deposit addresses for crypto
+// payments. Without a deriver buyers must submit a transaction hash.
+func (s *Service) SetDepositAddressDeriver(d DepositAddressDeriver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deposits = d
+}
+
+// SetPlatformFee configures the share of usage billing routed to the hosting
+// node operator and bounds the revenue splits listings may declare.
+func (s *Service) SetPlatformFee(fee PlatformFee) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.platformFee = fee
+}
+
+// SetIdentityKey sets the node's libp2p identity key. Listings and tombstones
+// are signed with it so other nodes can verify them against the provider's
+// peer ID; without it they are signed with the service signing key.
+func (s *Service) SetIdentityKey(key crypto.PrivKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identityKey = key
+}
+
+// SetCatalog attaches the DHT catalog used to publish this node's listings and
+// tombstones and to discover listings from other providers.
+func (s *Service) SetCatalog(c *Catalog) {
+	c.SetIndexSigner(s.peerID, s.signAsProvider)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catalog = c
+}
+
+func (s *Service) getCatalog() *Catalog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.catalog
+}
+
+// PlatformFee returns the configured platform fee.
+func (s *Service) PlatformFee() PlatformFee {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.platformFee
+}
+
 // CreateListing creates a new listing
 func (s *Service) CreateListing(ctx context.Context, listing *Listing) error {
+	if err := ValidateRevenueSplits(listing.RevenueSplits, s.PlatformFee()); err != nil {
+		return err
+	}
+
 	// Generate listing ID if not provided
 	if listing.ListingID == "" {
 		listing.ListingID = uuid.New().String()
@@ -74,7 +143,7 @@ func (s *Service) CreateListing(ctx context.Context, listing *Listing) error {
 	listing.Active = true
 
 	// Sign the listing
-	if s.signingKey != nil {
+	if s.canSignListings() {
 		signature, err := s.signListing(listing)
 		if err != nil {
 			return fmt.Errorf("failed to sign listing: %w", err)
@@ -98,15 +167,27 @@ func (s *Service) CreateListing(ctx context.Context, listing *Listing) error {
 }
 
 func (s *Service) signListing(listing *Listing) ([]byte, error) {
-	// Create a canonical representation for signing
-	data := fmt.Sprintf("%s:%s:%s:%s:%d",
-		listing.ListingID,
-		listing.ProviderPeerID,
-		listing.Title,
-		listing.Description,
-		listing.UpdatedAt.Unix(),
-	)
-	return ed25519.Sign(s.signingKey, []byte(data)), nil
+	data, err := listingSigningPayload(listing)
+	if err != nil {
+		return nil, err
+	}
+	return s.signAsProvider(data)
+}
+
+func (s *Service) canSignListings() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.identityKey != nil || s.signingKey != nil
+}
+
+func (s *Service) signAsProvider(data []byte) ([]byte, error) {
+	s.mu.RLock()
+	key := s.identityKey
+	s.mu.RUnlock()
+	if key != nil {
+		return key.Sign(data)
+	}
+	return ed25519.Sign(s.signingKey, data), nil
 }
 
 func (s *Service) publishListing(ctx context.Context, listing *Listing) error {
@@ -172,6 +253,8 @@ func (s *Service) CreatePurchaseRequest(ctx context.Context, req *PurchaseReques
 	req.UpdatedAt = time.Now()
 	req.PaymentDeadline = time.Now().Add(30 * time.Minute) // 30 min to pay
 
+	s.assignDepositAddress(ctx, req)
+
 	// Store the request
 	if err := s.store.CreatePurchaseRequest(req); err != nil {
 		return fmt.Errorf("failed to store purchase request: %w", err)
@@ -186,23 +269,90 @@ func (s *Service) CreatePurchaseRequest(ctx context.Context, req *PurchaseReques
 	return nil
 }
 
-// ProcessPayment processes a payment confirmation
-func (s *Service) ProcessPayment(ctx context.Context, requestID string, txHash string, chain string) error {
-	// Update purchase status
-	if err := s.store.UpdatePurchaseStatus(requestID, PurchaseStatusPaymentDetected, "Payment detected"); err != nil {
-		return err
+// assignDepositAddress gives a crypto purchase its own receive address so the
+// payment watcher can match incoming funds without a submitted tx hash. Only
+// tiers priced in the chain's native coin get one; a price in another currency
+// cannot be compared with an address balance.
+func (s *Service) assignDepositAddress(ctx context.Context, req *PurchaseRequest) {
+	s.mu.RLock()
+	deriver := s.deposits
+	s.mu.RUnlock()
+
+	chain := chainForPaymentMethod(req.PaymentMethod)
+	if deriver == nil || chain == "" || !pricedInNativeCoin(chain, req.PaymentCurrency) {
+		return
 	}
 
+	index, err := s.store.NextDepositIndex()
+	if err != nil {
+		log.Warnf("Failed to allocate deposit index for %s: %v", req.RequestID, err)
+		return
+	}
+	addr, err := deriver.DeriveDepositAddress(ctx, chain, index)
+	if err != nil {
+		log.Warnf("Failed to derive deposit address for %s: %v", req.RequestID, err)
+		return
+	}
+
+	req.DepositAddress = addr
+	req.DepositIndex = index
+	req.PaymentChain = chain
+}
+
+// chainForPaymentMethod maps native-coin payment methods to their chain
+// identifier. Token payments (USDC) cannot be detected from a plain balance
+// and return "".
+func chainForPaymentMethod(m PaymentMethod) string {
+	switch m {
+	case PaymentMethodCryptoETH:
+		return "ethereum"
+	case PaymentMethodCryptoSOL:
+		return "solana"
+	case PaymentMethodCryptoBTC:
+		return "bitcoin"
+	default:
+		return ""
+	}
+}
+
+// nativeCurrencies maps each watched chain to the currency code of its native
+// coin.
+var nativeCurrencies = map[string]string{
+	"ethereum": "ETH",
+	"solana":   "SOL",
+	"bitcoin":  "BTC",
+}
+
+// pricedInNativeCoin reports whether currency is the native coin of chain. A
+// tier priced in a native coin gives PriceAmount in the chain's base unit
+// (wei, lamports or satoshis).
+func pricedInNativeCoin(chain, currency string) bool {
+	native, ok := nativeCurrencies[chain]
+	return ok && strings.EqualFold(strings.TrimSpace(currency), native)
+}
+
+// ProcessPayment processes a payment confirmation
+func (s *Service) ProcessPayment(ctx context.Context, requestID string, txHash string, chain string) error {
 	// TODO: Verify payment on chain
 	// For now, auto-confirm
 
-	if err := s.store.UpdatePurchaseStatus(requestID, PurchaseStatusPaymentConfirmed, "Payment confirmed"); err != nil {
+	// Only the caller that moves the purchase to confirmed issues the grant;
+	// the payment watcher and the confirm API can race on the same purchase.
+	claimed, err := s.store.ClaimPurchasePayment(requestID, "Payment confirmed")
+	if err != nil {
 		return err
 	}
+	if !claimed {
+		return ErrPaymentAlreadyProcessed
+	}
 
 	// Issue access grant
 	grant, err := s.IssueGrant(ctx, requestID)
 	if err != nil {
+		// Hand the purchase back so the payment can be retried.
+		if uerr := s.store.UpdatePurchaseStatus(requestID, PurchaseStatusPaymentDetected, "Grant failed, awaiting retry"); uerr != nil {
+			log.Warnf("Failed to reopen purchase %s: %v", requestID, uerr)
+		}
 		return fmt.Errorf("failed to issue grant: %w", err)
 	}
 
@@ -514,7 +664,100 @@ func (s *Service) WithdrawCredits(ctx context.Context, peerID string, amount uin
 	return s.store.UpdateCreditsBalance(peerID, -int64(amount))
 }
 
-// SubscribeToListings subscribes to new listing announcements
+// RemoveListing withdraws a listing. For this node's own listings a signed
+// tombstone is stored, gossiped and published to the DHT so other nodes drop
+// the listing from their catalogs.
+func (s *Service) RemoveListing(ctx context.Context, listingID string) error {
+	listing, err := s.store.GetListing(listingID)
+	if err != nil {
+		return fmt.Errorf("failed to get listing: %w", err)
+	}
+	if listing == nil {
+		return fmt.Errorf("listing not found: %s", listingID)
+	}
+	if err := s.store.UpdateListingActive(listingID, false); err != nil {
+		return err
+	}
+	if listing.ProviderPeerID != s.peerID || !s.canSignListings() {
+		return nil
+	}
+
+	tombstone := &ListingTombstone{
+		ListingID:      listingID,
+		ProviderPeerID: s.peerID,
+		RemovedAt:      time.Now(),
+	}
+	tombstone.Signature, err = s.signAsProvider(tombstoneSigningPayload(tombstone))
+	if err != nil {
+		return fmt.Errorf("failed to sign tombstone: %w", err)
+	}
+	if err := s.store.PutTombstone(tombstone); err != nil {
+		return err
+	}
+
+	if s.tombTopic != nil {
+		data, _ := json.Marshal(tombstone)
+		if err := s.tombTopic.Publish(ctx, data); err != nil {
+			log.Warnf("Failed to publish tombstone: %v", err)
+		}
+	}
+	if c := s.getCatalog(); c != nil {
+		c.RemoveListing(ctx, listingID)
+		c.PublishProviderIndex(ctx, s.peerID)
+		if err := c.PublishTombstone(ctx, tombstone); err != nil {
+			log.Warnf("Failed to publish tombstone to DHT: %v", err)
+		}
+	}
+	return nil
+}
+
+// IndexRemoteListing verifies a listing announced by another node and indexes
+// it for search. Listings claiming to be from this node, failing signature
+// verification, withdrawn, or older than the indexed copy are not indexed.
+func (s *Service) IndexRemoteListing(listing *Listing, sourcePeerID string) (bool, error) {
+	if listing.ProviderPeerID == s.peerID {
+		return false, nil
+	}
+	return indexRemoteListing(s.store, listing, sourcePeerID)
+}
+
+// RepublishListings re-signs this node's active listings and announces them
+// on PubSub and the DHT. DHT records expire, and nodes that joined since a
+// listing was created only learn of it from a later announcement.
+func (s *Service) RepublishListings(ctx context.Context) error {
+	if !s.canSignListings() {
+		return nil
+	}
+	ids, err := s.store.ListActiveListingIDs(s.peerID)
+	if err != nil {
+		return err
+	}
+	catalog := s.getCatalog()
+	for _, id := range ids {
+		listing, err := s.store.GetListing(id)
+		if err != nil || listing == nil {
+			continue
+		}
+		signature, err := s.signListing(listing)
+		if err != nil {
+			return fmt.Errorf("failed to sign listing: %w", err)
+		}
+		listing.Signature = signature
+		if s.listingTopic != nil {
+			if err := s.publishListing(ctx, listing); err != nil {
+				log.Warnf("Failed to announce listing %s: %v", id, err)
+			}
+		}
+		if catalog != nil {
+			catalog.PublishListing(ctx, listing)
+		}
+	}
+	return nil
+}
+
+// SubscribeToListings subscribes to listing announcements from other nodes.
+// Announcements are verified and indexed; the returned channel receives the
+// listings that were indexed.
 func (s *Service) SubscribeToListings(ctx context.Context) (<-chan *Listing, error) {
 	if s.listingTopic == nil {
 		return nil, fmt.Errorf("pubsub not available")
@@ -542,9 +785,13 @@ func (s *Service) SubscribeToListings(ctx context.Context) (<-chan *Listing, err
 				continue
 			}
 
-			// Store the listing locally
-			if err := s.store.CreateListing(&listing); err != nil {
-				log.Warnf("Failed to store listing from pubsub: %v", err)
+			indexed, err := s.IndexRemoteListing(&listing, msg.ReceivedFrom.String())
+			if err != nil {
+				log.Warnf("Rejected listing %s from %s: %v", listing.ListingID, msg.ReceivedFrom, err)
+				continue
+			}
+			if !indexed {
+				continue
 			}
 
 			select {
@@ -558,12 +805,86 @@ func (s *Service) SubscribeToListings(ctx context.Context) (<-chan *Listing, err
 	return ch, nil
 }
 
-// IndexListingsFromDHT indexes listings from DHT (placeholder for DHT integration)
+// SubscribeToTombstones applies listing tombstones gossiped by other nodes
+// until ctx is cancelled.
+func (s *Service) SubscribeToTombstones(ctx context.Context) error {
+	if s.tombTopic == nil {
+		return fmt.Errorf("pubsub not available")
+	}
+
+	sub, err := s.tombTopic.Subscribe()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	go func() {
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+
+			var tombstone ListingTombstone
+			if err := json.Unmarshal(msg.Data, &tombstone); err != nil {
+				log.Warnf("Failed to unmarshal tombstone: %v", err)
+				continue
+			}
+			if tombstone.ProviderPeerID == s.peerID {
+				continue
+			}
+			if err := applyTombstone(s.store, &tombstone); err != nil {
+				log.Warnf("Rejected tombstone for %s from %s: %v", tombstone.ListingID, msg.ReceivedFrom, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// IndexListingsFromDHT refreshes listings of known remote providers from the
+// DHT. New and updated listings in a provider's index are verified and
+// indexed; indexed listings missing from it are checked for a tombstone.
 func (s *Service) IndexListingsFromDHT(ctx context.Context) error {
-	// TODO: Implement DHT-based listing discovery
-	// This would query /sdn/listing/{listing_id} keys from DHT
-	// and index them locally
-	log.Info("DHT listing indexing not yet implemented")
+	catalog := s.getCatalog()
+	if catalog == nil || catalog.dht == nil {
+		return nil
+	}
+
+	providers, err := s.store.ListRemoteProviders()
+	if err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		published, err := catalog.FetchProviderListings(ctx, provider)
+		if err != nil {
+			log.Debugf("No DHT listing index for provider %s: %v", provider, err)
+			continue
+		}
+		listed := make(map[string]bool, len(published))
+		for _, id := range published {
+			listed[id] = true
+			if _, err := catalog.fetchRemoteListing(ctx, id); err != nil {
+				log.Debugf("Failed to index listing %s from DHT: %v", id, err)
+			}
+		}
+
+		known, err := s.store.ListActiveListingIDs(provider)
+		if err != nil {
+			return err
+		}
+		for _, id := range known {
+			if listed[id] {
+				continue
+			}
+			if err := catalog.FetchTombstone(ctx, id); err != nil {
+				log.Debugf("No tombstone for listing %s: %v", id, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -582,5 +903,8 @@ func (s *Service) Close() error {
 	if s.purchaseTopic != nil {
 		s.purchaseTopic.Close()
 	}
+	if s.tombTopic != nil {
+		s.tombTopic.Close()
+	}
 	return s.store.Close()
 }
@@ -3,11 +3,13 @@ package storefront
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	logging "github.com/ipfs/go-log/v2"
 	_ "github.com/mattn/go-sqlite3"
 
@@ -16,6 +18,16 @@ import (
 
 var log = logging.Logger("storefront")
 
+// ErrInsufficientCredits is returned when a payer cannot cover a credits transfer.
+var ErrInsufficientCredits = errors.New("insufficient credits")
+
+// ErrPaymentAlreadyProcessed is returned when a purchase's payment was already
+// confirmed by another path.
+var ErrPaymentAlreadyProcessed = errors.New("purchase payment already processed")
+
+// ErrInvoiceSettled is returned when settling an invoice that is not unpaid.
+var ErrInvoiceSettled = errors.New("invoice already settled")
+
 // FlatSQL schema names for storefront record types.
 const (
 	SchemaSTF = "STF.fbs"
@@ -118,6 +130,8 @@ func (s *Store) initTables() error {
 	// Migration: add cid and source_peer_id columns to existing tables
 	s.db.Exec(`ALTER TABLE storefront_listings ADD COLUMN cid TEXT DEFAULT ''`)
 	s.db.Exec(`ALTER TABLE storefront_listings ADD COLUMN source_peer_id TEXT DEFAULT ''`)
+	s.db.Exec(`ALTER TABLE storefront_listings ADD COLUMN revenue_splits TEXT DEFAULT ''`)
+	s.db.Exec(`ALTER TABLE storefront_listings ADD COLUMN provenance TEXT DEFAULT ''`)
 
 	// Full-text search for listings
 	_, err = s.db.Exec(`
@@ -178,6 +192,7 @@ func (s *Store) initTables() error {
 	}
 
 	s.db.Exec(`ALTER TABLE storefront_grants ADD COLUMN cid TEXT DEFAULT ''`)
+	s.db.Exec(`ALTER TABLE storefront_grants ADD COLUMN total_bytes INTEGER DEFAULT 0`)
 
 	// Purchase index
 	_, err = s.db.Exec(`
@@ -223,6 +238,22 @@ func (s *Store) initTables() error {
 	}
 
 	s.db.Exec(`ALTER TABLE storefront_purchases ADD COLUMN cid TEXT DEFAULT ''`)
+	s.db.Exec(`ALTER TABLE storefront_purchases ADD COLUMN deposit_address TEXT DEFAULT ''`)
+	s.db.Exec(`ALTER TABLE storefront_purchases ADD COLUMN deposit_index INTEGER DEFAULT 0`)
+	s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_purchases_deposit ON storefront_purchases(deposit_address)`)
+
+	// Deposit index counter — allocates unique HD derivation indexes for
+	// per-purchase receive addresses. Index 0 is reserved for the node itself.
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS storefront_deposit_counter (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			next_index INTEGER NOT NULL
+		);
+		INSERT OR IGNORE INTO storefront_deposit_counter (id, next_index) VALUES (1, 1);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create deposit counter table: %w", err)
+	}
 
 	// Reviews index
 	_, err = s.db.Exec(`
@@ -291,6 +322,83 @@ func (s *Store) initTables() error {
 		return fmt.Errorf("failed to create credits transactions table: %w", err)
 	}
 
+	s.db.Exec(`ALTER TABLE storefront_credits_transactions ADD COLUMN role TEXT DEFAULT ''`)
+	s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_credits_tx_reference ON storefront_credits_transactions(reference)`)
+
+	// Metered usage per grant and billing period (local ledger)
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS storefront_usage (
+			grant_id TEXT NOT NULL,
+			period_start INTEGER NOT NULL,
+			period_end INTEGER NOT NULL,
+			requests INTEGER DEFAULT 0,
+			records INTEGER DEFAULT 0,
+			bytes INTEGER DEFAULT 0,
+			invoice_id TEXT DEFAULT '',
+			PRIMARY KEY (grant_id, period_start)
+		);
+		CREATE INDEX IF NOT EXISTS idx_usage_billable ON storefront_usage(invoice_id, period_end);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create usage table: %w", err)
+	}
+
+	// Usage invoices (signed by the provider, local ledger)
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS storefront_invoices (
+			invoice_id TEXT PRIMARY KEY,
+			grant_id TEXT NOT NULL,
+			listing_id TEXT NOT NULL,
+			tier_name TEXT,
+			buyer_peer_id TEXT NOT NULL,
+			provider_peer_id TEXT NOT NULL,
+			period_start INTEGER NOT NULL,
+			period_end INTEGER NOT NULL,
+			requests INTEGER DEFAULT 0,
+			records INTEGER DEFAULT 0,
+			bytes INTEGER DEFAULT 0,
+			records_amount INTEGER DEFAULT 0,
+			bytes_amount INTEGER DEFAULT 0,
+			total_amount INTEGER DEFAULT 0,
+			status INTEGER DEFAULT 0,
+			credits_transaction_id TEXT DEFAULT '',
+			created_at INTEGER NOT NULL,
+			paid_at INTEGER DEFAULT 0,
+			provider_signature BLOB
+		);
+		CREATE INDEX IF NOT EXISTS idx_invoices_buyer ON storefront_invoices(buyer_peer_id);
+		CREATE INDEX IF NOT EXISTS idx_invoices_provider ON storefront_invoices(provider_peer_id);
+		CREATE INDEX IF NOT EXISTS idx_invoices_status ON storefront_invoices(status);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create invoices table: %w", err)
+	}
+
+	// Tombstones for withdrawn listings (provider-signed)
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS storefront_tombstones (
+			listing_id TEXT PRIMARY KEY,
+			provider_peer_id TEXT NOT NULL,
+			removed_at INTEGER NOT NULL,
+			signature BLOB
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tombstones table: %w", err)
+	}
+
+	// Watermark tags embedded in delivered records, for leak tracing
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS storefront_watermarks (
+			tag TEXT PRIMARY KEY,
+			grant_id TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create watermarks table: %w", err)
+	}
+
 	log.Info("Storefront index tables initialized (FlatSQL-backed)")
 	return nil
 }
@@ -333,6 +441,8 @@ func (s *Store) CreateListing(listing *Listing) error {
 	pricingJSON, _ := json.Marshal(listing.Pricing)
 	acceptedPaymentsJSON, _ := json.Marshal(listing.AcceptedPayments)
 	reputationJSON, _ := json.Marshal(listing.Reputation)
+	splitsJSON, _ := json.Marshal(listing.RevenueSplits)
+	provenanceJSON, _ := json.Marshal(listing.Provenance)
 
 	_, err = s.db.Exec(`
 		INSERT OR REPLACE INTO storefront_listings (
@@ -340,8 +450,9 @@ func (s *Store) CreateListing(listing *Listing) error {
 			data_types, tags, coverage, sample_cid, sample_record_count,
 			access_type, encryption_required, delivery_methods, pricing,
 			accepted_payments, reputation, created_at, updated_at, version,
-			active, expires_at, terms_cid, license, signature, source_peer_id
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			active, expires_at, terms_cid, license, signature, source_peer_id,
+			revenue_splits, provenance
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		listing.ListingID, cid, listing.ProviderPeerID, listing.ProviderEPMCID,
 		listing.Title, listing.Description,
@@ -353,6 +464,7 @@ func (s *Store) CreateListing(listing *Listing) error {
 		listing.CreatedAt.Unix(), listing.UpdatedAt.Unix(),
 		listing.Version, listing.Active, listing.ExpiresAt.Unix(),
 		listing.TermsCID, listing.License, listing.Signature, listing.SourcePeerID,
+		string(splitsJSON), string(provenanceJSON),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to index listing: %w", err)
@@ -382,7 +494,8 @@ func (s *Store) GetListing(listingID string) (*Listing, error) {
 			data_types, tags, coverage, sample_cid, sample_record_count,
 			access_type, encryption_required, delivery_methods, pricing,
 			accepted_payments, reputation, created_at, updated_at, version,
-			active, expires_at, terms_cid, license, signature
+			active, expires_at, terms_cid, license, signature,
+			COALESCE(revenue_splits, ''), COALESCE(provenance, '')
 		FROM storefront_listings WHERE listing_id = ?
 	`, listingID)
 
@@ -392,7 +505,7 @@ func (s *Store) GetListing(listingID string) (*Listing, error) {
 func (s *Store) scanListing(row *sql.Row) (*Listing, error) {
 	var listing Listing
 	var dataTypesJSON, tagsJSON, coverageJSON, deliveryMethodsJSON string
-	var pricingJSON, acceptedPaymentsJSON, reputationJSON string
+	var pricingJSON, acceptedPaymentsJSON, reputationJSON, splitsJSON, provenanceJSON string
 	var createdAt, updatedAt, expiresAt int64
 
 	err := row.Scan(
@@ -406,6 +519,7 @@ func (s *Store) scanListing(row *sql.Row) (*Listing, error) {
 		&createdAt, &updatedAt, &listing.Version,
 		&listing.Active, &expiresAt,
 		&listing.TermsCID, &listing.License, &listing.Signature,
+		&splitsJSON, &provenanceJSON,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -421,6 +535,8 @@ func (s *Store) scanListing(row *sql.Row) (*Listing, error) {
 	json.Unmarshal([]byte(pricingJSON), &listing.Pricing)
 	json.Unmarshal([]byte(acceptedPaymentsJSON), &listing.AcceptedPayments)
 	json.Unmarshal([]byte(reputationJSON), &listing.Reputation)
+	json.Unmarshal([]byte(splitsJSON), &listing.RevenueSplits)
+	json.Unmarshal([]byte(provenanceJSON), &listing.Provenance)
 	listing.CreatedAt = time.Unix(createdAt, 0)
 	listing.UpdatedAt = time.Unix(updatedAt, 0)
 	listing.ExpiresAt = time.Unix(expiresAt, 0)
@@ -534,7 +650,8 @@ func (s *Store) SearchListings(query *SearchQuery) (*SearchResult, error) {
 			data_types, tags, coverage, sample_cid, sample_record_count,
 			access_type, encryption_required, delivery_methods, pricing,
 			accepted_payments, reputation, created_at, updated_at, version,
-			active, expires_at, terms_cid, license, signature
+			active, expires_at, terms_cid, license, signature,
+			COALESCE(revenue_splits, ''), COALESCE(provenance, '')
 		FROM storefront_listings WHERE %s ORDER BY %s LIMIT ? OFFSET ?
 	`, whereClause, orderBy)
 
@@ -549,7 +666,7 @@ func (s *Store) SearchListings(query *SearchQuery) (*SearchResult, error) {
 	for rows.Next() {
 		var listing Listing
 		var dataTypesJSON, tagsJSON, coverageJSON, deliveryMethodsJSON string
-		var pricingJSON, acceptedPaymentsJSON, reputationJSON string
+		var pricingJSON, acceptedPaymentsJSON, reputationJSON, splitsJSON, provenanceJSON string
 		var createdAt, updatedAt, expiresAt int64
 
 		err := rows.Scan(
@@ -563,6 +680,7 @@ func (s *Store) SearchListings(query *SearchQuery) (*SearchResult, error) {
 			&createdAt, &updatedAt, &listing.Version,
 			&listing.Active, &expiresAt,
 			&listing.TermsCID, &listing.License, &listing.Signature,
+			&splitsJSON, &provenanceJSON,
 		)
 		if err != nil {
 			log.Warnf("Failed to scan listing row: %v", err)
@@ -576,6 +694,8 @@ func (s *Store) SearchListings(query *SearchQuery) (*SearchResult, error) {
 		json.Unmarshal([]byte(pricingJSON), &listing.Pricing)
 		json.Unmarshal([]byte(acceptedPaymentsJSON), &listing.AcceptedPayments)
 		json.Unmarshal([]byte(reputationJSON), &listing.Reputation)
+		json.Unmarshal([]byte(splitsJSON), &listing.RevenueSplits)
+		json.Unmarshal([]byte(provenanceJSON), &listing.Provenance)
 		listing.CreatedAt = time.Unix(createdAt, 0)
 		listing.UpdatedAt = time.Unix(updatedAt, 0)
 		listing.ExpiresAt = time.Unix(expiresAt, 0)
@@ -645,7 +765,7 @@ func (s *Store) GetGrant(grantID string) (*AccessGrant, error) {
 			payment_amount, payment_currency, payment_chain, next_renewal,
 			auto_renew, renewal_count, total_requests, total_records,
 			last_access, delivery_topic, created_at, updated_at, notes,
-			provider_signature, provider_peer_id
+			provider_signature, provider_peer_id, COALESCE(total_bytes, 0)
 		FROM storefront_grants WHERE grant_id = ?
 	`, grantID).Scan(
 		&grant.GrantID, &grant.ListingID, &grant.TierName, &grant.BuyerPeerID,
@@ -657,7 +777,7 @@ func (s *Store) GetGrant(grantID string) (*AccessGrant, error) {
 		&grant.AutoRenew, &grant.RenewalCount, &grant.TotalRequests,
 		&grant.TotalRecords, &lastAccess, &grant.DeliveryTopic,
 		&createdAt, &updatedAt, &grant.Notes,
-		&grant.ProviderSignature, &grant.ProviderPeerID,
+		&grant.ProviderSignature, &grant.ProviderPeerID, &grant.TotalBytes,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -688,7 +808,7 @@ func (s *Store) GetGrantsByBuyer(buyerPeerID string) ([]*AccessGrant, error) {
 			payment_amount, payment_currency, payment_chain, next_renewal,
 			auto_renew, renewal_count, total_requests, total_records,
 			last_access, delivery_topic, created_at, updated_at, notes,
-			provider_signature, provider_peer_id
+			provider_signature, provider_peer_id, COALESCE(total_bytes, 0)
 		FROM storefront_grants WHERE buyer_peer_id = ?
 	`, buyerPeerID)
 	if err != nil {
@@ -711,7 +831,7 @@ func (s *Store) GetGrantsByBuyer(buyerPeerID string) ([]*AccessGrant, error) {
 			&grant.AutoRenew, &grant.RenewalCount, &grant.TotalRequests,
 			&grant.TotalRecords, &lastAccess, &grant.DeliveryTopic,
 			&createdAt, &updatedAt, &grant.Notes,
-			&grant.ProviderSignature, &grant.ProviderPeerID,
+			&grant.ProviderSignature, &grant.ProviderPeerID, &grant.TotalBytes,
 		)
 		if err != nil {
 			log.Warnf("Failed to scan grant row: %v", err)
@@ -749,8 +869,9 @@ func (s *Store) CreatePurchaseRequest(req *PurchaseRequest) error {
 			payment_intent_id, credits_transaction_id, status, status_message,
 			created_at, updated_at, payment_deadline, payment_confirmed_at,
 			grant_issued_at, grant_id, provider_peer_id, provider_acknowledged_at,
-			preferred_delivery_method, webhook_url, buyer_signature, provider_signature
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			preferred_delivery_method, webhook_url, buyer_signature, provider_signature,
+			deposit_address, deposit_index
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		req.RequestID, cid, req.ListingID, req.TierName, req.BuyerPeerID,
 		req.BuyerEncryptionPubkey, req.KeyAlgorithm, req.BuyerEmail,
@@ -762,6 +883,7 @@ func (s *Store) CreatePurchaseRequest(req *PurchaseRequest) error {
 		req.ProviderPeerID, req.ProviderAcknowledgedAt.Unix(),
 		req.PreferredDeliveryMethod, req.WebhookURL,
 		req.BuyerSignature, req.ProviderSignature,
+		req.DepositAddress, req.DepositIndex,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to index purchase request: %w", err)
@@ -787,6 +909,39 @@ func (s *Store) UpdatePurchaseStatus(requestID string, status PurchaseStatus, me
 	return nil
 }
 
+// ClaimPurchasePayment moves a purchase that is still awaiting payment
+// (pending, detected or expired) to PaymentConfirmed. It reports false when
+// the purchase was already paid, so only one caller issues its grant.
+func (s *Store) ClaimPurchasePayment(requestID, message string) (bool, error) {
+	return s.TransitionPurchaseStatus(requestID, PurchaseStatusPaymentConfirmed, message,
+		PurchaseStatusPending, PurchaseStatusPaymentDetected, PurchaseStatusExpired)
+}
+
+// TransitionPurchaseStatus sets a purchase's status only if it is currently
+// one of from, and reports whether it changed.
+func (s *Store) TransitionPurchaseStatus(requestID string, to PurchaseStatus, message string, from ...PurchaseStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+	args := []interface{}{to, message, time.Now().Unix(), requestID}
+	for _, st := range from {
+		args = append(args, st)
+	}
+	res, err := s.db.Exec(`
+		UPDATE storefront_purchases SET status = ?, status_message = ?, updated_at = ?
+		WHERE request_id = ? AND status IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update purchase status: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update purchase status: %w", err)
+	}
+	return n > 0, nil
+}
+
 // CreateReview creates a new review. Stores through FlatSQL.
 func (s *Store) CreateReview(review *Review) error {
 	s.mu.Lock()
@@ -967,24 +1122,27 @@ func (s *Store) AtomicDeductCredits(peerID string, amount uint64) error {
 	return nil
 }
 
-// GetPurchaseRequest retrieves a purchase request by ID.
-func (s *Store) GetPurchaseRequest(requestID string) (*PurchaseRequest, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// purchaseColumns is the column list shared by all purchase index queries;
+// scanPurchase expects rows in this order.
+const purchaseColumns = `request_id, listing_id, tier_name, buyer_peer_id, buyer_encryption_pubkey,
+	key_algorithm, buyer_email, payment_method, payment_amount, payment_currency,
+	payment_tx_hash, payment_chain, sender_address, confirmation_block,
+	payment_intent_id, credits_transaction_id, status, status_message,
+	created_at, updated_at, payment_deadline, payment_confirmed_at,
+	grant_issued_at, grant_id, provider_peer_id, provider_acknowledged_at,
+	preferred_delivery_method, webhook_url, buyer_signature, provider_signature,
+	COALESCE(deposit_address, ''), COALESCE(deposit_index, 0)`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanPurchase(row rowScanner) (*PurchaseRequest, error) {
 	var req PurchaseRequest
 	var createdAt, updatedAt, paymentDeadline, paymentConfirmedAt, grantIssuedAt, providerAcknowledgedAt int64
 
-	err := s.db.QueryRow(`
-		SELECT request_id, listing_id, tier_name, buyer_peer_id, buyer_encryption_pubkey,
-			key_algorithm, buyer_email, payment_method, payment_amount, payment_currency,
-			payment_tx_hash, payment_chain, sender_address, confirmation_block,
-			payment_intent_id, credits_transaction_id, status, status_message,
-			created_at, updated_at, payment_deadline, payment_confirmed_at,
-			grant_issued_at, grant_id, provider_peer_id, provider_acknowledged_at,
-			preferred_delivery_method, webhook_url, buyer_signature, provider_signature
-		FROM storefront_purchases WHERE request_id = ?
-	`, requestID).Scan(
+	err := row.Scan(
 		&req.RequestID, &req.ListingID, &req.TierName, &req.BuyerPeerID,
 		&req.BuyerEncryptionPubkey, &req.KeyAlgorithm, &req.BuyerEmail,
 		&req.PaymentMethod, &req.PaymentAmount, &req.PaymentCurrency,
@@ -994,12 +1152,10 @@ func (s *Store) GetPurchaseRequest(requestID string) (*PurchaseRequest, error) {
 		&grantIssuedAt, &req.GrantID, &req.ProviderPeerID, &providerAcknowledgedAt,
 		&req.PreferredDeliveryMethod, &req.WebhookURL,
 		&req.BuyerSignature, &req.ProviderSignature,
+		&req.DepositAddress, &req.DepositIndex,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get purchase request: %w", err)
+		return nil, err
 	}
 
 	req.CreatedAt = time.Unix(createdAt, 0)
@@ -1012,6 +1168,25 @@ func (s *Store) GetPurchaseRequest(requestID string) (*PurchaseRequest, error) {
 	return &req, nil
 }
 
+// GetPurchaseRequest retrieves a purchase request by ID.
+func (s *Store) GetPurchaseRequest(requestID string) (*PurchaseRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, err := scanPurchase(s.db.QueryRow(`
+		SELECT `+purchaseColumns+`
+		FROM storefront_purchases WHERE request_id = ?
+	`, requestID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get purchase request: %w", err)
+	}
+
+	return req, nil
+}
+
 // UpdatePurchasePayment updates payment details on a purchase request.
 func (s *Store) UpdatePurchasePayment(requestID, txHash, chain, senderAddress string) error {
 	s.mu.Lock()
@@ -1076,6 +1251,84 @@ func (s *Store) UpdatePurchaseGrant(requestID, grantID string) error {
 	return nil
 }
 
+// UpdatePurchaseConfirmation records the block at which a payment reached the
+// required number of confirmations.
+func (s *Store) UpdatePurchaseConfirmation(requestID string, confirmationBlock uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	_, err := s.db.Exec(`
+		UPDATE storefront_purchases
+		SET confirmation_block = ?, payment_confirmed_at = ?, updated_at = ?
+		WHERE request_id = ?
+	`, confirmationBlock, now, now, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to update purchase confirmation: %w", err)
+	}
+	return nil
+}
+
+// NextDepositIndex allocates a unique HD derivation index for a purchase
+// deposit address. Indexes start at 1 and are never reused.
+func (s *Store) NextDepositIndex() (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin deposit index transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var index uint32
+	if err := tx.QueryRow(`SELECT next_index FROM storefront_deposit_counter WHERE id = 1`).Scan(&index); err != nil {
+		return 0, fmt.Errorf("failed to read deposit index: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE storefront_deposit_counter SET next_index = next_index + 1 WHERE id = 1`); err != nil {
+		return 0, fmt.Errorf("failed to advance deposit index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit deposit index: %w", err)
+	}
+	return index, nil
+}
+
+// ListOpenCryptoPurchases returns crypto-paid purchases that are still waiting
+// for payment, plus expired purchases with a deposit address whose deadline
+// passed after lateSince, so deposits that land after expiry are still seen.
+func (s *Store) ListOpenCryptoPurchases(limit int, lateSince time.Time) ([]*PurchaseRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT `+purchaseColumns+`
+		FROM storefront_purchases
+		WHERE (status IN (?, ?)
+			OR (status = ? AND deposit_address != '' AND payment_deadline >= ?))
+		AND payment_method IN (?, ?, ?, ?)
+		ORDER BY created_at ASC LIMIT ?
+	`, PurchaseStatusPending, PurchaseStatusPaymentDetected,
+		PurchaseStatusExpired, lateSince.Unix(),
+		PaymentMethodCryptoETH, PaymentMethodCryptoSOL, PaymentMethodCryptoBTC, PaymentMethodCryptoUSDC,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []*PurchaseRequest
+	for rows.Next() {
+		req, err := scanPurchase(rows)
+		if err != nil {
+			log.Warnf("Failed to scan purchase row: %v", err)
+			continue
+		}
+		purchases = append(purchases, req)
+	}
+	return purchases, nil
+}
+
 // GetProviderPurchases retrieves all purchases for a provider.
 func (s *Store) GetProviderPurchases(providerPeerID string, limit, offset int) ([]*PurchaseRequest, int, error) {
 	s.mu.RLock()
@@ -1085,13 +1338,7 @@ func (s *Store) GetProviderPurchases(providerPeerID string, limit, offset int) (
 	s.db.QueryRow(`SELECT COUNT(*) FROM storefront_purchases WHERE provider_peer_id = ?`, providerPeerID).Scan(&total)
 
 	rows, err := s.db.Query(`
-		SELECT request_id, listing_id, tier_name, buyer_peer_id, buyer_encryption_pubkey,
-			key_algorithm, buyer_email, payment_method, payment_amount, payment_currency,
-			payment_tx_hash, payment_chain, sender_address, confirmation_block,
-			payment_intent_id, credits_transaction_id, status, status_message,
-			created_at, updated_at, payment_deadline, payment_confirmed_at,
-			grant_issued_at, grant_id, provider_peer_id, provider_acknowledged_at,
-			preferred_delivery_method, webhook_url, buyer_signature, provider_signature
+		SELECT `+purchaseColumns+`
 		FROM storefront_purchases WHERE provider_peer_id = ?
 		ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, providerPeerID, limit, offset)
@@ -1102,33 +1349,12 @@ func (s *Store) GetProviderPurchases(providerPeerID string, limit, offset int) (
 
 	var purchases []*PurchaseRequest
 	for rows.Next() {
-		var req PurchaseRequest
-		var createdAt, updatedAt, paymentDeadline, paymentConfirmedAt, grantIssuedAt, providerAcknowledgedAt int64
-
-		err := rows.Scan(
-			&req.RequestID, &req.ListingID, &req.TierName, &req.BuyerPeerID,
-			&req.BuyerEncryptionPubkey, &req.KeyAlgorithm, &req.BuyerEmail,
-			&req.PaymentMethod, &req.PaymentAmount, &req.PaymentCurrency,
-			&req.PaymentTxHash, &req.PaymentChain, &req.SenderAddress, &req.ConfirmationBlock,
-			&req.PaymentIntentID, &req.CreditsTransactionID, &req.Status, &req.StatusMessage,
-			&createdAt, &updatedAt, &paymentDeadline, &paymentConfirmedAt,
-			&grantIssuedAt, &req.GrantID, &req.ProviderPeerID, &providerAcknowledgedAt,
-			&req.PreferredDeliveryMethod, &req.WebhookURL,
-			&req.BuyerSignature, &req.ProviderSignature,
-		)
+		req, err := scanPurchase(rows)
 		if err != nil {
 			log.Warnf("Failed to scan purchase row: %v", err)
 			continue
 		}
-
-		req.CreatedAt = time.Unix(createdAt, 0)
-		req.UpdatedAt = time.Unix(updatedAt, 0)
-		req.PaymentDeadline = time.Unix(paymentDeadline, 0)
-		req.PaymentConfirmedAt = time.Unix(paymentConfirmedAt, 0)
-		req.GrantIssuedAt = time.Unix(grantIssuedAt, 0)
-		req.ProviderAcknowledgedAt = time.Unix(providerAcknowledgedAt, 0)
-
-		purchases = append(purchases, &req)
+		purchases = append(purchases, req)
 	}
 
 	return purchases, total, nil
@@ -1141,23 +1367,281 @@ func (s *Store) CreateCreditsTransaction(tx *CreditsTransaction) error {
 
 	_, err := s.db.Exec(`
 		INSERT INTO storefront_credits_transactions (
-			transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status, role
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, tx.TransactionID, tx.FromPeerID, tx.ToPeerID, tx.Amount,
-		tx.Type, tx.Reference, tx.CreatedAt.Unix(), tx.Status)
+		tx.Type, tx.Reference, tx.CreatedAt.Unix(), tx.Status, tx.Role)
 	if err != nil {
 		return fmt.Errorf("failed to create credits transaction: %w", err)
 	}
 	return nil
 }
 
+// TransferCredits atomically debits the sum of payouts from fromPeerID and
+// credits each payee, recording one transaction per leg. Nothing is moved if
+// the payer's balance is insufficient.
+func (s *Store) TransferCredits(fromPeerID string, payouts []Payout, txType, reference string) ([]*CreditsTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transfer: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	txs, err := transferCredits(dbTx, fromPeerID, payouts, txType, reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transfer: %w", err)
+	}
+	return txs, nil
+}
+
+// SettleInvoice marks an unpaid invoice paid and transfers its payouts from
+// fromPeerID in one database transaction, so an invoice is charged at most
+// once. It returns ErrInvoiceSettled if the invoice is no longer unpaid.
+func (s *Store) SettleInvoice(invoiceID, fromPeerID string, payouts []Payout) ([]*CreditsTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin invoice settlement: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	result, err := dbTx.Exec(`
+		UPDATE storefront_invoices SET status = ?, paid_at = ?
+		WHERE invoice_id = ? AND status = ?
+	`, InvoiceStatusPaid, time.Now().Unix(), invoiceID, InvoiceStatusUnpaid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark invoice paid: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvoiceSettled, invoiceID)
+	}
+
+	txs, err := transferCredits(dbTx, fromPeerID, payouts, "usage", invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) > 0 {
+		if _, err := dbTx.Exec(`
+			UPDATE storefront_invoices SET credits_transaction_id = ? WHERE invoice_id = ?
+		`, txs[0].TransactionID, invoiceID); err != nil {
+			return nil, fmt.Errorf("failed to mark invoice paid: %w", err)
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invoice settlement: %w", err)
+	}
+	return txs, nil
+}
+
+func transferCredits(dbTx *sql.Tx, fromPeerID string, payouts []Payout, txType, reference string) ([]*CreditsTransaction, error) {
+	var total uint64
+	for _, p := range payouts {
+		if total+p.Amount < total {
+			return nil, fmt.Errorf("transfer amount overflows")
+		}
+		total += p.Amount
+	}
+
+	now := time.Now()
+	result, err := dbTx.Exec(`
+		UPDATE storefront_credits
+		SET balance = balance - ?, total_spent = total_spent + ?, updated_at = ?
+		WHERE peer_id = ? AND balance >= ?
+	`, total, total, now.Unix(), fromPeerID, total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deduct credits: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("%w for peer %s (need %d)", ErrInsufficientCredits, fromPeerID, total)
+	}
+
+	txs := make([]*CreditsTransaction, 0, len(payouts))
+	for _, p := range payouts {
+		_, err := dbTx.Exec(`
+			INSERT INTO storefront_credits (peer_id, balance, total_earned, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(peer_id) DO UPDATE SET
+				balance = balance + excluded.balance,
+				total_earned = total_earned + excluded.total_earned,
+				updated_at = excluded.updated_at
+		`, p.PeerID, p.Amount, p.Amount, now.Unix())
+		if err != nil {
+			return nil, fmt.Errorf("failed to credit %s: %w", p.PeerID, err)
+		}
+
+		tx := &CreditsTransaction{
+			TransactionID: uuid.New().String(),
+			FromPeerID:    fromPeerID,
+			ToPeerID:      p.PeerID,
+			Amount:        p.Amount,
+			Type:          txType,
+			Reference:     reference,
+			Role:          p.Role,
+			CreatedAt:     now,
+			Status:        "completed",
+		}
+		_, err = dbTx.Exec(`
+			INSERT INTO storefront_credits_transactions (
+				transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status, role
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, tx.TransactionID, tx.FromPeerID, tx.ToPeerID, tx.Amount,
+			tx.Type, tx.Reference, tx.CreatedAt.Unix(), tx.Status, tx.Role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record credits transaction: %w", err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// RefundTransfer reverses the legs of a transfer in one database
+// transaction: each payee is debited its leg and toPeerID is credited the
+// total, recording one refund transaction per leg. Either every leg is
+// refunded or none is; a payee that has already spent its share fails the
+// refund with ErrInsufficientCredits rather than going negative.
+func (s *Store) RefundTransfer(toPeerID string, legs []Payout, reference string) ([]*CreditsTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin refund: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	now := time.Now()
+	txs := make([]*CreditsTransaction, 0, len(legs))
+	for _, leg := range legs {
+		result, err := dbTx.Exec(`
+			UPDATE storefront_credits SET balance = balance - ?, updated_at = ?
+			WHERE peer_id = ? AND balance >= ?
+		`, leg.Amount, now.Unix(), leg.PeerID, leg.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update credits for %s: %w", leg.PeerID, err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return nil, fmt.Errorf("%w for peer %s (need %d)", ErrInsufficientCredits, leg.PeerID, leg.Amount)
+		}
+		_, err = dbTx.Exec(`
+			INSERT INTO storefront_credits (peer_id, balance, updated_at)
+			VALUES (?, ?, ?)
+			ON CONFLICT(peer_id) DO UPDATE SET
+				balance = balance + excluded.balance,
+				updated_at = excluded.updated_at
+		`, toPeerID, leg.Amount, now.Unix())
+		if err != nil {
+			return nil, fmt.Errorf("failed to update credits for %s: %w", toPeerID, err)
+		}
+
+		tx := &CreditsTransaction{
+			TransactionID: uuid.New().String(),
+			FromPeerID:    leg.PeerID,
+			ToPeerID:      toPeerID,
+			Amount:        leg.Amount,
+			Type:          "refund",
+			Reference:     reference,
+			Role:          leg.Role,
+			CreatedAt:     now,
+			Status:        "completed",
+		}
+		_, err = dbTx.Exec(`
+			INSERT INTO storefront_credits_transactions (
+				transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status, role
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, tx.TransactionID, tx.FromPeerID, tx.ToPeerID, tx.Amount,
+			tx.Type, tx.Reference, tx.CreatedAt.Unix(), tx.Status, tx.Role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record refund transaction: %w", err)
+		}
+		txs = append(txs, tx)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit refund: %w", err)
+	}
+	return txs, nil
+}
+
+// GetTransferLegs returns the completed legs of a transfer recorded by
+// TransferCredits for the given reference and type.
+func (s *Store) GetTransferLegs(reference, txType string) ([]Payout, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT from_peer_id, to_peer_id, amount, COALESCE(role, '')
+		FROM storefront_credits_transactions
+		WHERE reference = ? AND type = ? AND status = 'completed'
+	`, reference, txType)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query transfer legs: %w", err)
+	}
+	defer rows.Close()
+
+	var legs []Payout
+	var payer string
+	for rows.Next() {
+		var p Payout
+		if err := rows.Scan(&payer, &p.PeerID, &p.Amount, &p.Role); err != nil {
+			continue
+		}
+		legs = append(legs, p)
+	}
+	return legs, payer, nil
+}
+
+// GetPayoutSummary returns the net credits a peer has received from sales and
+// usage billing (less refunds), grouped by the role it was paid in.
+func (s *Store) GetPayoutSummary(peerID string) (*PayoutSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT COALESCE(NULLIF(role, ''), 'provider'),
+			SUM(CASE WHEN to_peer_id = ? THEN amount ELSE -amount END)
+		FROM storefront_credits_transactions
+		WHERE (to_peer_id = ? AND type IN ('purchase', 'usage'))
+			OR (from_peer_id = ? AND type = 'refund')
+		GROUP BY 1
+	`, peerID, peerID, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payouts: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &PayoutSummary{PeerID: peerID, ByRole: make(map[string]uint64)}
+	for rows.Next() {
+		var role string
+		var net int64
+		if err := rows.Scan(&role, &net); err != nil {
+			continue
+		}
+		if net <= 0 {
+			continue
+		}
+		summary.ByRole[role] = uint64(net)
+		summary.Total += uint64(net)
+	}
+	return summary, nil
+}
+
 // GetCreditsTransactions retrieves credit transactions for a peer.
 func (s *Store) GetCreditsTransactions(peerID string, limit, offset int) ([]*CreditsTransaction, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	rows, err := s.db.Query(`
-		SELECT transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status
+		SELECT transaction_id, from_peer_id, to_peer_id, amount, type, reference, created_at, status,
+			COALESCE(role, '')
 		FROM storefront_credits_transactions
 		WHERE from_peer_id = ? OR to_peer_id = ?
 		ORDER BY created_at DESC LIMIT ? OFFSET ?
@@ -1172,7 +1656,7 @@ func (s *Store) GetCreditsTransactions(peerID string, limit, offset int) ([]*Cre
 		var tx CreditsTransaction
 		var createdAt int64
 		err := rows.Scan(&tx.TransactionID, &tx.FromPeerID, &tx.ToPeerID,
-			&tx.Amount, &tx.Type, &tx.Reference, &createdAt, &tx.Status)
+			&tx.Amount, &tx.Type, &tx.Reference, &createdAt, &tx.Status, &tx.Role)
 		if err != nil {
 			continue
 		}
@@ -1201,6 +1685,280 @@ func (s *Store) UpdateGrantUsage(grantID string, requestsIncrement, recordsIncre
 	return nil
 }
 
+// RecordGrantUsage adds usage to a grant's running totals and, when
+// usage.PeriodStart is set, to the grant's metered usage for that billing
+// period. Both updates happen in one transaction.
+func (s *Store) RecordGrantUsage(usage *UsagePeriod) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin usage transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(`
+		UPDATE storefront_grants
+		SET total_requests = total_requests + ?,
+			total_records = total_records + ?,
+			total_bytes = COALESCE(total_bytes, 0) + ?,
+			last_access = ?,
+			updated_at = ?
+		WHERE grant_id = ?
+	`, usage.Requests, usage.Records, usage.Bytes, now, now, usage.GrantID)
+	if err != nil {
+		return fmt.Errorf("failed to update grant usage: %w", err)
+	}
+
+	if !usage.PeriodStart.IsZero() {
+		_, err = tx.Exec(`
+			INSERT INTO storefront_usage (grant_id, period_start, period_end, requests, records, bytes)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(grant_id, period_start) DO UPDATE SET
+				requests = requests + excluded.requests,
+				records = records + excluded.records,
+				bytes = bytes + excluded.bytes
+		`, usage.GrantID, usage.PeriodStart.Unix(), usage.PeriodEnd.Unix(),
+			usage.Requests, usage.Records, usage.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to record metered usage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit usage: %w", err)
+	}
+	return nil
+}
+
+// GetUsagePeriods returns the metered usage history of a grant, newest first.
+func (s *Store) GetUsagePeriods(grantID string) ([]*UsagePeriod, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT grant_id, period_start, period_end, requests, records, bytes, invoice_id
+		FROM storefront_usage WHERE grant_id = ?
+		ORDER BY period_start DESC
+	`, grantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+	return scanUsagePeriods(rows)
+}
+
+// ListBillableUsage returns uninvoiced usage periods that ended at or before
+// the given time, oldest first.
+func (s *Store) ListBillableUsage(before time.Time, limit int) ([]*UsagePeriod, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT grant_id, period_start, period_end, requests, records, bytes, invoice_id
+		FROM storefront_usage WHERE invoice_id = '' AND period_end <= ?
+		ORDER BY period_end ASC LIMIT ?
+	`, before.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query billable usage: %w", err)
+	}
+	defer rows.Close()
+	return scanUsagePeriods(rows)
+}
+
+func scanUsagePeriods(rows *sql.Rows) ([]*UsagePeriod, error) {
+	var periods []*UsagePeriod
+	for rows.Next() {
+		var u UsagePeriod
+		var start, end int64
+		if err := rows.Scan(&u.GrantID, &start, &end, &u.Requests, &u.Records, &u.Bytes, &u.InvoiceID); err != nil {
+			log.Warnf("Failed to scan usage row: %v", err)
+			continue
+		}
+		u.PeriodStart = time.Unix(start, 0)
+		u.PeriodEnd = time.Unix(end, 0)
+		periods = append(periods, &u)
+	}
+	return periods, nil
+}
+
+// CreateInvoice stores an invoice and marks the usage period it covers as
+// invoiced.
+func (s *Store) CreateInvoice(inv *Invoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin invoice transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO storefront_invoices (
+			invoice_id, grant_id, listing_id, tier_name, buyer_peer_id, provider_peer_id,
+			period_start, period_end, requests, records, bytes,
+			records_amount, bytes_amount, total_amount, status,
+			credits_transaction_id, created_at, paid_at, provider_signature
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		inv.InvoiceID, inv.GrantID, inv.ListingID, inv.TierName, inv.BuyerPeerID, inv.ProviderPeerID,
+		inv.PeriodStart.Unix(), inv.PeriodEnd.Unix(), inv.Requests, inv.Records, inv.Bytes,
+		inv.RecordsAmount, inv.BytesAmount, inv.TotalAmount, inv.Status,
+		inv.CreditsTransactionID, inv.CreatedAt.Unix(), unixOrZero(inv.PaidAt), inv.ProviderSignature,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE storefront_usage SET invoice_id = ? WHERE grant_id = ? AND period_start = ?
+	`, inv.InvoiceID, inv.GrantID, inv.PeriodStart.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to mark usage invoiced: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit invoice: %w", err)
+	}
+	return nil
+}
+
+const invoiceColumns = `invoice_id, grant_id, listing_id, tier_name, buyer_peer_id, provider_peer_id,
+	period_start, period_end, requests, records, bytes,
+	records_amount, bytes_amount, total_amount, status,
+	credits_transaction_id, created_at, paid_at, provider_signature`
+
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	var inv Invoice
+	var start, end, createdAt, paidAt int64
+	err := row.Scan(
+		&inv.InvoiceID, &inv.GrantID, &inv.ListingID, &inv.TierName, &inv.BuyerPeerID, &inv.ProviderPeerID,
+		&start, &end, &inv.Requests, &inv.Records, &inv.Bytes,
+		&inv.RecordsAmount, &inv.BytesAmount, &inv.TotalAmount, &inv.Status,
+		&inv.CreditsTransactionID, &createdAt, &paidAt, &inv.ProviderSignature,
+	)
+	if err != nil {
+		return nil, err
+	}
+	inv.PeriodStart = time.Unix(start, 0)
+	inv.PeriodEnd = time.Unix(end, 0)
+	inv.CreatedAt = time.Unix(createdAt, 0)
+	if paidAt > 0 {
+		inv.PaidAt = time.Unix(paidAt, 0)
+	}
+	return &inv, nil
+}
+
+// GetInvoice retrieves an invoice by ID.
+func (s *Store) GetInvoice(invoiceID string) (*Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inv, err := scanInvoice(s.db.QueryRow(`
+		SELECT `+invoiceColumns+` FROM storefront_invoices WHERE invoice_id = ?
+	`, invoiceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	return inv, nil
+}
+
+// GetInvoicesByPeer retrieves invoices where the peer is buyer or provider.
+func (s *Store) GetInvoicesByPeer(peerID string, limit, offset int) ([]*Invoice, error) {
+	return s.queryInvoices(`
+		SELECT `+invoiceColumns+` FROM storefront_invoices
+		WHERE buyer_peer_id = ? OR provider_peer_id = ?
+		ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, peerID, peerID, limit, offset)
+}
+
+// ListUnpaidInvoices returns unpaid invoices, oldest first.
+func (s *Store) ListUnpaidInvoices(limit int) ([]*Invoice, error) {
+	return s.queryInvoices(`
+		SELECT `+invoiceColumns+` FROM storefront_invoices
+		WHERE status = ? ORDER BY created_at ASC LIMIT ?
+	`, InvoiceStatusUnpaid, limit)
+}
+
+func (s *Store) queryInvoices(query string, args ...interface{}) ([]*Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []*Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			log.Warnf("Failed to scan invoice row: %v", err)
+			continue
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, nil
+}
+
+// MarkInvoicePaid settles an invoice with the given credits transaction.
+func (s *Store) MarkInvoicePaid(invoiceID, creditsTxID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		UPDATE storefront_invoices SET status = ?, credits_transaction_id = ?, paid_at = ?
+		WHERE invoice_id = ?
+	`, InvoiceStatusPaid, creditsTxID, time.Now().Unix(), invoiceID)
+	if err != nil {
+		return fmt.Errorf("failed to mark invoice paid: %w", err)
+	}
+	return nil
+}
+
+// CountUnpaidInvoices returns the number of unpaid invoices for a grant.
+func (s *Store) CountUnpaidInvoices(grantID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM storefront_invoices WHERE grant_id = ? AND status = ?
+	`, grantID, InvoiceStatusUnpaid).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unpaid invoices: %w", err)
+	}
+	return n, nil
+}
+
+// UpdateGrantStatus updates the status of a grant in the index.
+func (s *Store) UpdateGrantStatus(grantID string, status GrantStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		UPDATE storefront_grants SET status = ?, updated_at = ? WHERE grant_id = ?
+	`, status, time.Now().Unix(), grantID)
+	if err != nil {
+		return fmt.Errorf("failed to update grant status: %w", err)
+	}
+	return nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 // UpdateListingReputation updates the reputation snapshot on a listing.
 func (s *Store) UpdateListingReputation(listingID string, rep ProviderReputation) error {
 	s.mu.Lock()
@@ -1231,7 +1989,7 @@ func (s *Store) GetProviderGrants(providerPeerID string, limit, offset int) ([]*
 			payment_amount, payment_currency, payment_chain, next_renewal,
 			auto_renew, renewal_count, total_requests, total_records,
 			last_access, delivery_topic, created_at, updated_at, notes,
-			provider_signature, provider_peer_id
+			provider_signature, provider_peer_id, COALESCE(total_bytes, 0)
 		FROM storefront_grants WHERE provider_peer_id = ?
 		ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, providerPeerID, limit, offset)
@@ -1255,7 +2013,7 @@ func (s *Store) GetProviderGrants(providerPeerID string, limit, offset int) ([]*
 			&grant.AutoRenew, &grant.RenewalCount, &grant.TotalRequests,
 			&grant.TotalRecords, &lastAccess, &grant.DeliveryTopic,
 			&createdAt, &updatedAt, &grant.Notes,
-			&grant.ProviderSignature, &grant.ProviderPeerID,
+			&grant.ProviderSignature, &grant.ProviderPeerID, &grant.TotalBytes,
 		)
 		if err != nil {
 			log.Warnf("Failed to scan provider grant row: %v", err)
@@ -1326,6 +2084,116 @@ func (s *Store) UpdateListingActive(listingID string, active bool) error {
 	return nil
 }
 
+// PutTombstone records a listing tombstone, keeping the most recent one.
+func (s *Store) PutTombstone(t *ListingTombstone) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		INSERT INTO storefront_tombstones (listing_id, provider_peer_id, removed_at, signature)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(listing_id) DO UPDATE SET
+			provider_peer_id = excluded.provider_peer_id,
+			removed_at = excluded.removed_at,
+			signature = excluded.signature
+		WHERE excluded.removed_at > storefront_tombstones.removed_at
+	`, t.ListingID, t.ProviderPeerID, t.RemovedAt.Unix(), t.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to store tombstone: %w", err)
+	}
+	return nil
+}
+
+// GetTombstone returns the tombstone for a listing, or nil if none exists.
+func (s *Store) GetTombstone(listingID string) (*ListingTombstone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var t ListingTombstone
+	var removedAt int64
+	err := s.db.QueryRow(`
+		SELECT listing_id, provider_peer_id, removed_at, signature
+		FROM storefront_tombstones WHERE listing_id = ?
+	`, listingID).Scan(&t.ListingID, &t.ProviderPeerID, &removedAt, &t.Signature)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tombstone: %w", err)
+	}
+	t.RemovedAt = time.Unix(removedAt, 0)
+	return &t, nil
+}
+
+// PutWatermark records the grant a watermark tag was issued for.
+func (s *Store) PutWatermark(tag, grantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		INSERT OR IGNORE INTO storefront_watermarks (tag, grant_id, created_at) VALUES (?, ?, ?)
+	`, tag, grantID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store watermark: %w", err)
+	}
+	return nil
+}
+
+// GetWatermarkGrant returns the grant a watermark tag was issued for, or ""
+// if the tag is unknown.
+func (s *Store) GetWatermarkGrant(tag string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var grantID string
+	err := s.db.QueryRow(`SELECT grant_id FROM storefront_watermarks WHERE tag = ?`, tag).Scan(&grantID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get watermark: %w", err)
+	}
+	return grantID, nil
+}
+
+// ListActiveListingIDs returns the IDs of active listings from a provider.
+func (s *Store) ListActiveListingIDs(providerPeerID string) ([]string, error) {
+	return s.queryStrings(`
+		SELECT listing_id FROM storefront_listings
+		WHERE provider_peer_id = ? AND active = 1
+	`, providerPeerID)
+}
+
+// ListRemoteProviders returns the providers of active listings discovered
+// from other nodes.
+func (s *Store) ListRemoteProviders() ([]string, error) {
+	return s.queryStrings(`
+		SELECT DISTINCT provider_peer_id FROM storefront_listings
+		WHERE COALESCE(source_peer_id, '') != '' AND active = 1
+	`)
+}
+
+func (s *Store) queryStrings(query string, args ...interface{}) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("failed to scan: %w", err)
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
 // GetProviderEarnings returns total earnings for a provider.
 func (s *Store) GetProviderEarnings(providerPeerID string) (uint64, error) {
 	s.mu.RLock()
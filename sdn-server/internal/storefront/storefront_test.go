@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/peer"
+
 	"github.com/spacedatanetwork/sdn-server/internal/sds"
 	"github.com/spacedatanetwork/sdn-server/internal/storage"
 )
@@ -223,10 +225,13 @@ func TestCatalogPublishAndFetch(t *testing.T) {
 	store := newTestStore(t)
 	mockDHT := &mockDHTStore{data: make(map[string][]byte)}
 	catalog := NewCatalog(store, mockDHT)
+	key := newRemoteProvider(t)
+	pid, _ := peer.IDFromPrivateKey(key)
+	catalog.SetIndexSigner(pid.String(), key.Sign)
 
 	listing := testListing()
 	listing.ListingID = "test-listing-123"
-	listing.ProviderPeerID = "provider-abc"
+	listing.ProviderPeerID = pid.String()
 	listing.CreatedAt = time.Now()
 	listing.UpdatedAt = time.Now()
 	listing.Active = true
@@ -242,7 +247,7 @@ func TestCatalogPublishAndFetch(t *testing.T) {
 	if _, ok := mockDHT.data[DHTKeyListingPrefix+"test-listing-123"]; !ok {
 		t.Error("listing not published to DHT")
 	}
-	if _, ok := mockDHT.data[DHTKeyProviderPrefix+"provider-abc/listings"]; !ok {
+	if _, ok := mockDHT.data[DHTKeyProviderPrefix+pid.String()+"/listings"]; !ok {
 		t.Error("provider index not published to DHT")
 	}
 
@@ -265,21 +270,23 @@ func TestIndexerComputeFacets(t *testing.T) {
 	// Index some listings
 	l1 := testListing()
 	l1.ListingID = "facet-1"
-	l1.ProviderPeerID = "p1"
 	l1.DataTypes = []string{"CDM", "TCA"}
 	l1.CreatedAt = time.Now()
 	l1.UpdatedAt = time.Now()
 	l1.Active = true
-	indexer.IndexListing(l1)
+	p1 := signRemoteListing(t, newRemoteProvider(t), l1)
+	if err := indexer.IndexListing(l1); err != nil {
+		t.Fatalf("IndexListing failed: %v", err)
+	}
 
 	l2 := testListing()
 	l2.ListingID = "facet-2"
-	l2.ProviderPeerID = "p2"
 	l2.DataTypes = []string{"OMM"}
 	l2.AccessType = AccessTypeOneTime
 	l2.CreatedAt = time.Now()
 	l2.UpdatedAt = time.Now()
 	l2.Active = true
+	signRemoteListing(t, newRemoteProvider(t), l2)
 	indexer.IndexListing(l2)
 
 	facets, err := indexer.ComputeFacets(&SearchQuery{})
@@ -290,8 +297,8 @@ func TestIndexerComputeFacets(t *testing.T) {
 	if facets.DataTypes["CDM"] != 1 {
 		t.Errorf("CDM facet = %d, want 1", facets.DataTypes["CDM"])
 	}
-	if facets.Providers["p1"] != 1 {
-		t.Errorf("p1 facet = %d, want 1", facets.Providers["p1"])
+	if facets.Providers[p1] != 1 {
+		t.Errorf("p1 facet = %d, want 1", facets.Providers[p1])
 	}
 }
 
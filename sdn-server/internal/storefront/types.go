@@ -99,6 +99,17 @@ type PricingTier struct {
 	MaxRecordsPerRequest uint32   `json:"max_records_per_request"`
 	Features             []string `json:"features"`
 	Description          string   `json:"description"`
+
+	// Metered pricing, charged in SDN credits at the end of each billing
+	// period on top of (or instead of) PriceAmount.
+	PricePer1KRecords uint64 `json:"price_per_1k_records,omitempty"`
+	PricePerGB        uint64 `json:"price_per_gb,omitempty"`
+	BillingPeriodDays uint32 `json:"billing_period_days,omitempty"` // default 30
+}
+
+// IsMetered reports whether the tier charges for usage.
+func (t *PricingTier) IsMetered() bool {
+	return t.PricePer1KRecords > 0 || t.PricePerGB > 0
 }
 
 // ProviderReputation represents provider reputation metrics
@@ -139,6 +150,61 @@ type Listing struct {
 	License           string             `json:"license"`
 	Signature         []byte             `json:"signature"`
 	SourcePeerID      string             `json:"source_peer_id,omitempty"` // empty = local, set = discovered from remote peer
+	RevenueSplits     []RevenueSplit     `json:"revenue_splits,omitempty"`
+	Provenance        ProvenanceOptions  `json:"provenance"`
+}
+
+// ProvenanceOptions controls how delivered records are bound to the grant
+// they were sold under
+type ProvenanceOptions struct {
+	Envelope  bool `json:"envelope"`  // wrap each record in a signed provenance envelope
+	Watermark bool `json:"watermark"` // mark each record with a per-grant watermark tag
+
+	// WatermarkFields are the field ids of double fields in the record's
+	// root table whose lowest mantissa bits may carry the watermark, so it
+	// survives the trailer being stripped. Only list fields whose precision
+	// past the 44th significant bit does not matter.
+	WatermarkFields []int `json:"watermark_fields,omitempty"`
+}
+
+// Revenue split roles
+const (
+	SplitRoleProvider     = "provider"
+	SplitRolePlatform     = "platform"
+	SplitRoleCoOwner      = "co_owner"
+	SplitRolePluginAuthor = "plugin_author"
+)
+
+// RevenueSplit routes a share of each sale of a listing to another peer.
+// Whatever is not assigned by splits (or the platform fee) goes to the provider.
+type RevenueSplit struct {
+	PeerID      string `json:"peer_id"`
+	Role        string `json:"role"`         // co_owner, plugin_author, ...
+	BasisPoints uint32 `json:"basis_points"` // 250 = 2.5%
+}
+
+// ListingTombstone is a provider-signed notice that a listing was withdrawn.
+// Nodes keep tombstones so stale announcements of the listing are ignored.
+type ListingTombstone struct {
+	ListingID      string    `json:"listing_id"`
+	ProviderPeerID string    `json:"provider_peer_id"`
+	RemovedAt      time.Time `json:"removed_at"`
+	Signature      []byte    `json:"signature"`
+}
+
+// Payout is one leg of a split credits transfer
+type Payout struct {
+	PeerID string `json:"peer_id"`
+	Role   string `json:"role"`
+	Amount uint64 `json:"amount"`
+}
+
+// PayoutSummary reports credits received by a peer, broken down by the role
+// it was paid in
+type PayoutSummary struct {
+	PeerID string            `json:"peer_id"`
+	Total  uint64            `json:"total"`
+	ByRole map[string]uint64 `json:"by_role"`
 }
 
 // AccessGrant represents a data access grant (ACL)
@@ -165,6 +231,7 @@ type AccessGrant struct {
 	RenewalCount         uint32        `json:"renewal_count"`
 	TotalRequests        uint64        `json:"total_requests"`
 	TotalRecords         uint64        `json:"total_records"`
+	TotalBytes           uint64        `json:"total_bytes"`
 	LastAccess           time.Time     `json:"last_access"`
 	DeliveryTopic        string        `json:"delivery_topic"`
 	CreatedAt            time.Time     `json:"created_at"`
@@ -206,6 +273,8 @@ type PurchaseRequest struct {
 	WebhookURL            string         `json:"webhook_url"`
 	BuyerSignature        []byte         `json:"buyer_signature"`
 	ProviderSignature     []byte         `json:"provider_signature"`
+	DepositAddress        string         `json:"deposit_address,omitempty"` // unique per-purchase receive address
+	DepositIndex          uint32         `json:"deposit_index,omitempty"`   // HD derivation index of DepositAddress
 }
 
 // DataQualityMetrics represents data quality assessment
@@ -306,8 +375,52 @@ type CreditsTransaction struct {
 	FromPeerID    string        `json:"from_peer_id"`
 	ToPeerID      string        `json:"to_peer_id"`
 	Amount        uint64        `json:"amount"`
-	Type          string        `json:"type"` // purchase, refund, deposit, withdrawal
+	Type          string        `json:"type"` // purchase, refund, deposit, withdrawal, usage
 	Reference     string        `json:"reference"` // purchase_id, etc.
+	Role          string        `json:"role,omitempty"` // payee role for split payouts
 	CreatedAt     time.Time     `json:"created_at"`
 	Status        string        `json:"status"`
 }
+
+// InvoiceStatus represents the settlement state of a usage invoice
+type InvoiceStatus int
+
+const (
+	InvoiceStatusUnpaid InvoiceStatus = iota
+	InvoiceStatusPaid
+)
+
+// UsagePeriod aggregates metered usage of a grant over one billing period
+type UsagePeriod struct {
+	GrantID     string    `json:"grant_id"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Requests    uint64    `json:"requests"`
+	Records     uint64    `json:"records"`
+	Bytes       uint64    `json:"bytes"`
+	InvoiceID   string    `json:"invoice_id,omitempty"`
+}
+
+// Invoice is a provider-signed statement of metered usage for one grant and
+// billing period. Amounts are in SDN credits.
+type Invoice struct {
+	InvoiceID            string        `json:"invoice_id"`
+	GrantID              string        `json:"grant_id"`
+	ListingID            string        `json:"listing_id"`
+	TierName             string        `json:"tier_name"`
+	BuyerPeerID          string        `json:"buyer_peer_id"`
+	ProviderPeerID       string        `json:"provider_peer_id"`
+	PeriodStart          time.Time     `json:"period_start"`
+	PeriodEnd            time.Time     `json:"period_end"`
+	Requests             uint64        `json:"requests"`
+	Records              uint64        `json:"records"`
+	Bytes                uint64        `json:"bytes"`
+	RecordsAmount        uint64        `json:"records_amount"`
+	BytesAmount          uint64        `json:"bytes_amount"`
+	TotalAmount          uint64        `json:"total_amount"`
+	Status               InvoiceStatus `json:"status"`
+	CreditsTransactionID string        `json:"credits_transaction_id,omitempty"`
+	CreatedAt            time.Time     `json:"created_at"`
+	PaidAt               time.Time     `json:"paid_at"`
+	ProviderSignature    []byte        `json:"provider_signature"`
+}
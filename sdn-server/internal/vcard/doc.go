@@ -30,6 +30,7 @@
 //	MULTIFORMAT_ADDRESS    URL (IPNS addresses)
 //	KEYS (Signing)         X-SIGNING-KEY
 //	KEYS (Encryption)      X-ENCRYPTION-KEY
+//	KEYS (license issuer)  X-SDN-LICENSE-ISSUER
 //	ALTERNATE_NAMES        X-ALTERNATE-NAME
 //
 // # vCard Conversion
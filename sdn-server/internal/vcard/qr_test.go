@@ -6,6 +6,8 @@ import (
 
 	"github.com/DigitalArsenal/spacedatastandards.org/lib/go/EPM"
 	flatbuffers "github.com/google/flatbuffers/go"
+
+	"github.com/spacedatanetwork/sdn-server/internal/keys"
 )
 
 func TestVCardToQR(t *testing.T) {
@@ -438,3 +440,23 @@ func BenchmarkEPMQRRoundtrip(b *testing.B) {
 		_, _ = QRToEPM(pngData)
 	}
 }
+
+func TestShareQRRoundtrip(t *testing.T) {
+	shares, err := keys.SplitMnemonic("abandon ability able about above absent absorb abstract", "12D3KooWTestPeer", 2, 3)
+	if err != nil {
+		t.Fatalf("SplitMnemonic failed: %v", err)
+	}
+
+	pngData, err := ShareToQR(shares[1], 512)
+	if err != nil {
+		t.Fatalf("ShareToQR failed: %v", err)
+	}
+
+	share, err := QRToShare(pngData)
+	if err != nil {
+		t.Fatalf("QRToShare failed: %v", err)
+	}
+	if share.String() != shares[1].String() {
+		t.Error("Share changed in QR roundtrip")
+	}
+}
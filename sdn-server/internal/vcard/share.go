@@ -0,0 +1,41 @@
+package vcard
+
+import (
+	"errors"
+
+	qrgen "github.com/skip2/go-qrcode"
+
+	"github.com/spacedatanetwork/sdn-server/internal/keys"
+)
+
+// ShareToQR renders a mnemonic share as a QR code PNG for printing. Shares
+// use high error correction, since paper copies may sit in a safe for years.
+func ShareToQR(share keys.MnemonicShare, size int) ([]byte, error) {
+	if size <= 0 {
+		size = DefaultQRSize
+	}
+	if size > 4096 {
+		return nil, ErrInvalidSize
+	}
+
+	qr, err := qrgen.New(share.String(), qrgen.High)
+	if err != nil {
+		return nil, errors.Join(ErrQREncode, err)
+	}
+
+	pngData, err := qr.PNG(size)
+	if err != nil {
+		return nil, errors.Join(ErrQREncode, err)
+	}
+
+	return pngData, nil
+}
+
+// QRToShare scans a QR code PNG produced by ShareToQR.
+func QRToShare(pngData []byte) (keys.MnemonicShare, error) {
+	text, err := QRToVCard(pngData)
+	if err != nil {
+		return keys.MnemonicShare{}, err
+	}
+	return keys.ParseMnemonicShare(text)
+}
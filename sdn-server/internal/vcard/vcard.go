@@ -12,6 +12,11 @@ import (
 	"github.com/emersion/go-vcard"
 )
 
+// LicenseIssuerAddressType is the CryptoKey ADDRESS_TYPE of a license token
+// issuer key. Its KEY_ADDRESS holds the signed issuer descriptor, which maps
+// to the X-SDN-LICENSE-ISSUER property.
+const LicenseIssuerAddressType = "sdn-license-issuer"
+
 // Errors
 var (
 	ErrEmptyEPM   = errors.New("EPM data is empty")
@@ -111,10 +116,17 @@ func EPMToVCard(epmBytes []byte) (string, error) {
 		}
 	}
 
-	// Cryptographic keys -> X-SIGNING-KEY / X-ENCRYPTION-KEY
+	// Cryptographic keys -> X-SIGNING-KEY / X-ENCRYPTION-KEY, license issuer
+	// descriptor -> X-SDN-LICENSE-ISSUER
 	key := new(EPM.CryptoKey)
 	for i := 0; i < epm.KEYSLength(); i++ {
 		if epm.KEYS(key, i) {
+			if string(key.ADDRESS_TYPE()) == LicenseIssuerAddressType {
+				if desc := key.KEY_ADDRESS(); desc != nil {
+					card.Add("X-SDN-LICENSE-ISSUER", &vcard.Field{Value: string(desc)})
+				}
+				continue
+			}
 			if pubKey := key.PUBLIC_KEY(); pubKey != nil {
 				var fieldName string
 				switch key.KEY_TYPE() {
@@ -295,7 +307,7 @@ func VCardToEPM(vcardStr string) ([]byte, error) {
 		}
 	}
 
-	// X-SIGNING-KEY / X-ENCRYPTION-KEY -> KEYS
+	// X-SIGNING-KEY / X-ENCRYPTION-KEY / X-SDN-LICENSE-ISSUER -> KEYS
 	var keysOffset flatbuffers.UOffsetT
 	signingKeys := card.Values("X-SIGNING-KEY")
 	encryptionKeys := card.Values("X-ENCRYPTION-KEY")
@@ -322,6 +334,18 @@ func VCardToEPM(vcardStr string) ([]byte, error) {
 		}
 	}
 
+	for _, desc := range card.Values("X-SDN-LICENSE-ISSUER") {
+		if desc != "" {
+			descOffset := builder.CreateString(desc)
+			addrTypeOffset := builder.CreateString(LicenseIssuerAddressType)
+			EPM.CryptoKeyStart(builder)
+			EPM.CryptoKeyAddADDRESS_TYPE(builder, addrTypeOffset)
+			EPM.CryptoKeyAddKEY_ADDRESS(builder, descOffset)
+			EPM.CryptoKeyAddKEY_TYPE(builder, EPM.KeyTypeSigning)
+			keyOffsets = append(keyOffsets, EPM.CryptoKeyEnd(builder))
+		}
+	}
+
 	if len(keyOffsets) > 0 {
 		EPM.EPMStartKEYSVector(builder, len(keyOffsets))
 		for i := len(keyOffsets) - 1; i >= 0; i-- {
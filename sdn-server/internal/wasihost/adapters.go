@@ -0,0 +1,227 @@
+package wasihost
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type originKey struct{}
+
+type origin struct {
+	from      string
+	signature []byte
+	data      []byte
+}
+
+// withOrigin records the message being processed, so records the module
+// stores are attributed to its sender rather than to this node.
+func withOrigin(ctx context.Context, from string, signature, data []byte) context.Context {
+	return context.WithValue(ctx, originKey{}, origin{from: from, signature: signature, data: data})
+}
+
+func originFrom(ctx context.Context) origin {
+	o, _ := ctx.Value(originKey{}).(origin)
+	return o
+}
+
+// TopicJoiner returns a joined PubSub topic by name. *node.Node implements it.
+type TopicJoiner interface {
+	Topic(name string) (*pubsub.Topic, error)
+}
+
+// PubSubNetwork backs the module's network imports with the node's GossipSub
+// topics. The module is confined to the per-schema SDS topics.
+type PubSubNetwork struct {
+	topics TopicJoiner
+	self   peer.ID
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	subs map[string]*pubsub.Subscription
+	wg   sync.WaitGroup
+}
+
+// NewPubSubNetwork creates a network adapter. Subscriptions live until ctx is
+// done or Close is called.
+func NewPubSubNetwork(ctx context.Context, topics TopicJoiner, self peer.ID) *PubSubNetwork {
+	ctx, cancel := context.WithCancel(ctx)
+	return &PubSubNetwork{
+		topics: topics,
+		self:   self,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*pubsub.Subscription),
+	}
+}
+
+func checkTopic(topic string) error {
+	if !strings.HasPrefix(topic, TopicPrefix) || len(topic) == len(TopicPrefix) {
+		return fmt.Errorf("topic %q is outside %s", topic, TopicPrefix)
+	}
+	return nil
+}
+
+// SendMessage publishes data to a topic.
+func (n *PubSubNetwork) SendMessage(ctx context.Context, topic string, data []byte) error {
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+	t, err := n.topics.Topic(topic)
+	if err != nil {
+		return err
+	}
+	return t.Publish(n.ctx, data)
+}
+
+// Subscribe delivers messages from other peers on topic to handler.
+// Subscribing to a topic twice is a no-op.
+func (n *PubSubNetwork) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.subs[topic]; ok {
+		return nil
+	}
+	t, err := n.topics.Topic(topic)
+	if err != nil {
+		return err
+	}
+	sub, err := t.Subscribe()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+	n.subs[topic] = sub
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		for {
+			msg, err := sub.Next(n.ctx)
+			if err != nil {
+				if n.ctx.Err() != nil {
+					return
+				}
+				log.Warnf("Error reading from subscription %s: %v", topic, err)
+				continue
+			}
+			if msg.ReceivedFrom == n.self {
+				continue
+			}
+			handler(n.ctx, topic, msg.Data, msg.Signature, msg.GetFrom().String())
+		}
+	}()
+	return nil
+}
+
+// PeerID returns this node's peer ID.
+func (n *PubSubNetwork) PeerID() string {
+	return n.self.String()
+}
+
+// Close cancels all subscriptions.
+func (n *PubSubNetwork) Close() {
+	n.cancel()
+	n.mu.Lock()
+	for topic, sub := range n.subs {
+		sub.Cancel()
+		delete(n.subs, topic)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// RecordStore is the part of storage.FlatSQLStore used by FlatSQLStorage.
+type RecordStore interface {
+	Store(schemaName string, data []byte, peerID string, signature []byte) (string, error)
+	FindByCID(cidPrefix string) (string, []byte, error)
+}
+
+// Admitter decides whether a record may be stored. The node's SDS exchange
+// handler implements it with the rules applied to PubSub messages.
+type Admitter interface {
+	AdmitPubSubMessage(schema string, data []byte, from peer.ID) error
+}
+
+// FlatSQLStorage backs the module's storage imports with the node's FlatSQL
+// store. Records are attributed to the sender of the message being
+// processed, or to this node when the module stores data on its own, and
+// pass the admitter's checks for that peer before they are written. The
+// message being processed was already admitted and stored by the node's own
+// subscription, so storing it again only returns its handle.
+type FlatSQLStorage struct {
+	store  RecordStore
+	admit  Admitter
+	peerID string
+}
+
+// NewFlatSQLStorage creates a storage adapter. admit must not be nil: the
+// module is untrusted and may not write records the network would refuse.
+func NewFlatSQLStorage(store RecordStore, admit Admitter, peerID string) *FlatSQLStorage {
+	return &FlatSQLStorage{store: store, admit: admit, peerID: peerID}
+}
+
+// Store writes a record and returns its handle: the first 8 bytes of its
+// SHA-256 CID.
+func (s *FlatSQLStorage) Store(ctx context.Context, schema string, data []byte) (uint64, error) {
+	o := originFrom(ctx)
+	if o.from != "" && bytes.Equal(data, o.data) {
+		sum := sha256.Sum256(data)
+		return binary.BigEndian.Uint64(sum[:8]), nil
+	}
+	from, signature := o.from, o.signature
+	if from == "" {
+		from = s.peerID
+	}
+	id, err := peer.Decode(from)
+	if err != nil {
+		return 0, fmt.Errorf("invalid origin peer %q: %w", from, err)
+	}
+	if err := s.admit.AdmitPubSubMessage(schema, data, id); err != nil {
+		return 0, fmt.Errorf("record rejected: %w", err)
+	}
+	cid, err := s.store.Store(schema, data, from, signature)
+	if err != nil {
+		return 0, err
+	}
+	return cidHandle(cid)
+}
+
+// Load reads a record by full hex CID or by the decimal handle Store
+// returned.
+func (s *FlatSQLStorage) Load(ctx context.Context, cid string) ([]byte, error) {
+	prefix := cid
+	if len(cid) <= 20 && strings.Trim(cid, "0123456789") == "" {
+		handle, err := strconv.ParseUint(cid, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid handle: %s", cid)
+		}
+		prefix = fmt.Sprintf("%016x", handle)
+	}
+	_, data, err := s.store.FindByCID(prefix)
+	return data, err
+}
+
+func cidHandle(cid string) (uint64, error) {
+	if len(cid) < 16 {
+		return 0, fmt.Errorf("invalid CID: %s", cid)
+	}
+	b, err := hex.DecodeString(cid[:16])
+	if err != nil {
+		return 0, fmt.Errorf("invalid CID: %s", cid)
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
@@ -0,0 +1,163 @@
+package wasihost
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type memRecordStore struct {
+	records map[string][]byte
+	peers   map[string]string
+}
+
+func newMemRecordStore() *memRecordStore {
+	return &memRecordStore{records: make(map[string][]byte), peers: make(map[string]string)}
+}
+
+func (m *memRecordStore) Store(schemaName string, data []byte, peerID string, signature []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	cid := hex.EncodeToString(sum[:])
+	m.records[cid] = data
+	m.peers[cid] = peerID
+	return cid, nil
+}
+
+func (m *memRecordStore) FindByCID(prefix string) (string, []byte, error) {
+	for cid, data := range m.records {
+		if strings.HasPrefix(cid, prefix) {
+			return "OMM.fbs", data, nil
+		}
+	}
+	return "", nil, fmt.Errorf("not found: %s", prefix)
+}
+
+// recordingAdmitter admits records from every peer except deny.
+type recordingAdmitter struct {
+	deny     peer.ID
+	admitted []peer.ID
+}
+
+func (a *recordingAdmitter) AdmitPubSubMessage(schema string, data []byte, from peer.ID) error {
+	if from == a.deny {
+		return errors.New("denied")
+	}
+	a.admitted = append(a.admitted, from)
+	return nil
+}
+
+func testPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key failed: %v", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("IDFromPublicKey failed: %v", err)
+	}
+	return id
+}
+
+func TestFlatSQLStorageAttributesToSender(t *testing.T) {
+	local, remote := testPeerID(t), testPeerID(t)
+	store := newMemRecordStore()
+	admit := &recordingAdmitter{}
+	s := NewFlatSQLStorage(store, admit, local.String())
+
+	handle, err := s.Store(withOrigin(context.Background(), remote.String(), []byte("sig"), nil), "OMM.fbs", []byte("record"))
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte("record"))
+	cid := hex.EncodeToString(sum[:])
+	if store.peers[cid] != remote.String() {
+		t.Errorf("record attributed to %q, want %s", store.peers[cid], remote)
+	}
+
+	if _, err := s.Store(context.Background(), "OMM.fbs", []byte("own")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	sum = sha256.Sum256([]byte("own"))
+	if got := store.peers[hex.EncodeToString(sum[:])]; got != local.String() {
+		t.Errorf("module's own record attributed to %q, want %s", got, local)
+	}
+	if len(admit.admitted) != 2 || admit.admitted[0] != remote || admit.admitted[1] != local {
+		t.Errorf("admitted = %v, want both records checked against their origin", admit.admitted)
+	}
+
+	// The handle and the full CID both load the record.
+	for _, key := range []string{strconv.FormatUint(handle, 10), cid} {
+		data, err := s.Load(context.Background(), key)
+		if err != nil || string(data) != "record" {
+			t.Errorf("Load(%s) = %q, %v", key, data, err)
+		}
+	}
+}
+
+func TestFlatSQLStorageRejectsUnadmittedRecords(t *testing.T) {
+	local, remote := testPeerID(t), testPeerID(t)
+	store := newMemRecordStore()
+	s := NewFlatSQLStorage(store, &recordingAdmitter{deny: remote}, local.String())
+
+	if _, err := s.Store(withOrigin(context.Background(), remote.String(), nil, nil), "OMM.fbs", []byte("record")); err == nil {
+		t.Error("record from a denied peer should be rejected")
+	}
+	if _, err := s.Store(withOrigin(context.Background(), "not-a-peer", nil, nil), "OMM.fbs", []byte("record")); err == nil {
+		t.Error("record with an invalid origin should be rejected")
+	}
+	if len(store.records) != 0 {
+		t.Errorf("rejected records were stored: %d", len(store.records))
+	}
+}
+
+func TestFlatSQLStorageSkipsMessageBeingProcessed(t *testing.T) {
+	local, remote := testPeerID(t), testPeerID(t)
+	store := newMemRecordStore()
+	admit := &recordingAdmitter{}
+	s := NewFlatSQLStorage(store, admit, local.String())
+
+	msg := []byte("record")
+	handle, err := s.Store(withOrigin(context.Background(), remote.String(), nil, msg), "OMM.fbs", msg)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if len(admit.admitted) != 0 || len(store.records) != 0 {
+		t.Errorf("message ingested twice: admitted %v, stored %d", admit.admitted, len(store.records))
+	}
+	sum := sha256.Sum256(msg)
+	if want := hex.EncodeToString(sum[:8]); fmt.Sprintf("%016x", handle) != want {
+		t.Errorf("handle = %016x, want %s", handle, want)
+	}
+
+	// A record the module derives from the message is still admitted.
+	if _, err := s.Store(withOrigin(context.Background(), remote.String(), nil, msg), "OMM.fbs", []byte("derived")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if len(admit.admitted) != 1 || len(store.records) != 1 {
+		t.Errorf("derived record: admitted %v, stored %d", admit.admitted, len(store.records))
+	}
+}
+
+func TestPubSubNetworkConfinedToSDSTopics(t *testing.T) {
+	n := NewPubSubNetwork(context.Background(), nil, "")
+	defer n.Close()
+
+	for _, topic := range []string{"/sdn/storefront/listings", TopicPrefix, "OMM.fbs"} {
+		if err := n.SendMessage(context.Background(), topic, []byte("x")); err == nil {
+			t.Errorf("SendMessage(%q) should be rejected", topic)
+		}
+		if err := n.Subscribe(context.Background(), topic, nil); err == nil {
+			t.Errorf("Subscribe(%q) should be rejected", topic)
+		}
+	}
+}
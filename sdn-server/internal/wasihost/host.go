@@ -0,0 +1,514 @@
+// Package wasihost runs the sdn-wasi module inside the daemon as a sandboxed
+// processing stage. It implements the module's "env" host imports on top of
+// the node's GossipSub topics and FlatSQL store, and delivers messages from
+// subscribed topics into the module via sdn_process_message.
+package wasihost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+var log = logging.Logger("wasihost")
+
+// TopicPrefix is the topic prefix the module uses for schema topics.
+const TopicPrefix = "/spacedatanetwork/sds/"
+
+// callTimeout bounds a single call into the module.
+const callTimeout = 10 * time.Second
+
+var (
+	ErrUnknownSchema   = errors.New("schema not registered in module")
+	ErrValidation      = errors.New("module rejected message")
+	ErrQueueFull       = errors.New("module message queue full")
+	ErrMessageTooLarge = errors.New("message exceeds module buffer")
+)
+
+// MessageHandler receives messages from a subscribed topic.
+type MessageHandler func(ctx context.Context, topic string, data, signature []byte, from string)
+
+// NetworkHandler backs host_send_message, host_subscribe and host_get_peer_id.
+type NetworkHandler interface {
+	SendMessage(ctx context.Context, topic string, data []byte) error
+	Subscribe(ctx context.Context, topic string, handler MessageHandler) error
+	PeerID() string
+}
+
+// StorageHandler backs host_store_data and host_load_data. Store returns a
+// nonzero 64-bit handle that Load accepts in decimal form.
+type StorageHandler interface {
+	Store(ctx context.Context, schema string, data []byte) (uint64, error)
+	Load(ctx context.Context, cid string) ([]byte, error)
+}
+
+// Config contains host configuration.
+type Config struct {
+	Network NetworkHandler
+	Storage StorageHandler
+
+	// MemoryLimitPages caps module memory in 64KiB pages (default: 512, 32MB).
+	MemoryLimitPages uint32
+}
+
+// Host runs one instance of the sdn-wasi module.
+type Host struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	module   api.Module
+	network  NetworkHandler
+	storage  StorageHandler
+	mu       sync.Mutex
+
+	// schemas and subscribed are replayed into an instance that replaces
+	// one closed by a call timeout. subscribed holds the topics already
+	// subscribed on the network, so a replay does not subscribe twice.
+	schemas    []moduleSchema
+	subscribed map[string]bool
+}
+
+type moduleSchema struct {
+	name    string
+	content []byte
+}
+
+// New instantiates the module. It must be a library build (TinyGo) that
+// exports the sdn_* functions.
+func New(ctx context.Context, wasmBytes []byte, cfg Config) (*Host, error) {
+	pages := cfg.MemoryLimitPages
+	if pages == 0 {
+		pages = 512
+	}
+	// Closing on context done lets callTimeout interrupt a guest stuck in a
+	// loop; without it wazero only observes the context at host calls.
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+
+	h := &Host{
+		runtime:    r,
+		network:    cfg.Network,
+		storage:    cfg.Storage,
+		subscribed: make(map[string]bool),
+	}
+
+	env := r.NewHostModuleBuilder("env")
+	env.NewFunctionBuilder().WithFunc(h.hostLog).Export("host_log")
+	env.NewFunctionBuilder().WithFunc(h.hostSendMessage).Export("host_send_message")
+	env.NewFunctionBuilder().WithFunc(h.hostSubscribe).Export("host_subscribe")
+	env.NewFunctionBuilder().WithFunc(h.hostGetPeerID).Export("host_get_peer_id")
+	env.NewFunctionBuilder().WithFunc(h.hostStoreData).Export("host_store_data")
+	env.NewFunctionBuilder().WithFunc(h.hostLoadData).Export("host_load_data")
+	if _, err := env.Instantiate(ctx); err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate env module: %w", err)
+	}
+
+	compiled, err := r.CompileModule(ctx, wasmBytes)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to compile WASM module: %w", err)
+	}
+	h.compiled = compiled
+	if err := h.instantiate(ctx); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	return h, nil
+}
+
+// instantiate creates a fresh instance of the compiled module.
+func (h *Host) instantiate(ctx context.Context) error {
+	// No filesystem, network or environment is granted; stdout and stderr
+	// are discarded (the module logs through host_log).
+	module, err := h.runtime.InstantiateModule(ctx, h.compiled, wazero.NewModuleConfig().
+		WithStartFunctions("_start"))
+	if err != nil {
+		return fmt.Errorf("failed to instantiate WASM module: %w", err)
+	}
+	for _, name := range []string{"sdn_alloc", "sdn_process_message", "sdn_register_schema", "sdn_subscribe"} {
+		if module.ExportedFunction(name) == nil {
+			module.Close(ctx)
+			return fmt.Errorf("module does not export %s (build it with TinyGo)", name)
+		}
+	}
+	h.module = module
+	return nil
+}
+
+// ensureInstance replaces an instance that a call timeout closed and
+// restores its schemas and subscriptions. The caller holds h.mu.
+func (h *Host) ensureInstance(ctx context.Context) error {
+	if !h.module.IsClosed() {
+		return nil
+	}
+	log.Warnf("WASI module instance was terminated; re-instantiating")
+	if err := h.instantiate(ctx); err != nil {
+		return err
+	}
+	for _, s := range h.schemas {
+		if _, err := h.registerSchema(ctx, s.name, s.content); err != nil {
+			log.Warnf("Failed to re-register schema %s with WASI module: %v", s.name, err)
+			continue
+		}
+		if h.subscribed[TopicPrefix+s.name] {
+			if err := h.subscribe(ctx, s.name); err != nil {
+				log.Warnf("Failed to resubscribe WASI module to %s: %v", s.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close releases the runtime.
+func (h *Host) Close(ctx context.Context) error {
+	return h.runtime.Close(ctx)
+}
+
+// Start registers schemas with the module and subscribes it to their topics.
+// source supplies .fbs content so the module can verify records fully; a
+// schema without source is registered by name only.
+func (h *Host) Start(ctx context.Context, schemas []string, source func(name string) ([]byte, bool)) error {
+	for _, schema := range schemas {
+		var content []byte
+		if source != nil {
+			content, _ = source(schema)
+		}
+		if _, err := h.RegisterSchema(ctx, schema, content); err != nil {
+			log.Warnf("Failed to register schema %s with WASI module: %v", schema, err)
+			continue
+		}
+		if err := h.Subscribe(ctx, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterSchema registers (or replaces) a schema in the module.
+func (h *Host) RegisterSchema(ctx context.Context, name string, content []byte) (int32, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ensureInstance(ctx); err != nil {
+		return 0, err
+	}
+	id, err := h.registerSchema(ctx, name, content)
+	if err != nil {
+		return 0, err
+	}
+	for i := range h.schemas {
+		if h.schemas[i].name == name {
+			h.schemas[i].content = content
+			return id, nil
+		}
+	}
+	h.schemas = append(h.schemas, moduleSchema{name: name, content: content})
+	return id, nil
+}
+
+// registerSchema calls sdn_register_schema. The caller holds h.mu.
+func (h *Host) registerSchema(ctx context.Context, name string, content []byte) (int32, error) {
+	args, err := h.writeArgs(ctx, []byte(name), content)
+	if err != nil {
+		return 0, err
+	}
+	res, err := h.call(ctx, "sdn_register_schema", args...)
+	if err != nil {
+		return 0, err
+	}
+	id := int32(res[0])
+	if id < 0 {
+		return 0, fmt.Errorf("schema %s rejected: %s", name, h.lastError(ctx))
+	}
+	return id, nil
+}
+
+// Subscribe asks the module to subscribe to a schema's topic.
+func (h *Host) Subscribe(ctx context.Context, schema string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ensureInstance(ctx); err != nil {
+		return err
+	}
+	return h.subscribe(ctx, schema)
+}
+
+// subscribe calls sdn_subscribe. The caller holds h.mu.
+func (h *Host) subscribe(ctx context.Context, schema string) error {
+	args, err := h.writeArgs(ctx, []byte(schema))
+	if err != nil {
+		return err
+	}
+	res, err := h.call(ctx, "sdn_subscribe", args...)
+	if err != nil {
+		return err
+	}
+	if code := int32(res[0]); code != 0 {
+		return fmt.Errorf("failed to subscribe module to %s: code %d", schema, code)
+	}
+	return nil
+}
+
+// ProcessMessage passes a message through the module, which validates it and
+// stores accepted records via host_store_data.
+func (h *Host) ProcessMessage(ctx context.Context, schema string, data, signature []byte, from string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ensureInstance(ctx); err != nil {
+		return err
+	}
+	args, err := h.writeArgs(ctx, []byte(schema), data, signature, []byte(from))
+	if err != nil {
+		return err
+	}
+	res, err := h.call(withOrigin(ctx, from, signature, data), "sdn_process_message", args...)
+	if err != nil {
+		return err
+	}
+
+	switch int32(res[0]) {
+	case 0:
+	case -1:
+		return ErrUnknownSchema
+	case -2:
+		return fmt.Errorf("%w: %s", ErrValidation, h.lastError(ctx))
+	case -3:
+		return ErrQueueFull
+	default:
+		return fmt.Errorf("sdn_process_message returned %d", int32(res[0]))
+	}
+
+	// The daemon consumes records through storage, so the module's own
+	// queue is drained to keep it from filling up.
+	if fn := h.module.ExportedFunction("sdn_clear_messages"); fn != nil {
+		if _, err := fn.Call(ctx); err != nil {
+			return fmt.Errorf("sdn_clear_messages: %w", err)
+		}
+	}
+	return nil
+}
+
+// deliver is the MessageHandler for topics the module subscribed to.
+func (h *Host) deliver(ctx context.Context, topic string, data, signature []byte, from string) {
+	schema := strings.TrimPrefix(topic, TopicPrefix)
+	if err := h.ProcessMessage(ctx, schema, data, signature, from); err != nil {
+		log.Debugf("WASI module dropped %s message from %s: %v", schema, from, err)
+	}
+}
+
+// call invokes an export with a timeout. The caller holds h.mu.
+func (h *Host) call(ctx context.Context, name string, args ...uint64) ([]uint64, error) {
+	fn := h.module.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("function not found: %s", name)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	res, err := fn.Call(callCtx, args...)
+	if err != nil {
+		if h.module.IsClosed() {
+			log.Warnf("WASI module %s interrupted: %v", name, err)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return res, nil
+}
+
+// writeArgs lays parts out back to back in the module's shared buffer and
+// returns (ptr, len) pairs for them. The caller holds h.mu.
+func (h *Host) writeArgs(ctx context.Context, parts ...[]byte) ([]uint64, error) {
+	total := 0
+	for _, p := range parts {
+		total += len(p)
+	}
+	res, err := h.call(ctx, "sdn_alloc", uint64(total))
+	if err != nil {
+		return nil, err
+	}
+	base := uint32(res[0])
+
+	// Modules with a fixed shared buffer ignore the requested size.
+	if fn := h.module.ExportedFunction("sdn_get_buffer_len"); fn != nil {
+		if n, err := fn.Call(ctx); err == nil && uint64(total) > n[0] {
+			return nil, ErrMessageTooLarge
+		}
+	}
+
+	args := make([]uint64, 0, 2*len(parts))
+	off := base
+	for _, p := range parts {
+		if len(p) > 0 && !h.module.Memory().Write(off, p) {
+			return nil, ErrMessageTooLarge
+		}
+		args = append(args, uint64(off), uint64(len(p)))
+		off += uint32(len(p))
+	}
+	return args, nil
+}
+
+// lastError returns the module's description of the last failure.
+func (h *Host) lastError(ctx context.Context) string {
+	fn := h.module.ExportedFunction("sdn_last_error")
+	if fn == nil {
+		return "no details"
+	}
+	res, err := fn.Call(ctx)
+	if err != nil || res[0] == 0 {
+		return "no details"
+	}
+	data, ok := h.readShared(ctx, uint32(res[0]))
+	if !ok {
+		return "no details"
+	}
+	var verr struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &verr) != nil || verr.Message == "" {
+		return string(data)
+	}
+	return verr.Message
+}
+
+func (h *Host) readShared(ctx context.Context, length uint32) ([]byte, bool) {
+	fn := h.module.ExportedFunction("sdn_get_buffer_ptr")
+	if fn == nil {
+		return nil, false
+	}
+	res, err := fn.Call(ctx)
+	if err != nil {
+		return nil, false
+	}
+	data, ok := h.module.Memory().Read(uint32(res[0]), length)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+// Host imports. Return codes follow the sdn-wasi ABI: 0 is success for
+// send/subscribe, and 0 means failure for store/load/peer ID.
+
+func (h *Host) hostLog(ctx context.Context, m api.Module, ptr, length uint32) {
+	const maxLogLen = 4096
+	if length > maxLogLen {
+		length = maxLogLen
+	}
+	data, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		return
+	}
+	msg := strings.Map(func(r rune) rune {
+		if r < 0x20 && r != ' ' {
+			return '?'
+		}
+		return r
+	}, string(data))
+	log.Debugf("[wasi] %s", msg)
+}
+
+func (h *Host) hostSendMessage(ctx context.Context, m api.Module, topicPtr, topicLen, dataPtr, dataLen uint32) uint32 {
+	topic, ok := m.Memory().Read(topicPtr, topicLen)
+	if !ok {
+		return 1
+	}
+	data, ok := m.Memory().Read(dataPtr, dataLen)
+	if !ok {
+		return 2
+	}
+	if h.network == nil {
+		return 3
+	}
+	if err := h.network.SendMessage(ctx, string(topic), append([]byte(nil), data...)); err != nil {
+		log.Warnf("WASI module send to %s failed: %v", topic, err)
+		return 4
+	}
+	return 0
+}
+
+func (h *Host) hostSubscribe(ctx context.Context, m api.Module, topicPtr, topicLen uint32) uint32 {
+	topic, ok := m.Memory().Read(topicPtr, topicLen)
+	if !ok {
+		return 1
+	}
+	if h.network == nil {
+		return 2
+	}
+	// A replacement instance resubscribes to topics that already deliver
+	// to the host. Host imports run inside a call, under h.mu.
+	if h.subscribed[string(topic)] {
+		return 0
+	}
+	if err := h.network.Subscribe(ctx, string(topic), h.deliver); err != nil {
+		log.Warnf("WASI module subscribe to %s failed: %v", topic, err)
+		return 3
+	}
+	h.subscribed[string(topic)] = true
+	return 0
+}
+
+func (h *Host) hostGetPeerID(ctx context.Context, m api.Module, bufPtr, bufLen uint32) uint32 {
+	if h.network == nil {
+		return 0
+	}
+	peerID := h.network.PeerID()
+	if uint32(len(peerID)) > bufLen || !m.Memory().Write(bufPtr, []byte(peerID)) {
+		return 0
+	}
+	return uint32(len(peerID))
+}
+
+func (h *Host) hostStoreData(ctx context.Context, m api.Module, schemaPtr, schemaLen, dataPtr, dataLen uint32) uint64 {
+	schema, ok := m.Memory().Read(schemaPtr, schemaLen)
+	if !ok {
+		return 0
+	}
+	data, ok := m.Memory().Read(dataPtr, dataLen)
+	if !ok {
+		return 0
+	}
+	if h.storage == nil {
+		return 0
+	}
+	handle, err := h.storage.Store(ctx, string(schema), append([]byte(nil), data...))
+	if err != nil {
+		log.Warnf("WASI module store failed: %v", err)
+		return 0
+	}
+	return handle
+}
+
+func (h *Host) hostLoadData(ctx context.Context, m api.Module, cidPtr, cidLen, bufPtr, bufLen uint32) uint32 {
+	cid, ok := m.Memory().Read(cidPtr, cidLen)
+	if !ok {
+		return 0
+	}
+	if h.storage == nil {
+		return 0
+	}
+	data, err := h.storage.Load(ctx, string(cid))
+	if err != nil {
+		log.Debugf("WASI module load failed: %v", err)
+		return 0
+	}
+	if uint32(len(data)) > bufLen || !m.Memory().Write(bufPtr, data) {
+		return 0
+	}
+	return uint32(len(data))
+}
@@ -0,0 +1,80 @@
+package wasihost
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// wasmSection encodes one module section. Sizes here stay below 128, so
+// every LEB128 length fits in a byte.
+func wasmSection(id byte, payload ...byte) []byte {
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// spinningModule builds a module exporting the sdn_* entry points the host
+// requires, where sdn_process_message never returns.
+func spinningModule() []byte {
+	const i32 = 0x7f
+	types := []byte{4,
+		0x60, 1, i32, 1, i32, // sdn_alloc
+		0x60, 4, i32, i32, i32, i32, 1, i32, // sdn_register_schema
+		0x60, 2, i32, i32, 1, i32, // sdn_subscribe
+		0x60, 8, i32, i32, i32, i32, i32, i32, i32, i32, 1, i32, // sdn_process_message
+	}
+	exports := []byte{5}
+	exports = append(append(exports, wasmName("memory")...), 0x02, 0)
+	for i, name := range []string{"sdn_alloc", "sdn_register_schema", "sdn_subscribe", "sdn_process_message"} {
+		exports = append(append(exports, wasmName(name)...), 0x00, byte(i))
+	}
+	returnZero := []byte{4, 0x00, 0x41, 0x00, 0x0b}                   // i32.const 0
+	spin := []byte{8, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b} // loop br 0 end; unreachable
+	code := []byte{4}
+	code = append(code, returnZero...)
+	code = append(code, returnZero...)
+	code = append(code, returnZero...)
+	code = append(code, spin...)
+
+	mod := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	mod = append(mod, wasmSection(1, types...)...)
+	mod = append(mod, wasmSection(3, 4, 0, 1, 2, 3)...)
+	mod = append(mod, wasmSection(5, 1, 0x00, 1)...)
+	mod = append(mod, wasmSection(7, exports...)...)
+	mod = append(mod, wasmSection(10, code...)...)
+	return mod
+}
+
+func TestProcessMessageInterruptsSpinningModule(t *testing.T) {
+	ctx := context.Background()
+	h, err := New(ctx, spinningModule(), Config{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.ProcessMessage(callCtx, "OMM.fbs", []byte("record"), nil, "peer")
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("ProcessMessage should fail when the module does not return")
+		}
+		// The interrupt closes the instance; the next call must run on a
+		// fresh one rather than fail.
+		if _, err := h.RegisterSchema(ctx, "OMM.fbs", []byte("table OMM {}")); err != nil {
+			t.Errorf("RegisterSchema after an interrupted call failed: %v", err)
+		}
+		h.Close(ctx)
+	case <-time.After(5 * time.Second):
+		// The runtime is left running: closing it would wait on the guest.
+		t.Fatal("ProcessMessage was not interrupted at its deadline")
+	}
+}
@@ -0,0 +1,218 @@
+package wasiplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+var (
+	// ErrCallTimeout indicates a plugin call exceeded its wall-time budget.
+	ErrCallTimeout = errors.New("WASI plugin call exceeded its time budget")
+	// ErrFuelExhausted indicates a plugin call exceeded its fuel budget.
+	ErrFuelExhausted = errors.New("WASI plugin call exhausted its fuel budget")
+	// ErrBusy indicates the plugin already has MaxConcurrent calls in flight.
+	ErrBusy = errors.New("WASI plugin is busy")
+	// ErrQuarantined indicates the plugin was disabled after repeatedly
+	// exceeding its budget.
+	ErrQuarantined = errors.New("WASI plugin is quarantined")
+)
+
+// Default budget values.
+const (
+	DefaultMaxConcurrent   = 16
+	DefaultQuarantineAfter = 3
+)
+
+// Budget bounds the execution of a single plugin.
+type Budget struct {
+	// CallTimeout is the wall-time deadline for each plugin call. A call that
+	// runs past it is interrupted and the plugin instance is replaced.
+	CallTimeout time.Duration
+	// MaxFuel, when non-zero, limits the number of guest function calls a
+	// single plugin call may make. Metering adds overhead to every guest
+	// call, so it is off by default; CallTimeout still bounds tight loops.
+	MaxFuel uint64
+	// MaxConcurrent limits calls that are running or waiting for the plugin.
+	// Calls beyond it fail fast with ErrBusy instead of piling up behind a
+	// slow plugin.
+	MaxConcurrent int
+	// QuarantineAfter is the number of consecutive budget violations after
+	// which the plugin is quarantined and every call fails with
+	// ErrQuarantined.
+	QuarantineAfter int
+	// OnQuarantine is called once when the plugin is quarantined, e.g. to
+	// update the plugin registry's runtime status. It must not call back
+	// into the runtime.
+	OnQuarantine func(reason string)
+}
+
+func (b Budget) withDefaults() Budget {
+	if b.CallTimeout <= 0 {
+		b.CallTimeout = pluginCallTimeout
+	}
+	if b.MaxConcurrent <= 0 {
+		b.MaxConcurrent = DefaultMaxConcurrent
+	}
+	if b.QuarantineAfter <= 0 {
+		b.QuarantineAfter = DefaultQuarantineAfter
+	}
+	return b
+}
+
+type fuelKey struct{}
+
+type fuelMeter struct {
+	remaining atomic.Int64
+	cancel    context.CancelCauseFunc
+}
+
+// fuelListenerFactory charges one unit of fuel per guest function call and
+// cancels the call once the meter runs dry.
+var fuelListenerFactory = experimental.FunctionListenerFactoryFunc(
+	func(api.FunctionDefinition) experimental.FunctionListener {
+		return experimental.FunctionListenerFunc(func(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+			if m, ok := ctx.Value(fuelKey{}).(*fuelMeter); ok && m.remaining.Add(-1) < 0 {
+				m.cancel(ErrFuelExhausted)
+			}
+		})
+	})
+
+// begin admits a plugin call: it takes a concurrency slot and the module
+// lock, replaces a terminated instance, and returns a context carrying the
+// call's deadline and fuel. end must be called when the call is done.
+func (rt *Runtime) begin(ctx context.Context, name string) (context.Context, func(), error) {
+	if reason := rt.quarantined.Load(); reason != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrQuarantined, *reason)
+	}
+	select {
+	case rt.slots <- struct{}{}:
+	default:
+		return nil, nil, ErrBusy
+	}
+	rt.mu.Lock()
+	release := func() {
+		rt.mu.Unlock()
+		<-rt.slots
+	}
+
+	// Re-check under the lock: the call ahead of us may have tripped it.
+	if reason := rt.quarantined.Load(); reason != nil {
+		release()
+		return nil, nil, fmt.Errorf("%w: %s", ErrQuarantined, *reason)
+	}
+	if err := rt.ensureInstance(ctx); err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	callCtx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(rt.budget.CallTimeout, func() { cancel(ErrCallTimeout) })
+	if rt.budget.MaxFuel > 0 {
+		m := &fuelMeter{cancel: cancel}
+		m.remaining.Store(int64(rt.budget.MaxFuel))
+		callCtx = context.WithValue(callCtx, fuelKey{}, m)
+	}
+
+	end := func() {
+		timer.Stop()
+		if cause := budgetCause(callCtx); cause != nil && rt.module.IsClosed() {
+			rt.recordViolation(name, cause)
+		} else if callCtx.Err() == nil {
+			rt.violations = 0
+		}
+		cancel(nil)
+		release()
+	}
+	return callCtx, end, nil
+}
+
+// budgetCause reports whether ctx was cancelled by the call budget.
+func budgetCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrCallTimeout) || errors.Is(cause, ErrFuelExhausted) {
+		return cause
+	}
+	return nil
+}
+
+// budgetErr replaces the error of an interrupted call with the budget it
+// exceeded, so callers can match it with errors.Is.
+func budgetErr(ctx context.Context, err error) error {
+	if cause := budgetCause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// ensureInstance replaces a plugin instance that wazero terminated for
+// running past its budget, replaying plugin_init so the plugin keeps its
+// configuration. Callers must hold rt.mu.
+func (rt *Runtime) ensureInstance(ctx context.Context) error {
+	if !rt.module.IsClosed() {
+		return nil
+	}
+	log.Warnf("WASI plugin instance was terminated; re-instantiating")
+	if err := rt.instantiate(ctx); err != nil {
+		return err
+	}
+	if rt.initConfig == nil {
+		return nil
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, rt.budget.CallTimeout)
+	defer cancel()
+	configPtr, err := rt.allocate(initCtx, rt.initConfig)
+	if err != nil {
+		return fmt.Errorf("failed to allocate config: %w", err)
+	}
+	defer rt.deallocate(initCtx, configPtr)
+	results, err := rt.initFn.Call(initCtx, uint64(configPtr), uint64(len(rt.initConfig)))
+	if err != nil {
+		return fmt.Errorf("plugin_init call failed: %w", err)
+	}
+	if status := api.DecodeI32(results[0]); status != 0 {
+		return fmt.Errorf("plugin_init returned error status %d", status)
+	}
+	return nil
+}
+
+// recordViolation counts a budget violation and quarantines the plugin once
+// QuarantineAfter violations happen in a row. Callers must hold rt.mu.
+func (rt *Runtime) recordViolation(name string, cause error) {
+	rt.violations++
+	log.Warnf("WASI plugin %s interrupted (%d/%d): %v", name, rt.violations, rt.budget.QuarantineAfter, cause)
+	if rt.violations < rt.budget.QuarantineAfter {
+		return
+	}
+
+	reason := fmt.Sprintf("%d consecutive budget violations, last in %s: %v", rt.violations, name, cause)
+	if !rt.quarantined.CompareAndSwap(nil, &reason) {
+		return
+	}
+	log.Errorf("WASI plugin quarantined: %s", reason)
+	if rt.budget.OnQuarantine != nil {
+		rt.budget.OnQuarantine(reason)
+	}
+}
+
+// Quarantined reports whether the plugin is quarantined and why.
+func (rt *Runtime) Quarantined() (string, bool) {
+	if reason := rt.quarantined.Load(); reason != nil {
+		return *reason, true
+	}
+	return "", false
+}
+
+// Release lifts a quarantine, e.g. after an operator has investigated.
+func (rt *Runtime) Release() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.violations = 0
+	rt.quarantined.Store(nil)
+}
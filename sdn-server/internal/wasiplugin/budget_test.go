@@ -0,0 +1,141 @@
+package wasiplugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// spinModule is a minimal plugin whose plugin_init spins forever and whose
+// plugin_handle_request calls a no-op function in an endless loop.
+func spinModule() []byte {
+	section := func(id byte, body ...byte) []byte {
+		return append([]byte{id, byte(len(body))}, body...)
+	}
+	name := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	export := func(s string, kind, idx byte) []byte { return append(name(s), kind, idx) }
+	body := func(code ...byte) []byte { return append([]byte{byte(len(code) + 1), 0}, code...) }
+
+	const i32 = 0x7f
+	types := []byte{5,
+		0x60, 1, i32, 1, i32, // 0: (i32) -> i32
+		0x60, 1, i32, 0, // 1: (i32)
+		0x60, 2, i32, i32, 1, i32, // 2: (i32, i32) -> i32
+		0x60, 6, i32, i32, i32, i32, i32, i32, 1, i32, // 3: (i32 x6) -> i32
+		0x60, 0, 0, // 4: ()
+	}
+	var exports []byte
+	exports = append(exports, 8)
+	exports = append(exports, export("memory", 2, 0)...)
+	for i, fn := range []string{"malloc", "free", "plugin_init", "plugin_get_public_key",
+		"plugin_get_metadata", "plugin_handle_request"} {
+		exports = append(exports, export(fn, 0, byte(i))...)
+	}
+	exports = append(exports, export("nop", 0, 6)...)
+
+	var code []byte
+	code = append(code, 7)
+	code = append(code, body(0x41, 0x80, 0x08, 0x0b)...)                                     // malloc: i32.const 1024
+	code = append(code, body(0x0b)...)                                                       // free
+	code = append(code, body(0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b)...)             // init: loop br 0
+	code = append(code, body(0x41, 0x00, 0x0b)...)                                           // get_public_key
+	code = append(code, body(0x41, 0x00, 0x0b)...)                                           // get_metadata
+	code = append(code, body(0x03, 0x40, 0x10, 0x06, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b)...) // loop call nop
+	code = append(code, body(0x0b)...)                                                       // nop
+
+	var out []byte
+	out = append(out, 0x00, 'a', 's', 'm', 1, 0, 0, 0)
+	out = append(out, section(1, types...)...)
+	out = append(out, section(3, 7, 0, 1, 2, 2, 2, 3, 4)...)
+	out = append(out, section(5, 1, 0, 1)...)
+	out = append(out, section(7, exports...)...)
+	out = append(out, section(10, code...)...)
+	return out
+}
+
+func TestBudgetInterruptsAndQuarantines(t *testing.T) {
+	ctx := context.Background()
+	var quarantined string
+	rt, err := NewWithOptions(ctx, spinModule(), Options{Budget: Budget{
+		CallTimeout:     50 * time.Millisecond,
+		QuarantineAfter: 2,
+		OnQuarantine:    func(reason string) { quarantined = reason },
+	}})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	defer rt.Close(ctx)
+
+	if err := rt.Init(ctx, []byte("config")); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("Init error = %v, want ErrCallTimeout", err)
+	}
+
+	// The terminated instance is replaced and a well-behaved call resets
+	// the violation count.
+	if _, err := rt.GetPublicKey(ctx); err != nil {
+		t.Fatalf("GetPublicKey after timeout: %v", err)
+	}
+	if err := rt.Init(ctx, nil); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("Init error = %v, want ErrCallTimeout", err)
+	}
+	if _, ok := rt.Quarantined(); ok {
+		t.Fatal("quarantined after a single consecutive violation")
+	}
+	if err := rt.Init(ctx, nil); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("Init error = %v, want ErrCallTimeout", err)
+	}
+
+	if _, ok := rt.Quarantined(); !ok || quarantined == "" {
+		t.Fatal("plugin not quarantined after repeated violations")
+	}
+	if _, err := rt.GetPublicKey(ctx); !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("GetPublicKey error = %v, want ErrQuarantined", err)
+	}
+
+	rt.Release()
+	if _, err := rt.GetPublicKey(ctx); err != nil {
+		t.Fatalf("GetPublicKey after release: %v", err)
+	}
+}
+
+func TestBudgetFuelMetering(t *testing.T) {
+	ctx := context.Background()
+	rt, err := NewWithOptions(ctx, spinModule(), Options{Budget: Budget{
+		CallTimeout: 10 * time.Second,
+		MaxFuel:     1000,
+	}})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	defer rt.Close(ctx)
+
+	start := time.Now()
+	if _, _, err := rt.HandleRequest(ctx, []byte{1}, "example.com"); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("HandleRequest error = %v, want ErrFuelExhausted", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("fuel exhaustion took %v", elapsed)
+	}
+}
+
+func TestBudgetConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	rt, err := NewWithOptions(ctx, spinModule(), Options{Budget: Budget{
+		CallTimeout:   time.Second,
+		MaxConcurrent: 1,
+	}})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	defer rt.Close(ctx)
+
+	rt.slots <- struct{}{} // occupy the only slot
+	if _, err := rt.GetPublicKey(ctx); !errors.Is(err, ErrBusy) {
+		t.Fatalf("GetPublicKey error = %v, want ErrBusy", err)
+	}
+	<-rt.slots
+	if _, err := rt.GetPublicKey(ctx); err != nil {
+		t.Fatalf("GetPublicKey: %v", err)
+	}
+}
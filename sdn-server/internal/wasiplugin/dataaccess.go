@@ -0,0 +1,473 @@
+package wasiplugin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/spacedatanetwork/sdn-server/internal/license"
+)
+
+// License scopes that grant data-access capabilities. A bare scope grants the
+// capability for every schema the plugin declares; a scope suffixed with
+// ":<schema>" (e.g. "plugin:data:query:OMM.fbs") grants it for one schema.
+const (
+	ScopeDataQuery     = "plugin:data:query"
+	ScopeDataSubscribe = "plugin:data:subscribe"
+	ScopeDataPublish   = "plugin:data:publish"
+)
+
+// Status codes returned to the guest by the data-access host functions.
+const (
+	dataErrDenied  = -1 // capability not granted for the schema
+	dataErrInvalid = -2 // bad arguments or guest memory out of range
+	dataErrFailed  = -3 // the host data call failed
+)
+
+const (
+	maxSchemaNameLen   = 256
+	maxQueryLen        = 4096
+	maxDataRecordSize  = 1 << 20
+	dataEventQueueSize = 256
+)
+
+// AllSchemas may be declared in place of a schema name to request a
+// capability for every schema. It is only granted by a bare scope.
+const AllSchemas = "*"
+
+// Capabilities lists the schemas a plugin may use for each data-access call.
+// Plugins declare the capabilities they need by exporting
+// plugin_get_capabilities(out_ptr, out_cap) -> len, which writes this struct
+// as JSON.
+type Capabilities struct {
+	Query     []string `json:"query,omitempty"`
+	Subscribe []string `json:"subscribe,omitempty"`
+	Publish   []string `json:"publish,omitempty"`
+}
+
+// DataQuery filters a query by the store's indexed fields. All fields are
+// optional.
+type DataQuery struct {
+	Day        string  `json:"day,omitempty"` // YYYY-MM-DD (UTC)
+	NoradCatID *uint32 `json:"norad_cat_id,omitempty"`
+	EntityID   string  `json:"entity_id,omitempty"`
+	Limit      int     `json:"limit,omitempty"`
+}
+
+// DataAccess is the node-side backend of the data-access host functions.
+type DataAccess interface {
+	// Query returns stored records of schema matching q, newest first.
+	Query(ctx context.Context, schema string, q DataQuery) ([][]byte, error)
+	// Subscribe calls fn for each new record of schema until the returned
+	// cancel function is called. fn must not block.
+	Subscribe(schema string, fn func(data []byte)) (func(), error)
+	// Publish validates, stores and announces a record, returning its CID.
+	Publish(ctx context.Context, schema string, data []byte) (string, error)
+}
+
+// Options configures optional runtime features.
+type Options struct {
+	// Data backs the data-access host functions. Without it every data call
+	// is denied.
+	Data DataAccess
+	// Claims are the license claims the plugin runs under. Declared
+	// capabilities are only granted when the claims carry a matching scope.
+	Claims *license.CapabilityClaims
+	// Manifest, when set, is the capability set the plugin's publisher
+	// signed. A plugin declaring capabilities beyond it fails to load.
+	Manifest *Capabilities
+	// Budget bounds plugin execution. Zero fields take defaults.
+	Budget Budget
+}
+
+type dataEvent struct {
+	schema string
+	data   []byte
+}
+
+// Beyond returns the capabilities in c that manifest does not cover. A
+// manifest entry of AllSchemas covers every schema.
+func (c Capabilities) Beyond(manifest Capabilities) Capabilities {
+	return Capabilities{
+		Query:     schemasBeyond(c.Query, manifest.Query),
+		Subscribe: schemasBeyond(c.Subscribe, manifest.Subscribe),
+		Publish:   schemasBeyond(c.Publish, manifest.Publish),
+	}
+}
+
+// Empty reports whether c grants nothing.
+func (c Capabilities) Empty() bool {
+	return len(c.Query) == 0 && len(c.Subscribe) == 0 && len(c.Publish) == 0
+}
+
+func schemasBeyond(schemas, allowed []string) []string {
+	var extra []string
+	for _, schema := range schemas {
+		covered := false
+		for _, a := range allowed {
+			if a == AllSchemas || a == schema {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			extra = append(extra, schema)
+		}
+	}
+	return extra
+}
+
+// GrantCapabilities returns the subset of declared capabilities that scopes
+// allow.
+func GrantCapabilities(declared Capabilities, scopes []string) Capabilities {
+	return Capabilities{
+		Query:     grantSchemas(declared.Query, ScopeDataQuery, scopes),
+		Subscribe: grantSchemas(declared.Subscribe, ScopeDataSubscribe, scopes),
+		Publish:   grantSchemas(declared.Publish, ScopeDataPublish, scopes),
+	}
+}
+
+// ScopesFor returns the scopes that grant exactly caps, for example to
+// write a plan that licenses what a plugin's manifest declares.
+func ScopesFor(caps Capabilities) []string {
+	var scopes []string
+	add := func(schemas []string, scope string) {
+		for _, schema := range schemas {
+			if schema == AllSchemas {
+				scopes = append(scopes, scope)
+			} else {
+				scopes = append(scopes, scope+":"+schema)
+			}
+		}
+	}
+	add(caps.Query, ScopeDataQuery)
+	add(caps.Subscribe, ScopeDataSubscribe)
+	add(caps.Publish, ScopeDataPublish)
+	return scopes
+}
+
+func grantSchemas(schemas []string, scope string, scopes []string) []string {
+	var granted []string
+	for _, schema := range schemas {
+		for _, s := range scopes {
+			if s == scope || (schema != AllSchemas && s == scope+":"+schema) {
+				granted = append(granted, schema)
+				break
+			}
+		}
+	}
+	return granted
+}
+
+func allows(schemas []string, schema string) bool {
+	for _, s := range schemas {
+		if s == schema || s == AllSchemas {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities returns the data-access capabilities granted to the plugin.
+func (rt *Runtime) Capabilities() Capabilities {
+	return rt.grants
+}
+
+// grantCapabilities reads the plugin's declared capabilities and keeps the
+// ones the claims allow. Plugins that declare none get no data access, and
+// plugins that declare more than their signed manifest are refused.
+func (rt *Runtime) grantCapabilities(ctx context.Context, claims *license.CapabilityClaims, manifest *Capabilities) error {
+	getCapabilitiesFn := rt.module.ExportedFunction("plugin_get_capabilities")
+	if rt.data == nil || getCapabilitiesFn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rt.budget.CallTimeout)
+	defer cancel()
+
+	const outCap = 4096
+	outPtr, err := rt.allocateSize(ctx, outCap)
+	if err != nil {
+		return err
+	}
+	defer rt.deallocate(ctx, outPtr)
+
+	results, err := getCapabilitiesFn.Call(ctx, uint64(outPtr), uint64(outCap))
+	if err != nil {
+		return fmt.Errorf("plugin_get_capabilities call failed: %w", err)
+	}
+	length := api.DecodeI32(results[0])
+	if length < 0 {
+		return fmt.Errorf("plugin_get_capabilities returned error %d", length)
+	}
+	if uint32(length) > outCap {
+		return fmt.Errorf("plugin_get_capabilities output length %d exceeds buffer capacity %d", length, outCap)
+	}
+	raw, err := rt.readMemory(outPtr, uint32(length))
+	if err != nil {
+		return err
+	}
+
+	var declared Capabilities
+	if err := json.Unmarshal(raw, &declared); err != nil {
+		return fmt.Errorf("invalid plugin capabilities: %w", err)
+	}
+	if manifest != nil {
+		if extra := declared.Beyond(*manifest); !extra.Empty() {
+			return fmt.Errorf("plugin declares capabilities beyond its signed manifest: query=%v subscribe=%v publish=%v",
+				extra.Query, extra.Subscribe, extra.Publish)
+		}
+	}
+	var scopes []string
+	if claims != nil {
+		scopes = claims.Scopes
+	}
+	rt.grants = GrantCapabilities(declared, scopes)
+
+	if len(rt.grants.Subscribe) > 0 {
+		if rt.onRecordFn == nil {
+			log.Warnf("Plugin declares subscriptions but does not export plugin_on_record; subscriptions disabled")
+			rt.grants.Subscribe = nil
+		} else {
+			rt.wg.Add(1)
+			go rt.dispatchRecords()
+		}
+	}
+
+	log.Infof("Plugin data access granted: query=%v subscribe=%v publish=%v",
+		rt.grants.Query, rt.grants.Subscribe, rt.grants.Publish)
+	return nil
+}
+
+// exportDataFunctions registers the data-access host functions:
+//
+//	data_query(schema_ptr, schema_len, query_ptr, query_len, out_ptr, out_cap) -> i32
+//	data_subscribe(schema_ptr, schema_len) -> i32
+//	data_publish(schema_ptr, schema_len, data_ptr, data_len) -> i32
+//
+// The query is a JSON DataQuery. Query results are written as
+// count(4 LE) + [len(4 LE) + record]..., keeping as many whole records as fit
+// in out_cap, and the call returns the number of bytes written. Subscribed
+// records are delivered to plugin_on_record(schema_ptr, schema_len, data_ptr,
+// data_len). Negative results are errors.
+func (rt *Runtime) exportDataFunctions(builder wazero.HostModuleBuilder) {
+	i32 := api.ValueTypeI32
+
+	builder.NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+				stack[0] = api.EncodeI32(rt.hostDataQuery(ctx, mod,
+					api.DecodeU32(stack[0]), api.DecodeU32(stack[1]),
+					api.DecodeU32(stack[2]), api.DecodeU32(stack[3]),
+					api.DecodeU32(stack[4]), api.DecodeU32(stack[5])))
+			}),
+			[]api.ValueType{i32, i32, i32, i32, i32, i32},
+			[]api.ValueType{i32},
+		).
+		Export("data_query")
+
+	builder.NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(func(_ context.Context, mod api.Module, stack []uint64) {
+				stack[0] = api.EncodeI32(rt.hostDataSubscribe(mod,
+					api.DecodeU32(stack[0]), api.DecodeU32(stack[1])))
+			}),
+			[]api.ValueType{i32, i32},
+			[]api.ValueType{i32},
+		).
+		Export("data_subscribe")
+
+	builder.NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+				stack[0] = api.EncodeI32(rt.hostDataPublish(ctx, mod,
+					api.DecodeU32(stack[0]), api.DecodeU32(stack[1]),
+					api.DecodeU32(stack[2]), api.DecodeU32(stack[3])))
+			}),
+			[]api.ValueType{i32, i32, i32, i32},
+			[]api.ValueType{i32},
+		).
+		Export("data_publish")
+}
+
+func readGuest(mod api.Module, ptr, length, max uint32) ([]byte, bool) {
+	if length > max {
+		return nil, false
+	}
+	data, ok := mod.Memory().Read(ptr, length)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+func (rt *Runtime) hostDataQuery(ctx context.Context, mod api.Module, schemaPtr, schemaLen, queryPtr, queryLen, outPtr, outCap uint32) int32 {
+	schema, ok := readGuest(mod, schemaPtr, schemaLen, maxSchemaNameLen)
+	if !ok {
+		return dataErrInvalid
+	}
+	if rt.data == nil || !allows(rt.grants.Query, string(schema)) {
+		return dataErrDenied
+	}
+	var q DataQuery
+	if queryLen > 0 {
+		raw, ok := readGuest(mod, queryPtr, queryLen, maxQueryLen)
+		if !ok || json.Unmarshal(raw, &q) != nil {
+			return dataErrInvalid
+		}
+	}
+
+	records, err := rt.data.Query(ctx, string(schema), q)
+	if err != nil {
+		log.Warnf("Plugin data query on %s failed: %v", schema, err)
+		return dataErrFailed
+	}
+	out, ok := encodeRecords(records, outCap)
+	if !ok || !mod.Memory().Write(outPtr, out) {
+		return dataErrInvalid
+	}
+	return int32(len(out))
+}
+
+func (rt *Runtime) hostDataSubscribe(mod api.Module, schemaPtr, schemaLen uint32) int32 {
+	raw, ok := readGuest(mod, schemaPtr, schemaLen, maxSchemaNameLen)
+	if !ok {
+		return dataErrInvalid
+	}
+	schema := string(raw)
+	if rt.data == nil || !allows(rt.grants.Subscribe, schema) {
+		return dataErrDenied
+	}
+
+	rt.subsMu.Lock()
+	defer rt.subsMu.Unlock()
+	if _, ok := rt.subs[schema]; ok {
+		return 0
+	}
+	select {
+	case <-rt.done:
+		return dataErrFailed
+	default:
+	}
+	cancel, err := rt.data.Subscribe(schema, func(data []byte) {
+		select {
+		case rt.events <- dataEvent{schema: schema, data: data}:
+		default:
+			log.Warnf("Plugin record queue full; dropping %s record", schema)
+		}
+	})
+	if err != nil {
+		log.Warnf("Plugin subscription to %s failed: %v", schema, err)
+		return dataErrFailed
+	}
+	rt.subs[schema] = cancel
+	return 0
+}
+
+func (rt *Runtime) hostDataPublish(ctx context.Context, mod api.Module, schemaPtr, schemaLen, dataPtr, dataLen uint32) int32 {
+	schema, ok := readGuest(mod, schemaPtr, schemaLen, maxSchemaNameLen)
+	if !ok {
+		return dataErrInvalid
+	}
+	if rt.data == nil || !allows(rt.grants.Publish, string(schema)) {
+		return dataErrDenied
+	}
+	data, ok := readGuest(mod, dataPtr, dataLen, maxDataRecordSize)
+	if !ok || len(data) == 0 {
+		return dataErrInvalid
+	}
+	cid, err := rt.data.Publish(ctx, string(schema), data)
+	if err != nil {
+		log.Warnf("Plugin publish to %s rejected: %v", schema, err)
+		return dataErrFailed
+	}
+	log.Debugf("Plugin published %s record %s", schema, cid)
+	return 0
+}
+
+// encodeRecords frames records as count(4 LE) + [len(4 LE) + record]...,
+// dropping trailing records that do not fit in limit bytes.
+func encodeRecords(records [][]byte, limit uint32) ([]byte, bool) {
+	if limit < 4 {
+		return nil, false
+	}
+	out := make([]byte, 4, 4+len(records)*4)
+	var count uint32
+	for _, rec := range records {
+		if uint64(len(out))+4+uint64(len(rec)) > uint64(limit) {
+			break
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(rec)))
+		out = append(out, rec...)
+		count++
+	}
+	binary.LittleEndian.PutUint32(out, count)
+	return out, true
+}
+
+// dispatchRecords delivers subscribed records to plugin_on_record one at a
+// time, serialized with other plugin calls.
+func (rt *Runtime) dispatchRecords() {
+	defer rt.wg.Done()
+	for {
+		select {
+		case <-rt.done:
+			return
+		case ev := <-rt.events:
+			if err := rt.deliverRecord(ev); err != nil {
+				log.Warnf("Plugin failed to handle %s record: %v", ev.schema, err)
+			}
+		}
+	}
+}
+
+func (rt *Runtime) deliverRecord(ev dataEvent) error {
+	ctx, end, err := rt.begin(context.Background(), "plugin_on_record")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	schemaPtr, err := rt.allocate(ctx, []byte(ev.schema))
+	if err != nil {
+		return err
+	}
+	defer rt.deallocate(ctx, schemaPtr)
+	dataPtr, err := rt.allocate(ctx, ev.data)
+	if err != nil {
+		return err
+	}
+	defer rt.deallocate(ctx, dataPtr)
+
+	results, err := rt.onRecordFn.Call(ctx,
+		uint64(schemaPtr), uint64(len(ev.schema)),
+		uint64(dataPtr), uint64(len(ev.data)))
+	if err != nil {
+		return fmt.Errorf("plugin_on_record call failed: %w", budgetErr(ctx, err))
+	}
+	if status := api.DecodeI32(results[0]); status != 0 {
+		return fmt.Errorf("plugin_on_record returned error status %d", status)
+	}
+	return nil
+}
+
+// stopDataAccess cancels subscriptions and waits for in-flight deliveries.
+func (rt *Runtime) stopDataAccess() {
+	if rt.done == nil {
+		return
+	}
+	rt.closeOnce.Do(func() {
+		close(rt.done)
+		rt.subsMu.Lock()
+		for schema, cancel := range rt.subs {
+			cancel()
+			delete(rt.subs, schema)
+		}
+		rt.subsMu.Unlock()
+	})
+	rt.wg.Wait()
+}
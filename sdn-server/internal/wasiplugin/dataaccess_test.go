@@ -0,0 +1,91 @@
+package wasiplugin
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestGrantCapabilities(t *testing.T) {
+	declared := Capabilities{
+		Query:     []string{"OMM.fbs", "CAT.fbs"},
+		Subscribe: []string{AllSchemas},
+		Publish:   []string{"CDM.fbs"},
+	}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		want   Capabilities
+	}{
+		{name: "no scopes", want: Capabilities{}},
+		{
+			name:   "per-schema scope",
+			scopes: []string{"plugin:data:query:OMM.fbs", "plugin:data:subscribe:OMM.fbs"},
+			want:   Capabilities{Query: []string{"OMM.fbs"}},
+		},
+		{
+			name:   "bare scopes",
+			scopes: []string{ScopeDataQuery, ScopeDataSubscribe, ScopeDataPublish},
+			want:   declared,
+		},
+		{
+			name:   "unrelated scopes",
+			scopes: []string{"orbpro:base", "api:data:read:free"},
+			want:   Capabilities{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GrantCapabilities(declared, tt.scopes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GrantCapabilities() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := GrantCapabilities(declared, ScopesFor(declared)); !reflect.DeepEqual(got, declared) {
+		t.Errorf("ScopesFor(declared) grants %+v, want %+v", got, declared)
+	}
+	narrow := Capabilities{Query: []string{"OMM.fbs"}}
+	if got := GrantCapabilities(declared, ScopesFor(narrow)); !reflect.DeepEqual(got, narrow) {
+		t.Errorf("ScopesFor(narrow) grants %+v, want %+v", got, narrow)
+	}
+
+	if extra := declared.Beyond(declared); !extra.Empty() {
+		t.Errorf("declared.Beyond(declared) = %+v, want none", extra)
+	}
+	want := Capabilities{Query: []string{"CAT.fbs"}, Subscribe: []string{AllSchemas}}
+	manifest := Capabilities{Query: []string{"OMM.fbs"}, Subscribe: []string{"OMM.fbs"}, Publish: []string{AllSchemas}}
+	if got := declared.Beyond(manifest); !reflect.DeepEqual(got, want) {
+		t.Errorf("Beyond() = %+v, want %+v", got, want)
+	}
+
+	if !allows([]string{AllSchemas}, "OMM.fbs") || allows([]string{"CAT.fbs"}, "OMM.fbs") {
+		t.Error("allows() does not match granted schemas")
+	}
+}
+
+func TestEncodeRecordsKeepsWholeRecords(t *testing.T) {
+	records := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+
+	// Room for the count and the first two records only.
+	limit := uint32(4 + 4 + 5 + 4 + 6 + 3)
+	out, ok := encodeRecords(records, limit)
+	if !ok {
+		t.Fatal("encodeRecords failed")
+	}
+	if count := binary.LittleEndian.Uint32(out); count != 2 {
+		t.Fatalf("count = %d, want 2", count)
+	}
+	if len(out) != 4+4+5+4+6 {
+		t.Errorf("len = %d, want %d", len(out), 4+4+5+4+6)
+	}
+	if n := binary.LittleEndian.Uint32(out[13:]); n != 6 || string(out[17:23]) != "second" {
+		t.Errorf("second record framed incorrectly: %q", out[13:])
+	}
+
+	if _, ok := encodeRecords(records, 3); ok {
+		t.Error("encodeRecords should reject a buffer without room for the count")
+	}
+}
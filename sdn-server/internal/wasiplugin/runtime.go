@@ -1,6 +1,7 @@
 // Package wasiplugin provides a Wazero-based WASI plugin runtime for loading
 // C++ plugins compiled to WASM/WASI by wasi-sdk. The runtime provides host
-// functions (time, random, logging) and exposes the plugin's exported API.
+// functions (time, random, logging, capability-scoped data access) and
+// exposes the plugin's exported API.
 package wasiplugin
 
 import (
@@ -11,11 +12,13 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 )
 
@@ -29,6 +32,7 @@ var (
 // Runtime wraps a single WASI plugin module loaded via Wazero.
 type Runtime struct {
 	wazRuntime wazero.Runtime
+	compiled   wazero.CompiledModule
 	module     api.Module
 	mu         sync.Mutex
 
@@ -39,9 +43,26 @@ type Runtime struct {
 	handleRequestFn api.Function
 	getPublicKeyFn  api.Function
 	getMetadataFn   api.Function
+
+	data       DataAccess
+	grants     Capabilities
+	onRecordFn api.Function
+	subsMu     sync.Mutex
+	subs       map[string]func()
+	events     chan dataEvent
+	done       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+
+	budget      Budget
+	slots       chan struct{}
+	initConfig  []byte
+	violations  int // consecutive budget violations, guarded by mu
+	quarantined atomic.Pointer[string]
 }
 
-// pluginCallTimeout is the maximum duration for a single WASI plugin function call.
+// pluginCallTimeout is the default maximum duration for a single WASI plugin
+// function call.
 const pluginCallTimeout = 10 * time.Second
 
 // New loads a WASI plugin from raw WASM bytes. The module must export
@@ -49,8 +70,29 @@ const pluginCallTimeout = 10 * time.Second
 // and plugin_get_metadata. Host functions (sdn.clock_now_ms, sdn.random_bytes,
 // sdn.log) are registered automatically.
 func New(ctx context.Context, wasmBytes []byte) (*Runtime, error) {
+	return NewWithOptions(ctx, wasmBytes, Options{})
+}
+
+// NewWithOptions loads a WASI plugin like New and additionally wires the
+// data-access host functions (sdn.data_query, sdn.data_subscribe,
+// sdn.data_publish) to opts.Data, limited to the capabilities the plugin
+// declares and opts.Claims grants.
+func NewWithOptions(ctx context.Context, wasmBytes []byte, opts Options) (*Runtime, error) {
+	budget := opts.Budget.withDefaults()
+	rt := &Runtime{
+		data:   opts.Data,
+		subs:   make(map[string]func()),
+		events: make(chan dataEvent, dataEventQueueSize),
+		done:   make(chan struct{}),
+		budget: budget,
+		slots:  make(chan struct{}, budget.MaxConcurrent),
+	}
+
 	// H8: Limit WASM memory to 512 pages (32MB) for plugin modules.
-	cfg := wazero.NewRuntimeConfig().WithMemoryLimitPages(512)
+	// Closing on context done lets call deadlines interrupt a spinning guest.
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(512).
+		WithCloseOnContextDone(true)
 	r := wazero.NewRuntimeWithConfig(ctx, cfg)
 
 	// Standard WASI imports (libc may call fd_write, proc_exit, etc.)
@@ -137,6 +179,8 @@ func New(ctx context.Context, wasmBytes []byte) (*Runtime, error) {
 			).
 			Export("log")
 
+		rt.exportDataFunctions(builder)
+
 		if name == "env" {
 			exportI32ToI32 := func(symbol string) {
 				builder.NewFunctionBuilder().
@@ -380,44 +424,82 @@ func New(ctx context.Context, wasmBytes []byte) (*Runtime, error) {
 		}
 	}
 
-	module, err := r.Instantiate(ctx, wasmBytes)
+	// Function listeners are bound at compile time, so fuel metering is only
+	// compiled in when a fuel budget is set.
+	compileCtx := ctx
+	if budget.MaxFuel > 0 {
+		compileCtx = context.WithValue(ctx, experimental.FunctionListenerFactoryKey{}, fuelListenerFactory)
+	}
+	compiled, err := r.CompileModule(compileCtx, wasmBytes)
 	if err != nil {
 		r.Close(ctx)
-		return nil, fmt.Errorf("failed to instantiate WASM module: %w", err)
+		return nil, fmt.Errorf("failed to compile WASM module: %w", err)
+	}
+
+	rt.wazRuntime = r
+	rt.compiled = compiled
+	if err := rt.instantiate(ctx); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	if err := rt.grantCapabilities(ctx, opts.Claims, opts.Manifest); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// instantiate creates a fresh instance of the compiled plugin module and
+// resolves its exports. It is also used to replace an instance that was
+// terminated for exceeding its budget.
+func (rt *Runtime) instantiate(ctx context.Context) error {
+	module, err := rt.wazRuntime.InstantiateModule(ctx, rt.compiled, wazero.NewModuleConfig())
+	if err != nil {
+		return fmt.Errorf("failed to instantiate WASM module: %w", err)
 	}
 	if initializeFn := module.ExportedFunction("_initialize"); initializeFn != nil {
-		if _, err := initializeFn.Call(ctx); err != nil {
-			r.Close(ctx)
-			return nil, fmt.Errorf("failed to run _initialize: %w", err)
+		initCtx, cancel := context.WithTimeout(ctx, rt.budget.CallTimeout)
+		_, err := initializeFn.Call(initCtx)
+		cancel()
+		if err != nil {
+			module.Close(ctx)
+			return fmt.Errorf("failed to run _initialize: %w", err)
 		}
 	}
 
-	rt := &Runtime{
-		wazRuntime:      r,
-		module:          module,
-		mallocFn:        module.ExportedFunction("malloc"),
-		freeFn:          module.ExportedFunction("free"),
-		initFn:          module.ExportedFunction("plugin_init"),
-		handleRequestFn: module.ExportedFunction("plugin_handle_request"),
-		getPublicKeyFn:  module.ExportedFunction("plugin_get_public_key"),
-		getMetadataFn:   module.ExportedFunction("plugin_get_metadata"),
-	}
+	mallocFn := module.ExportedFunction("malloc")
+	freeFn := module.ExportedFunction("free")
+	initFn := module.ExportedFunction("plugin_init")
+	handleRequestFn := module.ExportedFunction("plugin_handle_request")
+	getPublicKeyFn := module.ExportedFunction("plugin_get_public_key")
+	getMetadataFn := module.ExportedFunction("plugin_get_metadata")
 
-	if rt.mallocFn == nil || rt.freeFn == nil {
-		r.Close(ctx)
-		return nil, fmt.Errorf("WASM module missing malloc/free exports")
+	if mallocFn == nil || freeFn == nil {
+		module.Close(ctx)
+		return fmt.Errorf("WASM module missing malloc/free exports")
 	}
-	if rt.initFn == nil || rt.handleRequestFn == nil ||
-		rt.getPublicKeyFn == nil || rt.getMetadataFn == nil {
-		r.Close(ctx)
-		return nil, fmt.Errorf("WASM module missing required plugin_* exports")
+	if initFn == nil || handleRequestFn == nil ||
+		getPublicKeyFn == nil || getMetadataFn == nil {
+		module.Close(ctx)
+		return fmt.Errorf("WASM module missing required plugin_* exports")
 	}
 
-	return rt, nil
+	rt.module = module
+	rt.mallocFn = mallocFn
+	rt.freeFn = freeFn
+	rt.initFn = initFn
+	rt.handleRequestFn = handleRequestFn
+	rt.getPublicKeyFn = getPublicKeyFn
+	rt.getMetadataFn = getMetadataFn
+	rt.onRecordFn = module.ExportedFunction("plugin_on_record")
+	return nil
 }
 
 // Close releases the Wazero runtime and module.
 func (rt *Runtime) Close(ctx context.Context) error {
+	rt.stopDataAccess()
 	if rt.wazRuntime != nil {
 		return rt.wazRuntime.Close(ctx)
 	}
@@ -428,12 +510,12 @@ func (rt *Runtime) Close(ctx context.Context) error {
 // Config format: privateKey(32) + publicKey(65) + secretLen(4 LE) + secret(N)
 //   - domainsCsv(NUL-terminated) + epochPeriodMs(8 LE) + maxSkewMs(8 LE) + leaseMs(8 LE)
 func (rt *Runtime) Init(ctx context.Context, config []byte) error {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-
-	// H9: Wrap context with execution timeout inside locked section.
-	ctx, cancel := context.WithTimeout(ctx, pluginCallTimeout)
-	defer cancel()
+	// H9: Run under the plugin's call budget inside the locked section.
+	ctx, end, err := rt.begin(ctx, "plugin_init")
+	if err != nil {
+		return err
+	}
+	defer end()
 
 	configPtr, err := rt.allocate(ctx, config)
 	if err != nil {
@@ -443,23 +525,24 @@ func (rt *Runtime) Init(ctx context.Context, config []byte) error {
 
 	results, err := rt.initFn.Call(ctx, uint64(configPtr), uint64(len(config)))
 	if err != nil {
-		return fmt.Errorf("plugin_init call failed: %w", err)
+		return fmt.Errorf("plugin_init call failed: %w", budgetErr(ctx, err))
 	}
 
 	if status := api.DecodeI32(results[0]); status != 0 {
 		return fmt.Errorf("plugin_init returned error status %d", status)
 	}
+	rt.initConfig = append([]byte(nil), config...)
 	return nil
 }
 
 // GetPublicKey returns the server's P-256 uncompressed public key (65 bytes).
 func (rt *Runtime) GetPublicKey(ctx context.Context) ([]byte, error) {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-
-	// H9: Wrap context with execution timeout inside locked section.
-	ctx, cancel := context.WithTimeout(ctx, pluginCallTimeout)
-	defer cancel()
+	// H9: Run under the plugin's call budget inside the locked section.
+	ctx, end, err := rt.begin(ctx, "plugin_get_public_key")
+	if err != nil {
+		return nil, err
+	}
+	defer end()
 
 	const outCap = 128
 	outPtr, err := rt.allocateSize(ctx, outCap)
@@ -470,7 +553,7 @@ func (rt *Runtime) GetPublicKey(ctx context.Context) ([]byte, error) {
 
 	results, err := rt.getPublicKeyFn.Call(ctx, uint64(outPtr), uint64(outCap))
 	if err != nil {
-		return nil, fmt.Errorf("plugin_get_public_key call failed: %w", err)
+		return nil, fmt.Errorf("plugin_get_public_key call failed: %w", budgetErr(ctx, err))
 	}
 
 	length := api.DecodeI32(results[0])
@@ -487,12 +570,12 @@ func (rt *Runtime) GetPublicKey(ctx context.Context) ([]byte, error) {
 // GetMetadata returns the binary metadata blob from the plugin.
 // Format: domainCount(4 LE) + [domainLen(2 LE) + domain(N)]...
 func (rt *Runtime) GetMetadata(ctx context.Context) ([]byte, error) {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-
-	// H9: Wrap context with execution timeout inside locked section.
-	ctx, cancel := context.WithTimeout(ctx, pluginCallTimeout)
-	defer cancel()
+	// H9: Run under the plugin's call budget inside the locked section.
+	ctx, end, err := rt.begin(ctx, "plugin_get_metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer end()
 
 	const outCap = 4096
 	outPtr, err := rt.allocateSize(ctx, outCap)
@@ -503,7 +586,7 @@ func (rt *Runtime) GetMetadata(ctx context.Context) ([]byte, error) {
 
 	results, err := rt.getMetadataFn.Call(ctx, uint64(outPtr), uint64(outCap))
 	if err != nil {
-		return nil, fmt.Errorf("plugin_get_metadata call failed: %w", err)
+		return nil, fmt.Errorf("plugin_get_metadata call failed: %w", budgetErr(ctx, err))
 	}
 
 	length := api.DecodeI32(results[0])
@@ -521,12 +604,12 @@ func (rt *Runtime) GetMetadata(ctx context.Context) ([]byte, error) {
 // Returns (response_bytes, status_code, error). The response contains the
 // binary protocol response including error status when status != 0.
 func (rt *Runtime) HandleRequest(ctx context.Context, packet []byte, hostHeader string) ([]byte, int32, error) {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-
-	// H9: Wrap context with execution timeout inside locked section.
-	ctx, cancel := context.WithTimeout(ctx, pluginCallTimeout)
-	defer cancel()
+	// H9: Run under the plugin's call budget inside the locked section.
+	ctx, end, err := rt.begin(ctx, "plugin_handle_request")
+	if err != nil {
+		return nil, -1, err
+	}
+	defer end()
 
 	reqPtr, err := rt.allocate(ctx, packet)
 	if err != nil {
@@ -562,7 +645,7 @@ func (rt *Runtime) HandleRequest(ctx context.Context, packet []byte, hostHeader
 		uint64(outLenPtr),
 	)
 	if err != nil {
-		return nil, -1, fmt.Errorf("plugin_handle_request call failed: %w", err)
+		return nil, -1, fmt.Errorf("plugin_handle_request call failed: %w", budgetErr(ctx, err))
 	}
 
 	status := api.DecodeI32(results[0])
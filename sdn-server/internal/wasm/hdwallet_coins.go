@@ -33,6 +33,16 @@ const (
 	SolanaDerivePath   = "m/44'/501'/0'/0'"  // BIP-44 Solana (all hardened for Ed25519)
 )
 
+// Per-purchase deposit address path templates. The trailing index selects a
+// unique receive address so incoming payments can be matched to a purchase
+// without the buyer reporting a transaction hash. Index 0 is the node's own
+// display address (see the *DerivePath constants above).
+const (
+	BitcoinDepositPathFmt  = "m/84'/0'/0'/0/%d"
+	EthereumDepositPathFmt = "m/44'/60'/0'/0/%d"
+	SolanaDepositPathFmt   = "m/44'/501'/%d'/0'"
+)
+
 // Curve constants matching the WASM enum (types.h)
 const (
 	CurveSecp256k1 = 0
@@ -62,6 +72,55 @@ func (hw *HDWalletModule) DeriveCoinAddresses(ctx context.Context, seed []byte)
 	return addrs, nil
 }
 
+// DeriveDepositAddress derives the receive address at the given index for a
+// chain ("bitcoin", "ethereum" or "solana") from a 64-byte seed.
+func (hw *HDWalletModule) DeriveDepositAddress(ctx context.Context, seed []byte, chain string, index uint32) (*CoinAddress, error) {
+	if len(seed) != 64 {
+		return nil, ErrHDWalletInvalidSeed
+	}
+
+	switch chain {
+	case "bitcoin":
+		path := fmt.Sprintf(BitcoinDepositPathFmt, index)
+		pubkey, err := hw.deriveSecp256k1PubKey(ctx, seed, path)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := bitcoinP2WPKH(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		return &CoinAddress{Address: addr, Path: path}, nil
+
+	case "ethereum":
+		path := fmt.Sprintf(EthereumDepositPathFmt, index)
+		pubkey, err := hw.deriveSecp256k1PubKey(ctx, seed, path)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := ethereumAddress(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		return &CoinAddress{Address: addr, Path: path}, nil
+
+	case "solana":
+		path := fmt.Sprintf(SolanaDepositPathFmt, index)
+		derived, err := hw.DeriveEd25519Key(ctx, seed, path)
+		if err != nil {
+			return nil, err
+		}
+		privKey := ed25519.NewKeyFromSeed(derived.PrivateKey)
+		zeroBytes(derived.PrivateKey)
+		pubKey := privKey.Public().(ed25519.PublicKey)
+		zeroBytes(privKey)
+		return &CoinAddress{Address: base58.Encode(pubKey), Path: path}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported deposit chain: %s", chain)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // BIP-32 secp256k1 key derivation (via WASM)
 // ---------------------------------------------------------------------------
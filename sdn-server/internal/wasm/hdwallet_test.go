@@ -572,3 +572,53 @@ func TestDerivedIdentity_MarshalPrivateKey(t *testing.T) {
 		t.Error("MarshalPrivateKey() returned empty bytes")
 	}
 }
+
+func TestHDWalletModule_DeriveDepositAddress(t *testing.T) {
+	hw := testHDWalletModule(t)
+	ctx := context.Background()
+
+	seed, err := hw.MnemonicToSeed(ctx, testMnemonic, "")
+	if err != nil {
+		t.Fatalf("MnemonicToSeed() error = %v", err)
+	}
+
+	coins, err := hw.DeriveCoinAddresses(ctx, seed)
+	if err != nil {
+		t.Fatalf("DeriveCoinAddresses() error = %v", err)
+	}
+
+	for _, chain := range []string{"bitcoin", "ethereum", "solana"} {
+		first, err := hw.DeriveDepositAddress(ctx, seed, chain, 1)
+		if err != nil {
+			t.Fatalf("DeriveDepositAddress(%s, 1) error = %v", chain, err)
+		}
+		second, err := hw.DeriveDepositAddress(ctx, seed, chain, 2)
+		if err != nil {
+			t.Fatalf("DeriveDepositAddress(%s, 2) error = %v", chain, err)
+		}
+		if first.Address == "" || first.Address == second.Address {
+			t.Errorf("DeriveDepositAddress(%s) should yield distinct addresses per index", chain)
+		}
+
+		again, err := hw.DeriveDepositAddress(ctx, seed, chain, 1)
+		if err != nil {
+			t.Fatalf("DeriveDepositAddress(%s, 1) error = %v", chain, err)
+		}
+		if again.Address != first.Address {
+			t.Errorf("DeriveDepositAddress(%s) should be deterministic", chain)
+		}
+	}
+
+	// Index 0 on secp256k1 chains matches the node's display address.
+	eth0, err := hw.DeriveDepositAddress(ctx, seed, "ethereum", 0)
+	if err != nil {
+		t.Fatalf("DeriveDepositAddress(ethereum, 0) error = %v", err)
+	}
+	if coins.Ethereum != nil && eth0.Address != coins.Ethereum.Address {
+		t.Errorf("deposit index 0 = %s, want %s", eth0.Address, coins.Ethereum.Address)
+	}
+
+	if _, err := hw.DeriveDepositAddress(ctx, seed, "dogecoin", 1); err == nil {
+		t.Error("DeriveDepositAddress() should reject unsupported chains")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/protocol"
 
+	"github.com/spacedatanetwork/sdn-server/internal/audit"
 	"github.com/spacedatanetwork/sdn-server/internal/license"
 	"github.com/spacedatanetwork/sdn-server/plugins"
 )
@@ -25,6 +26,7 @@ type Plugin struct {
 	host    host.Host
 	service *license.Service
 	api     *license.APIHandler
+	audit   *audit.Logger
 }
 
 // New returns a new unstarted license plugin.
@@ -64,12 +66,22 @@ func (p *Plugin) Start(ctx context.Context, runtime plugins.RuntimeContext) erro
 	p.host = runtime.Host
 	p.service = svc
 	p.api = license.NewAPIHandler(svc)
+	p.api.SetAuditLogger(p.audit)
 	p.mu.Unlock()
 
 	_ = ctx // reserved for future plugin background jobs.
 	return nil
 }
 
+// SetAuditLogger records changes made through the license admin API to
+// logger.
+func (p *Plugin) SetAuditLogger(logger *audit.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.audit = logger
+	p.api.SetAuditLogger(logger)
+}
+
 // RegisterRoutes mounts HTTP routes for license and plugin-delivery APIs.
 func (p *Plugin) RegisterRoutes(mux *http.ServeMux) {
 	if mux == nil {
@@ -23,7 +23,9 @@ import (
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 
+	"github.com/spacedatanetwork/sdn-server/internal/license"
 	"github.com/spacedatanetwork/sdn-server/internal/wasiplugin"
 	"github.com/spacedatanetwork/sdn-server/plugins"
 )
@@ -36,19 +38,45 @@ const ID = "orbpro-key-broker"
 // Plugin wraps the WASI key broker module into the SDN plugin contract.
 type Plugin struct {
 	mu       sync.RWMutex
-	runtime  *wasiplugin.Runtime
-	handler  *wasiplugin.Handler
-	bridge   *wasiplugin.StreamBridge
+	active   *instance
+	config   []byte // plugin_init blob, replayed into reloaded instances
 	host     host.Host
 	wasmPath string
 	wasmData []byte
 
+	reloadMu     sync.Mutex
+	onQuarantine func(reason string)
+
+	// Data-access backend, the claims the module runs under and its signed
+	// manifest capabilities; see SetDataAccess.
+	data     wasiplugin.DataAccess
+	claims   *license.CapabilityClaims
+	manifest *wasiplugin.Capabilities
+
 	// Background goroutine lifecycle
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 }
 
+// instance is one loaded WASI module with the bridges that serve it. Requests
+// hold drain for reading; a swap takes it for writing to wait for in-flight
+// requests before closing the module.
+type instance struct {
+	runtime *wasiplugin.Runtime
+	handler *wasiplugin.Handler
+	bridge  *wasiplugin.StreamBridge
+
+	drain sync.RWMutex
+}
+
+// close waits for in-flight requests and releases the module.
+func (inst *instance) close() error {
+	inst.drain.Lock()
+	defer inst.drain.Unlock()
+	return inst.runtime.Close(context.Background())
+}
+
 // New returns an unstarted plugin that will load the WASM module from wasmPath.
 func New(wasmPath string) *Plugin {
 	return &Plugin{wasmPath: wasmPath}
@@ -64,6 +92,25 @@ func NewFromBytes(wasmBytes []byte) *Plugin {
 // ID returns the plugin identifier.
 func (p *Plugin) ID() string { return ID }
 
+// SetQuarantineHandler sets a callback invoked when the WASI runtime
+// quarantines the module for repeatedly exceeding its execution budget.
+// Must be called before Start.
+func (p *Plugin) SetQuarantineHandler(fn func(reason string)) {
+	p.onQuarantine = fn
+}
+
+// SetDataAccess enables the data-access host ABI for the module. It is
+// granted the capabilities it declares that claims carry a scope for; with a
+// manifest, a module declaring more than it fails to load. The setting
+// applies to the next load, by Start or Reload.
+func (p *Plugin) SetDataAccess(data wasiplugin.DataAccess, claims *license.CapabilityClaims, manifest *wasiplugin.Capabilities) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data = data
+	p.claims = claims
+	p.manifest = manifest
+}
+
 // Start loads the WASM module, derives the P-256 public key, packs the binary
 // config blob, calls plugin_init, then registers libp2p stream handlers and
 // publishes the public key to the DHT.
@@ -122,11 +169,6 @@ func (p *Plugin) Start(ctx context.Context, runtime plugins.RuntimeContext) erro
 		return fmt.Errorf("plugin module is empty")
 	}
 
-	rt, err := wasiplugin.New(ctx, wasmBytes)
-	if err != nil {
-		return fmt.Errorf("failed to create WASI runtime: %w", err)
-	}
-
 	// Pack binary config for plugin_init:
 	//   privateKey(32) + publicKey(65) + secretLen(4 LE) + secret(N)
 	//   + domainsCsv(NUL-terminated) + epochPeriodMs(8 LE) + maxSkewMs(8 LE) + leaseMs(8 LE)
@@ -156,27 +198,24 @@ func (p *Plugin) Start(ctx context.Context, runtime plugins.RuntimeContext) erro
 	off += 8
 	binary.LittleEndian.PutUint32(config[off:], activeKeyVersion)
 
-	if err := rt.Init(ctx, config); err != nil {
-		rt.Close(ctx)
-		return fmt.Errorf("plugin_init failed: %w", err)
+	inst, err := p.load(ctx, wasmBytes, config)
+	if err != nil {
+		return err
 	}
 
-	handler := wasiplugin.NewHandler(rt)
-	bridge := wasiplugin.NewStreamBridge(rt)
-
 	p.mu.Lock()
-	p.runtime = rt
-	p.handler = handler
-	p.bridge = bridge
+	p.active = inst
+	p.config = config
 	p.host = runtime.Host
 	p.mu.Unlock()
 
 	// Register libp2p stream handlers for key exchange over p2p transport.
 	// The key exchange happens entirely over encrypted libp2p streams,
-	// not HTTP — following a Widevine/Signal-style model.
+	// not HTTP — following a Widevine/Signal-style model. Handlers resolve
+	// the active instance per stream so reloads take effect immediately.
 	if runtime.Host != nil {
-		runtime.Host.SetStreamHandler(wasiplugin.PublicKeyProtocolID, bridge.HandlePublicKeyStream)
-		runtime.Host.SetStreamHandler(wasiplugin.KeyBrokerProtocolID, bridge.HandleKeyBrokerStream)
+		runtime.Host.SetStreamHandler(wasiplugin.PublicKeyProtocolID, p.handlePublicKeyStream)
+		runtime.Host.SetStreamHandler(wasiplugin.KeyBrokerProtocolID, p.handleKeyBrokerStream)
 		log.Infof("Registered libp2p stream handlers: %s, %s",
 			wasiplugin.PublicKeyProtocolID, wasiplugin.KeyBrokerProtocolID)
 	}
@@ -194,20 +233,149 @@ func (p *Plugin) Start(ctx context.Context, runtime plugins.RuntimeContext) erro
 	return nil
 }
 
-// announceLoop periodically publishes the public key CID to the DHT.
-func (p *Plugin) announceLoop(runtime plugins.RuntimeContext) {
-	defer p.wg.Done()
+// load creates and initializes a WASI instance and checks that it is healthy
+// before it is allowed to serve traffic.
+func (p *Plugin) load(ctx context.Context, wasmBytes, config []byte) (*instance, error) {
+	p.mu.RLock()
+	data, claims, manifest := p.data, p.claims, p.manifest
+	p.mu.RUnlock()
+
+	rt, err := wasiplugin.NewWithOptions(ctx, wasmBytes, wasiplugin.Options{
+		Data:     data,
+		Claims:   claims,
+		Manifest: manifest,
+		Budget:   wasiplugin.Budget{OnQuarantine: p.onQuarantine},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WASI runtime: %w", err)
+	}
+	if err := rt.Init(ctx, config); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("plugin_init failed: %w", err)
+	}
+	if err := probe(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("health probe failed: %w", err)
+	}
+	return &instance{
+		runtime: rt,
+		handler: wasiplugin.NewHandler(rt),
+		bridge:  wasiplugin.NewStreamBridge(rt),
+	}, nil
+}
+
+// probe checks that an initialized module serves its public key and
+// metadata.
+func probe(ctx context.Context, rt *wasiplugin.Runtime) error {
+	pubKey, err := rt.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pubKey) != 65 || pubKey[0] != 0x04 {
+		return fmt.Errorf("unexpected public key (%d bytes)", len(pubKey))
+	}
+	if _, err := rt.GetMetadata(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// acquire returns the active instance, held against draining until release
+// is called.
+func (p *Plugin) acquire() (*instance, func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	inst := p.active
+	if inst == nil {
+		return nil, nil
+	}
+	inst.drain.RLock()
+	return inst, inst.drain.RUnlock
+}
+
+// Reload hot-swaps the WASI module for a new build. The new module is
+// initialized with the running configuration and must pass its health probe
+// before it takes traffic; otherwise the current module keeps serving.
+// Requests in flight on the old module are drained before it is closed.
+func (p *Plugin) Reload(ctx context.Context, wasmBytes []byte) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
 
 	p.mu.RLock()
-	bridge := p.bridge
+	config := p.config
+	running := p.active != nil
 	p.mu.RUnlock()
+	if !running {
+		return fmt.Errorf("plugin is not running")
+	}
+
+	inst, err := p.load(ctx, wasmBytes, config)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	old := p.active
+	p.active = inst
+	p.mu.Unlock()
+
+	if old != nil {
+		if err := old.close(); err != nil {
+			log.Warnf("Error closing replaced key broker module: %v", err)
+		}
+	}
+	log.Infof("OrbPro key broker module reloaded")
+	return nil
+}
 
-	if bridge == nil {
+func (p *Plugin) handlePublicKeyStream(s network.Stream) {
+	inst, release := p.acquire()
+	if inst == nil {
+		_ = s.Reset()
 		return
 	}
+	defer release()
+	inst.bridge.HandlePublicKeyStream(s)
+}
+
+func (p *Plugin) handleKeyBrokerStream(s network.Stream) {
+	inst, release := p.acquire()
+	if inst == nil {
+		_ = s.Reset()
+		return
+	}
+	defer release()
+	inst.bridge.HandleKeyBrokerStream(s)
+}
+
+// serve routes an HTTP request to the active instance's handler.
+func (p *Plugin) serve(route func(*wasiplugin.Handler) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inst, release := p.acquire()
+		if inst == nil {
+			http.Error(w, "key broker unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		route(inst.handler)(w, r)
+	}
+}
+
+// announceLoop periodically publishes the public key CID to the DHT.
+func (p *Plugin) announceLoop(runtime plugins.RuntimeContext) {
+	defer p.wg.Done()
+
+	announce := func() error {
+		inst, release := p.acquire()
+		if inst == nil {
+			return nil
+		}
+		defer release()
+		return inst.bridge.AnnouncePublicKey(p.ctx, runtime.DHT)
+	}
 
 	// Initial announcement
-	if err := bridge.AnnouncePublicKey(p.ctx, runtime.DHT); err != nil {
+	if err := announce(); err != nil {
 		log.Warnf("Initial DHT announcement failed: %v", err)
 	}
 
@@ -219,7 +387,7 @@ func (p *Plugin) announceLoop(runtime plugins.RuntimeContext) {
 		case <-p.ctx.Done():
 			return
 		case <-ticker.C:
-			if err := bridge.AnnouncePublicKey(p.ctx, runtime.DHT); err != nil {
+			if err := announce(); err != nil {
 				log.Debugf("DHT re-announcement failed: %v", err)
 			}
 		}
@@ -230,19 +398,19 @@ func (p *Plugin) announceLoop(runtime plugins.RuntimeContext) {
 // Key exchange is available both over libp2p streams and HTTP.
 func (p *Plugin) RegisterRoutes(mux *http.ServeMux) {
 	p.mu.RLock()
-	h := p.handler
+	running := p.active != nil
 	p.mu.RUnlock()
 
-	if h == nil {
+	if !running {
 		return
 	}
 
 	// Public key + key exchange over HTTP (for browser-based demo clients).
-	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/public-key", h.HandlePublicKey)
-	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/key", h.HandleKeyExchange)
+	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/public-key", p.serve(func(h *wasiplugin.Handler) http.HandlerFunc { return h.HandlePublicKey }))
+	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/key", p.serve(func(h *wasiplugin.Handler) http.HandlerFunc { return h.HandleKeyExchange }))
 
 	// Admin UI (behind admin auth).
-	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/ui", h.HandleUI)
+	mux.HandleFunc("/orbpro-key-broker/v1/orbpro/ui", p.serve(func(h *wasiplugin.Handler) http.HandlerFunc { return h.HandleUI }))
 }
 
 // Version returns the plugin version string.
@@ -274,12 +442,14 @@ func (p *Plugin) Close() error {
 	}
 	p.wg.Wait()
 
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
 	p.mu.Lock()
-	rt := p.runtime
+	inst := p.active
 	h := p.host
-	p.runtime = nil
-	p.handler = nil
-	p.bridge = nil
+	p.active = nil
+	p.config = nil
 	p.host = nil
 	p.mu.Unlock()
 
@@ -289,8 +459,8 @@ func (p *Plugin) Close() error {
 		h.RemoveStreamHandler(wasiplugin.KeyBrokerProtocolID)
 	}
 
-	if rt != nil {
-		return rt.Close(context.Background())
+	if inst != nil {
+		return inst.close()
 	}
 	return nil
 }
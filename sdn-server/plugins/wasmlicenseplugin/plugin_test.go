@@ -0,0 +1,162 @@
+package wasmlicenseplugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spacedatanetwork/sdn-server/internal/license"
+	"github.com/spacedatanetwork/sdn-server/internal/wasiplugin"
+)
+
+// uleb appends n as unsigned LEB128.
+func uleb(out []byte, n int) []byte {
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// i32Const encodes i32.const n for non-negative n as signed LEB128.
+func i32Const(n int) []byte {
+	out := []byte{0x41}
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 && b&0x40 == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// dataModule is a minimal key broker plugin that passes the health probe and
+// declares capabilities through plugin_get_capabilities.
+func dataModule(capabilities string) []byte {
+	section := func(id byte, body []byte) []byte {
+		return append(uleb([]byte{id}, len(body)), body...)
+	}
+	name := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	export := func(s string, kind, idx byte) []byte { return append(name(s), kind, idx) }
+	body := func(code ...byte) []byte {
+		code = append([]byte{0}, append(code, 0x0b)...)
+		return append(uleb(nil, len(code)), code...)
+	}
+	// copyOut copies n bytes at src to the output pointer in local 0 and
+	// returns n.
+	copyOut := func(src, n int) []byte {
+		code := []byte{0x20, 0x00}
+		code = append(code, i32Const(src)...)
+		code = append(code, i32Const(n)...)
+		code = append(code, 0xfc, 0x0a, 0x00, 0x00) // memory.copy
+		return append(code, i32Const(n)...)
+	}
+
+	const (
+		i32     = 0x7f
+		keyAddr = 2048
+		capAddr = keyAddr + 65
+	)
+	types := []byte{4,
+		0x60, 1, i32, 1, i32, // 0: (i32) -> i32
+		0x60, 1, i32, 0, // 1: (i32)
+		0x60, 2, i32, i32, 1, i32, // 2: (i32, i32) -> i32
+		0x60, 6, i32, i32, i32, i32, i32, i32, 1, i32, // 3: (i32 x6) -> i32
+	}
+	var exports []byte
+	exports = append(exports, 8)
+	exports = append(exports, export("memory", 2, 0)...)
+	for i, fn := range []string{"malloc", "free", "plugin_init", "plugin_get_public_key",
+		"plugin_get_metadata", "plugin_handle_request", "plugin_get_capabilities"} {
+		exports = append(exports, export(fn, 0, byte(i))...)
+	}
+
+	var code []byte
+	code = append(code, 7)
+	code = append(code, body(i32Const(1024)...)...)                      // malloc
+	code = append(code, body()...)                                       // free
+	code = append(code, body(i32Const(0)...)...)                         // plugin_init
+	code = append(code, body(copyOut(keyAddr, 65)...)...)                // plugin_get_public_key
+	code = append(code, body(i32Const(0)...)...)                         // plugin_get_metadata
+	code = append(code, body(i32Const(0)...)...)                         // plugin_handle_request
+	code = append(code, body(copyOut(capAddr, len(capabilities))...)...) // plugin_get_capabilities
+
+	segment := append([]byte{0x04}, make([]byte, 64)...) // uncompressed P-256 point
+	segment = append(segment, capabilities...)
+	data := []byte{1, 0}
+	data = append(data, i32Const(keyAddr)...)
+	data = append(data, 0x0b)
+	data = uleb(data, len(segment))
+	data = append(data, segment...)
+
+	var out []byte
+	out = append(out, 0x00, 'a', 's', 'm', 1, 0, 0, 0)
+	out = append(out, section(1, types)...)
+	out = append(out, section(3, []byte{7, 0, 1, 2, 2, 2, 3, 2})...)
+	out = append(out, section(5, []byte{1, 0, 1})...)
+	out = append(out, section(7, exports)...)
+	out = append(out, section(10, code)...)
+	out = append(out, section(11, data)...)
+	return out
+}
+
+type nopDataAccess struct{}
+
+func (nopDataAccess) Query(context.Context, string, wasiplugin.DataQuery) ([][]byte, error) {
+	return nil, nil
+}
+
+func (nopDataAccess) Subscribe(string, func([]byte)) (func(), error) { return func() {}, nil }
+
+func (nopDataAccess) Publish(context.Context, string, []byte) (string, error) { return "", nil }
+
+func TestLoadGrantsDataAccess(t *testing.T) {
+	ctx := context.Background()
+	wasm := dataModule(`{"query":["OMM.fbs","CAT.fbs"],"publish":["CDM.fbs"]}`)
+
+	p := NewFromBytes(wasm)
+	inst, err := p.load(ctx, wasm, nil)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := inst.runtime.Capabilities(); !reflect.DeepEqual(got, wasiplugin.Capabilities{}) {
+		t.Errorf("without data access, granted %+v", got)
+	}
+	inst.close()
+
+	// Only the schemas the claims cover are granted.
+	p.SetDataAccess(nopDataAccess{}, &license.CapabilityClaims{
+		Scopes: wasiplugin.ScopesFor(wasiplugin.Capabilities{Query: []string{"OMM.fbs"}}),
+	}, nil)
+	inst, err = p.load(ctx, wasm, nil)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	want := wasiplugin.Capabilities{Query: []string{"OMM.fbs"}}
+	if got := inst.runtime.Capabilities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("granted %+v, want %+v", got, want)
+	}
+	inst.close()
+
+	// A module asking for more than its signed manifest is refused.
+	manifest := wasiplugin.Capabilities{Query: []string{"OMM.fbs", "CAT.fbs"}}
+	p.SetDataAccess(nopDataAccess{}, &license.CapabilityClaims{Scopes: wasiplugin.ScopesFor(manifest)}, &manifest)
+	if inst, err := p.load(ctx, wasm, nil); err == nil {
+		inst.close()
+		t.Fatal("module declaring capabilities beyond its manifest loaded")
+	}
+	manifest.Publish = []string{"CDM.fbs"}
+	p.SetDataAccess(nopDataAccess{}, &license.CapabilityClaims{Scopes: wasiplugin.ScopesFor(manifest)}, &manifest)
+	inst, err = p.load(ctx, wasm, nil)
+	if err != nil {
+		t.Fatalf("load within the manifest failed: %v", err)
+	}
+	defer inst.close()
+	if got := inst.runtime.Capabilities(); !reflect.DeepEqual(got, manifest) {
+		t.Errorf("granted %+v, want %+v", got, manifest)
+	}
+}
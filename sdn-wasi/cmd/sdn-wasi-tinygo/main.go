@@ -8,7 +8,10 @@ import (
 	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"unsafe"
+
+	"github.com/spacedatanetwork/sdn-wasi/internal/flatbuf"
 )
 
 // ============================================
@@ -77,14 +80,24 @@ type schemaEntry struct {
 var schemas = make([]schemaEntry, 0, 32)
 var nextSchemaID int32 = 1
 
+// registry holds the parsed schemas used by sdn_validate.
+var registry = flatbuf.NewRegistry()
+
 //export sdn_register_schema
 func sdnRegisterSchema(namePtr, nameLen, contentPtr, contentLen uint32) int32 {
 	name := getString(namePtr, nameLen)
 	content := getBytes(contentPtr, contentLen)
 
+	if _, err := registry.Register(name, content); err != nil {
+		setLastError(&flatbuf.Error{Code: flatbuf.CodeInvalidSchema, Offset: -1, Msg: err.Error()})
+		logMsg("Rejected schema " + name + ": " + err.Error())
+		return -int32(flatbuf.CodeInvalidSchema)
+	}
+
 	// Check if exists
 	for i := range schemas {
 		if schemas[i].name == name {
+			schemas[i].content = append(schemas[i].content[:0], content...)
 			return schemas[i].id
 		}
 	}
@@ -130,12 +143,63 @@ func sdnListSchemas() uint32 {
 
 //export sdn_validate
 func sdnValidate(schemaID int32, dataPtr, dataLen uint32) int32 {
-	if dataLen < 4 {
-		return -1
+	name := ""
+	for _, s := range schemas {
+		if s.id == schemaID {
+			name = s.name
+		}
+	}
+	if name == "" {
+		setLastError(&flatbuf.Error{Code: flatbuf.CodeUnknownSchema, Offset: -1, Msg: "unknown schema id"})
+		return -int32(flatbuf.CodeUnknownSchema)
 	}
+
+	var verr *flatbuf.Error
+	if err := registry.Verify(name, getBytes(dataPtr, dataLen)); errors.As(err, &verr) {
+		setLastError(verr)
+		return -int32(verr.Code)
+	}
+	setLastError(nil)
 	return 0
 }
 
+// ValidationError is the JSON form of the last validation failure.
+type ValidationError struct {
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Offset  int64  `json:"offset"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+var lastError *ValidationError
+
+func setLastError(err *flatbuf.Error) {
+	if err == nil {
+		lastError = nil
+		return
+	}
+	lastError = &ValidationError{
+		Code:    int(err.Code),
+		Name:    err.Code.String(),
+		Offset:  err.Offset,
+		Path:    err.Path,
+		Message: err.Error(),
+	}
+}
+
+//export sdn_last_error
+func sdnLastError() uint32 {
+	if lastError == nil {
+		return 0
+	}
+	data, _ := json.Marshal(lastError)
+	// A long message is truncated to the shared buffer rather than
+	// reporting bytes the host would read past what was written.
+	n := copy(sharedBuffer[:], data)
+	return uint32(n)
+}
+
 // ============================================
 // Message Processing
 // ============================================
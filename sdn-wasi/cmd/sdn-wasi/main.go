@@ -16,9 +16,12 @@ import (
 	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"unsafe"
+
+	"github.com/spacedatanetwork/sdn-wasi/internal/flatbuf"
 )
 
 // ============================================
@@ -82,17 +85,32 @@ func sdnGetBufferLen() uint32 {
 
 var schemas = map[string][]byte{}
 var schemaIDs = map[string]int{}
+var schemaNames = map[int]string{}
 var nextSchemaID = 1
 
+// registry holds the parsed schemas used by sdn_validate.
+var registry = flatbuf.NewRegistry()
+
+// sdn_register_schema parses the .fbs content and returns the schema ID, or
+// -15 if the schema does not parse (details via sdn_last_error). Empty content
+// registers the name only; buffers are then checked for structure alone.
+//
 //export sdn_register_schema
 func sdnRegisterSchema(namePtr, nameLen, contentPtr, contentLen uint32) int32 {
 	name := string(getBytes(namePtr, nameLen))
 	content := getBytes(contentPtr, contentLen)
 
+	if _, err := registry.Register(name, content); err != nil {
+		setLastError(&flatbuf.Error{Code: flatbuf.CodeInvalidSchema, Offset: -1, Msg: err.Error()})
+		log(fmt.Sprintf("Rejected schema %s: %v", name, err))
+		return -int32(flatbuf.CodeInvalidSchema)
+	}
+
 	schemas[name] = make([]byte, len(content))
 	copy(schemas[name], content)
 
 	schemaIDs[name] = nextSchemaID
+	schemaNames[nextSchemaID] = name
 	nextSchemaID++
 
 	log(fmt.Sprintf("Registered schema: %s (id=%d)", name, schemaIDs[name]))
@@ -123,24 +141,70 @@ func sdnListSchemas() uint32 {
 // Validation
 // ============================================
 
+// sdn_validate verifies a FlatBuffer against a registered schema. It returns
+// 0 if the buffer is valid, otherwise the negated flatbuf error code; details
+// of the failure are available from sdn_last_error.
+//
 //export sdn_validate
 func sdnValidate(schemaID int32, dataPtr, dataLen uint32) int32 {
-	// Basic validation - in production, use FlatBuffer verifier
 	data := getBytes(dataPtr, dataLen)
 
-	if len(data) < 4 {
-		return -1 // Too short for FlatBuffer
+	name, ok := schemaNames[int(schemaID)]
+	if !ok {
+		setLastError(&flatbuf.Error{Code: flatbuf.CodeUnknownSchema, Offset: -1, Msg: fmt.Sprintf("unknown schema id %d", schemaID)})
+		return -int32(flatbuf.CodeUnknownSchema)
 	}
 
-	// Check FlatBuffer magic bytes or minimum structure
-	// For now, just check non-empty
-	if len(data) == 0 {
-		return -1
+	var verr *flatbuf.Error
+	if err := registry.Verify(name, data); errors.As(err, &verr) {
+		setLastError(verr)
+		return -int32(verr.Code)
 	}
-
+	setLastError(nil)
 	return 0 // Valid
 }
 
+// ValidationError is the JSON form of the last validation failure.
+type ValidationError struct {
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Offset  int64  `json:"offset"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+var lastError *ValidationError
+
+func setLastError(err *flatbuf.Error) {
+	if err == nil {
+		lastError = nil
+		return
+	}
+	lastError = &ValidationError{
+		Code:    int(err.Code),
+		Name:    err.Code.String(),
+		Offset:  err.Offset,
+		Path:    err.Path,
+		Message: err.Error(),
+	}
+}
+
+// sdn_last_error writes the last validation failure as JSON to the shared
+// buffer and returns the number of bytes written, or 0 if the last
+// validation succeeded. Messages longer than the buffer are truncated.
+//
+//export sdn_last_error
+func sdnLastError() uint32 {
+	if lastError == nil {
+		return 0
+	}
+	data, _ := json.Marshal(lastError)
+	// A long message is truncated to the shared buffer rather than
+	// reporting bytes the host would read past what was written.
+	n := copy(sharedBuffer, data)
+	return uint32(n)
+}
+
 // ============================================
 // Message Processing
 // ============================================
@@ -179,7 +243,7 @@ func sdnProcessMessage(schemaPtr, schemaLen, dataPtr, dataLen, sigPtr, sigLen, f
 	}
 
 	if sdnValidate(int32(schemaID), dataPtr, dataLen) != 0 {
-		log(fmt.Sprintf("Validation failed for schema: %s", schema))
+		log(fmt.Sprintf("Validation failed for schema %s: %s", schema, lastError.Message))
 		return -2
 	}
 
@@ -427,8 +491,32 @@ func handleRPC(req RPCRequest) RPCResponse {
 			uint32(uintptr(unsafe.Pointer(&nameBytes[0]))), uint32(len(nameBytes)),
 			contentPtr, contentLen,
 		)
+		if id < 0 {
+			return RPCResponse{Error: lastError.Message, ID: req.ID}
+		}
 		return RPCResponse{Result: id, ID: req.ID}
 
+	case "validate":
+		var params struct {
+			Schema string `json:"schema"`
+			Data   []byte `json:"data"` // base64 in JSON
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		id, ok := schemaIDs[params.Schema]
+		if !ok {
+			return RPCResponse{Error: "unknown schema: " + params.Schema, ID: req.ID}
+		}
+		var dataPtr uint32
+		if len(params.Data) > 0 {
+			dataPtr = uint32(uintptr(unsafe.Pointer(&params.Data[0])))
+		}
+		if sdnValidate(int32(id), dataPtr, uint32(len(params.Data))) != 0 {
+			return RPCResponse{Result: map[string]interface{}{"valid": false, "error": lastError}, ID: req.ID}
+		}
+		return RPCResponse{Result: map[string]interface{}{"valid": true}, ID: req.ID}
+
 	case "get_message_count":
 		return RPCResponse{Result: sdnGetMessageCount(), ID: req.ID}
 
@@ -0,0 +1,152 @@
+package flatbuf
+
+import "fmt"
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of schema"
+	case tokIdent:
+		return "identifier"
+	case tokNumber:
+		return "number"
+	case tokString:
+		return "string"
+	}
+	return "punctuation"
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+type lexer struct {
+	src  []byte
+	pos  int
+	line int
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// skipSpace skips whitespace and // and /* */ comments.
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '/' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '/':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '*':
+			start := l.line
+			l.pos += 2
+			for {
+				if l.pos+1 >= len(l.src) {
+					return &ParseError{Line: start, Msg: "unterminated comment"}
+				}
+				if l.src[l.pos] == '*' && l.src[l.pos+1] == '/' {
+					l.pos += 2
+					break
+				}
+				if l.src[l.pos] == '\n' {
+					l.line++
+				}
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case isIdentStart(c):
+		// Dotted names cover namespaces and qualified type references.
+		for l.pos < len(l.src) && (isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: string(l.src[start:l.pos]), line: l.line}, nil
+
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])) ||
+		((c == '-' || c == '+') && l.pos+1 < len(l.src) && (isDigit(l.src[l.pos+1]) || isIdentStart(l.src[l.pos+1]) || l.src[l.pos+1] == '.')):
+		// Signed identifiers cover defaults such as -inf and +nan.
+		l.pos++
+		for l.pos < len(l.src) {
+			d := l.src[l.pos]
+			if isDigit(d) || isIdentStart(d) || d == '.' ||
+				((d == '-' || d == '+') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E')) {
+				l.pos++
+				continue
+			}
+			break
+		}
+		return token{kind: tokNumber, text: string(l.src[start:l.pos]), line: l.line}, nil
+
+	case c == '"' || c == '\'':
+		l.pos++
+		var out []byte
+		for {
+			if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+				return token{}, &ParseError{Line: l.line, Msg: "unterminated string"}
+			}
+			d := l.src[l.pos]
+			if d == c {
+				l.pos++
+				break
+			}
+			if d == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+				d = l.src[l.pos]
+				switch d {
+				case 'n':
+					d = '\n'
+				case 't':
+					d = '\t'
+				}
+			}
+			out = append(out, d)
+			l.pos++
+		}
+		return token{kind: tokString, text: string(out), line: l.line}, nil
+
+	case c == '{' || c == '}' || c == '(' || c == ')' || c == '[' || c == ']' ||
+		c == ':' || c == ';' || c == ',' || c == '=':
+		l.pos++
+		return token{kind: tokPunct, text: string(c), line: l.line}, nil
+	}
+	return token{}, &ParseError{Line: l.line, Msg: fmt.Sprintf("unexpected character %q", c)}
+}
@@ -0,0 +1,214 @@
+package flatbuf
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry holds parsed schemas. Type names are shared across all registered
+// schemas so that definitions from included files resolve regardless of the
+// order in which the files were registered.
+type Registry struct {
+	mu        sync.Mutex
+	schemas   map[string]*Schema
+	qualified map[string]interface{} // namespace.Name -> *Object or *Enum
+	short     map[string]interface{} // Name -> *Object or *Enum
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas:   make(map[string]*Schema),
+		qualified: make(map[string]interface{}),
+		short:     make(map[string]interface{}),
+	}
+}
+
+// Register parses and stores a schema under name, replacing any schema of the
+// same name. Empty source registers a schema without definitions, for which
+// only the buffer structure can be verified.
+func (r *Registry) Register(name string, src []byte) (*Schema, error) {
+	schema, err := Parse(name, src)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[name] = schema
+	r.rebuild()
+	return schema, nil
+}
+
+// Schema returns a registered schema.
+func (r *Registry) Schema(name string) (*Schema, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.schemas[name]
+	return s, ok
+}
+
+// rebuild reindexes type names and drops resolved type links, which may
+// point at definitions from a replaced schema.
+func (r *Registry) rebuild() {
+	r.qualified = make(map[string]interface{})
+	r.short = make(map[string]interface{})
+	for _, s := range r.schemas {
+		for _, obj := range s.Objects {
+			r.qualified[qualified(obj.Namespace, obj.Name)] = obj
+			r.short[obj.Name] = obj
+			obj.resolved = false
+			for _, f := range obj.Fields {
+				unlink(&f.Type)
+			}
+		}
+		for _, enum := range s.Enums {
+			r.qualified[qualified(enum.Namespace, enum.Name)] = enum
+			r.short[enum.Name] = enum
+		}
+	}
+}
+
+func unlink(t *Type) {
+	t.object, t.enum = nil, nil
+	if t.Elem != nil {
+		unlink(t.Elem)
+	}
+}
+
+// lookup finds a type by name as seen from namespace ns.
+func (r *Registry) lookup(ns, name string) interface{} {
+	if def, ok := r.qualified[qualified(ns, name)]; ok {
+		return def
+	}
+	if def, ok := r.qualified[name]; ok {
+		return def
+	}
+	return r.short[shortName(name)]
+}
+
+func (r *Registry) resolveType(ns string, t *Type) *Error {
+	switch t.Base {
+	case TypeVector, TypeArray:
+		return r.resolveType(ns, t.Elem)
+	case TypeNamed:
+		if t.object != nil || t.enum != nil {
+			return nil
+		}
+		switch def := r.lookup(ns, t.Name).(type) {
+		case *Object:
+			t.object = def
+		case *Enum:
+			t.enum = def
+		default:
+			return &Error{Code: CodeUnresolvedType, Msg: "unresolved type " + t.Name}
+		}
+	}
+	return nil
+}
+
+func isUnion(t *Type) bool {
+	if t.Base == TypeVector {
+		t = t.Elem
+	}
+	return t.enum != nil && t.enum.IsUnion
+}
+
+// resolveObject links an object's field types and computes its vtable slots
+// (tables) or its inline layout (structs).
+func (r *Registry) resolveObject(obj *Object) *Error {
+	if obj.resolved {
+		return nil
+	}
+	if obj.resolving {
+		return &Error{Code: CodeUnresolvedType, Msg: "struct " + obj.Name + " contains itself"}
+	}
+	obj.resolving = true
+	defer func() { obj.resolving = false }()
+
+	for _, f := range obj.Fields {
+		if err := r.resolveType(obj.Namespace, &f.Type); err != nil {
+			err.Path = obj.Name + "." + f.Name
+			return err
+		}
+	}
+
+	if obj.IsStruct {
+		size, align := 0, 1
+		for _, f := range obj.Fields {
+			fs, fa, err := r.inlineSize(&f.Type)
+			if err != nil {
+				err.Path = obj.Name + "." + f.Name
+				return err
+			}
+			size = alignUp(size, fa) + fs
+			if fa > align {
+				align = fa
+			}
+		}
+		if obj.ForceAlign > align {
+			align = obj.ForceAlign
+		}
+		obj.size, obj.align = alignUp(size, align), align
+	} else {
+		next := 0
+		for _, f := range obj.Fields {
+			union := isUnion(&f.Type)
+			switch {
+			case f.ID >= 0:
+				f.slot, f.typeSlot = f.ID, -1
+				if union {
+					if f.ID == 0 {
+						return &Error{Code: CodeUnresolvedType, Path: obj.Name + "." + f.Name, Msg: "union field cannot have id 0"}
+					}
+					f.typeSlot = f.ID - 1
+				}
+			case union:
+				f.typeSlot, f.slot = next, next+1
+				next += 2
+			default:
+				f.slot, f.typeSlot = next, -1
+				next++
+			}
+		}
+	}
+	obj.resolved = true
+	return nil
+}
+
+// inlineSize returns the size and alignment of a value stored inline in a
+// table, struct or vector.
+func (r *Registry) inlineSize(t *Type) (int, int, *Error) {
+	switch t.Base {
+	case TypeString, TypeVector:
+		return 4, 4, nil
+	case TypeArray:
+		size, align, err := r.inlineSize(t.Elem)
+		return size * t.Length, align, err
+	case TypeNamed:
+		switch {
+		case t.enum != nil && t.enum.IsUnion:
+			return 4, 4, nil
+		case t.enum != nil:
+			n := t.enum.Underlying.Size()
+			return n, n, nil
+		case t.object != nil && t.object.IsStruct:
+			if err := r.resolveObject(t.object); err != nil {
+				return 0, 0, err
+			}
+			return t.object.size, t.object.align, nil
+		case t.object != nil:
+			return 4, 4, nil
+		}
+		return 0, 0, &Error{Code: CodeUnresolvedType, Msg: "unresolved type " + t.Name}
+	}
+	n := t.Base.Size()
+	return n, n, nil
+}
+
+func alignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
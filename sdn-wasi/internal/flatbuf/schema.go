@@ -0,0 +1,594 @@
+// Package flatbuf parses FlatBuffers schemas (.fbs) and verifies binary
+// buffers against them. It has no dependencies beyond the standard library so
+// it can be compiled into the WASI module with either Go or TinyGo.
+package flatbuf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BaseType is the kind of a schema type.
+type BaseType int
+
+const (
+	TypeNone BaseType = iota
+	TypeBool
+	TypeInt8
+	TypeUint8
+	TypeInt16
+	TypeUint16
+	TypeInt32
+	TypeUint32
+	TypeInt64
+	TypeUint64
+	TypeFloat32
+	TypeFloat64
+	TypeString
+	TypeVector
+	TypeArray // fixed-length array, structs only
+	TypeNamed // table, struct, enum or union; resolved against the registry
+)
+
+var scalarTypes = map[string]BaseType{
+	"bool":    TypeBool,
+	"byte":    TypeInt8,
+	"ubyte":   TypeUint8,
+	"int8":    TypeInt8,
+	"uint8":   TypeUint8,
+	"short":   TypeInt16,
+	"ushort":  TypeUint16,
+	"int16":   TypeInt16,
+	"uint16":  TypeUint16,
+	"int":     TypeInt32,
+	"uint":    TypeUint32,
+	"int32":   TypeInt32,
+	"uint32":  TypeUint32,
+	"float":   TypeFloat32,
+	"float32": TypeFloat32,
+	"long":    TypeInt64,
+	"ulong":   TypeUint64,
+	"int64":   TypeInt64,
+	"uint64":  TypeUint64,
+	"double":  TypeFloat64,
+	"float64": TypeFloat64,
+}
+
+// Size returns the encoded size of a scalar type, or 0 for non-scalars.
+func (b BaseType) Size() int {
+	switch b {
+	case TypeBool, TypeInt8, TypeUint8:
+		return 1
+	case TypeInt16, TypeUint16:
+		return 2
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 4
+	case TypeInt64, TypeUint64, TypeFloat64:
+		return 8
+	}
+	return 0
+}
+
+// Type is a field type.
+type Type struct {
+	Base   BaseType
+	Elem   *Type  // element type of vectors and arrays
+	Length int    // length of fixed arrays
+	Name   string // referenced type name for TypeNamed
+
+	object *Object // resolved table or struct
+	enum   *Enum   // resolved enum or union
+}
+
+// Field is a table or struct field.
+type Field struct {
+	Name       string
+	Type       Type
+	Required   bool
+	Deprecated bool
+	ID         int // explicit id attribute, or -1
+
+	slot     int // vtable slot of the value
+	typeSlot int // vtable slot of a union's type field, or -1
+}
+
+// Object is a table or struct definition.
+type Object struct {
+	Name       string
+	Namespace  string
+	IsStruct   bool
+	ForceAlign int
+	Fields     []*Field
+
+	resolved    bool
+	resolving   bool
+	size, align int // struct layout
+}
+
+// EnumVal is one value of an enum or member of a union.
+type EnumVal struct {
+	Name  string
+	Type  string // member type for unions
+	Value int64
+}
+
+// Enum is an enum or union definition.
+type Enum struct {
+	Name       string
+	Namespace  string
+	IsUnion    bool
+	Underlying BaseType
+	Values     []EnumVal
+}
+
+// Schema is a parsed .fbs file.
+type Schema struct {
+	Name           string
+	Namespace      string
+	FileIdentifier string
+	RootType       string
+	Includes       []string
+	Objects        []*Object
+	Enums          []*Enum
+}
+
+// ParseError reports a syntax error in a schema.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses FlatBuffers schema source. Types referenced from included
+// files are left unresolved until verification.
+func Parse(name string, src []byte) (*Schema, error) {
+	p := &parser{lex: lexer{src: src, line: 1}, schema: &Schema{Name: name}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	for _, obj := range p.schema.Objects {
+		if err := checkIDs(obj); err != nil {
+			return nil, err
+		}
+	}
+	return p.schema, nil
+}
+
+// checkIDs enforces that either all or none of a table's fields carry an id
+// attribute. Slots are assigned once field types are resolved.
+func checkIDs(obj *Object) error {
+	if obj.IsStruct {
+		return nil
+	}
+	withID := 0
+	for _, f := range obj.Fields {
+		if f.ID >= 0 {
+			withID++
+		}
+	}
+	if withID > 0 && withID != len(obj.Fields) {
+		return fmt.Errorf("table %s: either all or no fields must have an id", obj.Name)
+	}
+	return nil
+}
+
+type parser struct {
+	lex       lexer
+	tok       token
+	schema    *Schema
+	namespace string
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Line: p.tok.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if p.tok.kind != kind || (text != "" && p.tok.text != text) {
+		want := text
+		if want == "" {
+			want = kind.String()
+		}
+		return p.errorf("expected %s, got %q", want, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.errorf("expected identifier, got %q", p.tok.text)
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *parser) str() (string, error) {
+	if p.tok.kind != tokString {
+		return "", p.errorf("expected string, got %q", p.tok.text)
+	}
+	s := p.tok.text
+	return s, p.next()
+}
+
+func (p *parser) parse() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	for p.tok.kind != tokEOF {
+		if p.tok.kind != tokIdent {
+			return p.errorf("unexpected %q", p.tok.text)
+		}
+		var err error
+		switch p.tok.text {
+		case "include", "native_include":
+			include := p.tok.text == "include"
+			if err = p.next(); err != nil {
+				return err
+			}
+			var path string
+			if path, err = p.str(); err != nil {
+				return err
+			}
+			if include {
+				p.schema.Includes = append(p.schema.Includes, path)
+			}
+			err = p.expect(tokPunct, ";")
+		case "namespace":
+			if err = p.next(); err != nil {
+				return err
+			}
+			if p.namespace, err = p.ident(); err != nil {
+				return err
+			}
+			p.schema.Namespace = p.namespace
+			err = p.expect(tokPunct, ";")
+		case "attribute":
+			if err = p.next(); err != nil {
+				return err
+			}
+			if p.tok.kind != tokString && p.tok.kind != tokIdent {
+				return p.errorf("expected attribute name")
+			}
+			if err = p.next(); err != nil {
+				return err
+			}
+			err = p.expect(tokPunct, ";")
+		case "file_identifier":
+			if err = p.next(); err != nil {
+				return err
+			}
+			var id string
+			if id, err = p.str(); err != nil {
+				return err
+			}
+			if len(id) != 4 {
+				return p.errorf("file_identifier must be exactly 4 characters")
+			}
+			p.schema.FileIdentifier = id
+			err = p.expect(tokPunct, ";")
+		case "file_extension":
+			if err = p.next(); err != nil {
+				return err
+			}
+			if _, err = p.str(); err != nil {
+				return err
+			}
+			err = p.expect(tokPunct, ";")
+		case "root_type":
+			if err = p.next(); err != nil {
+				return err
+			}
+			if p.schema.RootType, err = p.ident(); err != nil {
+				return err
+			}
+			err = p.expect(tokPunct, ";")
+		case "table", "struct":
+			err = p.parseObject(p.tok.text == "struct")
+		case "enum", "union":
+			err = p.parseEnum(p.tok.text == "union")
+		case "rpc_service":
+			err = p.skipDecl()
+		default:
+			return p.errorf("unexpected %q", p.tok.text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDecl skips a declaration up to and including its closing brace.
+func (p *parser) skipDecl() error {
+	depth := 0
+	for {
+		if p.tok.kind == tokEOF {
+			return p.errorf("unexpected end of schema")
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "{" {
+			depth++
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "}" {
+			depth--
+			if depth == 0 {
+				return p.next()
+			}
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseMetadata parses an optional "(key: value, ...)" attribute list.
+func (p *parser) parseMetadata() (map[string]string, error) {
+	attrs := map[string]string{}
+	if p.tok.kind != tokPunct || p.tok.text != "(" {
+		return attrs, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for !(p.tok.kind == tokPunct && p.tok.text == ")") {
+		key, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		attrs[key] = ""
+		if p.tok.kind == tokPunct && p.tok.text == ":" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokString && p.tok.kind != tokNumber && p.tok.kind != tokIdent {
+				return nil, p.errorf("invalid value for attribute %s", key)
+			}
+			attrs[key] = p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "," {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		} else if !(p.tok.kind == tokPunct && p.tok.text == ")") {
+			return nil, p.errorf("expected , or ) in attribute list")
+		}
+	}
+	return attrs, p.next()
+}
+
+func (p *parser) parseType() (Type, error) {
+	if p.tok.kind == tokPunct && p.tok.text == "[" {
+		if err := p.next(); err != nil {
+			return Type{}, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return Type{}, err
+		}
+		if elem.Base == TypeVector || elem.Base == TypeArray {
+			return Type{}, p.errorf("nested vectors are not supported")
+		}
+		t := Type{Base: TypeVector, Elem: &elem}
+		if p.tok.kind == tokPunct && p.tok.text == ":" {
+			if err := p.next(); err != nil {
+				return Type{}, err
+			}
+			if p.tok.kind != tokNumber {
+				return Type{}, p.errorf("expected array length")
+			}
+			n, err := strconv.ParseInt(p.tok.text, 0, 32)
+			if err != nil || n <= 0 || n > 0xFFFF {
+				return Type{}, p.errorf("invalid array length %q", p.tok.text)
+			}
+			t.Base, t.Length = TypeArray, int(n)
+			if err := p.next(); err != nil {
+				return Type{}, err
+			}
+		}
+		return t, p.expect(tokPunct, "]")
+	}
+
+	name, err := p.ident()
+	if err != nil {
+		return Type{}, err
+	}
+	if base, ok := scalarTypes[name]; ok {
+		return Type{Base: base}, nil
+	}
+	if name == "string" {
+		return Type{Base: TypeString}, nil
+	}
+	return Type{Base: TypeNamed, Name: name}, nil
+}
+
+func (p *parser) parseObject(isStruct bool) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	obj := &Object{Name: name, Namespace: p.namespace, IsStruct: isStruct}
+	attrs, err := p.parseMetadata()
+	if err != nil {
+		return err
+	}
+	if v, ok := attrs["force_align"]; ok {
+		obj.ForceAlign, _ = strconv.Atoi(v)
+	}
+	if err := p.expect(tokPunct, "{"); err != nil {
+		return err
+	}
+
+	for !(p.tok.kind == tokPunct && p.tok.text == "}") {
+		fname, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(tokPunct, ":"); err != nil {
+			return err
+		}
+		ftype, err := p.parseType()
+		if err != nil {
+			return err
+		}
+		if ftype.Base == TypeArray && !isStruct {
+			return p.errorf("fixed-length arrays are only allowed in structs")
+		}
+		if isStruct && (ftype.Base == TypeString || ftype.Base == TypeVector) {
+			return p.errorf("struct %s: field %s must be a scalar, struct or array", name, fname)
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "=" {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if p.tok.kind == tokPunct && p.tok.text == "[" {
+				// Only the empty vector is allowed as a vector default.
+				if err := p.next(); err != nil {
+					return err
+				}
+				if p.tok.kind != tokPunct || p.tok.text != "]" {
+					return p.errorf("invalid default for field %s", fname)
+				}
+			} else if p.tok.kind != tokNumber && p.tok.kind != tokIdent && p.tok.kind != tokString {
+				return p.errorf("invalid default for field %s", fname)
+			}
+			if err := p.next(); err != nil {
+				return err
+			}
+		}
+		fattrs, err := p.parseMetadata()
+		if err != nil {
+			return err
+		}
+		field := &Field{Name: fname, Type: ftype, ID: -1}
+		_, field.Required = fattrs["required"]
+		_, field.Deprecated = fattrs["deprecated"]
+		if v, ok := fattrs["id"]; ok {
+			if field.ID, err = strconv.Atoi(v); err != nil || field.ID < 0 {
+				return p.errorf("invalid id for field %s", fname)
+			}
+		}
+		obj.Fields = append(obj.Fields, field)
+		if err := p.expect(tokPunct, ";"); err != nil {
+			return err
+		}
+	}
+	p.schema.Objects = append(p.schema.Objects, obj)
+	return p.next()
+}
+
+func (p *parser) parseEnum(isUnion bool) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	enum := &Enum{Name: name, Namespace: p.namespace, IsUnion: isUnion, Underlying: TypeUint8}
+	if p.tok.kind == tokPunct && p.tok.text == ":" {
+		if err := p.next(); err != nil {
+			return err
+		}
+		base, err := p.ident()
+		if err != nil {
+			return err
+		}
+		bt, ok := scalarTypes[base]
+		if !ok || bt == TypeFloat32 || bt == TypeFloat64 {
+			return p.errorf("enum %s: invalid underlying type %s", name, base)
+		}
+		enum.Underlying = bt
+	} else if !isUnion {
+		return p.errorf("enum %s must declare an underlying type", name)
+	}
+	if _, err := p.parseMetadata(); err != nil {
+		return err
+	}
+	if err := p.expect(tokPunct, "{"); err != nil {
+		return err
+	}
+
+	var value int64
+	for !(p.tok.kind == tokPunct && p.tok.text == "}") {
+		vname, err := p.ident()
+		if err != nil {
+			return err
+		}
+		val := EnumVal{Name: vname, Type: vname}
+		if isUnion && p.tok.kind == tokPunct && p.tok.text == ":" {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if val.Type, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "=" {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if p.tok.kind != tokNumber {
+				return p.errorf("expected value for %s", vname)
+			}
+			v, err := strconv.ParseInt(p.tok.text, 0, 64)
+			if err != nil {
+				return p.errorf("invalid value for %s", vname)
+			}
+			value = v
+			if err := p.next(); err != nil {
+				return err
+			}
+		} else if isUnion && len(enum.Values) == 0 {
+			value = 1 // 0 is the implicit NONE member
+		}
+		val.Value = value
+		value++
+		enum.Values = append(enum.Values, val)
+		if _, err := p.parseMetadata(); err != nil {
+			return err
+		}
+		if p.tok.kind == tokPunct && p.tok.text == "," {
+			if err := p.next(); err != nil {
+				return err
+			}
+		} else if !(p.tok.kind == tokPunct && p.tok.text == "}") {
+			return p.errorf("expected , or } in %s", name)
+		}
+	}
+	p.schema.Enums = append(p.schema.Enums, enum)
+	return p.next()
+}
+
+// qualified returns the namespace-qualified name of a definition.
+func qualified(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// shortName strips any namespace from a type name.
+func shortName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,109 @@
+package flatbuf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	s, err := Parse("TEST", []byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if s.Namespace != "Test.Schema" || s.FileIdentifier != "TEST" || s.RootType != "Root" {
+		t.Errorf("header = %q %q %q", s.Namespace, s.FileIdentifier, s.RootType)
+	}
+	if len(s.Objects) != 3 || len(s.Enums) != 2 {
+		t.Fatalf("got %d objects and %d enums, want 3 and 2", len(s.Objects), len(s.Enums))
+	}
+
+	kind := s.Enums[0]
+	if kind.Underlying != TypeInt8 || kind.Values[2].Value != 3 {
+		t.Errorf("enum Kind = %+v", kind)
+	}
+	any := s.Enums[1]
+	if !any.IsUnion || any.Values[0].Value != 1 || any.Values[1].Type != "Item" {
+		t.Errorf("union Any = %+v", any)
+	}
+
+	root := s.Objects[2]
+	if root.Fields[2].Type.Base != TypeVector || root.Fields[2].Type.Elem.Name != "Item" {
+		t.Errorf("items type = %+v", root.Fields[2].Type)
+	}
+	if !root.Fields[7].Deprecated || !s.Objects[1].Fields[0].Required {
+		t.Error("field attributes not parsed")
+	}
+}
+
+func TestResolveSlotsAndLayout(t *testing.T) {
+	reg := NewRegistry()
+	_, err := reg.Register("IDS", []byte(`
+struct Pair (force_align: 8) { a:byte; b:int; }
+struct Padded { c:byte; d:double; e:[short:3]; }
+union U { Pair }
+table T {
+  u:U (id: 2);
+  x:int (id: 0);
+  y:int (id: 3);
+}
+table Seq { a:int; u:U; b:int; }
+`))
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	s, _ := reg.Schema("IDS")
+
+	layout := func(name string) (int, int) {
+		obj := reg.lookup("", name).(*Object)
+		if err := reg.resolveObject(obj); err != nil {
+			t.Fatalf("resolve %s: %v", name, err)
+		}
+		return obj.size, obj.align
+	}
+	if size, align := layout("Pair"); size != 8 || align != 8 {
+		t.Errorf("Pair layout = %d/%d, want 8/8", size, align)
+	}
+	if size, align := layout("Padded"); size != 24 || align != 8 {
+		t.Errorf("Padded layout = %d/%d, want 24/8", size, align)
+	}
+
+	layout("T")
+	u := s.Objects[2].Fields[0]
+	if u.slot != 2 || u.typeSlot != 1 {
+		t.Errorf("union with id: slot %d type slot %d", u.slot, u.typeSlot)
+	}
+	layout("Seq")
+	seq := s.Objects[3].Fields
+	if seq[1].typeSlot != 1 || seq[1].slot != 2 || seq[2].slot != 3 {
+		t.Errorf("sequential slots = %d/%d, %d", seq[1].typeSlot, seq[1].slot, seq[2].slot)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"unterminated table", "table T { a:int;"},
+		{"bad identifier", `file_identifier "TOOLONG";`},
+		{"array in table", "table T { a:[int:4]; }"},
+		{"string in struct", "struct S { a:string; }"},
+		{"mixed ids", "table T { a:int (id: 0); b:int; }"},
+		{"enum without type", "enum E { A }"},
+		{"unterminated comment", "/* table T {}"},
+		{"unknown keyword", "message T {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse("BAD", []byte(tt.src)); err == nil {
+				t.Error("expected parse error")
+			}
+		})
+	}
+
+	_, err := Parse("BAD", []byte("table T {\n  a int;\n}"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 {
+		t.Errorf("err = %v, want ParseError on line 2", err)
+	}
+}
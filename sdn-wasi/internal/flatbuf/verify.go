@@ -0,0 +1,431 @@
+package flatbuf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Code classifies a verification failure. Codes are stable: the WASI module
+// returns them negated from sdn_validate.
+type Code int
+
+const (
+	CodeOK                   Code = 0
+	CodeBufferTooShort       Code = 1
+	CodeIdentifierMismatch   Code = 2
+	CodeOutOfBounds          Code = 3
+	CodeMisaligned           Code = 4
+	CodeInvalidVTable        Code = 5
+	CodeRequiredFieldMissing Code = 6
+	CodeInvalidString        Code = 7
+	CodeInvalidVector        Code = 8
+	CodeInvalidUnion         Code = 9
+	CodeDepthLimit           Code = 10
+	CodeTableLimit           Code = 11
+	CodeUnresolvedType       Code = 12
+	CodeNoRootType           Code = 13
+	CodeUnknownSchema        Code = 14
+	CodeInvalidSchema        Code = 15
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                   "ok",
+	CodeBufferTooShort:       "buffer_too_short",
+	CodeIdentifierMismatch:   "identifier_mismatch",
+	CodeOutOfBounds:          "out_of_bounds",
+	CodeMisaligned:           "misaligned",
+	CodeInvalidVTable:        "invalid_vtable",
+	CodeRequiredFieldMissing: "required_field_missing",
+	CodeInvalidString:        "invalid_string",
+	CodeInvalidVector:        "invalid_vector",
+	CodeInvalidUnion:         "invalid_union",
+	CodeDepthLimit:           "depth_limit",
+	CodeTableLimit:           "table_limit",
+	CodeUnresolvedType:       "unresolved_type",
+	CodeNoRootType:           "no_root_type",
+	CodeUnknownSchema:        "unknown_schema",
+	CodeInvalidSchema:        "invalid_schema",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return "code_" + strconv.Itoa(int(c))
+}
+
+// Verification limits, matching the FlatBuffers verifier defaults.
+const (
+	MaxDepth  = 64
+	MaxTables = 1000000
+)
+
+// Error describes where and why a buffer failed verification.
+type Error struct {
+	Code   Code
+	Offset int64  // byte offset in the buffer, or -1
+	Path   string // field path, e.g. "OMM.EPOCH" or "CAT.RECORDS[3]"
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	msg := e.Code.String()
+	if e.Msg != "" {
+		msg += ": " + e.Msg
+	}
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	if e.Offset >= 0 {
+		msg += " (offset " + strconv.FormatInt(e.Offset, 10) + ")"
+	}
+	return msg
+}
+
+// Verify checks that buf is a well-formed FlatBuffer of the named schema's
+// root type, with or without a 4-byte size prefix: the file identifier matches, every offset and vtable lies within
+// the buffer and is aligned, strings are terminated, vectors fit, unions and
+// nested tables are valid and required fields are present. Schemas without
+// definitions only get the root table's structure checked. The returned error
+// is an *Error.
+func (r *Registry) Verify(schemaName string, buf []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schema, ok := r.schemas[schemaName]
+	if !ok {
+		return &Error{Code: CodeUnknownSchema, Offset: -1, Msg: "unknown schema " + schemaName}
+	}
+	v := &verifier{reg: r, buf: buf}
+	if err := v.verify(schema); err != nil {
+		return err
+	}
+	return nil
+}
+
+type verifier struct {
+	reg    *Registry
+	buf    []byte
+	depth  int
+	tables int
+}
+
+func (v *verifier) errorf(code Code, off int64, path, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Offset: off, Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+// sizePrefixed reports whether the buffer starts with a size prefix: a
+// uoffset holding the length of the rest of the buffer. The file identifier
+// decides a buffer that would be valid either way.
+func (v *verifier) sizePrefixed(id string) bool {
+	if len(v.buf) < 12 || v.u32(0) != int64(len(v.buf)-4) {
+		return false
+	}
+	return id == "" || string(v.buf[8:12]) == id || string(v.buf[4:8]) != id
+}
+
+func (v *verifier) verify(schema *Schema) *Error {
+	if len(v.buf) < 8 {
+		return v.errorf(CodeBufferTooShort, -1, "", "%d bytes", len(v.buf))
+	}
+	// Offsets are relative to their own position, so a size-prefixed
+	// buffer is verified in place with its header shifted by 4 bytes.
+	var base int64
+	if v.sizePrefixed(schema.FileIdentifier) {
+		base = 4
+	}
+	if id := schema.FileIdentifier; id != "" && string(v.buf[base+4:base+8]) != id {
+		return v.errorf(CodeIdentifierMismatch, base+4, "", "got %q, want %q", v.buf[base+4:base+8], id)
+	}
+	root, err := v.deref(base, "")
+	if err != nil {
+		return err
+	}
+
+	if schema.RootType == "" {
+		if len(schema.Objects) > 0 {
+			return v.errorf(CodeNoRootType, -1, "", "schema %s declares no root_type", schema.Name)
+		}
+		_, _, _, err := v.vtable(root, "$")
+		return err
+	}
+
+	obj, ok := v.reg.lookup(schema.Namespace, schema.RootType).(*Object)
+	if !ok || obj.IsStruct {
+		return v.errorf(CodeUnresolvedType, -1, schema.RootType, "root type is not a table")
+	}
+	return v.table(obj, root, obj.Name)
+}
+
+func (v *verifier) inBounds(off, size int64) bool {
+	return off >= 0 && size >= 0 && off+size <= int64(len(v.buf))
+}
+
+func (v *verifier) check(off, size, align int64, path string) *Error {
+	if !v.inBounds(off, size) {
+		return v.errorf(CodeOutOfBounds, off, path, "%d bytes exceed buffer of %d", size, len(v.buf))
+	}
+	if align > 1 && off%align != 0 {
+		return v.errorf(CodeMisaligned, off, path, "expected %d-byte alignment", align)
+	}
+	return nil
+}
+
+func (v *verifier) u16(off int64) int64 { return int64(binary.LittleEndian.Uint16(v.buf[off:])) }
+func (v *verifier) u32(off int64) int64 { return int64(binary.LittleEndian.Uint32(v.buf[off:])) }
+func (v *verifier) i32(off int64) int64 { return int64(int32(binary.LittleEndian.Uint32(v.buf[off:]))) }
+
+// deref follows the uoffset stored at pos.
+func (v *verifier) deref(pos int64, path string) (int64, *Error) {
+	if err := v.check(pos, 4, 4, path); err != nil {
+		return 0, err
+	}
+	o := v.u32(pos)
+	if o == 0 || o > 0x7FFFFFFF {
+		return 0, v.errorf(CodeOutOfBounds, pos, path, "invalid offset %d", o)
+	}
+	if !v.inBounds(pos+o, 1) {
+		return 0, v.errorf(CodeOutOfBounds, pos, path, "offset %d points past end of buffer", o)
+	}
+	return pos + o, nil
+}
+
+// vtable validates the vtable of the table at t and returns its position,
+// vtable size and inline table size.
+func (v *verifier) vtable(t int64, path string) (vt, vtsize, tblsize int64, err *Error) {
+	if err := v.check(t, 4, 4, path); err != nil {
+		return 0, 0, 0, err
+	}
+	vt = t - v.i32(t)
+	if !v.inBounds(vt, 4) || vt%2 != 0 {
+		return 0, 0, 0, v.errorf(CodeInvalidVTable, t, path, "vtable at %d is out of bounds or misaligned", vt)
+	}
+	vtsize, tblsize = v.u16(vt), v.u16(vt+2)
+	if vtsize < 4 || vtsize%2 != 0 || !v.inBounds(vt, vtsize) {
+		return 0, 0, 0, v.errorf(CodeInvalidVTable, vt, path, "invalid vtable size %d", vtsize)
+	}
+	if tblsize < 4 || !v.inBounds(t, tblsize) {
+		return 0, 0, 0, v.errorf(CodeInvalidVTable, vt, path, "invalid table size %d", tblsize)
+	}
+	for o := int64(4); o < vtsize; o += 2 {
+		if voff := v.u16(vt + o); voff != 0 && (voff < 4 || voff >= tblsize) {
+			return 0, 0, 0, v.errorf(CodeInvalidVTable, vt+o, path, "field offset %d outside table of %d bytes", voff, tblsize)
+		}
+	}
+	return vt, vtsize, tblsize, nil
+}
+
+func (v *verifier) table(obj *Object, t int64, path string) *Error {
+	v.depth++
+	defer func() { v.depth-- }()
+	if v.depth > MaxDepth {
+		return v.errorf(CodeDepthLimit, t, path, "nesting deeper than %d", MaxDepth)
+	}
+	v.tables++
+	if v.tables > MaxTables {
+		return v.errorf(CodeTableLimit, t, path, "more than %d tables", MaxTables)
+	}
+	if err := v.reg.resolveObject(obj); err != nil {
+		err.Offset = t
+		return err
+	}
+
+	vt, vtsize, tblsize, err := v.vtable(t, path)
+	if err != nil {
+		return err
+	}
+	slot := func(n int) int64 {
+		o := int64(4 + 2*n)
+		if n < 0 || o >= vtsize {
+			return 0
+		}
+		return v.u16(vt + o)
+	}
+
+	for _, f := range obj.Fields {
+		fpath := path + "." + f.Name
+		if isUnion(&f.Type) {
+			if err := v.union(f, t, slot(f.typeSlot), slot(f.slot), tblsize, fpath); err != nil {
+				return err
+			}
+			continue
+		}
+		voff := slot(f.slot)
+		if voff == 0 {
+			if f.Required {
+				return v.errorf(CodeRequiredFieldMissing, t, fpath, "required field is missing")
+			}
+			continue
+		}
+		if err := v.field(&f.Type, t+voff, tblsize-voff, fpath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field verifies a table field at pos with room bytes left in the table.
+func (v *verifier) field(t *Type, pos, room int64, path string) *Error {
+	size, align, err := v.reg.inlineSize(t)
+	if err != nil {
+		err.Offset, err.Path = pos, path
+		return err
+	}
+	if int64(size) > room {
+		return v.errorf(CodeOutOfBounds, pos, path, "field extends past end of table")
+	}
+	if err := v.check(pos, int64(size), int64(align), path); err != nil {
+		return err
+	}
+
+	switch {
+	case t.Base == TypeString:
+		target, err := v.deref(pos, path)
+		if err != nil {
+			return err
+		}
+		return v.string(target, path)
+	case t.Base == TypeVector:
+		target, err := v.deref(pos, path)
+		if err != nil {
+			return err
+		}
+		return v.vector(t.Elem, target, path)
+	case t.object != nil && !t.object.IsStruct:
+		target, err := v.deref(pos, path)
+		if err != nil {
+			return err
+		}
+		return v.table(t.object, target, path)
+	}
+	return nil
+}
+
+func (v *verifier) string(pos int64, path string) *Error {
+	if err := v.check(pos, 4, 4, path); err != nil {
+		return err
+	}
+	n := v.u32(pos)
+	if !v.inBounds(pos+4, n+1) {
+		return v.errorf(CodeInvalidString, pos, path, "length %d exceeds buffer", n)
+	}
+	if v.buf[pos+4+n] != 0 {
+		return v.errorf(CodeInvalidString, pos, path, "missing null terminator")
+	}
+	return nil
+}
+
+func (v *verifier) vector(elem *Type, pos int64, path string) *Error {
+	if err := v.check(pos, 4, 4, path); err != nil {
+		return err
+	}
+	size, _, err := v.reg.inlineSize(elem)
+	if err != nil {
+		err.Offset, err.Path = pos, path
+		return err
+	}
+	n := v.u32(pos)
+	if !v.inBounds(pos+4, n*int64(size)) {
+		return v.errorf(CodeInvalidVector, pos, path, "%d elements of %d bytes exceed buffer", n, size)
+	}
+
+	// Elements stored by offset need their targets verified too. Union
+	// vectors are checked for bounds only.
+	byOffset := elem.Base == TypeString || (elem.object != nil && !elem.object.IsStruct) || isUnion(elem)
+	if !byOffset {
+		return nil
+	}
+	for i := int64(0); i < n; i++ {
+		epath := path + "[" + strconv.FormatInt(i, 10) + "]"
+		target, err := v.deref(pos+4+4*i, epath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case elem.Base == TypeString:
+			err = v.string(target, epath)
+		case elem.object != nil:
+			err = v.table(elem.object, target, epath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// union verifies a union field from its type and value slots. As in the
+// FlatBuffers verifier, NONE and unknown member types are accepted for
+// forward compatibility once the value offset is known to be in bounds.
+func (v *verifier) union(f *Field, t, typeVoff, valVoff, tblsize int64, path string) *Error {
+	if f.Type.Base == TypeVector {
+		if valVoff == 0 {
+			if f.Required {
+				return v.errorf(CodeRequiredFieldMissing, t, path, "required field is missing")
+			}
+			return nil
+		}
+		if err := v.field(&f.Type, t+valVoff, tblsize-valVoff, path); err != nil {
+			return err
+		}
+		if typeVoff == 0 {
+			return v.errorf(CodeInvalidUnion, t, path, "union vector has no type vector")
+		}
+		types := &Type{Base: TypeVector, Elem: &Type{Base: TypeUint8}}
+		if err := v.field(types, t+typeVoff, tblsize-typeVoff, path+"_type"); err != nil {
+			return err
+		}
+		values, _ := v.deref(t+valVoff, path)
+		typeVec, _ := v.deref(t+typeVoff, path)
+		if v.u32(values) != v.u32(typeVec) {
+			return v.errorf(CodeInvalidUnion, values, path, "%d values but %d types", v.u32(values), v.u32(typeVec))
+		}
+		return nil
+	}
+
+	var utype int64
+	if typeVoff != 0 {
+		utype = int64(v.buf[t+typeVoff])
+	}
+	if valVoff == 0 {
+		if f.Required {
+			return v.errorf(CodeRequiredFieldMissing, t, path, "required field is missing")
+		}
+		return nil
+	}
+	if valVoff+4 > tblsize {
+		return v.errorf(CodeOutOfBounds, t+valVoff, path, "field extends past end of table")
+	}
+	target, err := v.deref(t+valVoff, path)
+	if err != nil {
+		return err
+	}
+	if utype == 0 {
+		return nil
+	}
+
+	enum := f.Type.enum
+	for _, member := range enum.Values {
+		if member.Value != utype {
+			continue
+		}
+		mpath := path + "<" + member.Name + ">"
+		if member.Type == "string" {
+			return v.string(target, mpath)
+		}
+		obj, ok := v.reg.lookup(enum.Namespace, member.Type).(*Object)
+		if !ok {
+			return v.errorf(CodeUnresolvedType, target, mpath, "unresolved union member %s", member.Type)
+		}
+		if obj.IsStruct {
+			if err := v.reg.resolveObject(obj); err != nil {
+				err.Offset = target
+				return err
+			}
+			return v.check(target, int64(obj.size), int64(obj.align), mpath)
+		}
+		return v.table(obj, target, mpath)
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+package flatbuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+// Test schema
+namespace Test.Schema;
+
+attribute "priority";
+file_identifier "TEST";
+
+enum Kind : byte { A = 1, B, C }
+
+struct Vec3 {
+  x:float;
+  y:float;
+  z:float;
+}
+
+table Item {
+  name:string (required);
+  qty:int = 0;
+}
+
+union Any { Item, Alias: Item }
+
+table Root (priority: 1) {
+  id:uint;
+  label:string;
+  items:[Item];
+  pos:Vec3;
+  kind:Kind = B;
+  payload:Any;
+  tags:[string];
+  legacy:int (deprecated);
+}
+
+root_type Root;
+`
+
+// testBuilder lays out a FlatBuffer front to back. Offset fields are written
+// as placeholders and patched once their targets have been appended.
+type testBuilder struct {
+	buf  []byte
+	root int // position of the root offset
+}
+
+func newTestBuilder(ident string) *testBuilder {
+	b := &testBuilder{buf: make([]byte, 8)}
+	copy(b.buf[4:], ident)
+	return b
+}
+
+// newSizePrefixedTestBuilder starts a buffer with a size prefix, which
+// finish fills in.
+func newSizePrefixedTestBuilder(ident string) *testBuilder {
+	b := &testBuilder{buf: make([]byte, 12), root: 4}
+	copy(b.buf[8:], ident)
+	return b
+}
+
+func (b *testBuilder) finish() []byte {
+	if b.root == 4 {
+		binary.LittleEndian.PutUint32(b.buf, uint32(len(b.buf)-4))
+	}
+	return b.buf
+}
+
+func (b *testBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *testBuilder) offset(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+type tfield struct {
+	slot  int
+	data  []byte
+	align int
+}
+
+func u32Field(slot int, v uint32) tfield {
+	return tfield{slot, binary.LittleEndian.AppendUint32(nil, v), 4}
+}
+
+func offsetField(slot int) tfield {
+	return tfield{slot, make([]byte, 4), 4}
+}
+
+// table writes a vtable followed by its table and returns the table position
+// and the absolute position of each field.
+func (b *testBuilder) table(fields ...tfield) (int, []int) {
+	nslots := 0
+	rel := make([]int, len(fields))
+	size := 4
+	for i, f := range fields {
+		if f.slot+1 > nslots {
+			nslots = f.slot + 1
+		}
+		size = alignUp(size, f.align)
+		rel[i] = size
+		size += len(f.data)
+	}
+	size = alignUp(size, 4)
+
+	b.pad(2)
+	vt := len(b.buf)
+	slots := make([]uint16, nslots)
+	for i, f := range fields {
+		slots[f.slot] = uint16(rel[i])
+	}
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*nslots))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	for _, s := range slots {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, s)
+	}
+
+	b.pad(8)
+	t := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[t:], uint32(t-vt))
+	pos := make([]int, len(fields))
+	for i, f := range fields {
+		pos[i] = t + rel[i]
+		copy(b.buf[pos[i]:], f.data)
+	}
+	return t, pos
+}
+
+func (b *testBuilder) str(s string) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+// offsets writes a vector of n placeholder offsets and returns its position.
+func (b *testBuilder) offsets(n int) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(n))
+	b.buf = append(b.buf, make([]byte, 4*n)...)
+	return pos
+}
+
+func (b *testBuilder) item(name string, qty uint32) int {
+	t, pos := b.table(offsetField(0), u32Field(1, qty))
+	b.offset(pos[0], b.str(name))
+	return t
+}
+
+// buildRoot builds a valid Root buffer and returns it with the positions of
+// some of its parts.
+func buildRoot() ([]byte, map[string]int) {
+	return buildRootWith(newTestBuilder("TEST"))
+}
+
+func buildRootWith(b *testBuilder) ([]byte, map[string]int) {
+	vec3 := make([]byte, 12)
+	binary.LittleEndian.PutUint32(vec3[8:], math.Float32bits(1.5))
+	root, pos := b.table(
+		u32Field(0, 7),
+		offsetField(1),
+		offsetField(2),
+		tfield{3, vec3, 4},
+		tfield{5, []byte{1}, 1},
+		offsetField(6),
+		offsetField(7),
+	)
+	b.offset(b.root, root)
+
+	at := map[string]int{"root": root}
+	at["label"] = b.str("hello")
+	b.offset(pos[1], at["label"])
+
+	at["items"] = b.offsets(2)
+	b.offset(pos[2], at["items"])
+	at["item0"] = b.item("first", 1)
+	b.offset(at["items"]+4, at["item0"])
+	b.offset(at["items"]+8, b.item("second", 2))
+
+	at["payload"] = b.item("union", 3)
+	b.offset(pos[5], at["payload"])
+
+	at["tags"] = b.offsets(1)
+	b.offset(pos[6], at["tags"])
+	b.offset(at["tags"]+4, b.str("tag"))
+	return b.finish(), at
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	if _, err := reg.Register("TEST", []byte(testSchema)); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	return reg
+}
+
+func verifyCode(err error) Code {
+	var verr *Error
+	if errors.As(err, &verr) {
+		return verr.Code
+	}
+	return CodeOK
+}
+
+func TestVerifyValidBuffer(t *testing.T) {
+	reg := newTestRegistry(t)
+	buf, _ := buildRoot()
+	if err := reg.Verify("TEST", buf); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+}
+
+func TestVerifyFailures(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	tests := []struct {
+		name   string
+		mutate func(buf []byte, at map[string]int) []byte
+		want   Code
+		path   string
+	}{
+		{
+			name:   "too short",
+			mutate: func(buf []byte, _ map[string]int) []byte { return buf[:6] },
+			want:   CodeBufferTooShort,
+		},
+		{
+			name: "wrong identifier",
+			mutate: func(buf []byte, _ map[string]int) []byte {
+				copy(buf[4:], "NOPE")
+				return buf
+			},
+			want: CodeIdentifierMismatch,
+		},
+		{
+			name: "root offset past end",
+			mutate: func(buf []byte, _ map[string]int) []byte {
+				binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+				return buf
+			},
+			want: CodeOutOfBounds,
+		},
+		{
+			name: "misaligned root",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				binary.LittleEndian.PutUint32(buf, uint32(at["root"]+2))
+				return buf
+			},
+			want: CodeMisaligned,
+		},
+		{
+			name: "vtable out of bounds",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				binary.LittleEndian.PutUint32(buf[at["root"]:], 0x7FFFFFF0)
+				return buf
+			},
+			want: CodeInvalidVTable,
+		},
+		{
+			name: "string without terminator",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				buf[at["label"]+4+len("hello")] = 'x'
+				return buf
+			},
+			want: CodeInvalidString,
+			path: "Root.label",
+		},
+		{
+			name: "vector length past end",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				binary.LittleEndian.PutUint32(buf[at["items"]:], 1<<30)
+				return buf
+			},
+			want: CodeInvalidVector,
+			path: "Root.items",
+		},
+		{
+			name: "required field missing in vector element",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				// Drop the name slot from the first item's vtable.
+				vt := at["item0"] - int(int32(binary.LittleEndian.Uint32(buf[at["item0"]:])))
+				binary.LittleEndian.PutUint16(buf[vt+4:], 0)
+				return buf
+			},
+			want: CodeRequiredFieldMissing,
+			path: "Root.items[0].name",
+		},
+		{
+			name: "required field missing in union member",
+			mutate: func(buf []byte, at map[string]int) []byte {
+				vt := at["payload"] - int(int32(binary.LittleEndian.Uint32(buf[at["payload"]:])))
+				binary.LittleEndian.PutUint16(buf[vt+4:], 0)
+				return buf
+			},
+			want: CodeRequiredFieldMissing,
+			path: "Root.payload<Item>.name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, at := buildRoot()
+			err := reg.Verify("TEST", tt.mutate(buf, at))
+			if got := verifyCode(err); got != tt.want {
+				t.Fatalf("code = %v, want %v (err: %v)", got, tt.want, err)
+			}
+			if tt.path != "" && err.(*Error).Path != tt.path {
+				t.Errorf("path = %q, want %q", err.(*Error).Path, tt.path)
+			}
+		})
+	}
+}
+
+func TestVerifySizePrefixedBuffer(t *testing.T) {
+	reg := newTestRegistry(t)
+	buf, at := buildRootWith(newSizePrefixedTestBuilder("TEST"))
+	if err := reg.Verify("TEST", buf); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	wrong := append([]byte(nil), buf...)
+	copy(wrong[8:], "NOPE")
+	err := reg.Verify("TEST", wrong)
+	if got := verifyCode(err); got != CodeIdentifierMismatch {
+		t.Fatalf("code = %v, want %v (err: %v)", got, CodeIdentifierMismatch, err)
+	}
+	if off := err.(*Error).Offset; off != 8 {
+		t.Errorf("offset = %d, want 8", off)
+	}
+
+	// Fields are still checked at their positions in the prefixed buffer.
+	buf[at["label"]+4+len("hello")] = 'x'
+	if got := verifyCode(reg.Verify("TEST", buf)); got != CodeInvalidString {
+		t.Errorf("code = %v, want %v", got, CodeInvalidString)
+	}
+
+	// A prefix that does not match the length leaves the buffer unprefixed.
+	buf, _ = buildRootWith(newSizePrefixedTestBuilder("TEST"))
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	if err := reg.Verify("TEST", buf); err == nil {
+		t.Error("buffer with a wrong size prefix should fail")
+	}
+}
+
+func TestVerifyUnknownSchema(t *testing.T) {
+	reg := NewRegistry()
+	buf, _ := buildRoot()
+	if got := verifyCode(reg.Verify("OMM", buf)); got != CodeUnknownSchema {
+		t.Errorf("code = %v, want %v", got, CodeUnknownSchema)
+	}
+}
+
+func TestVerifyAcrossSchemas(t *testing.T) {
+	reg := NewRegistry()
+	// The root schema is registered before the file it includes.
+	_, err := reg.Register("WRAP", []byte(`
+include "item.fbs";
+namespace Wrap;
+table Wrapper { item:Test.Schema.Item (required); }
+root_type Wrapper;
+`))
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	b := newTestBuilder("")
+	root, pos := b.table(offsetField(0))
+	b.offset(0, root)
+	b.offset(pos[0], b.item("nested", 1))
+
+	if got := verifyCode(reg.Verify("WRAP", b.buf)); got != CodeUnresolvedType {
+		t.Fatalf("before include is registered: code = %v, want %v", got, CodeUnresolvedType)
+	}
+	if _, err := reg.Register("ITEM", []byte("namespace Test.Schema;\ntable Item { name:string (required); qty:int; }")); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := reg.Verify("WRAP", b.buf); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestVerifyDepthLimit(t *testing.T) {
+	reg := NewRegistry()
+	if _, err := reg.Register("NODE", []byte("table Node { child:Node; }\nroot_type Node;")); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	build := func(depth int) []byte {
+		b := newTestBuilder("")
+		prev := 0
+		for i := 0; i < depth; i++ {
+			t, pos := b.table(offsetField(0))
+			if i == 0 {
+				b.offset(0, t)
+			} else {
+				b.offset(prev, t)
+			}
+			prev = pos[0]
+		}
+		// Terminate the chain with a table that has no child.
+		t, _ := b.table()
+		b.offset(prev, t)
+		return b.buf
+	}
+
+	if err := reg.Verify("NODE", build(MaxDepth-1)); err != nil {
+		t.Errorf("chain within limit: %v", err)
+	}
+	if got := verifyCode(reg.Verify("NODE", build(MaxDepth+1))); got != CodeDepthLimit {
+		t.Errorf("code = %v, want %v", got, CodeDepthLimit)
+	}
+}
+
+func TestVerifyStructureOnly(t *testing.T) {
+	reg := NewRegistry()
+	if _, err := reg.Register("RAW", nil); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	buf, at := buildRoot()
+	if err := reg.Verify("RAW", buf); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	binary.LittleEndian.PutUint32(buf[at["root"]:], 3)
+	if got := verifyCode(reg.Verify("RAW", buf)); got != CodeInvalidVTable {
+		t.Errorf("code = %v, want %v", got, CodeInvalidVTable)
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	err := &Error{Code: CodeRequiredFieldMissing, Offset: 24, Path: "OMM.EPOCH", Msg: "required field is missing"}
+	want := "required_field_missing: required field is missing at OMM.EPOCH (offset 24)"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !strings.HasPrefix(Code(99).String(), "code_") {
+		t.Errorf("unknown code string = %q", Code(99).String())
+	}
+}